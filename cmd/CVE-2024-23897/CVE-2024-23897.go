@@ -1,18 +1,39 @@
 package main
 
 import (
+	"errors"
 	"github.com/projectdiscovery/gologger"
 	"github.com/wjlin0/CVE-2024-23897/pkg/runner"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == runner.VerifyEvidenceCommand {
+		os.Exit(runner.VerifyEvidence(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == runner.DiagnoseCommand {
+		os.Exit(runner.Diagnose(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == runner.RollupCommand {
+		os.Exit(runner.Rollup(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == runner.PruneCommand {
+		os.Exit(runner.Prune(os.Args[2:]))
+	}
 
 	newRunner, err := runner.NewRunner(runner.ParseOptions())
 	if err != nil {
 		gologger.Fatal().Msgf("new runner error: %s", err.Error())
 		return
 	}
-	if err := newRunner.RunEnumeration(); err != nil {
+	err = newRunner.RunEnumeration()
+	// Fatal 直接退出, 先关闭以写完结果文件
+	newRunner.Close()
+	if errors.Is(err, runner.ErrStrict) || errors.Is(err, runner.ErrDeviation) {
+		gologger.Error().Msgf("%s", err)
+		os.Exit(1)
+	}
+	if err != nil {
 		gologger.Fatal().Msgf("run enumeration error: %s", err.Error())
 	}
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/webhook"
+	"net/http"
+)
+
+// 示例 webhook 接收端: CVE-2024-23897 -list list.txt -webhook http://127.0.0.1:8080/
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	flag.Parse()
+
+	receiver := webhook.NewReceiver()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		before := len(receiver.Payloads())
+		receiver.ServeHTTP(w, req)
+		for _, payload := range receiver.Payloads()[before:] {
+			gologger.Info().Msgf("[%s] %s %s", payload.Finding.CheckID, payload.Finding.URL, payload.Finding.Filename)
+		}
+	})
+	gologger.Info().Msgf("listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, handler); err != nil {
+		gologger.Fatal().Msgf("listen error: %s", err)
+	}
+}
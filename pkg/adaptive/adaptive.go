@@ -0,0 +1,172 @@
+package adaptive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/projectdiscovery/gologger"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Options configures the concurrency controller
+type Options struct {
+	// Min is the starting and lowest concurrency
+	Min int
+	// Max is the highest concurrency
+	Max int
+	// Window is the number of request outcomes evaluated per adjustment
+	Window int
+	// ErrorThreshold is the failure rate of a window above which the concurrency is halved
+	ErrorThreshold float64
+	// Step is the concurrency added after a healthy window
+	Step int
+}
+
+// DefaultOptions are the defaults of the zero fields of Options
+var DefaultOptions = Options{Min: 5, Max: 30, Window: 20, ErrorThreshold: 0.1, Step: 2}
+
+// Adjustment is a concurrency change and the failure rate that caused it
+type Adjustment struct {
+	From      int
+	To        int
+	ErrorRate float64
+}
+
+// Controller limits the running workers, growing the limit additively while the failure rate
+// of the last window stays under the threshold and halving it when it doesn't. Adjustments only
+// depend on the sequence of observed outcomes
+type Controller struct {
+	options    Options
+	mutex      sync.Mutex
+	cond       *sync.Cond
+	limit      int
+	active     int
+	samples    int
+	failures   int
+	trajectory []Adjustment
+}
+
+// New returns a controller starting at options.Min
+func New(options Options) *Controller {
+	if options.Min <= 0 {
+		options.Min = DefaultOptions.Min
+	}
+	if options.Max < options.Min {
+		options.Max = options.Min
+	}
+	if options.Window <= 0 {
+		options.Window = DefaultOptions.Window
+	}
+	if options.ErrorThreshold <= 0 {
+		options.ErrorThreshold = DefaultOptions.ErrorThreshold
+	}
+	if options.Step <= 0 {
+		options.Step = DefaultOptions.Step
+	}
+	c := &Controller{options: options, limit: options.Min}
+	c.cond = sync.NewCond(&c.mutex)
+	return c
+}
+
+// Acquire blocks until a worker slot is free
+func (c *Controller) Acquire() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for c.active >= c.limit {
+		c.cond.Wait()
+	}
+	c.active++
+}
+
+// Release frees a worker slot
+func (c *Controller) Release() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.active--
+	c.cond.Broadcast()
+}
+
+// Observe records the outcome of a request and adjusts the limit at the end of a window
+func (c *Controller) Observe(failed bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.samples++
+	if failed {
+		c.failures++
+	}
+	if c.samples < c.options.Window {
+		return
+	}
+	rate := float64(c.failures) / float64(c.samples)
+	c.samples, c.failures = 0, 0
+	limit := c.limit + c.options.Step
+	if rate > c.options.ErrorThreshold {
+		limit = c.limit / 2
+	}
+	if limit < c.options.Min {
+		limit = c.options.Min
+	}
+	if limit > c.options.Max {
+		limit = c.options.Max
+	}
+	if limit == c.limit {
+		return
+	}
+	gologger.Info().Msgf("adjusting concurrency %d -> %d (error rate %.0f%%)", c.limit, limit, rate*100)
+	c.trajectory = append(c.trajectory, Adjustment{From: c.limit, To: limit, ErrorRate: rate})
+	c.limit = limit
+	c.cond.Broadcast()
+}
+
+// Limit returns the current concurrency
+func (c *Controller) Limit() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.limit
+}
+
+// Trajectory returns the adjustments made so far
+func (c *Controller) Trajectory() []Adjustment {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]Adjustment{}, c.trajectory...)
+}
+
+// TrajectoryString returns the successive limits, e.g. "5 -> 7 -> 3"
+func (c *Controller) TrajectoryString() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	limits := []string{fmt.Sprint(c.options.Min)}
+	for _, adjustment := range c.trajectory {
+		limits = append(limits, fmt.Sprint(adjustment.To))
+	}
+	return strings.Join(limits, " -> ")
+}
+
+// IsFailure reports whether a request outcome hints at exhausted capacity: timeouts, connection
+// resets and 429/502/503/504 responses. Refused connections and dns errors mean the target is
+// down and are not counted
+func IsFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case errors.Is(err, context.Canceled):
+			return false
+		case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			return true
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return true
+		}
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
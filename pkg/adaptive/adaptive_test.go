@@ -0,0 +1,110 @@
+package adaptive
+
+import (
+	"context"
+	"errors"
+	"github.com/wjlin0/CVE-2024-23897/pkg/fakejenkins"
+	"net/http"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestControllerTrajectory(t *testing.T) {
+	c := New(Options{Min: 2, Max: 8, Window: 10, ErrorThreshold: 0.2, Step: 2})
+	// 每个窗口 10 个结果, 失败数依次为 0, 0, 0, 0, 5, 1, 3
+	for _, failures := range []int{0, 0, 0, 0, 5, 1, 3} {
+		for i := 0; i < 10; i++ {
+			c.Observe(i < failures)
+		}
+	}
+	want := []Adjustment{
+		{From: 2, To: 4, ErrorRate: 0},
+		{From: 4, To: 6, ErrorRate: 0},
+		{From: 6, To: 8, ErrorRate: 0},
+		{From: 8, To: 4, ErrorRate: 0.5},
+		{From: 4, To: 6, ErrorRate: 0.1},
+		{From: 6, To: 3, ErrorRate: 0.3},
+	}
+	if got := c.Trajectory(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Trajectory() = %+v, want %+v", got, want)
+	}
+	if got := c.TrajectoryString(); got != "2 -> 4 -> 6 -> 8 -> 4 -> 6 -> 3" {
+		t.Errorf("TrajectoryString() = %q", got)
+	}
+}
+
+func TestIsFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		failed bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "not found", status: http.StatusNotFound},
+		{name: "bad gateway", status: http.StatusBadGateway, failed: true},
+		{name: "too many requests", status: http.StatusTooManyRequests, failed: true},
+		{name: "reset", err: syscall.ECONNRESET, failed: true},
+		{name: "timeout", err: context.DeadlineExceeded, failed: true},
+		{name: "refused", err: syscall.ECONNREFUSED},
+		{name: "canceled", err: context.Canceled},
+		{name: "other", err: errors.New("no such host")},
+	}
+	for _, test := range tests {
+		var resp *http.Response
+		if test.err == nil {
+			resp = &http.Response{StatusCode: test.status}
+		}
+		if failed := IsFailure(resp, test.err); failed != test.failed {
+			t.Errorf("IsFailure(%s) = %v, want %v", test.name, failed, test.failed)
+		}
+	}
+}
+
+func TestControllerCapacity(t *testing.T) {
+	const capacity = 4
+	options := fakejenkins.DefaultOptions()
+	options.MaxConcurrent = capacity
+	options.ProcessingTime = 5 * time.Millisecond
+	server := fakejenkins.NewServer(options)
+	defer server.Close()
+
+	c := New(Options{Min: 2, Max: 32, Window: 20, ErrorThreshold: 0.1, Step: 2})
+	client := &http.Client{}
+	var wg sync.WaitGroup
+	for i := 0; i < 600; i++ {
+		c.Acquire()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer c.Release()
+			resp, err := client.Head(server.URL + "/login")
+			c.Observe(IsFailure(resp, err))
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	trajectory := c.Trajectory()
+	backedOff := false
+	for _, adjustment := range trajectory {
+		// 不超过容量时不应降低并发 (窗口内可能仍有上一个并发下发出的请求)
+		if adjustment.From <= capacity && adjustment.To < adjustment.From {
+			t.Errorf("backed off below the capacity: %+v", adjustment)
+		}
+		if adjustment.To < adjustment.From {
+			backedOff = true
+		}
+	}
+	if !backedOff {
+		t.Errorf("controller never backed off: %s", c.TrajectoryString())
+	}
+	if limit := c.Limit(); limit > 3*capacity {
+		t.Errorf("Limit() = %d, want it to stay close to the capacity %d: %s", limit, capacity, c.TrajectoryString())
+	}
+}
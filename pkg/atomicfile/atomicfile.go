@@ -0,0 +1,122 @@
+package atomicfile
+
+import (
+	"bytes"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// hooks of the write steps, replaced by tests to simulate crashes
+var (
+	syncFile   = (*os.File).Sync
+	renameFile = rename
+)
+
+// File is a temporary file in the directory of its destination, renamed over the destination on
+// Commit. Until then the destination keeps its previous content
+type File struct {
+	*os.File
+	path string
+	perm fs.FileMode
+	done bool
+}
+
+// Create returns a temporary file for path, the caller must Commit or Abort it
+func Create(path string, perm fs.FileMode) (*File, error) {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	// 临时文件与目标在同一目录, 保证 rename 不跨文件系统
+	tmp, err := os.CreateTemp(dir, "."+name+".tmp-*")
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("could not create temporary file for %v", path)
+	}
+	return &File{File: tmp, path: path, perm: perm}, nil
+}
+
+// Commit flushes the temporary file to disk and renames it over the destination
+func (f *File) Commit() error {
+	if f.done {
+		return errorutil.New("%v was already committed or aborted", f.path)
+	}
+	f.done = true
+	if err := f.commit(); err != nil {
+		_ = f.File.Close()
+		_ = os.Remove(f.File.Name())
+		return err
+	}
+	syncDir(filepath.Dir(f.path))
+	return nil
+}
+
+func (f *File) commit() error {
+	if err := f.File.Chmod(f.perm); err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not set the mode of %v", f.path)
+	}
+	if err := syncFile(f.File); err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not sync %v", f.path)
+	}
+	if err := f.File.Close(); err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not close %v", f.path)
+	}
+	if err := renameFile(f.File.Name(), f.path); err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not rename temporary file to %v", f.path)
+	}
+	return nil
+}
+
+// Abort removes the temporary file, it does nothing after Commit
+func (f *File) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	_ = f.File.Close()
+	_ = os.Remove(f.File.Name())
+}
+
+// WriteFile writes data to path like os.WriteFile, a crash leaves either the previous or the new content
+func WriteFile(path string, data []byte, perm fs.FileMode) error {
+	return WriteReader(path, bytes.NewReader(data), perm)
+}
+
+// WriteReader writes the content of r to path, the destination is left untouched when r fails
+func WriteReader(path string, r io.Reader, perm fs.FileMode) error {
+	f, err := Create(path, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if _, err := io.Copy(f, r); err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not write %v", path)
+	}
+	return f.Commit()
+}
+
+// WriteFileIfChanged writes data to path unless it already holds it, and reports whether it was written
+func WriteFileIfChanged(path string, data []byte, perm fs.FileMode) (bool, error) {
+	if unchanged(path, data) {
+		return false, nil
+	}
+	if err := WriteFile(path, data, perm); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// unchanged reports whether path holds data, comparing the sizes then the hashes
+func unchanged(path string, data []byte) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != int64(len(data)) {
+		return false
+	}
+	local, err := hashFile(path)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(local, hash(data))
+}
@@ -0,0 +1,170 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingReader returns an error after n bytes like a download interrupted mid-write
+type failingReader struct {
+	r io.Reader
+	n int
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.n <= 0 {
+		return 0, errors.New("connection reset")
+	}
+	if len(p) > f.n {
+		p = p[:f.n]
+	}
+	n, err := f.r.Read(p)
+	f.n -= n
+	return n, err
+}
+
+// entries returns the names in dir
+func entries(t *testing.T, dir string) []string {
+	t.Helper()
+	list, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range list {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := WriteFile(path, []byte("first"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("second"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "second" {
+		t.Fatalf("ReadFile() = %q, %v, want %q", data, err, "second")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+	if names := entries(t, dir); len(names) != 1 {
+		t.Errorf("directory holds %v, want only the destination", names)
+	}
+}
+
+func TestCrash(t *testing.T) {
+	injected := errors.New("injected")
+	tests := []struct {
+		name   string
+		write  func(path string) error
+		sync   func(*os.File) error
+		rename func(string, string) error
+	}{
+		{
+			name: "reader fails mid-write",
+			write: func(path string) error {
+				return WriteReader(path, &failingReader{r: strings.NewReader(strings.Repeat("new", 1024)), n: 1000}, 0644)
+			},
+		},
+		{
+			name:  "sync fails",
+			write: func(path string) error { return WriteFile(path, []byte("new"), 0644) },
+			sync:  func(*os.File) error { return injected },
+		},
+		{
+			name:   "rename fails",
+			write:  func(path string) error { return WriteFile(path, []byte("new"), 0644) },
+			rename: func(string, string) error { return injected },
+		},
+		{
+			name: "aborted",
+			write: func(path string) error {
+				f, err := Create(path, 0644)
+				if err != nil {
+					return err
+				}
+				_, _ = f.WriteString("partial")
+				f.Abort()
+				return injected
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.sync != nil {
+				defer func(sync func(*os.File) error) { syncFile = sync }(syncFile)
+				syncFile = test.sync
+			}
+			if test.rename != nil {
+				defer func(rename func(string, string) error) { renameFile = rename }(renameFile)
+				renameFile = test.rename
+			}
+			dir := t.TempDir()
+			existing := filepath.Join(dir, "existing.txt")
+			if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := test.write(existing); err == nil {
+				t.Fatal("write succeeded, want the injected failure")
+			}
+			if data, err := os.ReadFile(existing); err != nil || string(data) != "old" {
+				t.Errorf("existing file = %q, %v, want the previous content", data, err)
+			}
+			missing := filepath.Join(dir, "missing.txt")
+			if err := test.write(missing); err == nil {
+				t.Fatal("write succeeded, want the injected failure")
+			}
+			if _, err := os.Stat(missing); !os.IsNotExist(err) {
+				t.Errorf("Stat(missing) = %v, want no partial file", err)
+			}
+			if names := entries(t, dir); len(names) != 1 || names[0] != "existing.txt" {
+				t.Errorf("directory holds %v, want no temporary file left", names)
+			}
+		})
+	}
+}
+
+func TestWriteFileIfChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "template.yaml")
+	for i, test := range []struct {
+		data    string
+		written bool
+	}{
+		{data: "id: a", written: true},
+		{data: "id: a"},
+		{data: "id: b", written: true},
+		{data: "id: bb", written: true},
+	} {
+		written, err := WriteFileIfChanged(path, []byte(test.data), 0644)
+		if err != nil || written != test.written {
+			t.Errorf("WriteFileIfChanged(#%d) = %v, %v, want %v", i, written, err, test.written)
+		}
+		if data, _ := os.ReadFile(path); string(data) != test.data {
+			t.Errorf("content after #%d = %q, want %q", i, data, test.data)
+		}
+	}
+}
+
+func TestCommitTwice(t *testing.T) {
+	f, err := Create(filepath.Join(t.TempDir(), "results.sarif"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Commit(); err == nil {
+		t.Error("second Commit() succeeded")
+	}
+	f.Abort()
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package atomicfile
+
+import "os"
+
+func rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// syncDir persists the rename, errors are ignored since some file systems don't support it
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package atomicfile
+
+import "os"
+
+// rename replaces newpath, windows refuses to replace a file in use such as a running executable,
+// which can still be renamed out of the way
+func rename(oldpath, newpath string) error {
+	err := os.Rename(oldpath, newpath)
+	if err == nil {
+		return nil
+	}
+	if _, statErr := os.Stat(newpath); statErr != nil {
+		return err
+	}
+	old := newpath + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(newpath, old); err != nil {
+		return err
+	}
+	if err := os.Rename(oldpath, newpath); err != nil {
+		// 恢复原文件
+		_ = os.Rename(old, newpath)
+		return err
+	}
+	// 正在运行的可执行文件无法删除, 留到下次更新时删除
+	_ = os.Remove(old)
+	return nil
+}
+
+func syncDir(string) {}
@@ -0,0 +1,230 @@
+package baseline
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/atomicfile"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"os"
+	"sort"
+	"time"
+)
+
+// SchemaVersion is the version of the baseline file
+const SchemaVersion = 1
+
+// expected verdicts of a baseline, besides scanner.VerdictPatched and scanner.VerdictNotJenkins
+const (
+	// Excluded targets are expected to be left out by -exclude or -scope, their verdict is not compared
+	Excluded = "excluded"
+)
+
+// observed verdicts of targets without a finding, besides the expected verdicts and scanner.VerdictInconclusive
+const (
+	Vulnerable  = "vulnerable"
+	Unreachable = "unreachable"
+	Skipped     = "skipped"
+	NotScanned  = "not_scanned"
+)
+
+// kinds of deviations from the baseline
+const (
+	// DeviationVulnerable is a target found vulnerable
+	DeviationVulnerable = "vulnerable"
+	// DeviationMissing is an expected target not scanned, unreachable, skipped or no longer jenkins
+	DeviationMissing = "missing"
+	// DeviationInconclusive is an expected target whose detection was inconclusive
+	DeviationInconclusive = "inconclusive"
+	// DeviationNewJenkins is a patched jenkins the baseline doesn't expect
+	DeviationNewJenkins = "new-jenkins"
+)
+
+// Baseline is the expected verdict per target of a fleet
+type Baseline struct {
+	SchemaVersion int       `json:"schema-version"`
+	Created       time.Time `json:"created,omitempty"`
+	// Targets maps the targets to their expected verdict: patched, not_jenkins or excluded
+	Targets map[string]string `json:"targets"`
+}
+
+// ValidExpected reports whether verdict can be expected by a baseline
+func ValidExpected(verdict string) bool {
+	return verdict == scanner.VerdictPatched || verdict == scanner.VerdictNotJenkins || verdict == Excluded
+}
+
+// Read reads the baseline file at path, normalize returns the key of a target as the run records it
+func Read(path string, normalize func(target string) string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &Baseline{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s: %w", path, err)
+	}
+	if b.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("baseline %s has schema version %d, this version reads up to %d", path, b.SchemaVersion, SchemaVersion)
+	}
+	targets := make(map[string]string, len(b.Targets))
+	for target, expected := range b.Targets {
+		if !ValidExpected(expected) {
+			return nil, fmt.Errorf("baseline %s: invalid expected verdict %q of %s, use %s, %s or %s", path, expected, target,
+				scanner.VerdictPatched, scanner.VerdictNotJenkins, Excluded)
+		}
+		if key := normalize(target); key != "" {
+			targets[key] = expected
+		}
+	}
+	b.Targets = targets
+	return b, nil
+}
+
+// Write writes the baseline to path
+func (b *Baseline) Write(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Observations are the verdicts of the targets of a run
+type Observations map[string]string
+
+// severity orders the observed verdicts, a target keeps its most severe one
+func severity(verdict string) int {
+	switch verdict {
+	case Vulnerable:
+		return 6
+	case scanner.VerdictAuthConfirmed:
+		return 5
+	case scanner.VerdictAuthRequired:
+		return 4
+	case scanner.VerdictPatched:
+		return 3
+	case scanner.VerdictInconclusive:
+		return 2
+	case scanner.VerdictNotJenkins, Unreachable:
+		return 1
+	}
+	return 0
+}
+
+// Record records the verdict of target unless a more severe one was recorded
+func (o Observations) Record(target, verdict string) {
+	if current, ok := o[target]; !ok || severity(verdict) > severity(current) {
+		o[target] = verdict
+	}
+}
+
+// isVulnerable reports whether an observed verdict is a finding
+func isVulnerable(verdict string) bool {
+	return verdict == Vulnerable || verdict == scanner.VerdictAuthConfirmed || verdict == scanner.VerdictAuthRequired
+}
+
+// New returns the baseline expecting the observations of a run. Vulnerable targets are expected patched,
+// targets without a conclusive verdict are left out
+func New(observations Observations, now time.Time) (b *Baseline, omitted int) {
+	b = &Baseline{SchemaVersion: SchemaVersion, Created: now, Targets: make(map[string]string)}
+	for target, verdict := range observations {
+		switch {
+		case isVulnerable(verdict):
+			b.Targets[target] = scanner.VerdictPatched
+		case ValidExpected(verdict):
+			b.Targets[target] = verdict
+		default:
+			omitted++
+		}
+	}
+	return b, omitted
+}
+
+// Deviation is a target whose observed verdict deviates from the baseline
+type Deviation struct {
+	Target string `json:"target"`
+	Kind   string `json:"kind"`
+	// Expected is empty for targets not in the baseline
+	Expected string `json:"expected,omitempty"`
+	Observed string `json:"observed"`
+}
+
+// Report is the compliance of a run with a baseline
+type Report struct {
+	Baseline string `json:"baseline"`
+	// Expected is the number of targets of the baseline
+	Expected   int          `json:"expected"`
+	Compliant  int          `json:"compliant"`
+	Deviations []*Deviation `json:"deviations"`
+}
+
+// Compare compares the observations of a run with the baseline, the deviations are sorted by kind and target
+func Compare(b *Baseline, observations Observations) *Report {
+	report := &Report{Expected: len(b.Targets), Deviations: []*Deviation{}}
+	for target, expected := range b.Targets {
+		observed, ok := observations[target]
+		if !ok {
+			observed = NotScanned
+		}
+		if kind := deviation(expected, observed); kind != "" {
+			report.Deviations = append(report.Deviations, &Deviation{Target: target, Kind: kind, Expected: expected, Observed: observed})
+			continue
+		}
+		report.Compliant++
+	}
+	for target, observed := range observations {
+		if _, ok := b.Targets[target]; ok {
+			continue
+		}
+		switch {
+		case isVulnerable(observed):
+			report.Deviations = append(report.Deviations, &Deviation{Target: target, Kind: DeviationVulnerable, Observed: observed})
+		case observed == scanner.VerdictPatched:
+			report.Deviations = append(report.Deviations, &Deviation{Target: target, Kind: DeviationNewJenkins, Observed: observed})
+		}
+	}
+	sort.Slice(report.Deviations, func(i, j int) bool {
+		a, b := report.Deviations[i], report.Deviations[j]
+		if a.Kind != b.Kind {
+			return kindOrder(a.Kind) < kindOrder(b.Kind)
+		}
+		return a.Target < b.Target
+	})
+	return report
+}
+
+// deviation returns the kind of the deviation of an expected target, empty when it complies
+func deviation(expected, observed string) string {
+	switch {
+	case isVulnerable(observed):
+		return DeviationVulnerable
+	case expected == Excluded:
+		return ""
+	case observed == scanner.VerdictInconclusive:
+		return DeviationInconclusive
+	case observed == NotScanned || observed == Unreachable || observed == Skipped || observed == Excluded:
+		return DeviationMissing
+	case expected == scanner.VerdictPatched && observed == scanner.VerdictNotJenkins:
+		return DeviationMissing
+	case expected == scanner.VerdictNotJenkins && observed == scanner.VerdictPatched:
+		return DeviationNewJenkins
+	}
+	return ""
+}
+
+func kindOrder(kind string) int {
+	for i, k := range []string{DeviationVulnerable, DeviationNewJenkins, DeviationMissing, DeviationInconclusive} {
+		if k == kind {
+			return i
+		}
+	}
+	return 4
+}
+
+// Write writes the report to path as JSON
+func (r *Report) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,103 @@
+package baseline
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+)
+
+func TestCompare(t *testing.T) {
+	b := &Baseline{Targets: map[string]string{
+		"http://patched":      scanner.VerdictPatched,
+		"http://regressed":    scanner.VerdictPatched,
+		"http://gone":         scanner.VerdictPatched,
+		"http://not-scanned":  scanner.VerdictPatched,
+		"http://timeout":      scanner.VerdictPatched,
+		"http://web":          scanner.VerdictNotJenkins,
+		"http://now-jenkins":  scanner.VerdictNotJenkins,
+		"http://out-of-scope": Excluded,
+	}}
+	observations := Observations{}
+	for target, verdict := range map[string]string{
+		"http://patched":      scanner.VerdictPatched,
+		"http://regressed":    scanner.VerdictAuthConfirmed,
+		"http://gone":         scanner.VerdictNotJenkins,
+		"http://timeout":      scanner.VerdictInconclusive,
+		"http://web":          scanner.VerdictNotJenkins,
+		"http://now-jenkins":  scanner.VerdictPatched,
+		"http://out-of-scope": Unreachable,
+		// 不在基线中的目标
+		"http://new":        scanner.VerdictPatched,
+		"http://new-vuln":   Vulnerable,
+		"http://other-host": scanner.VerdictNotJenkins,
+	} {
+		observations.Record(target, verdict)
+	}
+	report := Compare(b, observations)
+	want := []*Deviation{
+		{Target: "http://new-vuln", Kind: DeviationVulnerable, Observed: Vulnerable},
+		{Target: "http://regressed", Kind: DeviationVulnerable, Expected: scanner.VerdictPatched, Observed: scanner.VerdictAuthConfirmed},
+		{Target: "http://new", Kind: DeviationNewJenkins, Observed: scanner.VerdictPatched},
+		{Target: "http://now-jenkins", Kind: DeviationNewJenkins, Expected: scanner.VerdictNotJenkins, Observed: scanner.VerdictPatched},
+		{Target: "http://gone", Kind: DeviationMissing, Expected: scanner.VerdictPatched, Observed: scanner.VerdictNotJenkins},
+		{Target: "http://not-scanned", Kind: DeviationMissing, Expected: scanner.VerdictPatched, Observed: NotScanned},
+		{Target: "http://timeout", Kind: DeviationInconclusive, Expected: scanner.VerdictPatched, Observed: scanner.VerdictInconclusive},
+	}
+	if !reflect.DeepEqual(report.Deviations, want) {
+		for _, deviation := range report.Deviations {
+			t.Logf("%+v", *deviation)
+		}
+		t.Errorf("Compare() deviations differ")
+	}
+	if report.Expected != 8 || report.Compliant != 3 {
+		t.Errorf("Compare() = %d/%d compliant, want 3/8", report.Compliant, report.Expected)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	observations := Observations{}
+	// 多个检查的结果保留最严重的
+	for _, verdict := range []string{scanner.VerdictPatched, Vulnerable, scanner.VerdictAuthRequired} {
+		observations.Record("http://a", verdict)
+	}
+	if observations["http://a"] != Vulnerable {
+		t.Errorf("Record() = %s, want %s", observations["http://a"], Vulnerable)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	observations := Observations{
+		"http://a:8080": Vulnerable,
+		"http://b":      scanner.VerdictNotJenkins,
+		"http://c":      Excluded,
+		"http://d":      scanner.VerdictInconclusive,
+	}
+	b, omitted := New(observations, time.Now())
+	if omitted != 1 {
+		t.Errorf("New() omitted %d, want 1", omitted)
+	}
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := b.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(path, func(target string) string { return strings.ToLower(target) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"http://a:8080": scanner.VerdictPatched, "http://b": scanner.VerdictNotJenkins, "http://c": Excluded}
+	if !reflect.DeepEqual(read.Targets, want) {
+		t.Errorf("Read() = %v, want %v", read.Targets, want)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"schema-version":1,"targets":{"http://a":"vulnerable"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path, strings.ToLower); err == nil || !strings.Contains(err.Error(), "invalid expected verdict") {
+		t.Errorf("Read() of an invalid verdict = %v", err)
+	}
+}
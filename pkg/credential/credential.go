@@ -0,0 +1,276 @@
+package credential
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// names of the credentials used by the tool
+const (
+	// GitHubToken authenticates the updater github api calls
+	GitHubToken = "github-token"
+	// GitLabToken authenticates the updater gitlab api calls and downloads
+	GitLabToken = "gitlab-token"
+	// GiteaToken authenticates the updater gitea or forgejo api calls and downloads
+	GiteaToken = "gitea-token"
+	// JenkinsAuth are the user:api-token credentials used on targets refusing anonymous users
+	JenkinsAuth = "jenkins-auth"
+)
+
+// defaultEnv are the environment variables the credentials are read from when no provider is selected,
+// the first one set is used
+var defaultEnv = map[string][]string{
+	GitHubToken: {"GITHUB_TOKEN", "GH_TOKEN"},
+	GitLabToken: {"GITLAB_TOKEN"},
+	GiteaToken:  {"GITEA_TOKEN"},
+	JenkinsAuth: {"JENKINS_AUTH"},
+}
+
+// Names returns the names of the credentials used by the tool
+func Names() []string {
+	return []string{GitHubToken, GitLabToken, GiteaToken, JenkinsAuth}
+}
+
+// CommandTimeout is the time a command provider has to print the secret
+var CommandTimeout = 30 * time.Second
+
+// ErrNotFound is returned by providers explicitly selected for a credential they don't hold
+var ErrNotFound = errors.New("credential not found")
+
+// Provider returns the secret of a credential, an empty secret when it's not set
+type Provider interface {
+	Secret(ctx context.Context, name string) (string, error)
+	// String describes the provider without the secret
+	String() string
+}
+
+// Env reads the secret from an environment variable
+type Env struct {
+	Variable string
+	// Fallbacks are read in order when Variable is not set
+	Fallbacks []string
+}
+
+func (e *Env) Secret(_ context.Context, _ string) (string, error) {
+	for _, variable := range append([]string{e.Variable}, e.Fallbacks...) {
+		if secret := os.Getenv(variable); variable != "" && secret != "" {
+			return secret, nil
+		}
+	}
+	return "", nil
+}
+
+func (e *Env) String() string {
+	return "env:" + strings.Join(append([]string{e.Variable}, e.Fallbacks...), ",")
+}
+
+// Static is a secret set by the program, e.g. a token passed to the updater by a caller
+type Static struct {
+	Value string
+}
+
+func (s *Static) Secret(_ context.Context, _ string) (string, error) {
+	return s.Value, nil
+}
+
+func (s *Static) String() string {
+	return "static"
+}
+
+// File reads the secret from a name=secret line of a credentials file which must not be readable by
+// other users, like ssh keys
+type File struct {
+	Path string
+}
+
+// DefaultFile returns the credentials file in the user config dir
+func DefaultFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "CVE-2024-23897", "credentials")
+}
+
+func (f *File) Secret(_ context.Context, name string) (string, error) {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("could not read credentials file %s: %w", f.Path, err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("credentials file %s is accessible by other users (mode %04o), it must be 0600", f.Path, info.Mode().Perm())
+	}
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("could not read credentials file %s: %w", f.Path, err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(key) == name {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("could not read credentials file %s: %w", f.Path, err)
+	}
+	return "", fmt.Errorf("%s in %s: %w", name, f.Path, ErrNotFound)
+}
+
+func (f *File) String() string {
+	return "file:" + f.Path
+}
+
+// Command runs a shell command and reads the secret from the first line of its stdout, e.g. pass show jenkins/token
+type Command struct {
+	Command string
+}
+
+func (c *Command) Secret(ctx context.Context, name string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, CommandTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", c.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", c.Command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	// 错误中不包含输出, 避免泄露密钥
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("credential command of %s failed: %w", name, err)
+	}
+	secret, _, _ := strings.Cut(stdout.String(), "\n")
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return "", fmt.Errorf("credential command of %s printed nothing: %w", name, ErrNotFound)
+	}
+	return secret, nil
+}
+
+func (c *Command) String() string {
+	return "command:" + c.Command
+}
+
+// ParseSpec parses a name=provider selection, the provider being env:VARIABLE, file, file:PATH or command:COMMAND
+func ParseSpec(spec string) (string, Provider, error) {
+	name, value, ok := strings.Cut(spec, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", nil, fmt.Errorf("invalid credential %q, want name=provider", spec)
+	}
+	if _, ok := defaultEnv[name]; !ok {
+		return "", nil, fmt.Errorf("unknown credential %s (available: %s)", name, strings.Join(Names(), ","))
+	}
+	kind, arg, _ := strings.Cut(strings.TrimSpace(value), ":")
+	switch kind {
+	case "env":
+		if arg == "" {
+			return "", nil, fmt.Errorf("credential %s: env provider requires a variable", name)
+		}
+		return name, &Env{Variable: arg}, nil
+	case "file":
+		if arg == "" {
+			arg = DefaultFile()
+		}
+		return name, &File{Path: arg}, nil
+	case "command":
+		if strings.TrimSpace(arg) == "" {
+			return "", nil, fmt.Errorf("credential %s: command provider requires a command", name)
+		}
+		return name, &Command{Command: arg}, nil
+	default:
+		return "", nil, fmt.Errorf("credential %s: unknown provider %q (available: env, file, command)", name, kind)
+	}
+}
+
+// Store returns the secrets of the credentials from their selected provider, the environment by
+// default. Secrets are fetched once and kept in memory for the run
+type Store struct {
+	mutex     sync.Mutex
+	providers map[string]Provider
+	secrets   map[string]string
+}
+
+// NewStore returns a store reading every credential from its default environment variable
+func NewStore() *Store {
+	return &Store{providers: make(map[string]Provider), secrets: make(map[string]string)}
+}
+
+// Default is the store of the tool
+var Default = NewStore()
+
+// Select reads the credential name from provider
+func (s *Store) Select(name string, provider Provider) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.providers[name] = provider
+	delete(s.secrets, name)
+}
+
+// SelectSpecs selects the providers of name=provider specs
+func (s *Store) SelectSpecs(specs []string) error {
+	for _, spec := range specs {
+		name, provider, err := ParseSpec(spec)
+		if err != nil {
+			return err
+		}
+		s.Select(name, provider)
+	}
+	return nil
+}
+
+// Provider returns the provider of the credential name
+func (s *Store) Provider(name string) Provider {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.provider(name)
+}
+
+func (s *Store) provider(name string) Provider {
+	if provider, ok := s.providers[name]; ok {
+		return provider
+	}
+	variables := defaultEnv[name]
+	if len(variables) == 0 {
+		return &Env{}
+	}
+	return &Env{Variable: variables[0], Fallbacks: variables[1:]}
+}
+
+// Get returns the secret of the credential name, empty when it's not set
+func (s *Store) Get(ctx context.Context, name string) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if secret, ok := s.secrets[name]; ok {
+		return secret, nil
+	}
+	secret, err := s.provider(name).Secret(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	s.secrets[name] = secret
+	return secret, nil
+}
+
+// Get returns the secret of the credential name from the default store
+func Get(name string) (string, error) {
+	return Default.Get(context.Background(), name)
+}
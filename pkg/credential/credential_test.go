@@ -0,0 +1,136 @@
+package credential
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		spec     string
+		name     string
+		provider string
+		wantErr  bool
+	}{
+		{spec: "github-token=env:GH_TOKEN", name: GitHubToken, provider: "env:GH_TOKEN"},
+		{spec: "jenkins-auth=file:/etc/cve/credentials", name: JenkinsAuth, provider: "file:/etc/cve/credentials"},
+		{spec: "jenkins-auth=file", name: JenkinsAuth, provider: "file:" + DefaultFile()},
+		{spec: "github-token=command:pass show a:b", name: GitHubToken, provider: "command:pass show a:b"},
+		{spec: "github-token", wantErr: true},
+		{spec: "github-token=env", wantErr: true},
+		{spec: "github-token=command:", wantErr: true},
+		{spec: "github-token=vault:secret/github", wantErr: true},
+		{spec: "gitub-token=env:GH_TOKEN", wantErr: true},
+	}
+	for _, test := range tests {
+		name, provider, err := ParseSpec(test.spec)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseSpec(%q) error = %v, want error %v", test.spec, err, test.wantErr)
+			continue
+		}
+		if err == nil && (name != test.name || provider.String() != test.provider) {
+			t.Errorf("ParseSpec(%q) = %s, %s, want %s, %s", test.spec, name, provider, test.name, test.provider)
+		}
+	}
+}
+
+func writeCredentials(t *testing.T, mode os.FileMode) string {
+	path := filepath.Join(t.TempDir(), "credentials")
+	content := "# engagement credentials\ngithub-token = ghp_file\njenkins-auth=admin:11a2b3c4\n"
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFile(t *testing.T) {
+	file := &File{Path: writeCredentials(t, 0600)}
+	for name, want := range map[string]string{GitHubToken: "ghp_file", JenkinsAuth: "admin:11a2b3c4"} {
+		if secret, err := file.Secret(context.Background(), name); err != nil || secret != want {
+			t.Errorf("Secret(%s) = %q, %v, want %q", name, secret, err, want)
+		}
+	}
+	if _, err := file.Secret(context.Background(), "smtp-password"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Secret() of a missing credential = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFileRejectsLoosePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on windows")
+	}
+	file := &File{Path: writeCredentials(t, 0644)}
+	secret, err := file.Secret(context.Background(), GitHubToken)
+	if err == nil || secret != "" {
+		t.Fatalf("Secret() = %q, %v, want an error", secret, err)
+	}
+	if strings.Contains(err.Error(), "ghp_file") {
+		t.Errorf("error leaks the secret: %v", err)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	tests := []struct {
+		command string
+		want    string
+		wantErr bool
+	}{
+		// pass show 在第一行输出密码, 之后是其他字段
+		{command: "printf 'ghp_command\\nlogin: bot\\n'", want: "ghp_command"},
+		{command: "true", wantErr: true},
+		{command: "echo ghp_leaked; exit 3", wantErr: true},
+	}
+	for _, test := range tests {
+		secret, err := (&Command{Command: test.command}).Secret(context.Background(), GitHubToken)
+		if (err != nil) != test.wantErr || secret != test.want {
+			t.Errorf("Secret() of %q = %q, %v, want %q", test.command, secret, err, test.want)
+		}
+		if err != nil && strings.Contains(err.Error(), "ghp_leaked") {
+			t.Errorf("error leaks the command output: %v", err)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghp_env")
+	store := NewStore()
+	if secret, err := store.Get(context.Background(), GitHubToken); err != nil || secret != "ghp_env" {
+		t.Errorf("Get() = %q, %v, want the default environment variable", secret, err)
+	}
+	// GITHUB_TOKEN 未设置时读取 GH_TOKEN
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "ghp_gh")
+	if secret, err := NewStore().Get(context.Background(), GitHubToken); err != nil || secret != "ghp_gh" {
+		t.Errorf("Get() = %q, %v, want the fallback environment variable", secret, err)
+	}
+	if secret, err := store.Get(context.Background(), JenkinsAuth); err != nil || secret != "" {
+		t.Errorf("Get() of an unset credential = %q, %v, want empty", secret, err)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	counter := filepath.Join(t.TempDir(), "runs")
+	if err := store.SelectSpecs([]string{"github-token=command:echo run >> " + counter + "; echo ghp_command"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if secret, err := store.Get(context.Background(), GitHubToken); err != nil || secret != "ghp_command" {
+			t.Fatalf("Get() = %q, %v, want the selected provider", secret, err)
+		}
+	}
+	// 密钥只获取一次
+	if runs, _ := os.ReadFile(counter); strings.Count(string(runs), "run") != 1 {
+		t.Errorf("command ran %d times, want once", strings.Count(string(runs), "run"))
+	}
+}
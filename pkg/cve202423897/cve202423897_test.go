@@ -0,0 +1,65 @@
+package cve202423897
+
+import (
+	"context"
+	"github.com/wjlin0/CVE-2024-23897/pkg/fakejenkins"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *fakejenkins.Options
+		vul     bool
+		full    bool
+	}{
+		{name: "vulnerable", options: fakejenkins.DefaultOptions(), vul: true, full: true},
+		{name: "anonymous read disabled", options: &fakejenkins.Options{Files: map[string]string{"/etc/passwd": fakejenkins.DefaultPasswd}}, vul: true, full: false},
+		{name: "patched", options: &fakejenkins.Options{Files: map[string]string{"/etc/passwd": fakejenkins.DefaultPasswd}, AnonymousRead: true, Patched: true}, vul: false, full: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakejenkins.NewServer(test.options)
+			defer server.Close()
+			result, err := Detect(context.Background(), server.URL, &Options{UploadDelay: 100 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Vulnerable != test.vul || result.FullRead != test.full {
+				t.Errorf("Detect() = (%v, %v), want (%v, %v)", result.Vulnerable, result.FullRead, test.vul, test.full)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	server := fakejenkins.NewServer(fakejenkins.DefaultOptions())
+	defer server.Close()
+	result, err := ReadFile(context.Background(), server.URL, "reload-job", "/etc/passwd", &Options{UploadDelay: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Content != strings.TrimSuffix(fakejenkins.DefaultPasswd, "\n") {
+		t.Errorf("ReadFile() = %q, want %q", result.Content, fakejenkins.DefaultPasswd)
+	}
+}
+
+// TestDependencies guards the facade against pulling in the cli dependencies
+func TestDependencies(t *testing.T) {
+	out, err := exec.Command("go", "list", "-deps", "-f", "{{if not .Standard}}{{.ImportPath}}{{end}}", ".").Output()
+	if err != nil {
+		t.Skipf("go list: %v", err)
+	}
+	allowed := map[string]bool{
+		"github.com/wjlin0/CVE-2024-23897/pkg/cve202423897": true,
+		"github.com/wjlin0/CVE-2024-23897/pkg/protocol":     true,
+	}
+	for _, dep := range strings.Fields(string(out)) {
+		if !allowed[dep] {
+			t.Errorf("unexpected dependency %s", dep)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// categories of the outbound requests
+const (
+	UpdaterAPI      = "updater-api"
+	UpdaterDownload = "updater-download"
+	Fingerprint     = "fingerprint"
+	Exploit         = "exploit"
+	Webhook         = "webhook"
+	Timestamp       = "timestamp"
+)
+
+// ErrBudgetExceeded is returned for the requests sent once the byte budget is exceeded
+var ErrBudgetExceeded = errors.New("egress budget exceeded")
+
+// Default is the counter of the process, shared by the updater and the scanner
+var Default = New()
+
+// Usage is the number of bytes sent and received, headers are approximated
+type Usage struct {
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received"`
+}
+
+// Total returns the bytes sent and received
+func (u Usage) Total() int64 {
+	return u.Sent + u.Received
+}
+
+// usage is the usage of a category updated concurrently
+type usage struct {
+	sent, received atomic.Int64
+}
+
+// Counter counts the bytes of the outbound requests per category. Children count into their parent
+// too, the budget of the root refuses new requests once the total exceeds it
+type Counter struct {
+	parent     *Counter
+	mutex      sync.Mutex
+	categories map[string]*usage
+	total      atomic.Int64
+	budget     atomic.Int64
+}
+
+// New returns a counter without budget
+func New() *Counter {
+	return &Counter{categories: make(map[string]*usage)}
+}
+
+// Child returns a counter of a part of the traffic of c, e.g. a single update, which also counts into c
+func (c *Counter) Child() *Counter {
+	child := New()
+	child.parent = c
+	return child
+}
+
+// SetBudget sets the byte budget of the requests, zero disables it
+func (c *Counter) SetBudget(budget int64) {
+	c.root().budget.Store(budget)
+}
+
+func (c *Counter) root() *Counter {
+	for c.parent != nil {
+		c = c.parent
+	}
+	return c
+}
+
+// Exceeded reports whether the budget is exceeded
+func (c *Counter) Exceeded() bool {
+	root := c.root()
+	budget := root.budget.Load()
+	return budget > 0 && root.total.Load() > budget
+}
+
+// Budget returns the byte budget, zero when unlimited
+func (c *Counter) Budget() int64 {
+	return c.root().budget.Load()
+}
+
+func (c *Counter) category(name string) *usage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	u, ok := c.categories[name]
+	if !ok {
+		u = &usage{}
+		c.categories[name] = u
+	}
+	return u
+}
+
+// Add counts bytes sent and received in category
+func (c *Counter) Add(category string, sent, received int64) {
+	for ; c != nil; c = c.parent {
+		u := c.category(category)
+		u.sent.Add(sent)
+		u.received.Add(received)
+		c.total.Add(sent + received)
+	}
+}
+
+// Usage returns the usage per category
+func (c *Counter) Usage() map[string]Usage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	usages := make(map[string]Usage, len(c.categories))
+	for name, u := range c.categories {
+		usages[name] = Usage{Sent: u.sent.Load(), Received: u.received.Load()}
+	}
+	return usages
+}
+
+// Total returns the bytes sent and received in every category
+func (c *Counter) Total() int64 {
+	return c.total.Load()
+}
+
+// String returns the usage per category, e.g. "exploit 1024 (sent 512, received 512)"
+func (c *Counter) String() string {
+	usages := c.Usage()
+	names := make([]string, 0, len(usages))
+	for name := range usages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		u := usages[name]
+		parts = append(parts, fmt.Sprintf("%s %d (sent %d, received %d)", name, u.Total(), u.Sent, u.Received))
+	}
+	return strings.Join(parts, ", ")
+}
+
+type contextKey struct{}
+
+// WithCategory makes the requests of ctx count in category instead of the category of their transport
+func WithCategory(ctx context.Context, category string) context.Context {
+	return context.WithValue(ctx, contextKey{}, category)
+}
+
+// Transport returns a transport counting the requests of base in category, nil uses http.DefaultTransport
+func (c *Counter) Transport(category string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, counter: c, category: category}
+}
+
+type transport struct {
+	base     http.RoundTripper
+	counter  *Counter
+	category string
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	category := t.category
+	if value, ok := req.Context().Value(contextKey{}).(string); ok {
+		category = value
+	}
+	if t.counter.Exceeded() {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, fmt.Errorf("%w (%d bytes)", ErrBudgetExceeded, t.counter.Budget())
+	}
+	sent := int64(len(req.Method) + len(req.URL.RequestURI()) + len(req.Host) + 12 + headerSize(req.Header))
+	if req.Body != nil && req.Body != http.NoBody {
+		// 按实际发送的字节计数, 请求体的长度可能未知
+		req = req.Clone(req.Context())
+		req.Body = &body{ReadCloser: req.Body, add: func(n int64) { t.counter.Add(category, n, 0) }}
+	}
+	t.counter.Add(category, sent, 0)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	t.counter.Add(category, 0, int64(len(resp.Proto)+len(resp.Status)+4+headerSize(resp.Header)))
+	if resp.Body != nil {
+		// 按读取的字节计数, 流式读取和提前关闭的响应也准确
+		resp.Body = &body{ReadCloser: resp.Body, add: func(n int64) { t.counter.Add(category, 0, n) }}
+	}
+	return resp, nil
+}
+
+func headerSize(header http.Header) int {
+	size := 0
+	for k, values := range header {
+		for _, v := range values {
+			size += len(k) + len(v) + 4
+		}
+	}
+	return size
+}
+
+type body struct {
+	io.ReadCloser
+	add func(n int64)
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.add(int64(n))
+	return n, err
+}
@@ -0,0 +1,97 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	payload := strings.Repeat("x", 64*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		// 分块发送, 没有 Content-Length
+		for i := 0; i < 4; i++ {
+			_, _ = io.WriteString(w, payload[:len(payload)/4])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		body     string
+		read     int64
+		category string
+	}{
+		{name: "streamed", read: -1, category: Exploit},
+		{name: "aborted", read: 1000, category: Exploit},
+		{name: "upload", body: strings.Repeat("y", 5000), read: -1, category: Exploit},
+		{name: "context category", read: -1, category: Fingerprint},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counter := New()
+			client := &http.Client{Transport: counter.Transport(Exploit, nil)}
+			ctx := context.Background()
+			if test.category != Exploit {
+				ctx = WithCategory(ctx, test.category)
+			}
+			request, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, io.NopCloser(strings.NewReader(test.body)))
+			resp, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var read int64
+			if test.read < 0 {
+				read, _ = io.Copy(io.Discard, resp.Body)
+			} else {
+				read, _ = io.CopyN(io.Discard, resp.Body, test.read)
+			}
+			_ = resp.Body.Close()
+			usage := counter.Usage()[test.category]
+			// 头部为估算值
+			if headers := usage.Received - read; headers <= 0 || headers > 512 {
+				t.Errorf("received %d bytes for a body of %d", usage.Received, read)
+			}
+			if headers := usage.Sent - int64(len(test.body)); headers <= 0 || headers > 512 {
+				t.Errorf("sent %d bytes for a body of %d", usage.Sent, len(test.body))
+			}
+			if counter.Total() != usage.Total() {
+				t.Errorf("Total() = %d, want %d", counter.Total(), usage.Total())
+			}
+		})
+	}
+}
+
+func TestBudget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("x", 2048))
+	}))
+	defer server.Close()
+
+	root := New()
+	root.SetBudget(1024)
+	child := root.Child()
+	client := &http.Client{Transport: child.Transport(UpdaterDownload, nil)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if child.Total() != root.Total() || !child.Exceeded() || !root.Exceeded() {
+		t.Fatalf("child total %d, root total %d, exceeded %v", child.Total(), root.Total(), root.Exceeded())
+	}
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("request over budget = %v, want %v", err, ErrBudgetExceeded)
+	}
+	root.SetBudget(0)
+	if root.Exceeded() {
+		t.Error("Exceeded() without budget")
+	}
+}
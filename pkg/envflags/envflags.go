@@ -0,0 +1,126 @@
+package envflags
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Prefix is the prefix of the environment variables setting flags
+const Prefix = "CVE23897_"
+
+// Flag is a flag with its aliases and the environment variable setting it
+type Flag struct {
+	// Names are the names of the flag, the longest first
+	Names []string
+	// Env is the environment variable setting the flag
+	Env   string
+	Usage string
+}
+
+// Name returns the environment variable of a flag name, e.g. CVE23897_RATE_LIMIT for rate-limit
+func Name(name string) string {
+	return Prefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// Flags returns the flags of fs sorted by name, aliases of a flag share one environment variable
+// named after the longest alias. Flags named in exclude, such as callbacks, are left out
+func Flags(fs *flag.FlagSet, exclude ...string) []*Flag {
+	excluded := make(map[string]struct{}, len(exclude))
+	for _, name := range exclude {
+		excluded[name] = struct{}{}
+	}
+	byValue := make(map[flag.Value]*Flag)
+	var flags []*Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := excluded[f.Name]; ok {
+			return
+		}
+		// 短名称和长名称注册的是同一个 flag.Value
+		if existing, ok := byValue[f.Value]; ok {
+			existing.Names = append(existing.Names, f.Name)
+			return
+		}
+		item := &Flag{Names: []string{f.Name}, Usage: f.Usage}
+		byValue[f.Value] = item
+		flags = append(flags, item)
+	})
+	for _, f := range flags {
+		sort.SliceStable(f.Names, func(i, j int) bool { return len(f.Names[i]) > len(f.Names[j]) })
+		f.Env = Name(f.Names[0])
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Names[0] < flags[j].Names[0] })
+	return flags
+}
+
+// isBoolFlag reports whether the flag takes no value on the command line
+func isBoolFlag(value flag.Value) bool {
+	b, ok := value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// given returns the flag names present in args, as the flag package parses them
+func given(fs *flag.FlagSet, args []string) map[string]struct{} {
+	names := make(map[string]struct{})
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) < 2 || arg[0] != '-' {
+			// flag 包遇到第一个非 flag 参数时停止解析
+			break
+		}
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		name, _, hasValue := strings.Cut(name, "=")
+		names[name] = struct{}{}
+		f := fs.Lookup(name)
+		if f != nil && !hasValue && !isBoolFlag(f.Value) {
+			i++
+		}
+	}
+	return names
+}
+
+// Args returns args preceded by the flags set through the environment which args doesn't set.
+// The values are parsed by the flags themselves, so booleans and lists behave as on the command
+// line. A value set on the command line wins over the environment, which wins over the config file
+// merged later for flags still holding their default
+func Args(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool), exclude ...string) []string {
+	set := given(fs, args)
+	var envArgs []string
+	for _, f := range Flags(fs, exclude...) {
+		value, ok := lookupEnv(f.Env)
+		if !ok {
+			continue
+		}
+		onCommandLine := false
+		for _, name := range f.Names {
+			if _, ok := set[name]; ok {
+				onCommandLine = true
+			}
+		}
+		if onCommandLine {
+			continue
+		}
+		envArgs = append(envArgs, fmt.Sprintf("-%s=%s", f.Names[0], value))
+	}
+	return append(envArgs, args...)
+}
+
+// PrintHelp writes the environment variable of every flag
+func PrintHelp(w io.Writer, fs *flag.FlagSet, exclude ...string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ENVIRONMENT VARIABLE\tFLAG\tDESCRIPTION")
+	for _, f := range Flags(fs, exclude...) {
+		names := make([]string, 0, len(f.Names))
+		for _, name := range f.Names {
+			names = append(names, "-"+name)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Env, strings.Join(names, ", "), f.Usage)
+	}
+	_ = tw.Flush()
+}
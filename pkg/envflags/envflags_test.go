@@ -0,0 +1,151 @@
+package envflags
+
+import (
+	"bytes"
+	"github.com/projectdiscovery/goflags"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type config struct {
+	URL      goflags.StringSlice
+	Headers  goflags.StringSlice
+	Thread   int
+	Debug    bool
+	NoColor  bool
+	Webhook  string
+	Timeout  time.Duration
+	Callback bool
+}
+
+func newFlagSet(c *config) *goflags.FlagSet {
+	flagSet := goflags.NewFlagSet()
+	flagSet.StringSliceVarP(&c.URL, "url", "u", nil, "URL to scan", goflags.FileCommaSeparatedStringSliceOptions)
+	flagSet.StringSliceVar(&c.Headers, "header", nil, "custom headers", goflags.FileCommaSeparatedStringSliceOptions)
+	flagSet.IntVarP(&c.Thread, "thread", "t", 30, "threads")
+	flagSet.BoolVar(&c.Debug, "debug", false, "debug")
+	flagSet.BoolVar(&c.NoColor, "no-color", false, "no color")
+	flagSet.StringVar(&c.Webhook, "webhook", "", "webhook url")
+	flagSet.DurationVarP(&c.Timeout, "input-read-timeout", "irt", time.Minute, "timeout")
+	flagSet.CallbackVar(func() { c.Callback = true }, "version", "show version")
+	return flagSet
+}
+
+// parse sets the flags from args and env like ParseOptions
+func parse(t *testing.T, args []string, env map[string]string) *config {
+	t.Helper()
+	c := &config{}
+	flagSet := newFlagSet(c)
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	if err := flagSet.CommandLine.Parse(Args(flagSet.CommandLine, args, lookup, "version")); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestFlags(t *testing.T) {
+	flagSet := newFlagSet(&config{})
+	var got []string
+	for _, f := range Flags(flagSet.CommandLine, "version") {
+		got = append(got, f.Env+"="+strings.Join(f.Names, "|"))
+	}
+	want := []string{
+		"CVE23897_DEBUG=debug",
+		"CVE23897_HEADER=header",
+		"CVE23897_INPUT_READ_TIMEOUT=input-read-timeout|irt",
+		"CVE23897_NO_COLOR=no-color",
+		"CVE23897_THREAD=thread|t",
+		"CVE23897_URL=url|u",
+		"CVE23897_WEBHOOK=webhook",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Flags() = %v, want %v", got, want)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want *config
+	}{
+		{
+			name: "defaults",
+			want: &config{Thread: 30, Timeout: time.Minute},
+		},
+		{
+			name: "env only",
+			env: map[string]string{
+				"CVE23897_THREAD":             "5",
+				"CVE23897_DEBUG":              "true",
+				"CVE23897_NO_COLOR":           "1",
+				"CVE23897_WEBHOOK":            "https://example.com/hook?a=b",
+				"CVE23897_URL":                "a.example.com,b.example.com",
+				"CVE23897_HEADER":             "Cookie: a=b",
+				"CVE23897_INPUT_READ_TIMEOUT": "30s",
+			},
+			want: &config{
+				Thread: 5, Debug: true, NoColor: true, Webhook: "https://example.com/hook?a=b",
+				URL: goflags.StringSlice{"a.example.com", "b.example.com"}, Headers: goflags.StringSlice{"Cookie: a=b"},
+				Timeout: 30 * time.Second,
+			},
+		},
+		{
+			name: "command line wins over env",
+			args: []string{"-t", "7", "-u", "c.example.com", "-debug=false", "-irt=5s"},
+			env:  map[string]string{"CVE23897_THREAD": "5", "CVE23897_URL": "a.example.com", "CVE23897_DEBUG": "true", "CVE23897_INPUT_READ_TIMEOUT": "30s"},
+			want: &config{Thread: 7, URL: goflags.StringSlice{"c.example.com"}, Timeout: 5 * time.Second},
+		},
+		{
+			name: "false boolean",
+			env:  map[string]string{"CVE23897_DEBUG": "false", "CVE23897_NO_COLOR": "0"},
+			want: &config{Thread: 30, Timeout: time.Minute},
+		},
+		{
+			name: "flags after positional arguments are not parsed",
+			args: []string{"positional", "-t", "7"},
+			env:  map[string]string{"CVE23897_THREAD": "5"},
+			want: &config{Thread: 5, Timeout: time.Minute},
+		},
+		{
+			name: "callbacks are not settable",
+			env:  map[string]string{"CVE23897_VERSION": "true"},
+			want: &config{Thread: 30, Timeout: time.Minute},
+		},
+	}
+	for _, test := range tests {
+		if got := parse(t, test.args, test.env); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parsed %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestArgsInvalidBoolean(t *testing.T) {
+	c := &config{}
+	flagSet := newFlagSet(c)
+	flagSet.CommandLine.Init("test", 0)
+	flagSet.CommandLine.SetOutput(&bytes.Buffer{})
+	lookup := func(name string) (string, bool) { return "yes", name == "CVE23897_DEBUG" }
+	if err := flagSet.CommandLine.Parse(Args(flagSet.CommandLine, nil, lookup)); err == nil {
+		t.Error("Parse() accepted CVE23897_DEBUG=yes, which -debug=yes rejects")
+	}
+}
+
+func TestPrintHelp(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	PrintHelp(buffer, newFlagSet(&config{}).CommandLine, "version")
+	for _, want := range []string{"CVE23897_THREAD", "-thread, -t", "CVE23897_INPUT_READ_TIMEOUT"} {
+		if !strings.Contains(buffer.String(), want) {
+			t.Errorf("PrintHelp() = %q, want %q", buffer.String(), want)
+		}
+	}
+	if strings.Contains(buffer.String(), "CVE23897_VERSION") {
+		t.Errorf("PrintHelp() lists the excluded callback")
+	}
+}
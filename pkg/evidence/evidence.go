@@ -0,0 +1,129 @@
+package evidence
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// fieldPrefix is the prefix of the result fields describing the evidence, left out of the bundle
+const fieldPrefix = "evidence-"
+
+// Canonical returns the evidence bundle of a result JSON object: the object without its evidence
+// fields, with sorted keys and the numbers as written, so the bundle of a stored result line is
+// the bundle hashed at capture time whichever version of the tool reads it
+func Canonical(result []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(result))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("could not decode result: %w", err)
+	}
+	for key := range fields {
+		if strings.HasPrefix(key, fieldPrefix) {
+			delete(fields, key)
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// Hash returns the sha256 of the evidence bundle of v, a result or its JSON
+func Hash(v interface{}) ([]byte, error) {
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	bundle, err := Canonical(data)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(bundle)
+	return sum[:], nil
+}
+
+// HexHash returns the hex sha256 of the evidence bundle of v
+func HexHash(v interface{}) (string, error) {
+	sum, err := Hash(v)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// ErrHashMismatch is returned when a stored result doesn't match its evidence hash
+var ErrHashMismatch = errors.New("result does not match its evidence hash")
+
+// stored are the evidence fields of a stored result
+type stored struct {
+	URL       string `json:"url"`
+	SHA256    string `json:"evidence-sha256"`
+	Timestamp string `json:"evidence-timestamp"`
+	TSA       string `json:"evidence-tsa"`
+	Time      string `json:"evidence-time"`
+	Retention string `json:"retention"`
+}
+
+// Verification is the outcome of verifying a stored result
+type Verification struct {
+	URL string
+	// Hashed is false for results stored without an evidence hash
+	Hashed      bool
+	Timestamped bool
+	// Time is the time asserted by the timestamp token
+	Time time.Time
+	// TSA is the subject of the certificate which signed the timestamp token
+	TSA string
+	Err error
+}
+
+// Verify checks a stored result line matches its evidence hash and, when it carries a timestamp
+// token, that the token is over the hash and signed by a TSA chaining to roots, the system roots when nil
+func Verify(line []byte, roots *x509.CertPool) *Verification {
+	var fields stored
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return &Verification{Err: fmt.Errorf("could not decode result: %w", err)}
+	}
+	v := &Verification{URL: fields.URL, Hashed: fields.SHA256 != ""}
+	if !v.Hashed {
+		return v
+	}
+	sum, err := Hash(line)
+	if err != nil {
+		v.Err = err
+		return v
+	}
+	if !strings.EqualFold(hex.EncodeToString(sum), fields.SHA256) {
+		v.Err = ErrHashMismatch
+		if fields.Retention != "" {
+			v.Err = fmt.Errorf("%w, its leaked content was %s by the retention policy", ErrHashMismatch, fields.Retention)
+		}
+		return v
+	}
+	if fields.Timestamp == "" {
+		return v
+	}
+	v.Timestamped = true
+	der, err := base64.StdEncoding.DecodeString(fields.Timestamp)
+	if err != nil {
+		v.Err = fmt.Errorf("could not decode timestamp token: %w", err)
+		return v
+	}
+	token, err := ParseToken(der)
+	if err != nil {
+		v.Err = err
+		return v
+	}
+	v.Time, v.TSA = token.Time, token.TSA()
+	v.Err = token.Verify(sum, roots)
+	return v
+}
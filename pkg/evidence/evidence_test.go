@@ -0,0 +1,123 @@
+package evidence
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type result struct {
+	URL       string `json:"url"`
+	Response  string `json:"response"`
+	Chunks    int    `json:"chunks"`
+	SHA256    string `json:"evidence-sha256,omitempty"`
+	Timestamp string `json:"evidence-timestamp,omitempty"`
+	TSA       string `json:"evidence-tsa,omitempty"`
+}
+
+func TestCanonical(t *testing.T) {
+	// 字段顺序、证据字段和数字的写法不影响证据包
+	a, err := Canonical([]byte(`{"url":"http://a","chunks":10000000000000001,"evidence-sha256":"00"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Canonical([]byte(`{"chunks":10000000000000001,"url":"http://a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a, b) || string(a) != `{"chunks":10000000000000001,"url":"http://a"}` {
+		t.Errorf("Canonical() = %s and %s", a, b)
+	}
+	first, _ := HexHash(&result{URL: "http://a", Response: "root:x:0:0"})
+	second, _ := HexHash(&result{URL: "http://a", Response: "root:x:0:0", SHA256: first})
+	if first != second {
+		t.Errorf("HexHash() depends on the evidence fields: %s != %s", first, second)
+	}
+}
+
+func stamp(t *testing.T, tsa *fakeTSA, r *result) []byte {
+	sum, err := Hash(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SHA256 = hex.EncodeToString(sum)
+	if tsa != nil {
+		token, err := Request(context.Background(), tsa.Client(), tsa.URL, sum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Timestamp, r.TSA = base64.StdEncoding.EncodeToString(token.Raw), tsa.URL
+	}
+	line, _ := json.Marshal(r)
+	return line
+}
+
+func TestVerify(t *testing.T) {
+	tsa := newFakeTSA(t)
+	hashOnly := stamp(t, nil, &result{URL: "http://a", Response: "root:x:0:0"})
+	timestamped := stamp(t, tsa, &result{URL: "http://b", Response: "root:x:0:0", Chunks: 2})
+	tampered := bytes.Replace(timestamped, []byte("root:x:0:0"), []byte("root:x:0:1"), 1)
+
+	var otherToken result
+	_ = json.Unmarshal(stamp(t, tsa, &result{URL: "http://c"}), &otherToken)
+	var swapped result
+	_ = json.Unmarshal(timestamped, &swapped)
+	swapped.Timestamp = otherToken.Timestamp
+	swappedLine, _ := json.Marshal(swapped)
+
+	tests := []struct {
+		name        string
+		line        []byte
+		timestamped bool
+		want        error
+	}{
+		{name: "hash only", line: hashOnly},
+		{name: "timestamped", line: timestamped, timestamped: true},
+		{name: "tampered response", line: tampered, want: ErrHashMismatch},
+		{name: "token of another result", line: swappedLine, timestamped: true, want: ErrImprintMismatch},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := Verify(test.line, tsa.roots)
+			if !errors.Is(v.Err, test.want) || (v.Err == nil) != (test.want == nil) {
+				t.Fatalf("Verify() = %v, want %v", v.Err, test.want)
+			}
+			if !v.Hashed || v.Timestamped != test.timestamped {
+				t.Errorf("Verify() hashed %v timestamped %v, want timestamped %v", v.Hashed, v.Timestamped, test.timestamped)
+			}
+			if test.timestamped && test.want == nil && (!v.Time.Equal(tsa.now) || v.TSA != "CN=Fake TSA") {
+				t.Errorf("Verify() time %v tsa %q, want %v CN=Fake TSA", v.Time, v.TSA, tsa.now)
+			}
+		})
+	}
+	purged := bytes.Replace(hashOnly, []byte(`"response":"root:x:0:0"`), []byte(`"retention":"purged"`), 1)
+	if v := Verify(purged, nil); !errors.Is(v.Err, ErrHashMismatch) || !strings.Contains(v.Err.Error(), "purged by the retention policy") {
+		t.Errorf("Verify() of a purged result = %v, want a mismatch naming the retention policy", v.Err)
+	}
+	if v := Verify(timestamped, nil); v.Err == nil || !strings.Contains(v.Err.Error(), "untrusted") {
+		t.Errorf("Verify() with the system roots = %v, want an untrusted tsa", v.Err)
+	}
+}
+
+func TestRequestFailures(t *testing.T) {
+	digest := sha256.Sum256([]byte("bundle"))
+	tsa := newFakeTSA(t)
+	tsa.status = 2
+	if _, err := Request(context.Background(), tsa.Client(), tsa.URL, digest[:]); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("Request() = %v, want a rejection", err)
+	}
+	tsa.status, tsa.tamper = 0, true
+	if _, err := Request(context.Background(), tsa.Client(), tsa.URL, digest[:]); !errors.Is(err, ErrImprintMismatch) {
+		t.Errorf("Request() = %v, want ErrImprintMismatch", err)
+	}
+	tsa.Close()
+	if _, err := Request(context.Background(), tsa.Client(), tsa.URL, digest[:]); err == nil {
+		t.Error("Request() to a closed tsa succeeded")
+	}
+}
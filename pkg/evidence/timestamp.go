@@ -0,0 +1,390 @@
+package evidence
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSHA1          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSA         = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+)
+
+// ErrImprintMismatch is returned when a timestamp token is not over the evidence hash
+var ErrImprintMismatch = errors.New("timestamp token is not over the evidence hash")
+
+// RFC 3161 请求与响应
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Accuracy       accuracy  `asn1:"optional"`
+	Ordering       bool      `asn1:"optional"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+// CMS SignedData, RFC 5652
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// Token is a parsed RFC 3161 timestamp token
+type Token struct {
+	// Raw is the DER of the token, the CMS SignedData ContentInfo
+	Raw          []byte
+	Time         time.Time
+	SerialNumber *big.Int
+	Policy       asn1.ObjectIdentifier
+	// Imprint is the hash the token is over
+	Imprint      []byte
+	Nonce        *big.Int
+	Certificates []*x509.Certificate
+
+	signedData signedData
+}
+
+// Request asks the TSA at url for a timestamp token over the sha256 digest
+func Request(ctx context.Context, client *http.Client, url string, digest []byte) (*Token, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	req, err := asn1.Marshal(timeStampReq{
+		Version:        1,
+		MessageImprint: messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}, HashedMessage: digest},
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/timestamp-query")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tsa returned status %d", resp.StatusCode)
+	}
+	var tsResp timeStampResp
+	if _, err := asn1.Unmarshal(body, &tsResp); err != nil {
+		return nil, fmt.Errorf("could not parse tsa response: %w", err)
+	}
+	// 0 granted, 1 grantedWithMods
+	if tsResp.Status.Status > 1 {
+		return nil, fmt.Errorf("tsa rejected the request: status %d %s", tsResp.Status.Status, strings.Join(tsResp.Status.StatusString, " "))
+	}
+	token, err := ParseToken(tsResp.TimeStampToken.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	if token.Nonce == nil || token.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("tsa response nonce does not match the request")
+	}
+	if !bytes.Equal(token.Imprint, digest) {
+		return nil, ErrImprintMismatch
+	}
+	return token, nil
+}
+
+// ParseToken parses the DER of a timestamp token
+func ParseToken(der []byte) (*Token, error) {
+	var info contentInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("could not parse timestamp token: %v", err)
+	}
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("timestamp token is not a signed data but %v", info.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("could not parse timestamp token signed data: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("timestamp token content is not a TSTInfo but %v", sd.EncapContentInfo.EContentType)
+	}
+	var tst tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &tst); err != nil {
+		return nil, fmt.Errorf("could not parse timestamp token info: %w", err)
+	}
+	token := &Token{
+		Raw:          der,
+		Time:         tst.GenTime,
+		SerialNumber: tst.SerialNumber,
+		Policy:       tst.Policy,
+		Imprint:      tst.MessageImprint.HashedMessage,
+		Nonce:        tst.Nonce,
+		signedData:   sd,
+	}
+	if !tst.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) {
+		return nil, fmt.Errorf("timestamp token imprint is not a sha256 but %v", tst.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	if len(sd.Certificates.Bytes) != 0 {
+		certificates, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse timestamp token certificates: %w", err)
+		}
+		token.Certificates = certificates
+	}
+	return token, nil
+}
+
+// Verify checks the token is over the sha256 digest and signed by a timestamping certificate
+// chaining to roots, the system roots when nil
+func (t *Token) Verify(digest []byte, roots *x509.CertPool) error {
+	if !bytes.Equal(t.Imprint, digest) {
+		return ErrImprintMismatch
+	}
+	if len(t.signedData.SignerInfos) != 1 {
+		return fmt.Errorf("timestamp token has %d signers, want 1", len(t.signedData.SignerInfos))
+	}
+	signer := t.signedData.SignerInfos[0]
+	certificate, err := t.signerCertificate(signer)
+	if err != nil {
+		return err
+	}
+	hash, err := hashOf(signer.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	if len(signer.SignedAttrs.Bytes) == 0 {
+		return errors.New("timestamp token has no signed attributes")
+	}
+	if err := checkSignedAttributes(signer.SignedAttrs.Bytes, hash, t.signedData.EncapContentInfo.EContent); err != nil {
+		return err
+	}
+	// 签名覆盖的是 SET OF 编码的签名属性, 而不是 [0] IMPLICIT
+	signed := append([]byte{0x31}, signer.SignedAttrs.FullBytes[1:]...)
+	algorithm, err := signatureAlgorithm(signer.SignatureAlgorithm.Algorithm, hash)
+	if err != nil {
+		return err
+	}
+	if err := certificate.CheckSignature(algorithm, signed, signer.Signature); err != nil {
+		return fmt.Errorf("invalid timestamp token signature: %w", err)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range t.Certificates {
+		if c != certificate {
+			intermediates.AddCert(c)
+		}
+	}
+	_, err = certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   t.Time,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return fmt.Errorf("untrusted timestamp authority %q: %w", certificate.Subject.String(), err)
+	}
+	return nil
+}
+
+// TSA returns the subject of the certificate which signed the token, empty when it carries none
+func (t *Token) TSA() string {
+	if len(t.signedData.SignerInfos) == 0 {
+		return ""
+	}
+	if certificate, err := t.signerCertificate(t.signedData.SignerInfos[0]); err == nil {
+		return certificate.Subject.String()
+	}
+	return ""
+}
+
+func (t *Token) signerCertificate(signer signerInfo) (*x509.Certificate, error) {
+	switch {
+	case signer.SID.Class == asn1.ClassUniversal && signer.SID.Tag == asn1.TagSequence:
+		var sid issuerAndSerial
+		if _, err := asn1.Unmarshal(signer.SID.FullBytes, &sid); err != nil {
+			return nil, fmt.Errorf("could not parse timestamp token signer: %w", err)
+		}
+		for _, c := range t.Certificates {
+			if c.SerialNumber.Cmp(sid.SerialNumber) == 0 && bytes.Equal(c.RawIssuer, sid.Issuer.FullBytes) {
+				return c, nil
+			}
+		}
+	case signer.SID.Class == asn1.ClassContextSpecific && signer.SID.Tag == 0:
+		for _, c := range t.Certificates {
+			if bytes.Equal(c.SubjectKeyId, signer.SID.Bytes) {
+				return c, nil
+			}
+		}
+	}
+	return nil, errors.New("timestamp token does not carry its signer certificate")
+}
+
+func checkSignedAttributes(attrs []byte, hash crypto.Hash, content []byte) error {
+	var contentTypeOK, digestOK bool
+	for rest := attrs; len(rest) > 0; {
+		var attr attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return fmt.Errorf("could not parse timestamp token signed attributes: %w", err)
+		}
+		switch {
+		case attr.Type.Equal(oidContentType):
+			var contentType asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &contentType); err != nil || !contentType.Equal(oidTSTInfo) {
+				return errors.New("timestamp token signed content type is not a TSTInfo")
+			}
+			contentTypeOK = true
+		case attr.Type.Equal(oidMessageDigest):
+			var digest []byte
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &digest); err != nil {
+				return fmt.Errorf("could not parse timestamp token message digest: %w", err)
+			}
+			h := hash.New()
+			h.Write(content)
+			if !bytes.Equal(h.Sum(nil), digest) {
+				return errors.New("timestamp token content does not match its signed digest")
+			}
+			digestOK = true
+		}
+	}
+	if !contentTypeOK || !digestOK {
+		return errors.New("timestamp token signed attributes lack the content type or message digest")
+	}
+	return nil
+}
+
+func hashOf(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	}
+	return 0, fmt.Errorf("unsupported timestamp token digest algorithm %v", oid)
+}
+
+// signatureAlgorithm returns the x509 signature algorithm of a CMS signature algorithm, which
+// is either a bare key algorithm combined with the digest algorithm or a full signature algorithm
+func signatureAlgorithm(oid asn1.ObjectIdentifier, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	byHash := map[crypto.Hash][2]x509.SignatureAlgorithm{
+		crypto.SHA1:   {x509.SHA1WithRSA, x509.ECDSAWithSHA1},
+		crypto.SHA256: {x509.SHA256WithRSA, x509.ECDSAWithSHA256},
+		crypto.SHA384: {x509.SHA384WithRSA, x509.ECDSAWithSHA384},
+		crypto.SHA512: {x509.SHA512WithRSA, x509.ECDSAWithSHA512},
+	}
+	switch {
+	case oid.Equal(oidRSA):
+		return byHash[hash][0], nil
+	case oid.Equal(oidECDSA):
+		return byHash[hash][1], nil
+	}
+	full := map[string]x509.SignatureAlgorithm{
+		"1.2.840.113549.1.1.5":  x509.SHA1WithRSA,
+		"1.2.840.113549.1.1.11": x509.SHA256WithRSA,
+		"1.2.840.113549.1.1.12": x509.SHA384WithRSA,
+		"1.2.840.113549.1.1.13": x509.SHA512WithRSA,
+		"1.2.840.10045.4.1":     x509.ECDSAWithSHA1,
+		"1.2.840.10045.4.3.2":   x509.ECDSAWithSHA256,
+		"1.2.840.10045.4.3.3":   x509.ECDSAWithSHA384,
+		"1.2.840.10045.4.3.4":   x509.ECDSAWithSHA512,
+	}
+	if algorithm, ok := full[oid.String()]; ok {
+		return algorithm, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported timestamp token signature algorithm %v", oid)
+}
@@ -0,0 +1,378 @@
+package fakejenkins
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 以下为 jenkins-cli 明文协议的操作码 (hudson.cli.PlainCLIProtocol.Op)
+const (
+	opArg    byte = 0
+	opLocale byte = 1
+	opStart  byte = 3
+	opExit   byte = 4
+	opStderr byte = 8
+)
+
+// DefaultPasswd is the /etc/passwd content served by a default fixture.
+const DefaultPasswd = `root:x:0:0:root:/root:/bin/bash
+daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin
+bin:x:2:2:bin:/bin:/usr/sbin/nologin
+jenkins:x:1000:1000::/var/jenkins_home:/bin/bash`
+
+// DefaultVersion is the Jenkins version announced by a default fixture.
+const DefaultVersion = "2.440"
+
+type Options struct {
+	// Files maps absolute paths to the content leaked through @file expansion.
+	Files map[string]string
+	// Version is announced through the X-Jenkins header.
+	Version string
+	// InstanceIdentity is announced through the X-Instance-Identity header.
+	InstanceIdentity string
+	// AnonymousRead allows anonymous users to run commands requiring Overall/Read.
+	AnonymousRead bool
+	// DenyAnonymous refuses every command to anonymous users, even who-am-i and help.
+	DenyAnonymous bool
+	// Users maps user names to the api tokens authenticating them through basic auth,
+	// authenticated users may run every command.
+	Users map[string]string
+	// Patched disables args4j @file expansion as done by fixed releases.
+	Patched bool
+	// SessionTimeout bounds the time a download side waits for its upload side.
+	SessionTimeout time.Duration
+	// LoginPagePadding inflates the login page by the given number of bytes.
+	LoginPagePadding int
+	// StripHeaderOnHead omits X-Jenkins on HEAD requests like some reverse proxies do.
+	StripHeaderOnHead bool
+	// MaxConcurrent simulates a capacity limit, requests beyond it get 503 like an overloaded proxy.
+	MaxConcurrent int
+	// ProcessingTime is spent on every request counted against MaxConcurrent.
+	ProcessingTime time.Duration
+	// OutputLineCaps caps the leaked lines per command like servers truncating the error channel.
+	OutputLineCaps map[string]int
+	// BlockedUserAgent makes requests whose User-Agent contains it get 403 like behind a WAF.
+	BlockedUserAgent string
+	// Server is announced through the Server header like a reverse proxy naming its os.
+	Server string
+	// Windows prints the paths of missing files with backslashes like java on windows does.
+	Windows bool
+	// Silent lists the files whose reads get no output at all, like proxies dropping the stderr frames.
+	Silent []string
+}
+
+// DefaultOptions returns options of a vulnerable instance allowing full file reads.
+func DefaultOptions() *Options {
+	return &Options{
+		Files:          map[string]string{"/etc/passwd": DefaultPasswd},
+		Version:        DefaultVersion,
+		AnonymousRead:  true,
+		SessionTimeout: 10 * time.Second,
+	}
+}
+
+// Server is an in-process fake Jenkins speaking the full-duplex /cli protocol.
+type Server struct {
+	*httptest.Server
+	options  *Options
+	mutex    sync.Mutex
+	sessions map[string]chan []string
+	inflight atomic.Int64
+}
+
+// NewServer starts a plain http fake Jenkins server
+func NewServer(options *Options) *Server {
+	s := newServer(options)
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// NewTLSServer starts a https fake Jenkins server with a self-signed certificate
+func NewTLSServer(options *Options) *Server {
+	s := newServer(options)
+	s.Server = httptest.NewTLSServer(s)
+	return s
+}
+
+func newServer(options *Options) *Server {
+	if options == nil {
+		options = DefaultOptions()
+	}
+	if options.SessionTimeout <= 0 {
+		options.SessionTimeout = 10 * time.Second
+	}
+	return &Server{options: options, sessions: make(map[string]chan []string)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.options.MaxConcurrent > 0 {
+		// 处理结束后才写入响应, 保证客户端收到响应时计数已经减少
+		inflight := s.inflight.Add(1)
+		if inflight > int64(s.options.MaxConcurrent) {
+			s.inflight.Add(-1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(s.options.ProcessingTime)
+		s.inflight.Add(-1)
+	}
+	if s.options.BlockedUserAgent != "" && strings.Contains(r.UserAgent(), s.options.BlockedUserAgent) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if s.options.Version != "" && !(s.options.StripHeaderOnHead && r.Method == http.MethodHead) {
+		w.Header().Set("X-Jenkins", s.options.Version)
+	}
+	if s.options.InstanceIdentity != "" {
+		w.Header().Set("X-Instance-Identity", s.options.InstanceIdentity)
+	}
+	if s.options.Server != "" {
+		w.Header().Set("Server", s.options.Server)
+	}
+	switch r.URL.Path {
+	case "/cli":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		switch r.Header.Get("Side") {
+		case "download":
+			s.download(w, r)
+		case "upload":
+			s.upload(w, r)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	case "/", "/login":
+		w.Header().Set("Content-Type", "text/html;charset=utf-8")
+		_, _ = fmt.Fprintf(w, `<html><head><meta name="generator" content="Jenkins %s"></head><body>Sign in [Jenkins]`, s.options.Version)
+		if s.options.LoginPagePadding > 0 {
+			_, _ = fmt.Fprintf(w, "<!-- %s -->", strings.Repeat("x", s.options.LoginPagePadding))
+		}
+		_, _ = fmt.Fprint(w, `</body></html>`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *Server) session(uid string) chan []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ch, ok := s.sessions[uid]
+	if !ok {
+		ch = make(chan []string, 1)
+		s.sessions[uid] = ch
+	}
+	return ch
+}
+
+func (s *Server) release(uid string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.sessions, uid)
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	args, err := parseArgs(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.session(r.Header.Get("Session")) <- args
+}
+
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	uid := r.Header.Get("Session")
+	defer s.release(uid)
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte{0x00})
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	var args []string
+	select {
+	case args = <-s.session(uid):
+	case <-time.After(s.options.SessionTimeout):
+		return
+	case <-r.Context().Done():
+		return
+	}
+	lines, code := s.run(args, s.authenticated(r))
+	if s.silent(args) {
+		lines = nil
+	}
+	for _, line := range lines {
+		_, _ = w.Write(frame(opStderr, []byte(line+"\n")))
+	}
+	exit := make([]byte, 4)
+	binary.BigEndian.PutUint32(exit, uint32(code))
+	_, _ = w.Write(frame(opExit, exit))
+}
+
+// silent reports whether the args read one of the Silent files
+func (s *Server) silent(args []string) bool {
+	for _, arg := range args {
+		for _, file := range s.options.Silent {
+			if arg == "@"+file {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authenticated reports whether the request carries the api token of a user
+func (s *Server) authenticated(r *http.Request) bool {
+	user, token, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	expected, ok := s.options.Users[user]
+	return ok && expected == token
+}
+
+// run 模拟 jenkins 执行命令, 返回 stderr 中的每一行以及退出码
+func (s *Server) run(args []string, authenticated bool) ([]string, int) {
+	if len(args) == 0 {
+		return []string{"ERROR: You must specify the command to execute"}, 255
+	}
+	if s.options.DenyAnonymous && !authenticated {
+		return []string{"ERROR: anonymous is missing the Overall/Read permission"}, 6
+	}
+	command, args := args[0], s.expand(args[1:])
+	usage := fmt.Sprintf("java -jar jenkins-cli.jar %s", command)
+	switch command {
+	case "help":
+		if len(args) == 0 {
+			return helpLines(), 0
+		}
+		if len(args) > 1 {
+			return []string{"ERROR: Too many arguments: " + args[1], usage + " [COMMAND]"}, 2
+		}
+		return []string{"ERROR: No such command " + args[0]}, 3
+	case "who-am-i", "version":
+		if len(args) > 0 {
+			return []string{"ERROR: No argument is allowed: " + args[0], usage}, 2
+		}
+		if command == "version" {
+			return []string{s.options.Version}, 0
+		}
+		return []string{"Authenticated as: anonymous", "Authorities:", "  anonymous"}, 0
+	case "reload-job", "connect-node":
+		if !s.options.AnonymousRead && !authenticated {
+			return []string{"ERROR: anonymous is missing the Overall/Read permission"}, 6
+		}
+		if len(args) == 0 {
+			return []string{"ERROR: Argument \"NAME\" is required", usage + " NAME ..."}, 2
+		}
+		if limit, ok := s.options.OutputLineCaps[command]; ok && len(args) > limit {
+			args = args[:limit]
+		}
+		var lines []string
+		for _, arg := range args {
+			if command == "reload-job" {
+				lines = append(lines, fmt.Sprintf("%s: No such item ?%s? exists.", arg, arg))
+			} else {
+				lines = append(lines, fmt.Sprintf("%s: No such agent \"%s\" exists.", arg, arg))
+			}
+		}
+		lines = append(lines, "", "ERROR: Error occurred while performing this command, see previous stderr output.")
+		return lines, 5
+	default:
+		return []string{fmt.Sprintf("ERROR: No such command %s", command)}, 255
+	}
+}
+
+// expand 模拟 args4j 对 @file 参数的展开
+func (s *Server) expand(args []string) []string {
+	if s.options.Patched {
+		return args
+	}
+	var expanded []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "@") {
+			expanded = append(expanded, arg)
+			continue
+		}
+		content, ok := s.options.Files[strings.TrimPrefix(arg, "@")]
+		if !ok {
+			name := strings.TrimPrefix(arg, "@")
+			if s.options.Windows {
+				name = strings.ReplaceAll(name, "/", `\`)
+			}
+			return []string{"No such file: " + name}
+		}
+		scanner := bufio.NewScanner(strings.NewReader(content))
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				expanded = append(expanded, line)
+			}
+		}
+	}
+	return expanded
+}
+
+func helpLines() []string {
+	commands := [][2]string{
+		{"connect-node", "Reconnect to a node(s)"},
+		{"help", "Lists all the available commands or a detailed description of single command."},
+		{"reload-job", "Reload job(s)"},
+		{"version", "Outputs the current version."},
+		{"who-am-i", "Reports your credential and permissions."},
+	}
+	var lines []string
+	for _, command := range commands {
+		lines = append(lines, "  "+command[0], "    "+command[1])
+	}
+	return lines
+}
+
+// parseArgs 解析 upload 请求中的参数帧, 直到 START 帧
+func parseArgs(body io.Reader) ([]string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	for len(data) >= 5 {
+		length := int(binary.BigEndian.Uint32(data[:4]))
+		op := data[4]
+		data = data[5:]
+		if length > len(data) {
+			return nil, fmt.Errorf("invalid frame length: %d", length)
+		}
+		payload := data[:length]
+		data = data[length:]
+		switch op {
+		case opArg:
+			if len(payload) < 2 {
+				return nil, fmt.Errorf("invalid argument frame")
+			}
+			args = append(args, string(payload[2:]))
+		case opLocale:
+		case opStart:
+			return args, nil
+		}
+	}
+	return nil, fmt.Errorf("missing start frame")
+}
+
+func frame(op byte, payload []byte) []byte {
+	buffer := bytes.Buffer{}
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(payload)))
+	buffer.Write(length)
+	buffer.WriteByte(op)
+	buffer.Write(payload)
+	return buffer.Bytes()
+}
@@ -0,0 +1,94 @@
+package i18n
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultLanguage is the language of the messages missing from a translation
+const DefaultLanguage = "en"
+
+// ErrUnknownLanguage is returned when a catalog has no message file for a language
+var ErrUnknownLanguage = errors.New("unknown language")
+
+// Catalog returns the messages of a language, loaded from a <lang>.json file of key to message,
+// falling back to the default language and then to the key for missing messages
+type Catalog struct {
+	lang     string
+	messages map[string]string
+	fallback map[string]string
+}
+
+// Languages returns the languages with a message file in fsys
+func Languages(fsys fs.FS) ([]string, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	languages := make([]string, 0, len(files))
+	for _, file := range files {
+		languages = append(languages, strings.TrimSuffix(file, path.Ext(file)))
+	}
+	sort.Strings(languages)
+	return languages, nil
+}
+
+// Load returns the catalog of lang from the message files in fsys
+func Load(fsys fs.FS, lang string) (*Catalog, error) {
+	if lang == "" {
+		lang = DefaultLanguage
+	}
+	messages, err := readMessages(fsys, lang)
+	if err != nil {
+		return nil, err
+	}
+	catalog := &Catalog{lang: lang, messages: messages}
+	if lang != DefaultLanguage {
+		if catalog.fallback, err = readMessages(fsys, DefaultLanguage); err != nil && !errors.Is(err, ErrUnknownLanguage) {
+			return nil, err
+		}
+	}
+	return catalog, nil
+}
+
+func readMessages(fsys fs.FS, lang string) (map[string]string, error) {
+	data, err := fs.ReadFile(fsys, lang+".json")
+	if errors.Is(err, fs.ErrNotExist) {
+		languages, _ := Languages(fsys)
+		return nil, fmt.Errorf("%w %s (available: %s)", ErrUnknownLanguage, lang, strings.Join(languages, ","))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, fmt.Errorf("could not decode %s messages: %w", lang, err)
+	}
+	return messages, nil
+}
+
+// Language returns the language of the catalog
+func (c *Catalog) Language() string {
+	return c.lang
+}
+
+// Message returns the message of key
+func (c *Catalog) Message(key string) string {
+	if message, ok := c.messages[key]; ok {
+		return message
+	}
+	if message, ok := c.fallback[key]; ok {
+		return message
+	}
+	return key
+}
+
+// Sprintf formats args with the message of key
+func (c *Catalog) Sprintf(key string, args ...interface{}) string {
+	return fmt.Sprintf(c.Message(key), args...)
+}
@@ -0,0 +1,59 @@
+package i18n
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+var messages = fstest.MapFS{
+	"en.json":  {Data: []byte(`{"mode": "Mode", "chunks": "%d chunks", "finding": "Finding"}`)},
+	"zh.json":  {Data: []byte(`{"mode": "模式", "chunks": "%d 个分块"}`)},
+	"bad.json": {Data: []byte(`{"mode": 1}`)},
+}
+
+func TestCatalog(t *testing.T) {
+	tests := []struct {
+		lang string
+		key  string
+		args []interface{}
+		want string
+	}{
+		{lang: "en", key: "mode", want: "Mode"},
+		{lang: "", key: "mode", want: "Mode"},
+		{lang: "zh", key: "mode", want: "模式"},
+		{lang: "zh", key: "chunks", args: []interface{}{3}, want: "3 个分块"},
+		// 缺少的翻译回退到英文, 再回退到 key
+		{lang: "zh", key: "finding", want: "Finding"},
+		{lang: "zh", key: "missing", want: "missing"},
+	}
+	for _, test := range tests {
+		catalog, err := Load(messages, test.lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := catalog.Sprintf(test.key, test.args...); got != test.want {
+			t.Errorf("%s: Sprintf(%q) = %q, want %q", test.lang, test.key, got, test.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := Load(messages, "fr"); !errors.Is(err, ErrUnknownLanguage) {
+		t.Errorf("Load(fr) = %v, want %v", err, ErrUnknownLanguage)
+	}
+	if _, err := Load(messages, "bad"); err == nil || errors.Is(err, ErrUnknownLanguage) {
+		t.Errorf("Load(bad) = %v, want a decoding error", err)
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	languages, err := Languages(messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bad", "en", "zh"}; !reflect.DeepEqual(languages, want) {
+		t.Errorf("Languages() = %v, want %v", languages, want)
+	}
+}
@@ -3,6 +3,8 @@ package input
 import (
 	"fmt"
 	"github.com/wjlin0/CVE-2024-23897/pkg/utils"
+	"net/url"
+	"strings"
 )
 
 type Target struct {
@@ -14,6 +16,11 @@ type Target struct {
 	Scheme string `json:"scheme,omitempty"`
 	// OriginURL is the Base URL of the host input on which match was found (if applicable).
 	OriginURL string `json:"origin-url,omitempty"`
+	// PreviousClass is the inconclusive class of the target in a previous run (if applicable).
+	PreviousClass string `json:"previous-class,omitempty"`
+	// Credentials are the user:password embedded in the input URL, percent-decoded. They are only sent
+	// to this target and never written out (if applicable).
+	Credentials string `json:"-"`
 }
 
 func (t *Target) ToString() string {
@@ -27,12 +34,43 @@ func (t *Target) HostAndPort() string {
 	return t.Host
 }
 
+// NewTarget returns the target of an input line, the credentials embedded in its URL are moved to Credentials
 func NewTarget(target string) *Target {
+	target, credentials := SplitCredentials(target)
 	Scheme, Host, Port := utils.GetSchemeHostAndPort(target)
 	return &Target{
-		Host:      Host,
-		Port:      Port,
-		Scheme:    Scheme,
-		OriginURL: target,
+		Host:        Host,
+		Port:        Port,
+		Scheme:      Scheme,
+		OriginURL:   target,
+		Credentials: credentials,
 	}
 }
+
+// SplitCredentials returns target without the user:password@ embedded in its URL and the percent-decoded
+// credentials as user:password, empty when there are none. The user info ends at the last @ before the
+// path, so passwords may contain @, : and # unescaped
+func SplitCredentials(target string) (string, string) {
+	start := 0
+	if i := strings.Index(target, "://"); i >= 0 {
+		start = i + 3
+	}
+	authority := target[start:]
+	if i := strings.Index(authority, "/"); i >= 0 {
+		authority = authority[:i]
+	}
+	at := strings.LastIndex(authority, "@")
+	if at < 0 {
+		return target, ""
+	}
+	user, password, _ := strings.Cut(authority[:at], ":")
+	return target[:start] + target[start+at+1:], unescape(user) + ":" + unescape(password)
+}
+
+// unescape percent-decodes s, s itself when it isn't validly escaped
+func unescape(s string) string {
+	if unescaped, err := url.PathUnescape(s); err == nil {
+		return unescaped
+	}
+	return s
+}
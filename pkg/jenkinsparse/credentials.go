@@ -0,0 +1,94 @@
+package jenkinsparse
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrUnexpectedDocument is returned when the content is not the parsed kind of file
+var ErrUnexpectedDocument = errors.New("unexpected document")
+
+// credentialsRoots are the root elements of the files holding credentials, the system store
+// credentials.xml and the config.xml of folders
+var credentialsRoots = []string{
+	"com.cloudbees.plugins.credentials.SystemCredentialsProvider",
+	"com.cloudbees.hudson.plugins.folder.Folder",
+}
+
+// secretFields are the elements holding hudson.util.Secret values in credentials
+var secretFields = map[string]struct{}{
+	"password":    {},
+	"passphrase":  {},
+	"privateKey":  {},
+	"secret":      {},
+	"secretBytes": {},
+	"token":       {},
+	"apiToken":    {},
+}
+
+// Credential is a credential of a credentials store
+type Credential struct {
+	// Type is the class of the credential, e.g. com.cloudbees.plugins.credentials.impl.UsernamePasswordCredentialsImpl
+	Type string `json:"type"`
+	// Domain is the credentials domain, empty for the global domain
+	Domain      string   `json:"domain,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	Secrets     []Secret `json:"secrets,omitempty"`
+}
+
+// ParseCredentials returns the credentials of a credentials.xml or folder config.xml, credentials
+// plugin 1.x lists and 2.x CopyOnWriteArrayLists are both read
+func ParseCredentials(data []byte) ([]Credential, error) {
+	root, err := parseDocument(data, credentialsRoots...)
+	if err != nil {
+		return nil, err
+	}
+	var credentials []Credential
+	for _, entry := range root.find("entry") {
+		var domain string
+		var lists []*node
+		for _, c := range entry.Children {
+			if strings.HasSuffix(c.Name, ".domains.Domain") {
+				domain = c.text("name")
+			} else {
+				lists = append(lists, c)
+			}
+		}
+		for _, list := range lists {
+			for _, item := range list.Children {
+				// 所有 StandardCredentials 都有 scope
+				if item.child("scope") == nil && item.child("id") == nil {
+					continue
+				}
+				credentials = append(credentials, parseCredential(item, domain))
+			}
+		}
+	}
+	return credentials, nil
+}
+
+func parseCredential(item *node, domain string) Credential {
+	credential := Credential{
+		Type:        item.Name,
+		Domain:      domain,
+		Scope:       item.text("scope"),
+		ID:          item.text("id"),
+		Description: item.text("description"),
+		Username:    item.text("username"),
+	}
+	var walk func(n *node)
+	walk = func(n *node) {
+		for _, c := range n.Children {
+			if _, ok := secretFields[c.Name]; ok && len(c.Children) == 0 && strings.TrimSpace(c.Text) != "" {
+				credential.Secrets = append(credential.Secrets, ParseSecret(c.Name, c.Text))
+				continue
+			}
+			walk(c)
+		}
+	}
+	walk(item)
+	return credential
+}
@@ -0,0 +1,53 @@
+// Package jenkinsparse parses the files leaked from jenkins controllers: /etc/passwd, the
+// credentials.xml of the credentials plugin, users/users.xml and the config.xml of users.
+// Every parser is a pure function of the file content.
+package jenkinsparse
+
+import (
+	"bytes"
+	"strings"
+)
+
+// leakWrappers are the args4j error messages wrapping each line leaked by reload-job and
+// connect-node, the line appears before the message and between its quotes
+var leakWrappers = []struct{ middle, end string }{
+	{": No such item ‘", "’ exists."},
+	// 非 UTF-8 终端上引号会变成 ?
+	{": No such item ?", "? exists."},
+	{": No such agent \"", "\" exists."},
+}
+
+// whoAmIPrefixes precede the first line leaked by who-am-i
+var whoAmIPrefixes = []string{"ERROR: No argument is allowed: ", "ERROR: Too many arguments: "}
+
+// unwrap returns p when line is p + middle + p + end
+func unwrap(line, middle, end string) (string, bool) {
+	n := len(line) - len(middle) - len(end)
+	if n <= 0 || n%2 != 0 {
+		return "", false
+	}
+	p := line[:n/2]
+	return p, line == p+middle+p+end
+}
+
+// LeakedContent returns the file lines leaked in the stderr of a cli command, without the args4j
+// error messages around them. args4j drops empty lines and trims the others
+func LeakedContent(response []byte) []byte {
+	var content bytes.Buffer
+	for _, line := range strings.Split(string(response), "\n") {
+		line = strings.TrimRight(line, "\r")
+		for _, wrapper := range leakWrappers {
+			if p, ok := unwrap(line, wrapper.middle, wrapper.end); ok {
+				content.WriteString(p + "\n")
+				break
+			}
+		}
+		for _, prefix := range whoAmIPrefixes {
+			if strings.HasPrefix(line, prefix) {
+				content.WriteString(strings.TrimPrefix(line, prefix) + "\n")
+				break
+			}
+		}
+	}
+	return content.Bytes()
+}
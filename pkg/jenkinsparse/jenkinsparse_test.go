@@ -0,0 +1,131 @@
+package jenkinsparse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// parsers parse the fixtures by the kind prefixing their name, e.g. credentials.2.426.input
+var parsers = map[string]func(data []byte) (interface{}, error){
+	"passwd":      func(data []byte) (interface{}, error) { return ParsePasswd(data), nil },
+	"credentials": func(data []byte) (interface{}, error) { return ParseCredentials(data) },
+	"users":       func(data []byte) (interface{}, error) { return ParseUsers(data) },
+	"config":      func(data []byte) (interface{}, error) { return ParseUserConfig(data) },
+}
+
+// TestGolden parses the sanitized fixtures of several jenkins releases, go test -update
+// rewrites the golden files after an intended change
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.input"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".input")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kind, _, _ := strings.Cut(name, ".")
+			var got []byte
+			if kind == "leaked" {
+				got = LeakedContent(data)
+			} else {
+				parse, ok := parsers[kind]
+				if !ok {
+					t.Fatalf("no parser for %s", kind)
+				}
+				parsed, err := parse(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, err = json.MarshalIndent(parsed, "", "  "); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, '\n')
+			}
+			golden := strings.TrimSuffix(input, ".input") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("parsed %s does not match %s:\n%s", input, golden, got)
+			}
+		})
+	}
+}
+
+// TestParseLeaked checks that files leaked line by line, trimmed and without empty lines, parse
+// as the original files
+func TestParseLeaked(t *testing.T) {
+	read := func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	want, err := ParseUsers(read("users.2.426.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseUsers(LeakedContent(read("leaked.reload-job.input")))
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseUsers(leaked) = %+v, %v, want %+v", got, err, want)
+	}
+	if entries := ParsePasswd(LeakedContent(read("leaked.connect-node.input"))); !reflect.DeepEqual(entries, ParsePasswd(read("passwd.debian.input"))) {
+		t.Errorf("ParsePasswd(leaked) = %+v", entries)
+	}
+	if entries := ParsePasswd(LeakedContent(read("leaked.who-am-i.input"))); len(entries) != 1 || entries[0].String() != "root:x:0:0:root:/root:/bin/bash" {
+		t.Errorf("ParsePasswd(who-am-i) = %+v, want the root entry", entries)
+	}
+}
+
+func TestUnexpectedDocument(t *testing.T) {
+	users := []byte("<hudson.model.UserIdMapper><version>1</version></hudson.model.UserIdMapper>")
+	if _, err := ParseCredentials(users); !errors.Is(err, ErrUnexpectedDocument) {
+		t.Errorf("ParseCredentials(users.xml) = %v, want %v", err, ErrUnexpectedDocument)
+	}
+	if _, err := ParseUserConfig(users); !errors.Is(err, ErrUnexpectedDocument) {
+		t.Errorf("ParseUserConfig(users.xml) = %v, want %v", err, ErrUnexpectedDocument)
+	}
+	for _, data := range []string{"", "root:x:0:0:root:/root:/bin/bash", "<user><id>admin</id>"} {
+		if _, err := ParseUserConfig([]byte(data)); err == nil {
+			t.Errorf("ParseUserConfig(%q) succeeded", data)
+		}
+	}
+}
+
+func TestParseSecret(t *testing.T) {
+	tests := []struct {
+		value  string
+		format SecretFormat
+	}{
+		{value: "{AQAAABAAAAAQAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=}", format: SecretCBC},
+		{value: "{AQAAABAAAAAQ}", format: SecretPlain},
+		{value: "{not base64}", format: SecretPlain},
+		{value: "AAAAAAAAAAAAAAAAAAAAAA==", format: SecretECB},
+		{value: "hunter2", format: SecretPlain},
+	}
+	for _, test := range tests {
+		if got := ParseSecret("password", test.value); got.Format != test.format {
+			t.Errorf("ParseSecret(%q) = %s, want %s", test.value, got.Format, test.format)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package jenkinsparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PasswdEntry is an entry of /etc/passwd
+type PasswdEntry struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	UID      int    `json:"uid"`
+	GID      int    `json:"gid"`
+	GECOS    string `json:"gecos"`
+	Home     string `json:"home"`
+	Shell    string `json:"shell"`
+}
+
+// String returns the passwd line of the entry
+func (e PasswdEntry) String() string {
+	return fmt.Sprintf("%s:%s:%d:%d:%s:%s:%s", e.Name, e.Password, e.UID, e.GID, e.GECOS, e.Home, e.Shell)
+}
+
+// ParsePasswd returns the entries of a passwd file, comments and malformed lines are skipped
+func ParsePasswd(data []byte) []PasswdEntry {
+	var entries []PasswdEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) != 7 || fields[0] == "" {
+			continue
+		}
+		uid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		gid, err := strconv.Atoi(fields[3])
+		if err != nil {
+			continue
+		}
+		entries = append(entries, PasswdEntry{Name: fields[0], Password: fields[1], UID: uid, GID: gid, GECOS: fields[4], Home: fields[5], Shell: fields[6]})
+	}
+	return entries
+}
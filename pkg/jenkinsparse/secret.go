@@ -0,0 +1,58 @@
+package jenkinsparse
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+)
+
+// SecretFormat is the storage format of a hudson.util.Secret
+type SecretFormat string
+
+const (
+	// SecretCBC is the {base64} format of Jenkins 2.x, AES-128-CBC with a random IV
+	SecretCBC SecretFormat = "aes-cbc"
+	// SecretECB is the legacy base64 format of Jenkins 1.x, AES-128-ECB of the value and a magic suffix
+	SecretECB SecretFormat = "aes-ecb"
+	// SecretPlain is a value stored unencrypted, jenkins encrypts it on the next save
+	SecretPlain SecretFormat = "plain"
+)
+
+// cbcPayloadVersion is the first byte of the {base64} payload
+const cbcPayloadVersion = 1
+
+// Secret is an encrypted value of a jenkins file, decrypting it needs secrets/master.key and
+// secrets/hudson.util.Secret of the controller
+type Secret struct {
+	// Field is the element holding the secret, e.g. password or privateKey
+	Field  string       `json:"field"`
+	Format SecretFormat `json:"format"`
+	// Value is the stored value
+	Value string `json:"value"`
+	// IV and Ciphertext are the parts of an aes-cbc payload
+	IV         []byte `json:"iv,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+}
+
+// ParseSecret returns the secret stored as value in field
+func ParseSecret(field, value string) Secret {
+	value = strings.TrimSpace(value)
+	secret := Secret{Field: field, Format: SecretPlain, Value: value}
+	if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+		payload, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		// version (1 byte), IV 长度 (4 字节), 密文长度 (4 字节), IV, 密文
+		if err == nil && len(payload) >= 9 && payload[0] == cbcPayloadVersion {
+			ivLength, dataLength := binary.BigEndian.Uint32(payload[1:5]), binary.BigEndian.Uint32(payload[5:9])
+			if uint64(ivLength)+uint64(dataLength) == uint64(len(payload)-9) {
+				secret.Format = SecretCBC
+				secret.IV = payload[9 : 9+ivLength]
+				secret.Ciphertext = payload[9+ivLength:]
+			}
+		}
+		return secret
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil && len(decoded) > 0 && len(decoded)%16 == 0 {
+		secret.Format = SecretECB
+	}
+	return secret
+}
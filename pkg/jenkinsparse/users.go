@@ -0,0 +1,99 @@
+package jenkinsparse
+
+import "strings"
+
+// password hash formats of HudsonPrivateSecurityRealm
+const (
+	// HashBcrypt is the #jbcrypt: format of Jenkins 1.5xx and later
+	HashBcrypt = "bcrypt"
+	// HashSaltedSHA256 is the salt:hex format of older releases
+	HashSaltedSHA256 = "salted-sha256"
+)
+
+// User is an entry of users/users.xml, mapping a user id to its directory in users/
+type User struct {
+	ID        string `json:"id"`
+	Directory string `json:"directory"`
+}
+
+// ParseUsers returns the users of users/users.xml, written by Jenkins 2.150 and later
+func ParseUsers(data []byte) ([]User, error) {
+	root, err := parseDocument(data, "hudson.model.UserIdMapper")
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	mapping := root.child("idToDirectoryNameMap")
+	if mapping == nil {
+		return users, nil
+	}
+	for _, entry := range mapping.find("entry") {
+		var values []string
+		for _, c := range entry.Children {
+			if c.Name == "string" {
+				values = append(values, strings.TrimSpace(c.Text))
+			}
+		}
+		if len(values) == 2 {
+			users = append(users, User{ID: values[0], Directory: values[1]})
+		}
+	}
+	return users, nil
+}
+
+// APIToken is a hashed api token of a user, the token itself can't be recovered
+type APIToken struct {
+	UUID    string `json:"uuid"`
+	Name    string `json:"name"`
+	Created string `json:"created,omitempty"`
+	Hash    string `json:"hash"`
+}
+
+// UserConfig is the config.xml of a user of the jenkins own user database
+type UserConfig struct {
+	ID       string `json:"id,omitempty"`
+	FullName string `json:"full-name,omitempty"`
+	Email    string `json:"email,omitempty"`
+	// PasswordHash is the stored password hash, empty for users of other security realms
+	PasswordHash string `json:"password-hash,omitempty"`
+	HashFormat   string `json:"hash-format,omitempty"`
+	// LegacyAPIToken is the encrypted api token of releases before 2.129
+	LegacyAPIToken *Secret    `json:"legacy-api-token,omitempty"`
+	APITokens      []APIToken `json:"api-tokens,omitempty"`
+}
+
+// ParseUserConfig returns the user of a users/<directory>/config.xml
+func ParseUserConfig(data []byte) (*UserConfig, error) {
+	root, err := parseDocument(data, "user")
+	if err != nil {
+		return nil, err
+	}
+	config := &UserConfig{ID: root.text("id"), FullName: root.text("fullName")}
+	properties := root.child("properties")
+	if properties == nil {
+		return config, nil
+	}
+	config.Email = properties.text("hudson.tasks.Mailer_-UserProperty", "emailAddress")
+	if hash := properties.text("hudson.security.HudsonPrivateSecurityRealm_-Details", "passwordHash"); hash != "" {
+		config.PasswordHash = hash
+		config.HashFormat = HashSaltedSHA256
+		if strings.HasPrefix(hash, "#jbcrypt:") {
+			config.HashFormat = HashBcrypt
+		}
+	}
+	if tokens := properties.child("jenkins.security.ApiTokenProperty"); tokens != nil {
+		if legacy := tokens.text("apiToken"); legacy != "" {
+			secret := ParseSecret("apiToken", legacy)
+			config.LegacyAPIToken = &secret
+		}
+		for _, token := range tokens.find("jenkins.security.apitoken.ApiTokenStore_-HashedToken") {
+			config.APITokens = append(config.APITokens, APIToken{
+				UUID:    token.text("uuid"),
+				Name:    token.text("name"),
+				Created: token.text("creationDate"),
+				Hash:    token.text("value", "hash"),
+			})
+		}
+	}
+	return config, nil
+}
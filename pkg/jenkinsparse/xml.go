@@ -0,0 +1,120 @@
+package jenkinsparse
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// node is an element of a parsed xml document
+type node struct {
+	Name     string
+	Attrs    map[string]string
+	Text     string
+	Children []*node
+}
+
+// child returns the first child named name
+func (n *node) child(name string) *node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// text returns the text of the element at path, empty when missing
+func (n *node) text(path ...string) string {
+	for _, name := range path {
+		if n = n.child(name); n == nil {
+			return ""
+		}
+	}
+	return strings.TrimSpace(n.Text)
+}
+
+// find returns the descendants named name
+func (n *node) find(name string) []*node {
+	var found []*node
+	for _, c := range n.Children {
+		if c.Name == name {
+			found = append(found, c)
+		}
+		found = append(found, c.find(name)...)
+	}
+	return found
+}
+
+// parseXML returns the root element of data, xstream documents declare xml 1.1 which
+// encoding/xml refuses so the declaration is dropped
+func parseXML(data []byte) (*node, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("<?xml")) {
+		if end := bytes.Index(data, []byte("?>")); end >= 0 {
+			data = data[end+2:]
+		}
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	var stack []*node
+	var root *node
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid xml: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &node{Name: t.Name.Local, Attrs: make(map[string]string)}
+			for _, attr := range t.Attr {
+				n.Attrs[attr.Name.Local] = attr.Value
+			}
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, fmt.Errorf("invalid xml: multiple root elements")
+				}
+				root = n
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("invalid xml: unexpected </%s>", t.Name.Local)
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) != 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("invalid xml: no root element")
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("invalid xml: unclosed <%s>", stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+// parseDocument returns the root element of data, an error when it's not one of roots
+func parseDocument(data []byte, roots ...string) (*node, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range roots {
+		if root.Name == name {
+			return root, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: root element %s, want %s", ErrUnexpectedDocument, root.Name, strings.Join(roots, " or "))
+}
@@ -0,0 +1,116 @@
+package ledger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	bolt "go.etcd.io/bbolt"
+	"strings"
+	"time"
+)
+
+var findingsBucket = []byte("findings")
+
+// Entry records when a finding was first and last seen
+type Entry struct {
+	ContentHash string    `json:"content-hash"`
+	FirstSeen   time.Time `json:"first-seen"`
+	LastSeen    time.Time `json:"last-seen"`
+}
+
+// Ledger is a findings ledger persisted across runs, used to only report new or changed findings
+type Ledger struct {
+	db *bolt.DB
+}
+
+// Open opens the ledger at path, creating it if needed
+func Open(path string) (*Ledger, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(findingsBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Ledger{db: db}, nil
+}
+
+// Close closes the ledger
+func (l *Ledger) Close() error {
+	return l.db.Close()
+}
+
+// Key returns the ledger key of a finding: host, check and file path
+func Key(event *output.ResultEvent) string {
+	host := event.Host
+	if host == "" {
+		host = event.URL
+	}
+	return strings.Join([]string{host, event.CheckID, strings.TrimPrefix(event.Args, "@")}, "|")
+}
+
+// ContentHash returns the hash of the finding contents
+func ContentHash(event *output.ResultEvent) string {
+	sum := sha256.Sum256([]byte(event.Response))
+	return hex.EncodeToString(sum[:])
+}
+
+// Record stores the finding as seen at now and reports whether it is new or its content changed
+func (l *Ledger) Record(event *output.ResultEvent, now time.Time) (changed bool, err error) {
+	key := []byte(Key(event))
+	hash := ContentHash(event)
+	err = l.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(findingsBucket)
+		entry := Entry{ContentHash: hash, FirstSeen: now}
+		if data := bucket.Get(key); data != nil {
+			var old Entry
+			if err := json.Unmarshal(data, &old); err == nil {
+				entry.FirstSeen = old.FirstSeen
+				changed = old.ContentHash != hash
+			} else {
+				changed = true
+			}
+		} else {
+			changed = true
+		}
+		entry.LastSeen = now
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, data)
+	})
+	return changed, err
+}
+
+// Prune deletes the entries not seen since before and returns how many were deleted
+func (l *Ledger) Prune(before time.Time) (pruned int, err error) {
+	err = l.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(findingsBucket)
+		var keys [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil || entry.LastSeen.Before(before) {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		pruned = len(keys)
+		return nil
+	})
+	return pruned, err
+}
@@ -0,0 +1,52 @@
+package ledger
+
+import (
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLedger(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "findings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	now := time.Now()
+	event := &output.ResultEvent{Host: "127.0.0.1", CheckID: "CVE-2024-23897", Args: "@/etc/passwd", Response: "root:x:0:0:root:/root:/bin/bash"}
+	tests := []struct {
+		name     string
+		response string
+		at       time.Time
+		want     bool
+	}{
+		{name: "first seen", response: event.Response, at: now, want: true},
+		{name: "seen again", response: event.Response, at: now.Add(time.Hour), want: false},
+		{name: "content changed", response: "root:x:0:0:root:/root:/bin/sh", at: now.Add(2 * time.Hour), want: true},
+		{name: "changed content seen again", response: "root:x:0:0:root:/root:/bin/sh", at: now.Add(3 * time.Hour), want: false},
+	}
+	for _, test := range tests {
+		event.Response = test.response
+		changed, err := l.Record(event, test.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != test.want {
+			t.Errorf("%s: Record() = %v, want %v", test.name, changed, test.want)
+		}
+	}
+
+	pruned, err := l.Prune(now.Add(3 * time.Hour))
+	if err != nil || pruned != 0 {
+		t.Errorf("Prune() = %v, %v, want 0", pruned, err)
+	}
+	pruned, err = l.Prune(now.Add(4 * time.Hour))
+	if err != nil || pruned != 1 {
+		t.Errorf("Prune() = %v, %v, want 1", pruned, err)
+	}
+	if changed, _ := l.Record(event, now.Add(5*time.Hour)); !changed {
+		t.Error("Record() after prune should report the finding as new")
+	}
+}
@@ -1,8 +1,24 @@
 package output
 
-import "github.com/wjlin0/CVE-2024-23897/pkg/input"
+import (
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"net/url"
+	"strings"
+)
+
+// SchemaVersion is the version of the results written, records without schema-version are version 1.
+// Version 3 writes the files read from a target as the Files of one record
+const SchemaVersion = 3
+
+// FlatSchemaVersion is the version of the flat results with one record per read file, written with -flat-results
+const FlatSchemaVersion = 2
 
 type ResultEvent struct {
+	// SchemaVersion is the version of the record schema, see SchemaVersion.
+	SchemaVersion int `json:"schema-version,omitempty"`
+	// CheckID is the id of the check which produced the result.
+	CheckID string `json:"check-id,omitempty"`
 	// Host is the host input on which match was found.
 	Host string `json:"host,omitempty"`
 	// Port is port of the host input on which match was found (if applicable).
@@ -20,6 +36,70 @@ type ResultEvent struct {
 	Args string `json:"filename,omitempty"`
 	// Mode is the mode of the input.
 	Mode Mode `json:"Mode,omitempty"`
+	// FullRead is true when full file contents can be read from the target.
+	FullRead bool `json:"full-read,omitempty"`
+	// InterestScore ranks leaked file contents, higher scores are more likely to hold secrets.
+	InterestScore int `json:"interest-score,omitempty"`
+	// InterestReasons explains the interest score.
+	InterestReasons []string `json:"interest-reasons,omitempty"`
+	// Finding is the type of a recognized leaked file, e.g. k8s-serviceaccount-token.
+	Finding string `json:"finding,omitempty"`
+	// Details are the attributes of the finding.
+	Details map[string]string `json:"details,omitempty"`
+	// Verdict is the negative verdict of the target, e.g. patched or not_jenkins.
+	Verdict string `json:"verdict,omitempty"`
+	// Reproduce is the tool command line reproducing the finding, secrets are placeholdered.
+	Reproduce string `json:"reproduce,omitempty"`
+	// ReproduceCurl is the curl sequence of the duplex exchange reproducing the finding.
+	ReproduceCurl string `json:"reproduce-curl,omitempty"`
+	// CachedFrom is the target on which a cached verdict was established.
+	CachedFrom string `json:"cached-from,omitempty"`
+	// Artifact is complete or partial when the leaked file looked truncated and was re-read in chunks.
+	Artifact string `json:"artifact,omitempty"`
+	// Truncation is why a partial artifact looks truncated, e.g. unclosed-xml.
+	Truncation string `json:"truncation,omitempty"`
+	// Chunks is the number of reads stitched into the leaked file.
+	Chunks int `json:"chunks,omitempty"`
+	// Inconclusive is the class of an inconclusive verdict, e.g. timeout or waf-blocked.
+	Inconclusive string `json:"inconclusive,omitempty"`
+	// OS is the operating system inferred for the target, e.g. linux or windows.
+	OS string `json:"os,omitempty"`
+	// SecondPass is the inconclusive class of the target in the previous run the result is a second pass of.
+	SecondPass string `json:"second-pass,omitempty"`
+	// EvidenceSHA256 is the sha256 of the result without its evidence fields, computed at capture time.
+	EvidenceSHA256 string `json:"evidence-sha256,omitempty"`
+	// EvidenceTimestamp is the base64 RFC 3161 timestamp token over EvidenceSHA256.
+	EvidenceTimestamp string `json:"evidence-timestamp,omitempty"`
+	// EvidenceTSA is the URL of the timestamp authority which issued EvidenceTimestamp.
+	EvidenceTSA string `json:"evidence-tsa,omitempty"`
+	// EvidenceTime is the time asserted by the timestamp authority.
+	EvidenceTime string `json:"evidence-time,omitempty"`
+	// Files are the files read from the target (if applicable).
+	Files []*FileRecord `json:"files,omitempty"`
+	// Retention is redacted or purged when the retention policy rewrote the leaked content after capture.
+	Retention string `json:"retention,omitempty"`
+}
+
+// FileRecord is a file read from a target
+type FileRecord struct {
+	// Path is the path of the file on the target.
+	Path string `json:"path"`
+	// RequestedVia is the cli command the file was read through, e.g. connect-node.
+	RequestedVia string `json:"requested-via,omitempty"`
+	// Complete is true when the full content was read, not only its first line or a truncated part.
+	Complete bool `json:"complete"`
+	// Size is the size of Content in bytes.
+	Size int `json:"size"`
+	// SHA256 is the hex sha256 of Content.
+	SHA256 string `json:"sha256,omitempty"`
+	// Content is the content read, redacted unless -no-redact.
+	Content string `json:"content,omitempty"`
+	// Error is why the file could not be read (if applicable).
+	Error string `json:"error,omitempty"`
+	// InterestScore ranks the content, higher scores are more likely to hold secrets.
+	InterestScore int `json:"interest-score,omitempty"`
+	// InterestReasons explains the interest score.
+	InterestReasons []string `json:"interest-reasons,omitempty"`
 }
 
 type Mode int
@@ -49,9 +129,30 @@ func (m Mode) String() string {
 func NewResultEvent(target *input.Target) *ResultEvent {
 
 	return &ResultEvent{
-		Host:   target.Host,
-		Port:   target.Port,
-		Scheme: target.Scheme,
-		URL:    target.ToString(),
+		SchemaVersion: SchemaVersion,
+		Host:          target.Host,
+		Port:          target.Port,
+		Scheme:        target.Scheme,
+		URL:           target.ToString(),
+		SecondPass:    target.PreviousClass,
+	}
+}
+
+// SortKey orders the results by normalized target, then check, mode, command and filename. The
+// target is lowercased with the default port and trailing slash removed
+func (e *ResultEvent) SortKey() string {
+	return strings.Join([]string{NormalizeTarget(e.URL), e.CheckID, fmt.Sprint(int(e.Mode)), e.Command, e.Args}, "\x00")
+}
+
+// NormalizeTarget returns target lowercased with the default port and trailing slash removed
+func NormalizeTarget(target string) string {
+	target = strings.TrimSuffix(target, "/")
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		u.Scheme, u.Host = strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+		if port := u.Port(); u.Scheme == "http" && port == "80" || u.Scheme == "https" && port == "443" {
+			u.Host = u.Hostname()
+		}
+		target = u.String()
 	}
+	return target
 }
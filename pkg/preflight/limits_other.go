@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package preflight
+
+func openFileLimit() (uint64, error) {
+	return 0, ErrUnsupported
+}
+
+func freeSpace(dir string) (uint64, error) {
+	return 0, ErrUnsupported
+}
@@ -0,0 +1,330 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// names of the checks
+const (
+	CheckOpenFiles = "open-files"
+	CheckDiskSpace = "disk-space"
+	CheckWritable  = "writable"
+	CheckProxy     = "proxy"
+	CheckDNS       = "dns"
+)
+
+// FilesPerThread is the number of descriptors a scan thread may hold: the download and upload
+// connections of the exchange and a probe
+const FilesPerThread = 3
+
+// ReservedFiles are the descriptors of the process besides the scan threads: output files, the
+// ledger, the resolver and the standard streams
+const ReservedFiles = 64
+
+// diskMargin is the free space kept besides the expected outputs
+const diskMargin = 64 << 20
+
+// ErrUnsupported is returned by the environment for a check not supported on the platform
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// Env is the environment the checks inspect, tests replace its functions by fakes
+type Env struct {
+	// OpenFileLimit returns the soft limit of open files
+	OpenFileLimit func() (uint64, error)
+	// FreeSpace returns the bytes available to the user in the file system of dir
+	FreeSpace func(dir string) (uint64, error)
+	// Probe creates and removes a file in dir
+	Probe func(dir string) error
+	// Dial connects to a proxy
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+	// LookupHost resolves a host name
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+// DefaultEnv returns the environment of the process
+func DefaultEnv() *Env {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &Env{
+		OpenFileLimit: openFileLimit,
+		FreeSpace:     freeSpace,
+		Probe: func(dir string) error {
+			file, err := os.CreateTemp(dir, ".preflight-*")
+			if err != nil {
+				return err
+			}
+			_ = file.Close()
+			return os.Remove(file.Name())
+		},
+		Dial:       dialer.DialContext,
+		LookupHost: net.DefaultResolver.LookupHost,
+	}
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name string
+	// Err is why the check failed, nil when it passed or was skipped
+	Err error
+	// Remediation tells how to fix the failure
+	Remediation string
+	// Skipped is why the check was not run (if applicable)
+	Skipped string
+	// Detail describes a passed check
+	Detail string
+}
+
+// Failed reports whether the check failed
+func (r *Result) Failed() bool {
+	return r.Err != nil
+}
+
+// Config is what the scan is about to use
+type Config struct {
+	// Threads is the configured concurrency
+	Threads int
+	// Outputs are the files the scan writes
+	Outputs []string
+	// OutputDirs are the directories the scan creates files in, such as the workdir
+	OutputDirs []string
+	// ExpectedBytes is the estimated size of the outputs
+	ExpectedBytes uint64
+	// Proxy is the proxy URL targets are requested through, empty for none
+	Proxy string
+	// Hosts are host names of targets sampled for the dns check
+	Hosts []string
+}
+
+// Run runs every check
+func Run(ctx context.Context, env *Env, config *Config) []*Result {
+	return []*Result{
+		OpenFiles(env, config.Threads),
+		DiskSpace(env, append(dirsOf(config.Outputs), config.OutputDirs...), config.ExpectedBytes),
+		Writable(env, config.Outputs, config.OutputDirs),
+		Proxy(ctx, env, config.Proxy),
+		DNS(ctx, env, config.Proxy, config.Hosts),
+	}
+}
+
+// OpenFiles checks the open files limit against the descriptors of threads concurrent scans
+func OpenFiles(env *Env, threads int) *Result {
+	result := &Result{Name: CheckOpenFiles}
+	limit, err := env.OpenFileLimit()
+	if errors.Is(err, ErrUnsupported) {
+		result.Skipped = err.Error()
+		return result
+	}
+	if err != nil {
+		result.Err = fmt.Errorf("could not read the open files limit: %w", err)
+		return result
+	}
+	need := uint64(threads*FilesPerThread + ReservedFiles)
+	if limit < need {
+		result.Err = fmt.Errorf("open files limit %d is below the %d needed by -t %d", limit, need, threads)
+		threadsFit := 1
+		if limit > ReservedFiles {
+			threadsFit = int(limit-ReservedFiles) / FilesPerThread
+		}
+		result.Remediation = fmt.Sprintf("raise the limit with 'ulimit -n %d' (or LimitNOFILE in a systemd unit), or lower the concurrency to -t %d", need, threadsFit)
+		return result
+	}
+	result.Detail = fmt.Sprintf("limit %d, %d needed", limit, need)
+	return result
+}
+
+// DiskSpace checks the free space of the file systems of dirs against the expected size of the outputs
+func DiskSpace(env *Env, dirs []string, expected uint64) *Result {
+	result := &Result{Name: CheckDiskSpace}
+	if len(dirs) == 0 {
+		result.Skipped = "no output file"
+		return result
+	}
+	need := expected + diskMargin
+	var details []string
+	for _, dir := range unique(dirs) {
+		existing := existingDir(dir)
+		free, err := env.FreeSpace(existing)
+		if errors.Is(err, ErrUnsupported) {
+			result.Skipped = err.Error()
+			return result
+		}
+		if err != nil {
+			result.Err = fmt.Errorf("could not read the free space of %s: %w", existing, err)
+			return result
+		}
+		if free < need {
+			result.Err = fmt.Errorf("%s has %s free, the outputs may need %s", existing, formatBytes(free), formatBytes(need))
+			result.Remediation = "free space there or write the outputs to another file system with -workdir, -results and -sarif"
+			return result
+		}
+		details = append(details, fmt.Sprintf("%s %s free", existing, formatBytes(free)))
+	}
+	result.Detail = strings.Join(details, ", ")
+	return result
+}
+
+// Writable checks that the output files and directories can be written
+func Writable(env *Env, outputs, dirs []string) *Result {
+	result := &Result{Name: CheckWritable}
+	if len(outputs) == 0 && len(dirs) == 0 {
+		result.Skipped = "no output file"
+		return result
+	}
+	for _, path := range append(dirsOf(outputs), dirs...) {
+		existing := existingDir(path)
+		if info, err := os.Stat(existing); err == nil && !info.IsDir() {
+			result.Err = fmt.Errorf("%s is not a directory", existing)
+			result.Remediation = fmt.Sprintf("remove %s or choose another output path", existing)
+			return result
+		}
+		if err := env.Probe(existing); err != nil {
+			result.Err = fmt.Errorf("cannot write to %s: %w", existing, err)
+			result.Remediation = fmt.Sprintf("fix the permissions of %s or choose another output path", existing)
+			return result
+		}
+	}
+	for _, path := range outputs {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			result.Err = fmt.Errorf("output %s is a directory", path)
+			result.Remediation = "give a file path"
+			return result
+		}
+	}
+	return result
+}
+
+// Proxy checks that the proxy accepts connections
+func Proxy(ctx context.Context, env *Env, proxy string) *Result {
+	result := &Result{Name: CheckProxy}
+	if proxy == "" {
+		result.Skipped = "no proxy"
+		return result
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		result.Err = fmt.Errorf("invalid proxy %s", proxy)
+		result.Remediation = "give the proxy as scheme://host:port"
+		return result
+	}
+	address := u.Host
+	if u.Port() == "" {
+		port := "80"
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "socks5":
+			port = "1080"
+		}
+		address = net.JoinHostPort(u.Hostname(), port)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := env.Dial(ctx, "tcp", address)
+	if err != nil {
+		result.Err = fmt.Errorf("proxy %s is unreachable: %w", address, err)
+		result.Remediation = "check that the proxy is running and reachable from this host, or remove -proxy and the proxy environment variables"
+		return result
+	}
+	_ = conn.Close()
+	result.Detail = address
+	return result
+}
+
+// DNS checks that target host names resolve and that names which don't exist aren't answered, a
+// resolver answering every name makes unreachable targets look like hosts that aren't jenkins
+func DNS(ctx context.Context, env *Env, proxy string, hosts []string) *Result {
+	result := &Result{Name: CheckDNS}
+	if strings.HasPrefix(proxy, "socks5") {
+		result.Skipped = "names are resolved by the socks5 proxy"
+		return result
+	}
+	var names []string
+	for _, host := range unique(hosts) {
+		if net.ParseIP(host) == nil && host != "" {
+			names = append(names, host)
+		}
+	}
+	if len(names) == 0 {
+		result.Skipped = "no target host name"
+		return result
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var lookupErr error
+	resolved := 0
+	for _, name := range names {
+		if _, err := env.LookupHost(ctx, name); err != nil {
+			lookupErr = err
+			continue
+		}
+		resolved++
+	}
+	if resolved == 0 {
+		result.Err = fmt.Errorf("none of %d sampled target names resolves: %w", len(names), lookupErr)
+		result.Remediation = "check /etc/resolv.conf and that the resolver is reachable, or use a proxy resolving the names"
+		return result
+	}
+	nonexistent := fmt.Sprintf("preflight-%d.invalid", time.Now().UnixNano())
+	if addrs, err := env.LookupHost(ctx, nonexistent); err == nil {
+		result.Err = fmt.Errorf("the resolver answers the nonexistent name %s with %s", nonexistent, strings.Join(addrs, ", "))
+		result.Remediation = "use a resolver without NXDOMAIN rewriting, otherwise unreachable targets are reported as not jenkins"
+		return result
+	}
+	result.Detail = fmt.Sprintf("%d of %d sampled target names resolve", resolved, len(names))
+	return result
+}
+
+// existingDir returns the nearest existing ancestor of path, path itself when it exists
+func existingDir(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+func dirsOf(files []string) []string {
+	var dirs []string
+	for _, file := range files {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+	return dirs
+}
+
+func unique(values []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,202 @@
+package preflight
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeEnv returns an environment passing every check
+func fakeEnv() *Env {
+	return &Env{
+		OpenFileLimit: func() (uint64, error) { return 65536, nil },
+		FreeSpace:     func(string) (uint64, error) { return 100 << 30, nil },
+		Probe:         func(string) error { return nil },
+		Dial: func(context.Context, string, string) (net.Conn, error) {
+			client, server := net.Pipe()
+			_ = server.Close()
+			return client, nil
+		},
+		LookupHost: func(_ context.Context, host string) ([]string, error) {
+			if strings.HasSuffix(host, ".invalid") {
+				return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+			}
+			return []string{"192.0.2.1"}, nil
+		},
+	}
+}
+
+func TestOpenFiles(t *testing.T) {
+	tests := []struct {
+		limit       uint64
+		err         error
+		threads     int
+		failed      bool
+		remediation string
+		skipped     bool
+	}{
+		{limit: 65536, threads: 300},
+		{limit: 1024, threads: 500, failed: true, remediation: "ulimit -n 1564"},
+		// 降低并发的建议
+		{limit: 1024, threads: 500, failed: true, remediation: "-t 320"},
+		{limit: 1024, threads: 320},
+		{err: ErrUnsupported, threads: 30, skipped: true},
+		{err: errors.New("getrlimit failed"), threads: 30, failed: true},
+	}
+	for _, test := range tests {
+		env := fakeEnv()
+		env.OpenFileLimit = func() (uint64, error) { return test.limit, test.err }
+		result := OpenFiles(env, test.threads)
+		if result.Failed() != test.failed || (result.Skipped != "") != test.skipped || !strings.Contains(result.Remediation, test.remediation) {
+			t.Errorf("OpenFiles(limit %d, -t %d) = %+v, want failed %v, remediation %q", test.limit, test.threads, result, test.failed, test.remediation)
+		}
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		free     uint64
+		expected uint64
+		failed   bool
+	}{
+		{free: 10 << 30, expected: 1 << 30},
+		{free: 100 << 20, expected: 1 << 30, failed: true},
+		// 保留余量
+		{free: 100 << 20, expected: 50 << 20, failed: true},
+	}
+	for _, test := range tests {
+		env := fakeEnv()
+		var checked string
+		env.FreeSpace = func(dir string) (uint64, error) {
+			checked = dir
+			return test.free, nil
+		}
+		// 尚不存在的目录检查其最近的已存在的上级目录
+		result := DiskSpace(env, []string{filepath.Join(dir, "workdir", "run")}, test.expected)
+		if result.Failed() != test.failed || checked != dir {
+			t.Errorf("DiskSpace(free %d, expected %d) = %+v checking %s, want failed %v checking %s", test.free, test.expected, result, checked, test.failed, dir)
+		}
+		if test.failed && result.Remediation == "" {
+			t.Errorf("DiskSpace() failed without remediation")
+		}
+	}
+	if result := DiskSpace(fakeEnv(), nil, 1<<40); result.Skipped == "" {
+		t.Errorf("DiskSpace() without outputs = %+v, want skipped", result)
+	}
+}
+
+func TestWritable(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		outputs []string
+		dirs    []string
+		probe   error
+		failed  bool
+	}{
+		{name: "new file", outputs: []string{filepath.Join(dir, "results.jsonl")}},
+		{name: "new workdir", dirs: []string{filepath.Join(dir, "a", "b")}},
+		{name: "read-only", outputs: []string{filepath.Join(dir, "results.jsonl")}, probe: os.ErrPermission, failed: true},
+		{name: "parent is a file", outputs: []string{filepath.Join(file, "results.jsonl")}, failed: true},
+		{name: "output is a directory", outputs: []string{dir}, failed: true},
+	}
+	for _, test := range tests {
+		env := fakeEnv()
+		env.Probe = func(string) error { return test.probe }
+		if result := Writable(env, test.outputs, test.dirs); result.Failed() != test.failed || test.failed && result.Remediation == "" {
+			t.Errorf("Writable() %s = %+v, want failed %v", test.name, result, test.failed)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	tests := []struct {
+		proxy   string
+		dialErr error
+		address string
+		failed  bool
+		skipped bool
+	}{
+		{proxy: "", skipped: true},
+		{proxy: "http://127.0.0.1:8080", address: "127.0.0.1:8080"},
+		{proxy: "socks5://proxy.example.com", address: "proxy.example.com:1080"},
+		{proxy: "http://127.0.0.1:8080", dialErr: errors.New("connection refused"), address: "127.0.0.1:8080", failed: true},
+		{proxy: "127.0.0.1:8080", failed: true},
+	}
+	for _, test := range tests {
+		env := fakeEnv()
+		var dialed string
+		dial := env.Dial
+		env.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = address
+			if test.dialErr != nil {
+				return nil, test.dialErr
+			}
+			return dial(ctx, network, address)
+		}
+		result := Proxy(context.Background(), env, test.proxy)
+		if result.Failed() != test.failed || (result.Skipped != "") != test.skipped || dialed != test.address {
+			t.Errorf("Proxy(%q) = %+v dialing %q, want failed %v dialing %q", test.proxy, result, dialed, test.failed, test.address)
+		}
+	}
+}
+
+func TestDNS(t *testing.T) {
+	notFound := &net.DNSError{Err: "no such host", IsNotFound: true}
+	tests := []struct {
+		name    string
+		proxy   string
+		hosts   []string
+		lookup  func(host string) ([]string, error)
+		failed  bool
+		skipped bool
+	}{
+		{name: "resolving", hosts: []string{"jenkins.example.com", "10.0.0.1"}},
+		{name: "ip targets", hosts: []string{"10.0.0.1"}, skipped: true},
+		{name: "socks5", proxy: "socks5://127.0.0.1:1080", hosts: []string{"jenkins.example.com"}, skipped: true},
+		{name: "resolver down", hosts: []string{"a.example.com", "b.example.com"}, failed: true,
+			lookup: func(string) ([]string, error) { return nil, &net.DNSError{Err: "i/o timeout", IsTimeout: true} }},
+		{name: "some names missing", hosts: []string{"a.example.com", "gone.example.com"},
+			lookup: func(host string) ([]string, error) {
+				if strings.HasPrefix(host, "a.") {
+					return []string{"192.0.2.1"}, nil
+				}
+				return nil, notFound
+			}},
+		{name: "nxdomain rewriting", hosts: []string{"jenkins.example.com"}, failed: true,
+			lookup: func(string) ([]string, error) { return []string{"198.51.100.7"}, nil }},
+	}
+	for _, test := range tests {
+		env := fakeEnv()
+		if test.lookup != nil {
+			env.LookupHost = func(_ context.Context, host string) ([]string, error) { return test.lookup(host) }
+		}
+		result := DNS(context.Background(), env, test.proxy, test.hosts)
+		if result.Failed() != test.failed || (result.Skipped != "") != test.skipped || test.failed && result.Remediation == "" {
+			t.Errorf("DNS() %s = %+v, want failed %v, skipped %v", test.name, result, test.failed, test.skipped)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	results := Run(context.Background(), fakeEnv(), &Config{Threads: 30, Outputs: []string{filepath.Join(dir, "results.jsonl")}, Hosts: []string{"jenkins.example.com"}})
+	names := []string{CheckOpenFiles, CheckDiskSpace, CheckWritable, CheckProxy, CheckDNS}
+	if len(results) != len(names) {
+		t.Fatalf("Run() = %d results, want %d", len(results), len(names))
+	}
+	for i, result := range results {
+		if result.Name != names[i] || result.Failed() {
+			t.Errorf("Run() result %d = %+v, want %s passing", i, result, names[i])
+		}
+	}
+}
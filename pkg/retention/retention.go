@@ -0,0 +1,345 @@
+package retention
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/atomicfile"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/redact"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestFile is the file of a run directory listing the artifacts the pruner may touch
+const ManifestFile = "manifest.json"
+
+// ManifestSchemaVersion is the version of the manifest written
+const ManifestSchemaVersion = 1
+
+// kinds of artifacts
+const (
+	// KindResults are JSON lines results holding leaked content and evidence
+	KindResults = "results"
+	// KindSarif is a SARIF log whose messages hold leaked lines
+	KindSarif = "sarif"
+	// KindMetadata artifacts hold no leaked content and are never touched
+	KindMetadata = "metadata"
+)
+
+// values of output.ResultEvent.Retention
+const (
+	Redacted = "redacted"
+	Purged   = "purged"
+)
+
+// operations of the pruner
+const (
+	OpRedact         = "redact"
+	OpPurge          = "purge"
+	OpRemoveEvidence = "remove-evidence"
+	OpDelete         = "delete"
+)
+
+// runDirName matches the names of the run directories of a workdir
+var runDirName = regexp.MustCompile(`^\d{8}-\d{6}(-\d+)?$`)
+
+// Artifact is a file of a run directory, Path is relative to the run directory
+type Artifact struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+}
+
+// Manifest lists the artifacts of a run directory
+type Manifest struct {
+	SchemaVersion int        `json:"schema-version"`
+	Created       time.Time  `json:"created"`
+	Artifacts     []Artifact `json:"artifacts"`
+}
+
+// WriteManifest writes the manifest of runDir listing the artifacts, a map of paths to kinds. Paths
+// outside of runDir are left out, the pruner only touches the files of the run directory
+func WriteManifest(runDir string, created time.Time, artifacts map[string]string) error {
+	manifest := &Manifest{SchemaVersion: ManifestSchemaVersion, Created: created, Artifacts: []Artifact{}}
+	for path, kind := range artifacts {
+		if rel, err := filepath.Rel(runDir, path); err == nil && validArtifactPath(rel) {
+			manifest.Artifacts = append(manifest.Artifacts, Artifact{Path: rel, Kind: kind})
+		}
+	}
+	sort.Slice(manifest.Artifacts, func(i, j int) bool { return manifest.Artifacts[i].Path < manifest.Artifacts[j].Path })
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Join(runDir, ManifestFile), append(data, '\n'), 0644)
+}
+
+// validArtifactPath reports whether path names a file directly in the run directory
+func validArtifactPath(path string) bool {
+	return path != "" && path != "." && path != ".." && path != ManifestFile && filepath.Base(path) == path && !strings.ContainsAny(path, `/\`)
+}
+
+// Policy is the age after which the pruner rewrites or deletes the artifacts of a run, zero disables a limit
+type Policy struct {
+	// RedactAfter redacts the secrets of the leaked content
+	RedactAfter time.Duration
+	// LootMaxAge purges the leaked content and deletes the SARIF logs, the metadata of the findings is kept
+	LootMaxAge time.Duration
+	// EvidenceMaxAge removes the evidence hashes and timestamp tokens of the findings
+	EvidenceMaxAge time.Duration
+}
+
+// Enabled reports whether the policy has a limit
+func (p Policy) Enabled() bool {
+	return p.RedactAfter > 0 || p.LootMaxAge > 0 || p.EvidenceMaxAge > 0
+}
+
+func exceeds(age, limit time.Duration) bool {
+	return limit > 0 && age >= limit
+}
+
+// Action is a change of the pruner to an artifact
+type Action struct {
+	Path string
+	Op   string
+	// Records is the number of results rewritten, zero for file operations
+	Records int
+}
+
+func (a *Action) String() string {
+	if a.Records != 0 {
+		return fmt.Sprintf("%s %d records of %s", a.Op, a.Records, a.Path)
+	}
+	return fmt.Sprintf("%s %s", a.Op, a.Path)
+}
+
+// Result is the outcome of pruning a workdir
+type Result struct {
+	Actions []*Action
+	// Skipped are the entries of the workdir not pruned with the reason
+	Skipped []string
+}
+
+// Prune applies the policy to the run directories of workdir which have a manifest. Only the artifacts
+// listed in the manifests are touched, a dry run only returns the actions
+func Prune(workdir string, policy Policy, now time.Time, dryRun bool) (*Result, error) {
+	entries, err := os.ReadDir(workdir)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	for _, entry := range entries {
+		// ReadDir 不跟随符号链接, 跳过 latest
+		if !entry.IsDir() || !runDirName.MatchString(entry.Name()) {
+			continue
+		}
+		runDir := filepath.Join(workdir, entry.Name())
+		manifest, err := readManifest(runDir)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %s", runDir, err))
+			continue
+		}
+		age := now.Sub(manifest.Created)
+		for _, artifact := range manifest.Artifacts {
+			actions, err := pruneArtifact(runDir, artifact, policy, age, dryRun)
+			if err != nil {
+				return result, err
+			}
+			result.Actions = append(result.Actions, actions...)
+		}
+	}
+	return result, nil
+}
+
+// errNoManifest is the reason a directory without manifest is skipped
+var errNoManifest = errors.New("no manifest, written by runs of this version on")
+
+func readManifest(runDir string) (*Manifest, error) {
+	path := filepath.Join(runDir, ManifestFile)
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil, errNoManifest
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", ManifestFile)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+	if manifest.SchemaVersion > ManifestSchemaVersion {
+		return nil, fmt.Errorf("%s has schema version %d, this version reads up to %d", ManifestFile, manifest.SchemaVersion, ManifestSchemaVersion)
+	}
+	if manifest.Created.IsZero() {
+		return nil, fmt.Errorf("%s has no creation time", ManifestFile)
+	}
+	return manifest, nil
+}
+
+func pruneArtifact(runDir string, artifact Artifact, policy Policy, age time.Duration, dryRun bool) ([]*Action, error) {
+	if !validArtifactPath(artifact.Path) {
+		return nil, nil
+	}
+	path := filepath.Join(runDir, artifact.Path)
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) || err == nil && !info.Mode().IsRegular() {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch artifact.Kind {
+	case KindResults:
+		return pruneResults(path, info.Mode().Perm(), policy, age, dryRun)
+	case KindSarif:
+		if exceeds(age, policy.LootMaxAge) {
+			if !dryRun {
+				if err := os.Remove(path); err != nil {
+					return nil, err
+				}
+			}
+			return []*Action{{Path: path, Op: OpDelete}}, nil
+		}
+		if exceeds(age, policy.RedactAfter) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			redacted := redact.New().Bytes(data)
+			if bytes.Equal(redacted, data) {
+				return nil, nil
+			}
+			if !dryRun {
+				if err := atomicfile.WriteFile(path, redacted, info.Mode().Perm()); err != nil {
+					return nil, err
+				}
+			}
+			return []*Action{{Path: path, Op: OpRedact}}, nil
+		}
+	}
+	return nil, nil
+}
+
+// pruneResults rewrites the records of a results file, records of a newer schema are kept as they are
+func pruneResults(path string, perm os.FileMode, policy Policy, age time.Duration, dryRun bool) ([]*Action, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	purge, redacting, removeEvidence := exceeds(age, policy.LootMaxAge), exceeds(age, policy.RedactAfter), exceeds(age, policy.EvidenceMaxAge)
+	if !purge && !redacting && !removeEvidence {
+		return nil, nil
+	}
+	counts := map[string]int{}
+	redactor := redact.New()
+	buffer := &bytes.Buffer{}
+	lines := bufio.NewScanner(bytes.NewReader(data))
+	lines.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for lines.Scan() {
+		line := lines.Bytes()
+		result := &output.ResultEvent{}
+		if len(bytes.TrimSpace(line)) == 0 || json.Unmarshal(line, result) != nil || result.SchemaVersion > output.SchemaVersion {
+			buffer.Write(line)
+			buffer.WriteByte('\n')
+			continue
+		}
+		changed := false
+		switch {
+		case purge && result.Retention != Purged && hasLoot(result):
+			purgeLoot(result)
+			counts[OpPurge]++
+			changed = true
+		case redacting && result.Retention == "" && redactLoot(result, redactor):
+			counts[OpRedact]++
+			changed = true
+		}
+		if removeEvidence && result.EvidenceSHA256 != "" {
+			result.EvidenceSHA256, result.EvidenceTimestamp, result.EvidenceTSA, result.EvidenceTime = "", "", "", ""
+			counts[OpRemoveEvidence]++
+			changed = true
+		}
+		if !changed {
+			buffer.Write(line)
+			buffer.WriteByte('\n')
+			continue
+		}
+		rewritten, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(rewritten)
+		buffer.WriteByte('\n')
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	var actions []*Action
+	for _, op := range []string{OpPurge, OpRedact, OpRemoveEvidence} {
+		if counts[op] != 0 {
+			actions = append(actions, &Action{Path: path, Op: op, Records: counts[op]})
+		}
+	}
+	if len(actions) == 0 || dryRun {
+		return actions, nil
+	}
+	return actions, atomicfile.WriteFile(path, buffer.Bytes(), perm)
+}
+
+// hasLoot reports whether a result holds leaked content
+func hasLoot(result *output.ResultEvent) bool {
+	if result.Response != "" || result.Details[scanner.DetailLeakedLine] != "" {
+		return true
+	}
+	for _, file := range result.Files {
+		if file.Content != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// purgeLoot removes the leaked content of a result, the sizes and hashes of the files are kept
+func purgeLoot(result *output.ResultEvent) {
+	result.Response = ""
+	delete(result.Details, scanner.DetailLeakedLine)
+	for _, file := range result.Files {
+		file.Content = ""
+	}
+	result.Retention = Purged
+}
+
+// redactLoot redacts the secrets of the leaked content of a result and reports whether it changed
+func redactLoot(result *output.ResultEvent, redactor *redact.Redactor) bool {
+	changed := false
+	redactString := func(s *string) {
+		if redacted := redactor.String(*s); redacted != *s {
+			*s, changed = redacted, true
+		}
+	}
+	redactString(&result.Response)
+	if line, ok := result.Details[scanner.DetailLeakedLine]; ok {
+		redactString(&line)
+		result.Details[scanner.DetailLeakedLine] = line
+	}
+	for _, file := range result.Files {
+		redactString(&file.Content)
+	}
+	if changed {
+		result.Retention = Redacted
+	}
+	return changed
+}
@@ -0,0 +1,201 @@
+package retention
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+)
+
+const day = 24 * time.Hour
+
+// writeRun writes a run directory created age ago with a results file, a SARIF log and a config
+func writeRun(t *testing.T, workdir, name string, age time.Duration, now time.Time) string {
+	t.Helper()
+	runDir := filepath.Join(workdir, name)
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	result := &output.ResultEvent{
+		SchemaVersion:  output.SchemaVersion,
+		URL:            "http://jenkins",
+		Response:       "root:x:0:0:root:/root:/bin/bash\npassword=hunter2hunter2\n",
+		Details:        map[string]string{scanner.DetailLeakedLine: "password=hunter2hunter2"},
+		Files:          []*output.FileRecord{{Path: "/etc/passwd", Size: 32, Content: "root:x:0:0:root:/root:/bin/bash"}},
+		EvidenceSHA256: "00",
+	}
+	line, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"results.jsonl": string(line) + "\nnot json\n",
+		"results.sarif": `{"message":"password=hunter2hunter2"}`,
+		"config.json":   `{"token":"abcdefgh"}`,
+	}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(runDir, file), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = WriteManifest(runDir, now.Add(-age), map[string]string{
+		filepath.Join(runDir, "results.jsonl"): KindResults,
+		filepath.Join(runDir, "results.sarif"): KindSarif,
+		filepath.Join(runDir, "config.json"):   KindMetadata,
+		// 不在运行目录下的产物不写入清单
+		filepath.Join(workdir, "outside.jsonl"): KindResults,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runDir
+}
+
+func readResult(t *testing.T, path string) *output.ResultEvent {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) < 2 || lines[1] != "not json" {
+		t.Errorf("%s lost the lines it could not parse: %q", path, data)
+	}
+	result := &output.ResultEvent{}
+	if err := json.Unmarshal([]byte(lines[0]), result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestWriteManifest(t *testing.T) {
+	workdir := t.TempDir()
+	runDir := writeRun(t, workdir, "20240101-000000", 0, time.Now())
+	manifest, err := readManifest(runDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Artifacts) != 3 {
+		t.Errorf("WriteManifest() = %+v, want the 3 artifacts of the run directory", manifest.Artifacts)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		age      time.Duration
+		policy   Policy
+		ops      []string
+		sarif    bool
+		response string
+	}{
+		{name: "young", age: day, policy: Policy{RedactAfter: 7 * day, LootMaxAge: 30 * day}, sarif: true,
+			response: "password=hunter2hunter2"},
+		{name: "redact", age: 10 * day, policy: Policy{RedactAfter: 7 * day, LootMaxAge: 30 * day}, ops: []string{OpRedact, OpRedact}, sarif: true,
+			response: "password=[REDACTED]"},
+		{name: "purge", age: 40 * day, policy: Policy{RedactAfter: 7 * day, LootMaxAge: 30 * day}, ops: []string{OpPurge, OpDelete}},
+		{name: "evidence", age: 40 * day, policy: Policy{EvidenceMaxAge: 30 * day}, ops: []string{OpRemoveEvidence}, sarif: true,
+			response: "password=hunter2hunter2"},
+	}
+	for _, test := range tests {
+		workdir := t.TempDir()
+		runDir := writeRun(t, workdir, "20240101-000000", test.age, now)
+		// 清单不可信时跳过
+		if err := os.MkdirAll(filepath.Join(workdir, "20240102-000000"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(runDir, filepath.Join(workdir, "latest")); err != nil {
+			t.Fatal(err)
+		}
+
+		dry, err := Prune(workdir, test.policy, now, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result := readResult(t, filepath.Join(runDir, "results.jsonl")); result.Retention != "" {
+			t.Errorf("Prune() %s dry run rewrote the results", test.name)
+		}
+		result, err := Prune(workdir, test.policy, now, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ops []string
+		for _, action := range result.Actions {
+			ops = append(ops, action.Op)
+		}
+		if strings.Join(ops, ",") != strings.Join(test.ops, ",") || len(dry.Actions) != len(result.Actions) {
+			t.Errorf("Prune() %s = %v, dry run %d actions, want %v", test.name, ops, len(dry.Actions), test.ops)
+		}
+		if len(result.Skipped) != 1 || !strings.Contains(result.Skipped[0], "20240102-000000") {
+			t.Errorf("Prune() %s skipped %v, want the run without manifest", test.name, result.Skipped)
+		}
+		if _, err := os.Stat(filepath.Join(runDir, "results.sarif")); (err == nil) != test.sarif {
+			t.Errorf("Prune() %s kept the SARIF log %v, want %v", test.name, err == nil, test.sarif)
+		}
+		if _, err := os.Stat(filepath.Join(runDir, "config.json")); err != nil {
+			t.Errorf("Prune() %s touched the metadata: %s", test.name, err)
+		}
+		got := readResult(t, filepath.Join(runDir, "results.jsonl"))
+		if test.response == "" && (got.Response != "" || got.Files[0].Content != "" || got.Files[0].Size != 32 || got.Retention != Purged) {
+			t.Errorf("Prune() %s = %+v, want the leaked content purged", test.name, got)
+		}
+		if test.response != "" && !strings.Contains(got.Response, test.response) {
+			t.Errorf("Prune() %s response = %q, want %q", test.name, got.Response, test.response)
+		}
+		if (got.EvidenceSHA256 == "") != (test.policy.EvidenceMaxAge > 0) {
+			t.Errorf("Prune() %s evidence = %q", test.name, got.EvidenceSHA256)
+		}
+
+		// 再次执行不再改写
+		if again, err := Prune(workdir, test.policy, now, false); err != nil || len(again.Actions) != 0 {
+			t.Errorf("Prune() %s again = %v, %v, want no actions", test.name, again.Actions, err)
+		}
+	}
+}
+
+func TestPruneManifestPaths(t *testing.T) {
+	now := time.Now()
+	workdir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "outside.sarif")
+	if err := os.WriteFile(outside, []byte("password=hunter2hunter2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(workdir, "20240101-000000")
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(runDir, "link.sarif")); err != nil {
+		t.Fatal(err)
+	}
+	manifest := &Manifest{SchemaVersion: ManifestSchemaVersion, Created: now.Add(-100 * day), Artifacts: []Artifact{
+		{Path: outside, Kind: KindSarif},
+		{Path: "../../" + filepath.Base(outside), Kind: KindSarif},
+		{Path: "link.sarif", Kind: KindSarif},
+		{Path: ManifestFile, Kind: KindSarif},
+	}}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, ManifestFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Prune(workdir, Policy{LootMaxAge: day}, now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Actions) != 0 {
+		t.Errorf("Prune() = %v, want no actions outside of the run directory", result.Actions)
+	}
+	for _, path := range []string{outside, filepath.Join(runDir, "link.sarif"), filepath.Join(runDir, ManifestFile)} {
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("Prune() removed %s", path)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package rollup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+)
+
+// ErrNewerSchema is returned for records written by a newer version than this binary knows
+var ErrNewerSchema = errors.New("record of a newer schema version")
+
+// migrations upgrade a record of the version of their key to the next version
+var migrations = map[int]func(record map[string]json.RawMessage) error{
+	1: migrateV1,
+	2: migrateV2,
+}
+
+// migrateV1 upgrades a record written before schema-version: records of the runs before the check
+// registry have no check-id and are CVE-2024-23897 findings
+func migrateV1(record map[string]json.RawMessage) error {
+	if _, ok := record["check-id"]; ok {
+		return nil
+	}
+	var verdict string
+	if raw, ok := record["verdict"]; ok {
+		if err := json.Unmarshal(raw, &verdict); err != nil {
+			return err
+		}
+	}
+	if verdict != scanner.VerdictInconclusive {
+		record["check-id"], _ = json.Marshal(scanner.CVE202423897)
+	}
+	return nil
+}
+
+// migrateV2 upgrades a flat record of a read file to a record of the target with the file as its only
+// file record
+func migrateV2(record map[string]json.RawMessage) error {
+	var flat output.ResultEvent
+	if err := json.Unmarshal(mustMarshal(record), &flat); err != nil {
+		return err
+	}
+	if flat.Mode != output.ModeReadFile || flat.Args == "" || len(flat.Files) != 0 {
+		return nil
+	}
+	file := &output.FileRecord{Path: flat.Args, RequestedVia: flat.Command, Error: flat.Error,
+		InterestScore: flat.InterestScore, InterestReasons: flat.InterestReasons}
+	if file.Error == "" {
+		sum := sha256.Sum256([]byte(flat.Response))
+		file.Content, file.Size, file.SHA256 = flat.Response, len(flat.Response), hex.EncodeToString(sum[:])
+		file.Complete = scanner.IsFullReadCommand(flat.Command) && flat.Artifact != scanner.ArtifactPartial
+	}
+	record["files"], _ = json.Marshal([]*output.FileRecord{file})
+	for _, key := range []string{"filename", "command", "response", "error", "artifact", "truncation", "chunks"} {
+		delete(record, key)
+	}
+	return nil
+}
+
+func mustMarshal(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// Upgrade parses a results line of any known schema version, upgrading older records through the
+// migrations. It returns the version the record was written with
+func Upgrade(line []byte) (*output.ResultEvent, int, error) {
+	record := map[string]json.RawMessage{}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, 0, err
+	}
+	version := 1
+	if raw, ok := record["schema-version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, 0, fmt.Errorf("invalid schema-version: %w", err)
+		}
+	}
+	if version > output.SchemaVersion {
+		return nil, version, fmt.Errorf("%w %d, this binary reads up to %d", ErrNewerSchema, version, output.SchemaVersion)
+	}
+	for v := version; v < output.SchemaVersion; v++ {
+		migrate, ok := migrations[v]
+		if !ok {
+			return nil, version, fmt.Errorf("no migration from schema version %d", v)
+		}
+		if err := migrate(record); err != nil {
+			return nil, version, fmt.Errorf("could not migrate from schema version %d: %w", v, err)
+		}
+	}
+	record["schema-version"], _ = json.Marshal(output.SchemaVersion)
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, version, err
+	}
+	result := &output.ResultEvent{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, version, err
+	}
+	return result, version, nil
+}
@@ -0,0 +1,185 @@
+package rollup
+
+import (
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// dateLayout is the layout of the dates of a report
+const dateLayout = "2006-01-02"
+
+// names of the template files, a template directory overrides the embedded ones it contains
+const (
+	MarkdownTemplate = "report.md"
+	HTMLTemplate     = "report.html"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+// Templates are the parsed report templates. Markdown is rendered with text/template, html/template
+// would escape the cells
+type Templates struct {
+	markdown *texttemplate.Template
+	html     *template.Template
+}
+
+var defaultTemplates = mustDefaultTemplates()
+
+func mustDefaultTemplates() *Templates {
+	templates, err := parseTemplates(embedded, "templates", "")
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// DefaultTemplates returns the embedded report templates
+func DefaultTemplates() *Templates {
+	return defaultTemplates
+}
+
+// LoadTemplates returns the templates of dir, report.md and report.html, the embedded ones standing in
+// for a missing file. Both are checked against sample data so that errors are reported with their
+// file and line before any run is read. The asset function of the templates inlines a file of dir,
+// e.g. <img src="{{asset "logo.png"}}">
+func LoadTemplates(dir string) (*Templates, error) {
+	if dir == "" {
+		return defaultTemplates, nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	templates, err := parseTemplates(os.DirFS(dir), ".", dir)
+	if err != nil {
+		return nil, err
+	}
+	if templates.markdown == nil && templates.html == nil {
+		return nil, fmt.Errorf("%s contains neither %s nor %s", dir, MarkdownTemplate, HTMLTemplate)
+	}
+	if templates.markdown == nil {
+		templates.markdown = defaultTemplates.markdown
+	}
+	if templates.html == nil {
+		templates.html = defaultTemplates.html
+	}
+	for _, data := range []*ReportData{sampleReportData(), NewReportData(&Rollup{})} {
+		if err := templates.Markdown(io.Discard, data); err != nil {
+			return nil, err
+		}
+		if err := templates.HTML(io.Discard, data); err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// parseTemplates parses the templates of root in fsys, the missing ones are nil. The templates are named
+// after their path in dir, which the errors start with, and the assets are read from dir
+func parseTemplates(fsys fs.FS, root, dir string) (*Templates, error) {
+	asset := func(name string) (string, error) {
+		if dir == "" {
+			return "", fmt.Errorf("asset %s: the embedded templates have no assets", name)
+		}
+		content, err := os.ReadFile(filepath.Join(dir, filepath.Clean("/"+name)))
+		if err != nil {
+			return "", err
+		}
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = http.DetectContentType(content)
+		}
+		return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(content), nil
+	}
+	funcs := map[string]any{
+		"date": func(t interface{ Format(string) string }) string { return t.Format(dateLayout) },
+		"join": strings.Join,
+		"cell": markdownCell,
+	}
+	templates := &Templates{}
+	content, name, err := readTemplate(fsys, root, dir, MarkdownTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if content != "" {
+		textFuncs := texttemplate.FuncMap{"asset": asset}
+		for key, value := range funcs {
+			textFuncs[key] = value
+		}
+		if templates.markdown, err = texttemplate.New(name).Funcs(textFuncs).Parse(content); err != nil {
+			return nil, err
+		}
+	}
+	if content, name, err = readTemplate(fsys, root, dir, HTMLTemplate); err != nil {
+		return nil, err
+	}
+	if content != "" {
+		htmlFuncs := template.FuncMap{"asset": func(name string) (template.URL, error) {
+			uri, err := asset(name)
+			return template.URL(uri), err
+		}}
+		for key, value := range funcs {
+			htmlFuncs[key] = value
+		}
+		if templates.html, err = template.New(name).Funcs(htmlFuncs).Parse(content); err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// readTemplate returns the content of the template file and its name, an empty content when it doesn't exist
+func readTemplate(fsys fs.FS, root, dir, file string) (string, string, error) {
+	content, err := fs.ReadFile(fsys, path.Join(root, file))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	name := file
+	if dir != "" {
+		name = filepath.Join(dir, file)
+	}
+	return string(content), name, nil
+}
+
+// Markdown writes the report data with the Markdown template
+func (t *Templates) Markdown(w io.Writer, data *ReportData) error {
+	return t.markdown.Execute(w, data)
+}
+
+// HTML writes the report data with the HTML template
+func (t *Templates) HTML(w io.Writer, data *ReportData) error {
+	return t.html.Execute(w, data)
+}
+
+// Markdown writes the roll-up as a Markdown report
+func Markdown(w io.Writer, r *Rollup) error {
+	return defaultTemplates.Markdown(w, NewReportData(r))
+}
+
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// HTML writes the roll-up as a standalone HTML report
+func HTML(w io.Writer, r *Rollup) error {
+	return defaultTemplates.HTML(w, NewReportData(r))
+}
@@ -0,0 +1,119 @@
+package rollup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Title is the title of the reports
+const Title = "CVE-2024-23897 roll-up report"
+
+// ReportData is the data the report templates are executed on. Its fields are a stable API: fields
+// may be added, existing ones are not renamed or removed
+type ReportData struct {
+	Title string
+	// Summary is the one-line summary of the runs, e.g. "2 runs from 2026-10-05 to 2026-10-12."
+	Summary string
+	Stats   Stats
+	Weeks   []*Week
+	// Findings are the vulnerable instances, by status then first seen
+	Findings []*Instance
+	// Evidence are the evidence references of every finding
+	Evidence []*EvidenceRef
+	Runs     []*RunInfo
+	// Generated is the time the report was rendered
+	Generated time.Time
+}
+
+// Stats are the totals of a report
+type Stats struct {
+	Runs int
+	// From and To are the times of the first and last runs
+	From time.Time
+	To   time.Time
+	// Migrated is the number of records upgraded from older schema versions
+	Migrated     int
+	New          int
+	Persistent   int
+	Inconclusive int
+	Fixed        int
+	// Evidence is the number of evidence hashes of the findings, Timestamped of them timestamped
+	Evidence    int
+	Timestamped int
+}
+
+// EvidenceRef is an evidence reference with the instance it belongs to
+type EvidenceRef struct {
+	Instance string
+	*Evidence
+}
+
+// RunInfo describes a merged run
+type RunInfo struct {
+	Path     string
+	Time     time.Time
+	Results  int
+	Migrated int
+}
+
+// NewReportData returns the report data of a roll-up
+func NewReportData(r *Rollup) *ReportData {
+	counts := r.Counts()
+	data := &ReportData{
+		Title:    Title,
+		Summary:  summary(r),
+		Weeks:    r.Weeks,
+		Findings: r.Instances,
+		Stats: Stats{
+			Runs:         len(r.Runs),
+			Migrated:     r.Migrated,
+			New:          counts[StatusNew],
+			Persistent:   counts[StatusPersistent],
+			Inconclusive: counts[StatusInconclusive],
+			Fixed:        counts[StatusFixed],
+		},
+		Generated: time.Now(),
+	}
+	if len(r.Runs) != 0 {
+		data.Stats.From, data.Stats.To = r.Runs[0].Time, r.Runs[len(r.Runs)-1].Time
+	}
+	for _, run := range r.Runs {
+		data.Runs = append(data.Runs, &RunInfo{Path: run.Path, Time: run.Time, Results: len(run.Results), Migrated: run.Migrated})
+	}
+	for _, instance := range r.Instances {
+		for _, evidence := range instance.Evidence {
+			data.Evidence = append(data.Evidence, &EvidenceRef{Instance: instance.Key, Evidence: evidence})
+			if evidence.Timestamp != "" {
+				data.Stats.Timestamped++
+			}
+		}
+	}
+	data.Stats.Evidence = len(data.Evidence)
+	return data
+}
+
+func summary(r *Rollup) string {
+	if len(r.Runs) == 0 {
+		return "No runs."
+	}
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "%d runs from %s to %s", len(r.Runs), r.Runs[0].Time.Format(dateLayout), r.Runs[len(r.Runs)-1].Time.Format(dateLayout))
+	if r.Migrated != 0 {
+		fmt.Fprintf(builder, ", %d records upgraded from older schema versions", r.Migrated)
+	}
+	builder.WriteString(".")
+	return builder.String()
+}
+
+// sampleReportData returns report data reaching every field, the templates are checked against it
+func sampleReportData() *ReportData {
+	seen := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	evidence := &Evidence{Run: "results.jsonl", Target: "http://jenkins:8080", SHA256: strings.Repeat("0", 64), Timestamp: seen.Format(time.RFC3339), TSA: "http://tsa"}
+	return NewReportData(&Rollup{
+		Runs:  []*Run{{Path: "results.jsonl", Time: seen}},
+		Weeks: []*Week{{Week: week(seen), Runs: 1, Vulnerable: 1, New: 1}},
+		Instances: []*Instance{{Key: "http://jenkins:8080", Targets: []string{"http://jenkins:8080"}, Checks: []string{"CVE-2024-23897"},
+			Files: []string{"/etc/passwd"}, Status: StatusNew, FirstSeen: seen, LastSeen: seen, Runs: 1, Evidence: []*Evidence{evidence}}},
+	})
+}
@@ -0,0 +1,114 @@
+package rollup
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// goldenRollup returns a roll-up exercising every section of the reports
+func goldenRollup() *Rollup {
+	week1 := time.Date(2026, 10, 5, 9, 0, 0, 0, time.UTC)
+	week2 := week1.AddDate(0, 0, 7)
+	return &Rollup{
+		Runs: []*Run{{Path: "runs/20261005-090000/results.jsonl", Time: week1}, {Path: "runs/20261012-090000/results.jsonl", Time: week2}},
+		Weeks: []*Week{
+			{Week: "2026-W41", Runs: 1, Vulnerable: 2, New: 2},
+			{Week: "2026-W42", Runs: 1, Vulnerable: 1, New: 1, Fixed: 1},
+		},
+		Instances: []*Instance{
+			{Key: "http://c", Targets: []string{"http://c"}, Checks: []string{"CVE-2024-23897"}, Status: StatusNew, FirstSeen: week2, LastSeen: week2, Runs: 1},
+			{Key: "http://a:8080", Targets: []string{"http://a:8080"}, Checks: []string{"CVE-2024-23897"}, Files: []string{"/etc/passwd", "/tmp/a|b<c>"},
+				Status: StatusPersistent, FirstSeen: week1, LastSeen: week2, Runs: 2},
+			{Key: "http://fixed", Targets: []string{"http://fixed"}, Checks: []string{"CVE-2024-23897"}, Status: StatusFixed, FirstSeen: week1, LastSeen: week1, Runs: 1},
+		},
+		Migrated: 2,
+	}
+}
+
+// TestGolden renders the embedded templates, go test ./pkg/rollup -update rewrites the golden files
+// after an intended change
+func TestGolden(t *testing.T) {
+	for _, test := range []struct {
+		golden string
+		render func(*bytes.Buffer, *Rollup) error
+	}{
+		{golden: "report.md.golden", render: func(b *bytes.Buffer, r *Rollup) error { return Markdown(b, r) }},
+		{golden: "report.html.golden", render: func(b *bytes.Buffer, r *Rollup) error { return HTML(b, r) }},
+		{golden: "empty.md.golden", render: func(b *bytes.Buffer, _ *Rollup) error { return Markdown(b, &Rollup{}) }},
+		{golden: "empty.html.golden", render: func(b *bytes.Buffer, _ *Rollup) error { return HTML(b, &Rollup{}) }},
+	} {
+		got := &bytes.Buffer{}
+		if err := test.render(got, goldenRollup()); err != nil {
+			t.Fatal(err)
+		}
+		golden := filepath.Join("testdata", test.golden)
+		if *update {
+			if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want) {
+			t.Errorf("report does not match %s:\n%s", golden, got)
+		}
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		files map[string]string
+		// err is the start of the error after the directory, empty when the templates load
+		err  string
+		want string
+	}{
+		{name: "override", files: map[string]string{MarkdownTemplate: "{{.Title}}: {{.Stats.Evidence}} evidence {{asset \"logo.txt\"}}", "logo.txt": "ACME"},
+			want: "CVE-2024-23897 roll-up report: 0 evidence data:text/plain; charset=utf-8;base64,QUNNRQ=="},
+		{name: "parse error", files: map[string]string{HTMLTemplate: "<p>\n{{.Title}</p>"}, err: "report.html:2: "},
+		{name: "execute error", files: map[string]string{MarkdownTemplate: "{{range .Findings}}\n{{.Nope}}{{end}}"}, err: "report.md:2:2: "},
+		{name: "missing asset", files: map[string]string{MarkdownTemplate: "{{asset \"logo.png\"}}"}, err: "report.md:1:2: "},
+		{name: "no template", files: map[string]string{"logo.txt": "ACME"}, err: " contains neither"},
+	} {
+		dir := t.TempDir()
+		for name, content := range test.files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		templates, err := LoadTemplates(dir)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		got := &bytes.Buffer{}
+		if err := templates.Markdown(got, NewReportData(&Rollup{})); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+		// the html template is the embedded one
+		got.Reset()
+		if err := templates.HTML(got, NewReportData(goldenRollup())); err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := os.ReadFile(filepath.Join("testdata", "report.html.golden")); !bytes.Equal(got.Bytes(), want) {
+			t.Errorf("%s: html report was not rendered with the embedded template", test.name)
+		}
+	}
+}
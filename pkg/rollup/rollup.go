@@ -0,0 +1,332 @@
+package rollup
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ResultsFile is the results file of a -workdir run directory
+const ResultsFile = "results.jsonl"
+
+// runDirLayout is the time layout of the -workdir run directory names
+const runDirLayout = "20060102-150405"
+
+// statuses of an instance at the last run of a roll-up
+const (
+	// StatusNew is vulnerable in the last run and in no earlier run
+	StatusNew = "new"
+	// StatusPersistent is vulnerable in the last run and earlier runs
+	StatusPersistent = "persistent"
+	// StatusInconclusive was vulnerable but is inconclusive in the last run
+	StatusInconclusive = "inconclusive"
+	// StatusFixed was vulnerable but not reported in the last run
+	StatusFixed = "fixed"
+)
+
+// statusOrder orders the instances of a report
+var statusOrder = map[string]int{StatusNew: 0, StatusPersistent: 1, StatusInconclusive: 2, StatusFixed: 3}
+
+// Run is the results file of a scan
+type Run struct {
+	Path string
+	// Time is the time of the run directory name, else the modification time of the file
+	Time    time.Time
+	Results []*output.ResultEvent
+	// Migrated is the number of records upgraded from an older schema version
+	Migrated int
+}
+
+// ReadRun reads a results file, upgrading the records of older schema versions
+func ReadRun(path string) (*Run, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	run := &Run{Path: path, Time: info.ModTime()}
+	if t, err := time.ParseInLocation(runDirLayout, prefix(filepath.Base(filepath.Dir(path)), len(runDirLayout)), time.Local); err == nil {
+		run.Time = t
+	}
+	lines := bufio.NewScanner(file)
+	lines.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; lines.Scan(); line++ {
+		if len(lines.Bytes()) == 0 {
+			continue
+		}
+		result, version, err := Upgrade(lines.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if version < output.SchemaVersion {
+			run.Migrated++
+		}
+		run.Results = append(run.Results, result)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func prefix(s string, n int) string {
+	if len(s) < n {
+		return s
+	}
+	return s[:n]
+}
+
+// Expand returns the results files of paths and globs: results files as is, the results.jsonl of a
+// run directory and the results.jsonl of the run directories of a workdir. Every file is returned once,
+// also when named through links such as the latest link of a workdir
+func Expand(patterns []string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	add := func(path string) {
+		key := path
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			key = resolved
+		}
+		if !seen[key] {
+			seen[key] = true
+			files = append(files, path)
+		}
+	}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %v: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no results match %v", pattern)
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(match, ResultsFile)); err == nil {
+				add(filepath.Join(match, ResultsFile))
+				continue
+			}
+			entries, err := os.ReadDir(match)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				results := filepath.Join(match, entry.Name(), ResultsFile)
+				if !entry.IsDir() {
+					continue
+				}
+				if _, err := os.Stat(results); err == nil {
+					add(results)
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+// Instance is a vulnerable Jenkins instance of a roll-up
+type Instance struct {
+	// Key is the normalized target, or the target of the verdict cache entry the instance was reported through
+	Key string
+	// Targets are the targets reported for the instance
+	Targets []string
+	// Checks are the ids of the checks which reported the instance
+	Checks []string
+	// Files are the paths of the files read from the instance
+	Files     []string
+	Status    string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Runs is the number of runs the instance was vulnerable in
+	Runs int
+	// Evidence are the evidence hashes of the vulnerable results of the instance
+	Evidence []*Evidence
+}
+
+// Evidence references the tamper-evidence of a vulnerable result, see evidence.Verify
+type Evidence struct {
+	// Run is the results file of the result
+	Run    string
+	Target string
+	SHA256 string
+	// Timestamp is the time asserted by the timestamp authority, empty when the hash isn't timestamped
+	Timestamp string
+	TSA       string
+}
+
+// Week counts the vulnerable instances of the runs of an ISO week
+type Week struct {
+	// Week is the ISO week, e.g. 2026-W41
+	Week string
+	Runs int
+	// Vulnerable is the number of instances vulnerable in a run of the week
+	Vulnerable int
+	// New is the number of instances first seen in the week
+	New int
+	// Fixed is the number of instances vulnerable in the previous week and neither vulnerable nor inconclusive in the week
+	Fixed int
+}
+
+// Rollup is the merge of the runs of a period
+type Rollup struct {
+	Runs      []*Run
+	Weeks     []*Week
+	Instances []*Instance
+	// Migrated is the number of records upgraded from an older schema version
+	Migrated int
+}
+
+// Counts returns the number of instances by status
+func (r *Rollup) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, instance := range r.Instances {
+		counts[instance.Status]++
+	}
+	return counts
+}
+
+// Vulnerable reports whether result is a finding: a confirmed vulnerability or file read, not a
+// negative, inconclusive or possible verdict
+func Vulnerable(result *output.ResultEvent) bool {
+	return result.Verdict == "" || result.Verdict == scanner.VerdictAuthConfirmed
+}
+
+// instanceKey returns the key deduplicating the results of an instance, results served from the verdict
+// cache belong to the instance of the target they were cached from
+func instanceKey(result *output.ResultEvent) string {
+	if result.CachedFrom != "" {
+		return output.NormalizeTarget(result.CachedFrom)
+	}
+	return output.NormalizeTarget(result.URL)
+}
+
+func week(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// Merge merges the runs in time order, deduplicating the results by instance
+func Merge(runs []*Run) *Rollup {
+	runs = append([]*Run(nil), runs...)
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Time.Before(runs[j].Time) })
+	rollup := &Rollup{Runs: runs}
+	instances := map[string]*Instance{}
+	var last, lastInconclusive map[string]bool
+	var current *Week
+	var weekVulnerable, weekInconclusive, previousWeek map[string]bool
+	closeWeek := func() {
+		if current == nil {
+			return
+		}
+		current.Vulnerable = len(weekVulnerable)
+		for key := range previousWeek {
+			switch {
+			case weekInconclusive[key] && !weekVulnerable[key]:
+				// 无法判断, 留到下一周
+				weekVulnerable[key] = true
+			case !weekVulnerable[key]:
+				current.Fixed++
+			}
+		}
+		previousWeek = weekVulnerable
+	}
+	for _, run := range runs {
+		rollup.Migrated += run.Migrated
+		if label := week(run.Time); current == nil || current.Week != label {
+			closeWeek()
+			current = &Week{Week: label}
+			rollup.Weeks = append(rollup.Weeks, current)
+			weekVulnerable, weekInconclusive = map[string]bool{}, map[string]bool{}
+		}
+		current.Runs++
+		vulnerable, inconclusive := map[string]bool{}, map[string]bool{}
+		for _, result := range run.Results {
+			key := instanceKey(result)
+			if !Vulnerable(result) {
+				if result.Verdict == scanner.VerdictInconclusive {
+					inconclusive[key] = true
+					weekInconclusive[key] = true
+				}
+				continue
+			}
+			instance, ok := instances[key]
+			if !ok {
+				instance = &Instance{Key: key, FirstSeen: run.Time}
+				instances[key] = instance
+				current.New++
+			}
+			if !vulnerable[key] {
+				instance.Runs++
+			}
+			instance.LastSeen = run.Time
+			instance.Targets = appendUnique(instance.Targets, result.URL)
+			instance.Checks = appendUnique(instance.Checks, result.CheckID)
+			for _, file := range result.Files {
+				if file.Error == "" {
+					instance.Files = appendUnique(instance.Files, file.Path)
+				}
+			}
+			if result.EvidenceSHA256 != "" {
+				instance.Evidence = append(instance.Evidence, &Evidence{Run: run.Path, Target: result.URL, SHA256: result.EvidenceSHA256,
+					Timestamp: result.EvidenceTime, TSA: result.EvidenceTSA})
+			}
+			vulnerable[key] = true
+			weekVulnerable[key] = true
+		}
+		last, lastInconclusive = vulnerable, inconclusive
+	}
+	closeWeek()
+
+	for key, instance := range instances {
+		switch {
+		case last[key] && instance.Runs == 1:
+			instance.Status = StatusNew
+		case last[key]:
+			instance.Status = StatusPersistent
+		case lastInconclusive[key]:
+			instance.Status = StatusInconclusive
+		default:
+			instance.Status = StatusFixed
+		}
+		rollup.Instances = append(rollup.Instances, instance)
+	}
+	sort.Slice(rollup.Instances, func(i, j int) bool {
+		a, b := rollup.Instances[i], rollup.Instances[j]
+		if a.Status != b.Status {
+			return statusOrder[a.Status] < statusOrder[b.Status]
+		}
+		if !a.FirstSeen.Equal(b.FirstSeen) {
+			return a.FirstSeen.Before(b.FirstSeen)
+		}
+		return a.Key < b.Key
+	})
+	return rollup
+}
+
+func appendUnique(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
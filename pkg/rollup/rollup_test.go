@@ -0,0 +1,187 @@
+package rollup
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+)
+
+func TestUpgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		checkID string
+		version int
+		err     error
+	}{
+		{name: "v1 finding", line: `{"host":"a","url":"http://a","Mode":1,"response":"who-am-i"}`, checkID: scanner.CVE202423897, version: 1},
+		// 不确定的结果没有检查 id
+		{name: "v1 inconclusive", line: `{"url":"http://a","verdict":"inconclusive","inconclusive":"timeout"}`, version: 1},
+		{name: "v1 with check-id", line: `{"check-id":"jenkins-version-advisory","url":"http://a"}`, checkID: scanner.JenkinsVersionAdvisory, version: 1},
+		{name: "v3", line: `{"schema-version":3,"check-id":"CVE-2024-23897","url":"http://a"}`, checkID: scanner.CVE202423897, version: 3},
+		{name: "newer", line: `{"schema-version":99,"url":"http://a"}`, version: 99, err: ErrNewerSchema},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, version, err := Upgrade([]byte(test.line))
+			if !errors.Is(err, test.err) || version != test.version {
+				t.Fatalf("Upgrade() = %d, %v, want %d, %v", version, err, test.version, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if result.SchemaVersion != output.SchemaVersion || result.CheckID != test.checkID || result.URL != "http://a" {
+				t.Errorf("Upgrade() = %+v, want schema %d and check %q", result, output.SchemaVersion, test.checkID)
+			}
+		})
+	}
+}
+
+func TestUpgradeFlatReadFile(t *testing.T) {
+	line := `{"schema-version":2,"check-id":"CVE-2024-23897","url":"http://a","Mode":3,"command":"connect-node","filename":"/etc/passwd","response":"root:x:0:0","full-read":true,"artifact":"partial","interest-score":30,"interest-reasons":["key=value density 100%"]}`
+	result, _, err := Upgrade([]byte(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := output.FileRecord{Path: "/etc/passwd", RequestedVia: "connect-node", Size: 10, SHA256: "89ef98f859f634507b321f5540785bedb26696c45ab130a70d9c61655ddfc5cc", Content: "root:x:0:0",
+		InterestScore: 30, InterestReasons: []string{"key=value density 100%"}}
+	if len(result.Files) != 1 || !reflect.DeepEqual(*result.Files[0], want) || result.Args != "" || result.Response != "" {
+		t.Fatalf("Upgrade() = %+v, want the file record %+v", result, want)
+	}
+	// 非读取文件的记录不变
+	if result, _, _ := Upgrade([]byte(`{"schema-version":2,"url":"http://a","Mode":1,"response":"who-am-i"}`)); len(result.Files) != 0 || result.Response != "who-am-i" {
+		t.Errorf("Upgrade() of a check = %+v", result)
+	}
+}
+
+// writeRun writes the results lines to the run directory of -workdir named after at
+func writeRun(t *testing.T, workdir string, at time.Time, lines ...string) {
+	t.Helper()
+	dir := filepath.Join(workdir, at.Format(runDirLayout))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ResultsFile), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	workdir := t.TempDir()
+	week1 := time.Date(2026, 10, 5, 9, 0, 0, 0, time.Local)
+	// 旧版本的记录
+	writeRun(t, workdir, week1,
+		`{"url":"http://a:8080","Mode":1}`,
+		`{"url":"http://b","Mode":1}`,
+		`{"url":"http://fixed","Mode":1}`)
+	// 同一周的第二次扫描, 同一实例的多条结果只算一次
+	writeRun(t, workdir, week1.Add(48*time.Hour),
+		`{"schema-version":3,"check-id":"CVE-2024-23897","url":"http://A:8080/","Mode":1}`,
+		`{"schema-version":2,"check-id":"CVE-2024-23897","url":"http://a:8080","Mode":3,"filename":"/etc/passwd","response":"root:x:0:0"}`,
+		`{"schema-version":3,"check-id":"CVE-2024-23897","url":"http://b:80","Mode":1}`)
+	writeRun(t, workdir, week1.AddDate(0, 0, 7),
+		`{"schema-version":3,"check-id":"CVE-2024-23897","url":"http://a:8080","Mode":1}`,
+		`{"schema-version":3,"url":"http://b","Mode":1,"verdict":"inconclusive","inconclusive":"timeout"}`,
+		`{"schema-version":3,"check-id":"CVE-2024-23897","url":"http://c","Mode":1,"verdict":"auth_required_confirmed"}`,
+		`{"schema-version":3,"check-id":"CVE-2024-23897","url":"http://alias","Mode":1,"cached-from":"http://c"}`,
+		`{"schema-version":3,"check-id":"CVE-2024-23897","url":"http://d","Mode":1,"verdict":"auth_required_possibly_vulnerable"}`)
+	if err := os.Symlink(week1.AddDate(0, 0, 7).Format(runDirLayout), filepath.Join(workdir, "latest")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Expand([]string{workdir, filepath.Join(workdir, "latest")})
+	if err != nil || len(files) != 3 {
+		t.Fatalf("Expand() = %v, %v, want the 3 runs once", files, err)
+	}
+	files, err = Expand([]string{filepath.Join(workdir, "2026*")})
+	if err != nil || len(files) != 3 {
+		t.Fatalf("Expand() of a glob = %v, %v, want 3 runs", files, err)
+	}
+	var runs []*Run
+	for _, file := range files {
+		run, err := ReadRun(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, run)
+	}
+	rollup := Merge(runs)
+	if rollup.Migrated != 4 {
+		t.Errorf("Migrated = %d, want 4", rollup.Migrated)
+	}
+
+	want := map[string]struct {
+		status string
+		runs   int
+		first  time.Time
+	}{
+		"http://a:8080": {StatusPersistent, 3, week1},
+		"http://b":      {StatusInconclusive, 2, week1},
+		"http://fixed":  {StatusFixed, 1, week1},
+		"http://c":      {StatusNew, 1, week1.AddDate(0, 0, 7)},
+	}
+	if len(rollup.Instances) != len(want) {
+		t.Fatalf("Instances = %d, want %d", len(rollup.Instances), len(want))
+	}
+	for _, instance := range rollup.Instances {
+		w, ok := want[instance.Key]
+		if !ok {
+			t.Errorf("unexpected instance %s", instance.Key)
+			continue
+		}
+		if instance.Status != w.status || instance.Runs != w.runs || !instance.FirstSeen.Equal(w.first) {
+			t.Errorf("instance %s = %s in %d runs first seen %s, want %s in %d runs first seen %s", instance.Key,
+				instance.Status, instance.Runs, instance.FirstSeen, w.status, w.runs, w.first)
+		}
+	}
+	if rollup.Instances[0].Status != StatusNew || rollup.Instances[len(rollup.Instances)-1].Status != StatusFixed {
+		t.Errorf("instances not ordered by status")
+	}
+
+	wantWeeks := []Week{
+		{Week: "2026-W41", Runs: 2, Vulnerable: 3, New: 3},
+		{Week: "2026-W42", Runs: 1, Vulnerable: 2, New: 1, Fixed: 1},
+	}
+	if len(rollup.Weeks) != len(wantWeeks) {
+		t.Fatalf("Weeks = %d, want %d", len(rollup.Weeks), len(wantWeeks))
+	}
+	for i, week := range rollup.Weeks {
+		if *week != wantWeeks[i] {
+			t.Errorf("week %d = %+v, want %+v", i, *week, wantWeeks[i])
+		}
+	}
+
+	markdown := &bytes.Buffer{}
+	if err := Markdown(markdown, rollup); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"| 2026-W42 | 1 | 2 | 1 | 1 |", "| http://a:8080 | persistent | 2026-10-05 | 2026-10-12 | 3 | CVE-2024-23897 | /etc/passwd |", "4 records upgraded"} {
+		if !strings.Contains(markdown.String(), want) {
+			t.Errorf("Markdown() = %s, want %q", markdown, want)
+		}
+	}
+	html := &bytes.Buffer{}
+	if err := HTML(html, rollup); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html.String(), `<td class="fixed">fixed</td>`) || !strings.Contains(html.String(), "<td>2026-W41</td>") {
+		t.Errorf("HTML() = %s", html)
+	}
+}
+
+func TestReadRunNewerSchema(t *testing.T) {
+	workdir := t.TempDir()
+	writeRun(t, workdir, time.Now(), `{"url":"http://a"}`, `{"schema-version":99,"url":"http://a"}`)
+	files, _ := Expand([]string{workdir})
+	if _, err := ReadRun(files[0]); !errors.Is(err, ErrNewerSchema) || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("ReadRun() = %v, want %v at line 2", err, ErrNewerSchema)
+	}
+}
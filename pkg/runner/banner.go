@@ -1,7 +1,14 @@
 package runner
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/projectdiscovery/goflags"
 	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/envflags"
+	updateutils "github.com/wjlin0/CVE-2024-23897/pkg/update"
+	"github.com/wjlin0/CVE-2024-23897/pkg/webhook"
 	"os"
 )
 
@@ -31,3 +38,49 @@ func ShowVersion() {
 	gologger.Info().Msgf("Current %s version v%v ", repoName, version)
 	os.Exit(0)
 }
+
+// showVersionCheck prints the latest release compared with the current version, as JSON with jsonOutput
+func showVersionCheck(jsonOutput bool) {
+	result, err := updateutils.GetVersionCheckCallback(repoName, version, "")()
+	if errors.Is(err, updateutils.ErrUpdateCheckDisabled) {
+		os.Exit(0)
+	}
+	if err != nil {
+		gologger.Fatal().Msgf("%s version check failed: %s", repoName, err)
+	}
+	if jsonOutput {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(data))
+		os.Exit(0)
+	}
+	status := "latest"
+	if result.Outdated {
+		status = "outdated"
+	} else if result.ComparedBy == "" {
+		status = "not comparable"
+	}
+	gologger.Info().Msgf("Current %s version v%v, latest release %v (%v)", repoName, version, result.LatestVersion, status)
+	if !result.PublishedAt.IsZero() {
+		gologger.Info().Msgf("published %v", result.PublishedAt.Format("2006-01-02"))
+	}
+	gologger.Info().Msgf("release %v", result.ReleaseURL)
+	if result.AssetName != "" {
+		gologger.Info().Msgf("asset for this platform: %v", result.AssetName)
+	}
+	os.Exit(0)
+}
+
+// ShowEnvHelp prints the environment variable of every flag
+func ShowEnvHelp(flagSet *goflags.FlagSet) {
+	envflags.PrintHelp(os.Stdout, flagSet.CommandLine, callbackFlags...)
+	os.Exit(0)
+}
+
+func ShowWebhookSchema() {
+	schema, err := webhook.Schema()
+	if err != nil {
+		gologger.Fatal().Msgf("could not generate webhook schema: %s", err)
+	}
+	fmt.Println(string(schema))
+	os.Exit(0)
+}
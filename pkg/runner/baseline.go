@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/projectdiscovery/gologger"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"github.com/wjlin0/CVE-2024-23897/pkg/baseline"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"time"
+)
+
+// ErrDeviation is returned by the run when the verdicts deviate from the -baseline
+var ErrDeviation = errors.New("targets deviate from the baseline")
+
+// baselineKey returns the key of a baseline target, the key the run records its verdict with
+func baselineKey(target string) string {
+	if target = adjustTarget(target); target == "" {
+		return ""
+	}
+	return input.NewTarget(target).ToString()
+}
+
+// loadBaseline reads the -baseline file and starts recording the verdicts of the targets
+func (r *Runner) loadBaseline() error {
+	if r.options.Baseline == "" && r.options.WriteBaseline == "" {
+		return nil
+	}
+	r.observations = baseline.Observations{}
+	for _, target := range r.excluded {
+		r.observations.Record(baselineKey(target), baseline.Excluded)
+	}
+	if r.options.Baseline == "" {
+		return nil
+	}
+	var err error
+	if r.baseline, err = baseline.Read(r.options.Baseline, baselineKey); err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not read baseline %v", r.options.Baseline)
+	}
+	return nil
+}
+
+// observe records the verdict of a target for the baseline
+func (r *Runner) observe(target *input.Target, verdict string) {
+	if r.observations == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.observations.Record(target.ToString(), verdict)
+}
+
+// findingVerdict returns the verdict of a finding, anonymously vulnerable findings have none
+func findingVerdict(result *output.ResultEvent) string {
+	if result.Verdict == "" {
+		return baseline.Vulnerable
+	}
+	return result.Verdict
+}
+
+// negativeVerdict returns the verdict of a target no check matched
+func negativeVerdict(backend *scanner.Backend, probeErr, checkErr error, class string) string {
+	switch {
+	case class != "":
+		return scanner.VerdictInconclusive
+	case probeErr != nil, backend == nil:
+		return baseline.Unreachable
+	case !backend.Jenkins:
+		return scanner.VerdictNotJenkins
+	case checkErr != nil:
+		return baseline.Unreachable
+	}
+	return scanner.VerdictPatched
+}
+
+// checkBaseline writes the -write-baseline file and reports the deviations from the -baseline,
+// failing the run when there are any
+func (r *Runner) checkBaseline() error {
+	if r.observations == nil {
+		return nil
+	}
+	if r.options.WriteBaseline != "" {
+		written, omitted := baseline.New(r.observations, time.Now())
+		if err := written.Write(r.options.WriteBaseline); err != nil {
+			gologger.Error().Msgf("could not write baseline %v: %s", r.options.WriteBaseline, err)
+		} else {
+			gologger.Info().Msgf("wrote the baseline of %d targets to %s, %d targets without a conclusive verdict were left out", len(written.Targets), r.options.WriteBaseline, omitted)
+		}
+	}
+	if r.baseline == nil {
+		return nil
+	}
+	report := baseline.Compare(r.baseline, r.observations)
+	report.Baseline = r.options.Baseline
+	if r.options.Compliance != "" {
+		if err := report.Write(r.options.Compliance); err != nil {
+			gologger.Error().Msgf("could not write compliance report %v: %s", r.options.Compliance, err)
+		}
+	}
+	if len(report.Deviations) == 0 {
+		gologger.Info().Msgf("compliance: all %d baseline targets comply with %s", report.Expected, r.options.Baseline)
+		return nil
+	}
+	gologger.Info().Msgf("compliance: %d of %d baseline targets comply with %s, %d deviations", report.Compliant, report.Expected, r.options.Baseline, len(report.Deviations))
+	for _, deviation := range report.Deviations {
+		expected := deviation.Expected
+		if expected == "" {
+			expected = "not in baseline"
+		}
+		gologger.Error().Msgf("deviation %s: %s expected %s, observed %s", deviation.Kind, deviation.Target, expected, deviation.Observed)
+	}
+	return fmt.Errorf("%d %w", len(report.Deviations), ErrDeviation)
+}
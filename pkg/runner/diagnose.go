@@ -0,0 +1,279 @@
+package runner
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/atomicfile"
+	"github.com/wjlin0/CVE-2024-23897/pkg/credential"
+	"github.com/wjlin0/CVE-2024-23897/pkg/envflags"
+	"github.com/wjlin0/CVE-2024-23897/pkg/redact"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	updateutils "github.com/wjlin0/CVE-2024-23897/pkg/update"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DiagnoseCommand is the subcommand collecting the environment of a failing update or scan into a zip
+const DiagnoseCommand = "diagnose"
+
+// githubProbeURL is probed for the connectivity to github, it doesn't count against the rate limit
+const githubProbeURL = "https://api.github.com/rate_limit"
+
+// proxyVariables are the environment variables selecting proxies
+var proxyVariables = []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "all_proxy", "no_proxy"}
+
+// logFiles are the -log flags of the diagnose subcommand
+type logFiles []string
+
+func (l *logFiles) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *logFiles) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// diagnoseItem is a file of the diagnose zip
+type diagnoseItem struct {
+	name string
+	data []byte
+}
+
+// diagnosis is the zip of the diagnose subcommand, every item is redacted before being added
+type diagnosis struct {
+	redactor *redact.Redactor
+	zip      *zip.Writer
+	items    []string
+}
+
+func (d *diagnosis) add(name string, data []byte) error {
+	w, err := d.zip.Create(name)
+	if err != nil {
+		return err
+	}
+	d.items = append(d.items, name)
+	_, err = w.Write(d.redactor.Bytes(data))
+	return err
+}
+
+// Diagnose writes a zip with the effective config, the environment, connectivity probes, the updater state
+// and the tail of logs for support and returns the exit code. The flags after -- are the flags of the scan
+func Diagnose(args []string) int {
+	flagSet := flag.NewFlagSet(DiagnoseCommand, flag.ContinueOnError)
+	out := flagSet.String("o", "", "zip file written, CVE-2024-23897-diagnose-<time>.zip by default")
+	target := flagSet.String("target", "", "URL of a target to probe")
+	offline := flagSet.Bool("offline", false, "skip the connectivity probes")
+	lines := flagSet.Int("lines", 200, "number of last lines included of each -log file")
+	var logs logFiles
+	flagSet.Var(&logs, "log", "log file to include the last lines of, e.g. a saved -debug output (repeatable)")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: CVE-2024-23897 %s [-o diagnose.zip] [-target url] [-offline] [-log file]... [-- scan flags]\n", DiagnoseCommand)
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return 2
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("%s-diagnose-%s.zip", repoName, time.Now().Format("20060102-150405"))
+	}
+
+	// 按扫描时的方式解析参数, 得到实际生效的配置
+	options := &types.Options{}
+	scanFlags := newFlagSet(options)
+	os.Args = append(os.Args[:1:1], envflags.Args(scanFlags.CommandLine, flagSet.Args(), os.LookupEnv, callbackFlags...)...)
+	_ = scanFlags.Parse()
+
+	d := &diagnosis{redactor: redact.New(optionSecrets(options)...)}
+	d.redactor.Add(credentialSecrets()...)
+	buffer := &bytes.Buffer{}
+	d.zip = zip.NewWriter(buffer)
+
+	config, _ := json.MarshalIndent(redactOptions(options), "", "  ")
+	items := []diagnoseItem{
+		{"config.json", config},
+		{"system.txt", diagnoseSystem()},
+		{"proxy.txt", diagnoseProxy(options)},
+		{"probes.txt", diagnoseProbes(options, *target, *offline)},
+		{"updater.txt", diagnoseUpdater()},
+	}
+	for _, log := range logs {
+		items = append(items, diagnoseItem{"logs/" + filepath.Base(log), tailFile(log, *lines)})
+	}
+	for _, item := range items {
+		if err := d.add(item.name, item.data); err != nil {
+			gologger.Error().Msgf("could not add %v: %s", item.name, err)
+			return 2
+		}
+	}
+	if err := d.zip.Close(); err != nil {
+		gologger.Error().Msgf("could not write %v: %s", *out, err)
+		return 2
+	}
+	if err := atomicfile.WriteFile(*out, buffer.Bytes(), 0600); err != nil {
+		gologger.Error().Msgf("could not write %v: %s", *out, err)
+		return 2
+	}
+	gologger.Info().Msgf("wrote %v with %s, secrets are redacted", *out, strings.Join(d.items, ", "))
+	return 0
+}
+
+// credentialSecrets returns the secrets of the credentials read from the environment or a file, the
+// commands of command providers are not run
+func credentialSecrets() []string {
+	var secrets []string
+	for _, name := range credential.Names() {
+		switch provider := credential.Default.Provider(name).(type) {
+		case *credential.Env, *credential.File, *credential.Static:
+			if secret, err := provider.Secret(context.Background(), name); err == nil {
+				secrets = append(secrets, secret)
+			}
+		}
+	}
+	return secrets
+}
+
+func diagnoseSystem() []byte {
+	builder := &strings.Builder{}
+	executable, _ := os.Executable()
+	fmt.Fprintf(builder, "version: %s v%s\n", repoName, version)
+	fmt.Fprintf(builder, "os: %s\narch: %s\ngo: %s\ncpus: %d\n", runtime.GOOS, runtime.GOARCH, runtime.Version(), runtime.NumCPU())
+	fmt.Fprintf(builder, "executable: %s\n", executable)
+	fmt.Fprintf(builder, "time: %s\n", time.Now().Format(time.RFC3339))
+	for _, name := range credential.Names() {
+		fmt.Fprintf(builder, "credential %s from %s\n", name, credential.Default.Provider(name))
+	}
+	return []byte(builder.String())
+}
+
+func diagnoseProxy(options *types.Options) []byte {
+	builder := &strings.Builder{}
+	for _, name := range proxyVariables {
+		if value, ok := os.LookupEnv(name); ok {
+			fmt.Fprintf(builder, "%s=%s\n", name, redact.URL(value))
+		}
+	}
+	for _, proxy := range options.ProxyURL {
+		fmt.Fprintf(builder, "-proxy %s\n", redact.URL(proxy))
+	}
+	if builder.Len() == 0 {
+		builder.WriteString("no proxy configured\n")
+	}
+	return []byte(builder.String())
+}
+
+// diagnoseProbes requests github and the target through the first -proxy, else the proxy environment
+func diagnoseProbes(options *types.Options, target string, offline bool) []byte {
+	probes := []string{githubProbeURL}
+	if target != "" {
+		probes = append(probes, target)
+	}
+	builder := &strings.Builder{}
+	if offline {
+		for _, probe := range probes {
+			fmt.Fprintf(builder, "%s: skipped (-offline)\n", redact.URL(probe))
+		}
+		return []byte(builder.String())
+	}
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if len(options.ProxyURL) > 0 {
+		if proxy, err := url.Parse(options.ProxyURL[0]); err == nil {
+			transport.Proxy = http.ProxyURL(proxy)
+		}
+	}
+	client := &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	for _, probe := range probes {
+		start := time.Now()
+		resp, err := client.Get(probe)
+		elapsed := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			fmt.Fprintf(builder, "%s: failed after %s: %s\n", redact.URL(probe), elapsed, strings.ReplaceAll(err.Error(), probe, redact.URL(probe)))
+			continue
+		}
+		_ = resp.Body.Close()
+		fmt.Fprintf(builder, "%s: %s in %s", redact.URL(probe), resp.Status, elapsed)
+		if jenkins := resp.Header.Get("X-Jenkins"); jenkins != "" {
+			fmt.Fprintf(builder, ", X-Jenkins %s", jenkins)
+		}
+		if resp.TLS != nil {
+			fmt.Fprintf(builder, ", TLS 0x%04x", resp.TLS.Version)
+		}
+		builder.WriteString("\n")
+	}
+	return []byte(builder.String())
+}
+
+// diagnoseUpdater lists the state dir of the updater with the content of its json records, the release
+// fingerprints and version checks of the last updates
+func diagnoseUpdater() []byte {
+	builder := &strings.Builder{}
+	dir := updateutils.StateDir()
+	if dir == "" {
+		builder.WriteString("state dir: none writable, kept in memory\n")
+		return []byte(builder.String())
+	}
+	fmt.Fprintf(builder, "state dir: %s\n", dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fmt.Fprintf(builder, "could not read the state dir: %s\n", err)
+		return []byte(builder.String())
+	}
+	var records []string
+	var assets, assetBytes int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".json") {
+			records = append(records, entry.Name())
+			continue
+		}
+		if entry.Name() != "install-id" {
+			assets++
+			assetBytes += info.Size()
+		}
+	}
+	fmt.Fprintf(builder, "asset cache: %d files, %d bytes\n", assets, assetBytes)
+	sort.Strings(records)
+	for _, record := range records {
+		data, err := os.ReadFile(filepath.Join(dir, record))
+		if err != nil {
+			fmt.Fprintf(builder, "\n%s: %s\n", record, err)
+			continue
+		}
+		fmt.Fprintf(builder, "\n%s:\n%s\n", record, bytes.TrimSpace(data))
+	}
+	return []byte(builder.String())
+}
+
+// tailFile returns the last n lines of path, or why they could not be read
+func tailFile(path string, n int) []byte {
+	file, err := os.Open(path)
+	if err != nil {
+		return []byte(fmt.Sprintf("could not read %s: %s\n", path, err))
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
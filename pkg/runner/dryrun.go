@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"github.com/wjlin0/CVE-2024-23897/pkg/webhook"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+// dryRunPlan is what a run would request from a target
+type dryRunPlan struct {
+	mode output.Mode
+	// requests are the planned requests, "command path" or the command alone
+	requests []string
+}
+
+// RunDryRun walks the pipeline of the options without sending any request to the targets: the
+// targets are loaded, normalized and checked against the scope, the requests of each one are listed,
+// the output sinks are initialized and the webhook delivery is exercised against a local endpoint
+func (r *Runner) RunDryRun() error {
+	r.displayExecutionInfo()
+	gologger.Info().Label("dry-run").Msgf("No request is sent to the targets")
+
+	planned, refused := 0, 0
+	for _, target := range r.targets {
+		record := output.NewResultEvent(target)
+		record.Verdict = scanner.VerdictDryRun
+		if err := r.scanner.Scope().Allowed(target.ToString()); err != nil {
+			refused++
+			record.Error = err.Error()
+			gologger.Info().Label("dry-run").Msgf("%s: %s", target.ToString(), err)
+			r.writeResult(record)
+			continue
+		}
+		plan := r.dryRunPlan(target)
+		record.Mode = plan.mode
+		record.Details = map[string]string{"requests": strings.Join(plan.requests, "\n")}
+		planned += len(plan.requests)
+		gologger.Info().Label("dry-run").Msgf("%s: %s, %d requests", target.ToString(), plan.mode, len(plan.requests))
+		for _, request := range plan.requests {
+			gologger.Info().Label("dry-run").Msgf("  %s", request)
+		}
+		r.writeResult(record)
+	}
+	if r.webhook != nil {
+		if err := r.dryRunWebhook(); err != nil {
+			return fmt.Errorf("dry-run webhook delivery failed: %w", err)
+		}
+	}
+
+	gologger.Info().Label("dry-run").Msgf("%d targets, %d excluded by -exclude and -scope, %d refused by the scope", len(r.targets), len(r.excluded), refused)
+	gologger.Info().Label("dry-run").Msgf("%d requests planned after the checks", planned)
+	for _, sink := range r.dryRunSinks() {
+		gologger.Info().Label("dry-run").Msgf("initialized %s", sink)
+	}
+	return nil
+}
+
+// dryRunPlan returns the requests a run would send to the target after its checks
+func (r *Runner) dryRunPlan(target *input.Target) *dryRunPlan {
+	ids := make([]string, 0, len(r.checks))
+	for _, check := range r.checks {
+		ids = append(ids, check.ID())
+	}
+	plan := &dryRunPlan{}
+	reads := func() {
+		for _, filename := range r.options.Args {
+			for _, command := range r.options.Command {
+				plan.requests = append(plan.requests, command+" "+filename)
+			}
+		}
+		// 变体按推断的系统选择, 推断失败时为 linux, 都无法读取时尝试另一个变体
+		for _, variant := range []string{scanner.OSLinux, scanner.OtherOS(scanner.OSLinux)} {
+			for _, filename := range scanner.PresetVariantPaths(r.options.VariantPresets, variant) {
+				for _, command := range r.options.Command {
+					plan.requests = append(plan.requests, fmt.Sprintf("%s %s (%s)", command, filename, variant))
+				}
+			}
+		}
+	}
+	switch {
+	case r.options.IsListAvailableCommands():
+		plan.mode = output.ModeListAvailableCommands
+		plan.requests = append(plan.requests, "help")
+	case r.options.IsReadMode():
+		plan.mode = output.ModeReadFile
+		reads()
+	case r.options.Exec:
+		plan.mode = output.ModeExec
+		for _, command := range r.options.Command {
+			plan.requests = append(plan.requests, strings.TrimSpace(command+" "+strings.Join(r.options.Args, " ")))
+		}
+	default:
+		plan.mode = output.ModeCheck
+		plan.requests = append(plan.requests, "checks "+strings.Join(ids, ","))
+		if r.options.AutoLoot {
+			// 仅在检测为存在漏洞时读取
+			reads()
+		}
+	}
+	return plan
+}
+
+// dryRunWebhook delivers a sample finding through a sender of the webhook options to a local
+// receiver, the configured webhook is not contacted
+func (r *Runner) dryRunWebhook() error {
+	receiver := webhook.NewReceiver()
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	sender := webhook.NewSender(server.URL, &http.Client{Timeout: 10 * time.Second})
+	sample := output.NewResultEvent(input.NewTarget("http://jenkins.example:8080"))
+	sample.Mode = output.ModeCheck
+	sample.Verdict = scanner.VerdictDryRun
+	if err := sender.Send(context.Background(), webhook.NewPayload(repoName, sample, time.Now())); err != nil {
+		return err
+	}
+	if len(receiver.Payloads()) != 1 {
+		return fmt.Errorf("the local endpoint received %d payloads", len(receiver.Payloads()))
+	}
+	gologger.Info().Label("dry-run").Msgf("delivered a sample payload to a local endpoint, %s was not contacted", r.options.Webhook)
+	return nil
+}
+
+// dryRunSinks returns the output sinks initialized by the options
+func (r *Runner) dryRunSinks() []string {
+	var sinks []string
+	if r.results != nil {
+		sinks = append(sinks, "results file "+r.options.Results)
+	}
+	if r.sarif != nil {
+		sinks = append(sinks, "sarif file "+r.options.Sarif)
+	}
+	if r.runDir != "" {
+		sinks = append(sinks, "run directory "+r.runDir)
+	}
+	if r.ledger != nil {
+		sinks = append(sinks, "ledger "+r.options.Ledger)
+	}
+	if r.webhook != nil {
+		sinks = append(sinks, "webhook "+r.options.Webhook)
+	}
+	return sinks
+}
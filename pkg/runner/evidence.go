@@ -0,0 +1,117 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+	"github.com/wjlin0/CVE-2024-23897/pkg/evidence"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"net/http"
+	"os"
+	"time"
+)
+
+// VerifyEvidenceCommand is the subcommand verifying the evidence of results files
+const VerifyEvidenceCommand = "verify-evidence"
+
+// captureEvidence sets the evidence hash of the finding and, with -timestamp-evidence, its
+// timestamp token. A failing TSA leaves the finding with its hash only
+func (r *Runner) captureEvidence(ctx context.Context, result *output.ResultEvent) {
+	sum, err := evidence.Hash(result)
+	if err != nil {
+		gologger.Warning().Msgf("could not hash the evidence of %s: %s", result.URL, err)
+		return
+	}
+	result.EvidenceSHA256 = hex.EncodeToString(sum)
+	if r.options.TimestampEvidence == "" {
+		return
+	}
+	client := &http.Client{Timeout: time.Duration(r.options.Timeout) * time.Second, Transport: egress.Default.Transport(egress.Timestamp, nil)}
+	token, err := evidence.Request(ctx, client, r.options.TimestampEvidence, sum)
+	if err != nil {
+		gologger.Warning().Msgf("could not timestamp the evidence of %s, keeping its hash only: %s", result.URL, err)
+		r.untimestamped.Add(1)
+		return
+	}
+	result.EvidenceTimestamp = base64.StdEncoding.EncodeToString(token.Raw)
+	result.EvidenceTSA = r.options.TimestampEvidence
+	result.EvidenceTime = token.Time.UTC().Format(time.RFC3339)
+}
+
+// VerifyEvidence verifies the evidence hashes and timestamp tokens of results files and returns the exit code
+func VerifyEvidence(args []string) int {
+	flagSet := flag.NewFlagSet(VerifyEvidenceCommand, flag.ContinueOnError)
+	roots := flagSet.String("tsa-roots", "", "PEM file of the trusted timestamp authority roots, the system roots by default")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: CVE-2024-23897 %s [-tsa-roots roots.pem] results.jsonl...\n", VerifyEvidenceCommand)
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return 2
+	}
+	if flagSet.NArg() == 0 {
+		flagSet.Usage()
+		return 2
+	}
+	var pool *x509.CertPool
+	if *roots != "" {
+		data, err := os.ReadFile(*roots)
+		if err != nil {
+			gologger.Error().Msgf("could not read tsa roots %v: %s", *roots, err)
+			return 2
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			gologger.Error().Msgf("no certificate in tsa roots %v", *roots)
+			return 2
+		}
+	}
+	verified, timestamped, unhashed, failed := 0, 0, 0, 0
+	for _, path := range flagSet.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			gologger.Error().Msgf("could not open results %v: %s", path, err)
+			failed++
+			continue
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			v := evidence.Verify(scanner.Bytes(), pool)
+			switch {
+			case v.Err != nil:
+				failed++
+				gologger.Error().Msgf("%s:%d %s: %s", path, line, v.URL, v.Err)
+			case !v.Hashed:
+				unhashed++
+				gologger.Debug().Msgf("%s:%d %s has no evidence hash", path, line, v.URL)
+			case v.Timestamped:
+				verified++
+				timestamped++
+				gologger.Info().Msgf("%s:%d %s timestamped at %s by %s", path, line, v.URL, v.Time.UTC().Format(time.RFC3339), v.TSA)
+			default:
+				verified++
+				gologger.Info().Msgf("%s:%d %s matches its evidence hash", path, line, v.URL)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			gologger.Error().Msgf("could not read results %v: %s", path, err)
+			failed++
+		}
+		_ = file.Close()
+	}
+	gologger.Info().Msgf("verified %d results (%d timestamped), %d without evidence hash, %d failed", verified, timestamped, unhashed, failed)
+	if failed != 0 {
+		return 1
+	}
+	return 0
+}
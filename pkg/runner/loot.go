@@ -0,0 +1,81 @@
+package runner
+
+import (
+	"context"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLootThreads is the number of workers of -auto-loot
+const DefaultLootThreads = 5
+
+// lootQueueSize bounds the vulnerable targets waiting to be looted, the detection workers wait when
+// the queue is full
+const lootQueueSize = 1024
+
+// lootJob is a vulnerable target waiting to be looted
+type lootJob struct {
+	target *input.Target
+	// detection is the detection record reported with the files once looted, nil when it was reported
+	// at once with -stream-loot
+	detection *output.ResultEvent
+}
+
+// lootQueue loots the targets found vulnerable by the detection with workers and a rate limit of
+// their own, so the detection of the remaining targets doesn't wait on the looting and the looting
+// goes on once the detection is done
+type lootQueue struct {
+	jobs   chan *lootJob
+	wg     sync.WaitGroup
+	looted atomic.Int64
+}
+
+// startLooting starts the -loot-threads workers of the looting queue
+func (r *Runner) startLooting(ctx context.Context) {
+	r.loot = &lootQueue{jobs: make(chan *lootJob, lootQueueSize)}
+	ctx = scanner.WithLootRateLimit(ctx)
+	for i := 0; i < r.options.LootThreads; i++ {
+		r.loot.wg.Add(1)
+		go func() {
+			defer r.loot.wg.Done()
+			for job := range r.loot.jobs {
+				r.lootTarget(ctx, job)
+			}
+		}()
+	}
+}
+
+// enqueueLoot queues a vulnerable target for the looting workers
+func (r *Runner) enqueueLoot(job *lootJob) {
+	r.loot.jobs <- job
+}
+
+// finishLooting waits for the looting of the queued targets once the detection is done
+func (r *Runner) finishLooting(detection time.Duration) {
+	if pending := len(r.loot.jobs); pending != 0 {
+		gologger.Info().Msgf("detection done in %.2f seconds, looting %d remaining vulnerable targets", detection.Seconds(), pending)
+	}
+	close(r.loot.jobs)
+	r.loot.wg.Wait()
+	gologger.Info().Msgf("looted %d vulnerable targets", r.loot.looted.Load())
+}
+
+// lootTarget reads the files of a vulnerable target, the detection record is still reported when the
+// -max-egress budget is exceeded
+func (r *Runner) lootTarget(ctx context.Context, job *lootJob) {
+	if egress.Default.Exceeded() {
+		gologger.Debug().Msgf("not looting %s: egress budget exceeded", job.target.ToString())
+		if job.detection != nil {
+			r.report(ctx, job.detection)
+		}
+		return
+	}
+	r.readTarget(ctx, job.target, job.detection)
+	r.loot.looted.Add(1)
+}
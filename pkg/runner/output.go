@@ -1,16 +1,37 @@
 package runner
 
 import (
+	"embed"
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/projectdiscovery/gologger"
 	"github.com/projectdiscovery/gologger/formatter"
 	"github.com/projectdiscovery/gologger/levels"
+	"github.com/wjlin0/CVE-2024-23897/pkg/i18n"
 	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
 	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"io/fs"
+	"sort"
 	"strings"
 )
 
+// reportLocales are the message files of the human-readable report, one <lang>.json per -report-lang
+//
+//go:embed locales/*.json
+var reportLocales embed.FS
+
+// ReportLanguages returns the languages of the human-readable report
+func ReportLanguages() []string {
+	languages, _ := i18n.Languages(reportMessages())
+	return languages
+}
+
+func reportMessages() fs.FS {
+	messages, _ := fs.Sub(reportLocales, "locales")
+	return messages
+}
+
 func SetOutput(options *types.Options) {
 	if options.Debug {
 		gologger.DefaultLogger.SetMaxLevel(levels.LevelDebug)
@@ -36,23 +57,59 @@ func (r *Runner) Output(event *output.ResultEvent) {
 	}
 	buffer := strings.Builder{}
 	buffer.WriteRune('[')
-	buffer.WriteString(color.HiRedString("CVE-2024-23897"))
+	checkID := event.CheckID
+	if checkID == "" {
+		checkID = scanner.CVE202423897
+	}
+	buffer.WriteString(color.HiRedString(checkID))
 	buffer.WriteRune(']')
 	buffer.WriteRune(' ')
 	buffer.WriteString(event.URL)
 	buffer.WriteRune('\n')
 	if event.Mode != 0 {
-		buffer.WriteString(fmt.Sprintf("Mode: %s\n", event.Mode))
+		buffer.WriteString(r.messages.Sprintf("mode", event.Mode) + "\n")
+	}
+	if event.Verdict == scanner.VerdictAuthRequired || event.Verdict == scanner.VerdictAuthConfirmed {
+		buffer.WriteString(r.messages.Sprintf("verdict", color.HiYellowString(event.Verdict)) + "\n")
+	}
+	if event.SecondPass != "" {
+		buffer.WriteString(r.messages.Sprintf("second-pass", event.SecondPass) + "\n")
 	}
 	if event.Command != "" && event.Mode != output.ModeCheck {
-		buffer.WriteString(fmt.Sprintf("Command: %s\n", event.Command))
+		buffer.WriteString(r.messages.Sprintf("command", event.Command) + "\n")
 	}
 	if event.Mode == output.ModeReadFile && event.Args != "" {
-		buffer.WriteString(fmt.Sprintf("Filename: %s\n", strings.TrimLeft(event.Args, "@")))
+		buffer.WriteString(r.messages.Sprintf("filename", strings.TrimLeft(event.Args, "@")) + "\n")
 	} else if event.Args != "" {
-		buffer.WriteString(fmt.Sprintf("Args: %s\n", event.Args))
+		buffer.WriteString(r.messages.Sprintf("args", event.Args) + "\n")
 	}
 
+	if event.Artifact == scanner.ArtifactPartial {
+		buffer.WriteString(r.messages.Sprintf("artifact-partial", color.HiRedString(event.Artifact), event.Truncation, event.Chunks) + "\n")
+	} else if event.Artifact != "" {
+		buffer.WriteString(r.messages.Sprintf("artifact", event.Artifact, event.Chunks) + "\n")
+	}
+	if event.EvidenceTime != "" {
+		buffer.WriteString(r.messages.Sprintf("evidence", event.EvidenceSHA256, event.EvidenceTime, event.EvidenceTSA) + "\n")
+	}
+	if event.InterestScore > 0 {
+		buffer.WriteString(r.messages.Sprintf("interest", color.HiMagentaString("%d", event.InterestScore), strings.Join(event.InterestReasons, ", ")) + "\n")
+	}
+	if event.Finding != "" {
+		buffer.WriteString(r.messages.Sprintf("finding", color.HiYellowString(event.Finding)) + "\n")
+		keys := make([]string, 0, len(event.Details))
+		for key := range event.Details {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := event.Details[key]
+			if key == "expired" && value == "true" {
+				value = color.HiRedString(value)
+			}
+			buffer.WriteString(fmt.Sprintf("  %s: %s\n", key, value))
+		}
+	}
 	if event.Response != "" {
 		buffer.WriteString(strings.TrimSuffix(event.Response, "\n"))
 		buffer.WriteRune('\n')
@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/preflight"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"net/http"
+)
+
+// ErrPreflight is returned by NewRunner when a pre-flight check failed without -force
+var ErrPreflight = errors.New("pre-flight checks failed")
+
+// estimated output sizes of the disk space check
+const (
+	resultBytesPerTarget = 4 << 10
+	bytesPerFileRead     = 256 << 10
+)
+
+// preflightHosts is the number of target host names resolved by the dns check
+const preflightHosts = 5
+
+// preflightConfig returns what the scan is about to use
+func (r *Runner) preflightConfig() *preflight.Config {
+	options := r.options
+	config := &preflight.Config{Threads: options.Thread, Proxy: types.ProxyURL}
+	for _, output := range []string{options.Results, options.Sarif, options.Ledger, options.WatchState, options.Compliance, options.WriteBaseline} {
+		if output != "" {
+			config.Outputs = append(config.Outputs, output)
+		}
+	}
+	if options.Workdir != "" {
+		config.OutputDirs = append(config.OutputDirs, options.Workdir)
+	}
+	reads := uint64(len(options.Args)+len(scanner.PresetVariantPaths(options.VariantPresets, scanner.OSLinux))) * uint64(len(options.Command))
+	config.ExpectedBytes = uint64(len(r.targets)) * (resultBytesPerTarget + reads*bytesPerFileRead)
+	seen := map[string]bool{}
+	for _, target := range r.targets {
+		if len(config.Hosts) == preflightHosts {
+			break
+		}
+		if !seen[target.Host] {
+			seen[target.Host] = true
+			config.Hosts = append(config.Hosts, target.Host)
+		}
+	}
+	// 未指定 -proxy 时检查环境变量中的代理
+	if config.Proxy == "" && len(r.targets) != 0 {
+		if request, err := http.NewRequest(http.MethodGet, r.targets[0].ToString(), nil); err == nil {
+			if proxy, err := http.ProxyFromEnvironment(request); err == nil && proxy != nil {
+				config.Proxy = proxy.String()
+			}
+		}
+	}
+	return config
+}
+
+// preflight checks the environment before the scan, failed checks are printed with their remediation
+// and refuse the start unless -force
+func (r *Runner) preflight(ctx context.Context, env *preflight.Env) error {
+	failed := 0
+	for _, result := range preflight.Run(ctx, env, r.preflightConfig()) {
+		switch {
+		case result.Failed():
+			failed++
+			gologger.Error().Msgf("pre-flight %s: %s", result.Name, result.Err)
+			if result.Remediation != "" {
+				gologger.Error().Msgf("  fix: %s", result.Remediation)
+			}
+		case result.Skipped != "":
+			gologger.Debug().Msgf("pre-flight %s skipped: %s", result.Name, result.Skipped)
+		default:
+			gologger.Debug().Msgf("pre-flight %s passed %s", result.Name, result.Detail)
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	if r.options.Force {
+		gologger.Info().Msgf("starting despite %d failed pre-flight checks (-force)", failed)
+		return nil
+	}
+	return fmt.Errorf("%d %w, fix them, start anyway with -force or skip them with -no-preflight", failed, ErrPreflight)
+}
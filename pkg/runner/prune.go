@@ -0,0 +1,85 @@
+package runner
+
+import (
+	"flag"
+	"fmt"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/retention"
+	"time"
+)
+
+// PruneCommand is the subcommand applying the retention policy to workdirs
+const PruneCommand = "prune"
+
+// day is the unit of the retention flags
+const day = 24 * time.Hour
+
+// retentionPolicy returns the retention policy of the limits in days
+func retentionPolicy(redactAfterDays, lootMaxDays, evidenceMaxDays int) retention.Policy {
+	return retention.Policy{
+		RedactAfter:    time.Duration(redactAfterDays) * day,
+		LootMaxAge:     time.Duration(lootMaxDays) * day,
+		EvidenceMaxAge: time.Duration(evidenceMaxDays) * day,
+	}
+}
+
+// Prune applies the retention policy to the runs of workdirs and returns the exit code
+func Prune(args []string) int {
+	flagSet := flag.NewFlagSet(PruneCommand, flag.ContinueOnError)
+	redactAfterDays := flagSet.Int("redact-after-days", 0, "redact the secrets of the leaked content of the runs older than the given number of days")
+	lootMaxDays := flagSet.Int("loot-max-days", 0, "purge the leaked content and delete the SARIF logs of the runs older than the given number of days")
+	evidenceMaxDays := flagSet.Int("evidence-max-days", 0, "remove the evidence hashes and timestamps of the runs older than the given number of days")
+	dryRun := flagSet.Bool("dry-run", false, "list the changes without applying them")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: CVE-2024-23897 %s [-redact-after-days n] [-loot-max-days n] [-evidence-max-days n] [-dry-run] workdir...\n", PruneCommand)
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return 2
+	}
+	policy := retentionPolicy(*redactAfterDays, *lootMaxDays, *evidenceMaxDays)
+	if flagSet.NArg() == 0 || !policy.Enabled() || *redactAfterDays < 0 || *lootMaxDays < 0 || *evidenceMaxDays < 0 {
+		flagSet.Usage()
+		return 2
+	}
+	code := 0
+	for _, workdir := range flagSet.Args() {
+		if err := pruneWorkdir(workdir, policy, *dryRun); err != nil {
+			gologger.Error().Msgf("could not prune %v: %s", workdir, err)
+			code = 1
+		}
+	}
+	return code
+}
+
+// pruneWorkdir applies the policy to workdir and logs every change
+func pruneWorkdir(workdir string, policy retention.Policy, dryRun bool) error {
+	result, err := retention.Prune(workdir, policy, time.Now(), dryRun)
+	if result != nil {
+		prefix := "pruned"
+		if dryRun {
+			prefix = "would prune"
+		}
+		for _, action := range result.Actions {
+			gologger.Info().Msgf("%s: %s", prefix, action)
+		}
+		for _, skipped := range result.Skipped {
+			gologger.Debug().Msgf("skipped %s", skipped)
+		}
+		if err == nil {
+			gologger.Info().Msgf("%s %v: %d changes, %d run directories without a usable manifest skipped", prefix, workdir, len(result.Actions), len(result.Skipped))
+		}
+	}
+	return err
+}
+
+// applyRetention applies the retention policy of the options to the workdir at the end of the run
+func (r *Runner) applyRetention() {
+	policy := retentionPolicy(r.options.RedactAfterDays, r.options.LootMaxDays, r.options.EvidenceMaxDays)
+	if r.runDir == "" || !policy.Enabled() {
+		return
+	}
+	if err := pruneWorkdir(r.options.Workdir, policy, r.options.DryRun); err != nil {
+		gologger.Error().Msgf("could not prune %v: %s", r.options.Workdir, err)
+	}
+}
@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/atomicfile"
+	"github.com/wjlin0/CVE-2024-23897/pkg/rollup"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RollupCommand is the subcommand merging the results of several runs into one report
+const RollupCommand = "rollup"
+
+// Rollup merges results files, run directories and workdirs into a Markdown or HTML report with the
+// trends of the vulnerable instances and returns the exit code
+func Rollup(args []string) int {
+	flagSet := flag.NewFlagSet(RollupCommand, flag.ContinueOnError)
+	out := flagSet.String("o", "", "report file written, stdout by default")
+	format := flagSet.String("format", "", "report format, markdown or html (default by the -o extension, else markdown)")
+	templateDir := flagSet.String("report-template", "", "directory of report.md and report.html templates overriding the embedded ones")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: CVE-2024-23897 %s [-o report.html] [-format markdown|html] [-report-template dir] results.jsonl|run-dir|workdir|glob...\n", RollupCommand)
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return 2
+	}
+	if flagSet.NArg() == 0 {
+		flagSet.Usage()
+		return 2
+	}
+	if *format == "" {
+		*format = "markdown"
+		if ext := strings.ToLower(filepath.Ext(*out)); ext == ".html" || ext == ".htm" {
+			*format = "html"
+		}
+	}
+	templates, err := rollup.LoadTemplates(*templateDir)
+	if err != nil {
+		gologger.Error().Msgf("could not load the report templates: %s", err)
+		return 2
+	}
+	render := templates.Markdown
+	switch *format {
+	case "markdown", "md":
+	case "html":
+		render = templates.HTML
+	default:
+		gologger.Error().Msgf("unknown report format %v, use markdown or html", *format)
+		return 2
+	}
+
+	files, err := rollup.Expand(flagSet.Args())
+	if err != nil {
+		gologger.Error().Msgf("%s", err)
+		return 2
+	}
+	var runs []*rollup.Run
+	for _, file := range files {
+		run, err := rollup.ReadRun(file)
+		if err != nil {
+			gologger.Error().Msgf("could not read results %v: %s", file, err)
+			return 2
+		}
+		gologger.Debug().Msgf("%s: %d results of %s", file, len(run.Results), run.Time.Format("2006-01-02 15:04:05"))
+		runs = append(runs, run)
+	}
+	merged := rollup.Merge(runs)
+
+	buffer := &bytes.Buffer{}
+	if err := render(buffer, rollup.NewReportData(merged)); err != nil {
+		gologger.Error().Msgf("could not render the report: %s", err)
+		return 2
+	}
+	if *out == "" {
+		_, _ = os.Stdout.Write(buffer.Bytes())
+	} else if err := atomicfile.WriteFile(*out, buffer.Bytes(), 0644); err != nil {
+		gologger.Error().Msgf("could not write %v: %s", *out, err)
+		return 2
+	}
+	counts := merged.Counts()
+	gologger.Info().Msgf("merged %d runs: %d newly vulnerable, %d persistent, %d inconclusive, %d fixed instances",
+		len(runs), counts[rollup.StatusNew], counts[rollup.StatusPersistent], counts[rollup.StatusInconclusive], counts[rollup.StatusFixed])
+	return 0
+}
@@ -2,63 +2,277 @@ package runner
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/projectdiscovery/gologger"
+	errorutil "github.com/projectdiscovery/utils/errors"
 	proxyutils "github.com/projectdiscovery/utils/proxy"
 	readerutil "github.com/projectdiscovery/utils/reader"
 	stringsutil "github.com/projectdiscovery/utils/strings"
 	"github.com/remeh/sizedwaitgroup"
+	"github.com/wjlin0/CVE-2024-23897/pkg/adaptive"
+	"github.com/wjlin0/CVE-2024-23897/pkg/baseline"
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+	"github.com/wjlin0/CVE-2024-23897/pkg/i18n"
 	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/ledger"
 	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/preflight"
+	"github.com/wjlin0/CVE-2024-23897/pkg/sarif"
 	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scope"
+	"github.com/wjlin0/CVE-2024-23897/pkg/sortedlines"
 	"github.com/wjlin0/CVE-2024-23897/pkg/types"
 	updateutils "github.com/wjlin0/CVE-2024-23897/pkg/update"
+	"github.com/wjlin0/CVE-2024-23897/pkg/webhook"
+	"net/http"
 	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// verdictVulnerable counts the findings of anonymously vulnerable targets, which have no verdict
+const verdictVulnerable = "vulnerable"
+
 type Runner struct {
 	scanner *scanner.Scanner
-	options *types.Options
-	targets []*input.Target
-	wg      sizedwaitgroup.SizedWaitGroup
-	success int
+	checks  []scanner.Check
+	ledger  *ledger.Ledger
+	webhook *webhook.Sender
+	sarif   *sarif.Writer
+	results *os.File
+	// sorted buffers the results file lines until Close with -sorted
+	sorted *sortedlines.Writer
+	// verdicts caches the negative verdicts of backends, nil when every alias is tested
+	verdicts *scanner.VerdictCache
+	// concurrency adapts the running workers to the error rate, nil uses a fixed number of threads
+	concurrency *adaptive.Controller
+	options     *types.Options
+	targets     []*input.Target
+	wg          sizedwaitgroup.SizedWaitGroup
+	success     int
+	// secondPass and converted count the inconclusive targets of the previous run per class
+	// and those with a conclusive result in this run
+	secondPass map[string]int
+	converted  map[string]int
+	// findings counts the findings of the detection per verdict
+	findings map[string]int
+	// excluded are the targets left out by the exclusion and scope lists
+	excluded []string
+	// messages are the strings of the human-readable report in the -report-lang language
+	messages *i18n.Catalog
+	// expected are the -expect-target targets with the reason they are not conclusively evaluated yet
+	expected map[string]string
+	// baseline is the -baseline file, observations the verdicts of the targets with -baseline or -write-baseline
+	baseline     *baseline.Baseline
+	observations baseline.Observations
+	// watchState records the targets scanned by the watch sessions
+	watchState *os.File
+	// untimestamped counts the findings whose evidence the TSA failed to timestamp
+	untimestamped atomic.Int64
+	// skipped counts the targets skipped once the -max-egress budget was exceeded
+	skipped atomic.Int64
+	// runDir is the run directory of -workdir
+	runDir string
+	// credentialsNotice tells once that targets embed credentials
+	credentialsNotice sync.Once
+	// loot is the queue of the vulnerable targets looted with -auto-loot
+	loot *lootQueue
 	sync.Mutex
 }
 
 func NewRunner(options *types.Options) (*Runner, error) {
 
-	r := &Runner{options: options}
+	r := &Runner{options: options, findings: make(map[string]int)}
+	messages, err := i18n.Load(reportMessages(), options.ReportLang)
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("invalid -report-lang")
+	}
+	r.messages = messages
+	egress.Default.SetBudget(int64(options.MaxEgress))
 	r.parseTargets()
+	if options.InputPreviousInconclusive != "" {
+		if err := r.loadPreviousInconclusive(options.InputPreviousInconclusive); err != nil {
+			return nil, err
+		}
+	}
 
 	scan, err := scanner.NewScanner(options)
 	if err != nil {
 		return nil, err
 	}
+	checks, err := scan.Checks(options.Checks)
+	if err != nil {
+		return nil, err
+	}
+	r.excludeTargets(scan.Scope())
+	r.expectTargets()
+	if err := r.loadBaseline(); err != nil {
+		return nil, err
+	}
 	r.wg = sizedwaitgroup.New(r.options.Thread)
 	r.scanner = scan
+	r.checks = checks
+	if options.AutoThreads {
+		r.concurrency = adaptive.New(adaptive.Options{Min: options.AutoThreadsMin, Max: options.Thread})
+		scan.OnResponse(func(resp *http.Response, err error) {
+			r.concurrency.Observe(adaptive.IsFailure(resp, err))
+		})
+	}
+	if !options.NoIntraRunCache {
+		r.verdicts = scanner.NewVerdictCache()
+	}
+	if !options.NoPreflight && !options.SelfTest {
+		if err := r.preflight(context.Background(), preflight.DefaultEnv()); err != nil {
+			return nil, err
+		}
+	}
+	if options.Workdir != "" {
+		if r.runDir, err = setupWorkdir(options, time.Now()); err != nil {
+			return nil, err
+		}
+		gologger.Info().Msgf("Writing run artifacts to %s", r.runDir)
+	}
+	if options.Results != "" {
+		if r.results, err = os.Create(options.Results); err != nil {
+			return nil, errorutil.NewWithErr(err).Msgf("could not create results file %v", options.Results)
+		}
+		if options.Sorted {
+			r.sorted = sortedlines.NewWriter(r.results, sortedlines.DefaultMemoryLimit)
+		}
+	}
+	if options.Sarif != "" {
+		r.sarif = sarif.NewWriter(options.Sarif, version, !options.NoRedact)
+	}
+	if options.Webhook != "" {
+		r.webhook = webhook.NewSender(options.Webhook, &http.Client{Timeout: 10 * time.Second, Transport: egress.Default.Transport(egress.Webhook, nil)})
+	}
+	if options.Ledger != "" {
+		if r.ledger, err = ledger.Open(options.Ledger); err != nil {
+			return nil, errorutil.NewWithErr(err).Msgf("could not open ledger %v", options.Ledger)
+		}
+		if options.LedgerPruneDays > 0 && !options.DryRun {
+			pruned, err := r.ledger.Prune(time.Now().AddDate(0, 0, -options.LedgerPruneDays))
+			if err != nil {
+				return nil, errorutil.NewWithErr(err).Msgf("could not prune ledger %v", options.Ledger)
+			}
+			gologger.Debug().Msgf("pruned %d ledger entries not seen in %d days", pruned, options.LedgerPruneDays)
+		}
+	}
 	return r, nil
 }
 
+// Close releases the resources held by the runner
+func (r *Runner) Close() {
+	if r.sorted != nil {
+		if err := r.sorted.Close(); err != nil {
+			gologger.Error().Msgf("could not write sorted results: %s", err)
+		}
+	}
+	if r.results != nil {
+		_ = r.results.Close()
+	}
+	if r.sarif != nil {
+		if err := r.sarif.Close(); err != nil {
+			gologger.Error().Msgf("%s", err)
+		}
+	}
+	if r.ledger != nil {
+		_ = r.ledger.Close()
+	}
+	if r.watchState != nil {
+		_ = r.watchState.Close()
+	}
+	// 输出关闭后再执行, 保留策略改写的文件已写完
+	r.applyRetention()
+}
+
+// isNewFinding records the finding in the ledger and reports whether it should be reported
+func (r *Runner) isNewFinding(result *output.ResultEvent) bool {
+	if r.ledger == nil {
+		return true
+	}
+	changed, err := r.ledger.Record(result, time.Now())
+	if err != nil {
+		gologger.Warning().Msgf("could not record finding %s in ledger: %s", ledger.Key(result), err)
+		return true
+	}
+	if !changed && !r.options.AlertAlways {
+		gologger.Debug().Msgf("skipping already reported finding %s", ledger.Key(result))
+		return false
+	}
+	return true
+}
+
+// report adds the finding to the results file and SARIF log, which hold every finding of the run even if already in the ledger
+func (r *Runner) report(ctx context.Context, result *output.ResultEvent) {
+	r.captureEvidence(ctx, result)
+	r.writeResult(result)
+	if r.sarif != nil {
+		r.sarif.Add(result)
+	}
+}
+
+// writeResult adds the result to the results file
+func (r *Runner) writeResult(result *output.ResultEvent) {
+	if r.results == nil {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err == nil {
+		r.Lock()
+		if r.sorted != nil {
+			err = r.sorted.Add(result.SortKey(), data)
+		} else {
+			_, err = r.results.Write(append(data, '\n'))
+		}
+		r.Unlock()
+	}
+	if err != nil {
+		gologger.Warning().Msgf("could not write result of %s: %s", result.URL, err)
+	}
+}
+
+// notify sends the finding to the webhook, as a version 1 payload with -flat-results
+func (r *Runner) notify(ctx context.Context, result *output.ResultEvent) {
+	if r.webhook == nil {
+		return
+	}
+	newPayload := webhook.NewPayload
+	if r.options.FlatResults {
+		newPayload = webhook.NewFlatPayload
+	}
+	if err := r.webhook.Send(ctx, newPayload(repoName, result, time.Now())); err != nil {
+		gologger.Warning().Msgf("%s", err)
+	}
+}
+
+// adjustTarget returns the url of an input target, empty for blank lines
+func adjustTarget(target string) string {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return ""
+	}
+	target = strings.TrimSuffix(target, "/")
+	if !stringsutil.HasPrefixAny(target, "http://", "https://") {
+		target = "http://" + target
+	}
+	return target
+}
+
 func (r *Runner) parseTargets() {
 	targets := make(map[string]struct{})
 	options := r.options
 	var target string
-	var adjustTarget = func(target string) string {
-		target = strings.TrimSpace(target)
-		if target == "" {
-			return ""
-		}
-		target = strings.TrimSuffix(target, "/")
-		if !stringsutil.HasPrefixAny(target, "http://", "https://") {
-			target = "http://" + target
-		}
-		return target
-	}
 	for _, target = range options.URL {
 		if target = adjustTarget(target); target == "" {
 			continue
@@ -83,102 +297,569 @@ func (r *Runner) parseTargets() {
 		}
 	}
 	for target = range targets {
-		r.targets = append(r.targets, input.NewTarget(target))
+		r.targets = append(r.targets, r.newTarget(target))
+	}
+}
+
+// newTarget returns the target of an input line, telling once that the input embeds credentials
+func (r *Runner) newTarget(line string) *input.Target {
+	target := input.NewTarget(line)
+	if target.Credentials != "" {
+		r.credentialsNotice.Do(func() {
+			gologger.Info().Msgf("credentials embedded in target URLs were stripped, they are only sent as basic auth to their own target and redacted from the output")
+		})
+	}
+	return target
+}
+
+// excludeTargets leaves out the targets not allowed by policy, they are never contacted
+func (r *Runner) excludeTargets(policy *scope.Policy) {
+	if !policy.Enabled() {
+		return
+	}
+	targets := r.targets[:0]
+	for _, target := range r.targets {
+		if err := policy.Allowed(target.OriginURL); err != nil {
+			gologger.Debug().Msgf("skipping %s: %s", target.OriginURL, err)
+			r.excluded = append(r.excluded, target.OriginURL)
+			continue
+		}
+		targets = append(targets, target)
 	}
+	r.targets = targets
+	sort.Strings(r.excluded)
+}
+
+// loadPreviousInconclusive adds the inconclusive targets of a previous results file with their class
+func (r *Runner) loadPreviousInconclusive(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not open previous results %v", path)
+	}
+	defer file.Close()
+	classes, err := scanner.ReadInconclusive(file)
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not read previous results %v", path)
+	}
+	r.secondPass, r.converted = make(map[string]int), make(map[string]int)
+	for _, target := range r.targets {
+		if class, ok := classes[target.ToString()]; ok {
+			target.PreviousClass = class
+			delete(classes, target.ToString())
+		}
+	}
+	for url, class := range classes {
+		target := input.NewTarget(url)
+		target.PreviousClass = class
+		r.targets = append(r.targets, target)
+	}
+	for _, target := range r.targets {
+		if target.PreviousClass != "" {
+			r.secondPass[target.PreviousClass]++
+		}
+	}
+	return nil
+}
+
+// convert counts a second pass target which got a conclusive result
+func (r *Runner) convert(target *input.Target) {
+	if target.PreviousClass == "" {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.converted[target.PreviousClass]++
+}
+
+// countVerdict counts a finding of the detection by its verdict
+func (r *Runner) countVerdict(result *output.ResultEvent) {
+	verdict := result.Verdict
+	if verdict == "" {
+		verdict = verdictVulnerable
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.findings[verdict]++
+}
+
+// findingsSummary returns the number of findings per verdict
+func (r *Runner) findingsSummary() string {
+	counts := make([]string, 0, 3)
+	for _, verdict := range []string{verdictVulnerable, scanner.VerdictAuthConfirmed, scanner.VerdictAuthRequired} {
+		counts = append(counts, fmt.Sprintf("%s %d", verdict, r.findings[verdict]))
+	}
+	return strings.Join(counts, ", ")
+}
+
+// conversionSummary returns the rate of second pass targets which got a conclusive result, overall and per class
+func (r *Runner) conversionSummary() string {
+	classes := make([]string, 0, len(r.secondPass))
+	total, converted := 0, 0
+	for class, count := range r.secondPass {
+		classes = append(classes, class)
+		total += count
+		converted += r.converted[class]
+	}
+	sort.Strings(classes)
+	rate := func(converted, total int) string {
+		return fmt.Sprintf("%d/%d (%.0f%%)", converted, total, float64(converted)*100/float64(total))
+	}
+	perClass := make([]string, 0, len(classes))
+	for _, class := range classes {
+		perClass = append(perClass, fmt.Sprintf("%s %s", class, rate(r.converted[class], r.secondPass[class])))
+	}
+	return fmt.Sprintf("%s, %s", rate(converted, total), strings.Join(perClass, ", "))
 }
 
 func (r *Runner) RunEnumeration() error {
+	if r.options.SelfTest {
+		return r.RunSelfTest()
+	}
+	if r.options.DryRun {
+		return r.RunDryRun()
+	}
 	start := time.Now()
 	r.displayExecutionInfo()
 
+	ctx := context.Background()
+	if r.options.AutoLoot {
+		r.startLooting(ctx)
+	}
+	var watchErr error
 	switch {
 	case r.options.IsListAvailableCommands():
 		for _, target := range r.targets {
-			r.wg.Add()
-			go func(target *input.Target) {
-				defer r.wg.Done()
-				commands, result := r.scanner.ListAvailableCommands(target)
-				if result == nil || len(commands) == 0 {
-					return
-				}
-				r.AddSuccess()
-				result.Response = fmt.Sprintf("%s\n", strings.Join(commands, ","))
-				r.Output(result)
-			}(target)
+			target := target
+			r.spawn(target, func() {
+				r.exploit(ctx, target, &scanner.ExploitOptions{Mode: output.ModeListAvailableCommands})
+			})
 		}
 	case r.options.IsReadMode():
 		for _, target := range r.targets {
-			r.wg.Add()
-			go func(target *input.Target) {
-				defer r.wg.Done()
-				for _, filename := range r.options.Args {
-					for _, command := range r.options.Command {
-						result := r.scanner.ReadFile(target, command, filename)
-						if result == nil || result.Response == "" {
-							continue
-						}
-						result.Response = color.HiYellowString(result.Response)
-
-						r.AddSuccess()
-
-						r.Output(result)
-					}
-				}
-			}(target)
+			target := target
+			r.spawn(target, func() {
+				r.readTarget(ctx, target, nil)
+			})
 		}
 	case r.options.Exec:
 		for _, target := range r.targets {
-			r.wg.Add()
-			go func(target *input.Target) {
-				defer r.wg.Done()
+			target := target
+			r.spawn(target, func() {
 				for _, command := range r.options.Command {
-					result := r.scanner.Exec(target, command, strings.Join(r.options.Args, " "))
-					if result == nil || result.Response == "" {
-						continue
-					}
-					r.AddSuccess()
-
-					r.Output(result)
-
+					r.exploit(ctx, target, &scanner.ExploitOptions{Mode: output.ModeExec, Command: command, Args: strings.Join(r.options.Args, " ")})
 				}
-			}(target)
+			})
 		}
+	case r.options.Watch != "":
+		watchErr = r.watch(ctx)
 	default:
 		for _, target := range r.targets {
-			r.wg.Add()
-			go func(target *input.Target) {
-				defer r.wg.Done()
-				vul, full, result := r.scanner.Check(target)
-				if !vul {
-					return
-				}
-				r.AddSuccess()
-				r.loadExecByUser(target, full, result)
-				r.Output(result)
-
-			}(target)
-
+			target := target
+			r.spawn(target, func() {
+				r.detect(ctx, target)
+			})
 		}
 	}
 
 	r.wg.Wait()
+	if r.loot != nil {
+		r.finishLooting(time.Since(start))
+	}
 	elapsed := time.Since(start)
 
 	elapsedSec := float64(elapsed) / float64(time.Second)
 	gologger.Info().Msgf("took %.2f seconds with %d successful targets", elapsedSec, r.success)
-	return nil
+	if len(r.findings) != 0 {
+		gologger.Info().Msgf("findings by verdict: %s", r.findingsSummary())
+	}
+	if r.concurrency != nil {
+		gologger.Info().Msgf("concurrency trajectory: %s", r.concurrency.TrajectoryString())
+	}
+	if len(r.secondPass) != 0 {
+		gologger.Info().Msgf("second pass converted inconclusive targets to conclusive: %s", r.conversionSummary())
+	}
+	if len(r.excluded) != 0 {
+		gologger.Info().Msgf("excluded %d targets by -exclude and -scope", len(r.excluded))
+		if r.options.ShowExcluded {
+			for _, target := range r.excluded {
+				gologger.Info().Msgf("excluded: %s", target)
+			}
+		}
+	}
+	if untimestamped := r.untimestamped.Load(); untimestamped != 0 {
+		gologger.Info().Msgf("%d findings could not be timestamped by %s and only carry their evidence hash", untimestamped, r.options.TimestampEvidence)
+	}
+	if refused := r.scanner.Scope().Refused(); refused != 0 {
+		gologger.Info().Msgf("refused %d connections to excluded or out of scope addresses", refused)
+	}
+	if received := r.scanner.BytesReceived(); len(r.targets) > 0 {
+		gologger.Info().Msgf("received %d bytes from targets (%d bytes per target)", received, received/int64(len(r.targets)))
+	}
+	if total := egress.Default.Total(); total != 0 {
+		gologger.Info().Msgf("egress %d bytes: %s", total, egress.Default)
+	}
+	if skipped := r.skipped.Load(); egress.Default.Exceeded() {
+		gologger.Info().Msgf("egress budget of %d bytes exceeded, skipped %d targets", egress.Default.Budget(), skipped)
+	}
+	if r.runDir != "" {
+		if err := writeEgress(r.runDir, r.skipped.Load()); err != nil {
+			gologger.Warning().Msgf("%s", err)
+		}
+	}
+	if watchErr != nil {
+		return watchErr
+	}
+	return errors.Join(r.checkBaseline(), r.checkExpected())
+}
+
+// spawn runs fn for target in a worker, limited by the thread count and the adaptive concurrency.
+// The target is skipped once the -max-egress budget is exceeded
+func (r *Runner) spawn(target *input.Target, fn func()) {
+	r.wg.Add()
+	go func() {
+		defer r.wg.Done()
+		if r.concurrency != nil {
+			r.concurrency.Acquire()
+			defer r.concurrency.Release()
+		}
+		if egress.Default.Exceeded() {
+			if r.skipped.Add(1) == 1 {
+				gologger.Warning().Msgf("egress budget of %d bytes exceeded, skipping the remaining targets", egress.Default.Budget())
+			}
+			r.evaluated(target, "skipped: egress budget exceeded")
+			r.observe(target, baseline.Skipped)
+			return
+		}
+		fn()
+	}()
 }
 
+// detect runs every selected check on the target, skipping backends already found patched or not jenkins
+func (r *Runner) detect(ctx context.Context, target *input.Target) {
+	var backend *scanner.Backend
+	var probeErr error
+	probed := false
+	if r.verdicts != nil {
+		// 同一后端的多个别名只检测一次, 只按实例标识识别别名, 共用地址的不同实例各自检测
+		backend, probeErr = r.scanner.Backend(ctx, target)
+		probed = true
+		if probeErr != nil {
+			gologger.Debug().Msgf("could not identify backend of %s: %s", target.ToString(), probeErr)
+		} else if cached, ok := r.verdicts.Get(backend.Keys()...); ok {
+			r.skipCached(target, cached)
+			return
+		}
+	}
+	found := false
+	var checkErr error
+	var loot *lootJob
+	for _, check := range r.checks {
+		result, err := check.Detect(ctx, target)
+		if err != nil {
+			gologger.Debug().Msgf("%s check of %s failed: %s", check.ID(), target.ToString(), err)
+			checkErr = err
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		found = true
+		r.countVerdict(result)
+		r.observe(target, findingVerdict(result))
+		deferred := false
+		if r.loot != nil && loot == nil && result.Verdict != scanner.VerdictAuthRequired {
+			loot = &lootJob{target: target}
+			if !r.options.StreamLoot {
+				// 读取完成后与文件合并为一条记录
+				detection := *result
+				loot.detection, deferred = &detection, true
+			}
+		}
+		if !deferred {
+			r.report(ctx, result)
+		}
+		if !r.isNewFinding(result) {
+			continue
+		}
+		r.notify(ctx, result)
+		if result.Verdict == scanner.VerdictAuthRequired {
+			result.Response = color.HiYellowString("Anonymous users lack the Overall/Read permission, the target may be vulnerable to authenticated users.\n") + "please use -auth user:api-token to confirm. \n"
+			r.Output(result)
+			continue
+		}
+		r.AddSuccess()
+		if check.ID() == scanner.CVE202423897 {
+			r.loadExecByUser(target, result.FullRead, result)
+		}
+		r.Output(result)
+	}
+	if loot != nil {
+		r.enqueueLoot(loot)
+	}
+	if found {
+		r.evaluated(target, "")
+		r.convert(target)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if !probed {
+		backend, probeErr = r.scanner.Backend(ctx, target)
+	}
+	class := scanner.ClassifyInconclusive(backend, probeErr, checkErr)
+	r.evaluated(target, ambiguousReason(backend, probeErr, checkErr, class))
+	r.observe(target, negativeVerdict(backend, probeErr, checkErr, class))
+	if class != "" {
+		result := output.NewResultEvent(target)
+		result.Mode = output.ModeCheck
+		result.Verdict = scanner.VerdictInconclusive
+		result.Inconclusive = class
+		gologger.Debug().Msgf("%s is inconclusive: %s", result.URL, class)
+		r.writeResult(result)
+		return
+	}
+	r.convert(target)
+	if backend == nil || r.verdicts == nil {
+		return
+	}
+	verdict := scanner.VerdictNotJenkins
+	if backend.Jenkins {
+		verdict = scanner.VerdictPatched
+	}
+	r.verdicts.Put(&scanner.CachedVerdict{Verdict: verdict, Evidence: target.ToString()}, backend.Keys()...)
+}
+
+// skipCached records a target skipped because its backend already has a negative verdict
+func (r *Runner) skipCached(target *input.Target, cached *scanner.CachedVerdict) {
+	result := output.NewResultEvent(target)
+	result.Mode = output.ModeCheck
+	result.Verdict = cached.Verdict
+	result.CachedFrom = cached.Evidence
+	r.observe(target, cached.Verdict)
+	if cached.Verdict == scanner.VerdictNotJenkins {
+		r.evaluated(target, fmt.Sprintf("%s (verdict cached from %s)", cached.Verdict, cached.Evidence))
+	} else {
+		r.evaluated(target, "")
+	}
+	r.convert(target)
+	gologger.Debug().Msgf("skipping %s: %s (verdict cached from %s)", result.URL, result.Verdict, result.CachedFrom)
+}
+
+// exploit runs the exploitation with every selected check supporting it and outputs the results
+func (r *Runner) exploit(ctx context.Context, target *input.Target, opts *scanner.ExploitOptions) {
+	for _, result := range r.exploitResults(ctx, target, opts) {
+		r.AddSuccess()
+		r.Output(result)
+	}
+}
+
+// reportFile reports a read file on its own with -flat-results, else only to the SARIF log since the
+// results file gets one record of the target with every read file
+func (r *Runner) reportFile(ctx context.Context, result *output.ResultEvent) {
+	if r.options.FlatResults {
+		result.SchemaVersion = output.FlatSchemaVersion
+		r.report(ctx, result)
+		return
+	}
+	if r.sarif != nil {
+		r.sarif.Add(result)
+	}
+}
+
+// readTarget reads the files of the target, reports them and outputs the files read. The files are
+// added to detection when set, else reported as a record of their own. The webhook gets the record
+// once when any of its files is new, or every new file with -flat-results
+func (r *Runner) readTarget(ctx context.Context, target *input.Target, detection *output.ResultEvent) {
+	results := r.readFiles(ctx, target, r.options.Args)
+	if len(r.options.VariantPresets) != 0 {
+		results = append(results, r.readPresetVariants(ctx, target)...)
+	}
+	// 按照 interest score 排序, 可能包含密钥的文件优先输出和记录
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].InterestScore > results[j].InterestScore
+	})
+	var record *output.ResultEvent
+	if detection != nil {
+		record = r.reportWithFiles(ctx, detection, results)
+	} else {
+		record = r.reportFiles(ctx, target, results)
+	}
+	changed := false
+	for _, result := range results {
+		if result.Error != "" || !r.isNewFinding(result) {
+			continue
+		}
+		if r.options.FlatResults {
+			r.notify(ctx, result)
+		}
+		changed = true
+		result.Response = color.HiYellowString(result.Response)
+		r.AddSuccess()
+		r.Output(result)
+	}
+	if changed && !r.options.FlatResults {
+		r.notify(ctx, record)
+	}
+}
+
+// reportFiles writes the files read from the target as the Files of one record of the results file
+// and returns the record, nil with -flat-results
+func (r *Runner) reportFiles(ctx context.Context, target *input.Target, results []*output.ResultEvent) *output.ResultEvent {
+	if r.options.FlatResults || len(results) == 0 {
+		return nil
+	}
+	record := output.NewResultEvent(target)
+	record.Mode = output.ModeReadFile
+	addFiles(record, results)
+	r.captureEvidence(ctx, record)
+	r.writeResult(record)
+	return record
+}
+
+// reportWithFiles reports the detection record with the files read from its target and returns it
+func (r *Runner) reportWithFiles(ctx context.Context, detection *output.ResultEvent, results []*output.ResultEvent) *output.ResultEvent {
+	if !r.options.FlatResults {
+		addFiles(detection, results)
+	}
+	r.report(ctx, detection)
+	return detection
+}
+
+// addFiles adds the files of read file results to the record, which gets the interest of the most
+// interesting file
+func addFiles(record *output.ResultEvent, results []*output.ResultEvent) {
+	for _, result := range results {
+		if record.CheckID == "" {
+			record.CheckID = result.CheckID
+		}
+		if result.Verdict == scanner.VerdictAuthConfirmed {
+			record.Verdict = result.Verdict
+		}
+		if result.OS != "" {
+			record.OS = result.OS
+		}
+		record.FullRead = record.FullRead || result.FullRead
+		if result.InterestScore > record.InterestScore {
+			record.InterestScore, record.InterestReasons = result.InterestScore, result.InterestReasons
+		}
+		record.Files = append(record.Files, fileRecord(result))
+	}
+}
+
+// fileRecord returns the file record of a read file result
+func fileRecord(result *output.ResultEvent) *output.FileRecord {
+	file := &output.FileRecord{Path: result.Args, RequestedVia: result.Command, Error: result.Error,
+		InterestScore: result.InterestScore, InterestReasons: result.InterestReasons}
+	switch {
+	case file.Error != "":
+	case scanner.IsMissingFile(result.Response):
+		file.Error = "no such file"
+	default:
+		sum := sha256.Sum256([]byte(result.Response))
+		file.Content, file.Size, file.SHA256 = result.Response, len(result.Response), hex.EncodeToString(sum[:])
+		file.Complete = scanner.IsFullReadCommand(result.Command) && result.Artifact != scanner.ArtifactPartial
+	}
+	return file
+}
+
+// unread reports whether the file of a read file result could not be read
+func unread(result *output.ResultEvent) bool {
+	return result.Error != "" || scanner.IsMissingFile(result.Response)
+}
+
+// readFiles reads the files with every command, the results include the files which could not be read
+func (r *Runner) readFiles(ctx context.Context, target *input.Target, files []string) []*output.ResultEvent {
+	var results []*output.ResultEvent
+	for _, filename := range files {
+		for _, command := range r.options.Command {
+			for _, result := range r.exploitResults(ctx, target, &scanner.ExploitOptions{Mode: output.ModeReadFile, Command: command, Args: filename}) {
+				if result.Error == "" {
+					r.reportFile(ctx, result)
+				}
+				results = append(results, result)
+			}
+		}
+	}
+	return results
+}
+
+// readPresetVariants reads the files of the os variant of the presets matching the inferred os of
+// the target, linux when unknown. When none can be read the other variant is tried once
+func (r *Runner) readPresetVariants(ctx context.Context, target *input.Target) []*output.ResultEvent {
+	variant := r.scanner.InferOS(ctx, target)
+	if variant == "" {
+		variant = scanner.OSLinux
+	}
+	results := r.readFiles(ctx, target, scanner.PresetVariantPaths(r.options.VariantPresets, variant))
+	for _, result := range results {
+		if !unread(result) {
+			return results
+		}
+	}
+	if ctx.Err() != nil {
+		return results
+	}
+	other := scanner.OtherOS(variant)
+	gologger.Debug().Msgf("no %s preset file could be read on %s, trying the %s variant", variant, target.ToString(), other)
+	fallback := r.readFiles(ctx, target, scanner.PresetVariantPaths(r.options.VariantPresets, other))
+	for _, result := range fallback {
+		if !unread(result) {
+			// 推断错误, 以能读取的变体为准
+			r.scanner.SetOS(target, other)
+			for _, result := range fallback {
+				result.OS = other
+			}
+			break
+		}
+	}
+	return append(results, fallback...)
+}
+
+// exploitResults runs the exploitation with every selected check supporting it
+func (r *Runner) exploitResults(ctx context.Context, target *input.Target, opts *scanner.ExploitOptions) []*output.ResultEvent {
+	var results []*output.ResultEvent
+	for _, check := range r.checks {
+		result, err := check.Exploit(ctx, target, opts)
+		if err == scanner.ErrExploitNotSupported {
+			continue
+		}
+		if err != nil {
+			gologger.Debug().Msgf("%s exploit of %s failed: %s", check.ID(), target.ToString(), err)
+		}
+		if err == nil && result == nil {
+			err = errEmptyResponse
+		}
+		if err != nil {
+			if opts.Mode == output.ModeReadFile {
+				// 读取失败的文件也记录在结果中
+				failed := output.NewResultEvent(target)
+				failed.CheckID, failed.Mode, failed.Command, failed.Args, failed.Error = check.ID(), opts.Mode, opts.Command, opts.Args, err.Error()
+				results = append(results, failed)
+			}
+			continue
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// errEmptyResponse is the error of the files whose exploitation got an empty response
+var errEmptyResponse = errors.New("empty response")
+
 func (r *Runner) displayExecutionInfo() {
 	opts := r.options
 	if !opts.DisableUpdateCheck {
-		latestVersion, err := updateutils.GetToolVersionCallback(repoName, repoName)()
-		if err != nil {
+		// 缓存有效时不请求 github
+		description, err := updateutils.GetCachedVersionDescription(repoName, repoName, version)
+		if errors.Is(err, updateutils.ErrUpdateCheckDisabled) {
+			gologger.Info().Msgf("Current %s version v%v ", repoName, version)
+		} else if err != nil {
 			if opts.Debug {
 				gologger.Error().Msgf("%s version check failed: %v", repoName, err.Error())
 			}
 		} else {
-			gologger.Info().Msgf("Current %s version v%v %v", repoName, version, updateutils.GetVersionDescription(version, latestVersion))
+			gologger.Info().Msgf("Current %s version v%v %v", repoName, version, description)
 		}
 	} else {
 		gologger.Info().Msgf("Current %s version v%v ", repoName, version)
@@ -200,12 +881,20 @@ func (r *Runner) displayExecutionInfo() {
 	if r.options.IsReadMode() {
 		gologger.Info().Msgf("Running %s", output.ModeReadFile)
 	}
+	if r.options.AutoLoot {
+		gologger.Info().Msgf("Looting the vulnerable targets with %d threads", r.options.LootThreads)
+	}
 	if r.options.IsExecMode() {
 		gologger.Info().Msgf("Running %s", output.ModeExec)
 	}
 	if r.options.IsListAvailableCommands() {
 		gologger.Info().Msgf("Running %s", output.ModeListAvailableCommands)
 	}
+	ids := make([]string, 0, len(r.checks))
+	for _, check := range r.checks {
+		ids = append(ids, check.ID())
+	}
+	gologger.Info().Msgf("Running checks: %s", strings.Join(ids, ","))
 	// 展示 targets数量
 	gologger.Info().Msgf("Loaded %d targets from input", len(r.targets))
 
@@ -238,5 +927,8 @@ func (r *Runner) loadExecByUser(target *input.Target, full bool, result *output.
 			buffer.WriteString(color.HiYellowString(fmt.Sprintf(" -header '%s'", h)))
 		}
 	}
+	if result.Verdict == scanner.VerdictAuthConfirmed {
+		buffer.WriteString(color.HiYellowString(" -auth '<USER>:<API_TOKEN>'"))
+	}
 	result.Response = buffer.String()
 }
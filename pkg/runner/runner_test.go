@@ -0,0 +1,264 @@
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/baseline"
+	"github.com/wjlin0/CVE-2024-23897/pkg/fakejenkins"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"github.com/wjlin0/CVE-2024-23897/pkg/webhook"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestRunner returns a runner of options without targets, recording the verdicts of the targets
+func newTestRunner(t *testing.T, options *types.Options) *Runner {
+	t.Helper()
+	options.NoPreflight = true
+	if options.Timeout == 0 {
+		options.Timeout = 5
+	}
+	if options.Thread == 0 {
+		options.Thread = 1
+	}
+	if len(options.Checks) == 0 {
+		options.Checks = []string{scanner.CVE202423897}
+	}
+	r, err := NewRunner(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	r.observations = baseline.Observations{}
+	return r
+}
+
+// vhosts serves the fake Jenkins of each host name on one address, like an ingress, and counts the cli
+// requests per host name
+func vhosts(t *testing.T, servers map[string]*fakejenkins.Server) (*httptest.Server, map[string]*atomic.Int64) {
+	t.Helper()
+	cli := make(map[string]*atomic.Int64)
+	for host := range servers {
+		cli[host] = &atomic.Int64{}
+	}
+	ingress := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := strings.Cut(r.Host, ":")
+		server, ok := servers[host]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Path == "/cli" {
+			cli[host].Add(1)
+		}
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ingress.Close)
+	for _, server := range servers {
+		t.Cleanup(server.Close)
+	}
+	return ingress, cli
+}
+
+func TestDetectAliasesSharingAddress(t *testing.T) {
+	patched := fakejenkins.DefaultOptions()
+	patched.Patched = true
+	patched.InstanceIdentity = "patched-identity"
+	vulnerable := fakejenkins.DefaultOptions()
+	vulnerable.InstanceIdentity = "vulnerable-identity"
+	ingress, cli := vhosts(t, map[string]*fakejenkins.Server{
+		"127.0.0.1": fakejenkins.NewServer(patched),
+		"localhost": fakejenkins.NewServer(vulnerable),
+	})
+	u, err := url.Parse(ingress.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestRunner(t, &types.Options{})
+	// 先检测已修复的实例, 共用地址的其他实例仍要检测
+	patchedTarget, vulnerableTarget := ingress.URL, "http://localhost:"+u.Port()
+	for _, target := range []string{patchedTarget + "/ci-a", vulnerableTarget + "/ci-b"} {
+		r.detect(context.Background(), input.NewTarget(target))
+	}
+	want := map[string]string{patchedTarget: scanner.VerdictPatched, vulnerableTarget: baseline.Vulnerable}
+	for target, verdict := range want {
+		if got := r.observations[target]; got != verdict {
+			t.Errorf("verdict of %s = %q, want %q", target, got, verdict)
+		}
+	}
+	if cli["localhost"].Load() == 0 {
+		t.Error("the vulnerable instance sharing the address was not tested")
+	}
+
+	// 同一实例的另一个路径按实例标识跳过
+	tested := cli["127.0.0.1"].Load()
+	r.detect(context.Background(), input.NewTarget(patchedTarget+"/jenkins"))
+	if n := cli["127.0.0.1"].Load() - tested; n != 0 {
+		t.Errorf("alias of the patched instance was tested with %d cli requests, want it skipped by its identity", n)
+	}
+}
+
+func TestReadTargetWebhook(t *testing.T) {
+	jenkins := fakejenkins.NewServer(fakejenkins.DefaultOptions())
+	defer jenkins.Close()
+	tests := []struct {
+		name string
+		flat bool
+		// want are the versions and the files of the accepted payloads
+		want []string
+	}{
+		{name: "files", want: []string{"2: /etc/passwd,/nope"}},
+		{name: "flat results", flat: true, want: []string{"1: /etc/passwd", "1: /nope"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receiver := webhook.NewReceiver()
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+			r := newTestRunner(t, &types.Options{
+				Command:     []string{"connect-node"},
+				Args:        []string{"/etc/passwd", "/nope"},
+				Webhook:     server.URL,
+				FlatResults: test.flat,
+			})
+			r.readTarget(context.Background(), input.NewTarget(jenkins.URL), nil)
+
+			var got []string
+			for _, payload := range receiver.Payloads() {
+				files := []string{payload.Finding.Filename}
+				if len(payload.Finding.Files) != 0 {
+					files = files[:0]
+					for _, file := range payload.Finding.Files {
+						files = append(files, file.Path)
+					}
+				}
+				sort.Strings(files)
+				got = append(got, fmt.Sprintf("%d: %s", payload.Version, strings.Join(files, ",")))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("payloads = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// readResults reads the records of the -results file of a read of files from jenkins
+func readResults(t *testing.T, jenkins *fakejenkins.Server, flat bool, files ...string) []*output.ResultEvent {
+	t.Helper()
+	results := filepath.Join(t.TempDir(), "results.jsonl")
+	r := newTestRunner(t, &types.Options{
+		Command:     []string{"connect-node"},
+		Args:        files,
+		Results:     results,
+		FlatResults: flat,
+	})
+	r.readTarget(context.Background(), input.NewTarget(jenkins.URL), nil)
+	r.Close()
+	data, err := os.ReadFile(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []*output.ResultEvent
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		record := &output.ResultEvent{}
+		if err := json.Unmarshal([]byte(line), record); err != nil {
+			t.Fatalf("invalid record %q: %s", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestReadTargetResults(t *testing.T) {
+	options := fakejenkins.DefaultOptions()
+	options.Silent = []string{"/empty"}
+	jenkins := fakejenkins.NewServer(options)
+	defer jenkins.Close()
+
+	records := readResults(t, jenkins, false, "/etc/passwd", "/nope", "/empty")
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want one record of the target", len(records))
+	}
+	record := records[0]
+	if record.SchemaVersion != output.SchemaVersion || record.Mode != output.ModeReadFile || record.Args != "" || record.Response != "" {
+		t.Errorf("record = %+v, want a version %d read file record without args and response", record, output.SchemaVersion)
+	}
+	files := map[string]*output.FileRecord{}
+	for _, file := range record.Files {
+		files[file.Path] = file
+	}
+	if len(files) != 3 {
+		t.Fatalf("files = %+v, want every requested file", record.Files)
+	}
+	passwd := files["/etc/passwd"]
+	sum := sha256.Sum256([]byte(passwd.Content))
+	if passwd.Error != "" || !passwd.Complete || passwd.RequestedVia != "connect-node" || !strings.Contains(passwd.Content, "root:x:0:0") ||
+		passwd.Size != len(passwd.Content) || passwd.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("/etc/passwd = %+v, want its complete content", passwd)
+	}
+	for path, want := range map[string]string{"/nope": "no such file", "/empty": errEmptyResponse.Error()} {
+		if file := files[path]; file.Error != want || file.Complete || file.Size != 0 || file.SHA256 != "" {
+			t.Errorf("%s = %+v, want error %q", path, file, want)
+		}
+	}
+
+	flat := readResults(t, jenkins, true, "/etc/passwd", "/nope", "/empty")
+	var args []string
+	for _, record := range flat {
+		if record.SchemaVersion != output.FlatSchemaVersion || len(record.Files) != 0 || record.Response == "" {
+			t.Errorf("flat record = %+v, want a version %d record with the response", record, output.FlatSchemaVersion)
+		}
+		args = append(args, record.Args)
+	}
+	sort.Strings(args)
+	if want := []string{"/etc/passwd", "/nope"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("flat records of %v, want %v", args, want)
+	}
+}
+
+func TestReadTargetFilesInterest(t *testing.T) {
+	options := fakejenkins.DefaultOptions()
+	options.Files["/app/.env"] = "DB_PASSWORD=hunter2\n"
+	jenkins := fakejenkins.NewServer(options)
+	defer jenkins.Close()
+
+	records := readResults(t, jenkins, false, "/etc/passwd", "/app/.env")
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want one record of the target", len(records))
+	}
+	record := records[0]
+	// 得分最高的文件排在前面, 记录带有它的 interest
+	var paths []string
+	for _, file := range record.Files {
+		paths = append(paths, file.Path)
+	}
+	if want := []string{"/app/.env", "/etc/passwd"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("files = %v, want %v", paths, want)
+	}
+	env := record.Files[0]
+	if env.InterestScore == 0 || len(env.InterestReasons) == 0 || !strings.HasPrefix(env.InterestReasons[0], "key=value density") {
+		t.Errorf("/app/.env = %+v, want its key=value interest", env)
+	}
+	if record.InterestScore != env.InterestScore || !reflect.DeepEqual(record.InterestReasons, env.InterestReasons) {
+		t.Errorf("record interest = %d %q, want the interest of /app/.env", record.InterestScore, record.InterestReasons)
+	}
+	if passwd := record.Files[1]; passwd.InterestScore >= env.InterestScore {
+		t.Errorf("/etc/passwd interest = %d, want below /app/.env", passwd.InterestScore)
+	}
+}
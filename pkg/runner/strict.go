@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"sort"
+)
+
+// ErrStrict is returned by the run when an expected target was not conclusively evaluated with -strict
+var ErrStrict = errors.New("expected targets were not conclusively evaluated")
+
+// expectTargets loads the -expect-target inputs, every one is pending until the detection evaluates it
+func (r *Runner) expectTargets() {
+	if len(r.options.ExpectTargets) == 0 {
+		return
+	}
+	r.expected = make(map[string]string)
+	for _, target := range r.options.ExpectTargets {
+		if target = adjustTarget(target); target != "" {
+			r.expected[input.NewTarget(target).ToString()] = "not in the scanned targets"
+		}
+	}
+	for _, target := range r.excluded {
+		if key := input.NewTarget(target).ToString(); r.expected[key] != "" {
+			r.expected[key] = "excluded by -exclude or -scope"
+		}
+	}
+}
+
+// evaluated records the outcome of the detection of a target, an empty reason when it is conclusive
+func (r *Runner) evaluated(target *input.Target, reason string) {
+	if r.expected == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.expected[target.ToString()]; ok {
+		r.expected[target.ToString()] = reason
+	}
+}
+
+// ambiguousReason returns why no check matching a target is not a conclusive negative verdict,
+// empty when the target is a patched jenkins
+func ambiguousReason(backend *scanner.Backend, probeErr, checkErr error, class string) string {
+	switch {
+	case class != "":
+		return fmt.Sprintf("%s: %s", scanner.VerdictInconclusive, class)
+	case probeErr != nil:
+		return fmt.Sprintf("unreachable: %s", probeErr)
+	case backend == nil:
+		return ""
+	case !backend.Jenkins:
+		return fmt.Sprintf("%s (login page status %d)", scanner.VerdictNotJenkins, backend.Status)
+	case checkErr != nil:
+		return fmt.Sprintf("unreachable: %s", checkErr)
+	}
+	return ""
+}
+
+// checkExpected logs the expected targets which were not conclusively evaluated, failing the run with -strict
+func (r *Runner) checkExpected() error {
+	if r.expected == nil {
+		return nil
+	}
+	targets := make([]string, 0, len(r.expected))
+	for target, reason := range r.expected {
+		if reason != "" {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		gologger.Info().Msgf("all %d expected targets were conclusively evaluated", len(r.expected))
+		return nil
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		if r.options.Strict {
+			gologger.Error().Msgf("strict: %s: %s", target, r.expected[target])
+		} else {
+			gologger.Warning().Msgf("expected target %s: %s", target, r.expected[target])
+		}
+	}
+	if !r.options.Strict {
+		return nil
+	}
+	return fmt.Errorf("%d of %d %w", len(targets), len(r.expected), ErrStrict)
+}
@@ -2,6 +2,7 @@ package runner
 
 import (
 	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
 	"github.com/wjlin0/CVE-2024-23897/pkg/types"
 	"time"
 )
@@ -22,6 +23,74 @@ func ValidateRunEnumeration(options *types.Options) error {
 		return err
 	}
 
+	// 先展开预设, 之后的检查依赖运行模式
+	if len(options.Presets) != 0 {
+		paths, variants, err := scanner.PresetPaths(options.Presets)
+		if err != nil {
+			return err
+		}
+		options.Args = append(options.Args, paths...)
+		options.VariantPresets = variants
+	}
+	if options.Auth != "" && !scanner.ValidAuth(options.Auth) {
+		return fmt.Errorf("-auth must be user:api-token")
+	}
+	if options.Sorted && options.Results == "" && options.Workdir == "" {
+		return fmt.Errorf("-sorted requires -results or -workdir")
+	}
+	if options.Watch != "" {
+		switch {
+		case !options.IsCheckMode():
+			return fmt.Errorf("-watch only applies to the detection")
+		case options.Sorted:
+			return fmt.Errorf("cannot use -watch with -sorted, which writes the results when the run ends")
+		case len(options.ExpectTargets) != 0:
+			return fmt.Errorf("cannot use -watch with -expect-target, a watch never completes")
+		}
+	} else if options.WatchPoll || options.WatchState != "" {
+		return fmt.Errorf("-watch-poll and -watch-state require -watch")
+	}
+	if options.Strict && len(options.ExpectTargets) == 0 {
+		return fmt.Errorf("-strict requires -expect-target")
+	}
+	if len(options.ExpectTargets) != 0 && !options.IsCheckMode() {
+		return fmt.Errorf("-expect-target only applies to the detection")
+	}
+	if options.Baseline != "" || options.WriteBaseline != "" {
+		switch {
+		case !options.IsCheckMode():
+			return fmt.Errorf("-baseline and -write-baseline only apply to the detection")
+		case options.Watch != "":
+			return fmt.Errorf("cannot use -watch with -baseline or -write-baseline, a watch never completes")
+		}
+	}
+	if options.Compliance != "" && options.Baseline == "" {
+		return fmt.Errorf("-compliance requires -baseline")
+	}
+	if options.RedactAfterDays < 0 || options.LootMaxDays < 0 || options.EvidenceMaxDays < 0 {
+		return fmt.Errorf("-redact-after-days, -loot-max-days and -evidence-max-days must not be negative")
+	}
+	if retentionPolicy(options.RedactAfterDays, options.LootMaxDays, options.EvidenceMaxDays).Enabled() && options.Workdir == "" {
+		return fmt.Errorf("-redact-after-days, -loot-max-days and -evidence-max-days require -workdir")
+	}
+	if options.AutoLoot {
+		switch {
+		case options.Exec || options.ListAvailableCommands:
+			return fmt.Errorf("-auto-loot only applies to the detection")
+		case !options.HasFiles():
+			return fmt.Errorf("-auto-loot requires the files to read with -args or -preset")
+		}
+	} else if options.StreamLoot {
+		return fmt.Errorf("-stream-loot requires -auto-loot")
+	}
+	if options.DryRun {
+		switch {
+		case options.SelfTest:
+			return fmt.Errorf("cannot use -dry-run with -selftest")
+		case options.Watch != "":
+			return fmt.Errorf("cannot use -dry-run with -watch, a watch never completes")
+		}
+	}
 	if options.Exec && options.ListAvailableCommands {
 		return fmt.Errorf("cannot use -exec and -list-available-commands at the same time")
 	}
@@ -29,6 +98,9 @@ func ValidateRunEnumeration(options *types.Options) error {
 	if options.Thread <= 0 {
 		options.Thread = DefaultThread
 	}
+	if options.LootThreads <= 0 {
+		options.LootThreads = DefaultLootThreads
+	}
 	if options.Timeout <= 0 {
 		options.Timeout = DefaultTimeout
 	}
@@ -41,10 +113,10 @@ func ValidateRunEnumeration(options *types.Options) error {
 		}
 	}
 
-	if !options.IsListAvailableCommands() && !options.IsExecMode() && len(options.Args) != 0 && len(options.Command) == 0 {
+	if !options.IsListAvailableCommands() && !options.IsExecMode() && options.HasFiles() && len(options.Command) == 0 {
 		options.Command = append(options.Command, "who-am-i")
 	}
-	if !options.IsListAvailableCommands() && !options.IsExecMode() && len(options.Args) == 0 && len(options.Command) != 0 {
+	if !options.IsListAvailableCommands() && !options.IsExecMode() && !options.HasFiles() && len(options.Command) != 0 {
 		options.Args = append(options.Args, "/etc/passwd")
 	}
 
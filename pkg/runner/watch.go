@@ -0,0 +1,119 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"github.com/projectdiscovery/gologger"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/watch"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watch schedules the input targets and those appended to the -watch file until SIGINT or SIGTERM,
+// SIGHUP reads the file again. Targets are scanned once per session, and once across sessions with -watch-state
+func (r *Runner) watch(ctx context.Context) error {
+	seen, err := r.openWatchState()
+	if err != nil {
+		return err
+	}
+	targets := r.targets
+	r.targets = nil
+	schedule := func(target *input.Target) {
+		key := target.ToString()
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		if err := r.scanner.Scope().Allowed(target.OriginURL); err != nil {
+			gologger.Debug().Msgf("skipping %s: %s", target.OriginURL, err)
+			r.Lock()
+			r.excluded = append(r.excluded, target.OriginURL)
+			r.Unlock()
+			return
+		}
+		r.targets = append(r.targets, target)
+		r.spawn(target, func() {
+			r.detect(ctx, target)
+			r.scanned(key)
+		})
+	}
+	for _, target := range targets {
+		schedule(target)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	tailer := watch.New(r.options.Watch)
+	tailer.Poll = r.options.WatchPoll
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lines := make(chan string)
+	done := make(chan error, 1)
+	go func() { done <- tailer.Run(watchCtx, lines) }()
+	gologger.Info().Msgf("Watching %s for new targets, SIGHUP reads it again, SIGINT or SIGTERM stops", r.options.Watch)
+	for {
+		select {
+		case line := <-lines:
+			if line = adjustTarget(line); line != "" {
+				schedule(r.newTarget(line))
+			}
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				gologger.Info().Msgf("Reading %s again", r.options.Watch)
+				tailer.Reload()
+				continue
+			}
+			gologger.Info().Msgf("Stopping the watch of %s, waiting for the running scans", r.options.Watch)
+			cancel()
+			<-done
+			return nil
+		case err := <-done:
+			return errorutil.NewWithErr(err).Msgf("could not watch %v", r.options.Watch)
+		}
+	}
+}
+
+// openWatchState returns the targets scanned by the previous sessions of the -watch-state file
+// and opens it to record the targets of this session
+func (r *Runner) openWatchState() (map[string]struct{}, error) {
+	seen := make(map[string]struct{})
+	if r.options.WatchState == "" {
+		return seen, nil
+	}
+	if file, err := os.Open(r.options.WatchState); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := adjustTarget(scanner.Text()); line != "" {
+				seen[input.NewTarget(line).ToString()] = struct{}{}
+			}
+		}
+		_ = file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, errorutil.NewWithErr(err).Msgf("could not read watch state %v", r.options.WatchState)
+		}
+		gologger.Info().Msgf("Resuming from %s, skipping %d targets already scanned", r.options.WatchState, len(seen))
+	} else if !os.IsNotExist(err) {
+		return nil, errorutil.NewWithErr(err).Msgf("could not read watch state %v", r.options.WatchState)
+	}
+	var err error
+	if r.watchState, err = os.OpenFile(r.options.WatchState, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("could not open watch state %v", r.options.WatchState)
+	}
+	return seen, nil
+}
+
+// scanned records a target whose detection completed in the watch state, an interrupted one is scanned again on resume
+func (r *Runner) scanned(key string) {
+	if r.watchState == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	if _, err := r.watchState.WriteString(key + "\n"); err != nil {
+		gologger.Warning().Msgf("could not record %s in watch state: %s", key, err)
+	}
+}
@@ -0,0 +1,198 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/projectdiscovery/goflags"
+	"github.com/projectdiscovery/gologger"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"github.com/wjlin0/CVE-2024-23897/pkg/atomicfile"
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/redact"
+	"github.com/wjlin0/CVE-2024-23897/pkg/retention"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// files of a run directory
+const (
+	runResultsFile    = "results.jsonl"
+	runSarifFile      = "results.sarif"
+	runConfigFile     = "config.json"
+	runEgressFile     = "egress.json"
+	runComplianceFile = "compliance.json"
+	latestRunLink     = "latest"
+)
+
+// setupWorkdir creates a timestamped run directory in options.Workdir, points the unset artifact
+// options into it and updates the latest link
+func setupWorkdir(options *types.Options, now time.Time) (string, error) {
+	if err := os.MkdirAll(options.Workdir, 0755); err != nil {
+		return "", errorutil.NewWithErr(err).Msgf("could not create workdir %v", options.Workdir)
+	}
+	name := now.Format("20060102-150405")
+	runDir := filepath.Join(options.Workdir, name)
+	for i := 1; ; i++ {
+		err := os.Mkdir(runDir, 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", errorutil.NewWithErr(err).Msgf("could not create run directory %v", runDir)
+		}
+		name = fmt.Sprintf("%s-%d", now.Format("20060102-150405"), i)
+		runDir = filepath.Join(options.Workdir, name)
+	}
+
+	// 单独指定的参数优先
+	if options.Results == "" {
+		options.Results = filepath.Join(runDir, runResultsFile)
+	}
+	if options.Sarif == "" {
+		options.Sarif = filepath.Join(runDir, runSarifFile)
+	}
+	if options.Compliance == "" && options.Baseline != "" {
+		options.Compliance = filepath.Join(runDir, runComplianceFile)
+	}
+	if err := writeConfigSnapshot(filepath.Join(runDir, runConfigFile), options); err != nil {
+		return "", err
+	}
+	// 清单只列出运行目录下的产物, 单独指定到别处的文件不会被 prune 修改
+	artifacts := map[string]string{
+		options.Results:                          retention.KindResults,
+		options.Sarif:                            retention.KindSarif,
+		filepath.Join(runDir, runConfigFile):     retention.KindMetadata,
+		filepath.Join(runDir, runEgressFile):     retention.KindMetadata,
+		filepath.Join(runDir, runComplianceFile): retention.KindMetadata,
+	}
+	if err := retention.WriteManifest(runDir, now, artifacts); err != nil {
+		return "", errorutil.NewWithErr(err).Msgf("could not write the manifest of %v", runDir)
+	}
+
+	latest := filepath.Join(options.Workdir, latestRunLink)
+	if info, err := os.Lstat(latest); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		_ = os.Remove(latest)
+	}
+	if err := os.Symlink(name, latest); err != nil {
+		gologger.Warning().Msgf("could not link %v to the run directory: %s", latest, err)
+	}
+	return runDir, nil
+}
+
+// runEgress is the traffic of a run written to its run directory
+type runEgress struct {
+	Total   int64                   `json:"total"`
+	Budget  int64                   `json:"budget,omitempty"`
+	Skipped int64                   `json:"skipped,omitempty"`
+	Usage   map[string]egress.Usage `json:"categories"`
+}
+
+// writeEgress writes the traffic of the run per category and the targets skipped by -max-egress to runDir
+func writeEgress(runDir string, skipped int64) error {
+	path := filepath.Join(runDir, runEgressFile)
+	data, err := json.MarshalIndent(&runEgress{Total: egress.Default.Total(), Budget: egress.Default.Budget(), Skipped: skipped, Usage: egress.Default.Usage()}, "", "  ")
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not marshal egress")
+	}
+	if err := atomicfile.WriteFile(path, data, 0644); err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not write egress %v", path)
+	}
+	return nil
+}
+
+// writeConfigSnapshot writes the effective options, redacted unless -no-redact
+func writeConfigSnapshot(path string, options *types.Options) error {
+	snapshot := *options
+	if !options.NoRedact {
+		snapshot = redactOptions(options)
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not marshal config snapshot")
+	}
+	if err := atomicfile.WriteFile(path, data, 0600); err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not write config snapshot %v", path)
+	}
+	return nil
+}
+
+// redactOptions returns a copy of options without its secrets: header values, -auth, the credentials of
+// the proxies and the path and query of the webhook, which usually hold secrets
+func redactOptions(options *types.Options) types.Options {
+	snapshot := *options
+	if options.Auth != "" {
+		snapshot.Auth = redact.Placeholder
+	}
+	snapshot.Headers = nil
+	for _, header := range options.Headers {
+		name, _, _ := strings.Cut(header, ":")
+		snapshot.Headers = append(snapshot.Headers, name+": "+redact.Placeholder)
+	}
+	snapshot.ProxyURL = nil
+	for _, proxy := range options.ProxyURL {
+		snapshot.ProxyURL = append(snapshot.ProxyURL, redact.URL(proxy))
+	}
+	if u, err := url.Parse(options.Webhook); err == nil && u.Host != "" {
+		snapshot.Webhook = u.Scheme + "://" + u.Host + "/" + redact.Placeholder
+	}
+	snapshot.URL = redactTargets(options.URL)
+	snapshot.ListURL = redactTargets(options.ListURL)
+	snapshot.ExpectTargets = redactTargets(options.ExpectTargets)
+	return snapshot
+}
+
+// redactTargets returns targets with the credentials embedded in their URL replaced by the placeholder
+func redactTargets(targets goflags.StringSlice) goflags.StringSlice {
+	if targets == nil {
+		return nil
+	}
+	redacted := make(goflags.StringSlice, 0, len(targets))
+	for _, target := range targets {
+		if stripped, credentials := input.SplitCredentials(target); credentials != "" {
+			scheme, rest, ok := strings.Cut(stripped, "://")
+			if !ok {
+				scheme, rest = "", stripped
+			} else {
+				scheme += "://"
+			}
+			target = scheme + redact.Placeholder + "@" + rest
+		}
+		redacted = append(redacted, target)
+	}
+	return redacted
+}
+
+// optionSecrets returns the secret values of options, hidden wherever they appear in diagnostics
+func optionSecrets(options *types.Options) []string {
+	secrets := []string{options.Auth}
+	if _, token, ok := strings.Cut(options.Auth, ":"); ok {
+		secrets = append(secrets, token)
+	}
+	for _, header := range options.Headers {
+		_, value, _ := strings.Cut(header, ":")
+		secrets = append(secrets, value)
+	}
+	for _, proxy := range options.ProxyURL {
+		if u, err := url.Parse(proxy); err == nil && u.User != nil {
+			password, _ := u.User.Password()
+			secrets = append(secrets, password)
+		}
+	}
+	for _, targets := range []goflags.StringSlice{options.URL, options.ListURL, options.ExpectTargets} {
+		for _, target := range targets {
+			if _, credentials := input.SplitCredentials(target); credentials != "" {
+				_, password, _ := strings.Cut(credentials, ":")
+				secrets = append(secrets, credentials, password)
+			}
+		}
+	}
+	if u, err := url.Parse(options.Webhook); err == nil && u.Host != "" && (u.Path != "" || u.RawQuery != "") {
+		secrets = append(secrets, strings.TrimPrefix(u.RequestURI(), "/"))
+	}
+	return secrets
+}
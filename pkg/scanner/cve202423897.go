@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"strings"
+	"time"
+)
+
+// CVE202423897 is the id of the jenkins-cli arbitrary file read check
+const CVE202423897 = "CVE-2024-23897"
+
+func init() {
+	RegisterCheck(CVE202423897, func(s *Scanner) Check { return &cve202423897Check{scanner: s} })
+}
+
+type cve202423897Check struct {
+	scanner *Scanner
+}
+
+func (c *cve202423897Check) ID() string {
+	return CVE202423897
+}
+
+func (c *cve202423897Check) Detect(ctx context.Context, target *input.Target) (*output.ResultEvent, error) {
+	vul, full, result, err := c.scanner.check(ctx, target)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if !vul {
+		if result != nil && result.Verdict == VerdictAuthRequired {
+			result.CheckID = c.ID()
+			result.OS = c.scanner.OS(target)
+			return result, nil
+		}
+		// 没有协议响应时返回交互的错误, 便于区分未修复以外的原因
+		return nil, err
+	}
+	result.CheckID = c.ID()
+	result.FullRead = full
+	result.OS = c.scanner.OS(target)
+	c.scanner.Reproduce(result)
+	return result, nil
+}
+
+func (c *cve202423897Check) Exploit(ctx context.Context, target *input.Target, opts *ExploitOptions) (*output.ResultEvent, error) {
+	var result *output.ResultEvent
+	switch opts.Mode {
+	case output.ModeReadFile:
+		result = c.scanner.ReadFile(ctx, target, opts.Command, opts.Args)
+		if result != nil {
+			c.scanner.completeRead(ctx, target, opts.Command, opts.Args, result)
+			result.InterestScore, result.InterestReasons = Interest(result.Response, c.scanner.interest)
+			classifyK8s(result, time.Now(), c.scanner.redact)
+			classifyJenkins(result)
+			c.scanner.Reproduce(result)
+		}
+	case output.ModeExec:
+		result = c.scanner.Exec(ctx, target, opts.Command, opts.Args)
+	case output.ModeListAvailableCommands:
+		commands, listed := c.scanner.ListAvailableCommands(ctx, target)
+		if listed != nil && len(commands) != 0 {
+			listed.Response = fmt.Sprintf("%s\n", strings.Join(commands, ","))
+			result = listed
+		}
+	default:
+		return nil, fmt.Errorf("unsupported exploit mode %s", opts.Mode)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if result == nil || result.Response == "" {
+		return nil, nil
+	}
+	result.CheckID = c.ID()
+	result.OS = c.scanner.OS(target)
+	return result, nil
+}
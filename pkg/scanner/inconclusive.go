@@ -0,0 +1,151 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/projectdiscovery/retryablehttp-go"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// VerdictInconclusive is the verdict of targets on which no check matched for a reason worth a second pass
+const VerdictInconclusive = "inconclusive"
+
+// classes of inconclusive targets
+const (
+	ClassTimeout         = "timeout"
+	ClassConnectionError = "connection-error"
+	ClassWAFBlocked      = "waf-blocked"
+	ClassProtocolError   = "protocol-error"
+)
+
+// ErrNoCLIResponse is returned when the cli endpoint of a jenkins answered without the cli protocol,
+// usually a proxy in between breaking the duplex exchange
+var ErrNoCLIResponse = errors.New("no cli protocol response")
+
+// Strategy tweaks the exchange with targets of an inconclusive class
+type Strategy struct {
+	// TimeoutFactor multiplies the request timeout
+	TimeoutFactor int
+	// UploadDelay is the time the download side gets before the upload is sent
+	UploadDelay time.Duration
+	// Attempts is the number of exchanges tried until one answers with the cli protocol
+	Attempts int
+	// Headers are set on every request unless given by the user
+	Headers map[string]string
+}
+
+// Strategies are the strategies of the second pass per inconclusive class
+var Strategies = map[string]Strategy{
+	ClassTimeout:         {TimeoutFactor: 3, UploadDelay: 3 * time.Second},
+	ClassConnectionError: {Attempts: 2},
+	ClassWAFBlocked: {Headers: map[string]string{
+		"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"Accept-Language": "en-US,en;q=0.9",
+	}},
+	// 负载均衡未保持会话时 download 和 upload 可能落到不同节点, 多次尝试
+	ClassProtocolError: {UploadDelay: 2 * time.Second, Attempts: 3},
+}
+
+// StrategyFor returns the strategy of the prior class of the target
+func StrategyFor(target *input.Target) Strategy {
+	return Strategies[target.PreviousClass]
+}
+
+func (st Strategy) uploadDelay() time.Duration {
+	if st.UploadDelay > 0 {
+		return st.UploadDelay
+	}
+	return time.Second
+}
+
+func (st Strategy) attempts() int {
+	if st.Attempts > 0 {
+		return st.Attempts
+	}
+	return 1
+}
+
+// apply sets the strategy headers the user didn't set
+func (st Strategy) apply(request *retryablehttp.Request) {
+	for name, value := range st.Headers {
+		if _, ok := types.Headers[name]; !ok {
+			request.Header.Set(name, value)
+		}
+	}
+}
+
+// ClassifyInconclusive returns the class of a target on which no check matched, empty when the
+// negative verdict is conclusive. probeErr is the error of the backend probe, checkErr the error of the exchange
+func ClassifyInconclusive(backend *Backend, probeErr error, checkErr error) string {
+	if probeErr != nil {
+		return classifyError(probeErr)
+	}
+	if backend == nil {
+		return ""
+	}
+	if !backend.Jenkins {
+		switch backend.Status {
+		case http.StatusForbidden, http.StatusNotAcceptable, http.StatusTooManyRequests:
+			return ClassWAFBlocked
+		}
+		return ""
+	}
+	if checkErr != nil {
+		return classifyError(checkErr)
+	}
+	return ""
+}
+
+// classifyError returns the class of a request error, refused connections and dns errors mean the
+// target is down which a second pass won't change
+func classifyError(err error) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED), errors.As(err, &dnsErr):
+		return ""
+	case errors.Is(err, ErrNoCLIResponse):
+		return ClassProtocolError
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ClassTimeout
+	}
+	return ClassConnectionError
+}
+
+// ReadInconclusive returns the prior class of the inconclusive targets of a results file,
+// targets with a later conclusive result are left out
+func ReadInconclusive(r io.Reader) (map[string]string, error) {
+	classes := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var result output.ResultEvent
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			return nil, err
+		}
+		if result.URL == "" {
+			continue
+		}
+		if result.Verdict == VerdictInconclusive && result.Inconclusive != "" {
+			classes[result.URL] = result.Inconclusive
+		} else {
+			delete(classes, result.URL)
+		}
+	}
+	return classes, scanner.Err()
+}
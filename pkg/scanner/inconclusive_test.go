@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"github.com/wjlin0/CVE-2024-23897/pkg/fakejenkins"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyInconclusive(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  *Backend
+		probeErr error
+		checkErr error
+		class    string
+	}{
+		{name: "probe timeout", probeErr: timeoutError{}, class: ClassTimeout},
+		{name: "probe deadline", probeErr: context.DeadlineExceeded, class: ClassTimeout},
+		{name: "probe reset", probeErr: syscall.ECONNRESET, class: ClassConnectionError},
+		{name: "probe refused", probeErr: syscall.ECONNREFUSED},
+		{name: "probe dns", probeErr: &net.DNSError{Err: "no such host", Name: "jenkins.invalid", IsNotFound: true}},
+		{name: "waf", backend: &Backend{Status: 403}, class: ClassWAFBlocked},
+		{name: "rate limited", backend: &Backend{Status: 429}, class: ClassWAFBlocked},
+		{name: "not jenkins", backend: &Backend{Status: 200}, checkErr: ErrNoCLIResponse},
+		{name: "proxy breaking the exchange", backend: &Backend{Jenkins: true, Status: 200}, checkErr: ErrNoCLIResponse, class: ClassProtocolError},
+		{name: "exchange timeout", backend: &Backend{Jenkins: true, Status: 200}, checkErr: timeoutError{}, class: ClassTimeout},
+		{name: "exchange eof", backend: &Backend{Jenkins: true, Status: 200}, checkErr: io.ErrUnexpectedEOF, class: ClassConnectionError},
+		{name: "patched", backend: &Backend{Jenkins: true, Status: 200}},
+		{name: "canceled before probe"},
+	}
+	for _, test := range tests {
+		if class := ClassifyInconclusive(test.backend, test.probeErr, test.checkErr); class != test.class {
+			t.Errorf("ClassifyInconclusive(%s) = %q, want %q", test.name, class, test.class)
+		}
+	}
+}
+
+func TestReadInconclusive(t *testing.T) {
+	results := strings.Join([]string{
+		`{"url":"http://a.example.com:80","Mode":1,"verdict":"inconclusive","inconclusive":"timeout"}`,
+		`{"url":"http://b.example.com:80","Mode":1,"verdict":"inconclusive","inconclusive":"waf-blocked"}`,
+		`{"check-id":"CVE-2024-23897","url":"http://c.example.com:80","Mode":1,"response":"connect-node"}`,
+		``,
+		`{"url":"http://d.example.com:80","Mode":1,"verdict":"inconclusive","inconclusive":"protocol-error"}`,
+		`{"check-id":"CVE-2024-23897","url":"http://d.example.com:80","Mode":1,"response":"who-am-i"}`,
+	}, "\n")
+	classes, err := ReadInconclusive(strings.NewReader(results))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"http://a.example.com:80": ClassTimeout, "http://b.example.com:80": ClassWAFBlocked}
+	if !reflect.DeepEqual(classes, want) {
+		t.Errorf("ReadInconclusive() = %v, want %v", classes, want)
+	}
+	if _, err := ReadInconclusive(strings.NewReader("not json")); err == nil {
+		t.Error("ReadInconclusive() accepted an invalid line")
+	}
+}
+
+func TestSecondPassStrategy(t *testing.T) {
+	options := fakejenkins.DefaultOptions()
+	options.BlockedUserAgent = "Go-http-client"
+	server := fakejenkins.NewServer(options)
+	defer server.Close()
+	s, err := NewScanner(&types.Options{Timeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := &cve202423897Check{scanner: s}
+	ctx := context.Background()
+
+	target := input.NewTarget(server.URL)
+	result, checkErr := check.Detect(ctx, target)
+	if result != nil {
+		t.Fatalf("Detect() through the waf = %+v, want no result", result)
+	}
+	backend, probeErr := s.Backend(ctx, target)
+	if class := ClassifyInconclusive(backend, probeErr, checkErr); class != ClassWAFBlocked {
+		t.Fatalf("ClassifyInconclusive() = %q, want %q", class, ClassWAFBlocked)
+	}
+
+	target.PreviousClass = ClassWAFBlocked
+	result, err = check.Detect(ctx, target)
+	if err != nil || result == nil {
+		t.Fatalf("Detect() with the %s strategy = %v, %v, want a finding", ClassWAFBlocked, result, err)
+	}
+	if result.SecondPass != ClassWAFBlocked {
+		t.Errorf("SecondPass = %q, want %q", result.SecondPass, ClassWAFBlocked)
+	}
+	if !errors.Is(checkErr, ErrNoCLIResponse) {
+		t.Errorf("first pass error = %v, want %v", checkErr, ErrNoCLIResponse)
+	}
+}
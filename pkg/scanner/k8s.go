@@ -0,0 +1,104 @@
+package scanner
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// FindingK8sServiceAccountToken is the finding type of a leaked kubernetes service account token
+	FindingK8sServiceAccountToken = "k8s-serviceaccount-token"
+	// FindingKubeconfig is the finding type of a leaked kubeconfig
+	FindingKubeconfig = "kubeconfig"
+
+	k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+var kubeconfigRegex = regexp.MustCompile(`(?m)^kind:\s*Config\s*$`)
+
+// k8sClaims are the claims of bound (kubernetes.io) and legacy service account tokens
+type k8sClaims struct {
+	Issuer     string `json:"iss"`
+	Subject    string `json:"sub"`
+	Expiry     int64  `json:"exp"`
+	Kubernetes struct {
+		Namespace      string `json:"namespace"`
+		ServiceAccount struct {
+			Name string `json:"name"`
+		} `json:"serviceaccount"`
+	} `json:"kubernetes.io"`
+	LegacyNamespace      string `json:"kubernetes.io/serviceaccount/namespace"`
+	LegacyServiceAccount string `json:"kubernetes.io/serviceaccount/service-account.name"`
+}
+
+// decodeK8sToken extracts the service account claims of a jwt without verifying its signature
+func decodeK8sToken(token string) (*k8sClaims, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("not a jwt")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+	claims := &k8sClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, err
+	}
+	if claims.Kubernetes.Namespace == "" && claims.LegacyNamespace == "" {
+		return nil, fmt.Errorf("not a kubernetes service account token")
+	}
+	return claims, nil
+}
+
+// redactToken keeps the jwt header and hides the claims and signature
+func redactToken(token string) string {
+	if i := strings.Index(token, "."); i > 0 {
+		return token[:i] + ".[REDACTED]"
+	}
+	return "[REDACTED]"
+}
+
+// classifyK8s turns leaked service account tokens and kubeconfigs into dedicated findings
+func classifyK8s(result *output.ResultEvent, now time.Time, redact bool) {
+	content := strings.TrimSpace(result.Response)
+	if content == "" {
+		return
+	}
+	if claims, err := decodeK8sToken(content); err == nil {
+		namespace, serviceAccount := claims.Kubernetes.Namespace, claims.Kubernetes.ServiceAccount.Name
+		if namespace == "" {
+			namespace, serviceAccount = claims.LegacyNamespace, claims.LegacyServiceAccount
+		}
+		result.Finding = FindingK8sServiceAccountToken
+		result.Details = map[string]string{
+			"namespace":      namespace,
+			"serviceaccount": serviceAccount,
+			"issuer":         claims.Issuer,
+			"kubectl":        fmt.Sprintf("kubectl --server <KUBERNETES_API_SERVER> --token \"$TOKEN\" --insecure-skip-tls-verify -n %s auth can-i --list", namespace),
+		}
+		if claims.Expiry > 0 {
+			expiry := time.Unix(claims.Expiry, 0).UTC()
+			result.Details["expiry"] = expiry.Format(time.RFC3339)
+			result.Details["expired"] = fmt.Sprint(expiry.Before(now))
+		} else {
+			result.Details["expiry"] = "never"
+			result.Details["expired"] = "false"
+		}
+		if redact {
+			result.Response = redactToken(content)
+		}
+		return
+	}
+	if kubeconfigRegex.MatchString(content) && strings.Contains(content, "clusters:") {
+		result.Finding = FindingKubeconfig
+		result.Details = map[string]string{
+			"kubectl": "kubectl --kubeconfig <LEAKED_KUBECONFIG> auth can-i --list",
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package scanner
+
+import (
+	"encoding/base64"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fakeJWT(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"RS256","kid":"test"}`)) + "." + encode([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+func TestClassifyK8s(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	bound := fakeJWT(`{"iss":"https://kubernetes.default.svc","exp":1800000000,"kubernetes.io":{"namespace":"ci","serviceaccount":{"name":"jenkins"}}}`)
+	expired := fakeJWT(`{"exp":1600000000,"kubernetes.io":{"namespace":"ci","serviceaccount":{"name":"jenkins"}}}`)
+	legacy := fakeJWT(`{"iss":"kubernetes/serviceaccount","kubernetes.io/serviceaccount/namespace":"default","kubernetes.io/serviceaccount/service-account.name":"builder"}`)
+	kubeconfig := "apiVersion: v1\nclusters:\n- cluster:\n    server: https://10.0.0.1:6443\n  name: prod\nkind: Config\n"
+
+	tests := []struct {
+		name           string
+		response       string
+		finding        string
+		namespace      string
+		serviceAccount string
+		expired        string
+	}{
+		{name: "bound", response: bound + "\n", finding: FindingK8sServiceAccountToken, namespace: "ci", serviceAccount: "jenkins", expired: "false"},
+		{name: "expired", response: expired, finding: FindingK8sServiceAccountToken, namespace: "ci", serviceAccount: "jenkins", expired: "true"},
+		{name: "legacy", response: legacy, finding: FindingK8sServiceAccountToken, namespace: "default", serviceAccount: "builder", expired: "false"},
+		{name: "kubeconfig", response: kubeconfig, finding: FindingKubeconfig},
+		{name: "other jwt", response: fakeJWT(`{"sub":"user"}`)},
+		{name: "passwd", response: "root:x:0:0:root:/root:/bin/bash\n"},
+	}
+	for _, test := range tests {
+		result := &output.ResultEvent{Response: test.response}
+		classifyK8s(result, now, true)
+		if result.Finding != test.finding {
+			t.Errorf("classifyK8s(%s) finding = %q, want %q", test.name, result.Finding, test.finding)
+			continue
+		}
+		if test.finding != FindingK8sServiceAccountToken {
+			continue
+		}
+		if result.Details["namespace"] != test.namespace || result.Details["serviceaccount"] != test.serviceAccount || result.Details["expired"] != test.expired {
+			t.Errorf("classifyK8s(%s) details = %v", test.name, result.Details)
+		}
+		if !strings.Contains(result.Details["kubectl"], "-n "+test.namespace) {
+			t.Errorf("classifyK8s(%s) kubectl = %q", test.name, result.Details["kubectl"])
+		}
+		if strings.Contains(result.Response, strings.Split(test.response, ".")[1]) {
+			t.Errorf("classifyK8s(%s) did not redact the token: %q", test.name, result.Response)
+		}
+	}
+
+	result := &output.ResultEvent{Response: bound}
+	classifyK8s(result, now, false)
+	if result.Response != bound {
+		t.Errorf("classifyK8s without redaction changed the response to %q", result.Response)
+	}
+}
+
+func TestPresetPaths(t *testing.T) {
+	paths, variants, err := PresetPaths([]string{"K8S", " Jenkins"})
+	if err != nil || len(paths) != len(Presets["k8s"]) || len(variants) != 1 || variants[0] != "jenkins" {
+		t.Fatalf("PresetPaths(K8S, Jenkins) = %v, %v, %v", paths, variants, err)
+	}
+	if _, _, err := PresetPaths([]string{"unknown"}); err == nil {
+		t.Errorf("PresetPaths(unknown) should fail")
+	}
+}
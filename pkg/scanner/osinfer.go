@@ -0,0 +1,129 @@
+package scanner
+
+import (
+	"context"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// operating systems inferred from the targets
+const (
+	OSLinux   = "linux"
+	OSWindows = "windows"
+)
+
+var (
+	// missingFile is the args4j error of a file which can't be read, java prints its path with the separator of the os
+	missingFile = regexp.MustCompile(`No such file: (\S+)`)
+	windowsPath = regexp.MustCompile(`(?i)(^|[\s"'=])[a-z]:\\|\\(windows|users|programdata|program files)\\`)
+	// banners of the web servers and proxies in front of jenkins naming the os
+	windowsBanner = regexp.MustCompile(`(?i)win32|win64|windows|microsoft-iis`)
+	linuxBanner   = regexp.MustCompile(`(?i)ubuntu|debian|centos|red hat|fedora|alpine|amazon linux|linux|unix`)
+)
+
+// OSFromLeak returns the os of the target from a leaked response, empty when it tells nothing
+func OSFromLeak(response string) string {
+	if strings.Contains(response, "root:x:0:0:") {
+		return OSLinux
+	}
+	for _, match := range missingFile.FindAllStringSubmatch(response, -1) {
+		switch {
+		case strings.Contains(match[1], `\`):
+			return OSWindows
+		case strings.HasPrefix(match[1], "/"):
+			return OSLinux
+		}
+	}
+	if windowsPath.MatchString(response) {
+		return OSWindows
+	}
+	return ""
+}
+
+// IsMissingFile reports whether a read was answered with the error of a file which can't be read
+func IsMissingFile(response string) bool {
+	return missingFile.MatchString(response)
+}
+
+// OSFromBanner returns the os named by the Server and X-Powered-By headers, empty when they don't
+func OSFromBanner(header http.Header) string {
+	banner := header.Get("Server") + " " + header.Get("X-Powered-By")
+	switch {
+	case windowsBanner.MatchString(banner):
+		return OSWindows
+	case linuxBanner.MatchString(banner):
+		return OSLinux
+	}
+	return ""
+}
+
+// OtherOS returns the os the variants of os are retried with when they can't be read
+func OtherOS(os string) string {
+	if os == OSWindows {
+		return OSLinux
+	}
+	return OSWindows
+}
+
+// osInference is the os inferred for a target, leaked responses are trusted over banners
+type osInference struct {
+	os     string
+	leaked bool
+}
+
+// osCache holds the os inferred per target
+type osCache struct {
+	mutex   sync.Mutex
+	entries map[string]osInference
+}
+
+func (c *osCache) get(target *input.Target) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.entries[target.ToString()].os
+}
+
+// set records os for target unless a leaked response already told otherwise, leaked overrides a banner
+func (c *osCache) set(target *input.Target, os string, leaked bool) {
+	if os == "" {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]osInference)
+	}
+	if current, ok := c.entries[target.ToString()]; ok && current.leaked && !leaked {
+		return
+	}
+	c.entries[target.ToString()] = osInference{os: os, leaked: leaked}
+}
+
+// OS returns the os inferred for target so far, empty when unknown
+func (s *Scanner) OS(target *input.Target) string {
+	return s.os.get(target)
+}
+
+// SetOS records the os of target, e.g. once the files of its variant could be read
+func (s *Scanner) SetOS(target *input.Target, os string) {
+	s.os.set(target, os, true)
+}
+
+// InferOS returns the os of target from the responses leaked so far, then from the server banner
+// and at last from a read of /etc/passwd, empty when they tell nothing
+func (s *Scanner) InferOS(ctx context.Context, target *input.Target) string {
+	if os := s.OS(target); os != "" {
+		return os
+	}
+	if backend, err := s.Backend(ctx, target); err == nil && backend.OS != "" {
+		s.os.set(target, backend.OS, false)
+		return backend.OS
+	}
+	// 响应会在 exchange 中被记录
+	s.Exploit(ctx, target, output.ModeReadFile, "/etc/passwd", "who-am-i")
+	return s.OS(target)
+}
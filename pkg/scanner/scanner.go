@@ -3,21 +3,43 @@ package scanner
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"github.com/projectdiscovery/ratelimit"
 	"github.com/projectdiscovery/retryablehttp-go"
+	"github.com/wjlin0/CVE-2024-23897/pkg/credential"
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+	"github.com/wjlin0/CVE-2024-23897/pkg/scope"
 	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"net"
 	"net/http"
 	"net/url"
 	"time"
 )
 
 type Scanner struct {
-	client      *retryablehttp.Client
-	rateLimiter *ratelimit.MultiLimiter
-	options     *types.Options
+	client *retryablehttp.Client
+	// patient is the client with the longer timeout of the timeout strategy
+	patient          *retryablehttp.Client
+	rateLimiter      *ratelimit.MultiLimiter
+	options          *types.Options
+	transport        *observingTransport
+	patientTransport *observingTransport
+	// egress counts the bytes exchanged with targets, into egress.Default too
+	egress   *egress.Counter
+	interest InterestThresholds
+	redact   bool
+	// authorization is the Authorization header sent to targets refusing anonymous users
+	authorization string
+	// scope refuses requests and dials to excluded or out of scope targets
+	scope *scope.Policy
+	// os holds the os inferred per target
+	os osCache
 }
 
-func NewScanner(options *types.Options) (*Scanner, error) {
+// newClient returns a client with the given timeout and its observing transport, requests and
+// dials not allowed by the policy are refused and the others counted by counter. The requests of a
+// dry-run client are never sent
+func newClient(timeout time.Duration, policy *scope.Policy, counter *egress.Counter, dryRun bool) (*retryablehttp.Client, *observingTransport) {
 	retryMax := 0
 
 	// load proxy
@@ -35,46 +57,120 @@ func NewScanner(options *types.Options) (*Scanner, error) {
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true,
 		},
-		ResponseHeaderTimeout: time.Duration(options.Timeout) * time.Second,
+		ResponseHeaderTimeout: timeout,
 		Proxy:                 proxyFunc,
 	}
+	if policy.Enabled() {
+		dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+		Transport.DialContext = policy.DialContext(dialer.DialContext)
+	}
+	var base http.RoundTripper = Transport
+	if dryRun {
+		base = dryRunTransport{}
+	}
+	transport := &observingTransport{RoundTripper: counter.Transport(egress.Exploit, policy.Transport(base, proxyFunc))}
 	httpclient := &http.Client{
-		Transport: Transport,
-		Timeout:   time.Duration(options.Timeout) * time.Second,
+		Transport: transport,
+		Timeout:   timeout,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
 	}
 
 	retryablehttpOptions := retryablehttp.Options{RetryMax: retryMax}
-	retryablehttpOptions.RetryWaitMax = time.Duration(options.Timeout) * time.Second
-	client := retryablehttp.NewWithHTTPClient(httpclient, retryablehttpOptions)
-
-	var rateLimit *ratelimit.Options
-	if options.RateLimit > 0 {
-		rateLimit = &ratelimit.Options{MaxCount: uint(options.RateLimit), Key: "default", Duration: time.Second}
+	retryablehttpOptions.RetryWaitMax = timeout
+	return retryablehttp.NewWithHTTPClient(httpclient, retryablehttpOptions), transport
+}
 
-	} else {
-		rateLimit = &ratelimit.Options{IsUnlimited: true, Key: "default"}
+func NewScanner(options *types.Options) (*Scanner, error) {
+	policy, err := scope.NewPolicy(options.Exclude, options.Scope)
+	if err != nil {
+		return nil, err
 	}
+	auth := options.Auth
+	if auth == "" {
+		// 未指定 -auth 时从凭据提供方读取
+		if auth, err = credential.Get(credential.JenkinsAuth); err != nil {
+			return nil, err
+		}
+		if auth != "" && !ValidAuth(auth) {
+			return nil, fmt.Errorf("the %s credential must be user:api-token", credential.JenkinsAuth)
+		}
+	}
+	timeout := time.Duration(options.Timeout) * time.Second
+	counter := egress.Default.Child()
+	client, transport := newClient(timeout, policy, counter, options.DryRun)
+	patient, patientTransport := newClient(timeout*time.Duration(Strategies[ClassTimeout].TimeoutFactor), policy, counter, options.DryRun)
 
-	rateLimits, err := ratelimit.NewMultiLimiter(context.Background(), rateLimit)
+	rateLimits, err := ratelimit.NewMultiLimiter(context.Background(), rateLimitOptions(defaultRateLimitKey, options.RateLimit))
 	if err != nil {
 		return nil, err
 	}
+	lootRateLimit := options.LootRateLimit
+	if lootRateLimit < 0 {
+		lootRateLimit = options.RateLimit
+	}
+	if err := rateLimits.Add(rateLimitOptions(lootRateLimitKey, lootRateLimit)); err != nil {
+		return nil, err
+	}
 
 	return &Scanner{
-		client:      client,
-		options:     options,
-		rateLimiter: rateLimits,
+		client:           client,
+		patient:          patient,
+		options:          options,
+		rateLimiter:      rateLimits,
+		transport:        transport,
+		patientTransport: patientTransport,
+		egress:           counter,
+		interest:         interestThresholds(options),
+		redact:           !options.NoRedact,
+		authorization:    basicAuthorization(auth),
+		scope:            policy,
 	}, err
 }
 
+// keys of the rate limits, the looting of -auto-loot has a budget of its own
+const (
+	defaultRateLimitKey = "default"
+	lootRateLimitKey    = "loot"
+)
+
+// rateLimitOptions returns the limit of perSecond requests per second of key, unlimited when not positive
+func rateLimitOptions(key string, perSecond int) *ratelimit.Options {
+	if perSecond > 0 {
+		return &ratelimit.Options{MaxCount: uint(perSecond), Key: key, Duration: time.Second}
+	}
+	return &ratelimit.Options{IsUnlimited: true, Key: key}
+}
+
+type lootContextKey struct{}
+
+// WithLootRateLimit makes the requests of ctx take from the -loot-rate-limit budget instead of the -rate-limit one
+func WithLootRateLimit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lootContextKey{}, true)
+}
+
+// Scope returns the policy of the targets which may be contacted
+func (s *Scanner) Scope() *scope.Policy {
+	return s.scope
+}
+
 func (s *Scanner) Do(request *retryablehttp.Request) (*http.Response, error) {
-	_ = s.rateLimiter.Take("default")
+	return s.do(request, Strategy{})
+}
+
+// do sends the request with the client of the strategy
+func (s *Scanner) do(request *retryablehttp.Request, strategy Strategy) (*http.Response, error) {
+	key := defaultRateLimitKey
+	if request.Context().Value(lootContextKey{}) != nil {
+		key = lootRateLimitKey
+	}
+	_ = s.rateLimiter.Take(key)
 	for k, v := range types.Headers {
 		request.Header.Add(k, v)
 	}
-
+	if strategy.TimeoutFactor > 1 {
+		return s.patient.Do(request)
+	}
 	return s.client.Do(request)
 }
@@ -0,0 +1,41 @@
+package scanner
+
+import (
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+	"net/http"
+)
+
+// observingTransport reports the outcome of every request to the observer of the scanner
+type observingTransport struct {
+	http.RoundTripper
+	// observe is called with the outcome of every request when set
+	observe func(resp *http.Response, err error)
+}
+
+func (t *observingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if t.observe != nil {
+		t.observe(resp, err)
+	}
+	return resp, err
+}
+
+// OnResponse sets the observer of request outcomes, it must be set before scanning
+func (s *Scanner) OnResponse(observe func(resp *http.Response, err error)) {
+	s.transport.observe = observe
+	s.patientTransport.observe = observe
+}
+
+// BytesReceived returns the bytes received from targets so far, response headers are approximated
+func (s *Scanner) BytesReceived() int64 {
+	var received int64
+	for _, usage := range s.egress.Usage() {
+		received += usage.Received
+	}
+	return received
+}
+
+// Egress returns the bytes exchanged with targets per category
+func (s *Scanner) Egress() *egress.Counter {
+	return s.egress
+}
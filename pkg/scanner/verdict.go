@@ -0,0 +1,127 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"github.com/projectdiscovery/retryablehttp-go"
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// verdicts of targets on which no check matched
+const (
+	VerdictPatched    = "patched"
+	VerdictNotJenkins = "not_jenkins"
+)
+
+// Backend identifies the server behind a target, aliases of one backend share its identity key
+type Backend struct {
+	// IdentityKey is derived from the X-Instance-Identity header of Jenkins
+	IdentityKey string
+	// EndpointKey is the scheme, host, port and path of the target. Distinct instances often share one
+	// address (vhosts, CDN edges, context paths), so targets are never matched by their resolved ip
+	EndpointKey string
+	// Jenkins is true when the backend announced itself as Jenkins
+	Jenkins bool
+	// Status is the status code of the login page
+	Status int
+	// OS is the os named by the server banner, empty when it names none
+	OS string
+}
+
+// Keys returns the non empty keys the verdict of the backend is cached under. A not_jenkins verdict has no
+// instance identity and is only cached for its own endpoint
+func (b *Backend) Keys() []string {
+	var keys []string
+	for _, key := range []string{b.IdentityKey, b.EndpointKey} {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// EndpointKey returns the endpoint key of the target, without resolving its host
+func EndpointKey(target *input.Target) string {
+	path := ""
+	origin := target.OriginURL
+	if !strings.Contains(origin, "://") {
+		origin = target.Scheme + "://" + origin
+	}
+	if u, err := url.Parse(origin); err == nil {
+		path = strings.TrimSuffix(u.EscapedPath(), "/")
+	}
+	return "endpoint:" + strings.ToLower(target.Scheme) + "://" + strings.ToLower(net.JoinHostPort(target.Host, strconv.Itoa(target.Port))) + path
+}
+
+// Backend probes the login page for the instance identity of the target
+func (s *Scanner) Backend(ctx context.Context, target *input.Target) (*Backend, error) {
+	ctx = egress.WithCategory(ctx, egress.Fingerprint)
+	backend := &Backend{EndpointKey: EndpointKey(target)}
+	request, err := retryablehttp.NewRequestWithContext(ctx, "HEAD", fmt.Sprintf("%s/login", target.ToString()), nil)
+	if err != nil {
+		return nil, err
+	}
+	strategy := StrategyFor(target)
+	strategy.apply(request)
+	resp, err := s.do(request, strategy)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	backend.Status = resp.StatusCode
+	if identity := resp.Header.Get("X-Instance-Identity"); identity != "" {
+		backend.IdentityKey = "identity:" + identity
+	}
+	backend.Jenkins = backend.IdentityKey != "" || resp.Header.Get("X-Jenkins") != "" || resp.Header.Get("X-Hudson") != ""
+	backend.OS = OSFromBanner(resp.Header)
+	s.os.set(target, backend.OS, false)
+	return backend, nil
+}
+
+// CachedVerdict is the negative verdict of a backend and the target it was established on
+type CachedVerdict struct {
+	Verdict  string
+	Evidence string
+}
+
+// VerdictCache holds the negative verdicts of the backends scanned in a run
+type VerdictCache struct {
+	mutex   sync.RWMutex
+	entries map[string]*CachedVerdict
+}
+
+func NewVerdictCache() *VerdictCache {
+	return &VerdictCache{entries: make(map[string]*CachedVerdict)}
+}
+
+// Get returns the verdict cached under any of the keys
+func (c *VerdictCache) Get(keys ...string) (*CachedVerdict, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, key := range keys {
+		if verdict, ok := c.entries[key]; ok && key != "" {
+			return verdict, true
+		}
+	}
+	return nil, false
+}
+
+// Put caches the verdict under every key
+func (c *VerdictCache) Put(verdict *CachedVerdict, keys ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if _, ok := c.entries[key]; !ok {
+			c.entries[key] = verdict
+		}
+	}
+}
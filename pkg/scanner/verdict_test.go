@@ -0,0 +1,85 @@
+package scanner
+
+import (
+	"context"
+	"github.com/wjlin0/CVE-2024-23897/pkg/fakejenkins"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/types"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestBackend(t *testing.T) {
+	s, err := NewScanner(&types.Options{Timeout: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := fakejenkins.DefaultOptions()
+	options.InstanceIdentity = "MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"
+	jenkins := fakejenkins.NewServer(options)
+	defer jenkins.Close()
+	other := httptest.NewServer(http.NotFoundHandler())
+	defer other.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		identity string
+		jenkins  bool
+	}{
+		{name: "jenkins", url: jenkins.URL, identity: "identity:" + options.InstanceIdentity, jenkins: true},
+		{name: "other", url: other.URL},
+	}
+	for _, test := range tests {
+		target := input.NewTarget(test.url)
+		backend, err := s.Backend(context.Background(), target)
+		if err != nil {
+			t.Fatalf("Backend(%s) failed: %s", test.name, err)
+		}
+		if backend.IdentityKey != test.identity || backend.Jenkins != test.jenkins {
+			t.Errorf("Backend(%s) = %+v, want identity %q and jenkins %v", test.name, backend, test.identity, test.jenkins)
+		}
+		if want := "endpoint:http://" + target.Host + ":" + strconv.Itoa(target.Port); backend.EndpointKey != want {
+			t.Errorf("Backend(%s) endpoint = %q, want %q", test.name, backend.EndpointKey, want)
+		}
+	}
+}
+
+func TestEndpointKey(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "http://jenkins.example.com", want: "endpoint:http://jenkins.example.com:80"},
+		{input: "https://Jenkins.Example.com:443/", want: "endpoint:https://jenkins.example.com:443"},
+		{input: "https://host/ci-a", want: "endpoint:https://host:443/ci-a"},
+		{input: "https://host/ci-b/", want: "endpoint:https://host:443/ci-b"},
+		{input: "http://[::1]:8080/jenkins", want: "endpoint:http://[::1]:8080/jenkins"},
+	}
+	for _, test := range tests {
+		if got := EndpointKey(input.NewTarget(test.input)); got != test.want {
+			t.Errorf("EndpointKey(%s) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestVerdictCache(t *testing.T) {
+	cache := NewVerdictCache()
+	if _, ok := cache.Get("", "endpoint:http://jenkins-a.example.com:80"); ok {
+		t.Fatal("empty cache returned a verdict")
+	}
+	first := &CachedVerdict{Verdict: VerdictPatched, Evidence: "http://jenkins-a.example.com"}
+	cache.Put(first, "identity:abc", "", "endpoint:http://jenkins-a.example.com:80")
+	cache.Put(&CachedVerdict{Verdict: VerdictNotJenkins, Evidence: "http://jenkins-b.example.com"}, "endpoint:http://jenkins-a.example.com:80")
+
+	for _, key := range []string{"identity:abc", "endpoint:http://jenkins-a.example.com:80"} {
+		if verdict, ok := cache.Get(key); !ok || verdict != first {
+			t.Errorf("Get(%s) = %+v, %v, want the first verdict", key, verdict, ok)
+		}
+	}
+	if _, ok := cache.Get(""); ok {
+		t.Error("Get of an empty key returned a verdict")
+	}
+}
@@ -0,0 +1,111 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/projectdiscovery/retryablehttp-go"
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+	"github.com/wjlin0/CVE-2024-23897/pkg/input"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// JenkinsVersionAdvisory is the id of the version-only advisory check
+const JenkinsVersionAdvisory = "jenkins-version-advisory"
+
+var (
+	// fixedWeeklyVersion and fixedLTSVersion are the first releases fixing CVE-2024-23897
+	fixedWeeklyVersion = semver.MustParse("2.442")
+	fixedLTSVersion    = semver.MustParse("2.426.3")
+
+	generatorRegex = regexp.MustCompile(`<meta name="generator" content="Jenkins ([0-9.]+)"`)
+)
+
+func init() {
+	RegisterCheck(JenkinsVersionAdvisory, func(s *Scanner) Check { return &versionAdvisoryCheck{scanner: s} })
+}
+
+// versionAdvisoryCheck flags targets by the announced Jenkins version without exploiting them
+type versionAdvisoryCheck struct {
+	scanner *Scanner
+}
+
+func (c *versionAdvisoryCheck) ID() string {
+	return JenkinsVersionAdvisory
+}
+
+func (c *versionAdvisoryCheck) Detect(ctx context.Context, target *input.Target) (*output.ResultEvent, error) {
+	version, err := c.scanner.JenkinsVersion(ctx, target)
+	if err != nil || version == "" {
+		return nil, err
+	}
+	if !IsAffectedVersion(version) {
+		return nil, nil
+	}
+	result := output.NewResultEvent(target)
+	result.CheckID = c.ID()
+	result.Mode = output.ModeCheck
+	result.Response = fmt.Sprintf("Jenkins %s is affected by %s (fixed in %s and LTS %s)", version, CVE202423897, fixedWeeklyVersion, fixedLTSVersion)
+	return result, nil
+}
+
+func (c *versionAdvisoryCheck) Exploit(ctx context.Context, target *input.Target, opts *ExploitOptions) (*output.ResultEvent, error) {
+	return nil, ErrExploitNotSupported
+}
+
+// maxFingerprintBodySize caps the login page bytes read when the version header is missing
+const maxFingerprintBodySize = 4096
+
+// JenkinsVersion returns the version announced by the target. The X-Jenkins header is probed
+// with HEAD first, falling back to a ranged GET of the login page when a proxy strips it
+func (s *Scanner) JenkinsVersion(ctx context.Context, target *input.Target) (string, error) {
+	ctx = egress.WithCategory(ctx, egress.Fingerprint)
+	loginURL := fmt.Sprintf("%s/login", target.ToString())
+	request, err := retryablehttp.NewRequestWithContext(ctx, "HEAD", loginURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if resp, err := s.Do(request); err == nil {
+		_ = resp.Body.Close()
+		if version := resp.Header.Get("X-Jenkins"); version != "" {
+			return version, nil
+		}
+	}
+
+	request, err = retryablehttp.NewRequestWithContext(ctx, "GET", loginURL, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=0-%d", maxFingerprintBodySize-1))
+	resp, err := s.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if version := resp.Header.Get("X-Jenkins"); version != "" {
+		return version, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFingerprintBodySize))
+	if err != nil {
+		return "", err
+	}
+	if rg := generatorRegex.FindSubmatch(body); len(rg) > 1 {
+		return string(rg[1]), nil
+	}
+	return "", nil
+}
+
+// IsAffectedVersion reports whether a Jenkins weekly (x.y) or LTS (x.y.z) version is affected by CVE-2024-23897
+func IsAffectedVersion(version string) bool {
+	v, err := semver.NewVersion(strings.TrimSpace(version))
+	if err != nil {
+		return false
+	}
+	if strings.Count(strings.TrimSpace(version), ".") >= 2 {
+		return v.LessThan(fixedLTSVersion)
+	}
+	return v.LessThan(fixedWeeklyVersion)
+}
@@ -0,0 +1,329 @@
+package scope
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// ErrExcluded is returned for targets and addresses matching the exclusion list
+	ErrExcluded = errors.New("excluded from scope")
+	// ErrOutOfScope is returned for targets and addresses not matching the scope list
+	ErrOutOfScope = errors.New("out of scope")
+)
+
+// List is a list of hostnames, wildcards such as *.prod.example.com, IPs, CIDRs and exact URLs
+type List struct {
+	hosts     map[string]struct{}
+	wildcards []string
+	networks  []*net.IPNet
+	urls      []*url.URL
+}
+
+// ParseList parses the values of a list, as given inline or read from files
+func ParseList(values []string) (*List, error) {
+	l := &List{hosts: make(map[string]struct{})}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || strings.HasPrefix(value, "#") {
+			continue
+		}
+		switch {
+		case strings.Contains(value, "://"):
+			u, err := url.Parse(value)
+			if err != nil || u.Hostname() == "" {
+				return nil, fmt.Errorf("invalid scope url %q", value)
+			}
+			l.urls = append(l.urls, normalizeURL(u))
+		case strings.Contains(value, "/"):
+			_, network, err := net.ParseCIDR(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid scope cidr %q: %w", value, err)
+			}
+			l.networks = append(l.networks, network)
+		case net.ParseIP(value) != nil:
+			ip := net.ParseIP(value)
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			l.networks = append(l.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		case strings.HasPrefix(value, "*."):
+			l.wildcards = append(l.wildcards, normalizeHost(value[1:]))
+		default:
+			if strings.Contains(value, "*") {
+				return nil, fmt.Errorf("invalid scope wildcard %q, only *.domain is supported", value)
+			}
+			l.hosts[normalizeHost(value)] = struct{}{}
+		}
+	}
+	return l, nil
+}
+
+// Empty reports whether the list has no entry
+func (l *List) Empty() bool {
+	return l == nil || len(l.hosts) == 0 && len(l.wildcards) == 0 && len(l.networks) == 0 && len(l.urls) == 0
+}
+
+// MatchName reports whether host, a hostname or an IP, matches a hostname, wildcard, IP or CIDR entry
+func (l *List) MatchName(host string) bool {
+	if l == nil {
+		return false
+	}
+	host = normalizeHost(host)
+	if ip := net.ParseIP(host); ip != nil {
+		return l.MatchIP(ip)
+	}
+	if _, ok := l.hosts[host]; ok {
+		return true
+	}
+	for _, suffix := range l.wildcards {
+		// *.example.com 不匹配 example.com 本身
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchIP reports whether ip matches an IP or CIDR entry
+func (l *List) MatchIP(ip net.IP) bool {
+	if l == nil {
+		return false
+	}
+	for _, network := range l.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchURL reports whether rawURL matches a name entry by its host, or is an exact URL entry or below it
+func (l *List) MatchURL(rawURL string) bool {
+	if l == nil {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if l.MatchName(u.Hostname()) {
+		return true
+	}
+	u = normalizeURL(u)
+	for _, entry := range l.urls {
+		if entry.Scheme == u.Scheme && entry.Host == u.Host && (entry.Path == "" || u.Path == entry.Path || strings.HasPrefix(u.Path, entry.Path+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+}
+
+// normalizeURL returns the scheme, host with its explicit port and path without trailing slash of u
+func normalizeURL(u *url.URL) *url.URL {
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if scheme == "https" {
+			port = "443"
+		}
+	}
+	return &url.URL{Scheme: scheme, Host: net.JoinHostPort(normalizeHost(u.Hostname()), port), Path: strings.TrimSuffix(u.Path, "/")}
+}
+
+// Resolver resolves the hosts dialed, net.DefaultResolver is used when nil
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// DialFunc dials a network address
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Policy allows targets not matching the exclusion list and, when a scope list is set, matching it
+type Policy struct {
+	Exclude *List
+	// Scope allows only matching targets when not empty
+	Scope    *List
+	Resolver Resolver
+
+	refused atomic.Int64
+}
+
+// NewPolicy returns the policy of the exclusion and scope values
+func NewPolicy(exclude, scope []string) (*Policy, error) {
+	excludeList, err := ParseList(exclude)
+	if err != nil {
+		return nil, err
+	}
+	scopeList, err := ParseList(scope)
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{Exclude: excludeList, Scope: scopeList}, nil
+}
+
+// Enabled reports whether the policy restricts any target
+func (p *Policy) Enabled() bool {
+	return p != nil && (!p.Exclude.Empty() || !p.Scope.Empty())
+}
+
+// Allowed returns nil when the target URL may be contacted by its name. Out of scope hostnames are
+// allowed when the scope has networks, their resolved addresses are checked at dial time
+func (p *Policy) Allowed(rawURL string) error {
+	if !p.Enabled() {
+		return nil
+	}
+	if p.Exclude.MatchURL(rawURL) {
+		return ErrExcluded
+	}
+	if p.Scope.Empty() || p.Scope.MatchURL(rawURL) {
+		return nil
+	}
+	if u, err := url.Parse(rawURL); err == nil && net.ParseIP(normalizeHost(u.Hostname())) == nil && len(p.Scope.networks) != 0 {
+		return nil
+	}
+	return ErrOutOfScope
+}
+
+// allowedAddr returns nil when ip, resolved from host, may be dialed. A host in scope by name is
+// allowed on any address which isn't excluded, any other host only on an address in scope
+func (p *Policy) allowedAddr(host string, ip net.IP) error {
+	if p.Exclude.MatchIP(ip) {
+		return ErrExcluded
+	}
+	if !p.Scope.Empty() && !p.Scope.MatchName(host) && !p.Scope.matchURLHost(host) && !p.Scope.MatchIP(ip) {
+		return ErrOutOfScope
+	}
+	return nil
+}
+
+// matchURLHost reports whether an exact URL entry is on host, its paths are checked per request
+func (l *List) matchURLHost(host string) bool {
+	host = normalizeHost(host)
+	for _, entry := range l.urls {
+		if entry.Hostname() == host {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the addresses of host which may be dialed, an error when there is none
+func (p *Policy) Resolve(ctx context.Context, host string) ([]net.IP, error) {
+	if p.Exclude.MatchName(host) {
+		p.refused.Add(1)
+		return nil, fmt.Errorf("%s: %w", host, ErrExcluded)
+	}
+	var addrs []net.IPAddr
+	if ip := net.ParseIP(normalizeHost(host)); ip != nil {
+		addrs = []net.IPAddr{{IP: ip}}
+	} else {
+		resolver := p.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		var err error
+		if addrs, err = resolver.LookupIPAddr(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+	var allowed []net.IP
+	refusedErr := ErrOutOfScope
+	for _, addr := range addrs {
+		if err := p.allowedAddr(host, addr.IP); err != nil {
+			refusedErr = err
+			continue
+		}
+		allowed = append(allowed, addr.IP)
+	}
+	if len(allowed) == 0 {
+		p.refused.Add(1)
+		return nil, fmt.Errorf("%s resolves to no address in scope: %w", host, refusedErr)
+	}
+	return allowed, nil
+}
+
+// DialContext returns dial checking the resolved addresses of every dialed host, the host is
+// resolved once and only an allowed address is dialed so a second lookup can't change it
+func (p *Policy) DialContext(dial DialFunc) DialFunc {
+	if !p.Enabled() {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("invalid port %q", port)
+		}
+		if ctx.Value(proxiedKey{}) != nil {
+			// 通过代理的请求已经在 RoundTrip 中检查, 这里拨号的是代理本身
+			return dial(ctx, network, addr)
+		}
+		ips, err := p.Resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var dialErr error
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			dialErr = err
+		}
+		return nil, dialErr
+	}
+}
+
+// Refused returns the number of dials refused because the host or all its addresses are not allowed
+func (p *Policy) Refused() int64 {
+	return p.refused.Load()
+}
+
+type proxiedKey struct{}
+
+// Transport returns a RoundTripper refusing requests to URLs which aren't allowed. Requests going
+// through a proxy, whose dials reach the proxy and not the target, have their host resolved here
+func (p *Policy) Transport(base http.RoundTripper, proxy func(*http.Request) (*url.URL, error)) http.RoundTripper {
+	if !p.Enabled() {
+		return base
+	}
+	return &scopedTransport{base: base, policy: p, proxy: proxy}
+}
+
+type scopedTransport struct {
+	base   http.RoundTripper
+	policy *Policy
+	proxy  func(*http.Request) (*url.URL, error)
+}
+
+func (t *scopedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.Allowed(req.URL.String()); err != nil {
+		return nil, fmt.Errorf("%s: %w", req.URL.Redacted(), err)
+	}
+	if t.proxy != nil {
+		if proxyURL, err := t.proxy(req); err == nil && proxyURL != nil {
+			// 代理可能解析出不同的地址, 这是尽力而为的检查
+			if _, err := t.policy.Resolve(req.Context(), req.URL.Hostname()); err != nil {
+				return nil, err
+			}
+			req = req.WithContext(context.WithValue(req.Context(), proxiedKey{}, true))
+		}
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,168 @@
+package scope
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestPolicyAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		exclude []string
+		scope   []string
+		url     string
+		want    error
+	}{
+		{name: "no lists", url: "http://jenkins.example.com"},
+		{name: "excluded host", exclude: []string{"Jenkins.Example.com."}, url: "http://jenkins.example.com:8080", want: ErrExcluded},
+		{name: "excluded wildcard", exclude: []string{"*.prod.example.com"}, url: "https://ci.prod.example.com", want: ErrExcluded},
+		{name: "wildcard parent allowed", exclude: []string{"*.prod.example.com"}, url: "https://prod.example.com"},
+		{name: "excluded cidr", exclude: []string{"10.0.0.0/8"}, url: "http://10.1.2.3:8080", want: ErrExcluded},
+		{name: "excluded ipv6", exclude: []string{"::1"}, url: "http://[::1]:8080", want: ErrExcluded},
+		{name: "excluded url", exclude: []string{"https://ci.example.com/jenkins/"}, url: "https://ci.example.com:443/jenkins/cli", want: ErrExcluded},
+		{name: "url other path allowed", exclude: []string{"https://ci.example.com/jenkins"}, url: "https://ci.example.com/jenkins2"},
+		{name: "url other scheme allowed", exclude: []string{"https://ci.example.com"}, url: "http://ci.example.com"},
+		{name: "in scope", scope: []string{"*.example.com"}, url: "http://ci.example.com"},
+		{name: "out of scope", scope: []string{"*.example.com"}, url: "http://ci.example.org", want: ErrOutOfScope},
+		{name: "out of scope ip", scope: []string{"192.168.0.0/16"}, url: "http://10.0.0.1", want: ErrOutOfScope},
+		{name: "hostname checked at dial", scope: []string{"192.168.0.0/16"}, url: "http://ci.example.org"},
+		{name: "excluded wins over scope", exclude: []string{"ci.example.com"}, scope: []string{"*.example.com"}, url: "http://ci.example.com", want: ErrExcluded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := NewPolicy(test.exclude, test.scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := policy.Allowed(test.url); !errors.Is(err, test.want) || (err == nil) != (test.want == nil) {
+				t.Errorf("Allowed(%q) = %v, want %v", test.url, err, test.want)
+			}
+		})
+	}
+}
+
+func TestParseListInvalid(t *testing.T) {
+	for _, value := range []string{"10.0.0.0/33", "ci.*.example.com", "http://"} {
+		if _, err := ParseList([]string{value}); err == nil {
+			t.Errorf("ParseList(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	var addrs []net.IPAddr
+	for _, ip := range r[host] {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func TestDialContextChecksResolvedAddresses(t *testing.T) {
+	resolver := fakeResolver{
+		"rebind.example.com": {"10.0.0.5"},
+		"mixed.example.com":  {"10.0.0.6", "203.0.113.7"},
+		"public.example.com": {"203.0.113.8"},
+		"ci.example.com":     {"198.51.100.1"},
+	}
+	tests := []struct {
+		name    string
+		exclude []string
+		scope   []string
+		addr    string
+		dialed  []string
+		want    error
+	}{
+		{name: "dns pointing to excluded range", exclude: []string{"10.0.0.0/8"}, addr: "rebind.example.com:8080", want: ErrExcluded},
+		{name: "only allowed address dialed", exclude: []string{"10.0.0.0/8"}, addr: "mixed.example.com:8080", dialed: []string{"203.0.113.7:8080"}},
+		{name: "allowed", exclude: []string{"10.0.0.0/8"}, addr: "public.example.com:443", dialed: []string{"203.0.113.8:443"}},
+		{name: "excluded name", exclude: []string{"public.example.com"}, addr: "public.example.com:443", want: ErrExcluded},
+		{name: "scope by address", scope: []string{"203.0.113.0/24"}, addr: "public.example.com:443", dialed: []string{"203.0.113.8:443"}},
+		{name: "out of scope address", scope: []string{"203.0.113.0/24"}, addr: "ci.example.com:443", want: ErrOutOfScope},
+		{name: "scope by name", scope: []string{"ci.example.com"}, addr: "ci.example.com:443", dialed: []string{"198.51.100.1:443"}},
+		{name: "scope by name excluded address", exclude: []string{"198.51.100.0/24"}, scope: []string{"ci.example.com"}, addr: "ci.example.com:443", want: ErrExcluded},
+		{name: "ip literal", exclude: []string{"10.0.0.0/8"}, addr: "10.0.0.1:80", want: ErrExcluded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := NewPolicy(test.exclude, test.scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			policy.Resolver = resolver
+			var dialed []string
+			dial := policy.DialContext(func(_ context.Context, _, addr string) (net.Conn, error) {
+				dialed = append(dialed, addr)
+				client, server := net.Pipe()
+				_ = server.Close()
+				return client, nil
+			})
+			conn, err := dial(context.Background(), "tcp", test.addr)
+			if conn != nil {
+				_ = conn.Close()
+			}
+			if !errors.Is(err, test.want) || (err == nil) != (test.want == nil) {
+				t.Fatalf("dial(%q) = %v, want %v", test.addr, err, test.want)
+			}
+			if len(dialed) != len(test.dialed) || len(dialed) != 0 && dialed[0] != test.dialed[0] {
+				t.Errorf("dialed %v, want %v", dialed, test.dialed)
+			}
+			if refused := policy.Refused(); (refused != 0) != (test.want != nil) {
+				t.Errorf("Refused() = %d", refused)
+			}
+		})
+	}
+}
+
+type recordingTransport struct {
+	requests []*http.Request
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestTransport(t *testing.T) {
+	policy, err := NewPolicy([]string{"10.0.0.0/8", "https://ci.example.com/secret"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.Resolver = fakeResolver{"rebind.example.com": {"10.0.0.5"}, "ci.example.com": {"203.0.113.1"}}
+	proxyURL, _ := url.Parse("http://10.0.0.1:3128")
+	proxy := func(req *http.Request) (*url.URL, error) { return proxyURL, nil }
+	base := &recordingTransport{}
+	transport := policy.Transport(base, proxy)
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{url: "https://ci.example.com/secret/cli", want: ErrExcluded},
+		{url: "http://10.1.1.1/cli", want: ErrExcluded},
+		// 通过代理时目标的解析地址也会被检查
+		{url: "http://rebind.example.com/cli", want: ErrExcluded},
+		{url: "https://ci.example.com/cli"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodGet, test.url, nil)
+		_, err := transport.RoundTrip(req)
+		if !errors.Is(err, test.want) || (err == nil) != (test.want == nil) {
+			t.Errorf("RoundTrip(%q) = %v, want %v", test.url, err, test.want)
+		}
+	}
+	if len(base.requests) != 1 {
+		t.Fatalf("%d requests reached the base transport, want 1", len(base.requests))
+	}
+	// 代理本身在排除范围内, 拨号时不能被拒绝
+	if base.requests[0].Context().Value(proxiedKey{}) == nil {
+		t.Error("proxied request not marked, its dial to the proxy would be checked against the target policy")
+	}
+}
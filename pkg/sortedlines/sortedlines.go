@@ -0,0 +1,179 @@
+package sortedlines
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// DefaultMemoryLimit is the default number of bytes buffered in memory before spilling to a temporary file
+const DefaultMemoryLimit = 64 * 1024 * 1024
+
+// line is a buffered line and the key it's sorted by
+type line struct {
+	Key  string `json:"k"`
+	Data string `json:"d"`
+}
+
+func less(a, b line) bool {
+	if a.Key != b.Key {
+		return a.Key < b.Key
+	}
+	// 相同 key 按内容排序, 保证输出与并发顺序无关
+	return a.Data < b.Data
+}
+
+// Writer buffers lines and writes them sorted by key on Close. Once the buffered lines exceed the
+// memory limit they are sorted and spilled to a temporary file, the files are merged on Close
+type Writer struct {
+	w     io.Writer
+	limit int
+	size  int
+	lines []line
+	runs  []*os.File
+}
+
+// NewWriter returns a writer of the sorted lines to w buffering up to limit bytes in memory,
+// zero uses DefaultMemoryLimit
+func NewWriter(w io.Writer, limit int) *Writer {
+	if limit <= 0 {
+		limit = DefaultMemoryLimit
+	}
+	return &Writer{w: w, limit: limit}
+}
+
+// Add buffers data, which must not contain a newline, to be written at the position of key
+func (s *Writer) Add(key string, data []byte) error {
+	s.lines = append(s.lines, line{Key: key, Data: string(data)})
+	s.size += len(key) + len(data)
+	if s.size >= s.limit {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill writes the buffered lines sorted to a temporary file
+func (s *Writer) spill() error {
+	sort.Slice(s.lines, func(i, j int) bool { return less(s.lines[i], s.lines[j]) })
+	file, err := os.CreateTemp("", "cve-2024-23897-sorted-*")
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not create temporary file of sorted output")
+	}
+	s.runs = append(s.runs, file)
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, l := range s.lines {
+		if err := encoder.Encode(l); err != nil {
+			return errorutil.NewWithErr(err).Msgf("could not spill sorted output to %v", file.Name())
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return errorutil.NewWithErr(err).Msgf("could not spill sorted output to %v", file.Name())
+	}
+	s.lines, s.size = nil, 0
+	return nil
+}
+
+// Spilled returns the number of temporary files written so far
+func (s *Writer) Spilled() int {
+	return len(s.runs)
+}
+
+// Close writes every line sorted and removes the temporary files
+func (s *Writer) Close() error {
+	defer s.cleanup()
+	if len(s.runs) != 0 && len(s.lines) != 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	writer := bufio.NewWriter(s.w)
+	if len(s.runs) == 0 {
+		sort.Slice(s.lines, func(i, j int) bool { return less(s.lines[i], s.lines[j]) })
+		for _, l := range s.lines {
+			if _, err := writer.WriteString(l.Data + "\n"); err != nil {
+				return err
+			}
+		}
+		return writer.Flush()
+	}
+	if err := s.merge(writer); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// merge writes the lines of the sorted temporary files in order
+func (s *Writer) merge(w *bufio.Writer) error {
+	var cursors mergeHeap
+	for _, file := range s.runs {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		c := &cursor{decoder: json.NewDecoder(bufio.NewReader(file))}
+		if ok, err := c.next(); err != nil {
+			return errorutil.NewWithErr(err).Msgf("could not read sorted output from %v", file.Name())
+		} else if ok {
+			cursors = append(cursors, c)
+		}
+	}
+	heap.Init(&cursors)
+	for cursors.Len() > 0 {
+		c := cursors[0]
+		if _, err := w.WriteString(c.line.Data + "\n"); err != nil {
+			return err
+		}
+		ok, err := c.next()
+		if err != nil {
+			return errorutil.NewWithErr(err).Msgf("could not read sorted output")
+		}
+		if ok {
+			heap.Fix(&cursors, 0)
+		} else {
+			heap.Pop(&cursors)
+		}
+	}
+	return nil
+}
+
+func (s *Writer) cleanup() {
+	for _, file := range s.runs {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}
+	s.runs, s.lines = nil, nil
+}
+
+// cursor is the current line of a temporary file
+type cursor struct {
+	decoder *json.Decoder
+	line    line
+}
+
+func (c *cursor) next() (bool, error) {
+	if err := c.decoder.Decode(&c.line); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+type mergeHeap []*cursor
+
+func (h mergeHeap) Len() int            { return len(h) }
+func (h mergeHeap) Less(i, j int) bool  { return less(h[i].line, h[j].line) }
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*cursor)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,83 @@
+package sortedlines
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var want []string
+	var lines []string
+	for i := 0; i < 200; i++ {
+		line := fmt.Sprintf(`{"url":"http://host-%03d.example.com","n":%d}`, i/2, i%2)
+		want = append(want, line)
+		lines = append(lines, line)
+	}
+	tests := []struct {
+		name    string
+		limit   int
+		spilled bool
+	}{
+		{name: "memory", limit: 0},
+		{name: "spilled", limit: 512, spilled: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shuffled := append([]string(nil), lines...)
+			rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			var out bytes.Buffer
+			w := NewWriter(&out, test.limit)
+			for _, line := range shuffled {
+				// key 只包含目标, 相同目标的行按内容排序
+				key := strings.Split(line, `"`)[3]
+				if err := w.Add(key, []byte(line)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if spilled := w.Spilled() > 0; spilled != test.spilled {
+				t.Errorf("Spilled() = %d, want spilled %v", w.Spilled(), test.spilled)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("Close() wrote %d lines out of order, first %q", len(got), got[0])
+			}
+			if w.Spilled() != 0 {
+				t.Errorf("Spilled() = %d after Close, want temporary files removed", w.Spilled())
+			}
+		})
+	}
+}
+
+func TestWriterRemovesTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	w := NewWriter(&bytes.Buffer{}, 16)
+	for i := 0; i < 10; i++ {
+		if err := w.Add(fmt.Sprint(i), []byte("0123456789abcdef")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) == 0 {
+		t.Fatal("no temporary file was spilled")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("temporary files left after Close: %v", files)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var out bytes.Buffer
+	if err := NewWriter(&out, 0).Close(); err != nil || out.Len() != 0 {
+		t.Errorf("Close() = %v wrote %q, want nothing", err, out.String())
+	}
+}
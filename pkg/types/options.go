@@ -6,9 +6,33 @@ import (
 )
 
 type Options struct {
-	URL                   goflags.StringSlice
-	ListURL               goflags.StringSlice
+	URL     goflags.StringSlice
+	ListURL goflags.StringSlice
+	// Watch is the file or named pipe tailed for new targets until the process is stopped
+	Watch string
+	// WatchPoll polls the watched file instead of waiting for file system notifications
+	WatchPoll bool
+	// WatchState records the targets scanned in watch mode, they are skipped when resuming
+	WatchState string
+	// ExpectTargets are the targets the detection must conclusively evaluate
+	ExpectTargets goflags.StringSlice
+	// Strict fails the run when an expected target is unreachable, inconclusive or not jenkins
+	Strict bool
+	// Baseline is the file of the expected verdicts per target, the run fails on deviations from it
+	Baseline string
+	// WriteBaseline is the file the verdicts of the run are written to as a baseline
+	WriteBaseline string
+	// Compliance is the file the deviations from the baseline are written to as JSON
+	Compliance string
+	// InputPreviousInconclusive is a results file of a previous run whose inconclusive targets are scanned again
+	InputPreviousInconclusive string
+	// Exclude are the hostnames, wildcards, CIDRs and URLs never contacted
+	Exclude goflags.StringSlice
+	// Scope, when set, are the only hostnames, wildcards, CIDRs and URLs contacted
+	Scope                 goflags.StringSlice
+	ShowExcluded          bool
 	Command               goflags.StringSlice
+	Checks                goflags.StringSlice
 	Args                  goflags.StringSlice
 	ProxyURL              goflags.StringSlice
 	NoColor               bool
@@ -17,22 +41,114 @@ type Options struct {
 	DisableStdin          bool
 	RateLimit             int
 	Thread                int
-	InputReadTimeout      time.Duration
-	Headers               goflags.StringSlice
-	Stdin                 bool
-	Timeout               int
-	Exec                  bool
-	DisableUpdateCheck    bool
+	// MaxEgress is the byte budget of the run, zero is unlimited
+	MaxEgress goflags.Size
+	// NoPreflight skips the checks of the environment before the scan
+	NoPreflight bool
+	// Force starts the scan even when pre-flight checks failed
+	Force bool
+	// AutoThreads adapts the concurrency between AutoThreadsMin and Thread to the error rate
+	AutoThreads      bool
+	AutoThreadsMin   int
+	InputReadTimeout time.Duration
+	Headers          goflags.StringSlice
+	// Auth are the user:token credentials used on targets refusing anonymous users
+	Auth string
+	// Credentials select the provider of credentials as name=provider
+	Credentials        goflags.StringSlice
+	Stdin              bool
+	Timeout            int
+	Exec               bool
+	DisableUpdateCheck bool
+	Update             bool
+	ConfirmBreaking    bool
+	NoCache            bool
+	// NoUpdateCache asks github for the latest version on every run instead of reusing the last version check
+	NoUpdateCache bool
+	// RolloutPercent is the percentage of machines updated by -update, negative uses the rollout of the release
+	RolloutPercent int
+	ForceUpdate    bool
+	// UpdateVersion is the release tag installed by the update instead of the latest one
+	UpdateVersion string
+	// VersionCheck prints the latest release compared with the current version, as JSON with JSON
+	VersionCheck bool
+	JSON         bool
+	// UpdateFromFile is a release asset on disk applied instead of downloading the update
+	UpdateFromFile string
+	// UpdateDryRun prints what the update would do without applying it
+	UpdateDryRun bool
+	// UpdatePrerelease makes the pre-releases candidates of the update checks and of the update
+	UpdatePrerelease bool
+	// UpdateProxy is the http, https or socks5 proxy of the update checks and downloads
+	UpdateProxy string
+	// UpdateCA is a PEM bundle of CAs trusted for the update hosts in addition to the system roots
+	UpdateCA          string
+	UpdateInsecureTLS bool
+	NoMachineID       bool
+	// ReportLang is the language of the static strings of the human-readable report
+	ReportLang string
+	// TimestampEvidence is the URL of the RFC 3161 timestamp authority timestamping the evidence hashes
+	TimestampEvidence string
+	SelfTest          bool
+	// DryRun walks the pipeline without sending any request to the targets and prints the plan
+	DryRun bool
+	// Ledger is the findings ledger file, findings already in it are only reported again when they change
+	Ledger          string
+	AlertAlways     bool
+	LedgerPruneDays int
+	Webhook         string
+	NoRedact        bool
+	// Workdir holds a timestamped directory with the artifacts of every run
+	Workdir string
+	// retention policy of the runs of the workdir in days, applied when the run ends, 0 disables a limit
+	RedactAfterDays int
+	LootMaxDays     int
+	EvidenceMaxDays int
+	// Results is the file the findings are written to as JSON lines
+	Results string
+	// Sorted writes the results file sorted by target at the end of the run instead of streaming it
+	Sorted bool
+	// FlatResults writes one record per read file as before schema version 3
+	FlatResults bool
+	// Sarif is the file the SARIF log of the findings is written to
+	Sarif string
+	// NoIntraRunCache tests every alias of a backend already found patched or not jenkins
+	NoIntraRunCache bool
+	// Presets are named lists of files to read, expanded into Args
+	Presets goflags.StringSlice
+	// VariantPresets are the selected presets with os variants, their files are chosen per target
+	VariantPresets []string
+	// AutoLoot reads the Args and preset files of the targets the detection finds vulnerable
+	AutoLoot bool
+	// LootThreads are the workers looting the vulnerable targets, besides the Thread workers of the detection
+	LootThreads int
+	// LootRateLimit is the requests per second of the looting, negative uses RateLimit as a separate budget
+	LootRateLimit int
+	// StreamLoot writes the detection record of a looted target at once and its files as a second record,
+	// instead of one record once the target is looted
+	StreamLoot bool
+	// MaxChunkRequests is the number of follow-up reads of a leaked file which looks truncated
+	MaxChunkRequests int
+	// thresholds of the leaked content interest heuristics, zero values use the defaults
+	InterestSmallSize       int
+	InterestEntropy         float64
+	InterestPrintable       int
+	InterestKeyValueDensity int
 }
 
 func (opt *Options) IsCheckMode() bool {
-	return !opt.ListAvailableCommands && len(opt.Command) == 0 && len(opt.Args) == 0 && !opt.Exec
+	return !opt.ListAvailableCommands && !opt.Exec && (opt.AutoLoot || len(opt.Command) == 0 && !opt.HasFiles())
+}
+
+// HasFiles reports whether files are read, given as args or os variant presets
+func (opt *Options) HasFiles() bool {
+	return len(opt.Args) != 0 || len(opt.VariantPresets) != 0
 }
 func (opt *Options) IsListAvailableCommands() bool {
 	return opt.ListAvailableCommands && !opt.Exec
 }
 func (opt *Options) IsReadMode() bool {
-	return len(opt.Command) != 0 && len(opt.Args) != 0 && !opt.ListAvailableCommands && !opt.Exec
+	return len(opt.Command) != 0 && opt.HasFiles() && !opt.ListAvailableCommands && !opt.Exec && !opt.AutoLoot
 }
 func (opt *Options) IsExecMode() bool {
 	return opt.Exec && !opt.ListAvailableCommands
@@ -0,0 +1,171 @@
+package updateutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"github.com/ulikunitz/xz"
+)
+
+// MaxDecompressedSize is the maximum number of bytes unpacked from an asset, archives inflating to more
+// are refused as decompression bombs. Zero or negative disables the limit
+var MaxDecompressedSize int64 = 1 << 30
+
+// ErrDecompressedSizeExceeded is returned when an asset unpacks to more than MaxDecompressedSize, matched
+// with errors.Is
+var ErrDecompressedSizeExceeded = errorutil.NewWithTag("unpack", "decompressed size limit exceeded")
+
+// magic bytes of the compressions and archives of the assets
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte("PK\x03\x04")
+	tarMagic  = []byte("ustar")
+)
+
+// tarMagicOffset is the offset of the magic of the header of posix and gnu tar archives
+const tarMagicOffset = 257
+
+// sizeLimiter fails the reads once more than remaining bytes were read, it is shared by the entries of an archive
+type sizeLimiter struct {
+	remaining atomic.Int64
+}
+
+// newSizeLimiter returns the limiter of an archive allowing MaxDecompressedSize bytes
+func newSizeLimiter() *sizeLimiter {
+	l := &sizeLimiter{}
+	l.remaining.Store(MaxDecompressedSize)
+	return l
+}
+
+// reader returns r counting against the limit, r itself when the limit is disabled
+func (l *sizeLimiter) reader(r io.Reader) io.Reader {
+	if MaxDecompressedSize <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, limiter: l}
+}
+
+type limitedReader struct {
+	r       io.Reader
+	limiter *sizeLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.limiter.remaining.Add(-int64(n)) < 0 {
+		return n, newUpdateError(ErrDecompressedSizeExceeded, "asset unpacks to more than %d bytes", MaxDecompressedSize)
+	}
+	return n, err
+}
+
+// decompress returns the reader of data decompressed per its magic bytes, gzip, xz or zstd, nil when
+// data isn't compressed
+func decompress(data []byte) (io.ReadCloser, error) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return gzip.NewReader(bytes.NewReader(data))
+	case bytes.HasPrefix(data, xzMagic):
+		reader, err := xz.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(reader), nil
+	case bytes.HasPrefix(data, zstdMagic):
+		decoder, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, nil
+}
+
+// unpackAsset calls callback with the files of the asset data. The compression, gzip, xz or zstd, and
+// the archive, zip or tar, are detected by their magic bytes as the asset names and content types are
+// not reliable. Data which is not an archive is a single file named rawName, an error when rawName is empty
+func unpackAsset(ctx context.Context, rawName string, data []byte, callback AssetFileCallback) error {
+	// 只限制解压产生的数据: 压缩流和 zip 中的文件
+	limiter := newSizeLimiter()
+	reader, err := decompress(data)
+	if err != nil {
+		return err
+	}
+	decompressed := data
+	if reader != nil {
+		decompressed, err = io.ReadAll(limiter.reader(reader))
+		_ = reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case bytes.HasPrefix(decompressed, zipMagic):
+		zipReader, err := zip.NewReader(bytes.NewReader(decompressed), int64(len(decompressed)))
+		if err != nil {
+			return err
+		}
+		for _, f := range zipReader.File {
+			if err := contextError(ctx, "unpacking cancelled before %v", f.Name); err != nil {
+				return err
+			}
+			data, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = callback(f.Name, f.FileInfo(), limiter.reader(data))
+			_ = data.Close()
+			if err != nil {
+				return err
+			}
+		}
+	case len(decompressed) > tarMagicOffset+len(tarMagic) && bytes.Equal(decompressed[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic):
+		tarReader := tar.NewReader(bytes.NewReader(decompressed))
+		// iterate through the files in the archive
+		for {
+			if err := contextError(ctx, "unpacking cancelled"); err != nil {
+				return err
+			}
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := callback(header.Name, header.FileInfo(), tarReader); err != nil {
+				return err
+			}
+		}
+	default:
+		// 单个可执行文件, 可能经过压缩
+		if rawName == "" {
+			return errorutil.NewWithTag("unpack", "not a zip or tar archive")
+		}
+		return callback(rawName, &rawFileInfo{name: rawName, size: int64(len(decompressed))}, bytes.NewReader(decompressed))
+	}
+	return nil
+}
+
+// rawFileInfo is the file info of an asset which is not an archive
+type rawFileInfo struct {
+	name string
+	size int64
+}
+
+func (f *rawFileInfo) Name() string       { return f.name }
+func (f *rawFileInfo) Size() int64        { return f.size }
+func (f *rawFileInfo) Mode() fs.FileMode  { return 0755 }
+func (f *rawFileInfo) ModTime() time.Time { return time.Time{} }
+func (f *rawFileInfo) IsDir() bool        { return false }
+func (f *rawFileInfo) Sys() any           { return nil }
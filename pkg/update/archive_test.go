@@ -0,0 +1,145 @@
+package updateutils
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"runtime"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// tarArchive returns an uncompressed tar archive of files
+func tarArchive(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// xzCompress returns data compressed with xz
+func xzCompress(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zstdCompress returns data compressed with zstd
+func zstdCompress(t *testing.T, data []byte) []byte {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+	return encoder.EncodeAll(data, nil)
+}
+
+func TestUnpackAsset(t *testing.T) {
+	name := executableFileName("jaudit", runtime.GOOS)
+	bin := []byte("\x7fELF fake jaudit binary")
+	files := map[string][]byte{name: bin, "LICENSE": []byte("MIT")}
+	tests := []struct {
+		format string
+		asset  []byte
+	}{
+		{format: "zip", asset: zipArchive(t, files)},
+		{format: "tar.gz", asset: tarGz(t, files)},
+		{format: "tar.xz", asset: xzCompress(t, tarArchive(t, files))},
+		{format: "tar.zst", asset: zstdCompress(t, tarArchive(t, files))},
+		{format: "tar", asset: tarArchive(t, files)},
+		{format: "binary", asset: bin},
+		{format: "binary.xz", asset: xzCompress(t, bin)},
+		{format: "binary.zst", asset: zstdCompress(t, bin)},
+	}
+	for _, test := range tests {
+		var entries []archiveEntry
+		err := unpackAsset(context.Background(), "jaudit", test.asset, func(path string, info fs.FileInfo, data io.Reader) error {
+			content, err := io.ReadAll(data)
+			entries = append(entries, archiveEntry{path: path, data: content})
+			return err
+		})
+		if err != nil {
+			t.Errorf("unpackAsset() of %v = %v", test.format, err)
+			continue
+		}
+		entry, err := selectExecutable(entries, "jaudit")
+		if err != nil || !bytes.Equal(entry.data, bin) {
+			t.Errorf("executable of %v = %v, %v, want the binary", test.format, entry, err)
+		}
+	}
+}
+
+func TestUnpackAssetSizeLimit(t *testing.T) {
+	limit := MaxDecompressedSize
+	MaxDecompressedSize = 64 << 10
+	defer func() { MaxDecompressedSize = limit }()
+	// 1MB 的零字节压缩后只有几 KB
+	bomb := map[string][]byte{"jaudit": make([]byte, 1<<20)}
+	assets := map[string][]byte{
+		"zip":     zipArchive(t, bomb),
+		"tar.gz":  tarGz(t, bomb),
+		"tar.xz":  xzCompress(t, tarArchive(t, bomb)),
+		"tar.zst": zstdCompress(t, tarArchive(t, bomb)),
+	}
+	for format, asset := range assets {
+		err := unpackAsset(context.Background(), "jaudit", asset, func(path string, info fs.FileInfo, data io.Reader) error {
+			_, err := io.ReadAll(data)
+			return err
+		})
+		if !errors.Is(err, ErrDecompressedSizeExceeded) {
+			t.Errorf("unpackAsset() of a %v bomb = %v, want %v", format, err, ErrDecompressedSizeExceeded)
+		}
+	}
+	// 未压缩的资源不受限制
+	if err := unpackAsset(context.Background(), "jaudit", tarArchive(t, bomb), func(string, fs.FileInfo, io.Reader) error { return nil }); err != nil {
+		t.Errorf("unpackAsset() of an uncompressed tar = %v", err)
+	}
+}
+
+func TestGetExecutableFromCompressedAsset(t *testing.T) {
+	hideProgressBar(t)
+	// 资源没有校验和文件
+	SkipCheckSumValidation = true
+	defer func() { SkipCheckSumValidation = false }()
+	bin := []byte("jaudit binary")
+	archive := tarArchive(t, map[string][]byte{"jaudit": bin})
+	for format, asset := range map[AssetFormat][]byte{TarXz: xzCompress(t, archive), TarZstd: zstdCompress(t, archive)} {
+		fake := newFakeGitHub(t)
+		fake.AddRelease(Organization+"/jaudit", &fakeRelease{Tag: "v1.0.0", Assets: map[string][]byte{
+			platformAssetName("jaudit", "v1.0.0", format): asset,
+		}})
+		d, err := NewghReleaseDownloader("jaudit")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.cache = nil
+		got, err := d.GetExecutableFromAsset()
+		if err != nil || !bytes.Equal(got, bin) {
+			t.Errorf("GetExecutableFromAsset() of %v = %q, %v", format.FileExtension(), got, err)
+		}
+	}
+}
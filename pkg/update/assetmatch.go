@@ -0,0 +1,158 @@
+package updateutils
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v30/github"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// DefaultAssetPattern is the name of the release asset of the platform without its extension, as published
+// by the releases of this repo
+const DefaultAssetPattern = "{{.Tool}}_{{.Version}}_{{.OS}}_{{.Arch}}{{if .Variant}}_{{.Variant}}{{end}}"
+
+// AssetVariant is appended to the name of the release asset of the platform, e.g. musl for
+// tool_1.0.0_linux_amd64_musl.tar.gz. Empty matches the assets without variant
+var AssetVariant = ""
+
+// assetNameData is the data of the asset pattern templates
+type assetNameData struct {
+	Tool    string // asset base name
+	Version string // tag without the v prefix
+	Tag     string
+	OS      string
+	Arch    string
+	Variant string
+}
+
+// osAliases and archAliases are the names of GOOS and GOARCH in asset names, the preferred ones first
+var (
+	osAliases = map[string][]string{
+		"darwin": {"macOS", "darwin"},
+	}
+	archAliases = map[string][]string{
+		"amd64": {"amd64", "x86_64"},
+		"arm64": {"arm64", "aarch64"},
+		"386":   {"386", "i386", "x86"},
+		"arm":   {"arm", "armv7", "armv6"},
+	}
+)
+
+// aliases returns the names of value in asset names, value itself when it has no alias
+func aliases(names map[string][]string, value string) []string {
+	if alias, ok := names[value]; ok {
+		return alias
+	}
+	return []string{value}
+}
+
+// SetAssetPattern sets the text/template of the name of the release asset of the platform, with the fields
+// Tool, Version (the tag without v), Tag, OS, Arch and Variant, e.g. "{{.Tool}}_{{.Version}}_{{.OS}}_{{.Arch}}.zip".
+// When the pattern has no archive extension the archives are tried, then the executable itself. Empty
+// restores DefaultAssetPattern
+func (d *GHReleaseDownloader) SetAssetPattern(pattern string) error {
+	if pattern == "" {
+		d.assetPattern = nil
+		return nil
+	}
+	parsed, err := template.New("asset").Parse(pattern)
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("invalid asset pattern %v", pattern)
+	}
+	// 提前发现引用了不存在字段的模板
+	if err := parsed.Execute(&bytes.Buffer{}, assetNameData{}); err != nil {
+		return errorutil.NewWithErr(err).Msgf("invalid asset pattern %v", pattern)
+	}
+	d.assetPattern = parsed
+	return nil
+}
+
+// archiveFormats are the extensions tried in order when the asset pattern has none
+var archiveFormats = []AssetFormat{Zip, Tar, TarXz, TarZstd}
+
+// assetCandidate is a name of the release asset of the platform and its format
+type assetCandidate struct {
+	name   string
+	format AssetFormat
+}
+
+// assetCandidates returns the names of the release asset of the platform goos/goarch for tag, the exact
+// names of GOOS and GOARCH before their aliases
+func (d *GHReleaseDownloader) assetCandidates(tag, goos, goarch string) ([]assetCandidate, error) {
+	pattern := d.assetPattern
+	if pattern == nil {
+		pattern = template.Must(template.New("asset").Parse(DefaultAssetPattern))
+	}
+	var candidates []assetCandidate
+	for _, osName := range aliases(osAliases, goos) {
+		for _, archName := range aliases(archAliases, goarch) {
+			buffer := &bytes.Buffer{}
+			data := assetNameData{Tool: d.assetName, Version: strings.TrimPrefix(tag, "v"), Tag: tag, OS: osName, Arch: archName, Variant: AssetVariant}
+			if err := pattern.Execute(buffer, data); err != nil {
+				return nil, errorutil.NewWithErr(err).Msgf("could not build the asset name")
+			}
+			name := buffer.String()
+			if format := IdentifyAssetFormat(strings.ToLower(name)); format != Unknown {
+				candidates = append(candidates, assetCandidate{name: name, format: format})
+				continue
+			}
+			for _, format := range archiveFormats {
+				candidates = append(candidates, assetCandidate{name: name + format.FileExtension(), format: format})
+			}
+			// 未打包的可执行文件, 可能经过压缩
+			raw := name
+			if goos == "windows" && !strings.HasSuffix(strings.ToLower(raw), extIfFound) {
+				raw += extIfFound
+			}
+			candidates = append(candidates, assetCandidate{name: raw + ".zst", format: Binary}, assetCandidate{name: raw + ".xz", format: Binary}, assetCandidate{name: raw, format: Binary})
+		}
+	}
+	return candidates, nil
+}
+
+// matchAsset returns the asset of release best matching candidates and the number of matching assets
+func matchAsset(release *github.RepositoryRelease, candidates []assetCandidate) (*github.ReleaseAsset, AssetFormat, int) {
+	var (
+		chosen  *github.ReleaseAsset
+		format  AssetFormat
+		rank    = len(candidates)
+		matches int
+	)
+	for _, asset := range release.Assets {
+		for i, candidate := range candidates {
+			if !strings.EqualFold(asset.GetName(), candidate.name) {
+				continue
+			}
+			matches++
+			// 优先与 GOOS/GOARCH 完全一致的名称, 其次是别名
+			if i < rank || (i == rank && asset.GetName() == candidate.name) {
+				chosen, format, rank = asset, candidate.format, i
+			}
+			break
+		}
+	}
+	return chosen, format, matches
+}
+
+// getToolAssetID tries to find assetId of tool required for this platform
+func (d *GHReleaseDownloader) getToolAssetID(latest *github.RepositoryRelease) error {
+	candidates, err := d.assetCandidates(d.Latest.GetTagName(), runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+	asset, format, matches := matchAsset(latest, candidates)
+	// handle if id is zero (no asset found)
+	if asset == nil || asset.GetID() == 0 {
+		return ErrNoAssetFound.Msgf(runtime.GOOS, runtime.GOARCH)
+	}
+	if matches > 1 {
+		updateLog.Info().Label("updater").Msgf("%d release assets match %v/%v, using %v", matches, runtime.GOOS, runtime.GOARCH, asset.GetName())
+	}
+	d.AssetID = int(asset.GetID())
+	d.Format = format
+	d.fullAssetName = asset.GetName()
+	return nil
+}
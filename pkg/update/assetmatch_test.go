@@ -0,0 +1,77 @@
+package updateutils
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v30/github"
+)
+
+func TestMatchAsset(t *testing.T) {
+	// goreleaser 默认命名, 以及额外发布的 musl 与自定义命名资源
+	names := []string{
+		"jaudit_1.4.0_Linux_x86_64.tar.gz",
+		"jaudit_1.4.0_Linux_arm64.tar.gz",
+		"jaudit_1.4.0_Linux_aarch64.tar.gz",
+		"jaudit_1.4.0_Linux_armv7.tar.gz",
+		"jaudit_1.4.0_Linux_i386.tar.gz",
+		"jaudit_1.4.0_Darwin_x86_64.tar.gz",
+		"jaudit_1.4.0_Darwin_arm64.tar.gz",
+		"jaudit_1.4.0_Windows_x86_64.zip",
+		"jaudit_1.4.0_linux_amd64_musl.tar.gz",
+		"jaudit-v1.4.0-linux-amd64.zip",
+		"jaudit_1.4.0_checksums.txt",
+	}
+	release := &github.RepositoryRelease{TagName: github.String("v1.4.0")}
+	for i, name := range names {
+		release.Assets = append(release.Assets, &github.ReleaseAsset{ID: github.Int64(int64(i + 1)), Name: github.String(name)})
+	}
+	tests := []struct {
+		goos        string
+		goarch      string
+		variant     string
+		pattern     string
+		want        string
+		wantFormat  AssetFormat
+		wantMatches int
+	}{
+		{goos: "linux", goarch: "amd64", want: "jaudit_1.4.0_Linux_x86_64.tar.gz", wantFormat: Tar, wantMatches: 1},
+		{goos: "linux", goarch: "amd64", variant: "musl", want: "jaudit_1.4.0_linux_amd64_musl.tar.gz", wantFormat: Tar, wantMatches: 1},
+		// arm64 与 aarch64 都匹配时优先完全一致的名称
+		{goos: "linux", goarch: "arm64", want: "jaudit_1.4.0_Linux_arm64.tar.gz", wantFormat: Tar, wantMatches: 2},
+		{goos: "linux", goarch: "arm", want: "jaudit_1.4.0_Linux_armv7.tar.gz", wantFormat: Tar, wantMatches: 1},
+		{goos: "linux", goarch: "386", want: "jaudit_1.4.0_Linux_i386.tar.gz", wantFormat: Tar, wantMatches: 1},
+		{goos: "darwin", goarch: "arm64", want: "jaudit_1.4.0_Darwin_arm64.tar.gz", wantFormat: Tar, wantMatches: 1},
+		{goos: "windows", goarch: "amd64", want: "jaudit_1.4.0_Windows_x86_64.zip", wantFormat: Zip, wantMatches: 1},
+		{goos: "linux", goarch: "amd64", pattern: "{{.Tool}}-{{.Tag}}-{{.OS}}-{{.Arch}}.zip", want: "jaudit-v1.4.0-linux-amd64.zip", wantFormat: Zip, wantMatches: 1},
+		{goos: "linux", goarch: "arm64", variant: "musl"},
+		{goos: "linux", goarch: "riscv64"},
+		{goos: "freebsd", goarch: "amd64"},
+	}
+	variant := AssetVariant
+	defer func() { AssetVariant = variant }()
+	for _, test := range tests {
+		AssetVariant = test.variant
+		d := &GHReleaseDownloader{assetName: "jaudit", Latest: release}
+		if err := d.SetAssetPattern(test.pattern); err != nil {
+			t.Fatal(err)
+		}
+		candidates, err := d.assetCandidates(release.GetTagName(), test.goos, test.goarch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		asset, format, matches := matchAsset(release, candidates)
+		if got := asset.GetName(); got != test.want || matches != test.wantMatches || (asset != nil && format != test.wantFormat) {
+			t.Errorf("%v/%v %q %q matched %v (%v, %d matches), want %v (%v, %d matches)",
+				test.goos, test.goarch, test.variant, test.pattern, got, format, matches, test.want, test.wantFormat, test.wantMatches)
+		}
+	}
+}
+
+func TestSetAssetPattern(t *testing.T) {
+	d := &GHReleaseDownloader{assetName: "jaudit"}
+	for _, pattern := range []string{"{{.Tool", "{{.Platform}}_{{.Arch}}"} {
+		if err := d.SetAssetPattern(pattern); err == nil {
+			t.Errorf("SetAssetPattern(%q) succeeded", pattern)
+		}
+	}
+}
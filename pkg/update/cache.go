@@ -0,0 +1,259 @@
+package updateutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"github.com/wjlin0/CVE-2024-23897/pkg/atomicfile"
+)
+
+// DefaultAssetCacheSize is the size above which the least recently used cached assets are evicted
+const DefaultAssetCacheSize = 512 * 1024 * 1024
+
+var (
+	// DisableAssetCache downloads every release asset instead of reusing the verified copies of the asset cache
+	DisableAssetCache = false
+	// AssetCacheDir is the directory of the asset cache shared by the updaters of the machine, empty uses StateDir
+	AssetCacheDir string
+
+	defaultCacheMutex sync.Mutex
+	defaultCache      *AssetCache
+)
+
+// DefaultAssetCacheDir returns the asset cache directory in the user cache dir
+func DefaultAssetCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, Repository, "assets")
+}
+
+// AssetCache is a content addressed cache of verified release assets keyed by their sha256, shared
+// by the updaters of a machine. Entries are written atomically so other processes never read a
+// partial asset, and the least recently used ones are evicted above the size cap. Without a
+// directory the assets are kept in memory for the process
+type AssetCache struct {
+	dir     string
+	maxSize int64
+
+	mutex   sync.Mutex
+	entries map[string]*sync.Mutex
+	memory  map[string]*memoryAsset
+	hits    atomic.Int64
+	misses  atomic.Int64
+}
+
+// memoryAsset is an asset of a cache without directory
+type memoryAsset struct {
+	data []byte
+	used time.Time
+}
+
+// NewAssetCache returns the asset cache of dir evicting entries above maxSize bytes, zero uses DefaultAssetCacheSize.
+// An empty dir keeps the assets in memory
+func NewAssetCache(dir string, maxSize int64) *AssetCache {
+	if maxSize <= 0 {
+		maxSize = DefaultAssetCacheSize
+	}
+	return &AssetCache{dir: dir, maxSize: maxSize, entries: make(map[string]*sync.Mutex), memory: make(map[string]*memoryAsset)}
+}
+
+// assetCache returns the cache shared by the downloaders, nil when disabled
+func assetCache() *AssetCache {
+	if DisableAssetCache {
+		return nil
+	}
+	dir := StateDir()
+	defaultCacheMutex.Lock()
+	defer defaultCacheMutex.Unlock()
+	// 没有可写目录时使用内存缓存
+	if defaultCache == nil || defaultCache.dir != dir {
+		defaultCache = NewAssetCache(dir, DefaultAssetCacheSize)
+	}
+	return defaultCache
+}
+
+// lock locks the entry of checksum until the returned function is called
+func (c *AssetCache) lock(checksum string) func() {
+	c.mutex.Lock()
+	entry, ok := c.entries[checksum]
+	if !ok {
+		entry = &sync.Mutex{}
+		c.entries[checksum] = entry
+	}
+	c.mutex.Unlock()
+	entry.Lock()
+	return entry.Unlock
+}
+
+// path returns the file of checksum, false when checksum is not a sha256
+func (c *AssetCache) path(checksum string) (string, bool) {
+	checksum = strings.ToLower(checksum)
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+		return "", false
+	}
+	return filepath.Join(c.dir, checksum), true
+}
+
+// Get returns the cached asset whose sha256 is checksum, corrupted entries are removed
+func (c *AssetCache) Get(checksum string) ([]byte, bool) {
+	path, ok := c.path(checksum)
+	if !ok {
+		return nil, false
+	}
+	defer c.lock(checksum)()
+	if c.dir == "" {
+		return c.getMemory(checksum)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.misses.Add(1)
+		return nil, false
+	}
+	if sum := sha256.Sum256(data); !strings.EqualFold(hex.EncodeToString(sum[:]), checksum) {
+		updateLog.Warning().Label("updater").Msgf("removing corrupted cached asset %v", path)
+		_ = os.Remove(path)
+		c.misses.Add(1)
+		return nil, false
+	}
+	// 更新修改时间, 用于 LRU 淘汰
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	c.hits.Add(1)
+	return data, true
+}
+
+// Put stores data whose sha256 is checksum and evicts the least recently used entries above the size cap
+func (c *AssetCache) Put(checksum string, data []byte) error {
+	path, ok := c.path(checksum)
+	if !ok {
+		return errorutil.NewWithTag("cache", "invalid asset checksum %v", checksum)
+	}
+	if sum := sha256.Sum256(data); !strings.EqualFold(hex.EncodeToString(sum[:]), checksum) {
+		return errorutil.NewWithTag("cache", "asset does not match checksum %v", checksum)
+	}
+	if c.dir == "" {
+		c.putMemory(checksum, data)
+		return nil
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return errorutil.NewWithErr(err).Msgf("failed to create asset cache %v", c.dir)
+	}
+	unlock := c.lock(checksum)
+	err := atomicfile.WriteFile(path, data, 0600)
+	unlock()
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("failed to cache asset %v", checksum)
+	}
+	return c.evict()
+}
+
+// evict removes the least recently used entries until the cache fits its size cap
+func (c *AssetCache) evict() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("failed to list asset cache %v", c.dir)
+	}
+	type entry struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var entries []entry
+	var size int64
+	for _, file := range files {
+		if _, ok := c.path(file.Name()); !ok || file.IsDir() {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry{name: file.Name(), size: info.Size(), modTime: info.ModTime()})
+		size += info.Size()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	for _, e := range entries {
+		if size <= c.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, e.name)); err == nil || os.IsNotExist(err) {
+			size -= e.size
+		}
+	}
+	return nil
+}
+
+// Remove removes the cached asset whose sha256 is checksum
+func (c *AssetCache) Remove(checksum string) {
+	path, ok := c.path(checksum)
+	if !ok {
+		return
+	}
+	defer c.lock(checksum)()
+	if c.dir == "" {
+		c.mutex.Lock()
+		delete(c.memory, strings.ToLower(checksum))
+		c.mutex.Unlock()
+		return
+	}
+	if err := os.Remove(path); err == nil {
+		updateLog.Verbose().Label("updater").Msgf("removed cached asset %v", path)
+	}
+}
+
+// getMemory returns the asset of checksum kept in memory
+func (c *AssetCache) getMemory(checksum string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	asset, ok := c.memory[strings.ToLower(checksum)]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	asset.used = time.Now()
+	c.hits.Add(1)
+	return asset.data, true
+}
+
+// putMemory keeps the asset of checksum in memory and evicts the least recently used ones above the size cap
+func (c *AssetCache) putMemory(checksum string, data []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.memory[strings.ToLower(checksum)] = &memoryAsset{data: append([]byte(nil), data...), used: time.Now()}
+	var size int64
+	checksums := make([]string, 0, len(c.memory))
+	for checksum, asset := range c.memory {
+		checksums = append(checksums, checksum)
+		size += int64(len(asset.data))
+	}
+	sort.Slice(checksums, func(i, j int) bool { return c.memory[checksums[i]].used.Before(c.memory[checksums[j]].used) })
+	for _, checksum := range checksums {
+		if size <= c.maxSize {
+			break
+		}
+		size -= int64(len(c.memory[checksum].data))
+		delete(c.memory, checksum)
+	}
+}
+
+// Hits returns the number of assets read from the cache
+func (c *AssetCache) Hits() int64 {
+	return c.hits.Load()
+}
+
+// Misses returns the number of assets looked up and not found in the cache
+func (c *AssetCache) Misses() int64 {
+	return c.misses.Load()
+}
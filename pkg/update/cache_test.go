@@ -0,0 +1,146 @@
+package updateutils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+)
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAssetCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewAssetCache(dir, 0)
+	asset := []byte("asset")
+	if _, ok := cache.Get(checksum(asset)); ok {
+		t.Fatal("Get() hit on an empty cache")
+	}
+	if err := cache.Put(checksum([]byte("other")), asset); err == nil {
+		t.Error("Put() stored an asset not matching its checksum")
+	}
+	if err := cache.Put("../../etc/passwd", asset); err == nil {
+		t.Error("Put() accepted a checksum which is not a sha256")
+	}
+	if err := cache.Put(checksum(asset), asset); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := cache.Get(checksum(asset)); !ok || !bytes.Equal(data, asset) {
+		t.Errorf("Get() = %q, %v, want %q", data, ok, asset)
+	}
+
+	// 被篡改的缓存条目不会被使用并被删除
+	path := filepath.Join(dir, checksum(asset))
+	if err := os.WriteFile(path, []byte("tampered"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get(checksum(asset)); ok {
+		t.Error("Get() returned a corrupted entry")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("corrupted entry was not removed: %v", err)
+	}
+	if cache.Hits() != 1 || cache.Misses() != 2 {
+		t.Errorf("Hits(), Misses() = %d, %d, want 1, 2", cache.Hits(), cache.Misses())
+	}
+}
+
+func TestAssetCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewAssetCache(dir, 25)
+	assets := [][]byte{[]byte("asset-0000"), []byte("asset-0001"), []byte("asset-0002")}
+	for i, asset := range assets[:2] {
+		if err := cache.Put(checksum(asset), asset); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(time.Duration(i-10) * time.Minute)
+		_ = os.Chtimes(filepath.Join(dir, checksum(asset)), old, old)
+	}
+	// 读取 asset-0000 后 asset-0001 成为最久未使用的条目
+	if _, ok := cache.Get(checksum(assets[0])); !ok {
+		t.Fatal("Get() missed a cached asset")
+	}
+	if err := cache.Put(checksum(assets[2]), assets[2]); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{true, false, true} {
+		if _, err := os.Stat(filepath.Join(dir, checksum(assets[i]))); (err == nil) != want {
+			t.Errorf("asset %d cached = %v, want %v", i, err == nil, want)
+		}
+	}
+}
+
+func TestAssetCacheConcurrent(t *testing.T) {
+	cache := NewAssetCache(t.TempDir(), 64)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			asset := []byte(fmt.Sprintf("asset-%d", i%4))
+			for j := 0; j < 20; j++ {
+				if err := cache.Put(checksum(asset), asset); err != nil {
+					t.Error(err)
+					return
+				}
+				if data, ok := cache.Get(checksum(asset)); ok && !bytes.Equal(data, asset) {
+					t.Errorf("Get() = %q, want %q", data, asset)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestUpdateToolsAssetCache(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/cached", newToolRelease(t, "cached", "v1.1.0", []byte("bin-cached")))
+	tools := []Tool{{Name: "cached", Version: "1.0.0"}}
+	updater := &Updater{APIRequestsPerMinute: -1}
+	defer updater.Close()
+
+	tests := []struct {
+		name    string
+		disable bool
+		hits    int
+	}{
+		{name: "first", hits: 0},
+		{name: "second", hits: 1},
+		{name: "no cache", disable: true, hits: 0},
+	}
+	asset := int64(len(fake.releases[Organization+"/cached"].Assets[platformAssetName("cached", "v1.1.0", Tar)]))
+	var firstDownload int64
+	for _, test := range tests {
+		DisableAssetCache = test.disable
+		dir := t.TempDir()
+		summary := updater.UpdateTools(context.Background(), tools, dir)
+		if summary.Updated() != 1 || summary.CacheHits() != test.hits {
+			t.Errorf("UpdateTools(%s) = %d updated %d cache hits, want 1 and %d: %v", test.name, summary.Updated(), summary.CacheHits(), test.hits, summary.Results[0].Err)
+		}
+		if bin, err := os.ReadFile(filepath.Join(dir, "cached")); err != nil || !bytes.Equal(bin, []byte("bin-cached")) {
+			t.Errorf("UpdateTools(%s) installed %q, %v", test.name, bin, err)
+		} // 命中缓存时不下载资源
+		usage := summary.Results[0].Egress
+		if downloaded := usage[egress.UpdaterDownload].Received; test.hits == 0 {
+			firstDownload = downloaded
+		} else if firstDownload-downloaded < asset {
+			t.Errorf("UpdateTools(%s) downloaded %d bytes with a cache hit, %d without", test.name, downloaded, firstDownload)
+		}
+		if usage[egress.UpdaterAPI].Received == 0 {
+			t.Errorf("UpdateTools(%s) egress = %+v, want the api calls counted", test.name, usage)
+		}
+	}
+	DisableAssetCache = false
+}
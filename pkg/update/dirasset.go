@@ -0,0 +1,136 @@
+package updateutils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v30/github"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// ErrReleaseAssetNotFound is returned by the directory updates from a release asset when the release has no
+// asset matching DirUpdateOptions.Asset, matched with errors.Is
+var ErrReleaseAssetNotFound = errorutil.NewWithTag("updater", "release asset not found")
+
+// GetUpdateDirFromAssetCallback returns a callback updating dir from the asset assetName of the latest release of
+// repoName instead of its source, e.g. a curated templates.zip. assetName may be a glob like templates-*.zip
+func GetUpdateDirFromAssetCallback(toolName, dir, repoName, assetName string) func() error {
+	return GetUpdateDirFromRepoWithOptionsCallback(toolName, dir, repoName, &DirUpdateOptions{Asset: assetName})
+}
+
+// findReleaseAsset returns the asset of the latest release named pattern or matching it as a glob, an
+// ErrReleaseAssetNotFound when none does and an error when several do
+func (d *GHReleaseDownloader) findReleaseAsset(pattern string) (*github.ReleaseAsset, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("invalid asset name %v", pattern)
+	}
+	var matches []*github.ReleaseAsset
+	for _, asset := range d.Latest.Assets {
+		if ok, _ := path.Match(pattern, asset.GetName()); ok {
+			matches = append(matches, asset)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, newUpdateError(ErrReleaseAssetNotFound, "release %v of %v has no asset matching %v", d.Latest.GetTagName(), d.Source(), pattern)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, 0, len(matches))
+	for _, asset := range matches {
+		names = append(names, asset.GetName())
+	}
+	return nil, errorutil.NewWithTag("updater", "%d assets of release %v match %v: %v", len(matches), d.Latest.GetTagName(), pattern, strings.Join(names, ", "))
+}
+
+// unpackDirAsset downloads the release asset of opts, verifies its checksum and signature and calls callback
+// for its files like for the entries of the source
+func (d *GHReleaseDownloader) unpackDirAsset(ctx context.Context, opts *DirUpdateOptions, showProgressBar bool, progress *dirProgress, callback AssetFileCallback) error {
+	asset, err := d.findReleaseAsset(opts.Asset)
+	if err != nil {
+		return err
+	}
+	name := asset.GetName()
+	checksum, _, err := d.assetChecksum(ctx, name)
+	if err != nil {
+		return err
+	}
+	data, err := d.downloadAsset(ctx, asset.GetID(), name, checksum, showProgressBar)
+	if err := contextError(ctx, "download of asset %v cancelled", name); err != nil {
+		return err
+	}
+	if errors.Is(err, ErrCredentialRejected) || errors.Is(err, ErrLengthMismatch) || isRateLimited(err) {
+		return err
+	}
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("failed to download asset %v of release %v got %v", name, d.Latest.GetTagName(), err)
+	}
+	progress.downloaded(int64(len(data)), int64(len(data)))
+	if checksum != "" {
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); got != checksum {
+			return newUpdateError(ErrChecksumMismatch, "asset file %v corrupted: checksum mismatch expected %v but got %v, the update was refused", name, checksum, got)
+		}
+		updateLog.Info().Msgf("Verified Integrity of %v", name)
+	}
+	// 解压前校验签名
+	if err := verifySource(d, data, name, name+".minisig", opts); err != nil {
+		return err
+	}
+
+	rooted, err := archiveRooted(ctx, data)
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("failed to unpack %v got %v", name, err)
+	}
+	// 没有根目录的资源加上一层, 与源码包相同地去掉
+	root := strings.TrimSuffix(name, path.Ext(name))
+	progress.phase(DirPhaseExtract, zipEntries(data))
+	bar := newProgress("extracting "+name, int64(zipEntries(data)), true, d.showProgress(showProgressBar))
+	defer bar.Finish()
+	err = unpackAsset(ctx, "", data, func(entry string, f fs.FileInfo, r io.Reader) error {
+		bar.Add(1, entry)
+		if rooted {
+			return callback(entry, f, r)
+		}
+		if err := checkArchivePath(entry); err != nil {
+			return err
+		}
+		return callback(root+"/"+entry, f, r)
+	})
+	if err := contextError(ctx, "unpacking %v cancelled", name); err != nil {
+		return err
+	}
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("failed to unpack %v got %v", name, err)
+	}
+	return nil
+}
+
+// archiveRooted reports whether all the entries of the archive are in one top-level directory, like in the
+// zipball of a repository
+func archiveRooted(ctx context.Context, data []byte) (bool, error) {
+	root, rooted := "", true
+	err := unpackAsset(ctx, "", data, func(entry string, f fs.FileInfo, _ io.Reader) error {
+		entry = strings.ReplaceAll(entry, "\\", "/")
+		top, rest, nested := strings.Cut(entry, "/")
+		if !nested || rest == "" && !f.IsDir() {
+			rooted = false
+		}
+		if root == "" {
+			root = top
+		} else if top != root {
+			rooted = false
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return rooted && root != "", nil
+}
@@ -0,0 +1,108 @@
+package updateutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assetChecksums returns the checksums file of the templates release listing the assets
+func assetChecksums(assets map[string][]byte) []byte {
+	var builder strings.Builder
+	for name, data := range assets {
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(&builder, "%s  %s\n", hex.EncodeToString(sum[:]), name)
+	}
+	return []byte(builder.String())
+}
+
+func TestUpdateDirFromAsset(t *testing.T) {
+	hideProgressBar(t)
+	flat := zipArchive(t, map[string][]byte{
+		".version":      []byte("v1.0.1"),
+		"http/foo.yaml": []byte("foo"),
+		"dns/bar.yaml":  []byte("bar"),
+	})
+	rooted := tarGz(t, map[string][]byte{
+		"templates/.version":      []byte("v1.0.1"),
+		"templates/http/foo.yaml": []byte("foo"),
+		"templates/dns/bar.yaml":  []byte("bar"),
+	})
+	want := []string{".version", "dns/bar.yaml", "http/foo.yaml"}
+
+	tests := []struct {
+		name   string
+		assets map[string][]byte
+		asset  string
+	}{
+		{"flat zip", map[string][]byte{"templates.zip": flat}, "templates.zip"},
+		{"glob", map[string][]byte{"templates-v1.0.1.zip": flat, "tool_1.0.1_linux_amd64.zip": []byte("bin")}, "templates-*.zip"},
+		{"rooted tar.gz", map[string][]byte{"templates.tar.gz": rooted}, "templates.tar.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assets := map[string][]byte{"templates_1.0.1_checksums.txt": assetChecksums(tt.assets)}
+			for name, data := range tt.assets {
+				assets[name] = data
+			}
+			fake := newFakeGitHub(t)
+			fake.AddRelease(Organization+"/templates", &fakeRelease{Tag: "v1.0.1", Assets: assets})
+			dir := t.TempDir()
+			if err := GetUpdateDirFromAssetCallback("templates", dir, "", tt.asset)(); err != nil {
+				t.Fatal(err)
+			}
+			if got := listFiles(t, dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("files = %v, want %v", got, want)
+			}
+			if tag := localDirVersion(dir); tag != "v1.0.1" {
+				t.Errorf("version = %q, want v1.0.1", tag)
+			}
+		})
+	}
+}
+
+func TestUpdateDirFromAssetErrors(t *testing.T) {
+	hideProgressBar(t)
+	flat := zipArchive(t, map[string][]byte{".version": []byte("v1.0.1"), "http/foo.yaml": []byte("foo")})
+	corrupted := map[string][]byte{"templates.zip": []byte("other")}
+
+	tests := []struct {
+		name     string
+		assets   map[string][]byte
+		asset    string
+		kind     error
+		contains string
+	}{
+		{"missing", map[string][]byte{"templates.zip": flat}, "templates-*.tar.gz", ErrReleaseAssetNotFound, "no asset matching"},
+		{"ambiguous", map[string][]byte{"templates-a.zip": flat, "templates-b.zip": flat}, "templates-*.zip", nil, "2 assets of release"},
+		{"download failure", map[string][]byte{"templates.zip": nil}, "templates.zip", nil, "failed to download asset templates.zip"},
+		{"checksum mismatch", map[string][]byte{"templates.zip": flat, "templates_1.0.1_checksums.txt": assetChecksums(corrupted)}, "templates.zip", ErrChecksumMismatch, "checksum mismatch"},
+		{"not listed", map[string][]byte{"templates.zip": flat, "templates_1.0.1_checksums.txt": assetChecksums(map[string][]byte{"other.zip": flat})}, "templates.zip", ErrChecksumMismatch, "doesn't list templates.zip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGitHub(t)
+			fake.AddRelease(Organization+"/templates", &fakeRelease{Tag: "v1.0.1", Assets: tt.assets})
+			dir := t.TempDir()
+			err := GetUpdateDirFromAssetCallback("templates", dir, "", tt.asset)()
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Fatalf("update = %v, want %q", err, tt.contains)
+			}
+			if tt.kind != nil && !errors.Is(err, tt.kind) {
+				t.Errorf("update = %v, want %v", err, tt.kind)
+			}
+			if errors.Is(err, ErrReleaseAssetNotFound) != (tt.kind == ErrReleaseAssetNotFound) {
+				t.Errorf("update = %v, asset not found %v", err, errors.Is(err, ErrReleaseAssetNotFound))
+			}
+			if _, err := os.Stat(filepath.Join(dir, "http")); !os.IsNotExist(err) {
+				t.Errorf("files written after the failure: %v", listFiles(t, dir))
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package updateutils
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// DefaultDirBackup is the backup dir of the directory updates relative to the directory, hidden so that
+// the updates skip it
+const DefaultDirBackup = ".backup"
+
+// MaxDirBackups is the number of backups of a directory kept by the updates, see DirUpdateOptions.MaxBackups
+var MaxDirBackups = 3
+
+// dirBackupLayout is the name of a backup, the UTC time it was taken
+const dirBackupLayout = "20060102T150405.000Z"
+
+// dirBackupManifest lists the files added by the update of a backup, removed by the restore
+const dirBackupManifest = ".backup-manifest.json"
+
+// dirBackupRoot returns the dir holding the backups of dir, backupDir relative to dir
+func dirBackupRoot(dir, backupDir string) string {
+	if filepath.IsAbs(backupDir) {
+		return backupDir
+	}
+	return filepath.Join(dir, backupDir)
+}
+
+// backupDir copies the files of dir about to be replaced or pruned by changes to a new backup under root,
+// with the files the update adds, and keeps the max most recent backups. It returns the backup dir, empty
+// when the update replaces nothing
+func backupDir(dir, root string, changes *DirChangeSet, max int) (string, error) {
+	// 未变化的文件即使被重新写入也不需要备份
+	replaced := append(append([]string{}, changes.Modified...), changes.Pruned...)
+	if len(replaced) == 0 {
+		return "", nil
+	}
+	backup := filepath.Join(root, time.Now().UTC().Format(dirBackupLayout))
+	if err := makeTemplateDir(backup); err != nil {
+		return "", err
+	}
+	for _, relativePath := range replaced {
+		if err := copyDirFile(filepath.Join(dir, relativePath), filepath.Join(backup, relativePath)); err != nil {
+			_ = os.RemoveAll(backup)
+			return "", errorutil.NewWithErr(err).Msgf("failed to back up %v", relativePath)
+		}
+	}
+	manifest, _ := json.Marshal(map[string][]string{"added": changes.Added})
+	if err := os.WriteFile(filepath.Join(backup, dirBackupManifest), manifest, 0644); err != nil {
+		_ = os.RemoveAll(backup)
+		return "", errorutil.NewWithErr(err).Msgf("failed to write the manifest of %v", backup)
+	}
+	pruneDirBackups(root, max)
+	return backup, nil
+}
+
+// copyDirFile copies the file or the symlink from to to, keeping its mode
+func copyDirFile(from, to string) error {
+	info, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+	if err := makeTemplateDir(filepath.Dir(to)); err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		link, err := os.Readlink(from)
+		if err != nil {
+			return err
+		}
+		_ = os.Remove(to)
+		return symlink(link, to)
+	}
+	data, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	_ = os.Remove(to)
+	return os.WriteFile(to, data, info.Mode().Perm())
+}
+
+// dirBackups returns the names of the backups under root, oldest first
+func dirBackups(root string) []string {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+	var backups []string
+	for _, entry := range entries {
+		// 只处理备份, 调用方提供的目录中可能有其他文件
+		if _, err := time.Parse(dirBackupLayout, entry.Name()); err == nil && entry.IsDir() {
+			backups = append(backups, entry.Name())
+		}
+	}
+	sort.Strings(backups)
+	return backups
+}
+
+// pruneDirBackups removes the oldest backups under root beyond max, max <= 0 keeps MaxDirBackups
+func pruneDirBackups(root string, max int) {
+	if max <= 0 {
+		max = MaxDirBackups
+	}
+	backups := dirBackups(root)
+	for len(backups) > max {
+		if err := os.RemoveAll(filepath.Join(root, backups[0])); err != nil {
+			updateLog.Verbose().Msgf("could not remove the backup %v: %v", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+}
+
+// RestoreDirBackup restores the files of dir backed up by an update under dir/DefaultDirBackup and removes
+// the files this update added, timestamp is the name of the backup and the latest backup when empty
+func RestoreDirBackup(dir, timestamp string) error {
+	return RestoreDirBackupFrom(dir, DefaultDirBackup, timestamp)
+}
+
+// RestoreDirBackupFrom is RestoreDirBackup of the backups under backupDir, relative to dir, as set by
+// DirUpdateOptions.BackupDir
+func RestoreDirBackupFrom(dir, backupDir, timestamp string) error {
+	root := dirBackupRoot(dir, backupDir)
+	if timestamp == "" {
+		backups := dirBackups(root)
+		if len(backups) == 0 {
+			return errorutil.NewWithTag("updater", "no backup of %v in %v", dir, root)
+		}
+		timestamp = backups[len(backups)-1]
+	}
+	if _, err := time.Parse(dirBackupLayout, timestamp); err != nil {
+		return errorutil.NewWithTag("updater", "invalid backup %q of %v, backups are named like %v", timestamp, dir, dirBackupLayout)
+	}
+	backup := filepath.Join(root, timestamp)
+	data, err := os.ReadFile(filepath.Join(backup, dirBackupManifest))
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("invalid backup %v", backup)
+	}
+	var manifest struct {
+		Added []string `json:"added"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return errorutil.NewWithErr(err).Msgf("invalid manifest of backup %v", backup)
+	}
+	for _, relativePath := range manifest.Added {
+		if !filepath.IsLocal(relativePath) {
+			return newUpdateError(ErrUnsafeArchivePath, "refusing to remove %v outside of %v", relativePath, dir)
+		}
+	}
+	err = filepath.WalkDir(backup, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path == filepath.Join(backup, dirBackupManifest) {
+			return err
+		}
+		relativePath, err := filepath.Rel(backup, path)
+		if err != nil {
+			return err
+		}
+		return copyDirFile(path, filepath.Join(dir, relativePath))
+	})
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("failed to restore backup %v", backup)
+	}
+	if err := pruneDir(context.Background(), dir, manifest.Added); err != nil {
+		return err
+	}
+	updateLog.Info().Label("updater").Msgf("restored %v from %v", dir, backup)
+	return nil
+}
+
+// backupSkipped returns the backup root to skip when diffing dir, empty when it is outside of dir
+func backupSkipped(dir, root string) string {
+	absDir, dirErr := filepath.Abs(dir)
+	absRoot, rootErr := filepath.Abs(root)
+	if dirErr != nil || rootErr != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(absDir, absRoot)
+	if err != nil || !filepath.IsLocal(rel) || strings.HasPrefix(rel, ".") {
+		// 点开头的目录本就被跳过
+		return ""
+	}
+	return filepath.Join(dir, rel)
+}
@@ -0,0 +1,111 @@
+package updateutils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateDirFromRepoBackup(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	dir := t.TempDir()
+	local := map[string]string{
+		".version":         "v1.0.0",
+		"cves/change.yaml": "patched locally",
+		"cves/same.yaml":   "same",
+		"cves/gone.yaml":   "gone",
+	}
+	writeFiles(t, dir, local)
+
+	changes, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{Prune: true, BackupDir: DefaultDirBackup})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(changes.Backup) != filepath.Join(dir, DefaultDirBackup) {
+		t.Fatalf("backup = %q, want under %v", changes.Backup, filepath.Join(dir, DefaultDirBackup))
+	}
+	for name, want := range map[string]string{".version": "v1.0.0", "cves/change.yaml": "patched locally", "cves/gone.yaml": "gone"} {
+		if data, err := os.ReadFile(filepath.Join(changes.Backup, name)); err != nil || string(data) != want {
+			t.Errorf("backup of %v = %q, %v, want %q", name, data, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(changes.Backup, "cves/same.yaml")); !os.IsNotExist(err) {
+		t.Errorf("unchanged file backed up: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "cves/change.yaml")); string(data) != "changed" {
+		t.Errorf("cves/change.yaml after the update = %q", data)
+	}
+
+	if err := RestoreDirBackup(dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range local {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != want {
+			t.Errorf("%v after the restore = %q, %v, want %q", name, data, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cves/new.yaml")); !os.IsNotExist(err) {
+		t.Errorf("file added by the update kept by the restore: %v", err)
+	}
+	if err := RestoreDirBackup(dir, "yesterday"); err == nil {
+		t.Errorf("RestoreDirBackup() of an invalid backup succeeded")
+	}
+	if err := RestoreDirBackup(t.TempDir(), ""); err == nil {
+		t.Errorf("RestoreDirBackup() without backups succeeded")
+	}
+}
+
+func TestUpdateDirFromRepoBackupNotPruned(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"cves/change.yaml": "patched", "backups/notes.txt": "kept"})
+	changes, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{Prune: true, BackupDir: "backups"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, deleted := range changes.Deleted {
+		if strings.HasPrefix(filepath.ToSlash(deleted), "backups/") {
+			t.Errorf("backup dir listed as deleted: %v", changes.Deleted)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "backups/notes.txt")); err != nil {
+		t.Errorf("file of the backup dir pruned: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(changes.Backup, "cves/change.yaml")); err != nil || string(data) != "patched" {
+		t.Errorf("backup of cves/change.yaml = %q, %v", data, err)
+	}
+}
+
+func TestPruneDirBackups(t *testing.T) {
+	root := t.TempDir()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var names []string
+	for i := 0; i < 5; i++ {
+		name := start.Add(time.Duration(i) * time.Hour).Format(dirBackupLayout)
+		names = append(names, name)
+		if err := os.Mkdir(filepath.Join(root, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 不是备份的目录不删除
+	if err := os.Mkdir(filepath.Join(root, "unrelated"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pruneDirBackups(root, 0)
+	if got := dirBackups(root); strings.Join(got, ",") != strings.Join(names[2:], ",") {
+		t.Errorf("backups after pruning = %v, want %v", got, names[2:])
+	}
+	pruneDirBackups(root, 1)
+	if got := dirBackups(root); strings.Join(got, ",") != names[4] {
+		t.Errorf("backups after pruning to 1 = %v, want %v", got, names[4])
+	}
+	if _, err := os.Stat(filepath.Join(root, "unrelated")); err != nil {
+		t.Errorf("unrelated dir removed: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package updateutils
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/wjlin0/CVE-2024-23897/pkg/atomicfile"
+)
+
+// symlink creates the symlinks of the release source, replaced by tests to simulate platforms without symlinks
+var symlink = os.Symlink
+
+// linkTarget returns the target of the symlink entry f with the content data, tar keeps it in the header
+// while zip stores it as the content
+func linkTarget(f fs.FileInfo, data []byte) string {
+	if header, ok := f.Sys().(*tar.Header); ok {
+		return header.Linkname
+	}
+	return string(data)
+}
+
+// checkLinkTarget rejects a symlink entry of the archive whose target is absolute or resolves outside of
+// the directory, relativePath is the path of the link in the directory
+func checkLinkTarget(name, relativePath, link string) error {
+	slashed := strings.ReplaceAll(link, "\\", "/")
+	if slashed == "" || strings.HasPrefix(slashed, "/") || (len(slashed) >= 2 && slashed[1] == ':') {
+		return newUpdateError(ErrUnsafeArchivePath, "archive entry %v is a symlink to the absolute path %v", name, link)
+	}
+	resolved := path.Join(path.Dir(filepath.ToSlash(relativePath)), slashed)
+	if !filepath.IsLocal(filepath.FromSlash(resolved)) {
+		return newUpdateError(ErrUnsafeArchivePath, "archive entry %v is a symlink to %v, outside of the directory", name, link)
+	}
+	return nil
+}
+
+// sameExecutable reports whether both modes have the same executable bits, always on windows which has none
+func sameExecutable(local, incoming fs.FileMode) bool {
+	return runtime.GOOS == "windows" || local.Perm()&0111 == incoming.Perm()&0111
+}
+
+// localMatches reports whether the local file at path is the incoming file: the same symlink, or a regular
+// file with the same content and executable bits. The error satisfies os.IsNotExist when there is none
+func localMatches(path string, file *incomingFile) (bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false, err
+	}
+	if file.link != "" {
+		if info.Mode()&fs.ModeSymlink == 0 {
+			return false, nil
+		}
+		target, err := os.Readlink(path)
+		return err == nil && filepath.ToSlash(target) == file.link, nil
+	}
+	if !info.Mode().IsRegular() {
+		return false, nil
+	}
+	local, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(local, file.data) && sameExecutable(info.Mode(), file.mode), nil
+}
+
+// writeIncomingLink recreates the symlink of the incoming file at path. Where symlinks can't be created the
+// content of the link target is copied instead, targets which are not files of the release are skipped
+func writeIncomingLink(path, relativePath string, file *incomingFile, incoming map[string]*incomingFile) error {
+	// 在同一目录创建后重命名, 替换已有的文件或链接
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".link-tmp")
+	_ = os.Remove(tmp)
+	err := symlink(filepath.FromSlash(file.link), tmp)
+	if err == nil {
+		if err = os.Rename(tmp, path); err != nil {
+			_ = os.Remove(tmp)
+		}
+		return err
+	}
+	target, ok := incoming[filepath.Join(filepath.Dir(relativePath), filepath.FromSlash(file.link))]
+	if !ok || target.link != "" {
+		updateLog.Info().Label("updater").Msgf("skipped %v: symlinks are not supported here (%v) and its target %v is not a file of the release", relativePath, err, file.link)
+		return nil
+	}
+	updateLog.Verbose().Msgf("symlinks are not supported (%v), copying %v to %v", err, file.link, relativePath)
+	return atomicfile.WriteFile(path, target.data, target.mode.Perm())
+}
+
+// writeIncomingFile writes the regular incoming file at path with its mode, replacing a local symlink.
+// An unchanged file is rewritten with force
+func writeIncomingFile(path string, file *incomingFile, force bool) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		// 不通过链接写入目标文件
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	if force {
+		return atomicfile.WriteFile(path, file.data, file.mode.Perm())
+	}
+	changed, err := atomicfile.WriteFileIfChanged(path, file.data, file.mode.Perm())
+	if err == nil && !changed {
+		// 内容相同, 只有可执行位不同
+		err = os.Chmod(path, file.mode.Perm())
+	}
+	return err
+}
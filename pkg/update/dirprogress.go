@@ -0,0 +1,147 @@
+package updateutils
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// Phases of a directory update reported by DirUpdateProgress
+const (
+	DirPhaseDownload = "download"
+	DirPhaseExtract  = "extract"
+	DirPhaseWrite    = "write"
+)
+
+// DirUpdateProgress is the state of a directory update passed to DirUpdateOptions.OnProgress
+type DirUpdateProgress struct {
+	// Phase is DirPhaseDownload, DirPhaseExtract or DirPhaseWrite
+	Phase string
+	// TotalBytes is the size of the source archive, 0 while unknown
+	TotalBytes int64
+	// DownloadedBytes is the number of bytes of the source archive downloaded
+	DownloadedBytes int64
+	// TotalFiles is the number of entries to extract or of files to write in the phase, 0 while unknown
+	TotalFiles int
+	// FilesExtracted is the number of archive entries unpacked
+	FilesExtracted int
+	// FilesWritten is the number of files written to the directory
+	FilesWritten int
+	// FilesSkipped is the number of files of the release identical to the local ones
+	FilesSkipped int
+	// Path is the file being extracted or written
+	Path string
+	// Done is set on the last invocation, also when the update failed or had nothing to do
+	Done bool
+	// Err is the error of the update on the last invocation
+	Err error
+}
+
+// dirProgress reports the progress of a directory update to a hook at most every progressInterval, and
+// at every phase change. The methods of a nil dirProgress do nothing
+type dirProgress struct {
+	mutex    sync.Mutex
+	hook     func(DirUpdateProgress)
+	state    DirUpdateProgress
+	reported time.Time
+}
+
+// newDirProgress returns the progress reporting to hook, nil without hook
+func newDirProgress(hook func(DirUpdateProgress)) *dirProgress {
+	if hook == nil {
+		return nil
+	}
+	return &dirProgress{hook: hook}
+}
+
+// update applies fn to the state and reports it when forced or when the interval elapsed
+func (p *dirProgress) update(force bool, fn func(state *DirUpdateProgress)) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.state.Done {
+		return
+	}
+	fn(&p.state)
+	if force || time.Since(p.reported) >= progressInterval {
+		p.reported = time.Now()
+		// 在持有锁时调用, 保证调用顺序
+		p.hook(p.state)
+	}
+}
+
+// phase starts phase with total files, 0 when unknown
+func (p *dirProgress) phase(phase string, total int) {
+	p.update(true, func(state *DirUpdateProgress) {
+		state.Phase, state.TotalFiles, state.Path = phase, total, ""
+	})
+}
+
+// downloaded records read bytes of the archive of total bytes, total <= 0 when unknown
+func (p *dirProgress) downloaded(read, total int64) {
+	p.update(total > 0 && read >= total, func(state *DirUpdateProgress) {
+		state.DownloadedBytes = read
+		if total > 0 {
+			state.TotalBytes = total
+		}
+	})
+}
+
+// extracted records the archive entry path as unpacked
+func (p *dirProgress) extracted(path string) {
+	p.update(false, func(state *DirUpdateProgress) {
+		state.FilesExtracted++
+		state.Path = path
+	})
+}
+
+// skipped records n files unchanged
+func (p *dirProgress) skipped(n int) {
+	p.update(false, func(state *DirUpdateProgress) {
+		state.FilesSkipped = n
+	})
+}
+
+// written records the file at relativePath as written
+func (p *dirProgress) written(relativePath string) {
+	p.update(false, func(state *DirUpdateProgress) {
+		state.FilesWritten++
+		state.Path = relativePath
+	})
+}
+
+// finish reports the last state with Done and err
+func (p *dirProgress) finish(err error) {
+	p.update(true, func(state *DirUpdateProgress) {
+		state.Path, state.Err = "", err
+		state.Done = true
+	})
+}
+
+// zipEntries returns the number of entries of the zip source, 0 when it is not a zip
+func zipEntries(source []byte) int {
+	zipReader, err := zip.NewReader(bytes.NewReader(source), int64(len(source)))
+	if err != nil {
+		return 0
+	}
+	return len(zipReader.File)
+}
+
+// progressBody counts the bytes read from a response body for a hook
+type progressBody struct {
+	io.ReadCloser
+	read   int64
+	total  int64
+	notify func(read, total int64)
+}
+
+func (b *progressBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	b.notify(b.read, b.total)
+	return n, err
+}
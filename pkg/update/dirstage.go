@@ -0,0 +1,188 @@
+package updateutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// stagingPrefix names the staging dirs of the directory updates, hidden so that an interrupted update
+// leaving one isn't taken for templates
+const stagingPrefix = ".update-staging-"
+
+// dirStage is a directory update written to a staging dir before being moved into dir
+type dirStage struct {
+	dir  string
+	root string
+	// files are the relative paths of the staged files in write order, TemplateVersionFile last
+	files []string
+}
+
+// newDirStage creates the staging dir of dir next to it, or inside it when dir is another file system
+// the staged files can't be renamed from
+func newDirStage(dir string) (*dirStage, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	parent := filepath.Dir(dir)
+	if err := makeTemplateDir(parent); err != nil {
+		return nil, err
+	}
+	root, err := os.MkdirTemp(parent, stagingPrefix+filepath.Base(dir)+"-")
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to create the staging dir of %v", dir)
+	}
+	if info, err := os.Stat(dir); err == nil && info.IsDir() && !renameable(root, dir) {
+		// 例如挂载的目录, 无法从父目录重命名
+		_ = os.RemoveAll(root)
+		if root, err = os.MkdirTemp(dir, stagingPrefix); err != nil {
+			return nil, errorutil.NewWithErr(err).Msgf("failed to create the staging dir of %v", dir)
+		}
+	}
+	return &dirStage{dir: dir, root: root}, nil
+}
+
+// renameable reports whether the files of from can be renamed into to
+func renameable(from, to string) bool {
+	probe, err := os.CreateTemp(from, "probe-")
+	if err != nil {
+		return false
+	}
+	_ = probe.Close()
+	target := filepath.Join(to, stagingPrefix+filepath.Base(probe.Name()))
+	if err := os.Rename(probe.Name(), target); err != nil {
+		_ = os.Remove(probe.Name())
+		return false
+	}
+	_ = os.Remove(target)
+	return true
+}
+
+// staged returns the dir the release files are written to
+func (s *dirStage) staged() string {
+	return filepath.Join(s.root, "new")
+}
+
+// write writes the files of written to the staged dir with write, concurrently but TemplateVersionFile.
+// The first error leaves dir untouched
+func (s *dirStage) write(ctx context.Context, written []string, write func(relativePath string) error) error {
+	var (
+		mutex  sync.Mutex
+		staged = make(map[string]struct{}, len(written))
+		count  atomic.Int64
+	)
+	stage := func(relativePath string) error {
+		if err := failpointAt(FailpointDirWrite, int(count.Add(1))); err != nil {
+			return err
+		}
+		if err := write(relativePath); err != nil {
+			return err
+		}
+		mutex.Lock()
+		staged[relativePath] = struct{}{}
+		mutex.Unlock()
+		return nil
+	}
+	cancelled := func(string) error {
+		return contextError(ctx, "update of %v cancelled", s.dir)
+	}
+	files := written
+	if len(files) > 0 && files[len(files)-1] == TemplateVersionFile {
+		files = files[:len(files)-1]
+	}
+	if err := forEachConcurrently(ctx, files, ExtractWorkers, cancelled, stage); err != nil {
+		return err
+	}
+	if len(files) < len(written) {
+		if err := cancelled(TemplateVersionFile); err != nil {
+			return err
+		}
+		if err := stage(TemplateVersionFile); err != nil {
+			return err
+		}
+	}
+	// 校验全部文件已写入, 跳过的链接不移动
+	for _, relativePath := range written {
+		if _, ok := staged[relativePath]; !ok {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(s.staged(), relativePath)); err != nil {
+			return errorutil.NewWithErr(err).Msgf("staged file %v missing", relativePath)
+		}
+		s.files = append(s.files, relativePath)
+	}
+	return nil
+}
+
+// commit moves the staged files into dir in order, renaming the staging dir to dir when it doesn't exist.
+// A failing move restores the files already replaced and removes the ones added
+func (s *dirStage) commit(ctx context.Context) error {
+	if err := contextError(ctx, "update of %v cancelled", s.dir); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(s.dir); os.IsNotExist(err) && filepath.Dir(s.root) == filepath.Dir(s.dir) {
+		if err := os.MkdirAll(s.staged(), os.ModePerm); err != nil {
+			return err
+		}
+		return os.Rename(s.staged(), s.dir)
+	}
+	type move struct {
+		target, backup string
+		created        []string
+	}
+	var moved []move
+	rollback := func() {
+		for i := len(moved) - 1; i >= 0; i-- {
+			if moved[i].backup != "" {
+				_ = os.Rename(moved[i].backup, moved[i].target)
+			} else {
+				_ = os.Remove(moved[i].target)
+			}
+			for _, dir := range moved[i].created {
+				_ = os.Remove(dir)
+			}
+		}
+	}
+	for _, relativePath := range s.files {
+		m := move{target: filepath.Join(s.dir, relativePath)}
+		for parent := filepath.Dir(m.target); parent != s.dir; parent = filepath.Dir(parent) {
+			if _, err := os.Lstat(parent); err == nil {
+				break
+			}
+			m.created = append(m.created, parent)
+		}
+		if err := makeTemplateDir(filepath.Dir(m.target)); err != nil {
+			rollback()
+			return err
+		}
+		if _, err := os.Lstat(m.target); err == nil {
+			m.backup = filepath.Join(s.root, "old", relativePath)
+			if err := makeTemplateDir(filepath.Dir(m.backup)); err != nil {
+				rollback()
+				return err
+			}
+			if err := os.Rename(m.target, m.backup); err != nil {
+				rollback()
+				return errorutil.NewWithErr(err).Msgf("failed to replace file %s", m.target)
+			}
+		}
+		moved = append(moved, m)
+		if err := os.Rename(filepath.Join(s.staged(), relativePath), m.target); err != nil {
+			rollback()
+			return errorutil.NewWithErr(err).Msgf("failed to write file %s", m.target)
+		}
+	}
+	return nil
+}
+
+// cleanup removes the staging dir with the staged and the replaced files
+func (s *dirStage) cleanup() {
+	if err := os.RemoveAll(s.root); err != nil {
+		updateLog.Verbose().Msgf("could not remove the staging dir %v: %v", s.root, err)
+	}
+}
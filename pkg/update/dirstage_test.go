@@ -0,0 +1,146 @@
+package updateutils
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// snapshotDir returns the files of dir with their mode and content
+func snapshotDir(t *testing.T, dir string) map[string]string {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		relativePath, _ := filepath.Rel(dir, path)
+		if d.IsDir() {
+			files[relativePath] = "dir"
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[relativePath] = fmt.Sprintf("%v %s", info.Mode(), data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// checkNoStaging fails when a staging dir is left next to or inside dir
+func checkNoStaging(t *testing.T, dir string) {
+	t.Helper()
+	for _, parent := range []string{filepath.Dir(dir), dir} {
+		entries, _ := os.ReadDir(parent)
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), stagingPrefix) {
+				t.Errorf("staging dir %v left", filepath.Join(parent, entry.Name()))
+			}
+		}
+	}
+}
+
+func TestUpdateDirFromRepoStagedWriteFailure(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	files := map[string][]byte{"templates-abc123/.version": []byte("v1.0.1")}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("templates-abc123/cves/%02d.yaml", i)] = []byte(fmt.Sprintf("new %d", i))
+	}
+	fake.AddRelease(Organization+"/templates", &fakeRelease{Tag: "v1.0.1", Source: zipArchive(t, files)})
+	dir := filepath.Join(t.TempDir(), "templates")
+	writeFiles(t, dir, map[string]string{
+		".version":          "v1.0.0",
+		"cves/00.yaml":      "old 0",
+		"cves/07.yaml":      "old 7",
+		"custom/mine.yaml":  "mine",
+		"cves/removed.yaml": "removed",
+	})
+	before := snapshotDir(t, dir)
+
+	// 第 21 个文件是版本文件
+	for _, n := range []int{1, 8, 20, 21} {
+		t.Run(fmt.Sprintf("file %d", n), func(t *testing.T) {
+			enableFailpoints(t, fmt.Sprintf("%v:%d", FailpointDirWrite, n))
+			_, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{Prune: true})
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("dir-write %d failed", n)) {
+				t.Fatalf("UpdateDirFromRepo() failing file %d = %v", n, err)
+			}
+			after := snapshotDir(t, dir)
+			if fmt.Sprint(after) != fmt.Sprint(before) {
+				t.Errorf("dir changed by a failed update:\n%v\nwant\n%v", after, before)
+			}
+			checkNoStaging(t, dir)
+		})
+	}
+
+	if _, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{Prune: true, Keep: []string{"custom/*"}}); err != nil {
+		t.Fatal(err)
+	}
+	after := snapshotDir(t, dir)
+	if len(after) != 25 || after["cves/removed.yaml"] != "" || !strings.HasSuffix(after["cves/07.yaml"], "new 7") || !strings.HasSuffix(after[".version"], "v1.0.1") || after["custom/mine.yaml"] == "" {
+		t.Errorf("dir after the update = %v", after)
+	}
+	checkNoStaging(t, dir)
+}
+
+func TestUpdateDirFromRepoStagedNewDir(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	dir := filepath.Join(t.TempDir(), "nested", "templates")
+	if _, err := UpdateDirFromRepo("templates", dir, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	got := snapshotDir(t, dir)
+	for _, name := range []string{".version", "cves/new.yaml", "cves/same.yaml", "cves/change.yaml"} {
+		if got[name] == "" {
+			t.Errorf("%v missing from the new dir: %v", name, got)
+		}
+	}
+	checkNoStaging(t, dir)
+}
+
+func TestDirStageCommitRollback(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "templates")
+	writeFiles(t, dir, map[string]string{".version": "v1.0.0", "a/one.yaml": "old one", "mine.yaml": "mine"})
+	before := snapshotDir(t, dir)
+	stage, err := newDirStage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stage.cleanup()
+	written := []string{"a/one.yaml", "b/c/two.yaml", "z.yaml", TemplateVersionFile}
+	err = stage.write(context.Background(), written, func(relativePath string) error {
+		path := filepath.Join(stage.staged(), relativePath)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte("new "+relativePath), 0644)
+	})
+	if err != nil || strings.Join(stage.files, ",") != strings.Join(written, ",") {
+		t.Fatalf("write() = %v, staged %v", err, stage.files)
+	}
+	// 移动第三个文件时失败
+	if err := os.Remove(filepath.Join(stage.staged(), "z.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if err := stage.commit(context.Background()); err == nil {
+		t.Fatal("commit() of a missing staged file succeeded")
+	}
+	if after := snapshotDir(t, dir); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Errorf("dir after a failed commit:\n%v\nwant\n%v", after, before)
+	}
+}
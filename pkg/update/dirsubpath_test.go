@@ -0,0 +1,96 @@
+package updateutils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func newSubPathRelease(t *testing.T) *fakeRelease {
+	return &fakeRelease{Tag: "v1.0.1", Source: zipArchive(t, map[string][]byte{
+		"repo-abc123/.version":                   []byte("v1.0.1"),
+		"repo-abc123/README.md":                  []byte("readme"),
+		"repo-abc123/cmd/main.go":                []byte("package main"),
+		"repo-abc123/templates/http/foo.yaml":    []byte("foo"),
+		"repo-abc123/templates/dns/bar.yaml":     []byte("bar"),
+		"repo-abc123/templates-old/http/x.yaml":  []byte("old"),
+		"repo-abc123/templates/http/x/deep.yaml": []byte("deep"),
+	})}
+}
+
+// listFiles returns the files of dir relative to it with forward slashes
+func listFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relative, _ := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(relative))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestUpdateDirFromRepoSubPath(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newSubPathRelease(t))
+
+	tests := []struct {
+		subPath string
+		want    []string
+	}{
+		{"", []string{".version", "cmd/main.go", "templates-old/http/x.yaml", "templates/dns/bar.yaml", "templates/http/foo.yaml", "templates/http/x/deep.yaml"}},
+		{"templates", []string{".version", "dns/bar.yaml", "http/foo.yaml", "http/x/deep.yaml"}},
+		{"/templates/", []string{".version", "dns/bar.yaml", "http/foo.yaml", "http/x/deep.yaml"}},
+		{"templates/http", []string{".version", "foo.yaml", "x/deep.yaml"}},
+		{`templates\http\x`, []string{".version", "deep.yaml"}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if _, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{SubPath: tt.subPath}); err != nil {
+			t.Errorf("UpdateDirFromRepo() with sub path %q = %v", tt.subPath, err)
+			continue
+		}
+		if got := listFiles(t, dir); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("files with sub path %q = %v, want %v", tt.subPath, got, tt.want)
+		}
+	}
+	dir := t.TempDir()
+	if _, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{SubPath: "templates/http"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "foo.yaml")); string(data) != "foo" {
+		t.Errorf("foo.yaml = %q, want foo", data)
+	}
+}
+
+func TestUpdateDirFromRepoSubPathErrors(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newSubPathRelease(t))
+
+	for _, subPath := range []string{"missing", "templates/http/foo.yaml", "templates/ht"} {
+		dir := t.TempDir()
+		_, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{SubPath: subPath})
+		if err == nil || !strings.Contains(err.Error(), "no file of") {
+			t.Errorf("UpdateDirFromRepo() with sub path %q = %v, want no file error", subPath, err)
+		}
+		if files := listFiles(t, dir); len(files) != 0 {
+			t.Errorf("files written with sub path %q: %v", subPath, files)
+		}
+	}
+	for _, subPath := range []string{"..", "../templates", "templates/../.."} {
+		if _, err := UpdateDirFromRepo("templates", t.TempDir(), "", &DirUpdateOptions{SubPath: subPath}); err == nil || !strings.Contains(err.Error(), "invalid sub path") {
+			t.Errorf("UpdateDirFromRepo() with sub path %q = %v, want invalid sub path", subPath, err)
+		}
+	}
+}
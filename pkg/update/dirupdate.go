@@ -0,0 +1,641 @@
+package updateutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+)
+
+// ErrDirUpdateNotConfirmed is returned when the directory change set was not approved
+var ErrDirUpdateNotConfirmed = errorutil.NewWithTag("updater", "directory update was not confirmed")
+
+// DirUpdateOptions configures a directory update
+type DirUpdateOptions struct {
+	// DryRun computes the change set without writing anything, also enabled by the DryRun of Options
+	DryRun bool
+	// Confirm is asked to approve the change set before it is written, nil approves it
+	Confirm func(changes *DirChangeSet) bool
+	// PublicKey is the minisign public key verifying the release zipball, TemplatesPublicKey when empty
+	PublicKey string
+	// RequireSigned refuses releases without a valid signature, also enabled by RequireSignedTemplates
+	RequireSigned bool
+	// BinaryVersion is the version of the binary loading the templates, the pack is not installed when
+	// its min_binary is newer. Empty skips the check
+	BinaryVersion string
+	// Force installs a pack requiring a newer binary
+	Force bool
+	// Tag installs the source of the release tagged Tag instead of the latest release, also when it is older
+	Tag string
+	// Prune deletes the local files missing from the release once it is written, except those matching Keep
+	Prune bool
+	// Keep are globs of the files never pruned, e.g. user templates. A pattern without / matches the file
+	// name in any directory, one with / the path relative to the directory
+	Keep []string
+	// OnProgress is called during the download, the extraction and the writes, a last time with Done. It
+	// replaces the progress bars rendered on terminals
+	OnProgress func(progress DirUpdateProgress)
+	// BackupDir enables the backup of the files the update replaces or prunes before anything is written,
+	// to BackupDir/<timestamp>. A relative BackupDir is relative to the directory, e.g. DefaultDirBackup,
+	// and is never pruned. See RestoreDirBackup
+	BackupDir string
+	// MaxBackups is the number of backups kept in BackupDir, MaxDirBackups when 0
+	MaxBackups int
+	// Asset is the name of the release asset dir is updated from instead of the source archive, a glob
+	// like templates-*.zip matching a single asset. See GetUpdateDirFromAssetCallback
+	Asset string
+	// SubPath installs only the files under this path of the repository, e.g. templates, rooted at the
+	// directory: templates/http/a.yaml is written to <dir>/http/a.yaml. The TemplateVersionFile at the root
+	// of the repository is kept. Empty installs the whole repository
+	SubPath string
+	// Options replaces the package variables of the update when not nil, e.g. DryRun, ForceUpdate and
+	// HideProgressBar, see DefaultOptions
+	Options *Options
+}
+
+// DirChangeSet lists the files a directory update adds, modifies or deletes, paths are relative to the directory
+type DirChangeSet struct {
+	Added    []string
+	Modified []string
+	// Deleted are local files missing from the release, they are listed but only removed with Prune
+	Deleted []string
+	// Pruned are the files of Deleted removed by Prune, or which would be in a dry run
+	Pruned []string
+	// Unchanged are the files of the release identical to the local ones, they are skipped
+	Unchanged []string
+	// Bytes is the total size of the added and modified files
+	Bytes int64
+	// Egress is the bytes exchanged with github for the update per category
+	Egress map[string]egress.Usage
+	// Backup is the backup of the replaced and pruned files, empty without DirUpdateOptions.BackupDir or
+	// when the update replaced nothing
+	Backup string
+}
+
+// IsEmpty reports whether the update doesn't change anything
+func (c *DirChangeSet) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Modified) == 0 && len(c.Deleted) == 0
+}
+
+func (c *DirChangeSet) String() string {
+	builder := &strings.Builder{}
+	for _, v := range c.Added {
+		builder.WriteString(fmt.Sprintf("+ %s\n", v))
+	}
+	for _, v := range c.Modified {
+		builder.WriteString(fmt.Sprintf("~ %s\n", v))
+	}
+	for _, v := range c.Deleted {
+		builder.WriteString(fmt.Sprintf("- %s\n", v))
+	}
+	builder.WriteString(fmt.Sprintf("%d added, %d modified, %d deleted, %d unchanged, %d bytes to write", len(c.Added), len(c.Modified), len(c.Deleted), len(c.Unchanged), c.Bytes))
+	if len(c.Pruned) > 0 {
+		builder.WriteString(fmt.Sprintf(", %d to prune", len(c.Pruned)))
+	}
+	return builder.String()
+}
+
+// ConfirmDirChanges prints the change set and asks on stdin to approve it
+func ConfirmDirChanges(changes *DirChangeSet) bool {
+	updateLog.Print().Msgf("%v\n", changes)
+	return confirm("apply these changes?")
+}
+
+// incomingFile is a file of the release source
+type incomingFile struct {
+	// path is the path inside the archive
+	path string
+	data []byte
+	mode fs.FileMode
+	// link is the target of a symlink entry with / separators, empty for regular files
+	link string
+}
+
+// options returns the Options of the update, DefaultOptions when o or its Options are nil
+func (o *DirUpdateOptions) options() Options {
+	if o == nil {
+		return DefaultOptions()
+	}
+	return resolveOptions(o.Options)
+}
+
+// UpdateDirFromRepo updates dir from the source of the latest release and returns the change set. Nothing is
+// downloaded and the change set is empty when the TemplateVersionFile of dir is the release, unless ForceUpdate
+// of the options
+func UpdateDirFromRepo(toolName, dir, repoName string, opts *DirUpdateOptions) (*DirChangeSet, error) {
+	return UpdateDirFromRepoCtx(context.Background(), toolName, dir, repoName, opts)
+}
+
+// UpdateDirFromRepoCtx is UpdateDirFromRepo aborting the download and the unpacking when ctx is done,
+// nothing is written to dir once ctx is done
+func UpdateDirFromRepoCtx(ctx context.Context, toolName, dir, repoName string, opts *DirUpdateOptions) (*DirChangeSet, error) {
+	if opts == nil {
+		opts = &DirUpdateOptions{}
+	}
+	if err := updateCheckDisabled(toolName); err != nil {
+		return &DirChangeSet{}, err
+	}
+	progress := newDirProgress(opts.OnProgress)
+	changes, err := updateDirFromRepo(ctx, toolName, dir, repoName, opts, progress)
+	progress.finish(err)
+	return changes, err
+}
+
+// updateDirFromRepo is UpdateDirFromRepoCtx reporting to progress
+func updateDirFromRepo(ctx context.Context, toolName, dir, repoName string, opts *DirUpdateOptions, progress *dirProgress) (*DirChangeSet, error) {
+	if repoName == "" {
+		repoName = toolName
+	}
+	if opts.Prune {
+		if err := checkKeepPatterns(opts.Keep); err != nil {
+			return nil, err
+		}
+	}
+	subPath, err := cleanSubPath(opts.SubPath)
+	if err != nil {
+		return nil, err
+	}
+	options := opts.options()
+	dryRun := opts.DryRun || options.DryRun
+	var downloaderOpts []DownloaderOption
+	if opts.Options != nil {
+		downloaderOpts = append(downloaderOpts, WithOptions(*opts.Options))
+	}
+	downloader, err := NewghReleaseDownloaderWithContext(ctx, repoName, downloaderOpts...)
+	if err := contextError(ctx, "update of %v cancelled", toolName); err != nil {
+		return nil, err
+	}
+	if isRateLimited(err) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to download latest release got %v", err).WithTag("updater")
+	}
+	if opts.Tag != "" {
+		if err := downloader.PinRelease(opts.Tag); err != nil {
+			return nil, err
+		}
+	}
+	// 本地版本与发布相同时不下载
+	if tag := localDirVersion(dir); !options.ForceUpdate && dirUpToDate(tag, downloader.Latest.GetTagName(), opts.Tag != "") {
+		if !dryRun {
+			updateLog.Info().Label("updater").Msgf("%v in %v already up to date (%v)", toolName, dir, tag)
+		}
+		return &DirChangeSet{}, nil
+	}
+	incoming := map[string]*incomingFile{}
+	collect := collectIncomingUnder(incoming, subPath)
+	callback := func(path string, f fs.FileInfo, data io.Reader) error {
+		progress.extracted(path)
+		return collect(path, f, data)
+	}
+	if err := downloader.checkFingerprint(nil); err != nil {
+		return nil, err
+	}
+	// 有回调时不显示进度条
+	showProgressBar := downloader.showProgress(progress == nil)
+	progress.phase(DirPhaseDownload, 0)
+	if progress != nil {
+		downloader.sourceProgress = progress.downloaded
+	}
+	if opts.Asset != "" {
+		if err := downloader.unpackDirAsset(ctx, opts, showProgressBar, progress, callback); err != nil {
+			return nil, err
+		}
+	} else {
+		source, err := downloader.DownloadSourceCtx(ctx, showProgressBar)
+		if err := contextError(ctx, "update of %v cancelled", toolName); err != nil {
+			return nil, err
+		}
+		if isRateLimited(err) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, errorutil.NewWithErr(err).Msgf("failed to download latest release got %v", err)
+		}
+		// 解压前校验签名
+		if err := verifySource(downloader, source, downloader.repoName+Zip.FileExtension(), SourceSignatureAssetName, opts); err != nil {
+			return nil, err
+		}
+		progress.phase(DirPhaseExtract, zipEntries(source))
+		err = unpackSource(ctx, downloader.repoName, source, showProgressBar, ExtractWorkers, callback)
+		if err := contextError(ctx, "update of %v cancelled", toolName); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, errorutil.NewWithErr(err).Msgf("failed to unpack latest release got %v", err)
+		}
+	}
+	matched := len(incoming)
+	if _, ok := incoming[TemplateVersionFile]; ok {
+		matched--
+	}
+	if subPath != "" && matched == 0 {
+		return nil, errorutil.NewWithTag("updater", "no file of %v %v under %v", repoName, downloader.Latest.GetTagName(), opts.SubPath)
+	}
+
+	var skipped []string
+	if opts.BackupDir != "" {
+		skipped = append(skipped, backupSkipped(dir, dirBackupRoot(dir, opts.BackupDir)))
+	}
+	changes, err := diffDir(dir, incoming, skipped...)
+	if err != nil {
+		return nil, err
+	}
+	changes.Egress = downloader.Egress()
+	progress.skipped(len(changes.Unchanged))
+	if err := checkIncomingTemplates(incoming, downloader.Latest.GetTagName(), opts); err != nil {
+		return changes, err
+	}
+	if opts.Prune {
+		if changes.Pruned, err = prunedFiles(changes.Deleted, opts.Keep); err != nil {
+			return changes, err
+		}
+	}
+	if dryRun {
+		return changes, nil
+	}
+	if opts.Confirm != nil && !changes.IsEmpty() && !opts.Confirm(changes) {
+		return changes, ErrDirUpdateNotConfirmed
+	}
+	if opts.BackupDir != "" {
+		if changes.Backup, err = backupDir(dir, dirBackupRoot(dir, opts.BackupDir), changes, opts.MaxBackups); err != nil {
+			return changes, err
+		}
+		if changes.Backup != "" {
+			updateLog.Info().Label("updater").Msgf("backed up %d files of %v to %v", len(changes.Modified)+len(changes.Pruned), dir, changes.Backup)
+		}
+	}
+	written, err := writeDirChanges(ctx, dir, incoming, changes, options.ForceUpdate, progress)
+	if err != nil {
+		return changes, err
+	}
+	// 只在完整下载并写入发布后删除文件
+	if err := pruneDir(ctx, dir, changes.Pruned); err != nil {
+		return changes, err
+	}
+	if opts.Prune {
+		updateLog.Info().Label("updater").Msgf("updated %v in %v: %d added, %d updated, %d pruned", toolName, dir, len(changes.Added), len(changes.Modified), len(changes.Pruned))
+	}
+	if options.ForceUpdate {
+		updateLog.Info().Label("updater").Msgf("reinstalled %v %v in %v (%d files)", toolName, downloader.Latest.GetTagName(), dir, written)
+	}
+	if subPath != "" {
+		updateLog.Info().Label("updater").Msgf("updated %v %v in %v from %v: %d files matched, %d written", toolName, downloader.Latest.GetTagName(), dir, opts.SubPath, matched, written)
+	}
+	return changes, nil
+}
+
+// localDirVersion returns the tag of the TemplateVersionFile of dir, empty when it is missing or corrupt
+func localDirVersion(dir string) string {
+	version, err := ReadTemplateVersion(dir)
+	if err != nil {
+		updateLog.Verbose().Msgf("ignoring %v of %v: %v", TemplateVersionFile, dir, err)
+		return ""
+	}
+	if version == nil {
+		return ""
+	}
+	return version.Tag
+}
+
+// dirUpToDate reports whether a dir holding local doesn't need the release tagged latest, compared like
+// IsOutdated. A pinned release is only skipped when it is the installed one, also when it is older
+func dirUpToDate(local, latest string, pinned bool) bool {
+	if local == "" || latest == "" {
+		return false
+	}
+	if pinned {
+		return !IsOutdated(local, latest) && !IsOutdated(latest, local)
+	}
+	return !IsOutdated(local, latest)
+}
+
+// collectIncoming returns the callback unpacking the files of a release source into incoming, safe for
+// concurrent use
+func collectIncoming(incoming map[string]*incomingFile) AssetFileCallback {
+	return collectIncomingUnder(incoming, "")
+}
+
+// cleanSubPath returns the SubPath of a directory update with the separators of the os, an error when it
+// isn't a relative path inside the repository
+func cleanSubPath(subPath string) (string, error) {
+	subPath = strings.Trim(strings.ReplaceAll(subPath, "\\", "/"), "/")
+	if subPath == "" {
+		return "", nil
+	}
+	cleaned := filepath.FromSlash(path.Clean(subPath))
+	if !filepath.IsLocal(cleaned) || cleaned == "." {
+		return "", errorutil.NewWithTag("updater", "invalid sub path %v, it must be a relative path inside the repository", subPath)
+	}
+	return cleaned, nil
+}
+
+// underSubPath returns relativePath re-rooted at subPath, false when it is outside of it. The root
+// TemplateVersionFile is always kept
+func underSubPath(relativePath, subPath string) (string, bool) {
+	if subPath == "" || relativePath == TemplateVersionFile {
+		return relativePath, true
+	}
+	if !strings.HasPrefix(relativePath, subPath+string(filepath.Separator)) {
+		return "", false
+	}
+	return relativePath[len(subPath)+1:], true
+}
+
+// collectIncomingUnder is collectIncoming of the files under subPath only, rooted at subPath
+func collectIncomingUnder(incoming map[string]*incomingFile, subPath string) AssetFileCallback {
+	var mutex sync.Mutex
+	return func(path string, f fs.FileInfo, data io.Reader) error {
+		if f.IsDir() {
+			return nil
+		}
+		// 拒绝会写到目录之外的条目, 不列入变更
+		if err := checkArchivePath(path); err != nil {
+			return err
+		}
+		relativePath, skipFile := calculateTemplateRelativePath(path)
+		if skipFile {
+			return nil
+		}
+		if !filepath.IsLocal(relativePath) {
+			return newUpdateError(ErrUnsafeArchivePath, "archive entry %v resolves outside of the directory", path)
+		}
+		relativePath, ok := underSubPath(relativePath, subPath)
+		if !ok {
+			return nil
+		}
+		bin, err := io.ReadAll(data)
+		if err != nil {
+			// if error occurs, iteration also stops
+			return errorutil.NewWithErr(err).Msgf("failed to read file %s", relativePath)
+		}
+		file := &incomingFile{path: path, data: bin, mode: f.Mode()}
+		if f.Mode()&fs.ModeSymlink != 0 {
+			link := linkTarget(f, bin)
+			if err := checkLinkTarget(path, relativePath, link); err != nil {
+				return err
+			}
+			file.link, file.data = strings.ReplaceAll(link, "\\", "/"), nil
+		}
+		mutex.Lock()
+		incoming[relativePath] = file
+		mutex.Unlock()
+		return nil
+	}
+}
+
+// writeDirChanges writes the added and modified files of changes to dir, all the incoming files with
+// force, and returns the number of files written. The files are written to a staging dir first and
+// moved into dir once all were written, TemplateVersionFile last: dir is left untouched when writing fails
+func writeDirChanges(ctx context.Context, dir string, incoming map[string]*incomingFile, changes *DirChangeSet, force bool, progress *dirProgress) (int, error) {
+	written := dirWriteOrder(incoming, changes, force)
+	progress.phase(DirPhaseWrite, len(written))
+	if len(written) == 0 {
+		return 0, nil
+	}
+	stage, err := newDirStage(dir)
+	if err != nil {
+		return 0, err
+	}
+	defer stage.cleanup()
+	paths := make(map[string]string, len(written))
+	dirs := map[string]struct{}{}
+	for _, relativePath := range written {
+		// 按相对路径写入, 相对路径可能已按 SubPath 调整
+		if !filepath.IsLocal(relativePath) {
+			return 0, newUpdateError(ErrUnsafeArchivePath, "archive entry %v resolves outside of %v", incoming[relativePath].path, dir)
+		}
+		templateAbsolutePath := filepath.Join(stage.staged(), relativePath)
+		paths[relativePath] = templateAbsolutePath
+		dirs[filepath.Dir(templateAbsolutePath)] = struct{}{}
+	}
+	// 每个目录只创建一次
+	for templateDirectory := range dirs {
+		if err := makeTemplateDir(templateDirectory); err != nil {
+			return 0, err
+		}
+	}
+	write := func(relativePath string) error {
+		file, templateAbsolutePath := incoming[relativePath], paths[relativePath]
+		var err error
+		if file.link != "" {
+			err = writeIncomingLink(templateAbsolutePath, relativePath, file, incoming)
+		} else {
+			err = writeIncomingFile(templateAbsolutePath, file, force)
+		}
+		if err != nil {
+			return errorutil.NewWithErr(err).Msgf("failed to write file %s", filepath.Join(dir, relativePath))
+		}
+		progress.written(relativePath)
+		return nil
+	}
+	if err := stage.write(ctx, written, write); err != nil {
+		return 0, err
+	}
+	if err := stage.commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(written), nil
+}
+
+// dirWriteOrder returns the files writeDirChanges writes in order, every incoming file with force and
+// TemplateVersionFile last so that an interrupted update isn't taken for an up to date dir
+func dirWriteOrder(incoming map[string]*incomingFile, changes *DirChangeSet, force bool) []string {
+	written := append(append([]string{}, changes.Added...), changes.Modified...)
+	if force {
+		// 重新写入全部文件, 包括未变化的文件
+		written = written[:0]
+		for relativePath := range incoming {
+			written = append(written, relativePath)
+		}
+		sort.Strings(written)
+	}
+	sort.SliceStable(written, func(i, j int) bool {
+		return written[i] != TemplateVersionFile && written[j] == TemplateVersionFile
+	})
+	return written
+}
+
+// prunedFiles returns the deleted files not matching the keep globs
+func prunedFiles(deleted, keep []string) ([]string, error) {
+	if err := checkKeepPatterns(keep); err != nil {
+		return nil, err
+	}
+	var pruned []string
+	for _, relativePath := range deleted {
+		if !keepFile(keep, filepath.ToSlash(relativePath)) {
+			pruned = append(pruned, relativePath)
+		}
+	}
+	return pruned, nil
+}
+
+// checkKeepPatterns returns an error for the first invalid keep glob
+func checkKeepPatterns(keep []string) error {
+	for _, pattern := range keep {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errorutil.NewWithErr(err).Msgf("invalid keep pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// keepFile reports whether the slash separated relative path matches one of the keep globs
+func keepFile(keep []string, relativePath string) bool {
+	for _, pattern := range keep {
+		name := relativePath
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(relativePath)
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneDir removes the pruned files from dir and the directories they leave empty, never anything outside of dir
+func pruneDir(ctx context.Context, dir string, pruned []string) error {
+	for _, relativePath := range pruned {
+		if err := contextError(ctx, "update of %v cancelled", dir); err != nil {
+			return err
+		}
+		if !filepath.IsLocal(relativePath) {
+			return newUpdateError(ErrUnsafeArchivePath, "refusing to prune %v outside of %v", relativePath, dir)
+		}
+		if err := os.Remove(filepath.Join(dir, relativePath)); err != nil && !os.IsNotExist(err) {
+			return errorutil.NewWithErr(err).Msgf("failed to prune file %s", relativePath)
+		}
+		for parent := filepath.Dir(relativePath); parent != "."; parent = filepath.Dir(parent) {
+			// 目录不为空时删除失败, 停止向上
+			if os.Remove(filepath.Join(dir, parent)) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// checkIncomingTemplates warns when the binary can't load the incoming pack, the pack is refused unless
+// forced or in a dry run
+func checkIncomingTemplates(incoming map[string]*incomingFile, release string, opts *DirUpdateOptions) error {
+	file, ok := incoming[TemplateVersionFile]
+	if !ok || opts.BinaryVersion == "" {
+		return nil
+	}
+	version, err := ParseTemplateVersion(file.data)
+	if err == nil {
+		err = version.Compatible(opts.BinaryVersion)
+	}
+	if err == nil {
+		return nil
+	}
+	updateLog.Warning().Msgf("release %v: %v", release, err)
+	if opts.Force || opts.DryRun {
+		return nil
+	}
+	return errorutil.NewWithErr(err).Msgf("templates of release %v were not installed, force the update to install them anyway", release)
+}
+
+// verifySource checks the signature of the release archive named archiveName, the zipball or an asset, held
+// by the asset signatureName against the pinned public key
+func verifySource(downloader *GHReleaseDownloader, source []byte, archiveName, signatureName string, opts *DirUpdateOptions) error {
+	publicKey := opts.PublicKey
+	if publicKey == "" {
+		publicKey = TemplatesPublicKey
+	}
+	required := opts.RequireSigned || RequireSignedTemplates
+	release := downloader.Latest.GetTagName()
+	if publicKey == "" {
+		if required {
+			return errorutil.NewWithErr(ErrUnsignedRelease).Msgf("signed releases are required but no public key is pinned, set TemplatesPublicKey to the minisign public key of the release signer")
+		}
+		return nil
+	}
+	key, err := ParseMinisignPublicKey(publicKey)
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("invalid pinned public key")
+	}
+	if !downloader.HasAsset(signatureName) {
+		if required {
+			return errorutil.NewWithErr(ErrUnsignedRelease).Msgf("release %v has no %v asset, ask the maintainers to publish `minisign -S -m %v` or disable RequireSignedTemplates", release, signatureName, archiveName)
+		}
+		updateLog.Warning().Msgf("%v of release %v of %v is not signed, skipping signature verification", archiveName, release, downloader.repoName)
+		return nil
+	}
+	signature, err := downloader.DownloadAssetWithName(signatureName, false)
+	if err != nil {
+		return err
+	}
+	if err := key.Verify(source, signature.String()); err != nil {
+		return errorutil.NewWithErr(err).Msgf("signature verification of release %v failed, the release was not extracted", release)
+	}
+	updateLog.Verbose().Msgf("verified signature of release %v of %v", release, downloader.repoName)
+	return nil
+}
+
+// diffDir compares the incoming files with the content of dir, the skipped dirs are not compared
+func diffDir(dir string, incoming map[string]*incomingFile, skipped ...string) (*DirChangeSet, error) {
+	changes := &DirChangeSet{}
+	for relativePath, file := range incoming {
+		same, err := localMatches(filepath.Join(dir, relativePath), file)
+		switch {
+		case os.IsNotExist(err):
+			changes.Added = append(changes.Added, relativePath)
+		case err != nil:
+			return nil, errorutil.NewWithErr(err).Msgf("failed to read file %s", relativePath)
+		case same:
+			changes.Unchanged = append(changes.Unchanged, relativePath)
+			continue
+		default:
+			changes.Modified = append(changes.Modified, relativePath)
+		}
+		changes.Bytes += int64(len(file.data))
+	}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			for _, skip := range skipped {
+				if skip != "" && filepath.Clean(skip) == filepath.Clean(path) {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		// 与 calculateTemplateRelativePath 相同的规则跳过的文件不视为删除
+		if _, skipFile := calculateTemplateRelativePath(filepath.Join("root", relativePath)); skipFile {
+			return nil
+		}
+		if _, ok := incoming[relativePath]; !ok {
+			changes.Deleted = append(changes.Deleted, relativePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Modified)
+	sort.Strings(changes.Deleted)
+	sort.Strings(changes.Unchanged)
+	return changes, nil
+}
@@ -0,0 +1,630 @@
+package updateutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+)
+
+func newTemplatesRelease(t *testing.T) *fakeRelease {
+	return &fakeRelease{Tag: "v1.0.1", Source: zipArchive(t, map[string][]byte{
+		"templates-abc123/.version":         []byte("v1.0.1"),
+		"templates-abc123/README.md":        []byte("readme"),
+		"templates-abc123/cves/new.yaml":    []byte("new"),
+		"templates-abc123/cves/same.yaml":   []byte("same"),
+		"templates-abc123/cves/change.yaml": []byte("changed"),
+	})}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpdateDirFromRepoDryRun(t *testing.T) {
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"cves/same.yaml": "same", "cves/change.yaml": "old", "cves/gone.yaml": "gone", ".version": "v1.0.0"})
+
+	changes, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Egress[egress.UpdaterDownload].Received < int64(len(fake.releases[Organization+"/templates"].Source)) {
+		t.Errorf("UpdateDirFromRepo() egress = %+v, want the zipball counted", changes.Egress)
+	}
+	changes.Egress = nil
+	want := &DirChangeSet{
+		Added:     []string{"cves/new.yaml"},
+		Modified:  []string{".version", "cves/change.yaml"},
+		Deleted:   []string{"cves/gone.yaml"},
+		Unchanged: []string{"cves/same.yaml"},
+		Bytes:     int64(len("new") + len("v1.0.1") + len("changed")),
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("UpdateDirFromRepo() = %+v, want %+v", changes, want)
+	}
+	// dry-run 不应写入任何文件
+	if _, err := os.Stat(filepath.Join(dir, "cves/new.yaml")); !os.IsNotExist(err) {
+		t.Error("dry-run wrote cves/new.yaml")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "cves/change.yaml")); string(data) != "old" {
+		t.Errorf("dry-run modified cves/change.yaml to %q", data)
+	}
+}
+
+func TestUpdateDirFromRepoConfirm(t *testing.T) {
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"cves/change.yaml": "old"})
+
+	_, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{Confirm: func(changes *DirChangeSet) bool { return false }})
+	if err != ErrDirUpdateNotConfirmed {
+		t.Fatalf("UpdateDirFromRepo() = %v, want %v", err, ErrDirUpdateNotConfirmed)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "cves/change.yaml")); string(data) != "old" {
+		t.Errorf("rejected update modified cves/change.yaml to %q", data)
+	}
+
+	if err := GetUpdateDirFromRepoCallback("templates", dir, "")(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"cves/new.yaml": "new", "cves/change.yaml": "changed", ".version": "v1.0.1"} {
+		if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "README.md")); !os.IsNotExist(err) {
+		t.Error("README.md should be skipped")
+	}
+}
+
+func TestGetUpdateDirFromRepoCheckCallback(t *testing.T) {
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"cves/change.yaml": "old"})
+
+	if err := GetUpdateDirFromRepoCheckCallback("templates", dir, "")(); !errors.Is(err, ErrUpdateAvailable) {
+		t.Fatalf("GetUpdateDirFromRepoCheckCallback() = %v, want %v", err, ErrUpdateAvailable)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "cves/change.yaml")); string(data) != "old" {
+		t.Errorf("dry run modified cves/change.yaml to %q", data)
+	}
+	// 全局 DryRun 同样不写入
+	DryRun = true
+	err := GetUpdateDirFromRepoCallback("templates", dir, "")()
+	DryRun = false
+	if !errors.Is(err, ErrUpdateAvailable) {
+		t.Fatalf("GetUpdateDirFromRepoCallback() with DryRun = %v, want %v", err, ErrUpdateAvailable)
+	}
+	if err := GetUpdateDirFromRepoCallback("templates", dir, "")(); err != nil {
+		t.Fatal(err)
+	}
+	if err := GetUpdateDirFromRepoCheckCallback("templates", dir, "")(); !errors.Is(err, ErrAlreadyLatest) {
+		t.Errorf("GetUpdateDirFromRepoCheckCallback() of an updated dir = %v, want %v", err, ErrAlreadyLatest)
+	}
+}
+
+func TestUpdateDirFromRepoForce(t *testing.T) {
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"cves/same.yaml": "same", ".version": "v1.0.1"})
+	before, err := os.Stat(filepath.Join(dir, "cves/same.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	force := ForceUpdate
+	ForceUpdate = true
+	defer func() { ForceUpdate = force }()
+
+	if err := GetUpdateDirFromRepoCallback("templates", dir, "")(); err != nil {
+		t.Fatal(err)
+	}
+	// 内容相同的文件也被原子替换
+	after, err := os.Stat(filepath.Join(dir, "cves/same.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.SameFile(before, after) {
+		t.Error("cves/same.yaml was not rewritten")
+	}
+}
+
+func TestUpdateDirFromRepoCancel(t *testing.T) {
+	started := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1048576")
+		_, _ = w.Write(make([]byte, 1024))
+		w.(http.Flusher).Flush()
+		close(started)
+		// 缓慢传输, 直到客户端断开
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", &fakeRelease{Tag: "v1.0.1", ZipballURL: slow.URL})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error)
+	go func() { errs <- GetUpdateDirFromRepoCallbackCtx(ctx, "templates", t.TempDir(), "")() }()
+	<-started
+	cancelled := time.Now()
+	cancel()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled update = %v, want %v", err, context.Canceled)
+		}
+		if elapsed := time.Since(cancelled); elapsed > 100*time.Millisecond {
+			t.Errorf("cancelled update returned after %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled update did not return")
+	}
+}
+
+// cancelAfterLookup cancels the update once the lookup of the latest release has succeeded
+type cancelAfterLookup struct {
+	base   http.RoundTripper
+	cancel context.CancelFunc
+}
+
+func (c *cancelAfterLookup) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := c.base.RoundTrip(req)
+	if err != nil || !strings.HasSuffix(req.URL.Path, "/releases/latest") {
+		return resp, err
+	}
+	// 读完响应再取消, 查询本身成功
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	c.cancel()
+	return resp, nil
+}
+
+func TestUpdateCancelledAfterLookup(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	fake.AddRelease(Organization+"/cancelled", newToolRelease(t, "cancelled", "v1.1.0", []byte("bin-cancelled")))
+	fakeExecutable(t, "cancelled")
+	dryRun := DryRun
+	t.Cleanup(func() { DryRun = dryRun })
+
+	tests := []struct {
+		name   string
+		dryRun bool
+		update func(ctx context.Context) func() error
+	}{
+		{name: "dir dry run", dryRun: true, update: func(ctx context.Context) func() error {
+			return GetUpdateDirFromRepoCallbackCtx(ctx, "templates", t.TempDir(), "")
+		}},
+		{name: "dir", update: func(ctx context.Context) func() error {
+			return GetUpdateDirFromRepoCallbackCtx(ctx, "templates", t.TempDir(), "")
+		}},
+		{name: "tool", update: func(ctx context.Context) func() error {
+			return GetUpdateToolFromRepoCallbackWithErrorCtx(ctx, "cancelled", "v1.0.0", "")
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			api := apiTransportBase
+			apiTransportBase = &cancelAfterLookup{base: api, cancel: cancel}
+			defer func() { apiTransportBase = api }()
+			DryRun = test.dryRun
+
+			if err := test.update(ctx)(); !errors.Is(err, context.Canceled) {
+				t.Errorf("update cancelled after the lookup = %v, want %v", err, context.Canceled)
+			}
+		})
+	}
+}
+
+func TestUnpackAssetWithCallbackCtx(t *testing.T) {
+	archive := zipArchive(t, map[string][]byte{"a": []byte("a"), "b": []byte("b"), "c": []byte("c")})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	files := 0
+	err := UnpackAssetWithCallbackCtx(ctx, Zip, bytes.NewReader(archive), func(string, fs.FileInfo, io.Reader) error {
+		files++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || files != 1 {
+		t.Errorf("UnpackAssetWithCallbackCtx() = %v after %d files, want %v after 1", err, files, context.Canceled)
+	}
+}
+
+func TestCheckArchivePath(t *testing.T) {
+	tests := []struct {
+		name   string
+		unsafe bool
+	}{
+		{name: "templates-abc/cves/a.yaml"},
+		{name: "templates-abc/cves/../a.yaml"},
+		{name: "templates-abc/a..b.yaml"},
+		{name: `templates-abc\cves\a.yaml`},
+		{name: "foo/../../../../home/user/.bashrc", unsafe: true},
+		{name: "../a.yaml", unsafe: true},
+		{name: "/etc/passwd", unsafe: true},
+		// windows 路径语义
+		{name: `foo\..\..\Users\user\.bashrc`, unsafe: true},
+		{name: `C:\Windows\system32\a.dll`, unsafe: true},
+		{name: "c:/Windows/a.dll", unsafe: true},
+		{name: `\\server\share\a.yaml`, unsafe: true},
+	}
+	for _, test := range tests {
+		err := checkArchivePath(test.name)
+		if test.unsafe != errors.Is(err, ErrUnsafeArchivePath) || (err == nil) == test.unsafe {
+			t.Errorf("checkArchivePath(%q) = %v, want unsafe %v", test.name, err, test.unsafe)
+		}
+		if err != nil && !strings.Contains(err.Error(), test.name) {
+			t.Errorf("checkArchivePath(%q) = %v, want the entry named", test.name, err)
+		}
+	}
+}
+
+func TestCalculateTemplateAbsolutePath(t *testing.T) {
+	dir := t.TempDir()
+	got, skip, err := calculateTemplateAbsolutePath("templates-abc/cves/a.yaml", dir)
+	if err != nil || skip || got != filepath.Join(dir, "cves", "a.yaml") {
+		t.Errorf("calculateTemplateAbsolutePath() = %v, %v, %v", got, skip, err)
+	}
+	// 去掉根目录后以 .. 开头的条目被跳过
+	if _, skip, err := calculateTemplateAbsolutePath("templates-abc/../cves/a.yaml", dir); err != nil || !skip {
+		t.Errorf("calculateTemplateAbsolutePath() of an entry above the root = %v, %v, want it skipped", skip, err)
+	}
+	if _, _, err := calculateTemplateAbsolutePath("templates-abc/../../a.yaml", dir); !errors.Is(err, ErrUnsafeArchivePath) {
+		t.Errorf("calculateTemplateAbsolutePath() of an escaping entry = %v, want %v", err, ErrUnsafeArchivePath)
+	}
+}
+
+func TestUpdateDirFromRepoZipSlip(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", &fakeRelease{Tag: "v1.0.1", Source: zipArchive(t, map[string][]byte{
+		"templates-abc/cves/a.yaml":             []byte("a"),
+		"templates-abc/../../escaped/evil.yaml": []byte("evil"),
+	})})
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "a", "templates")
+	_, err := UpdateDirFromRepo("templates", dir, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "templates-abc/../../escaped/evil.yaml") {
+		t.Fatalf("UpdateDirFromRepo() of a hostile zip = %v, want the entry named", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "escaped")); !os.IsNotExist(err) {
+		t.Errorf("hostile entry was written outside of the directory: %v", err)
+	}
+}
+
+func TestUpdateDirFromRepoPrune(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	dir := t.TempDir()
+	local := map[string]string{
+		"cves/same.yaml": "same", "cves/gone.yaml": "gone", "old/renamed.yaml": "renamed",
+		"custom/mine.yaml": "mine", "cves/notes.local.yaml": "notes",
+	}
+	writeFiles(t, dir, local)
+	opts := &DirUpdateOptions{Prune: true, Keep: []string{"custom/*", "*.local.yaml"}, DryRun: true}
+
+	changes, err := UpdateDirFromRepo("templates", dir, "", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPruned := []string{"cves/gone.yaml", "old/renamed.yaml"}
+	if !reflect.DeepEqual(changes.Pruned, wantPruned) {
+		t.Errorf("UpdateDirFromRepo() pruned = %v, want %v", changes.Pruned, wantPruned)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cves/gone.yaml")); err != nil {
+		t.Errorf("dry-run pruned cves/gone.yaml: %v", err)
+	}
+
+	opts.DryRun = false
+	if _, err := UpdateDirFromRepo("templates", dir, "", opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"cves/gone.yaml", "old/renamed.yaml", "old"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%v was not pruned: %v", name, err)
+		}
+	}
+	for _, name := range []string{"custom/mine.yaml", "cves/notes.local.yaml", "cves/new.yaml"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%v: %v", name, err)
+		}
+	}
+
+	if _, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{Prune: true, Keep: []string{"["}}); err == nil {
+		t.Error("UpdateDirFromRepo() with an invalid keep pattern succeeded")
+	}
+}
+
+func TestUpdateDirFromRepoPruneFailedDownload(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", &fakeRelease{Tag: "v1.0.1", Source: []byte("truncated zipball")})
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"cves/gone.yaml": "gone"})
+	if _, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{Prune: true}); err == nil {
+		t.Fatal("UpdateDirFromRepo() of a corrupted zipball succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cves/gone.yaml")); err != nil {
+		t.Errorf("cves/gone.yaml was pruned after a failed download: %v", err)
+	}
+}
+
+// zipEntry is an entry of modeZip, data is the target for symlinks
+type zipEntry struct {
+	name string
+	mode fs.FileMode
+	data string
+}
+
+// modeZip returns a zip archive whose entries keep their unix mode like a git zipball
+func modeZip(t *testing.T, entries ...zipEntry) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		header.SetMode(entry.mode)
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, entry.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUpdateDirFromRepoModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks and executable bits are not supported")
+	}
+	hideProgressBar(t)
+	release := &fakeRelease{Tag: "v1.0.1", Source: modeZip(t,
+		zipEntry{name: "templates-abc/cves/a.yaml", mode: 0644, data: "a"},
+		zipEntry{name: "templates-abc/helpers/run.sh", mode: 0755, data: "#!/bin/sh\n"},
+		zipEntry{name: "templates-abc/latest.yaml", mode: fs.ModeSymlink | 0777, data: "cves/a.yaml"},
+		zipEntry{name: "templates-abc/cves/run.sh", mode: fs.ModeSymlink | 0777, data: "../helpers/run.sh"},
+	)}
+	check := func(t *testing.T, dir string, wantLinks bool) {
+		for name, target := range map[string]string{"latest.yaml": "cves/a.yaml", "cves/run.sh": "../helpers/run.sh"} {
+			info, err := os.Lstat(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !wantLinks {
+				if !info.Mode().IsRegular() {
+					t.Errorf("%v = %v, want a copy of %v", name, info.Mode(), target)
+				}
+				continue
+			}
+			if got, err := os.Readlink(filepath.Join(dir, name)); err != nil || got != target {
+				t.Errorf("%v links to %q, %v, want %q", name, got, err, target)
+			}
+		}
+		for name, perm := range map[string]fs.FileMode{"helpers/run.sh": 0755, "cves/a.yaml": 0644} {
+			info, err := os.Stat(filepath.Join(dir, name))
+			if err != nil || info.Mode().Perm()&0111 != perm&0111 {
+				t.Errorf("%v mode = %v, %v, want %v", name, info.Mode(), err, perm)
+			}
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, "cves/run.sh")); err != nil || string(data) != "#!/bin/sh\n" {
+			t.Errorf("cves/run.sh = %q, %v", data, err)
+		}
+	}
+
+	t.Run("symlinks", func(t *testing.T) {
+		fake := newFakeGitHub(t)
+		fake.AddRelease(Organization+"/templates", release)
+		dir := t.TempDir()
+		// 本地为普通文件, 仅可执行位不同
+		writeFiles(t, dir, map[string]string{"latest.yaml": "a", "helpers/run.sh": "#!/bin/sh\n"})
+		if _, err := UpdateDirFromRepo("templates", dir, "", nil); err != nil {
+			t.Fatal(err)
+		}
+		check(t, dir, true)
+		changes, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{DryRun: true})
+		if err != nil || len(changes.Added)+len(changes.Modified) != 0 {
+			t.Errorf("UpdateDirFromRepo() after the update = %v, %v, want no changes", changes, err)
+		}
+	})
+	t.Run("without symlinks", func(t *testing.T) {
+		fake := newFakeGitHub(t)
+		fake.AddRelease(Organization+"/templates", release)
+		create := symlink
+		symlink = func(string, string) error { return errors.New("operation not supported") }
+		defer func() { symlink = create }()
+		dir := t.TempDir()
+		if _, err := UpdateDirFromRepo("templates", dir, "", nil); err != nil {
+			t.Fatal(err)
+		}
+		check(t, dir, false)
+	})
+	t.Run("hostile target", func(t *testing.T) {
+		fake := newFakeGitHub(t)
+		fake.AddRelease(Organization+"/templates", &fakeRelease{Tag: "v1.0.1", Source: modeZip(t,
+			zipEntry{name: "templates-abc/cves/a.yaml", mode: 0644, data: "a"},
+			zipEntry{name: "templates-abc/cves/passwd", mode: fs.ModeSymlink | 0777, data: "../../etc/passwd"},
+		)})
+		dir := t.TempDir()
+		_, err := UpdateDirFromRepo("templates", dir, "", nil)
+		if err == nil || !strings.Contains(err.Error(), "templates-abc/cves/passwd") {
+			t.Fatalf("UpdateDirFromRepo() of a zip linking outside = %v, want the entry named", err)
+		}
+		if _, err := os.Lstat(filepath.Join(dir, "cves/passwd")); !os.IsNotExist(err) {
+			t.Errorf("hostile symlink was created: %v", err)
+		}
+	})
+}
+
+func TestCheckLinkTarget(t *testing.T) {
+	tests := []struct {
+		path string
+		link string
+		safe bool
+	}{
+		{path: "latest.yaml", link: "cves/a.yaml", safe: true},
+		{path: "cves/run.sh", link: "../helpers/run.sh", safe: true},
+		{path: "cves/a.yaml", link: "../../a.yaml"},
+		{path: "a.yaml", link: "/etc/passwd"},
+		{path: "a.yaml", link: `C:\Windows`},
+		{path: "cves/a.yaml", link: `..\..\a.yaml`},
+		{path: "a.yaml", link: ""},
+	}
+	for _, test := range tests {
+		err := checkLinkTarget(test.path, filepath.FromSlash(test.path), test.link)
+		if (err == nil) != test.safe || (err != nil && !errors.Is(err, ErrUnsafeArchivePath)) {
+			t.Errorf("checkLinkTarget(%v -> %v) = %v, want safe %v", test.path, test.link, err, test.safe)
+		}
+	}
+	// tar 的链接目标在头部
+	header := &tar.Header{Name: "latest.yaml", Typeflag: tar.TypeSymlink, Linkname: "cves/a.yaml", Mode: 0777}
+	if got := linkTarget(header.FileInfo(), nil); got != "cves/a.yaml" {
+		t.Errorf("linkTarget() of a tar symlink = %q, want cves/a.yaml", got)
+	}
+}
+
+func TestUpdateDirFromRepoUpToDate(t *testing.T) {
+	hideProgressBar(t)
+	tests := []struct {
+		name         string
+		version      string
+		tag          string
+		force        bool
+		wantDownload bool
+	}{
+		{name: "missing", wantDownload: true},
+		{name: "stale", version: "v1.0.0", wantDownload: true},
+		{name: "equal", version: "v1.0.1"},
+		{name: "equal json", version: `{"tag": "v1.0.1"}`},
+		{name: "newer", version: "v1.0.2"},
+		{name: "corrupt", version: `{"tag": `, wantDownload: true},
+		{name: "garbage", version: "not a version", wantDownload: true},
+		{name: "forced", version: "v1.0.1", force: true, wantDownload: true},
+		// 指定的版本比本地旧时也要安装
+		{name: "pinned older", version: "v1.0.2", tag: "v1.0.1", wantDownload: true},
+		{name: "pinned equal", version: "v1.0.1", tag: "v1.0.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeGitHub(t)
+			fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+			dir := t.TempDir()
+			if test.version != "" {
+				writeFiles(t, dir, map[string]string{".version": test.version})
+			}
+			ForceUpdate = test.force
+			defer func() { ForceUpdate = false }()
+
+			if _, err := UpdateDirFromRepo("templates", dir, "", &DirUpdateOptions{Tag: test.tag}); err != nil {
+				t.Fatal(err)
+			}
+			if downloaded := fake.sourceRequests.Load() > 0; downloaded != test.wantDownload {
+				t.Errorf("source downloaded = %v, want %v", downloaded, test.wantDownload)
+			}
+			_, err := os.Stat(filepath.Join(dir, "cves/new.yaml"))
+			if (err == nil) != test.wantDownload {
+				t.Errorf("cves/new.yaml written = %v, want %v", err == nil, test.wantDownload)
+			}
+		})
+	}
+}
+
+func TestDirWriteOrder(t *testing.T) {
+	incoming := map[string]*incomingFile{".version": {}, "a.yaml": {}, "cves/b.yaml": {}, "same.yaml": {}}
+	changes := &DirChangeSet{Added: []string{".version", "cves/b.yaml"}, Modified: []string{"a.yaml"}, Unchanged: []string{"same.yaml"}}
+	if got, want := dirWriteOrder(incoming, changes, false), []string{"cves/b.yaml", "a.yaml", ".version"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dirWriteOrder() = %v, want %v", got, want)
+	}
+	if got, want := dirWriteOrder(incoming, changes, true), []string{"a.yaml", "cves/b.yaml", "same.yaml", ".version"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dirWriteOrder() with force = %v, want %v", got, want)
+	}
+}
+
+func TestUpdateDirFromRepoProgress(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	release := newTemplatesRelease(t)
+	fake.AddRelease(Organization+"/templates", release)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"cves/same.yaml": "same"})
+	var events []DirUpdateProgress
+	opts := &DirUpdateOptions{OnProgress: func(p DirUpdateProgress) { events = append(events, p) }}
+
+	if _, err := UpdateDirFromRepo("templates", dir, "", opts); err != nil {
+		t.Fatal(err)
+	}
+	var phases []string
+	for i, event := range events {
+		if event.Done != (i == len(events)-1) {
+			t.Errorf("event %d of %d Done = %v", i, len(events), event.Done)
+		}
+		if len(phases) == 0 || phases[len(phases)-1] != event.Phase {
+			phases = append(phases, event.Phase)
+		}
+	}
+	if want := []string{DirPhaseDownload, DirPhaseExtract, DirPhaseWrite}; !reflect.DeepEqual(phases, want) {
+		t.Errorf("phases = %v, want %v", phases, want)
+	}
+	last := events[len(events)-1]
+	want := DirUpdateProgress{
+		Phase: DirPhaseWrite, TotalBytes: int64(len(release.Source)), DownloadedBytes: int64(len(release.Source)),
+		TotalFiles: 3, FilesExtracted: 5, FilesWritten: 3, FilesSkipped: 1, Done: true,
+	}
+	if !reflect.DeepEqual(last, want) {
+		t.Errorf("last progress = %+v, want %+v", last, want)
+	}
+
+	// 无需更新和失败时同样以 Done 结束
+	events = nil
+	if _, err := UpdateDirFromRepo("templates", dir, "", opts); err != nil || len(events) != 1 || !events[0].Done {
+		t.Errorf("progress of an up to date dir = %+v, %v, want a single Done", events, err)
+	}
+	events = nil
+	if _, err := UpdateDirFromRepo("missing", dir, "", opts); err == nil || len(events) != 1 || !events[0].Done || events[0].Err == nil {
+		t.Errorf("progress of a failed update = %+v, %v, want Done with the error", events, err)
+	}
+}
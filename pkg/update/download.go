@@ -0,0 +1,156 @@
+package updateutils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// DownloadRetries is the number of times a download whose length doesn't match the release is retried
+var DownloadRetries = 2
+
+// ErrLengthMismatch is returned when the downloaded asset is shorter or longer than announced, usually
+// because a proxy re-encoded or truncated it. Matched with errors.Is
+var ErrLengthMismatch = errorutil.NewWithTag("updater", "downloaded asset length mismatch")
+
+// assetSize returns the size of the asset id listed by the latest release, 0 when unknown
+func (d *GHReleaseDownloader) assetSize(id int64) int64 {
+	if d.Latest == nil {
+		return 0
+	}
+	for _, asset := range d.Latest.Assets {
+		if asset.GetID() == id {
+			return int64(asset.GetSize())
+		}
+	}
+	return 0
+}
+
+// downloadAsset downloads the asset id named name, retrying downloads whose length doesn't match or
+// whose connection failed while reading. The body is decoded as decodeBody decides with checksum, the
+// expected sha256 of the asset if known
+func (d *GHReleaseDownloader) downloadAsset(ctx context.Context, id int64, name, checksum string, showProgressBar bool) ([]byte, error) {
+	return retryDownload(ctx, name, func() ([]byte, error) {
+		return d.downloadAssetOnce(ctx, id, name, checksum, showProgressBar)
+	})
+}
+
+// retryDownload runs download up to DownloadRetries more times while its body is truncated or
+// interrupted, the interrupted ones after the backoff of the retries
+func retryDownload(ctx context.Context, name string, download func() ([]byte, error)) ([]byte, error) {
+	var err error
+	for attempt := 0; attempt <= DownloadRetries; attempt++ {
+		if attempt > 0 {
+			updateLog.Info().Label("updater").Msgf("retrying download of %v (%d/%d): %s", name, attempt, DownloadRetries, err)
+			if errors.Is(err, errInterrupted) {
+				if waitErr := waitRetry(ctx, retryDelay(attempt)); waitErr != nil {
+					return nil, err
+				}
+			}
+		}
+		var bin []byte
+		if bin, err = download(); !errors.Is(err, ErrLengthMismatch) && !errors.Is(err, errInterrupted) || ctx.Err() != nil {
+			return bin, err
+		}
+	}
+	return nil, err
+}
+
+func (d *GHReleaseDownloader) downloadAssetOnce(ctx context.Context, id int64, name, checksum string, showProgressBar bool) ([]byte, error) {
+	size := d.assetSize(id)
+	start := time.Now()
+	resp, err := d.downloadAssetwithID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := readBody(resp, name, start, size, d.showProgress(showProgressBar))
+	encoding := resp.Header.Get("Content-Encoding")
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, lengthMismatch(name, "the connection was closed before Content-Length "+fmt.Sprint(resp.ContentLength)+" bytes", encoding)
+	}
+	if err != nil && networkError(err) && ctx.Err() == nil {
+		return nil, newUpdateError(errInterrupted, "download of %v interrupted: %v", name, err)
+	}
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to read response body")
+	}
+	bin, err := decodeBody(raw, encoding, name, checksum)
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 && int64(len(bin)) != size {
+		return nil, lengthMismatch(name, fmt.Sprintf("got %d bytes (%d received, Content-Length %d) but the release lists %d", len(bin), len(raw), resp.ContentLength, size), encoding)
+	}
+	return bin, nil
+}
+
+// lengthMismatch returns the ErrLengthMismatch of the download of name
+func lengthMismatch(name, detail, encoding string) error {
+	if encoding == "" {
+		encoding = "none"
+	}
+	return newUpdateError(ErrLengthMismatch, "download of %v: %v (Content-Encoding %v), a proxy between this machine and github is likely re-encoding, re-chunking or truncating downloads",
+		name, detail, encoding)
+}
+
+// decodeBody returns the asset of a body received with encoding. A body matching checksum is the
+// asset itself, e.g. a .tar.gz served as gzip encoded, and is kept. Otherwise the encoding was added
+// in transit and is decoded, a body without known checksum is kept only when the asset is gzip itself
+// or the body has no gzip header
+func decodeBody(raw []byte, encoding, name, checksum string) ([]byte, error) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" || encoding == "identity" {
+		return raw, nil
+	}
+	if checksum != "" && sha256Hex(raw) == checksum {
+		return raw, nil
+	}
+	if checksum == "" && encoding != "deflate" && isGzipAsset(name) {
+		return raw, nil
+	}
+	// 没有 gzip 头的内容只是被错误标记
+	if (encoding == "gzip" || encoding == "x-gzip") && !bytes.HasPrefix(raw, []byte{0x1f, 0x8b}) {
+		return raw, nil
+	}
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(raw))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader(raw))
+	default:
+		return nil, errorutil.NewWithTag("updater", "download of %v has the unsupported Content-Encoding %v, likely added by a proxy", name, encoding)
+	}
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("could not decode the %v Content-Encoding of %v", encoding, name)
+	}
+	defer reader.Close()
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("could not decode the %v Content-Encoding of %v", encoding, name)
+	}
+	return decoded, nil
+}
+
+func isGzipAsset(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
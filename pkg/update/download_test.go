@@ -0,0 +1,182 @@
+package updateutils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// proxyBehavior rewrites the response of the fake github as a proxy would, attempt counts from 1
+type proxyBehavior func(w http.ResponseWriter, body []byte, attempt int64)
+
+// newProxy starts a proxy in front of the downloads of fake
+func newProxy(t *testing.T, fake *fakeGitHub, behavior proxyBehavior) *atomic.Int64 {
+	var attempts atomic.Int64
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := httptest.NewRecorder()
+		fake.ServeHTTP(recorder, r)
+		if recorder.Code != http.StatusOK {
+			w.WriteHeader(recorder.Code)
+			return
+		}
+		behavior(w, recorder.Body.Bytes(), attempts.Add(1))
+	}))
+	t.Cleanup(proxy.Close)
+	fake.DownloadURL = proxy.URL
+	return &attempts
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDownloadThroughProxy(t *testing.T) {
+	hideProgressBar(t)
+	tests := []struct {
+		name     string
+		behavior proxyBehavior
+		attempts int64
+		wantErr  error
+	}{
+		{name: "direct", behavior: func(w http.ResponseWriter, body []byte, _ int64) { _, _ = w.Write(body) }, attempts: 2},
+		// 代理在传输中压缩并改为分块传输
+		{name: "gzip in transit", behavior: func(w http.ResponseWriter, body []byte, _ int64) {
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(gzipBytes(t, body))
+			w.(http.Flusher).Flush()
+		}, attempts: 2},
+		// .tar.gz 被标记为 gzip 编码, 资源本身就是压缩文件
+		{name: "asset labelled gzip", behavior: func(w http.ResponseWriter, body []byte, _ int64) {
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(body)
+		}, attempts: 2},
+		{name: "truncated once", behavior: func(w http.ResponseWriter, body []byte, attempt int64) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			if attempt == 1 {
+				_, _ = w.Write(body[:len(body)/2])
+				return
+			}
+			_, _ = w.Write(body)
+		}, attempts: 3},
+		{name: "wrong length", behavior: func(w http.ResponseWriter, body []byte, _ int64) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)-10))
+			_, _ = w.Write(body[:len(body)-10])
+		}, attempts: 1 + int64(DownloadRetries), wantErr: ErrLengthMismatch},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeGitHub(t)
+			bin := bytes.Repeat([]byte("genuine binary "), 1000)
+			fake.AddRelease(Organization+"/proxied", newToolRelease(t, "proxied", "v1.0.0", bin))
+			attempts := newProxy(t, fake, test.behavior)
+			d, err := NewghReleaseDownloader(Organization + "/proxied")
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.cache = nil
+			got, err := d.GetExecutableFromAsset()
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) || !strings.Contains(err.Error(), "proxy") {
+					t.Fatalf("GetExecutableFromAsset() = %v, want %v naming the proxy", err, test.wantErr)
+				}
+			} else if err != nil || !bytes.Equal(got, bin) {
+				t.Fatalf("GetExecutableFromAsset() = %d bytes, %v, want the verified binary", len(got), err)
+			}
+			// 校验和文件与资源各下载一次, 长度不符时重试, 校验和文件长度不符时不再下载资源
+			if n := attempts.Load(); n != test.attempts {
+				t.Errorf("proxy got %d downloads, want %d", n, test.attempts)
+			}
+		})
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	asset := []byte("checksums")
+	encoded := gzipBytes(t, asset)
+	tests := []struct {
+		name     string
+		raw      []byte
+		encoding string
+		asset    string
+		checksum string
+		want     []byte
+	}{
+		{name: "identity", raw: asset, asset: "a.txt", want: asset},
+		{name: "decoded", raw: encoded, encoding: "gzip", asset: "a.txt", want: asset},
+		{name: "decoded matching checksum", raw: encoded, encoding: "gzip", asset: "a.tar.gz", checksum: sha256Hex(asset), want: asset},
+		{name: "asset matching checksum", raw: encoded, encoding: "gzip", asset: "a.tar.gz", checksum: sha256Hex(encoded), want: encoded},
+		{name: "gzip asset without checksum", raw: encoded, encoding: "gzip", asset: "a.tar.gz", want: encoded},
+		{name: "mislabelled gzip", raw: asset, encoding: "gzip", asset: "checksums.txt", want: asset},
+	}
+	for _, test := range tests {
+		got, err := decodeBody(test.raw, test.encoding, test.asset, test.checksum)
+		if err != nil || !bytes.Equal(got, test.want) {
+			t.Errorf("decodeBody() %s = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+	if _, err := decodeBody(asset, "br", "a.txt", ""); err == nil || !strings.Contains(err.Error(), "proxy") {
+		t.Errorf("decodeBody() of an unsupported encoding = %v", err)
+	}
+}
+
+func TestChecksumVerification(t *testing.T) {
+	hideProgressBar(t)
+	bin := []byte("genuine binary")
+	checksumsName := "checked_1.0.0_checksums.txt"
+	tests := []struct {
+		name string
+		// checksums replaces the checksums file of the release, nil removes it
+		checksums []byte
+		skip      bool
+		wantErr   error
+	}{
+		{name: "valid"},
+		{name: "wrong checksum", checksums: []byte(strings.Repeat("0", 64) + "  " + platformAssetName("checked", "v1.0.0", Tar) + "\n"), wantErr: ErrChecksumMismatch},
+		{name: "asset not listed", checksums: []byte(strings.Repeat("0", 64) + "  checked_1.0.0_other.tar.gz\n"), wantErr: ErrChecksumMismatch},
+		{name: "wrong checksum skipped", checksums: []byte(strings.Repeat("0", 64) + "  " + platformAssetName("checked", "v1.0.0", Tar) + "\n"), skip: true},
+		{name: "no checksums file", checksums: []byte{}},
+	}
+	defer func() { SkipCheckSumValidation = false }()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			SkipCheckSumValidation = test.skip
+			fake := newFakeGitHub(t)
+			release := newToolRelease(t, "checked", "v1.0.0", bin)
+			if test.checksums != nil && len(test.checksums) == 0 {
+				delete(release.Assets, checksumsName)
+			} else if test.checksums != nil {
+				release.Assets[checksumsName] = test.checksums
+			}
+			fake.AddRelease(Organization+"/checked", release)
+			d, err := NewghReleaseDownloader(Organization + "/checked")
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.cache = nil
+			got, err := d.GetExecutableFromAsset()
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) || got != nil {
+					t.Fatalf("GetExecutableFromAsset() = %d bytes, %v, want %v", len(got), err, test.wantErr)
+				}
+				return
+			}
+			if err != nil || !bytes.Equal(got, bin) {
+				t.Fatalf("GetExecutableFromAsset() = %d bytes, %v, want the binary", len(got), err)
+			}
+		})
+	}
+}
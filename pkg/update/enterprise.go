@@ -0,0 +1,106 @@
+package updateutils
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// GitHubHostEnv is the environment variable naming the host of a github enterprise server as the gh
+// cli does, e.g. github.internal.example.com. It is used when SetGitHubBaseURL was not called
+const GitHubHostEnv = "GH_HOST"
+
+// githubUploadURL is the uploads url set by SetGitHubBaseURL along githubBaseURL
+var githubUploadURL *url.URL
+
+// SetGitHubBaseURL points the github api calls, asset downloads and source archives of the updater at
+// a github enterprise server. apiURL is the api url, https://host/api/v3/, or the url of the host.
+// uploadsURL defaults to https://host/api/uploads/. An empty apiURL restores github.com. The
+// certificates of a private CA are trusted with SetRootCAs
+func SetGitHubBaseURL(apiURL, uploadsURL string) error {
+	if apiURL == "" {
+		githubBaseURL, githubUploadURL = nil, nil
+		return nil
+	}
+	api, err := enterpriseURL(apiURL, "api/v3/")
+	if err != nil {
+		return err
+	}
+	uploads := &url.URL{Scheme: api.Scheme, Host: api.Host, Path: "/api/uploads/"}
+	if uploadsURL != "" {
+		if uploads, err = enterpriseURL(uploadsURL, "api/uploads/"); err != nil {
+			return err
+		}
+	}
+	githubBaseURL, githubUploadURL = api, uploads
+	return nil
+}
+
+// enterpriseURL parses the url of an enterprise server endpoint, the url of the host gets path
+func enterpriseURL(rawURL, path string) (*url.URL, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, errorutil.NewWithTag("updater", "invalid github enterprise url %v, expected https://host/%v", rawURL, path)
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = "/" + path
+	}
+	// go-github 要求以 / 结尾
+	if !strings.HasSuffix(parsed.Path, "/") {
+		parsed.Path += "/"
+	}
+	return parsed, nil
+}
+
+// githubURLs returns the api and uploads urls of the github api calls: the ones of SetGitHubBaseURL,
+// of the GitHubHostEnv enterprise server or of github.com
+func githubURLs() (api, uploads *url.URL) {
+	if githubBaseURL != nil {
+		uploads = githubUploadURL
+		if uploads == nil {
+			uploads = &url.URL{Scheme: githubBaseURL.Scheme, Host: githubBaseURL.Host, Path: "/api/uploads/"}
+		}
+		return githubBaseURL, uploads
+	}
+	if host := strings.TrimSpace(os.Getenv(GitHubHostEnv)); host != "" && !strings.EqualFold(host, "github.com") {
+		return &url.URL{Scheme: "https", Host: host, Path: "/api/v3/"}, &url.URL{Scheme: "https", Host: host, Path: "/api/uploads/"}
+	}
+	return &url.URL{Scheme: "https", Host: "api.github.com", Path: "/"}, &url.URL{Scheme: "https", Host: "uploads.github.com", Path: "/"}
+}
+
+// githubHost returns the host of the github releases, github.com by default, and whether it was only set
+// by GitHubHostEnv
+func githubHost() (host string, fromEnv bool) {
+	api, _ := githubURLs()
+	if api.Host == "api.github.com" {
+		return "github.com", false
+	}
+	return api.Host, githubBaseURL == nil
+}
+
+// warnedHosts are the GitHubHostEnv hosts already warned about
+var warnedHosts sync.Map
+
+// warnGitHubHostEnv warns once per host when the github releases are downloaded from the host of
+// GitHubHostEnv, which the environment can change
+func warnGitHubHostEnv(forge string) {
+	if forge != SourceGitHub {
+		return
+	}
+	if host, fromEnv := githubHost(); fromEnv {
+		if _, warned := warnedHosts.LoadOrStore(strings.ToLower(host), struct{}{}); !warned {
+			updateLog.Warning().Label("updater").Msgf("downloading the github releases from %v set by %v", host, GitHubHostEnv)
+		}
+	}
+}
+
+// githubArchiveURL returns the api url of the zip archive of the source at tag, for the releases which
+// don't announce one. The api redirects it to codeload.github.com, or to /_codeload on the host of an
+// enterprise server, which receives the token as the api host
+func githubArchiveURL(api *url.URL, org, repo, tag string) string {
+	return fmt.Sprintf("%srepos/%s/%s/zipball/%s", api.String(), url.PathEscape(org), url.PathEscape(repo), url.PathEscape(tag))
+}
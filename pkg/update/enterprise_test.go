@@ -0,0 +1,174 @@
+package updateutils
+
+import (
+	"bytes"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGitHubURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		api     string
+		uploads string
+		env     string
+		wantAPI string
+		// wantUploads is the uploads url, wantArchive the source archive of acme/tool at v1.0.0
+		wantUploads string
+		wantArchive string
+		wantErr     bool
+	}{
+		{name: "github.com", wantAPI: "https://api.github.com/", wantUploads: "https://uploads.github.com/",
+			wantArchive: "https://api.github.com/repos/acme/tool/zipball/v1.0.0"},
+		{name: "enterprise host", api: "https://github.internal.example.com", wantAPI: "https://github.internal.example.com/api/v3/",
+			wantUploads: "https://github.internal.example.com/api/uploads/", wantArchive: "https://github.internal.example.com/api/v3/repos/acme/tool/zipball/v1.0.0"},
+		{name: "enterprise api", api: "https://github.internal.example.com/api/v3", uploads: "https://uploads.internal.example.com",
+			wantAPI: "https://github.internal.example.com/api/v3/", wantUploads: "https://uploads.internal.example.com/api/uploads/",
+			wantArchive: "https://github.internal.example.com/api/v3/repos/acme/tool/zipball/v1.0.0"},
+		{name: "GH_HOST", env: "github.internal.example.com", wantAPI: "https://github.internal.example.com/api/v3/",
+			wantUploads: "https://github.internal.example.com/api/uploads/", wantArchive: "https://github.internal.example.com/api/v3/repos/acme/tool/zipball/v1.0.0"},
+		{name: "GH_HOST github.com", env: "github.com", wantAPI: "https://api.github.com/", wantUploads: "https://uploads.github.com/",
+			wantArchive: "https://api.github.com/repos/acme/tool/zipball/v1.0.0"},
+		// 显式设置优先于 GH_HOST
+		{name: "explicit over GH_HOST", api: "https://ghe.example.com", env: "github.internal.example.com", wantAPI: "https://ghe.example.com/api/v3/",
+			wantUploads: "https://ghe.example.com/api/uploads/", wantArchive: "https://ghe.example.com/api/v3/repos/acme/tool/zipball/v1.0.0"},
+		{name: "no scheme", api: "github.internal.example.com", wantErr: true},
+		{name: "invalid uploads", api: "https://ghe.example.com", uploads: "ftp://ghe.example.com", wantErr: true},
+	}
+	defer func() { _ = SetGitHubBaseURL("", "") }()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(GitHubHostEnv, test.env)
+			_ = SetGitHubBaseURL("", "")
+			err := SetGitHubBaseURL(test.api, test.uploads)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("SetGitHubBaseURL(%q, %q) = %v, want error %v", test.api, test.uploads, err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			api, uploads := githubURLs()
+			if api.String() != test.wantAPI || uploads.String() != test.wantUploads {
+				t.Errorf("githubURLs() = %v, %v, want %v, %v", api, uploads, test.wantAPI, test.wantUploads)
+			}
+			if archive := githubArchiveURL(api, "acme", "tool", "v1.0.0"); archive != test.wantArchive {
+				t.Errorf("githubArchiveURL() = %v, want %v", archive, test.wantArchive)
+			}
+		})
+	}
+}
+
+func TestEnterpriseServer(t *testing.T) {
+	hideProgressBar(t)
+	defer func() {
+		_ = SetRootCAs(nil)
+		_ = SetGitHubBaseURL("", "")
+	}()
+	fake := newFakeGitHub(t)
+	bin := []byte("enterprise binary")
+	release := newToolRelease(t, "internal", "v1.0.0", bin)
+	release.Source = zipArchive(t, map[string][]byte{"internal-v1.0.0/README.md": []byte("internal")})
+	fake.AddRelease(Organization+"/internal", release)
+	// 私有 CA 签发的证书
+	server := httptest.NewTLSServer(fake)
+	defer server.Close()
+	fake.DownloadURL = server.URL
+	release.ZipballURL = server.URL + "/source/" + Organization + "/internal"
+	if err := SetGitHubBaseURL(server.URL+"/api/", ""); err != nil {
+		t.Fatal(err)
+	}
+	UpdateSourceAllowlist = append(UpdateSourceAllowlist, trustedSource(Organization+"/internal"))
+	if err := SetRootCAs(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewghReleaseDownloader(Organization + "/internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.cache = nil
+	if got, err := d.GetExecutableFromAsset(); err != nil || !bytes.Equal(got, bin) {
+		t.Fatalf("GetExecutableFromAsset() = %q, %v", got, err)
+	}
+	if _, err := d.DownloadSource(false); err != nil {
+		t.Errorf("DownloadSource() = %v", err)
+	}
+}
+
+func TestEnterpriseUnreachable(t *testing.T) {
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/internal", &fakeRelease{Tag: "v1.0.0"})
+	attempts := RetryAttempts
+	RetryAttempts = 1
+	defer func() {
+		RetryAttempts = attempts
+		_ = SetGitHubBaseURL("", "")
+	}()
+	// 监听后立即关闭, 连接被拒绝
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := listener.Addr().String()
+	_ = listener.Close()
+	if err := SetGitHubBaseURL("http://"+host, ""); err != nil {
+		t.Fatal(err)
+	}
+	UpdateSourceAllowlist = append(UpdateSourceAllowlist, trustedSource(Organization+"/internal"))
+	_, err = NewghReleaseDownloader(Organization + "/internal")
+	if err == nil || !strings.Contains(err.Error(), "could not reach github at "+host) {
+		t.Errorf("NewghReleaseDownloader() of an unreachable server = %v, want the configured host", err)
+	}
+}
+
+// TestGitHubHostEnvAllowlist refuses to update from the host of GH_HOST unless the source on that host is
+// allowlisted, the token is never sent to it
+func TestGitHubHostEnvAllowlist(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+	allowlist := UpdateSourceAllowlist
+	defer func() { UpdateSourceAllowlist = allowlist }()
+	_ = SetGitHubBaseURL("", "")
+	t.Setenv(GitHubHostEnv, host)
+	t.Setenv("GITHUB_TOKEN", "ghp_0123456789")
+
+	UpdateSourceAllowlist = nil
+	err := GetUpdateToolFromRepoCallbackWithError(Repository, "0.9.0", "")()
+	if err == nil || !strings.Contains(err.Error(), ErrUntrustedUpdateSource.Error()) || !strings.Contains(err.Error(), host+"/"+DefaultUpdateSource()) {
+		t.Fatalf("update from the unlisted GH_HOST = %v, want %v naming the host", err, ErrUntrustedUpdateSource)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("the unlisted GH_HOST got %d requests, want none", n)
+	}
+
+	UpdateSourceAllowlist = []string{host + "/" + DefaultUpdateSource()}
+	if _, err := EnforceUpdateSource(Repository); err != nil {
+		t.Errorf("EnforceUpdateSource() of the allowlisted GH_HOST source = %v", err)
+	}
+	logger := &captureLogger{}
+	SetLogger(logger)
+	defer SetLogger(nil)
+	for i := 0; i < 2; i++ {
+		_, _ = NewghReleaseDownloader(Repository)
+	}
+	warning := "warn: downloading the github releases from " + host + " set by " + GitHubHostEnv
+	warnings := 0
+	for _, message := range logger.messages {
+		if message == warning {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("messages = %q, want %q once", logger.messages, warning)
+	}
+}
@@ -0,0 +1,84 @@
+package updateutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NoETagEnv set to a true value (1, true) enables DisableReleaseETag
+const NoETagEnv = "UPDATE_NO_ETAG"
+
+var (
+	// DisableReleaseETag requests the latest release without If-None-Match, to debug the lookups. The
+	// response is still recorded, also enabled by NoETagEnv
+	DisableReleaseETag = false
+
+	latestReleasesMutex sync.Mutex
+	// latestReleases are the records of the latest release lookups by record name
+	latestReleases = make(map[string]*stateFile)
+)
+
+// latestRelease is the response of a latest release lookup, reused when the forge answers 304 Not Modified
+type latestRelease struct {
+	// Key is the url of the lookup, with the base url of the api and the repo
+	Key     string          `json:"key"`
+	ETag    string          `json:"etag"`
+	Release json.RawMessage `json:"release"`
+}
+
+// etagDisabled reports whether DisableReleaseETag or NoETagEnv disable the conditional lookups
+func etagDisabled() bool {
+	if DisableReleaseETag {
+		return true
+	}
+	disabled, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(NoETagEnv)))
+	return err == nil && disabled
+}
+
+// latestReleaseFile returns the record of the lookups of key
+func latestReleaseFile(key string) *stateFile {
+	sum := sha256.Sum256([]byte(key))
+	name := "latest-" + hex.EncodeToString(sum[:8]) + ".json"
+	latestReleasesMutex.Lock()
+	defer latestReleasesMutex.Unlock()
+	file, ok := latestReleases[name]
+	if !ok {
+		file = &stateFile{name: name}
+		latestReleases[name] = file
+	}
+	return file
+}
+
+// readLatestRelease returns the recorded lookup of key, nil when there is none or it is corrupt: it is
+// overwritten by the next lookup
+func readLatestRelease(key string) *latestRelease {
+	data, err := latestReleaseFile(key).read()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			updateLog.Verbose().Label("updater").Msgf("ignoring the cached latest release of %v: %v", key, err)
+		}
+		return nil
+	}
+	var cached latestRelease
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Key != key || cached.ETag == "" || len(cached.Release) == 0 {
+		updateLog.Verbose().Label("updater").Msgf("ignoring the corrupt cached latest release of %v", key)
+		return nil
+	}
+	return &cached
+}
+
+// writeLatestRelease records the lookup of key answered with etag and release
+func writeLatestRelease(key, etag string, release json.RawMessage) {
+	data, err := json.Marshal(&latestRelease{Key: key, ETag: etag, Release: release})
+	if err == nil {
+		err = latestReleaseFile(key).write(data)
+	}
+	if err != nil {
+		updateLog.Verbose().Label("updater").Msgf("could not cache the latest release of %v: %v", key, err)
+	}
+}
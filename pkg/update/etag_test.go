@@ -0,0 +1,71 @@
+package updateutils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLatestReleaseETag(t *testing.T) {
+	fake := newFakeGitHub(t)
+	repo := Organization + "/cached"
+	fake.AddRelease(repo, &fakeRelease{Tag: "v1.0.0"})
+	lookup := func(want string) {
+		t.Helper()
+		gh, err := NewghReleaseDownloader(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag := gh.Latest.GetTagName(); tag != want {
+			t.Errorf("latest release = %v, want %v", tag, want)
+		}
+	}
+
+	lookup("v1.0.0")
+	lookup("v1.0.0")
+	if n := fake.notModified.Load(); n != 1 {
+		t.Errorf("got %d not modified responses, want 1", n)
+	}
+	fake.AddRelease(repo, &fakeRelease{Tag: "v1.1.0"})
+	lookup("v1.1.0")
+	lookup("v1.1.0")
+	if n := fake.notModified.Load(); n != 2 {
+		t.Errorf("got %d not modified responses after the release, want 2", n)
+	}
+
+	defer func() { DisableReleaseETag = false }()
+	DisableReleaseETag = true
+	lookup("v1.1.0")
+	DisableReleaseETag = false
+	t.Setenv(NoETagEnv, "1")
+	lookup("v1.1.0")
+	if n := fake.notModified.Load(); n != 2 {
+		t.Errorf("got %d not modified responses with the conditional requests disabled, want 2", n)
+	}
+	t.Setenv(NoETagEnv, "")
+
+	// 损坏的缓存被忽略并覆盖
+	key := githubBaseURL.String() + "repos/" + repo + "/releases/latest"
+	file := latestReleaseFile(key)
+	if _, err := file.read(); err != nil {
+		t.Fatalf("latest release of %v not cached: %v", key, err)
+	}
+	if err := file.write([]byte("{not json")); err != nil {
+		t.Fatal(err)
+	}
+	lookup("v1.1.0")
+	if n := fake.notModified.Load(); n != 2 {
+		t.Errorf("got %d not modified responses with a corrupt cache, want 2", n)
+	}
+	if readLatestRelease(key) == nil {
+		t.Errorf("corrupt cache of %v not overwritten", key)
+	}
+
+	// 其他仓库或 api 地址的记录不复用
+	data, _ := json.Marshal(&latestRelease{Key: "https://api.github.com/repos/other/cached/releases/latest", ETag: `"abc"`, Release: json.RawMessage(`{}`)})
+	if err := file.write(data); err != nil {
+		t.Fatal(err)
+	}
+	if readLatestRelease(key) != nil {
+		t.Errorf("record of another key reused for %v", key)
+	}
+}
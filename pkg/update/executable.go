@@ -0,0 +1,212 @@
+package updateutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// ignoredArchiveDirs hold documentation and shell completions, never the executable
+var ignoredArchiveDirs = []string{"docs", "doc", "completions", "completion"}
+
+// executableMagics are the headers of ELF, PE and Mach-O (thin and fat) binaries
+var executableMagics = [][]byte{
+	{0x7f, 'E', 'L', 'F'},
+	{'M', 'Z'},
+	{0xfe, 0xed, 0xfa, 0xce},
+	{0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe},
+	{0xcf, 0xfa, 0xed, 0xfe},
+	{0xca, 0xfe, 0xba, 0xbe},
+}
+
+// archiveEntry is a regular file of a release asset
+type archiveEntry struct {
+	path string
+	data []byte
+}
+
+// isIgnoredArchivePath reports whether an archive path is under a docs or completions directory
+func isIgnoredArchivePath(archivePath string) bool {
+	dir := path.Dir(strings.ReplaceAll(archivePath, "\\", "/"))
+	for _, part := range strings.Split(dir, "/") {
+		for _, ignored := range ignoredArchiveDirs {
+			if strings.EqualFold(part, ignored) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isExecutableBinary(data []byte) bool {
+	for _, magic := range executableMagics {
+		if bytes.HasPrefix(data, magic) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectExecutable picks the executable among the archive entries: an exact name match (with or
+// without .exe) first, then the largest ELF/PE/Mach-O binary, failing with the candidates when
+// the choice is ambiguous
+func selectExecutable(entries []archiveEntry, executableName string) (*archiveEntry, error) {
+	name := strings.TrimSuffix(executableName, extIfFound)
+	var binaries []*archiveEntry
+	var candidates []string
+	for i := range entries {
+		entry := &entries[i]
+		if isIgnoredArchivePath(entry.path) {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSuffix(path.Base(entry.path), extIfFound), name) {
+			return entry, nil
+		}
+		candidates = append(candidates, entry.path)
+		if isExecutableBinary(entry.data) {
+			binaries = append(binaries, entry)
+		}
+	}
+	if len(binaries) == 0 {
+		return nil, errorutil.NewWithTag("update", "executable %v not found in archive, candidates: %v", executableName, strings.Join(candidates, ", "))
+	}
+	sort.SliceStable(binaries, func(i, j int) bool {
+		return len(binaries[i].data) > len(binaries[j].data)
+	})
+	if len(binaries) > 1 && len(binaries[0].data) == len(binaries[1].data) {
+		var names []string
+		for _, binary := range binaries {
+			names = append(names, binary.path)
+		}
+		return nil, errorutil.NewWithTag("update", "executable %v not found in archive and several binaries match, candidates: %v", executableName, strings.Join(names, ", "))
+	}
+	return binaries[0], nil
+}
+
+// ErrWrongPlatform is returned for an executable built for another os or architecture, matched with errors.Is
+var ErrWrongPlatform = errorutil.NewWithTag("updater", "executable built for another platform")
+
+// binaryFormats are the executable formats of the operating systems not using ELF
+var binaryFormats = map[string]string{"windows": "PE", "darwin": "Mach-O", "ios": "Mach-O"}
+
+var elfArchs = map[elf.Machine]string{
+	elf.EM_X86_64:  "amd64",
+	elf.EM_386:     "386",
+	elf.EM_AARCH64: "arm64",
+	elf.EM_ARM:     "arm",
+	elf.EM_RISCV:   "riscv64",
+	elf.EM_S390:    "s390x",
+	elf.EM_PPC64:   "ppc64",
+	elf.EM_MIPS:    "mips",
+}
+
+var peArchs = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+	pe.IMAGE_FILE_MACHINE_I386:  "386",
+	pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+}
+
+var machoArchs = map[macho.Cpu]string{
+	macho.CpuAmd64: "amd64",
+	macho.Cpu386:   "386",
+	macho.CpuArm64: "arm64",
+	macho.CpuArm:   "arm",
+}
+
+// binaryPlatform returns the format and the architectures of an ELF, PE or Mach-O binary, the format is
+// empty for data which is not such a binary
+func binaryPlatform(data []byte) (string, []string, error) {
+	if !isExecutableBinary(data) {
+		return "", nil, nil
+	}
+	reader := bytes.NewReader(data)
+	switch {
+	case bytes.HasPrefix(data, executableMagics[0]):
+		file, err := elf.NewFile(reader)
+		if err != nil {
+			return "", nil, errorutil.NewWithErr(err).Msgf("invalid ELF executable")
+		}
+		arch, ok := elfArchs[file.Machine]
+		if !ok {
+			arch = file.Machine.String()
+		}
+		littleEndian := file.ByteOrder == binary.LittleEndian
+		switch {
+		case file.Machine == elf.EM_PPC64 && littleEndian:
+			arch = "ppc64le"
+		case file.Machine == elf.EM_MIPS:
+			if file.Class == elf.ELFCLASS64 {
+				arch = "mips64"
+			}
+			if littleEndian {
+				arch += "le"
+			}
+		}
+		return "ELF", []string{arch}, nil
+	case bytes.HasPrefix(data, executableMagics[1]):
+		file, err := pe.NewFile(reader)
+		if err != nil {
+			return "", nil, errorutil.NewWithErr(err).Msgf("invalid PE executable")
+		}
+		arch, ok := peArchs[file.Machine]
+		if !ok {
+			arch = fmt.Sprintf("machine %#x", file.Machine)
+		}
+		return "PE", []string{arch}, nil
+	case bytes.HasPrefix(data, executableMagics[6]):
+		// fat 二进制包含多个架构
+		file, err := macho.NewFatFile(reader)
+		if err != nil {
+			return "", nil, errorutil.NewWithErr(err).Msgf("invalid Mach-O universal executable")
+		}
+		var archs []string
+		for _, arch := range file.Arches {
+			archs = append(archs, machoArch(arch.Cpu))
+		}
+		return "Mach-O", archs, nil
+	default:
+		file, err := macho.NewFile(reader)
+		if err != nil {
+			return "", nil, errorutil.NewWithErr(err).Msgf("invalid Mach-O executable")
+		}
+		return "Mach-O", []string{machoArch(file.Cpu)}, nil
+	}
+}
+
+func machoArch(cpu macho.Cpu) string {
+	if arch, ok := machoArchs[cpu]; ok {
+		return arch
+	}
+	return cpu.String()
+}
+
+// checkPlatform returns ErrWrongPlatform when the binary name was built for another platform than goos/goarch,
+// data which is not an ELF, PE or Mach-O binary is not checked
+func checkPlatform(name string, data []byte, goos, goarch string) error {
+	format, archs, err := binaryPlatform(data)
+	if err != nil || format == "" {
+		return err
+	}
+	want, ok := binaryFormats[goos]
+	if !ok {
+		want = "ELF"
+	}
+	if format == want {
+		for _, arch := range archs {
+			if arch == goarch {
+				return nil
+			}
+		}
+	}
+	return newUpdateError(ErrWrongPlatform, "%v is a %v %v executable, it can't run on %v/%v (%v %v expected)", name, format, strings.Join(archs, "/"), goos, goarch, want, goarch)
+}
@@ -0,0 +1,106 @@
+package updateutils
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func elfBinary(size int) []byte {
+	return append([]byte{0x7f, 'E', 'L', 'F'}, make([]byte, size)...)
+}
+
+func TestSelectExecutable(t *testing.T) {
+	script := []byte("#!/bin/sh\necho helper\n")
+	tests := []struct {
+		name    string
+		entries map[string][]byte
+		want    string
+		wantErr []string
+	}{
+		{
+			name:    "flat exact match",
+			entries: map[string][]byte{"tool": []byte("bin"), "LICENSE": []byte("mit"), "README.md": []byte("readme")},
+			want:    "tool",
+		},
+		{
+			name:    "nested exact match",
+			entries: map[string][]byte{"tool_1.0.0/bin/tool": []byte("bin"), "tool_1.0.0/LICENSE": []byte("mit")},
+			want:    "tool_1.0.0/bin/tool",
+		},
+		{
+			name:    "exact match with exe",
+			entries: map[string][]byte{"tool.exe": []byte("bin"), "README.md": []byte("readme")},
+			want:    "tool.exe",
+		},
+		{
+			name:    "largest binary without exact match",
+			entries: map[string][]byte{"dist/helper": elfBinary(10), "dist/tool-linux-amd64": elfBinary(100), "dist/install.sh": script},
+			want:    "dist/tool-linux-amd64",
+		},
+		{
+			name:    "exact name under completions is ignored",
+			entries: map[string][]byte{"completions/tool": script, "docs/tool": script, "tool-static": elfBinary(10)},
+			want:    "tool-static",
+		},
+		{
+			name:    "ambiguous binaries",
+			entries: map[string][]byte{"a": elfBinary(10), "b": elfBinary(10), "LICENSE": []byte("mit")},
+			wantErr: []string{"candidates", "a", "b"},
+		},
+		{
+			name:    "no binary",
+			entries: map[string][]byte{"install.sh": script, "LICENSE": []byte("mit")},
+			wantErr: []string{"candidates", "install.sh", "LICENSE"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var entries []archiveEntry
+			for name, data := range test.entries {
+				entries = append(entries, archiveEntry{path: name, data: data})
+			}
+			got, err := selectExecutable(entries, "tool")
+			if test.wantErr != nil {
+				if err == nil {
+					t.Fatalf("selectExecutable() = %v, want error", got.path)
+				}
+				for _, want := range test.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("selectExecutable() error %q does not contain %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.path != test.want {
+				t.Errorf("selectExecutable() = %v, want %v", got.path, test.want)
+			}
+		})
+	}
+}
+
+func TestGetExecutableFromNestedAsset(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/tool", &fakeRelease{Tag: "v1.0.0", Assets: map[string][]byte{
+		platformAssetName("tool", "v1.0.0", Tar): tarGz(t, map[string][]byte{
+			"tool_1.0.0/completions/tool.bash": []byte("complete -C tool tool"),
+			"tool_1.0.0/helper":                elfBinary(10),
+			"tool_1.0.0/tool-cli":              elfBinary(100),
+			"tool_1.0.0/LICENSE":               []byte("mit"),
+		}),
+	}})
+	updater := &Updater{APIRequestsPerMinute: -1}
+	defer updater.Close()
+	summary := updater.UpdateTools(context.Background(), []Tool{{Name: "tool"}}, t.TempDir())
+	if err := summary.Results[0].Err; err != nil {
+		t.Fatal(err)
+	}
+	if bin, _ := os.ReadFile(summary.Results[0].Path); string(bin) != string(elfBinary(100)) {
+		t.Errorf("installed the wrong executable (%d bytes)", len(bin))
+	}
+}
@@ -0,0 +1,123 @@
+package updateutils
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ExtractWorkers is the number of archive entries unpacked and files written concurrently by the directory
+// updates, 1 or less handles them one at a time in archive order
+var ExtractWorkers = runtime.NumCPU()
+
+// WithExtractWorkers makes DownloadSourceWithCallback call its callback for up to n entries concurrently,
+// for callbacks safe for concurrent use. Without it the callback is called for one entry at a time in
+// archive order
+func WithExtractWorkers(n int) DownloaderOption {
+	return func(d *GHReleaseDownloader) {
+		d.extractWorkers = n
+	}
+}
+
+// callbackWorkers returns the number of entries the callbacks of the downloader are called for concurrently
+func (d *GHReleaseDownloader) callbackWorkers() int {
+	if d.extractWorkers < 1 {
+		return 1
+	}
+	return d.extractWorkers
+}
+
+// forEachConcurrently calls fn for the items on up to workers goroutines, in order when workers is 1 or less.
+// cancelled is checked before each item is started, the first error of either stops the items not started
+// yet and is returned once the started ones are done
+func forEachConcurrently[T any](ctx context.Context, items []T, workers int, cancelled func(item T) error, fn func(item T) error) error {
+	if workers > len(items) {
+		workers = len(items)
+	}
+	if workers <= 1 {
+		for _, item := range items {
+			if err := cancelled(item); err != nil {
+				return err
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		once     sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	queue := make(chan T)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				// 出错后丢弃剩余的任务
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := fn(item); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+feed:
+	for _, item := range items {
+		if err := cancelled(item); err != nil {
+			fail(err)
+			break
+		}
+		select {
+		case queue <- item:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return firstErr
+}
+
+// entryError returns err of the archive entry name, naming the entry unless err already does
+func entryError(name string, err error) error {
+	if strings.Contains(err.Error(), name) {
+		return err
+	}
+	return fmt.Errorf("archive entry %v: %w", name, err)
+}
+
+// unpackZipConcurrently calls callback for the entries of zipReader on up to workers goroutines, the first
+// error stops the entries not started yet and is returned with the failing entry
+func unpackZipConcurrently(ctx context.Context, zipReader *zip.Reader, workers int, callback AssetFileCallback) error {
+	limiter := newSizeLimiter()
+	cancelled := func(f *zip.File) error {
+		return contextError(ctx, "unpacking cancelled before %v", f.Name)
+	}
+	return forEachConcurrently(ctx, zipReader.File, workers, cancelled, func(f *zip.File) error {
+		data, err := f.Open()
+		if err != nil {
+			return entryError(f.Name, err)
+		}
+		defer data.Close()
+		if err := callback(f.Name, f.FileInfo(), limiter.reader(data)); err != nil {
+			return entryError(f.Name, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,199 @@
+package updateutils
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachConcurrently(t *testing.T) {
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+	none := func(int) error { return nil }
+
+	var order []int
+	if err := forEachConcurrently(context.Background(), items[:5], 1, none, func(item int) error {
+		order = append(order, item)
+		return nil
+	}); err != nil || !reflect.DeepEqual(order, items[:5]) {
+		t.Errorf("forEachConcurrently() with 1 worker = %v in order %v", err, order)
+	}
+
+	var running, most, calls atomic.Int64
+	var mutex sync.Mutex
+	err := forEachConcurrently(context.Background(), items, 4, none, func(item int) error {
+		calls.Add(1)
+		n := running.Add(1)
+		defer running.Add(-1)
+		mutex.Lock()
+		if n > most.Load() {
+			most.Store(n)
+		}
+		mutex.Unlock()
+		if item == 10 {
+			return fmt.Errorf("item %d failed", item)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "item 10 failed" {
+		t.Errorf("forEachConcurrently() = %v, want the error of item 10", err)
+	}
+	if most.Load() > 4 {
+		t.Errorf("forEachConcurrently() ran %d items at once, want at most 4", most.Load())
+	}
+	// 出错后不再开始新的任务
+	if calls.Load() == int64(len(items)) {
+		t.Errorf("forEachConcurrently() ran all %d items after an error", calls.Load())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelled := func(item int) error { return contextError(ctx, "cancelled before %d", item) }
+	if err := forEachConcurrently(ctx, items, 4, cancelled, none); !errors.Is(err, context.Canceled) {
+		t.Errorf("forEachConcurrently() after cancel = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestUnpackSourceConcurrently(t *testing.T) {
+	files := map[string][]byte{}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("templates-abc/cves/%02d.yaml", i)] = []byte(fmt.Sprint(i))
+	}
+	source := zipArchive(t, files)
+	for _, workers := range []int{1, 8} {
+		incoming := map[string]*incomingFile{}
+		if err := unpackSource(context.Background(), "templates", source, false, workers, collectIncoming(incoming)); err != nil || len(incoming) != len(files) {
+			t.Errorf("unpackSource() with %d workers = %v with %d files, want %d", workers, err, len(incoming), len(files))
+		}
+	}
+
+	failing := errors.New("disk full")
+	err := unpackSource(context.Background(), "templates", source, false, 8, func(path string, _ fs.FileInfo, _ io.Reader) error {
+		if path == "templates-abc/cves/07.yaml" {
+			return failing
+		}
+		return nil
+	})
+	if !errors.Is(err, failing) || !strings.Contains(err.Error(), "templates-abc/cves/07.yaml") {
+		t.Errorf("unpackSource() of a failing callback = %v, want %v with the entry", err, failing)
+	}
+}
+
+func TestDownloadSourceWithCallbackWorkers(t *testing.T) {
+	files := map[string][]byte{}
+	for i := 0; i < 16; i++ {
+		files[fmt.Sprintf("templates-abc/%02d.yaml", i)] = []byte(fmt.Sprint(i))
+	}
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", &fakeRelease{Tag: "v1.0.0", Source: zipArchive(t, files)})
+
+	tests := []struct {
+		name string
+		opts []DownloaderOption
+		// concurrent is whether the callback may be called for several entries at once
+		concurrent bool
+	}{
+		{name: "serial by default"},
+		{name: "opt-in workers", opts: []DownloaderOption{WithExtractWorkers(4)}, concurrent: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := NewghReleaseDownloader(Organization+"/templates", test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var running, peak atomic.Int64
+			count := 0
+			var mutex sync.Mutex
+			err = d.DownloadSourceWithCallback(false, func(string, fs.FileInfo, io.Reader) error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for current := peak.Load(); n > current && !peak.CompareAndSwap(current, n); current = peak.Load() {
+				}
+				time.Sleep(5 * time.Millisecond)
+				mutex.Lock()
+				count++
+				mutex.Unlock()
+				return nil
+			})
+			if err != nil || count != len(files) {
+				t.Fatalf("DownloadSourceWithCallback() = %v with %d files, want %d", err, count, len(files))
+			}
+			if concurrent := peak.Load() > 1; concurrent != test.concurrent {
+				t.Errorf("callbacks running at once = %d, want concurrent %v", peak.Load(), test.concurrent)
+			}
+		})
+	}
+}
+
+func TestWriteDirChangesConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	incoming := map[string]*incomingFile{}
+	changes := &DirChangeSet{}
+	for i := 0; i < 200; i++ {
+		name := filepath.Join(fmt.Sprintf("d%d", i%7), fmt.Sprintf("%03d.yaml", i))
+		incoming[name] = &incomingFile{path: "templates-abc/" + filepath.ToSlash(name), data: []byte(name), mode: 0644}
+		changes.Added = append(changes.Added, name)
+	}
+	written, err := writeDirChanges(context.Background(), dir, incoming, changes, false, nil)
+	if err != nil || written != len(incoming) {
+		t.Fatalf("writeDirChanges() = %d, %v", written, err)
+	}
+	for name := range incoming {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != name {
+			t.Errorf("%v = %q, %v", name, data, err)
+		}
+	}
+}
+
+// BenchmarkUpdateDirFromSource unpacks and writes a synthetic source of 10k small templates
+func BenchmarkUpdateDirFromSource(b *testing.B) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i < 10000; i++ {
+		w, err := zw.Create(fmt.Sprintf("templates-abc/cves/%d/CVE-%05d.yaml", i%100, i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		fmt.Fprintf(w, "id: CVE-%05d\ninfo:\n  name: synthetic template %d\n  severity: high\n", i, i)
+	}
+	if err := zw.Close(); err != nil {
+		b.Fatal(err)
+	}
+	source := buf.Bytes()
+	workers := ExtractWorkers
+	defer func() { ExtractWorkers = workers }()
+	for _, n := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers=%d", n), func(b *testing.B) {
+			ExtractWorkers = n
+			for i := 0; i < b.N; i++ {
+				dir := b.TempDir()
+				incoming := map[string]*incomingFile{}
+				if err := unpackSource(context.Background(), "templates", source, false, n, collectIncoming(incoming)); err != nil {
+					b.Fatal(err)
+				}
+				changes, err := diffDir(dir, incoming)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := writeDirChanges(context.Background(), dir, incoming, changes, false, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
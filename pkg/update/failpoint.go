@@ -0,0 +1,61 @@
+package updateutils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// FailpointEnv lists the comma separated steps of the update failing deterministically, only read by
+// builds with the failpoint tag (go build -tags failpoint)
+const FailpointEnv = "WJLIN0_UPDATE_FAILPOINT"
+
+// steps of the update which can be made to fail
+const (
+	FailpointDownload = "download"
+	FailpointChecksum = "checksum"
+	FailpointApply    = "apply"
+	// FailpointRollback fails the rollback of the self-update, it implies FailpointApply
+	FailpointRollback = "rollback"
+	// FailpointDirWrite fails the first file written by a directory update, dir-write:N the Nth one
+	FailpointDirWrite = "dir-write"
+)
+
+var (
+	// ErrFailpoint is wrapped by the errors of the steps made to fail through FailpointEnv
+	ErrFailpoint = errorutil.NewWithTag("updater", "injected failure")
+	// failpointsEnabled gates FailpointEnv, set by the failpoint build tag
+	failpointsEnabled = failpointBuild
+)
+
+// failpoint returns ErrFailpoint when step is listed in FailpointEnv and failpoints are enabled
+func failpoint(step string) error {
+	if !failpointsEnabled {
+		return nil
+	}
+	for _, name := range strings.Split(os.Getenv(FailpointEnv), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		// 回滚只在替换失败后发生
+		if name == step || (step == FailpointApply && name == FailpointRollback) {
+			return errorutil.NewWithErr(ErrFailpoint).Msgf("%v failed (%v=%v)", step, FailpointEnv, os.Getenv(FailpointEnv))
+		}
+	}
+	return nil
+}
+
+// failpointAt returns ErrFailpoint for the nth occurrence of step, listed in FailpointEnv as step for the
+// first one or step:n, when failpoints are enabled
+func failpointAt(step string, n int) error {
+	if !failpointsEnabled {
+		return nil
+	}
+	for _, name := range strings.Split(os.Getenv(FailpointEnv), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if (name == step && n == 1) || name == step+":"+strconv.Itoa(n) {
+			return errorutil.NewWithErr(ErrFailpoint).Msgf("%v %d failed (%v=%v)", step, n, FailpointEnv, os.Getenv(FailpointEnv))
+		}
+	}
+	return nil
+}
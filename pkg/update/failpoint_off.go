@@ -0,0 +1,5 @@
+//go:build !failpoint
+
+package updateutils
+
+const failpointBuild = false
@@ -0,0 +1,103 @@
+package updateutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/minio/selfupdate"
+)
+
+// enableFailpoints enables the failpoints until the test ends as the failpoint build tag does
+func enableFailpoints(t *testing.T, steps string) {
+	enabled := failpointsEnabled
+	failpointsEnabled = true
+	t.Cleanup(func() { failpointsEnabled = enabled })
+	t.Setenv(FailpointEnv, steps)
+}
+
+func TestFailpointDisabled(t *testing.T) {
+	t.Setenv(FailpointEnv, FailpointDownload)
+	if failpointBuild {
+		t.Skip("built with the failpoint tag")
+	}
+	if err := failpoint(FailpointDownload); err != nil {
+		t.Errorf("failpoint() without the failpoint tag = %v", err)
+	}
+}
+
+func TestUpdateToolsFailpoints(t *testing.T) {
+	hideProgressBar(t)
+	tests := []struct {
+		steps string
+		err   string
+	}{
+		{steps: FailpointDownload, err: "download failed"},
+		{steps: FailpointChecksum, err: "checksum mismatch"},
+		{steps: FailpointApply, err: "apply failed"},
+		{steps: "", err: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.steps, func(t *testing.T) {
+			fake := newFakeGitHub(t)
+			fake.AddRelease(Organization+"/chaos", newToolRelease(t, "chaos", "v1.1.0", []byte("bin-chaos")))
+			enableFailpoints(t, test.steps)
+			updater := &Updater{APIRequestsPerMinute: -1}
+			defer updater.Close()
+			dir := t.TempDir()
+			result := updater.UpdateTools(context.Background(), []Tool{{Name: "chaos", Version: "1.0.0"}}, dir).Results[0]
+			if test.err == "" {
+				if result.Err != nil || !result.Updated {
+					t.Fatalf("update without failpoint = %v", result.Err)
+				}
+				return
+			}
+			if result.Err == nil || !strings.Contains(result.Err.Error(), ErrFailpoint.Error()) || !strings.Contains(result.Err.Error(), test.err) {
+				t.Fatalf("update = %v, want %v with %q", result.Err, ErrFailpoint, test.err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, executableFileName("chaos", runtime.GOOS))); !os.IsNotExist(err) {
+				t.Error("failed update installed the executable")
+			}
+		})
+	}
+}
+
+func TestApplyUpdateFailpoints(t *testing.T) {
+	tests := []struct {
+		steps      string
+		applyErr   bool
+		rollback   bool
+		wantBinary string
+	}{
+		{steps: "", wantBinary: "new"},
+		{steps: FailpointApply, applyErr: true, wantBinary: "old"},
+		// 回滚也失败
+		{steps: FailpointRollback, applyErr: true, rollback: true, wantBinary: "old"},
+		{steps: "apply, rollback", applyErr: true, rollback: true, wantBinary: "old"},
+	}
+	for _, test := range tests {
+		t.Run(test.steps, func(t *testing.T) {
+			enableFailpoints(t, test.steps)
+			target := filepath.Join(t.TempDir(), "tool")
+			if err := os.WriteFile(target, []byte("old"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			err, rollbackErr := applyUpdate([]byte("new"), selfupdate.Options{TargetPath: target})
+			if (err != nil) != test.applyErr || (rollbackErr != nil) != test.rollback {
+				t.Fatalf("applyUpdate() = %v, rollback %v, want error %v, rollback error %v", err, rollbackErr, test.applyErr, test.rollback)
+			}
+			if err != nil && !strings.Contains(err.Error(), ErrFailpoint.Error()) {
+				t.Errorf("applyUpdate() = %v, want %v", err, ErrFailpoint)
+			}
+			if rollbackErr != nil && !strings.Contains(rollbackErr.Error(), "rollback failed") {
+				t.Errorf("rollback error = %v, want the rollback failpoint", rollbackErr)
+			}
+			if data, _ := os.ReadFile(target); string(data) != test.wantBinary {
+				t.Errorf("executable = %q, want %q", data, test.wantBinary)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package updateutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeRelease is a release served by fakeGitHub
+type fakeRelease struct {
+	// ID is the release id, re-tagging a tag to another release changes it
+	ID     int64
+	Tag    string
+	Body   string
+	Assets map[string][]byte
+	// AssetIDs overrides the ids of the assets, by default their index, re-uploading an asset changes it
+	AssetIDs map[string]int64
+	// Source is the zipball of the repository source
+	Source []byte
+	// ZipballURL overrides the url the zipball is downloaded from
+	ZipballURL string
+	// Prerelease and Draft mark the release, the latest release endpoint skips both
+	Prerelease bool
+	Draft      bool
+	// PublishedAt is the publication date of the release, omitted when zero
+	PublishedAt time.Time
+}
+
+// fakeGitHub serves the subset of the github api used by the updater
+type fakeGitHub struct {
+	*httptest.Server
+	mutex       sync.Mutex
+	releases    map[string]*fakeRelease
+	older       map[string][]*fakeRelease
+	apiRequests atomic.Int64
+	// sourceRequests counts the zipball downloads
+	sourceRequests atomic.Int64
+	// Token is required as bearer token by the api requests when set, like a private repository
+	Token string
+	// DownloadURL overrides the url assets are redirected to, e.g. a proxy in front of the fake
+	DownloadURL string
+	// ListStatus fails the listing of the releases with the status when set
+	ListStatus int
+	// notModified counts the release lookups answered 304 to their If-None-Match
+	notModified atomic.Int64
+}
+
+// newFakeGitHub starts a fake github and points the updater at it until the test ends
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	f := &fakeGitHub{releases: make(map[string]*fakeRelease), older: make(map[string][]*fakeRelease)}
+	f.Server = httptest.NewServer(f)
+	baseURL, _ := url.Parse(f.URL + "/api/")
+	githubBaseURL = baseURL
+	allowlist, cacheDir, backoff := UpdateSourceAllowlist, AssetCacheDir, RetryBackoff
+	UpdateSourceAllowlist = []string{trustedSource(DefaultUpdateSource())}
+	RetryBackoff = time.Millisecond
+	// 每个测试使用独立的资源缓存
+	AssetCacheDir = t.TempDir()
+	t.Cleanup(func() {
+		githubBaseURL = nil
+		UpdateSourceAllowlist, AssetCacheDir, RetryBackoff = allowlist, cacheDir, backoff
+		f.Close()
+	})
+	return f
+}
+
+// AddRelease sets the latest release of org/repo and allowlists it as update source
+func (f *fakeGitHub) AddRelease(repo string, release *fakeRelease) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.releases[repo] = release
+	UpdateSourceAllowlist = append(UpdateSourceAllowlist, trustedSource(repo))
+}
+
+// trustedSource returns the allowlist entry of the repo spec on the current host of its forge, e.g. the
+// fake github
+func trustedSource(repo string) string {
+	forge, orgName, repoName, err := parseSource(repo)
+	if err != nil {
+		panic(err)
+	}
+	return sourceIdentity(forge, orgName, repoName)
+}
+
+// AddUntrustedRelease sets the latest release of org/repo without allowlisting it
+func (f *fakeGitHub) AddUntrustedRelease(repo string, release *fakeRelease) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.releases[repo] = release
+}
+
+// AddOlderRelease adds a release of org/repo served by tag only
+func (f *fakeGitHub) AddOlderRelease(repo string, release *fakeRelease) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	// 与最新版本的资源 id 错开
+	if release.AssetIDs == nil {
+		release.AssetIDs = make(map[string]int64)
+	}
+	for i, name := range release.assetNames() {
+		if _, ok := release.AssetIDs[name]; !ok {
+			release.AssetIDs[name] = int64(1000*(len(f.older[repo])+1) + i + 1)
+		}
+	}
+	f.older[repo] = append(f.older[repo], release)
+}
+
+// release returns the release of org/repo tagged tag, the latest one when tag is empty
+func (f *fakeGitHub) release(repo, tag string) (*fakeRelease, bool) {
+	latest, ok := f.releases[repo]
+	if tag == "" || (ok && latest.Tag == tag) {
+		return latest, ok
+	}
+	for _, release := range f.older[repo] {
+		if release.Tag == tag {
+			return release, true
+		}
+	}
+	return nil, false
+}
+
+// all returns the latest and the older releases of org/repo
+func (f *fakeGitHub) all(repo string) []*fakeRelease {
+	var releases []*fakeRelease
+	if latest, ok := f.releases[repo]; ok {
+		releases = append(releases, latest)
+	}
+	return append(releases, f.older[repo]...)
+}
+
+// assetNames returns the sorted asset names of release
+func (r *fakeRelease) assetNames() []string {
+	var names []string
+	for name := range r.Assets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// assetID returns the id of the asset name, its index in the sorted names unless overridden
+func (r *fakeRelease) assetID(name string) int64 {
+	if id, ok := r.AssetIDs[name]; ok {
+		return id
+	}
+	return int64(sort.SearchStrings(r.assetNames(), name) + 1)
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	path := req.URL.Path
+	if strings.HasPrefix(path, "/api/") {
+		f.apiRequests.Add(1)
+		if f.Token != "" && req.Header.Get("Authorization") != "Bearer "+f.Token {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"message":"Bad credentials"}`))
+			return
+		}
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	// /api/repos/{org}/{repo}/releases
+	case len(parts) == 5 && parts[0] == "api" && parts[4] == "releases":
+		if f.ListStatus != 0 {
+			w.WriteHeader(f.ListStatus)
+			return
+		}
+		var releases []map[string]interface{}
+		for _, release := range f.all(parts[2] + "/" + parts[3]) {
+			releases = append(releases, map[string]interface{}{"id": release.ID, "tag_name": release.Tag, "prerelease": release.Prerelease, "draft": release.Draft, "body": release.Body})
+		}
+		_ = json.NewEncoder(w).Encode(releases)
+	// /api/repos/{org}/{repo}/releases/latest, /api/repos/{org}/{repo}/releases/tags/{tag}
+	case (len(parts) == 6 && parts[5] == "latest" || len(parts) == 7 && parts[5] == "tags") && parts[0] == "api" && parts[4] == "releases":
+		var tag string
+		if len(parts) == 7 {
+			tag = parts[6]
+		}
+		release, ok := f.release(parts[2]+"/"+parts[3], tag)
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		var assets []map[string]interface{}
+		for _, name := range release.assetNames() {
+			assets = append(assets, map[string]interface{}{"id": release.assetID(name), "name": name, "size": len(release.Assets[name])})
+		}
+		zipballURL := release.ZipballURL
+		if zipballURL == "" {
+			zipballURL = fmt.Sprintf("%s/source/%s/%s/%s", f.URL, parts[2], parts[3], release.Tag)
+		}
+		body := map[string]interface{}{
+			"id":               release.ID,
+			"tag_name":         release.Tag,
+			"target_commitish": "main",
+			"prerelease":       release.Prerelease,
+			"body":             release.Body,
+			"assets":           assets,
+			"zipball_url":      zipballURL,
+		}
+		if !release.PublishedAt.IsZero() {
+			body["published_at"] = release.PublishedAt
+		}
+		data, _ := json.Marshal(body)
+		sum := sha256.Sum256(data)
+		etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+		w.Header().Set("ETag", etag)
+		if req.Header.Get("If-None-Match") == etag {
+			f.notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write(data)
+	// /api/repos/{org}/{repo}/releases/assets/{id}
+	case len(parts) == 7 && parts[0] == "api" && parts[4] == "releases" && parts[5] == "assets":
+		var id int64
+		_, _ = fmt.Sscanf(parts[6], "%d", &id)
+		for _, release := range f.all(parts[2] + "/" + parts[3]) {
+			for _, name := range release.assetNames() {
+				if release.assetID(name) == id {
+					downloadURL := f.URL
+					if f.DownloadURL != "" {
+						downloadURL = f.DownloadURL
+					}
+					http.Redirect(w, req, fmt.Sprintf("%s/download/%s/%s/%s?tag=%s", downloadURL, parts[2], parts[3], name, release.Tag), http.StatusFound)
+					return
+				}
+			}
+		}
+		http.NotFound(w, req)
+	// /download/{org}/{repo}/{name}?tag={tag}
+	case len(parts) == 4 && parts[0] == "download":
+		release, ok := f.release(parts[1]+"/"+parts[2], req.URL.Query().Get("tag"))
+		if !ok || release.Assets[parts[3]] == nil {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(release.Assets[parts[3]])
+	// /source/{org}/{repo}, /source/{org}/{repo}/{tag}
+	case (len(parts) == 3 || len(parts) == 4) && parts[0] == "source":
+		var tag string
+		if len(parts) == 4 {
+			tag = parts[3]
+		}
+		release, ok := f.release(parts[1]+"/"+parts[2], tag)
+		if !ok || release.Source == nil {
+			http.NotFound(w, req)
+			return
+		}
+		f.sourceRequests.Add(1)
+		_, _ = w.Write(release.Source)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// platformAssetName returns the asset name the updater looks for on this platform
+func platformAssetName(tool, tag string, format AssetFormat) string {
+	goos := runtime.GOOS
+	if goos == "darwin" {
+		goos = "macOS"
+	}
+	return fmt.Sprintf("%s_%s_%s_%s%s", tool, strings.TrimPrefix(tag, "v"), goos, runtime.GOARCH, format.FileExtension())
+}
+
+// newToolRelease returns a release with a tar.gz asset holding the tool binary and its checksums file
+func newToolRelease(t *testing.T, tool, tag string, bin []byte) *fakeRelease {
+	asset := tarGz(t, map[string][]byte{tool: bin})
+	name := platformAssetName(tool, tag, Tar)
+	sum := sha256.Sum256(asset)
+	checksums := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name)
+	return &fakeRelease{
+		Tag: tag,
+		Assets: map[string][]byte{
+			name: asset,
+			fmt.Sprintf("%s_%s_checksums.txt", tool, strings.TrimPrefix(tag, "v")): []byte(checksums),
+		},
+	}
+}
+
+// tarGz returns a tar.gz archive of files
+func tarGz(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zipArchive returns a zip archive of files
+// hideProgressBar sets HideProgressBar until the test ends
+func hideProgressBar(t *testing.T) {
+	hide := HideProgressBar
+	HideProgressBar = true
+	t.Cleanup(func() { HideProgressBar = hide })
+}
+
+// fakeExecutable writes an old executable name to a temp dir and makes it the executable updated by the
+// test, until the test ends
+func fakeExecutable(t *testing.T, name string) string {
+	t.Helper()
+	target := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(target, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	executable := executablePath
+	executablePath = func() (string, error) { return target, nil }
+	t.Cleanup(func() { executablePath = executable })
+	return target
+}
+
+func zipArchive(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,112 @@
+package updateutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+var (
+	// RefuseModifiedReleases fails the update when a release changed after it was first seen instead of warning
+	RefuseModifiedReleases = false
+	// ErrReleaseModified is returned when a release was re-tagged or had assets re-uploaded under the same tag
+	ErrReleaseModified = errorutil.NewWithTag("updater", "release modified after publication")
+
+	fingerprintMutex sync.Mutex
+	// fingerprintRecords are the fingerprints of the releases seen by the updaters of the machine
+	fingerprintRecords = &stateFile{name: "releases.json"}
+)
+
+// releaseFingerprint identifies the release of a tag by the ids and digests of its assets
+type releaseFingerprint struct {
+	ReleaseID int64                       `json:"release-id"`
+	Assets    map[string]assetFingerprint `json:"assets"`
+}
+
+type assetFingerprint struct {
+	ID     int64  `json:"id"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// fingerprint returns the fingerprint of the latest release, checksums are the digests of its checksums file
+func (d *GHReleaseDownloader) fingerprint(checksums map[string]string) *releaseFingerprint {
+	fingerprint := &releaseFingerprint{ReleaseID: d.Latest.GetID(), Assets: make(map[string]assetFingerprint)}
+	for _, asset := range d.Latest.Assets {
+		fingerprint.Assets[asset.GetName()] = assetFingerprint{ID: asset.GetID(), SHA256: strings.ToLower(checksums[asset.GetName()])}
+	}
+	return fingerprint
+}
+
+// changes returns how the live release differs from the fingerprint recorded for its tag, assets
+// added since are not changes
+func (f *releaseFingerprint) changes(live *releaseFingerprint) (changes []string, stale []string) {
+	if f.ReleaseID != 0 && live.ReleaseID != 0 && f.ReleaseID != live.ReleaseID {
+		changes = append(changes, fmt.Sprintf("tag moved to release %d (was %d)", live.ReleaseID, f.ReleaseID))
+	}
+	names := make([]string, 0, len(f.Assets))
+	for name := range f.Assets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		recorded, current := f.Assets[name], live.Assets[name]
+		switch {
+		case current.ID == 0:
+			changes = append(changes, fmt.Sprintf("%s deleted", name))
+		case recorded.SHA256 != "" && current.SHA256 != "" && recorded.SHA256 != current.SHA256:
+			changes = append(changes, fmt.Sprintf("%s re-uploaded with sha256 %s (was %s)", name, current.SHA256, recorded.SHA256))
+		case recorded.ID != current.ID:
+			changes = append(changes, fmt.Sprintf("%s re-uploaded as asset %d (was %d)", name, current.ID, recorded.ID))
+		default:
+			continue
+		}
+		if recorded.SHA256 != "" && recorded.SHA256 != current.SHA256 {
+			stale = append(stale, recorded.SHA256)
+		}
+	}
+	return changes, stale
+}
+
+// checkFingerprint compares the latest release with the fingerprint recorded for its tag. A modified
+// release invalidates the cached assets it no longer has and is reported, or refused with RefuseModifiedReleases
+func (d *GHReleaseDownloader) checkFingerprint(checksums map[string]string) error {
+	fingerprintMutex.Lock()
+	defer fingerprintMutex.Unlock()
+	fingerprints := make(map[string]*releaseFingerprint)
+	if data, err := fingerprintRecords.read(); err == nil {
+		if err := json.Unmarshal(data, &fingerprints); err != nil {
+			updateLog.Warning().Label("updater").Msgf("ignoring corrupted release fingerprints %v: %v", fingerprintRecords.name, err)
+			fingerprints = make(map[string]*releaseFingerprint)
+		}
+	}
+	key := d.Source() + "@" + d.Latest.GetTagName()
+	live := d.fingerprint(checksums)
+	if recorded, ok := fingerprints[key]; ok {
+		changes, stale := recorded.changes(live)
+		if len(changes) != 0 {
+			for _, checksum := range stale {
+				if d.cache != nil {
+					d.cache.Remove(checksum)
+				}
+			}
+			if RefuseModifiedReleases {
+				return errorutil.NewWithErr(ErrReleaseModified).Msgf("release %v of %v was modified after publication: %v", d.Latest.GetTagName(), d.Source(), strings.Join(changes, ", "))
+			}
+			updateLog.Warning().Label("updater").Msgf("release %v of %v was modified after publication: %v", d.Latest.GetTagName(), d.Source(), strings.Join(changes, ", "))
+		}
+	}
+	fingerprints[key] = live
+	data, err := json.MarshalIndent(fingerprints, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := fingerprintRecords.write(data); err != nil {
+		// 记录失败不影响更新本身
+		updateLog.Warning().Label("updater").Msgf("could not record release fingerprint in %v: %v", fingerprintRecords.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package updateutils
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReleaseFingerprintChanges(t *testing.T) {
+	recorded := &releaseFingerprint{ReleaseID: 1, Assets: map[string]assetFingerprint{
+		"tool.tar.gz":   {ID: 1, SHA256: "aa"},
+		"checksums.txt": {ID: 2},
+	}}
+	tests := []struct {
+		name  string
+		live  *releaseFingerprint
+		want  []string
+		stale []string
+	}{
+		{name: "unchanged", live: &releaseFingerprint{ReleaseID: 1, Assets: map[string]assetFingerprint{"tool.tar.gz": {ID: 1, SHA256: "aa"}, "checksums.txt": {ID: 2}}}},
+		{name: "asset added", live: &releaseFingerprint{ReleaseID: 1, Assets: map[string]assetFingerprint{"tool.tar.gz": {ID: 1, SHA256: "aa"}, "checksums.txt": {ID: 2}, "tool.zip": {ID: 3}}}},
+		{
+			name:  "re-uploaded",
+			live:  &releaseFingerprint{ReleaseID: 1, Assets: map[string]assetFingerprint{"tool.tar.gz": {ID: 5, SHA256: "bb"}, "checksums.txt": {ID: 6}}},
+			want:  []string{"checksums.txt re-uploaded as asset 6 (was 2)", "tool.tar.gz re-uploaded with sha256 bb (was aa)"},
+			stale: []string{"aa"},
+		},
+		{
+			name:  "re-tagged",
+			live:  &releaseFingerprint{ReleaseID: 9, Assets: map[string]assetFingerprint{"checksums.txt": {ID: 2}}},
+			want:  []string{"tag moved to release 9 (was 1)", "tool.tar.gz deleted"},
+			stale: []string{"aa"},
+		},
+	}
+	for _, test := range tests {
+		changes, stale := recorded.changes(test.live)
+		if strings.Join(changes, "|") != strings.Join(test.want, "|") || strings.Join(stale, "|") != strings.Join(test.stale, "|") {
+			t.Errorf("%s: changes() = %q %q, want %q %q", test.name, changes, stale, test.want, test.stale)
+		}
+	}
+}
+
+func TestUpdateToolsReuploadedRelease(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	repo := Organization + "/reuploaded"
+	fake.AddRelease(repo, newToolRelease(t, "reuploaded", "v1.1.0", []byte("bin-first")))
+	tools := []Tool{{Name: "reuploaded", Version: "1.0.0"}}
+	updater := &Updater{APIRequestsPerMinute: -1}
+	defer updater.Close()
+	update := func() ([]byte, error) {
+		dir := t.TempDir()
+		summary := updater.UpdateTools(context.Background(), tools, dir)
+		if err := summary.Results[0].Err; err != nil {
+			return nil, err
+		}
+		return os.ReadFile(filepath.Join(dir, "reuploaded"))
+	}
+	if _, err := update(); err != nil {
+		t.Fatal(err)
+	}
+	first := fake.releases[repo]
+	firstAsset := checksum(first.Assets[platformAssetName("reuploaded", "v1.1.0", Tar)])
+	if _, err := os.Stat(filepath.Join(AssetCacheDir, firstAsset)); err != nil {
+		t.Fatalf("first asset not cached: %v", err)
+	}
+
+	// 同一 tag 下删除并重新上传资源
+	reupload := func(bin string, id int64) {
+		release := newToolRelease(t, "reuploaded", "v1.1.0", []byte(bin))
+		release.AssetIDs = make(map[string]int64)
+		for i, name := range release.assetNames() {
+			release.AssetIDs[name] = id + int64(i)
+		}
+		fake.AddRelease(repo, release)
+	}
+	reupload("bin-second", 100)
+	bin, err := update()
+	if err != nil || !bytes.Equal(bin, []byte("bin-second")) {
+		t.Fatalf("update after re-upload installed %q, %v", bin, err)
+	}
+	if _, err := os.Stat(filepath.Join(AssetCacheDir, firstAsset)); !os.IsNotExist(err) {
+		t.Errorf("cached asset of the replaced upload not invalidated: %v", err)
+	}
+	// 已记录新的指纹, 不再重复告警
+	if _, err := update(); err != nil {
+		t.Fatal(err)
+	}
+
+	RefuseModifiedReleases = true
+	defer func() { RefuseModifiedReleases = false }()
+	reupload("bin-third", 200)
+	if _, err := update(); err == nil || !strings.Contains(err.Error(), ErrReleaseModified.Error()) {
+		t.Fatalf("update with RefuseModifiedReleases = %v, want %v", err, ErrReleaseModified)
+	}
+	// 拒绝后不记录新的指纹, 之后的更新仍然被拒绝
+	if _, err := update(); err == nil {
+		t.Fatal("second update of the refused release succeeded")
+	}
+}
@@ -1,113 +1,254 @@
 package updateutils
 
 import (
-	"archive/tar"
 	"archive/zip"
 	"bytes"
-	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"io"
 	"io/fs"
 	"net/http"
-	"os"
+	"net/url"
 	"runtime"
 	"strings"
+	"text/template"
+	"time"
 
-	"github.com/cheggaaa/pb/v3"
 	"github.com/google/go-github/v30/github"
-	"github.com/projectdiscovery/gologger"
 	errorutil "github.com/projectdiscovery/utils/errors"
-	"golang.org/x/oauth2"
+	"github.com/wjlin0/CVE-2024-23897/pkg/credential"
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
 )
 
 var (
 	extIfFound             = ".exe"
 	ErrNoAssetFound        = errorutil.NewWithFmt("update: could not find release asset for your platform (%s/%s)")
 	SkipCheckSumValidation = false // by default checksum of gh assets is verified with checksums file present in release
+	// ErrNoChecksums is returned by GetReleaseChecksums when the release has no checksums file, matched with errors.Is
+	ErrNoChecksums = errorutil.NewWithTag("updater", "checksum file not in release assets")
+	// ErrChecksumMismatch is returned when a downloaded asset doesn't match the checksums file or isn't listed in it,
+	// matched with errors.Is
+	ErrChecksumMismatch = errorutil.NewWithTag("updater", "asset checksum mismatch")
+	// githubBaseURL overrides the github api url, set by SetGitHubBaseURL and by the tests
+	githubBaseURL *url.URL
 )
 
 // AssetFileCallback function is executed on every file in unpacked asset . if returned error
 // is not nil furthur processing of asset file is stopped
 type AssetFileCallback func(path string, fileInfo fs.FileInfo, data io.Reader) error
 
-// GHReleaseDownloader fetches and reads release of a gh repo
+// GHReleaseDownloader fetches and reads release of a gh repo, or of a gitlab project
 type GHReleaseDownloader struct {
-	assetName     string // required assetName given as input
-	repoName      string // we assume toolname and repoName are always same
-	fullAssetName string // full asset name of asset that contains tool for this platform
-	organization  string // organization name of repo
-	Format        AssetFormat
-	AssetID       int
-	Latest        *github.RepositoryRelease
-	client        *github.Client
-	httpClient    *http.Client
+	assetName      string // asset base name, defaults to repoName
+	executableName string // executable name inside the archive, defaults to assetName
+	repoName       string // we assume toolname and repoName are always same
+	fullAssetName  string // full asset name of asset that contains tool for this platform
+	organization   string // organization name of repo
+	Format         AssetFormat
+	AssetID        int
+	Latest         *github.RepositoryRelease
+	latestRaw      json.RawMessage          // unmodified api response of Latest
+	tagged         map[string]taggedRelease // releases fetched by tag
+	source         ReleaseSource
+	forge          string      // SourceGitHub, SourceGitLab or SourceGitea
+	apiHost        string      // host of the api calls, e.g. of a github enterprise server
+	authenticated  bool        // whether the api calls carry the github-token or gitlab-token credential
+	cache          *AssetCache // verified assets shared by the updaters, nil downloads every asset
+	cached         bool        // whether the last executable asset was read from the cache
+	egress         *egress.Counter
+	ctx            context.Context         // cancels the requests of the downloader
+	prereleases    bool                    // whether the latest release may be a pre-release
+	extractWorkers int                     // source callbacks called concurrently, see WithExtractWorkers
+	sourceProgress func(read, total int64) // notified of the bytes of the source downloaded, nil for none
+	httpClient     *http.Client            // sends the api calls and the downloads instead of the updater transports, see WithHTTPClient
+	options        *Options                // replaces the package variables, see WithOptions
+	assetPattern   *template.Template      // name of the asset of the platform, DefaultAssetPattern when nil
+	comparer       VersionComparer         // compares the installed version with the releases, VersionComparison when nil
 }
 
 // NewghReleaseDownloader returns GHRD instance
-func NewghReleaseDownloader(RepoName string) (*GHReleaseDownloader, error) {
-	var orgName, repoName string
-	if strings.Contains(RepoName, "/") {
-		arr := strings.Split(RepoName, "/")
-		if len(arr) != 2 {
-			return nil, errorutil.NewWithTag("update", "invalid repo name %v", RepoName)
-		}
-		orgName = arr[0]
-		repoName = arr[1]
-	} else {
-		orgName = Organization
-		repoName = RepoName
+func NewghReleaseDownloader(RepoName string, opts ...DownloaderOption) (*GHReleaseDownloader, error) {
+	return newghReleaseDownloader(context.Background(), RepoName, nil, opts...)
+}
+
+// NewghReleaseDownloaderWithContext returns GHRD instance whose requests are aborted when ctx is done
+func NewghReleaseDownloaderWithContext(ctx context.Context, RepoName string, opts ...DownloaderOption) (*GHReleaseDownloader, error) {
+	return newghReleaseDownloader(ctx, RepoName, nil, opts...)
+}
+
+// newghReleaseDownloader returns GHRD instance whose github api calls wait on limiter if not nil
+func newghReleaseDownloader(ctx context.Context, RepoName string, limiter *apiLimiter, opts ...DownloaderOption) (*GHReleaseDownloader, error) {
+	// 下载前校验来源, 防止被指向不受信任的仓库
+	source, identity, err := enforceUpdateSource(RepoName)
+	if err != nil {
+		return nil, err
 	}
-	httpClient := &http.Client{
-		Timeout: DownloadUpdateTimeout,
+	if !allowlisted(identity) {
+		updateLog.Warning().Label("updater").Msgf("downloading releases of %v outside the update source allowlist", identity)
 	}
-	if orgName == "" {
-		return nil, errorutil.NewWithTag("update", "organization name cannot be empty")
+	forge, orgName, repoName, _ := parseSource(source)
+	warnGitHubHostEnv(forge)
+	name := forgeCredential(forge)
+	token, err := credential.Get(name)
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("could not read the %v credential", name)
+	}
+	apiURL, uploadURL := githubURLs()
+	var header, prefix string
+	switch forge {
+	case SourceGitLab:
+		if apiURL, err = url.Parse(GitLabURL); err != nil || apiURL.Host == "" {
+			return nil, errorutil.New("invalid gitlab url %v", GitLabURL)
+		}
+		header = "PRIVATE-TOKEN"
+	case SourceGitea:
+		instance := giteaURL()
+		if instance == "" {
+			return nil, errorutil.New("the gitea url of %v is not set, set %v or call SetReleaseSource", source, GiteaURLEnv)
+		}
+		if apiURL, err = url.Parse(strings.TrimSuffix(instance, "/") + "/api/v1/"); err != nil || apiURL.Host == "" {
+			return nil, errorutil.New("invalid gitea url %v", instance)
+		}
+		header, prefix = "Authorization", "token "
+	}
+	ghrd := GHReleaseDownloader{forge: forge, apiHost: apiURL.Host, repoName: repoName, assetName: repoName, authenticated: token != "", organization: orgName, cache: assetCache(), ctx: ctx}
+	for _, opt := range opts {
+		opt(&ghrd)
+	}
+	ghrd.prereleases = ghrd.prereleases || resolveOptions(ghrd.options).IncludePrereleases
+	transport, download := apiTransport(), downloadTransport()
+	apiClient, httpClient := &http.Client{Timeout: ghrd.downloadTimeout()}, &http.Client{Timeout: ghrd.downloadTimeout()}
+	if ghrd.httpClient != nil {
+		// 复制调用方的客户端, 不修改它
+		transport, download = clientTransport(ghrd.httpClient), clientTransport(ghrd.httpClient)
+		injectedAPI, injectedDownload := *ghrd.httpClient, *ghrd.httpClient
+		apiClient, httpClient = &injectedAPI, &injectedDownload
+		if ghrd.options != nil {
+			apiClient.Timeout, httpClient.Timeout = ghrd.downloadTimeout(), ghrd.downloadTimeout()
+		}
 	}
-	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
-		httpClient = oauth2.NewClient(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+	if token != "" {
+		// 只发送给 api 主机, 不随重定向发送到下载地址
+		transport = &tokenTransport{host: apiURL.Host, token: prefix + token, header: header, base: transport}
+		download = &tokenTransport{host: apiURL.Host, token: prefix + token, header: header, base: download}
+	}
+	// api 调用与下载分别计数
+	counter := egress.Default.Child()
+	apiTransport := counter.Transport(egress.UpdaterAPI, transport)
+	if limiter != nil {
+		apiTransport = limiter.Transport(apiTransport)
+	}
+	// 每次重试都计数并等待限速
+	apiClient.Transport = &retryTransport{base: apiTransport}
+	httpClient.Transport = &retryTransport{base: counter.Transport(egress.UpdaterDownload, download)}
+	if forge == SourceGitLab {
+		ghrd.source = &gitlabSource{baseURL: apiURL, project: orgName + "/" + repoName, client: apiClient, httpClient: httpClient}
+	} else {
+		client := github.NewClient(apiClient)
+		client.BaseURL, client.UploadURL = apiURL, uploadURL
+		hub := githubSource{client: client, httpClient: httpClient, organization: orgName, repoName: repoName}
+		ghrd.source = &hub
+		if forge == SourceGitea {
+			ghrd.source = &giteaSource{githubSource: hub}
+		}
 	}
-	ghrd := GHReleaseDownloader{client: github.NewClient(httpClient), repoName: repoName, assetName: repoName, httpClient: httpClient, organization: orgName}
+	ghrd.egress = counter
 
-	err := ghrd.getLatestRelease()
+	if err = ghrd.getLatestRelease(); err != nil && ctx.Err() != nil {
+		return &ghrd, contextError(ctx, "fetching the latest release of %v cancelled", source)
+	}
 	return &ghrd, err
 }
 
+// Cached reports whether the last executable asset was read from the asset cache
+func (d *GHReleaseDownloader) Cached() bool {
+	return d.cached
+}
+
+// Egress returns the bytes exchanged with github by the downloader per category
+func (d *GHReleaseDownloader) Egress() map[string]egress.Usage {
+	return d.egress.Usage()
+}
+
+// Source returns the org/repo the releases are downloaded from, gitlab://group/project on gitlab
+func (d *GHReleaseDownloader) Source() string {
+	return sourceName(d.forge, d.organization, d.repoName)
+}
+
+// SourceURL returns the location of the repo on its forge, e.g. github.com/org/repo
+func (d *GHReleaseDownloader) SourceURL() string {
+	host := "github.com"
+	instance := map[string]string{SourceGitLab: GitLabURL, SourceGitea: giteaURL()}[d.forge]
+	if instanceURL, err := url.Parse(instance); err == nil && instanceURL.Host != "" {
+		host = instanceURL.Host
+	} else if api, _ := githubURLs(); d.forge == SourceGitHub && api.Host != "api.github.com" {
+		host = api.Host
+	}
+	return host + "/" + d.organization + "/" + d.repoName
+}
+
 // SetAssetName: By default RepoName is assumed as ToolName which maynot be the case always setToolName corrects that
 func (d *GHReleaseDownloader) SetToolName(toolName string) {
-	if toolName != "" {
-		d.assetName = toolName
+	d.SetAssetBaseName(toolName)
+}
+
+// SetAssetBaseName sets the prefix of the release asset and checksums file names, by default the repo name
+func (d *GHReleaseDownloader) SetAssetBaseName(assetBaseName string) {
+	if assetBaseName != "" {
+		d.assetName = assetBaseName
+	}
+}
+
+// SetExecutableName sets the name of the executable inside the asset archive, by default the asset base name
+func (d *GHReleaseDownloader) SetExecutableName(executableName string) {
+	if executableName != "" {
+		d.executableName = strings.TrimSuffix(executableName, extIfFound)
+	}
+}
+
+// ExecutableName returns the file name of the executable on this platform
+func (d *GHReleaseDownloader) ExecutableName() string {
+	name := d.executableName
+	if name == "" {
+		name = d.assetName
 	}
+	return executableFileName(name, runtime.GOOS)
+}
+
+// executableFileName returns the file name of executable name on goos
+func executableFileName(name, goos string) string {
+	if goos == "windows" && !strings.HasSuffix(name, extIfFound) {
+		return name + extIfFound
+	}
+	return name
 }
 
 // DownloadTool downloads tool and returns bin data
 func (d *GHReleaseDownloader) DownloadTool() (*bytes.Buffer, error) {
+	return d.downloadTool(d.ctx, "")
+}
+
+// downloadTool downloads the asset of the tool, checksum is its expected sha256 if known
+func (d *GHReleaseDownloader) downloadTool(ctx context.Context, checksum string) (*bytes.Buffer, error) {
 	if err := d.getToolAssetID(d.Latest); err != nil {
 		return nil, err
 	}
-	resp, err := d.downloadAssetwithID(int64(d.AssetID))
+	bin, err := d.downloadAsset(ctx, int64(d.AssetID), d.fullAssetName, checksum, d.showProgress(true))
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if !HideProgressBar {
-		bar := pb.New64(resp.ContentLength).SetMaxWidth(100)
-		bar.Start()
-		resp.Body = bar.NewProxyReader(resp.Body)
-		defer bar.Finish()
-	}
-
-	bin, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errorutil.NewWithErr(err).Msgf("failed to read response body")
-	}
 	return bytes.NewBuffer(bin), nil
 }
 
 // GetReleaseChecksums tries to download tool checksum if release contains any in map[asset_name]checksum_data format
 func (d *GHReleaseDownloader) GetReleaseChecksums() (map[string]string, error) {
+	return d.getReleaseChecksums(d.ctx)
+}
+
+func (d *GHReleaseDownloader) getReleaseChecksums(ctx context.Context) (map[string]string, error) {
 	builder := &strings.Builder{}
 	builder.WriteString(d.assetName)
 	builder.WriteString("_")
@@ -123,17 +264,15 @@ func (d *GHReleaseDownloader) GetReleaseChecksums() (map[string]string, error) {
 		}
 	}
 	if checksumFileAssetID == 0 {
-		return nil, errorutil.NewWithTag("update", "checksum file not in release assets")
+		return nil, newUpdateError(ErrNoChecksums, "release %v of %v has no %v", d.Latest.GetTagName(), d.Source(), checksumFileName)
 	}
 
-	resp, err := d.downloadAssetwithID(int64(checksumFileAssetID))
-	if err != nil {
-		return nil, errorutil.NewWithErr(err).Msgf("failed to download checksum file")
+	bin, err := d.downloadAsset(ctx, int64(checksumFileAssetID), checksumFileName, "", false)
+	if errors.Is(err, ErrLengthMismatch) || isRateLimited(err) {
+		return nil, err
 	}
-	defer resp.Body.Close()
-	bin, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, errorutil.NewWithErr(err).Msgf("failed to read checksum file")
+		return nil, errorutil.NewWithErr(err).Msgf("failed to download checksum file")
 	}
 	data := strings.TrimSpace(string(bin))
 	if data == "" {
@@ -150,41 +289,125 @@ func (d *GHReleaseDownloader) GetReleaseChecksums() (map[string]string, error) {
 	return m, nil
 }
 
+// expectedChecksum returns the sha256 of the tool asset listed by the checksums file of the release and
+// the checksums, an empty checksum when SkipCheckSumValidation is set or the release has no checksums
+// file. A checksums file which can't be read or doesn't list the asset is an error
+func (d *GHReleaseDownloader) expectedChecksum(ctx context.Context) (string, map[string]string, error) {
+	return d.assetChecksum(ctx, d.fullAssetName)
+}
+
+// assetChecksum is expectedChecksum of the asset named name
+func (d *GHReleaseDownloader) assetChecksum(ctx context.Context, name string) (string, map[string]string, error) {
+	if SkipCheckSumValidation {
+		updateLog.Verbose().Label("updater").Msgf("checksum verification of %v skipped", name)
+		return "", nil, nil
+	}
+	checksums, err := d.getReleaseChecksums(ctx)
+	if errors.Is(err, ErrNoChecksums) {
+		updateLog.Info().Label("updater").Msgf("%s, %v is installed without integrity check", err, name)
+		return "", nil, nil
+	}
+	// 校验和文件被代理改写时不能跳过校验
+	if err != nil {
+		return "", nil, err
+	}
+	checksum, ok := checksums[name]
+	if !ok {
+		return "", nil, newUpdateError(ErrChecksumMismatch, "the checksums file of release %v of %v doesn't list %v, the update was refused",
+			d.Latest.GetTagName(), d.Source(), name)
+	}
+	return checksum, checksums, nil
+}
+
 // GetExecutableFromAsset downloads , validates checksum and only returns tool Binary
 func (d *GHReleaseDownloader) GetExecutableFromAsset() ([]byte, error) {
-	var bin []byte
-	var err error
+	return d.GetExecutableFromAssetCtx(d.ctx)
+}
+
+// GetExecutableFromAssetCtx is GetExecutableFromAsset aborting the download and the unpacking when ctx is done
+func (d *GHReleaseDownloader) GetExecutableFromAssetCtx(ctx context.Context) ([]byte, error) {
+	bin, err := d.getExecutableFromAsset(ctx)
+	if err != nil && ctx.Err() != nil {
+		return nil, contextError(ctx, "download of %v cancelled", d.ExecutableName())
+	}
+	return bin, err
+}
+
+func (d *GHReleaseDownloader) getExecutableFromAsset(ctx context.Context) ([]byte, error) {
+	var entries []archiveEntry
 	getToolCallback := func(path string, fileInfo fs.FileInfo, data io.Reader) error {
-		if !strings.EqualFold(strings.TrimSuffix(fileInfo.Name(), extIfFound), d.assetName) {
+		if !fileInfo.Mode().IsRegular() {
 			return nil
 		}
-		bin, err = io.ReadAll(data)
-		return err
+		bin, err := io.ReadAll(data)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, archiveEntry{path: path, data: bin})
+		return nil
 	}
 
-	buff, err := d.DownloadTool()
+	if err := d.getToolAssetID(d.Latest); err != nil {
+		return nil, err
+	}
+	expectedChecksum, checksums, err := d.expectedChecksum(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if err := d.checkFingerprint(checksums); err != nil {
+		return nil, err
+	}
 
-	var expectedChecksum string
-	checksums, err := d.GetReleaseChecksums()
-	if checksums != nil {
-		expectedChecksum = checksums[d.fullAssetName]
+	if err := failpoint(FailpointDownload); err != nil {
+		return nil, err
+	}
+	// 校验和已知时优先使用缓存中已校验的资源
+	var buff *bytes.Buffer
+	d.cached = false
+	if d.cache != nil && expectedChecksum != "" {
+		if data, ok := d.cache.Get(expectedChecksum); ok {
+			updateLog.Verbose().Msgf("using cached %v", d.fullAssetName)
+			buff, d.cached = bytes.NewBuffer(data), true
+		}
+	}
+	if buff == nil {
+		var err error
+		if buff, err = d.downloadTool(ctx, expectedChecksum); err != nil {
+			return nil, err
+		}
+	}
+	if err := failpoint(FailpointChecksum); err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("asset file corrupted: checksum mismatch")
 	}
 	// verify integrity using checksum
-	if expectedChecksum != "" {
+	if expectedChecksum != "" && !d.cached {
 		gotChecksumbytes := sha256.Sum256(buff.Bytes())
 		gotchecksum := hex.EncodeToString(gotChecksumbytes[:])
 		if expectedChecksum != gotchecksum {
-			return nil, errorutil.NewWithTag("checksum", "asset file corrupted: checksum mismatch expected %v but got %v", expectedChecksum, gotchecksum)
+			return nil, newUpdateError(ErrChecksumMismatch, "asset file %v corrupted: checksum mismatch expected %v but got %v, the update was refused",
+				d.fullAssetName, expectedChecksum, gotchecksum)
 		} else {
-			gologger.Info().Msgf("Verified Integrity of %v", d.fullAssetName)
+			updateLog.Info().Msgf("Verified Integrity of %v", d.fullAssetName)
+		}
+		if d.cache != nil {
+			if err := d.cache.Put(expectedChecksum, buff.Bytes()); err != nil {
+				updateLog.Warning().Msgf("%v", err)
+			}
 		}
 	}
 
-	_ = UnpackAssetWithCallback(d.Format, bytes.NewReader(buff.Bytes()), getToolCallback)
-	return bin, errorutil.WrapfWithNil(err, "executable not found in archive") // Note: WrapfWithNil wraps msg if err != nil
+	if err := d.verifySignature(ctx, buff.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if err := unpackAsset(ctx, d.ExecutableName(), buff.Bytes(), getToolCallback); err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to unpack %v", d.fullAssetName)
+	}
+	entry, err := selectExecutable(entries, d.ExecutableName())
+	if err != nil {
+		return nil, err
+	}
+	return entry.data, nil
 }
 
 // DownloadAssetWithName downloads asset with given name
@@ -198,122 +421,209 @@ func (d *GHReleaseDownloader) DownloadAssetWithName(assetname string, showProgre
 	if assetID == 0 {
 		return nil, errorutil.New("release asset %v not found", assetname)
 	}
-	resp, err := d.downloadAssetwithID(int64(assetID))
+	bin, err := d.downloadAsset(d.ctx, int64(assetID), assetname, "", showProgressBar)
+	if errors.Is(err, ErrCredentialRejected) || errors.Is(err, ErrLengthMismatch) || isRateLimited(err) {
+		return nil, err
+	}
 	if err != nil {
 		return nil, errorutil.NewWithErr(err).Msgf("failed to download asset %v", assetname)
 	}
-	defer resp.Body.Close()
+	return bytes.NewBuffer(bin), nil
+}
 
-	if showProgressBar {
-		bar := pb.New64(resp.ContentLength).SetMaxWidth(100)
-		bar.Start()
-		resp.Body = bar.NewProxyReader(resp.Body)
-		defer bar.Finish()
-	}
+// DownloadSourceWithCallback downloads source code of latest release and calls callback for each file in archive,
+// one at a time unless the downloader has WithExtractWorkers
+func (d *GHReleaseDownloader) DownloadSourceWithCallback(showProgressBar bool, callback AssetFileCallback) error {
+	return d.DownloadSourceWithCallbackCtx(d.ctx, showProgressBar, callback)
+}
 
-	bin, err := io.ReadAll(resp.Body)
+// DownloadSourceWithCallbackCtx is DownloadSourceWithCallback aborting the download and the unpacking when ctx is done
+func (d *GHReleaseDownloader) DownloadSourceWithCallbackCtx(ctx context.Context, showProgressBar bool, callback AssetFileCallback) error {
+	bin, err := d.DownloadSourceCtx(ctx, showProgressBar)
 	if err != nil {
-		return nil, errorutil.NewWithErr(err).Msgf("failed to read resp body")
+		return err
 	}
-	return bytes.NewBuffer(bin), nil
+	return unpackSource(ctx, d.repoName, bin, d.showProgress(showProgressBar), d.callbackWorkers(), callback)
 }
 
-// DownloadSourceWithCallback downloads source code of latest release and calls callback for each file in archive
-func (d *GHReleaseDownloader) DownloadSourceWithCallback(showProgressBar bool, callback AssetFileCallback) error {
-	downloadURL := d.Latest.GetZipballURL()
+// unpackSource unpacks the zipball of repoName calling callback for up to workers entries concurrently,
+// showing the extraction progress per file if asked
+func unpackSource(ctx context.Context, repoName string, source []byte, showProgressBar bool, workers int, callback AssetFileCallback) error {
+	var files int64
+	zipReader, err := zip.NewReader(bytes.NewReader(source), int64(len(source)))
+	if err == nil {
+		files = int64(len(zipReader.File))
+	}
+	bar := newProgress("extracting "+repoName, files, true, showProgressBar)
+	defer bar.Finish()
+	progressCallback := func(path string, fileInfo fs.FileInfo, data io.Reader) error {
+		bar.Add(1, path)
+		return callback(path, fileInfo, data)
+	}
+	if zipReader == nil || workers <= 1 {
+		return UnpackAssetWithCallbackCtx(ctx, Zip, bytes.NewReader(source), progressCallback)
+	}
+	return unpackZipConcurrently(ctx, zipReader, workers, progressCallback)
+}
 
-	resp, err := d.httpClient.Get(downloadURL)
+// DownloadSource downloads the zipball of the latest release
+func (d *GHReleaseDownloader) DownloadSource(showProgressBar bool) ([]byte, error) {
+	return d.DownloadSourceCtx(d.ctx, showProgressBar)
+}
+
+// DownloadSourceCtx is DownloadSource aborting the download when ctx is done
+func (d *GHReleaseDownloader) DownloadSourceCtx(ctx context.Context, showProgressBar bool) ([]byte, error) {
+	return retryDownload(ctx, d.repoName+Zip.FileExtension(), func() ([]byte, error) {
+		return d.downloadSourceOnce(ctx, showProgressBar)
+	})
+}
+
+func (d *GHReleaseDownloader) downloadSourceOnce(ctx context.Context, showProgressBar bool) ([]byte, error) {
+	start := time.Now()
+	resp, err := d.source.DownloadSource(ctx, d.Latest)
 	if err != nil {
-		return errorutil.NewWithErr(err).Msgf("failed to source of %v", d.repoName)
+		if ctx.Err() != nil {
+			return nil, contextError(ctx, "download of the source of %v cancelled", d.repoName)
+		}
+		return nil, errorutil.NewWithErr(err).Msgf("failed to source of %v", d.repoName)
 	}
 	defer resp.Body.Close()
-	if showProgressBar {
-		bar := pb.New64(resp.ContentLength).SetMaxWidth(100)
-		bar.Start()
-		resp.Body = bar.NewProxyReader(resp.Body)
-		defer bar.Finish()
+	if resp.StatusCode != http.StatusOK {
+		if limited := d.rateLimited(resp, nil, "downloading the source of "+d.Source()); limited != nil {
+			return nil, limited
+		}
+		if rejected := d.credentialRejected(resp, nil, "downloading the source"); rejected != nil {
+			return nil, rejected
+		}
+		return nil, errorutil.New("something went wrong got %v while downloading the source of %v, expected status 200", resp.StatusCode, d.repoName)
 	}
 
-	bin, err := io.ReadAll(resp.Body)
+	if d.sourceProgress != nil {
+		resp.Body = &progressBody{ReadCloser: resp.Body, total: resp.ContentLength, notify: d.sourceProgress}
+	}
+	bin, err := readBody(resp, d.repoName+Zip.FileExtension(), start, 0, d.showProgress(showProgressBar))
 	if err != nil {
-		return errorutil.NewWithErr(err).Msgf("failed to read resp body")
+		if ctx.Err() != nil {
+			return nil, contextError(ctx, "download of the source of %v cancelled", d.repoName)
+		}
+		if networkError(err) {
+			return nil, newUpdateError(errInterrupted, "download of the source of %v interrupted: %v", d.repoName, err)
+		}
+		return nil, errorutil.NewWithErr(err).Msgf("failed to read resp body")
 	}
-	return UnpackAssetWithCallback(Zip, bytes.NewReader(bin), callback)
+	return decodeBody(bin, resp.Header.Get("Content-Encoding"), d.repoName+Zip.FileExtension(), "")
+}
+
+// HasAsset reports whether the latest release has an asset named assetname
+func (d *GHReleaseDownloader) HasAsset(assetname string) bool {
+	for _, v := range d.Latest.Assets {
+		if v.GetName() == assetname {
+			return true
+		}
+	}
+	return false
 }
 
 // getLatestRelease returns latest release of error
 func (d *GHReleaseDownloader) getLatestRelease() error {
-	release, resp, err := d.client.Repositories.GetLatestRelease(context.Background(), d.organization, d.repoName)
+	tag, err := d.latestPrerelease()
 	if err != nil {
+		return err
+	}
+	release, raw, resp, err := d.source.Release(d.ctx, tag)
+	getMetrics().IncCounter(MetricChecks, map[string]string{"repo": d.Source(), "result": resultLabel(err)})
+	if err != nil {
+		if limited := d.rateLimited(resp, err, "fetching the latest release of "+d.Source()); limited != nil {
+			return limited
+		}
+		if rejected := d.credentialRejected(resp, err, "fetching the latest release"); rejected != nil {
+			return rejected
+		}
 		errx := errorutil.NewWithErr(err)
 		if resp != nil && resp.StatusCode == http.StatusNotFound {
 			errx = errx.Msgf("repo %v/%v not found got ", d.organization, d.repoName)
-		} else if _, ok := err.(*github.RateLimitError); ok {
-			errx = errx.Msgf("hit github ratelimit while downloading latest release")
-		} else if resp != nil && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized) {
-			errx = errx.Msgf("gh auth failed try unsetting GITHUB_TOKEN env variable")
+		} else if networkError(err) {
+			// 指明配置的主机, 避免误以为 github.com 不可用
+			errx = errx.Msgf("could not reach %v at %v while fetching the latest release of %v", d.forge, d.apiHost, d.Source())
 		}
 		return errx
 	}
-	d.Latest = release
+	d.Latest, d.latestRaw = release, raw
 	return nil
 }
 
-// getToolAssetID tries to find assetId of tool required for this platform
-func (d *GHReleaseDownloader) getToolAssetID(latest *github.RepositoryRelease) error {
-	builder := &strings.Builder{}
-	builder.WriteString(d.assetName)
-	builder.WriteString("_")
-	builder.WriteString(strings.TrimPrefix(d.Latest.GetTagName(), "v"))
-	builder.WriteString("_")
-	if strings.EqualFold(runtime.GOOS, "darwin") {
-		builder.WriteString("macOS")
-	} else {
-		builder.WriteString(runtime.GOOS)
+// LatestRaw returns the api response of the latest release as received, for the fields Latest doesn't
+// wrap. It follows the schema of the api of the forge and costs no request
+func (d *GHReleaseDownloader) LatestRaw() (json.RawMessage, error) {
+	if d.latestRaw == nil {
+		return nil, errorutil.NewWithTag("updater", "latest release of %v/%v was not fetched", d.organization, d.repoName)
 	}
-	builder.WriteString("_")
-	builder.WriteString(runtime.GOARCH)
-
-loop:
-	for _, v := range latest.Assets {
-		asset := v.GetName()
-		switch {
-		case strings.Contains(asset, Zip.FileExtension()):
-			if strings.EqualFold(asset, builder.String()+Zip.FileExtension()) {
-				d.AssetID = int(v.GetID())
-				d.Format = Zip
-				d.fullAssetName = asset
-				break loop
-			}
-		case strings.Contains(asset, Tar.FileExtension()):
-			if strings.EqualFold(asset, builder.String()+Tar.FileExtension()) {
-				d.AssetID = int(v.GetID())
-				d.Format = Tar
-				d.fullAssetName = asset
-				break loop
-			}
+	return d.latestRaw, nil
+}
+
+// ReleaseByTag returns the release of the repo tagged tag
+func (d *GHReleaseDownloader) ReleaseByTag(tag string) (*github.RepositoryRelease, error) {
+	release, _, err := d.releaseByTag(tag)
+	return release, err
+}
+
+// ReleaseByTagRaw returns the api response of the release tagged tag as received. The latest release and
+// the tags already fetched cost no request
+func (d *GHReleaseDownloader) ReleaseByTagRaw(tag string) (json.RawMessage, error) {
+	_, raw, err := d.releaseByTag(tag)
+	return raw, err
+}
+
+func (d *GHReleaseDownloader) releaseByTag(tag string) (*github.RepositoryRelease, json.RawMessage, error) {
+	if d.Latest != nil && d.Latest.GetTagName() == tag && d.latestRaw != nil {
+		return d.Latest, d.latestRaw, nil
+	}
+	if tagged, ok := d.tagged[tag]; ok {
+		return tagged.release, tagged.raw, nil
+	}
+	release, raw, resp, err := d.source.Release(d.ctx, tag)
+	if err != nil {
+		if rejected := d.credentialRejected(resp, err, "fetching release "+tag); rejected != nil {
+			return nil, nil, rejected
+		}
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil, newUpdateError(ErrReleaseNotFound, "release %v of %v not found", tag, d.Source())
 		}
+		return nil, nil, errorutil.NewWithErr(err)
 	}
-	builder.Reset()
-
-	// handle if id is zero (no asset found)
-	if d.AssetID == 0 {
-		return ErrNoAssetFound.Msgf(runtime.GOOS, runtime.GOARCH)
+	if d.tagged == nil {
+		d.tagged = make(map[string]taggedRelease)
 	}
-	return nil
+	d.tagged[tag] = taggedRelease{release: release, raw: raw}
+	return release, raw, nil
+}
+
+// taggedRelease is a release fetched by tag and the api response it was decoded from
+type taggedRelease struct {
+	release *github.RepositoryRelease
+	raw     json.RawMessage
 }
 
 // downloadAssetwithID
-func (d *GHReleaseDownloader) downloadAssetwithID(id int64) (*http.Response, error) {
-	_, rdurl, err := d.client.Repositories.DownloadReleaseAsset(context.Background(), d.organization, d.repoName, id, nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := d.httpClient.Get(rdurl)
+func (d *GHReleaseDownloader) downloadAssetwithID(ctx context.Context, id int64) (*http.Response, error) {
+	resp, err := d.source.DownloadAsset(ctx, d.Latest, id)
 	if err != nil {
+		if limited := d.rateLimited(resp, err, "downloading an asset"); limited != nil {
+			return nil, limited
+		}
+		if rejected := d.credentialRejected(resp, err, "downloading an asset"); rejected != nil {
+			return nil, rejected
+		}
 		return nil, errorutil.NewWithErr(err).Msgf("failed to download release asset")
 	}
 	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		if limited := d.rateLimited(resp, nil, "downloading an asset"); limited != nil {
+			return nil, limited
+		}
+		if rejected := d.credentialRejected(resp, nil, "downloading an asset"); rejected != nil {
+			return nil, rejected
+		}
 		return nil, errorutil.New("something went wrong got %v while downloading asset, expected status 200", resp.StatusCode)
 	}
 	if resp.Body == nil {
@@ -322,45 +632,53 @@ func (d *GHReleaseDownloader) downloadAssetwithID(id int64) (*http.Response, err
 	return resp, nil
 }
 
+// readBody reads the body of a download, showing a progress bar if asked, and observes its size and duration.
+// The bar total is size if known, else the Content-Length, proxies may drop or change it
+func readBody(resp *http.Response, name string, start time.Time, size int64, showProgressBar bool) ([]byte, error) {
+	body := resp.Body
+	if size <= 0 {
+		size = resp.ContentLength
+	}
+	bar := newProgress(name, size, false, showProgressBar)
+	defer bar.Finish()
+	bin, err := io.ReadAll(bar.Reader(body))
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{"asset": name}
+	getMetrics().Observe(MetricDownloadBytes, float64(len(bin)), labels)
+	getMetrics().Observe(MetricDownloadDuration, time.Since(start).Seconds(), labels)
+	return bin, nil
+}
+
 // UnpackAssetWithCallback unpacks asset and executes callback function on every file in data
 func UnpackAssetWithCallback(format AssetFormat, data *bytes.Reader, callback AssetFileCallback) error {
-	if format != Zip && format != Tar {
-		return errorutil.NewWithTag("unpack", "github asset format not supported. only zip and tar are supported")
+	return UnpackAssetWithCallbackCtx(context.Background(), format, data, callback)
+}
+
+// UnpackAssetWithCallbackCtx is UnpackAssetWithCallback stopping before the next file when ctx is done. The
+// archive is detected by its magic bytes, format is not needed. Data which is not an archive is an error
+func UnpackAssetWithCallbackCtx(ctx context.Context, format AssetFormat, data *bytes.Reader, callback AssetFileCallback) error {
+	buffer := make([]byte, data.Size())
+	if _, err := data.ReadAt(buffer, 0); err != nil && err != io.EOF {
+		return err
 	}
-	if format == Zip {
-		zipReader, err := zip.NewReader(data, data.Size())
-		if err != nil {
-			return err
-		}
-		for _, f := range zipReader.File {
-			data, err := f.Open()
-			if err != nil {
-				return err
-			}
-			if err := callback(f.Name, f.FileInfo(), data); err != nil {
-				return err
-			}
-			_ = data.Close()
-		}
-	} else if format == Tar {
-		gzipReader, err := gzip.NewReader(data)
-		if err != nil {
-			return err
-		}
-		tarReader := tar.NewReader(gzipReader)
-		// iterate through the files in the archive
-		for {
-			header, err := tarReader.Next()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return err
-			}
-			if err := callback(header.Name, header.FileInfo(), tarReader); err != nil {
-				return err
-			}
-		}
+	return unpackAsset(ctx, "", buffer, callback)
+}
+
+// contextError returns the error of ctx with msg when ctx is done and nil otherwise, errors.Is matches
+// it with context.Canceled or context.DeadlineExceeded
+func contextError(ctx context.Context, format string, args ...any) error {
+	if ctx.Err() == nil {
+		return nil
 	}
-	return nil
+	return newUpdateError(ctx.Err(), format, args...)
+}
+
+// responseOf returns the http response of a github api response, nil if there is none
+func responseOf(resp *github.Response) *http.Response {
+	if resp == nil {
+		return nil
+	}
+	return resp.Response
 }
@@ -0,0 +1,56 @@
+package updateutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestExecutableFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		goos string
+		want string
+	}{
+		{name: "jaudit", goos: "linux", want: "jaudit"},
+		{name: "jaudit", goos: "windows", want: "jaudit.exe"},
+		{name: "jaudit.exe", goos: "windows", want: "jaudit.exe"},
+	}
+	for _, test := range tests {
+		if got := executableFileName(test.name, test.goos); got != test.want {
+			t.Errorf("executableFileName(%v, %v) = %v, want %v", test.name, test.goos, got, test.want)
+		}
+	}
+}
+
+func TestUpdateToolsMismatchedNames(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	// 仓库名 jenkins-audit, 资产前缀 jaudit-suite, 压缩包及安装后的可执行文件名 jaudit
+	release := &fakeRelease{Tag: "v1.2.0", Assets: map[string][]byte{
+		platformAssetName("jaudit-suite", "v1.2.0", Tar): tarGz(t, map[string][]byte{
+			"jenkins-audit": []byte("decoy"),
+			"jaudit":        []byte("jaudit-bin"),
+		}),
+	}}
+	fake.AddRelease(Organization+"/jenkins-audit", release)
+
+	updater := &Updater{APIRequestsPerMinute: -1}
+	defer updater.Close()
+	dir := t.TempDir()
+	summary := updater.UpdateTools(context.Background(), []Tool{
+		{Name: "jenkins-audit", Repo: "jenkins-audit", AssetBaseName: "jaudit-suite", ExecutableName: "jaudit", Version: "1.0.0"},
+	}, dir)
+	result := summary.Results[0]
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if filepath.Base(result.Path) != executableFileName("jaudit", runtime.GOOS) {
+		t.Errorf("installed at %v, want jaudit", result.Path)
+	}
+	if bin, err := os.ReadFile(result.Path); err != nil || string(bin) != "jaudit-bin" {
+		t.Errorf("installed %q, %v, want jaudit-bin", bin, err)
+	}
+}
@@ -0,0 +1,233 @@
+package updateutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wjlin0/CVE-2024-23897/pkg/credential"
+)
+
+// fakeGitea serves the subset of the gitea api used by the updater, with the fields of gitea only
+type fakeGitea struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	releases map[string]*fakeRelease
+	// Token is required as "token" Authorization by every request when set, like a private mirror
+	Token string
+	// auth are the Authorization headers received per path
+	auth map[string]string
+}
+
+// newFakeGitea starts a fake gitea and restores the release source of the updater when the test ends
+func newFakeGitea(t *testing.T) *fakeGitea {
+	f := &fakeGitea{releases: make(map[string]*fakeRelease), auth: make(map[string]string)}
+	f.Server = httptest.NewServer(f)
+	giteaURL, source, allowlist, cacheDir, backoff := GiteaURL, DefaultSource, UpdateSourceAllowlist, AssetCacheDir, RetryBackoff
+	UpdateSourceAllowlist = []string{DefaultUpdateSource()}
+	RetryBackoff = time.Millisecond
+	AssetCacheDir = t.TempDir()
+	t.Cleanup(func() {
+		GiteaURL, DefaultSource, UpdateSourceAllowlist, AssetCacheDir, RetryBackoff = giteaURL, source, allowlist, cacheDir, backoff
+		credential.Default.Select(credential.GiteaToken, &credential.Env{Variable: "GITEA_TOKEN"})
+		f.Close()
+	})
+	return f
+}
+
+// AddRelease sets the latest release of owner/repo and allowlists it as update source
+func (f *fakeGitea) AddRelease(repo string, release *fakeRelease) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.releases[repo] = release
+	// gitea 的来源总是带上实例的主机
+	UpdateSourceAllowlist = append(UpdateSourceAllowlist, "gitea://"+strings.TrimPrefix(f.URL, "http://")+"/"+repo)
+}
+
+func (f *fakeGitea) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.auth[req.URL.Path] = req.Header.Get("Authorization")
+	if f.Token != "" && req.Header.Get("Authorization") != "token "+f.Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message":"user does not exist [uid: 0, name: ]","url":"` + f.URL + `/api/swagger"}`))
+		return
+	}
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	// /api/v1/repos/{owner}/{repo}/releases/latest, /api/v1/repos/{owner}/{repo}/releases/tags/{tag}
+	case len(parts) >= 7 && parts[0] == "api" && parts[1] == "v1" && parts[5] == "releases":
+		repo := parts[3] + "/" + parts[4]
+		release, ok := f.releases[repo]
+		if !ok || !(len(parts) == 7 && parts[6] == "latest" || len(parts) == 8 && parts[6] == "tags" && parts[7] == release.Tag) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":null,"message":"not found","url":"` + f.URL + `/api/swagger"}`))
+			return
+		}
+		var assets []map[string]interface{}
+		for _, name := range release.assetNames() {
+			assets = append(assets, map[string]interface{}{
+				"id":                   release.assetID(name),
+				"name":                 name,
+				"size":                 len(release.Assets[name]),
+				"download_count":       0,
+				"created_at":           "2024-02-01T10:00:00Z",
+				"uuid":                 fmt.Sprintf("%032x", release.assetID(name)),
+				"browser_download_url": fmt.Sprintf("%s/%s/releases/download/%s/%s", f.URL, repo, release.Tag, name),
+			})
+		}
+		// gitea 不返回 target_commitish 等 github 独有的字段
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":           release.ID,
+			"tag_name":     release.Tag,
+			"name":         release.Tag,
+			"body":         release.Body,
+			"url":          fmt.Sprintf("%s/api/v1/repos/%s/releases/%d", f.URL, repo, release.ID),
+			"html_url":     fmt.Sprintf("%s/%s/releases/tag/%s", f.URL, repo, release.Tag),
+			"tarball_url":  fmt.Sprintf("%s/%s/archive/%s.tar.gz", f.URL, repo, release.Tag),
+			"zipball_url":  fmt.Sprintf("%s/%s/archive/%s.zip", f.URL, repo, release.Tag),
+			"draft":        false,
+			"prerelease":   false,
+			"created_at":   "2024-02-01T10:00:00Z",
+			"published_at": "2024-02-01T10:00:00Z",
+			"author":       map[string]interface{}{"id": 1, "login": "mirror-bot"},
+			"assets":       assets,
+		})
+	// /{owner}/{repo}/releases/download/{tag}/{name}
+	case len(parts) == 6 && parts[2] == "releases" && parts[3] == "download":
+		release, ok := f.releases[parts[0]+"/"+parts[1]]
+		if !ok || release.Assets[parts[5]] == nil {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(release.Assets[parts[5]])
+	// /{owner}/{repo}/archive/{tag}.zip
+	case len(parts) == 4 && parts[2] == "archive":
+		release, ok := f.releases[parts[0]+"/"+parts[1]]
+		if !ok || release.Source == nil || parts[3] != release.Tag+".zip" {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(release.Source)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// header returns the Authorization header received by path
+func (f *fakeGitea) header(path string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.auth[path]
+}
+
+func TestGiteaRelease(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitea(t)
+	fake.Token = "gitea0123456789"
+	bin := []byte("mirrored binary")
+	fake.AddRelease("mirror/mytool", newToolRelease(t, "mytool", "v1.2.0", bin))
+	if err := SetReleaseSource(SourceGitea, fake.URL+"/", fake.Token); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewghReleaseDownloader("mirror/mytool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.cache = nil
+	if d.Source() != "gitea://mirror/mytool" {
+		t.Errorf("Source() = %v", d.Source())
+	}
+	if d.Latest.GetTagName() != "v1.2.0" || d.Latest.TargetCommitish != nil {
+		t.Errorf("latest release = %v, target_commitish %v", d.Latest.GetTagName(), d.Latest.TargetCommitish)
+	}
+	got, err := d.GetExecutableFromAsset()
+	if err != nil || !bytes.Equal(got, bin) {
+		t.Fatalf("GetExecutableFromAsset() = %q, %v, want the binary", got, err)
+	}
+	name := platformAssetName("mytool", "v1.2.0", Tar)
+	if auth := fake.header("/mirror/mytool/releases/download/v1.2.0/" + name); auth != "token "+fake.Token {
+		t.Errorf("asset download got Authorization %q", auth)
+	}
+	if release, err := d.ReleaseByTag("v1.2.0"); err != nil || release.GetTagName() != "v1.2.0" {
+		t.Errorf("ReleaseByTag() = %v, %v", release, err)
+	}
+
+	if err := SetReleaseSource(SourceGitea, "", "gitea-revoked"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewghReleaseDownloader("mirror/mytool"); !errors.Is(err, ErrCredentialRejected) || !strings.Contains(err.Error(), credential.GiteaToken) {
+		t.Errorf("NewghReleaseDownloader() with an invalid token = %v, want %v", err, ErrCredentialRejected)
+	}
+}
+
+func TestGiteaDirUpdate(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitea(t)
+	fake.AddRelease("mirror/templates", newTemplatesRelease(t))
+	// 通过环境变量配置, 仓库名使用 gitea:// 前缀时不依赖 UPDATE_SOURCE
+	t.Setenv(GiteaURLEnv, fake.URL)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"cves/change.yaml": "old"})
+
+	if err := GetUpdateDirFromRepoCallback("templates", dir, "gitea://mirror/templates")(); err != nil {
+		t.Fatalf("GetUpdateDirFromRepoCallback() = %v", err)
+	}
+	for name, want := range map[string]string{"cves/new.yaml": "new", "cves/change.yaml": "changed", ".version": "v1.0.1"} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != want {
+			t.Errorf("%v = %q, %v, want %q", name, data, err, want)
+		}
+	}
+}
+
+func TestReleaseSourceEnv(t *testing.T) {
+	fake := newFakeGitea(t)
+	fake.Token = "gitea-env0123456789"
+	fake.AddRelease(Organization+"/mytool", newToolRelease(t, "mytool", "v1.2.0", []byte("bin")))
+	t.Setenv(SourceEnv, SourceGitea)
+	t.Setenv(GiteaURLEnv, fake.URL)
+	t.Setenv("GITEA_TOKEN", fake.Token)
+	credential.Default.Select(credential.GiteaToken, &credential.Env{Variable: "GITEA_TOKEN"})
+
+	d, err := NewghReleaseDownloader("mytool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Source() != "gitea://"+Organization+"/mytool" || !strings.HasPrefix(d.SourceURL(), strings.TrimPrefix(fake.URL, "http://")) {
+		t.Errorf("Source() = %v, SourceURL() = %v", d.Source(), d.SourceURL())
+	}
+
+	tests := []struct {
+		forge   string
+		baseURL string
+		wantErr bool
+	}{
+		{forge: SourceGitea, baseURL: fake.URL},
+		{forge: SourceGitLab, baseURL: "https://gitlab.example.com"},
+		{forge: "GitHub"},
+		{forge: SourceGitea, baseURL: "gitea.example.com", wantErr: true},
+		{forge: "bitbucket", wantErr: true},
+	}
+	gitlabURL := GitLabURL
+	defer func() { GitLabURL = gitlabURL }()
+	for _, test := range tests {
+		if err := SetReleaseSource(test.forge, test.baseURL, ""); test.wantErr != (err != nil) {
+			t.Errorf("SetReleaseSource(%q, %q) = %v, want error %v", test.forge, test.baseURL, err, test.wantErr)
+		}
+	}
+	os.Unsetenv(GiteaURLEnv)
+	GiteaURL = ""
+	if err := SetReleaseSource(SourceGitea, "", ""); err == nil {
+		t.Error("SetReleaseSource() of gitea without url succeeded")
+	}
+}
@@ -0,0 +1,248 @@
+package updateutils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v30/github"
+	"github.com/wjlin0/CVE-2024-23897/pkg/credential"
+)
+
+// gitlabProject is the project of the recorded gitlab fixtures
+const gitlabProject = "acme/security/mytool"
+
+// fakeGitLab serves the recorded releases of gitlabProject with the Releases API
+type fakeGitLab struct {
+	*httptest.Server
+	mutex sync.Mutex
+	// Token is required as PRIVATE-TOKEN by every request when set, like a private project
+	Token string
+	// Assets are the asset links downloads by name
+	Assets map[string][]byte
+	// Source is the zip archive of the source
+	Source []byte
+	// headers are the PRIVATE-TOKEN headers received per path
+	headers map[string]string
+}
+
+// newFakeGitLab starts a fake gitlab instance and points the updater at it until the test ends
+func newFakeGitLab(t *testing.T) *fakeGitLab {
+	f := &fakeGitLab{Assets: make(map[string][]byte), headers: make(map[string]string)}
+	f.Server = httptest.NewServer(f)
+	gitlabURL, allowlist, cacheDir, backoff := GitLabURL, UpdateSourceAllowlist, AssetCacheDir, RetryBackoff
+	GitLabURL = f.URL
+	UpdateSourceAllowlist = []string{DefaultUpdateSource(), trustedSource("gitlab://" + gitlabProject)}
+	RetryBackoff = time.Millisecond
+	AssetCacheDir = t.TempDir()
+	t.Cleanup(func() {
+		GitLabURL, UpdateSourceAllowlist, AssetCacheDir, RetryBackoff = gitlabURL, allowlist, cacheDir, backoff
+		f.Close()
+	})
+	return f
+}
+
+// fixture returns the recorded api response of the release tag with the urls of gitlab.com pointing at the fake
+func (f *fakeGitLab) fixture(tag string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join("testdata", "gitlab", "release_"+tag+".json"))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.ReplaceAll(data, []byte("https://gitlab.com"), []byte(f.URL)), nil
+}
+
+func (f *fakeGitLab) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.headers[req.URL.Path] = req.Header.Get("PRIVATE-TOKEN")
+	if f.Token != "" && req.Header.Get("PRIVATE-TOKEN") != f.Token {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"message":"401 Unauthorized"}`))
+		return
+	}
+	api := "/api/v4/projects/" + strings.ReplaceAll(gitlabProject, "/", "%2F") + "/releases/"
+	path := req.URL.EscapedPath()
+	switch {
+	// /api/v4/projects/{project}/releases/permalink/latest, /api/v4/projects/{project}/releases/{tag}
+	case strings.HasPrefix(path, api):
+		tag := strings.TrimPrefix(path, api)
+		if tag == "permalink/latest" {
+			tag = "latest"
+		}
+		data, err := f.fixture(tag)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"404 Not Found"}`))
+			return
+		}
+		_, _ = w.Write(data)
+	case strings.HasPrefix(path, "/"+gitlabProject+"/-/releases/"):
+		// /{project}/-/releases/{tag}/downloads/{name}, the direct asset urls
+		data, ok := f.Assets[filepath.Base(path)]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(data)
+	case strings.HasPrefix(path, "/"+gitlabProject+"/-/archive/") && strings.HasSuffix(path, ".zip") && f.Source != nil:
+		_, _ = w.Write(f.Source)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// header returns the PRIVATE-TOKEN header received by path
+func (f *fakeGitLab) header(path string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.headers[path]
+}
+
+// setGitLabToken sets the gitlab token of the updater until the test ends
+func setGitLabToken(t *testing.T, token string) {
+	SetGitLabToken(token)
+	t.Cleanup(func() {
+		credential.Default.Select(credential.GitLabToken, &credential.Env{Variable: "GITLAB_TOKEN"})
+	})
+}
+
+func TestGitLabAssetNames(t *testing.T) {
+	fake := newFakeGitLab(t)
+	lab, err := NewghReleaseDownloader("gitlab://" + gitlabProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lab.SetAssetBaseName("mytool")
+	data, err := os.ReadFile(filepath.Join("testdata", "github", "release_latest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := &GHReleaseDownloader{assetName: "mytool", Latest: &github.RepositoryRelease{}}
+	if err := json.Unmarshal(data, hub.Latest); err != nil {
+		t.Fatal(err)
+	}
+
+	// goreleaser 的资源名在两个来源上解析结果一致
+	labErr, hubErr := lab.getToolAssetID(lab.Latest), hub.getToolAssetID(hub.Latest)
+	if (labErr == nil) != (hubErr == nil) {
+		t.Fatalf("getToolAssetID() = %v on gitlab and %v on github", labErr, hubErr)
+	}
+	if labErr != nil {
+		t.Skipf("the fixtures have no asset for this platform: %v", labErr)
+	}
+	if lab.fullAssetName != hub.fullAssetName || lab.Format != hub.Format {
+		t.Errorf("gitlab resolved %v (%v), github %v (%v)", lab.fullAssetName, lab.Format, hub.fullAssetName, hub.Format)
+	}
+	if lab.Latest.GetTagName() != hub.Latest.GetTagName() || lab.Latest.GetBody() != hub.Latest.GetBody() {
+		t.Errorf("gitlab release %v %q, github %v %q", lab.Latest.GetTagName(), lab.Latest.GetBody(), hub.Latest.GetTagName(), hub.Latest.GetBody())
+	}
+	if want := fake.URL + "/" + gitlabProject + "/-/archive/v1.2.0/mytool-v1.2.0.zip"; lab.Latest.GetZipballURL() != want {
+		t.Errorf("gitlab zipball = %v, want %v", lab.Latest.GetZipballURL(), want)
+	}
+	for _, asset := range lab.Latest.Assets {
+		if !hub.HasAsset(asset.GetName()) || asset.GetID() == 0 {
+			t.Errorf("gitlab asset %v (%d) is not a github asset", asset.GetName(), asset.GetID())
+		}
+	}
+}
+
+func TestGitLabRelease(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitLab(t)
+	fake.Token = "glpat-private0123456789"
+	setGitLabToken(t, fake.Token)
+
+	// 当前平台的资源替换为真实的压缩包
+	bin := []byte("gitlab binary")
+	name := platformAssetName("mytool", "v1.2.0", Tar)
+	asset := tarGz(t, map[string][]byte{"mytool": bin})
+	sum := sha256.Sum256(asset)
+	fake.Assets[name] = asset
+	fake.Assets["mytool_1.2.0_checksums.txt"] = []byte(fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name))
+	fake.Source = zipArchive(t, map[string][]byte{"mytool-v1.2.0/README.md": []byte("source")})
+
+	d, err := NewghReleaseDownloader("gitlab://" + gitlabProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetAssetBaseName("mytool")
+	d.cache = nil
+	if !d.HasAsset(name) {
+		t.Skipf("the fixtures have no %v asset", name)
+	}
+	if d.Source() != "gitlab://"+gitlabProject || !strings.HasSuffix(d.SourceURL(), "/"+gitlabProject) {
+		t.Errorf("Source() = %v, SourceURL() = %v", d.Source(), d.SourceURL())
+	}
+	got, err := d.GetExecutableFromAsset()
+	if err != nil || !bytes.Equal(got, bin) {
+		t.Fatalf("GetExecutableFromAsset() = %q, %v, want the binary", got, err)
+	}
+	if _, err := d.DownloadSource(false); err != nil {
+		t.Errorf("DownloadSource() = %v", err)
+	}
+	// 资源通过 direct_asset_url 下载, 令牌随请求发送给实例
+	if header := fake.header("/" + gitlabProject + "/-/releases/v1.2.0/downloads/" + name); header != fake.Token {
+		t.Errorf("asset download got PRIVATE-TOKEN %q", header)
+	}
+	older, err := d.ReleaseByTag("v1.1.0")
+	if err != nil || older.GetTagName() != "v1.1.0" || len(older.Assets) == 0 {
+		t.Errorf("ReleaseByTag() = %v, %v", older, err)
+	}
+	if _, err := d.ReleaseByTag("v0.9.0"); err == nil {
+		t.Error("ReleaseByTag() of a missing tag succeeded")
+	}
+
+	setGitLabToken(t, "glpat-revoked0123456789")
+	if _, err := NewghReleaseDownloader("gitlab://" + gitlabProject); !errors.Is(err, ErrCredentialRejected) || !strings.Contains(err.Error(), credential.GitLabToken) {
+		t.Errorf("NewghReleaseDownloader() with an invalid token = %v, want %v", err, ErrCredentialRejected)
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		spec    string
+		def     string
+		forge   string
+		source  string
+		wantErr bool
+	}{
+		{spec: "mytool", forge: SourceGitHub, source: Organization + "/mytool"},
+		{spec: "acme/mytool", forge: SourceGitHub, source: "acme/mytool"},
+		{spec: "github://acme/mytool", forge: SourceGitHub, source: "acme/mytool"},
+		{spec: "gitlab://acme/mytool", forge: SourceGitLab, source: "gitlab://acme/mytool"},
+		{spec: "gitlab://acme/security/mytool", forge: SourceGitLab, source: "gitlab://acme/security/mytool"},
+		{spec: "acme/security/mytool", def: SourceGitLab, forge: SourceGitLab, source: "gitlab://acme/security/mytool"},
+		{spec: "mytool", def: SourceGitLab, forge: SourceGitLab, source: "gitlab://" + Organization + "/mytool"},
+		{spec: "github://acme/mytool", def: SourceGitLab, forge: SourceGitHub, source: "acme/mytool"},
+		{spec: "acme/security/mytool", wantErr: true},
+		{spec: "gitlab://acme/../mytool", wantErr: true},
+		{spec: "gitlab:///mytool", wantErr: true},
+		{spec: "bitbucket://acme/mytool", wantErr: true},
+	}
+	defer func() { DefaultSource = SourceGitHub }()
+	for _, test := range tests {
+		DefaultSource = SourceGitHub
+		if test.def != "" {
+			DefaultSource = test.def
+		}
+		forge, org, repo, err := parseSource(test.spec)
+		if test.wantErr != (err != nil) {
+			t.Errorf("parseSource(%q) = %v, want error %v", test.spec, err, test.wantErr)
+			continue
+		}
+		if err == nil && (forge != test.forge || sourceName(forge, org, repo) != test.source) {
+			t.Errorf("parseSource(%q) = %v %v, want %v %v", test.spec, forge, sourceName(forge, org, repo), test.forge, test.source)
+		}
+	}
+}
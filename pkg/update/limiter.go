@@ -0,0 +1,72 @@
+package updateutils
+
+import (
+	"context"
+	"github.com/projectdiscovery/ratelimit"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultAuthenticatedAPIRequestsPerMinute is the github api limit used when the github-token credential is set
+	DefaultAuthenticatedAPIRequestsPerMinute = 60
+	// DefaultAnonymousAPIRequestsPerMinute is the github api limit used without the github-token credential
+	DefaultAnonymousAPIRequestsPerMinute = 10
+)
+
+// apiLimiter is a token bucket shared by all github api calls of an Updater
+type apiLimiter struct {
+	limiter   *ratelimit.Limiter
+	requests  atomic.Int64
+	throttled atomic.Int64
+}
+
+// newAPILimiter returns a limiter refilling one token every minute/perMinute
+func newAPILimiter(ctx context.Context, perMinute int) *apiLimiter {
+	if perMinute <= 0 {
+		return &apiLimiter{limiter: ratelimit.NewUnlimited(ctx)}
+	}
+	return &apiLimiter{limiter: ratelimit.New(ctx, 1, time.Minute/time.Duration(perMinute))}
+}
+
+// Take waits for a token and records the time spent waiting
+func (l *apiLimiter) Take() {
+	start := time.Now()
+	l.limiter.Take()
+	l.requests.Add(1)
+	l.throttled.Add(int64(time.Since(start)))
+}
+
+// Requests returns the number of github api requests made
+func (l *apiLimiter) Requests() int64 {
+	return l.requests.Load()
+}
+
+// Throttled returns the total time github api requests waited on the limiter
+func (l *apiLimiter) Throttled() time.Duration {
+	return time.Duration(l.throttled.Load())
+}
+
+// Stop releases the limiter
+func (l *apiLimiter) Stop() {
+	l.limiter.Stop()
+}
+
+// Transport returns a RoundTripper waiting on the limiter before every request
+func (l *apiLimiter) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &limitedTransport{base: base, limiter: l}
+}
+
+type limitedTransport struct {
+	base    http.RoundTripper
+	limiter *apiLimiter
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.limiter.Take()
+	return t.base.RoundTrip(req)
+}
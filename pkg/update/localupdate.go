@@ -0,0 +1,179 @@
+package updateutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/minio/selfupdate"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// ApplyUpdateFromFile replaces the executable of toolName with the one in the release asset at archivePath,
+// e.g. copied to an air-gapped host. The archive is unpacked and checked like a downloaded asset, without
+// checksum validation. The version is not compared since local archives may lack it, see
+// ApplyUpdateFromFileWithVersion
+func ApplyUpdateFromFile(toolName, archivePath string) error {
+	return ApplyUpdateFromFileWithVersion(toolName, "", archivePath)
+}
+
+// ApplyUpdateFromFileWithVersion is ApplyUpdateFromFile refusing with ErrAlreadyLatest an archive whose
+// TemplateVersionFile is not newer than currentVersion, unless ForceUpdate. Archives without it are applied
+func ApplyUpdateFromFileWithVersion(toolName, currentVersion, archivePath string) error {
+	if !DryRun {
+		sweepOldBinaries()
+	}
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("failed to read %v", archivePath)
+	}
+	executableName := executableFileName(toolName, runtime.GOOS)
+	var entries []archiveEntry
+	var version *TemplateVersion
+	err = unpackAsset(context.Background(), executableName, data, func(entryPath string, fileInfo fs.FileInfo, data io.Reader) error {
+		if !fileInfo.Mode().IsRegular() {
+			return nil
+		}
+		bin, err := io.ReadAll(data)
+		if err != nil {
+			return err
+		}
+		if path.Base(entryPath) == TemplateVersionFile {
+			version, err = ParseTemplateVersion(bin)
+			return err
+		}
+		entries = append(entries, archiveEntry{path: entryPath, data: bin})
+		return nil
+	})
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("failed to unpack %v", archivePath)
+	}
+	archiveVersion := "unknown version"
+	if version != nil && version.Tag != "" {
+		archiveVersion = version.Tag
+		if err := checkArchiveVersion(toolName, currentVersion, version.Tag); err != nil {
+			return err
+		}
+	}
+	entry, err := selectExecutable(entries, executableName)
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("executable %v not found in %v", toolName, archivePath)
+	}
+	if err := checkPlatform(entry.path, entry.data, runtime.GOOS, runtime.GOARCH); err != nil {
+		return err
+	}
+
+	updateOpts := selfupdate.Options{}
+	if executable, err := executablePath(); err == nil {
+		if err := CheckInstallDir(filepath.Dir(executable)); err != nil {
+			return newUpdateError(ErrPermission, "update of %v from %v failed: %v", toolName, archivePath, err)
+		}
+		updateOpts.TargetPath = executable
+	}
+	if err := updateOpts.CheckPermissions(); err != nil {
+		return newUpdateError(ErrPermission, "update of %v from %v failed , insufficient permission detected got: %v", toolName, archivePath, err)
+	}
+	if DryRun {
+		summary := fmt.Sprintf("would update %v to %v (%v, %v) from %v", toolName, archiveVersion, entry.path, formatBytes(int64(len(entry.data))), archivePath)
+		updateLog.Info().Label("dry-run").Msg(summary)
+		return newUpdateError(ErrUpdateAvailable, "%v", summary)
+	}
+	err, rollbackErr := applyUpdate(entry.data, updateOpts)
+	getMetrics().IncCounter(MetricApplies, map[string]string{"tool": toolName, "result": resultLabel(err)})
+	if err != nil {
+		getMetrics().IncCounter(MetricRollbacks, map[string]string{"tool": toolName, "result": resultLabel(rollbackErr)})
+		if rollbackErr != nil {
+			return newUpdateError(ErrRollbackFailed, "update of %v from %v failed: %v, rollback failed got %v,pls reinstall %v", toolName, archivePath, err, rollbackErr, toolName)
+		}
+		return newUpdateError(ErrApplyFailed, "update of %v from %v failed, rolled back update: %v", toolName, archivePath, err)
+	}
+	updateLog.Info().Msgf("%v sucessfully updated to %v from %v", toolName, archiveVersion, archivePath)
+	return nil
+}
+
+// checkArchiveVersion returns ErrAlreadyLatest when the archive version is not newer than current, versions
+// which can't be parsed are not compared
+func checkArchiveVersion(toolName, current, archive string) error {
+	if current == "" || ForceUpdate {
+		return nil
+	}
+	currentVersion, err := semver.NewVersion(current)
+	if err != nil {
+		return nil
+	}
+	archiveVersion, err := semver.NewVersion(archive)
+	if err != nil {
+		return nil
+	}
+	if !archiveVersion.GreaterThan(currentVersion) {
+		return newUpdateError(ErrAlreadyLatest, "%v %v is not older than the archive version %v, force the update to install it anyway", toolName, currentVersion.String(), archiveVersion.String())
+	}
+	return nil
+}
+
+// UpdateDirFromZip updates dir from the zip at zipPath laid out like a release zipball, the files under its
+// root directory are written through the same pipeline as UpdateDirFromRepo. When both the zip and dir have
+// a TemplateVersionFile, an older zip is refused with ErrAlreadyLatest unless ForceUpdate
+func UpdateDirFromZip(dir, zipPath string) error {
+	data, err := os.ReadFile(zipPath)
+	if err != nil {
+		return errorutil.NewWithErr(err).Msgf("failed to read %v", zipPath)
+	}
+	ctx := context.Background()
+	incoming := map[string]*incomingFile{}
+	if err := unpackSource(ctx, filepath.Base(zipPath), data, !HideProgressBar, ExtractWorkers, collectIncoming(incoming)); err != nil {
+		return errorutil.NewWithErr(err).Msgf("failed to unpack %v got %v", zipPath, err)
+	}
+	archiveVersion := "unknown version"
+	if file, ok := incoming[TemplateVersionFile]; ok {
+		version, err := ParseTemplateVersion(file.data)
+		if err != nil {
+			return err
+		}
+		archiveVersion = version.Tag
+		local, err := ReadTemplateVersion(dir)
+		if err != nil {
+			return err
+		}
+		if local != nil && !ForceUpdate {
+			if err := checkDirVersion(dir, local.Tag, version.Tag); err != nil {
+				return err
+			}
+		}
+	}
+	changes, err := diffDir(dir, incoming)
+	if err != nil {
+		return err
+	}
+	if DryRun {
+		return dryRunDirUpdate(filepath.Base(zipPath), dir, changes)
+	}
+	written, err := writeDirChanges(ctx, dir, incoming, changes, ForceUpdate, nil)
+	if err != nil {
+		return err
+	}
+	updateLog.Info().Label("updater").Msgf("installed %v from %v in %v (%d files written, %d unchanged)", archiveVersion, zipPath, dir, written, len(changes.Unchanged))
+	return nil
+}
+
+// checkDirVersion returns ErrAlreadyLatest when the zip version is older than the one installed in dir
+func checkDirVersion(dir, local, archive string) error {
+	localVersion, err := semver.NewVersion(local)
+	if err != nil {
+		return nil
+	}
+	archiveVersion, err := semver.NewVersion(archive)
+	if err != nil {
+		return nil
+	}
+	if archiveVersion.LessThan(localVersion) {
+		return newUpdateError(ErrAlreadyLatest, "%v holds %v, newer than the zip version %v, force the update to install it anyway", dir, local, archive)
+	}
+	return nil
+}
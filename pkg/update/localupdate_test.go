@@ -0,0 +1,164 @@
+package updateutils
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// elfHeader returns a 64-bit little endian ELF executable header for machine
+func elfHeader(t *testing.T, machine elf.Machine) []byte {
+	var buf bytes.Buffer
+	header := elf.Header64{
+		Ident:   [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)},
+		Type:    uint16(elf.ET_EXEC),
+		Machine: uint16(machine),
+		Version: uint32(elf.EV_CURRENT),
+		Ehsize:  64,
+	}
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// peHeader returns a PE executable header for machine without sections
+func peHeader(t *testing.T, machine uint16) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0x80))
+	copy(buf.Bytes(), "MZ")
+	binary.LittleEndian.PutUint32(buf.Bytes()[0x3c:], 0x80)
+	buf.WriteString("PE\x00\x00")
+	if err := binary.Write(buf, binary.LittleEndian, pe.FileHeader{Machine: machine}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// machoHeader returns a 64-bit Mach-O executable header for cpu without load commands
+func machoHeader(t *testing.T, cpu macho.Cpu) []byte {
+	var buf bytes.Buffer
+	header := macho.FileHeader{Magic: macho.Magic64, Cpu: cpu, Type: macho.TypeExec}
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		t.Fatal(err)
+	}
+	// 64 位头部的保留字段
+	buf.Write(make([]byte, 4))
+	return buf.Bytes()
+}
+
+// foreignBinary returns an executable which can't run on the host
+func foreignBinary(t *testing.T) []byte {
+	if runtime.GOOS == "windows" {
+		return elfHeader(t, elf.EM_X86_64)
+	}
+	return peHeader(t, pe.IMAGE_FILE_MACHINE_AMD64)
+}
+
+func TestCheckPlatform(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		goos    string
+		goarch  string
+		err     error
+		wantErr bool
+	}{
+		{name: "linux amd64", data: elfHeader(t, elf.EM_X86_64), goos: "linux", goarch: "amd64"},
+		{name: "freebsd arm64", data: elfHeader(t, elf.EM_AARCH64), goos: "freebsd", goarch: "arm64"},
+		{name: "linux wrong arch", data: elfHeader(t, elf.EM_AARCH64), goos: "linux", goarch: "amd64", err: ErrWrongPlatform},
+		{name: "windows", data: peHeader(t, pe.IMAGE_FILE_MACHINE_AMD64), goos: "windows", goarch: "amd64"},
+		{name: "windows binary on linux", data: peHeader(t, pe.IMAGE_FILE_MACHINE_AMD64), goos: "linux", goarch: "amd64", err: ErrWrongPlatform},
+		{name: "linux binary on windows", data: elfHeader(t, elf.EM_X86_64), goos: "windows", goarch: "amd64", err: ErrWrongPlatform},
+		{name: "darwin arm64", data: machoHeader(t, macho.CpuArm64), goos: "darwin", goarch: "arm64"},
+		{name: "darwin wrong arch", data: machoHeader(t, macho.CpuAmd64), goos: "darwin", goarch: "arm64", err: ErrWrongPlatform},
+		// 不是可执行文件时不检查
+		{name: "script", data: []byte("#!/bin/sh\n"), goos: "linux", goarch: "amd64"},
+		{name: "truncated", data: elfBinary(4), goos: "linux", goarch: "amd64", wantErr: true},
+	}
+	for _, test := range tests {
+		err := checkPlatform("tool", test.data, test.goos, test.goarch)
+		if (err != nil) != (test.wantErr || test.err != nil) || (test.err != nil && !errors.Is(err, test.err)) {
+			t.Errorf("checkPlatform() of %v = %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestApplyUpdateFromFile(t *testing.T) {
+	name := executableFileName("chaos", runtime.GOOS)
+	tests := []struct {
+		name       string
+		version    string
+		archive    func(t *testing.T) []byte
+		err        error
+		wantBinary string
+	}{
+		{name: "without version", archive: func(t *testing.T) []byte {
+			return tarGz(t, map[string][]byte{"chaos_1.1.0/" + name: []byte("bin-v1.1.0")})
+		}, version: "1.1.0", wantBinary: "bin-v1.1.0"},
+		{name: "newer version", archive: func(t *testing.T) []byte {
+			return zipArchive(t, map[string][]byte{name: []byte("bin-v1.1.0"), ".version": []byte("v1.1.0")})
+		}, version: "1.0.0", wantBinary: "bin-v1.1.0"},
+		{name: "same version", archive: func(t *testing.T) []byte {
+			return zipArchive(t, map[string][]byte{name: []byte("bin-v1.1.0"), ".version": []byte("v1.1.0")})
+		}, version: "1.1.0", err: ErrAlreadyLatest, wantBinary: "old"},
+		{name: "wrong platform", archive: func(t *testing.T) []byte {
+			return zipArchive(t, map[string][]byte{name: foreignBinary(t)})
+		}, err: ErrWrongPlatform, wantBinary: "old"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archivePath := filepath.Join(dir, "chaos.archive")
+			if err := os.WriteFile(archivePath, test.archive(t), 0644); err != nil {
+				t.Fatal(err)
+			}
+			target := fakeExecutable(t, name)
+
+			err := ApplyUpdateFromFileWithVersion("chaos", test.version, archivePath)
+			if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("ApplyUpdateFromFileWithVersion() = %v, want %v", err, test.err)
+			}
+			if data, _ := os.ReadFile(target); string(data) != test.wantBinary {
+				t.Errorf("executable = %q, want %q", data, test.wantBinary)
+			}
+		})
+	}
+}
+
+func TestUpdateDirFromZip(t *testing.T) {
+	hideProgressBar(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{".version": "v1.0.1", "cves/change.yaml": "v1.0.1", "local.yaml": "local"})
+	zipPath := filepath.Join(t.TempDir(), "templates.zip")
+	writeZip := func(version string) {
+		data := zipArchive(t, map[string][]byte{
+			"templates/.version":         []byte(version),
+			"templates/cves/change.yaml": []byte(version),
+			"templates/cves/new.yaml":    []byte("new"),
+		})
+		if err := os.WriteFile(zipPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeZip("v1.0.0")
+	if err := UpdateDirFromZip(dir, zipPath); !errors.Is(err, ErrAlreadyLatest) {
+		t.Fatalf("UpdateDirFromZip() of an older zip = %v, want %v", err, ErrAlreadyLatest)
+	}
+	writeZip("v1.0.2")
+	if err := UpdateDirFromZip(dir, zipPath); err != nil {
+		t.Fatalf("UpdateDirFromZip() = %v", err)
+	}
+	for name, want := range map[string]string{".version": "v1.0.2", "cves/change.yaml": "v1.0.2", "cves/new.yaml": "new", "local.yaml": "local"} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != want {
+			t.Errorf("%v = %q, %v, want %q", name, data, err, want)
+		}
+	}
+}
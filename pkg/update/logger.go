@@ -0,0 +1,115 @@
+package updateutils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/projectdiscovery/gologger"
+)
+
+// UpdateLogger receives the messages of the updater, see SetLogger. Fatalf of the default logger exits like
+// gologger, a custom logger may panic or return: the callbacks exiting after an update then return
+type UpdateLogger interface {
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+	Fatalf(format string, args ...any)
+}
+
+// VerboseLogger is implemented by the custom loggers also receiving the verbose and debug messages, the
+// other custom loggers don't get them
+type VerboseLogger interface {
+	Verbosef(format string, args ...any)
+}
+
+var (
+	loggerMutex  sync.RWMutex
+	updateLogger UpdateLogger = gologgerLogger{}
+)
+
+// SetLogger routes the messages of the updater to l instead of gologger, nil restores gologger. The
+// messages of a custom logger have no labels, Print messages such as the release notes are Infof
+func SetLogger(l UpdateLogger) {
+	if l == nil {
+		l = gologgerLogger{}
+	}
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	updateLogger = l
+}
+
+// currentLogger returns the logger set by SetLogger
+func currentLogger() UpdateLogger {
+	loggerMutex.RLock()
+	defer loggerMutex.RUnlock()
+	return updateLogger
+}
+
+// gologgerLogger is the default logger writing with gologger
+type gologgerLogger struct{}
+
+func (gologgerLogger) Infof(format string, args ...any)  { gologger.Info().Msgf(format, args...) }
+func (gologgerLogger) Warnf(format string, args ...any)  { gologger.Warning().Msgf(format, args...) }
+func (gologgerLogger) Errorf(format string, args ...any) { gologger.Error().Msgf(format, args...) }
+func (gologgerLogger) Fatalf(format string, args ...any) { gologger.Fatal().Msgf(format, args...) }
+
+// logEvent is a message of the updater, written with its gologger level and label by the default logger
+type logEvent struct {
+	event func() *gologger.Event
+	// send is the method of a custom logger receiving it, nil drops it
+	send  func(l UpdateLogger) func(format string, args ...any)
+	label string
+}
+
+// updateLog builds the messages of the updater like gologger, e.g. updateLog.Info().Label("updater").Msgf
+var updateLog logEvents
+
+type logEvents struct{}
+
+func infof(l UpdateLogger) func(string, ...any)  { return l.Infof }
+func warnf(l UpdateLogger) func(string, ...any)  { return l.Warnf }
+func errorf(l UpdateLogger) func(string, ...any) { return l.Errorf }
+func fatalf(l UpdateLogger) func(string, ...any) { return l.Fatalf }
+
+// verbosef returns Verbosef of l, nil when it doesn't receive the verbose messages
+func verbosef(l UpdateLogger) func(string, ...any) {
+	if verbose, ok := l.(VerboseLogger); ok {
+		return verbose.Verbosef
+	}
+	return nil
+}
+
+func (logEvents) Info() logEvent    { return logEvent{event: gologger.Info, send: infof} }
+func (logEvents) Warning() logEvent { return logEvent{event: gologger.Warning, send: warnf} }
+func (logEvents) Error() logEvent   { return logEvent{event: gologger.Error, send: errorf} }
+func (logEvents) Fatal() logEvent   { return logEvent{event: gologger.Fatal, send: fatalf} }
+func (logEvents) Verbose() logEvent { return logEvent{event: gologger.Verbose, send: verbosef} }
+func (logEvents) Debug() logEvent   { return logEvent{event: gologger.Debug, send: verbosef} }
+func (logEvents) Print() logEvent   { return logEvent{event: gologger.Print, send: infof} }
+
+// Label sets the label of the message, ignored by the custom loggers
+func (e logEvent) Label(label string) logEvent {
+	e.label = label
+	return e
+}
+
+func (e logEvent) Msg(message string) {
+	e.Msgf("%s", message)
+}
+
+func (e logEvent) Msgf(format string, args ...any) {
+	l := currentLogger()
+	if _, ok := l.(gologgerLogger); !ok {
+		// 空行只用于分隔终端输出
+		if send := e.send(l); send != nil && strings.TrimSpace(fmt.Sprintf(format, args...)) != "" {
+			send(format, args...)
+		}
+		return
+	}
+	event := e.event()
+	if e.label != "" {
+		event = event.Label(e.label)
+	}
+	event.Msg(fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,111 @@
+package updateutils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// captureLogger records the messages of the updater as level: message
+type captureLogger struct {
+	mutex    sync.Mutex
+	messages []string
+	verbose  bool
+}
+
+func (l *captureLogger) record(level, format string, args ...any) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.messages = append(l.messages, level+": "+fmt.Sprintf(format, args...))
+}
+
+func (l *captureLogger) Infof(format string, args ...any)  { l.record("info", format, args...) }
+func (l *captureLogger) Warnf(format string, args ...any)  { l.record("warn", format, args...) }
+func (l *captureLogger) Errorf(format string, args ...any) { l.record("error", format, args...) }
+func (l *captureLogger) Fatalf(format string, args ...any) { l.record("fatal", format, args...) }
+
+// verboseCaptureLogger also records the verbose messages
+type verboseCaptureLogger struct{ captureLogger }
+
+func (l *verboseCaptureLogger) Verbosef(format string, args ...any) {
+	l.record("verbose", format, args...)
+}
+
+func TestSetLogger(t *testing.T) {
+	hideProgressBar(t)
+	hideReleaseNotes := HideReleaseNotes
+	HideReleaseNotes = true
+	defer func() { HideReleaseNotes = hideReleaseNotes }()
+	defer SetLogger(nil)
+	asset := platformAssetName("chaos", "v1.1.0", Tar)
+	tests := []struct {
+		name    string
+		version string
+		steps   string
+		err     error
+		want    []string
+	}{
+		{name: "updated", version: "1.0.0", want: []string{
+			"info: update source: {source}",
+			"info: Verified Integrity of " + asset,
+			"info: chaos sucessfully updated 1.0.0 -> 1.1.0 (latest) from {source}",
+		}},
+		{name: "already updated", version: "1.1.0", err: ErrAlreadyLatest, want: []string{
+			"info: update source: {source}",
+		}},
+		{name: "rollback", version: "1.0.0", steps: FailpointApply, err: ErrApplyFailed, want: []string{
+			"info: update source: {source}",
+			"info: Verified Integrity of " + asset,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeGitHub(t)
+			fake.AddRelease(Organization+"/chaos", newToolRelease(t, "chaos", "v1.1.0", []byte("bin-chaos")))
+			enableFailpoints(t, test.steps)
+			fakeExecutable(t, "chaos")
+
+			logger := &captureLogger{}
+			SetLogger(logger)
+			err := GetUpdateToolCallbackWithError("chaos", test.version)()
+			SetLogger(nil)
+			if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("update = %v, want %v", err, test.err)
+			}
+			source := strings.TrimPrefix(fake.URL, "http://") + "/" + Organization + "/chaos"
+			want := strings.ReplaceAll(strings.Join(test.want, "\n"), "{source}", source)
+			if got := strings.Join(logger.messages, "\n"); got != want {
+				t.Errorf("messages =\n%v\nwant\n%v", got, want)
+			}
+		})
+	}
+}
+
+func TestSetLoggerFatal(t *testing.T) {
+	defer SetLogger(nil)
+	logger := &captureLogger{}
+	SetLogger(logger)
+	// 自定义日志的 Fatalf 返回时回调不退出进程
+	exitAfterUpdate("chaos", func() error { return errors.New("boom") })()
+	if got := strings.Join(logger.messages, "\n"); got != "fatal: boom" {
+		t.Errorf("messages = %q, want the fatal message", got)
+	}
+
+	verbose := &verboseCaptureLogger{}
+	SetLogger(verbose)
+	updateLog.Verbose().Label("updater").Msgf("detail %d", 1)
+	updateLog.Debug().Msg("debug")
+	updateLog.Print().Msg("")
+	updateLog.Warning().Label("updater").Msgf("careful")
+	SetLogger(logger)
+	updateLog.Verbose().Msg("dropped")
+	want := []string{"verbose: detail 1", "verbose: debug", "warn: careful"}
+	if got := strings.Join(verbose.messages, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("verbose messages = %q, want %q", got, want)
+	}
+	if len(logger.messages) != 1 {
+		t.Errorf("verbose message sent to a logger without Verbosef: %q", logger.messages)
+	}
+}
@@ -0,0 +1,64 @@
+package updateutils
+
+import "sync"
+
+// metric names emitted by the updater
+const (
+	// MetricChecks counts latest release lookups, labels: repo, result (success|failure)
+	MetricChecks = "updater_checks_total"
+	// MetricUpdateAvailable is 1 when a newer release was found and 0 otherwise, labels: tool
+	MetricUpdateAvailable = "updater_update_available"
+	// MetricOutdated counts outdated tools found, labels: tool
+	MetricOutdated = "updater_outdated_total"
+	// MetricDownloadBytes observes the size of downloaded assets, labels: asset
+	MetricDownloadBytes = "updater_download_bytes"
+	// MetricDownloadDuration observes the duration in seconds of asset downloads, labels: asset
+	MetricDownloadDuration = "updater_download_duration_seconds"
+	// MetricApplies counts applied updates, labels: tool, result (success|failure)
+	MetricApplies = "updater_applies_total"
+	// MetricRollbacks counts rollbacks of failed self-updates, labels: tool, result (success|failure)
+	MetricRollbacks = "updater_rollbacks_total"
+)
+
+// Metrics receives the updater metrics, e.g. to forward them to a prometheus registry
+type Metrics interface {
+	IncCounter(name string, labels map[string]string)
+	SetGauge(name string, value float64, labels map[string]string)
+	Observe(name string, value float64, labels map[string]string)
+}
+
+// NoopMetrics discards every metric
+type NoopMetrics struct{}
+
+func (NoopMetrics) IncCounter(name string, labels map[string]string)              {}
+func (NoopMetrics) SetGauge(name string, value float64, labels map[string]string) {}
+func (NoopMetrics) Observe(name string, value float64, labels map[string]string)  {}
+
+var (
+	metricsMutex sync.RWMutex
+	metrics      Metrics = NoopMetrics{}
+)
+
+// SetMetrics sets the metrics receiver, nil restores the no-op default
+func SetMetrics(m Metrics) {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+	if m == nil {
+		m = NoopMetrics{}
+	}
+	metrics = m
+}
+
+// getMetrics returns the current metrics receiver
+func getMetrics() Metrics {
+	metricsMutex.RLock()
+	defer metricsMutex.RUnlock()
+	return metrics
+}
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
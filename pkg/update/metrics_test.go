@@ -0,0 +1,115 @@
+package updateutils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingMetrics records every metric event as "kind name labels"
+type recordingMetrics struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (m *recordingMetrics) record(kind, name string, labels map[string]string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var pairs []string
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	m.events = append(m.events, fmt.Sprintf("%s %s %s", kind, name, strings.Join(pairs, ",")))
+}
+
+func (m *recordingMetrics) IncCounter(name string, labels map[string]string) {
+	m.record("counter", name, labels)
+}
+
+func (m *recordingMetrics) SetGauge(name string, value float64, labels map[string]string) {
+	m.record(fmt.Sprintf("gauge=%v", value), name, labels)
+}
+
+func (m *recordingMetrics) Observe(name string, value float64, labels map[string]string) {
+	m.record("observe", name, labels)
+}
+
+func (m *recordingMetrics) has(event string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, e := range m.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func TestUpdaterMetrics(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/fresh", newToolRelease(t, "fresh", "v1.0.0", []byte("fresh")))
+	fake.AddRelease(Organization+"/stale", newToolRelease(t, "stale", "v2.0.0", []byte("stale")))
+	fake.AddRelease(Organization+"/readonly", newToolRelease(t, "readonly", "v2.0.0", []byte("readonly")))
+	// 允许但不存在的仓库, 版本检查失败
+	UpdateSourceAllowlist = append(UpdateSourceAllowlist, trustedSource(Organization+"/missing"))
+
+	m := &recordingMetrics{}
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	dir := t.TempDir()
+	// 安装路径为目录, 写入必然失败
+	if err := os.Mkdir(filepath.Join(dir, "readonly"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	updater := &Updater{APIRequestsPerMinute: -1}
+	defer updater.Close()
+	updater.UpdateTools(context.Background(), []Tool{
+		{Name: "fresh", Version: "1.0.0"},
+		{Name: "stale", Version: "1.0.0"},
+		{Name: "readonly", Version: "1.0.0"},
+		{Name: "missing", Version: "1.0.0"},
+	}, dir)
+
+	for _, event := range []string{
+		"counter " + MetricChecks + " repo=" + Organization + "/fresh,result=success",
+		"counter " + MetricChecks + " repo=" + Organization + "/missing,result=failure",
+		"gauge=0 " + MetricUpdateAvailable + " tool=fresh",
+		"gauge=1 " + MetricUpdateAvailable + " tool=stale",
+		"counter " + MetricOutdated + " tool=stale",
+		"observe " + MetricDownloadBytes + " asset=" + platformAssetName("stale", "v2.0.0", Tar),
+		"observe " + MetricDownloadDuration + " asset=" + platformAssetName("stale", "v2.0.0", Tar),
+		"observe " + MetricDownloadBytes + " asset=stale_2.0.0_checksums.txt",
+		"counter " + MetricApplies + " result=success,tool=stale",
+		"counter " + MetricApplies + " result=failure,tool=readonly",
+	} {
+		if !m.has(event) {
+			t.Errorf("missing metric event %q", event)
+		}
+	}
+	if m.has("counter " + MetricOutdated + " tool=fresh") {
+		t.Error("up to date tool counted as outdated")
+	}
+}
+
+func TestSourceDownloadMetrics(t *testing.T) {
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	m := &recordingMetrics{}
+	SetMetrics(m)
+	defer SetMetrics(nil)
+
+	if _, err := UpdateDirFromRepo("templates", t.TempDir(), "", &DirUpdateOptions{DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !m.has("observe " + MetricDownloadBytes + " asset=templates.zip") {
+		t.Errorf("missing source download metric, got %v", m.events)
+	}
+}
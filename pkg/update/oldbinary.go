@@ -0,0 +1,17 @@
+package updateutils
+
+import "path/filepath"
+
+// oldBinaries returns the copies of executable left next to it by the previous updates, the hidden
+// .<name>.old of selfupdate and the <name>.old of atomicfile
+func oldBinaries(executable string) []string {
+	dir, name := filepath.Dir(executable), filepath.Base(executable)
+	return []string{filepath.Join(dir, "."+name+".old"), filepath.Join(dir, name+".old")}
+}
+
+// sweepOldBinaries removes the copies of the running executable left by the previous updates
+func sweepOldBinaries() {
+	if executable, err := executablePath(); err == nil {
+		removeOldBinaries(executable)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package updateutils
+
+// removeOldBinaries does nothing, the replaced executable is removed by the update outside windows
+func removeOldBinaries(string) {}
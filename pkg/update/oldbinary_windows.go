@@ -0,0 +1,52 @@
+//go:build windows
+
+package updateutils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// detachedProcess is the DETACHED_PROCESS creation flag, the cleanup outlives the console of the updater
+const detachedProcess = 0x00000008
+
+var (
+	// removeFile removes an old binary, it fails while the binary is still running
+	removeFile = os.Remove
+	// deferRemoval removes path once the running process exited, from a detached cmd waiting a few seconds
+	deferRemoval = func(path string) error {
+		cmd := exec.Command("cmd")
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			HideWindow:    true,
+			CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP,
+			CmdLine:       fmt.Sprintf(`cmd /c ping -n 4 127.0.0.1 >nul & del /f /q /a "%s"`, path),
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		return cmd.Process.Release()
+	}
+)
+
+// removeOldBinaries removes the copies of executable left by the previous updates. Windows can't remove
+// the executable of a running process, a copy still locked is removed by a detached cleanup after this
+// process exited, else by the next update
+func removeOldBinaries(executable string) {
+	for _, path := range oldBinaries(executable) {
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		err := removeFile(path)
+		if err == nil {
+			updateLog.Verbose().Msgf("removed %v left by a previous update", path)
+			continue
+		}
+		if deferErr := deferRemoval(path); deferErr != nil {
+			updateLog.Verbose().Msgf("could not remove %v left by a previous update: %v, %v", path, err, deferErr)
+			continue
+		}
+		updateLog.Verbose().Msgf("%v is still in use, removing it once %v exits", path, executable)
+	}
+}
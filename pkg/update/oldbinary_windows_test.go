@@ -0,0 +1,50 @@
+//go:build windows
+
+package updateutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveOldBinaries(t *testing.T) {
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "tool.exe")
+	hidden, plain := filepath.Join(dir, ".tool.exe.old"), filepath.Join(dir, "tool.exe.old")
+	for _, path := range []string{executable, hidden, plain} {
+		if err := os.WriteFile(path, []byte(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var deferred []string
+	removal := deferRemoval
+	deferRemoval = func(path string) error {
+		deferred = append(deferred, path)
+		return nil
+	}
+	defer func() { deferRemoval = removal }()
+
+	// 打开的文件无法删除, 模拟仍在运行的旧版本
+	locked, err := os.Open(hidden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removeOldBinaries(executable)
+	if _, err := os.Stat(plain); !os.IsNotExist(err) {
+		t.Errorf("%v not removed: %v", plain, err)
+	}
+	if _, err := os.Stat(hidden); err != nil || len(deferred) != 1 || deferred[0] != hidden {
+		t.Errorf("locked %v: %v, deferred removals %v", hidden, err, deferred)
+	}
+	if _, err := os.Stat(executable); err != nil {
+		t.Errorf("executable removed: %v", err)
+	}
+
+	// 下次更新时清理
+	locked.Close()
+	removeOldBinaries(executable)
+	if _, err := os.Stat(hidden); !os.IsNotExist(err) {
+		t.Errorf("%v not removed once unlocked: %v", hidden, err)
+	}
+}
@@ -0,0 +1,93 @@
+package updateutils
+
+import (
+	"net/http"
+	"time"
+)
+
+// Options configures the updates of the callbacks built with options, e.g. GetUpdateToolCallbackWithOptions,
+// so that tools embedding the package in one binary don't share the package variables. The variables
+// remain the defaults of the other callbacks, see DefaultOptions
+type Options struct {
+	// HideReleaseNotes doesn't print the release notes after an update
+	HideReleaseNotes bool
+	// HideProgressBar doesn't render the progress bars of the downloads and extractions
+	HideProgressBar bool
+	// VersionCheckTimeout is the timeout of the requests of the version checks
+	VersionCheckTimeout time.Duration
+	// DownloadUpdateTimeout is the timeout of the requests of the updates
+	DownloadUpdateTimeout time.Duration
+	// HTTPClient sends the requests, nil uses the transports configured by SetProxy, SetRootCAs and
+	// AllowInsecureTLS. See WithHTTPClient
+	HTTPClient *http.Client
+	// DryRun resolves the updates without downloading or writing anything
+	DryRun bool
+	// MaxReleaseNotes is the number of releases whose notes are shown by an update skipping releases, see
+	// the package variable
+	MaxReleaseNotes int
+	// ForceUpdate updates regardless of the rollout and reinstalls the release when already installed
+	ForceUpdate bool
+	// IncludePrereleases makes the pre-releases candidates of the latest release
+	IncludePrereleases bool
+	// ConfirmBreakingChanges asks before applying an update whose release notes contain breaking changes
+	ConfirmBreakingChanges bool
+	// BreakingChangePatterns match the headers of breaking change sections, nil uses DefaultBreakingChangePatterns
+	BreakingChangePatterns []string
+	// ReleaseNotesStyle is the glamour style of the release notes, see the package variable
+	ReleaseNotesStyle string
+}
+
+// DefaultOptions returns the options of the package variables HideReleaseNotes, HideProgressBar,
+// VersionCheckTimeout, DownloadUpdateTimeout, DryRun, MaxReleaseNotes, ForceUpdate, IncludePrereleases,
+// ConfirmBreakingChanges, BreakingChangePatterns and ReleaseNotesStyle. HTTPClient is nil:
+// DefaultHttpClient is not used by the downloaders
+func DefaultOptions() Options {
+	return Options{
+		HideReleaseNotes:       HideReleaseNotes,
+		HideProgressBar:        HideProgressBar,
+		VersionCheckTimeout:    VersionCheckTimeout,
+		DownloadUpdateTimeout:  DownloadUpdateTimeout,
+		DryRun:                 DryRun,
+		MaxReleaseNotes:        MaxReleaseNotes,
+		ForceUpdate:            ForceUpdate,
+		IncludePrereleases:     IncludePrereleases,
+		ConfirmBreakingChanges: ConfirmBreakingChanges,
+		BreakingChangePatterns: BreakingChangePatterns,
+		ReleaseNotesStyle:      ReleaseNotesStyle,
+	}
+}
+
+// WithOptions configures the downloader with the progress bars, the timeout, the client, the
+// pre-releases and the rollout of opts instead of the package variables
+func WithOptions(opts Options) DownloaderOption {
+	return func(d *GHReleaseDownloader) {
+		d.options = &opts
+		if opts.HTTPClient != nil {
+			d.httpClient = opts.HTTPClient
+		}
+	}
+}
+
+// resolveOptions returns opts, DefaultOptions at the time of the call when nil
+func resolveOptions(opts *Options) Options {
+	if opts == nil {
+		return DefaultOptions()
+	}
+	return *opts
+}
+
+// progressShown reports whether a progress bar asked with show is rendered under opts, the package
+// variables when nil
+func progressShown(opts *Options, show bool) bool {
+	return show && !resolveOptions(opts).HideProgressBar
+}
+
+// showProgress reports whether the progress bar asked with show is rendered by the downloader
+func (d *GHReleaseDownloader) showProgress(show bool) bool {
+	return progressShown(d.options, show)
+}
+
+// downloadTimeout returns the timeout of the requests of the downloader
+func (d *GHReleaseDownloader) downloadTimeout() time.Duration {
+	return resolveOptions(d.options).DownloadUpdateTimeout
+}
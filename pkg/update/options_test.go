@@ -0,0 +1,104 @@
+package updateutils
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDefaultOptions(t *testing.T) {
+	hide, timeout := HideReleaseNotes, DownloadUpdateTimeout
+	defer func() { HideReleaseNotes, DownloadUpdateTimeout = hide, timeout }()
+	HideReleaseNotes, DownloadUpdateTimeout = true, time.Minute
+	opts := DefaultOptions()
+	if !opts.HideReleaseNotes || opts.DownloadUpdateTimeout != time.Minute || opts.VersionCheckTimeout != VersionCheckTimeout || opts.HTTPClient != nil {
+		t.Errorf("DefaultOptions() = %+v, want the package variables", opts)
+	}
+}
+
+// TestUpdateToolCallbackWithOptionsConcurrently runs differently configured updaters at once, run it
+// with -race
+func TestUpdateToolCallbackWithOptionsConcurrently(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	tools := []string{"chaos", "naabu", "httpx"}
+	for _, tool := range tools {
+		fake.AddRelease(Organization+"/"+tool, newToolRelease(t, tool, "v1.1.0", []byte(tool+" v1.1.0")))
+	}
+	target := fakeExecutable(t, "tool")
+	// 选项覆盖全局变量
+	force := ForceUpdate
+	ForceUpdate = true
+	defer func() { ForceUpdate = force }()
+
+	transports := []*countingTransport{{}, {}, {}}
+	updaters := []struct {
+		version string
+		options Options
+		want    error
+	}{
+		{version: "1.0.0", want: ErrUpdateAvailable, options: Options{HideReleaseNotes: true, HideProgressBar: true, DownloadUpdateTimeout: time.Minute,
+			HTTPClient: &http.Client{Transport: transports[0]}, DryRun: true}},
+		{version: "1.1.0", want: ErrUpdateAvailable, options: Options{HideProgressBar: true, DownloadUpdateTimeout: time.Second, VersionCheckTimeout: time.Second,
+			HTTPClient: &http.Client{Transport: transports[1]}, DryRun: true, ForceUpdate: true}},
+		{version: "1.1.0", want: ErrAlreadyLatest, options: Options{HideReleaseNotes: true, HideProgressBar: true, DownloadUpdateTimeout: time.Minute,
+			HTTPClient: &http.Client{Transport: transports[2]}}},
+	}
+	errs := make([]error, len(tools))
+	var wg sync.WaitGroup
+	for i := range tools {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = GetUpdateToolCallbackWithOptions(tools[i], updaters[i].version, updaters[i].options)()
+		}(i)
+	}
+	wg.Wait()
+	for i, tool := range tools {
+		if !errors.Is(errs[i], updaters[i].want) {
+			t.Errorf("update of %v %v with %+v = %v, want %v", tool, updaters[i].version, updaters[i].options, errs[i], updaters[i].want)
+		}
+		if transports[i].requests.Load() == 0 {
+			t.Errorf("updater of %v didn't use its client", tool)
+		}
+	}
+	if data, _ := os.ReadFile(target); string(data) != "old" {
+		t.Errorf("updaters replaced the executable with %q", data)
+	}
+	if DryRun {
+		t.Error("Options.DryRun set DryRun")
+	}
+}
+
+func TestUpdateDirFromRepoWithOptions(t *testing.T) {
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"cves/change.yaml": "old", ".version": "v1.0.1"})
+	dryRun := DryRun
+	DryRun = true
+	defer func() { DryRun = dryRun }()
+
+	// 全局 DryRun 不影响带 Options 的更新
+	err := GetUpdateDirFromRepoWithOptionsCallback("templates", dir, "", &DirUpdateOptions{Options: &Options{HideProgressBar: true}})()
+	if err != nil || fake.sourceRequests.Load() != 0 {
+		t.Fatalf("update of an up to date dir = %v with %d downloads, want it skipped", err, fake.sourceRequests.Load())
+	}
+	err = GetUpdateDirFromRepoWithOptionsCallback("templates", dir, "", &DirUpdateOptions{Options: &Options{HideProgressBar: true, DryRun: true, ForceUpdate: true}})()
+	if !errors.Is(err, ErrUpdateAvailable) {
+		t.Fatalf("forced dry run = %v, want %v", err, ErrUpdateAvailable)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "cves/change.yaml")); string(data) != "old" {
+		t.Errorf("dry run modified cves/change.yaml to %q", data)
+	}
+	if err := GetUpdateDirFromRepoWithOptionsCallback("templates", dir, "", &DirUpdateOptions{Options: &Options{HideProgressBar: true, ForceUpdate: true}})(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "cves/change.yaml")); string(data) != "changed" {
+		t.Errorf("forced update wrote cves/change.yaml %q, want the release", data)
+	}
+}
@@ -0,0 +1,120 @@
+package updateutils
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// ErrReleaseNotFound is returned when the repo has no release with the requested tag, matched with errors.Is
+var ErrReleaseNotFound = errorutil.NewWithTag("updater", "release not found")
+
+// nearestTagsCount is the number of available tags listed when the requested one doesn't exist
+const nearestTagsCount = 5
+
+// PinRelease replaces the latest release of the downloader with the release tagged tag, the assets and
+// the source are then downloaded from it. A tag without its v prefix matches, e.g. 1.2.0 for v1.2.0. A
+// missing tag is ErrReleaseNotFound listing the nearest available tags
+func (d *GHReleaseDownloader) PinRelease(tag string) error {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return errorutil.NewWithTag("updater", "empty release tag")
+	}
+	release, raw, err := d.releaseByTag(tag)
+	if errors.Is(err, ErrReleaseNotFound) {
+		tags, tagsErr := d.tags()
+		if tagsErr != nil {
+			return err
+		}
+		// 允许省略或多写 v 前缀
+		if match := matchTag(tags, tag); match != "" {
+			release, raw, err = d.releaseByTag(match)
+		} else {
+			return d.tagNotFound(tag, tags)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	d.Latest, d.latestRaw = release, raw
+	d.AssetID, d.fullAssetName = 0, ""
+	return nil
+}
+
+// tags returns the tags of the releases of the repo, newest first
+func (d *GHReleaseDownloader) tags() ([]string, error) {
+	tags, resp, err := d.source.Tags(d.ctx)
+	if err != nil {
+		if rejected := d.credentialRejected(resp, err, "listing the releases"); rejected != nil {
+			return nil, rejected
+		}
+		return nil, errorutil.NewWithErr(err).Msgf("could not list the releases of %v", d.Source())
+	}
+	return tags, nil
+}
+
+// tagNotFound returns the ErrReleaseNotFound of tag listing the nearest of tags
+func (d *GHReleaseDownloader) tagNotFound(tag string, tags []string) error {
+	nearest := nearestTags(tags, tag, nearestTagsCount)
+	if len(nearest) == 0 {
+		return newUpdateError(ErrReleaseNotFound, "release %v of %v not found, the repo has no release", tag, d.Source())
+	}
+	return newUpdateError(ErrReleaseNotFound, "release %v of %v not found, nearest available: %v", tag, d.Source(), strings.Join(nearest, ", "))
+}
+
+// matchTag returns the tag of tags equal to tag as a version, empty when there is none
+func matchTag(tags []string, tag string) string {
+	want, err := semver.NewVersion(tag)
+	if err != nil {
+		return ""
+	}
+	for _, candidate := range tags {
+		if version, err := semver.NewVersion(candidate); err == nil && version.Equal(want) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// nearestTags returns up to n tags closest to tag in version order, the newest tags when tag is not a version
+func nearestTags(tags []string, tag string, n int) []string {
+	type versionTag struct {
+		tag     string
+		version *semver.Version
+	}
+	var versions []versionTag
+	for _, candidate := range tags {
+		if version, err := semver.NewVersion(candidate); err == nil {
+			versions = append(versions, versionTag{tag: candidate, version: version})
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].version.GreaterThan(versions[j].version) })
+	want, err := semver.NewVersion(tag)
+	if err != nil {
+		var newest []string
+		for i := 0; i < len(versions) && i < n; i++ {
+			newest = append(newest, versions[i].tag)
+		}
+		return newest
+	}
+	// 从目标版本所在的位置向两侧交替选取
+	position := sort.Search(len(versions), func(i int) bool { return !versions[i].version.GreaterThan(want) })
+	var nearest []string
+	for above, below := position-1, position; len(nearest) < n && (above >= 0 || below < len(versions)); {
+		if below < len(versions) {
+			nearest = append(nearest, versions[below].tag)
+			below++
+		}
+		if above >= 0 && len(nearest) < n {
+			nearest = append(nearest, versions[above].tag)
+			above--
+		}
+	}
+	sort.Slice(nearest, func(i, j int) bool {
+		return semver.MustParse(nearest[i]).GreaterThan(semver.MustParse(nearest[j]))
+	})
+	return nearest
+}
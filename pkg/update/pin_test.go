@@ -0,0 +1,102 @@
+package updateutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNearestTags(t *testing.T) {
+	tags := []string{"v2.0.0", "v1.3.0", "v1.2.1", "v1.2.0", "nightly", "v1.1.0", "v1.0.0"}
+	tests := []struct {
+		tag  string
+		n    int
+		want []string
+	}{
+		{tag: "v1.2.5", n: 3, want: []string{"v1.3.0", "v1.2.1", "v1.2.0"}},
+		{tag: "v0.9.0", n: 2, want: []string{"v1.1.0", "v1.0.0"}},
+		{tag: "v3.0.0", n: 2, want: []string{"v2.0.0", "v1.3.0"}},
+		// 不是版本号时列出最新的版本
+		{tag: "latest-stable", n: 2, want: []string{"v2.0.0", "v1.3.0"}},
+		{tag: "v1.2.5", n: 10, want: []string{"v2.0.0", "v1.3.0", "v1.2.1", "v1.2.0", "v1.1.0", "v1.0.0"}},
+	}
+	for _, test := range tests {
+		if got := nearestTags(tags, test.tag, test.n); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("nearestTags(%q, %d) = %v, want %v", test.tag, test.n, got, test.want)
+		}
+	}
+	if got := nearestTags(nil, "v1.0.0", 3); len(got) != 0 {
+		t.Errorf("nearestTags() without tags = %v", got)
+	}
+}
+
+func TestGetUpdateToolToVersionCallback(t *testing.T) {
+	hideProgressBar(t)
+	hideReleaseNotes := HideReleaseNotes
+	HideReleaseNotes = true
+	defer func() { HideReleaseNotes = hideReleaseNotes }()
+	tests := []struct {
+		name       string
+		version    string
+		tag        string
+		err        error
+		wantBinary string
+		wantMsg    string
+	}{
+		{name: "downgrade", version: "1.1.0", tag: "v1.0.0", wantBinary: "bin-v1.0.0"},
+		{name: "without v prefix", version: "1.1.0", tag: "1.0.0", wantBinary: "bin-v1.0.0"},
+		// 指定版本时不检查是否为最新版本
+		{name: "upgrade", version: "0.9.0", tag: "v1.0.0", wantBinary: "bin-v1.0.0"},
+		{name: "same version", version: "1.0.0", tag: "v1.0.0", err: ErrAlreadyAtVersion, wantBinary: "old"},
+		{name: "not found", version: "1.1.0", tag: "v1.0.5", err: ErrReleaseNotFound, wantBinary: "old", wantMsg: "v1.1.0, v1.0.0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeGitHub(t)
+			fake.AddRelease(Organization+"/chaos", newToolRelease(t, "chaos", "v1.1.0", []byte("bin-v1.1.0")))
+			fake.AddOlderRelease(Organization+"/chaos", newToolRelease(t, "chaos", "v1.0.0", []byte("bin-v1.0.0")))
+			target := fakeExecutable(t, "chaos")
+
+			err := GetUpdateToolToVersionCallback("chaos", test.version, "", test.tag)()
+			if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("update = %v, want %v", err, test.err)
+			}
+			if err != nil && !strings.Contains(err.Error(), test.wantMsg) {
+				t.Errorf("update = %v, want it to list %v", err, test.wantMsg)
+			}
+			if data, _ := os.ReadFile(target); string(data) != test.wantBinary {
+				t.Errorf("executable = %q, want %q", data, test.wantBinary)
+			}
+		})
+	}
+}
+
+func TestGetUpdateDirFromRepoToVersionCallback(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	fake.AddOlderRelease(Organization+"/templates", &fakeRelease{Tag: "v1.0.0", Source: zipArchive(t, map[string][]byte{
+		"templates-abc100/.version":         []byte("v1.0.0"),
+		"templates-abc100/cves/change.yaml": []byte("v1.0.0"),
+	})})
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"cves/change.yaml": "changed", ".version": "v1.0.1"})
+
+	if err := GetUpdateDirFromRepoToVersionCallback("templates", dir, "", "v1.0.0")(); err != nil {
+		t.Fatalf("GetUpdateDirFromRepoToVersionCallback() = %v", err)
+	}
+	for name, want := range map[string]string{"cves/change.yaml": "v1.0.0", ".version": "v1.0.0"} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != want {
+			t.Errorf("%v = %q, %v, want %q", name, data, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cves/new.yaml")); !os.IsNotExist(err) {
+		t.Errorf("cves/new.yaml of the latest release was installed: %v", err)
+	}
+	if err := GetUpdateDirFromRepoToVersionCallback("templates", dir, "", "v0.1.0")(); !errors.Is(err, ErrReleaseNotFound) {
+		t.Errorf("GetUpdateDirFromRepoToVersionCallback() of a missing tag = %v, want %v", err, ErrReleaseNotFound)
+	}
+}
@@ -0,0 +1,57 @@
+package updateutils
+
+import (
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-github/v30/github"
+)
+
+// IncludePrereleases makes the pre-releases candidates of the latest release of every downloader, see WithPrereleases
+var IncludePrereleases = false
+
+// DownloaderOption configures a GHReleaseDownloader
+type DownloaderOption func(*GHReleaseDownloader)
+
+// WithPrereleases makes the highest version among the releases the latest release, pre-releases such as
+// v2.1.0-beta.3 included. The latest release endpoint of github skips them
+func WithPrereleases() DownloaderOption {
+	return func(d *GHReleaseDownloader) {
+		d.prereleases = true
+	}
+}
+
+// latestPrerelease returns the tag of the highest version of the releases when pre-releases are included,
+// empty for the latest release of the forge otherwise or when no tag is a version
+func (d *GHReleaseDownloader) latestPrerelease() (string, error) {
+	if !d.prereleases {
+		return "", nil
+	}
+	tags, err := d.tags()
+	if err != nil {
+		return "", err
+	}
+	var versions semver.Collection
+	versionTags := make(map[*semver.Version]string)
+	for _, tag := range tags {
+		if version, err := semver.NewVersion(tag); err == nil {
+			versions = append(versions, version)
+			versionTags[version] = tag
+		}
+	}
+	if len(versions) == 0 {
+		return "", nil
+	}
+	// 按版本号而不是发布时间排序
+	sort.Sort(versions)
+	return versionTags[versions[len(versions)-1]], nil
+}
+
+// isPrerelease reports whether release is marked as pre-release or has a pre-release version
+func isPrerelease(release *github.RepositoryRelease) bool {
+	if release.GetPrerelease() {
+		return true
+	}
+	version, err := semver.NewVersion(release.GetTagName())
+	return err == nil && version.Prerelease() != ""
+}
@@ -0,0 +1,68 @@
+package updateutils
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsOutdated(t *testing.T) {
+	tests := []struct {
+		current string
+		latest  string
+		want    bool
+	}{
+		{current: "2.0.5", latest: "2.1.0-beta.3", want: true},
+		{current: "2.1.0-beta.3", latest: "2.1.0", want: true},
+		{current: "2.1.0-beta.3", latest: "2.1.0-beta.10", want: true},
+		{current: "2.1.0", latest: "2.1.0-beta.3", want: false},
+		{current: "2.1.0-beta.3", latest: "v2.1.0-beta.3", want: false},
+		{current: "2.1.0-dev", latest: "2.1.0", want: true},
+	}
+	for _, test := range tests {
+		if got := IsOutdated(test.current, test.latest); got != test.want {
+			t.Errorf("IsOutdated(%q, %q) = %v, want %v", test.current, test.latest, got, test.want)
+		}
+	}
+}
+
+func TestPrereleases(t *testing.T) {
+	hideProgressBar(t)
+	hideReleaseNotes := HideReleaseNotes
+	HideReleaseNotes = true
+	defer func() { HideReleaseNotes = hideReleaseNotes }()
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/chaos", newToolRelease(t, "chaos", "v2.0.5", []byte("bin-v2.0.5")))
+	for _, tag := range []string{"v2.1.0-beta.10", "v2.1.0-beta.3", "v1.0.0"} {
+		release := newToolRelease(t, "chaos", tag, []byte("bin-"+tag))
+		release.Prerelease = tag != "v1.0.0"
+		fake.AddOlderRelease(Organization+"/chaos", release)
+	}
+	// 草稿不参与选择
+	fake.AddOlderRelease(Organization+"/chaos", &fakeRelease{Tag: "v3.0.0", Draft: true})
+
+	d, err := NewghReleaseDownloader("chaos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Latest.GetTagName() != "v2.0.5" {
+		t.Errorf("latest release = %v, want v2.0.5", d.Latest.GetTagName())
+	}
+	d, err = NewghReleaseDownloader("chaos", WithPrereleases())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// beta.10 高于 beta.3, 与发布顺序无关
+	if d.Latest.GetTagName() != "v2.1.0-beta.10" || !isPrerelease(d.Latest) {
+		t.Errorf("latest release with pre-releases = %v, pre-release %v", d.Latest.GetTagName(), isPrerelease(d.Latest))
+	}
+
+	target := fakeExecutable(t, "chaos")
+	IncludePrereleases = true
+	defer func() { IncludePrereleases = false }()
+	if err := GetUpdateToolCallbackWithError("chaos", "2.0.5")(); err != nil {
+		t.Fatalf("update = %v", err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "bin-v2.1.0-beta.10" {
+		t.Errorf("executable = %q, want the pre-release", data)
+	}
+}
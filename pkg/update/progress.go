@@ -0,0 +1,193 @@
+package updateutils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/gologger/levels"
+	"github.com/projectdiscovery/gologger/writer"
+)
+
+// progressInterval is the minimum interval between two renderings of a progress bar
+const progressInterval = 200 * time.Millisecond
+
+// progressBarWidth is the number of cells of the bar itself
+const progressBarWidth = 30
+
+// ProgressLogWriter is the writer of the gologger lines. While a progress bar is rendered the updater
+// sets the logger writer to one clearing the bar before each line and redrawing it after, then sets
+// ProgressLogWriter back. Set it when the logger writes elsewhere than the default CLI writer
+var ProgressLogWriter writer.Writer = writer.NewCLI()
+
+var (
+	// progressOutput is where the progress bars are rendered
+	progressOutput io.Writer = os.Stderr
+	// progressTerminal reports whether progressOutput is a terminal, bars are only rendered on terminals
+	progressTerminal = func() bool {
+		info, err := os.Stderr.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0
+	}
+)
+
+// progress is a single-line progress bar of a download in bytes or of an extraction in files. The
+// methods of a nil progress do nothing
+type progress struct {
+	mutex   sync.Mutex
+	name    string
+	total   int64
+	current int64
+	files   bool
+	detail  string
+	start   time.Time
+	drawn   time.Time
+	done    bool
+}
+
+// newProgress starts the progress bar of name, total is unknown when <= 0. It is nil when show is
+// false or stderr is not a terminal, callers fold HideProgressBar into show with progressShown
+func newProgress(name string, total int64, files, show bool) *progress {
+	if !show || !progressTerminal() {
+		return nil
+	}
+	p := &progress{name: name, total: total, files: files, start: time.Now()}
+	gologger.DefaultLogger.SetWriter(&progressLogWriter{progress: p})
+	p.mutex.Lock()
+	p.draw()
+	p.mutex.Unlock()
+	return p
+}
+
+// Reader returns r counting the bytes read from it
+func (p *progress) Reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{Reader: r, progress: p}
+}
+
+// Add adds n units, detail describes the current one, e.g. the file being extracted
+func (p *progress) Add(n int64, detail string) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.current += n
+	if detail != "" {
+		p.detail = detail
+	}
+	if time.Since(p.drawn) >= progressInterval || (p.total > 0 && p.current >= p.total) {
+		p.draw()
+	}
+}
+
+// Finish draws the bar a last time, ends its line and gives the logger its writer back
+func (p *progress) Finish() {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.done {
+		return
+	}
+	p.done = true
+	p.draw()
+	_, _ = io.WriteString(progressOutput, "\n")
+	gologger.DefaultLogger.SetWriter(ProgressLogWriter)
+}
+
+// draw renders the bar over the current line, the mutex must be held
+func (p *progress) draw() {
+	p.drawn = time.Now()
+	_, _ = io.WriteString(progressOutput, "\r"+p.line()+"\033[K")
+}
+
+// clear erases the bar from the current line, the mutex must be held
+func (p *progress) clear() {
+	_, _ = io.WriteString(progressOutput, "\r\033[K")
+}
+
+// line returns the text of the bar: the bar and percentage when the total is known, the count,
+// the speed and the remaining time
+func (p *progress) line() string {
+	elapsed := time.Since(p.start)
+	builder := &strings.Builder{}
+	builder.WriteString(p.name)
+	if p.total > 0 {
+		ratio := float64(p.current) / float64(p.total)
+		if ratio > 1 {
+			ratio = 1
+		}
+		filled := int(ratio * progressBarWidth)
+		fmt.Fprintf(builder, " [%s%s] %3.0f%%", strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled), ratio*100)
+	}
+	if p.files {
+		fmt.Fprintf(builder, " %d", p.current)
+		if p.total > 0 {
+			fmt.Fprintf(builder, "/%d", p.total)
+		}
+		builder.WriteString(" files")
+	} else {
+		builder.WriteString(" " + formatBytes(p.current))
+		if p.total > 0 {
+			builder.WriteString("/" + formatBytes(p.total))
+		}
+		if seconds := elapsed.Seconds(); seconds > 0 {
+			builder.WriteString(" " + formatBytes(int64(float64(p.current)/seconds)) + "/s")
+		}
+	}
+	if !p.done && p.total > 0 && p.current > 0 && p.current < p.total {
+		remaining := time.Duration(float64(elapsed) * float64(p.total-p.current) / float64(p.current))
+		fmt.Fprintf(builder, " ETA %s", remaining.Round(time.Second))
+	}
+	if p.detail != "" && !p.done {
+		builder.WriteString(" " + p.detail)
+	}
+	return builder.String()
+}
+
+// formatBytes returns n in binary units, e.g. 12.3 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+type progressReader struct {
+	io.Reader
+	progress *progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.progress.Add(int64(n), "")
+	return n, err
+}
+
+// progressLogWriter writes the gologger lines above the progress bar
+type progressLogWriter struct {
+	progress *progress
+}
+
+func (w *progressLogWriter) Write(data []byte, level levels.Level) {
+	w.progress.mutex.Lock()
+	defer w.progress.mutex.Unlock()
+	w.progress.clear()
+	ProgressLogWriter.Write(data, level)
+	if !w.progress.done {
+		w.progress.draw()
+	}
+}
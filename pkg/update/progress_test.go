@@ -0,0 +1,146 @@
+package updateutils
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/gologger/levels"
+)
+
+// bufferLogWriter writes the gologger lines to the buffer of the progress bars
+type bufferLogWriter struct {
+	buf *bytes.Buffer
+}
+
+func (w *bufferLogWriter) Write(data []byte, _ levels.Level) {
+	w.buf.Write(data)
+	w.buf.WriteString("\n")
+}
+
+// captureProgress renders the progress bars and the gologger lines to a buffer until the test ends
+func captureProgress(t *testing.T, terminal bool) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	output, isTerminal, logWriter, hide := progressOutput, progressTerminal, ProgressLogWriter, HideProgressBar
+	progressOutput, progressTerminal, ProgressLogWriter, HideProgressBar = buf, func() bool { return terminal }, &bufferLogWriter{buf: buf}, false
+	gologger.DefaultLogger.SetWriter(ProgressLogWriter)
+	t.Cleanup(func() {
+		progressOutput, progressTerminal, ProgressLogWriter, HideProgressBar = output, isTerminal, logWriter, hide
+		gologger.DefaultLogger.SetWriter(ProgressLogWriter)
+	})
+	return buf
+}
+
+func TestProgressLine(t *testing.T) {
+	start := time.Now().Add(-10 * time.Second)
+	tests := []struct {
+		name     string
+		progress *progress
+		want     []string
+	}{
+		{name: "known size", progress: &progress{name: "a.tar.gz", total: 4 << 20, current: 1 << 20, start: start},
+			want: []string{"a.tar.gz [=======                       ]  25%", "1.0 MiB/4.0 MiB", "KiB/s", "ETA 30s"}},
+		{name: "unknown size", progress: &progress{name: "a.zip", current: 1536, start: start},
+			want: []string{"a.zip 1.5 KiB", "B/s"}},
+		{name: "files", progress: &progress{name: "extracting", total: 4, current: 2, files: true, detail: "dir/file.txt", start: start},
+			want: []string{"extracting [===============               ]  50% 2/4 files", "dir/file.txt"}},
+	}
+	for _, test := range tests {
+		line := test.progress.line()
+		for _, want := range test.want {
+			if !strings.Contains(line, want) {
+				t.Errorf("line() %s = %q, want it to contain %q", test.name, line, want)
+			}
+		}
+	}
+	if line := (&progress{name: "a.zip", start: start}).line(); strings.Contains(line, "ETA") || strings.Contains(line, "%") {
+		t.Errorf("line() of an unknown size = %q, want no percentage or ETA", line)
+	}
+}
+
+func TestProgressHidden(t *testing.T) {
+	tests := []struct {
+		name     string
+		terminal bool
+		hide     bool
+		show     bool
+	}{
+		{name: "not a terminal", terminal: false, show: true},
+		{name: "HideProgressBar", terminal: true, hide: true, show: true},
+		{name: "not asked", terminal: true},
+	}
+	for _, test := range tests {
+		buf := captureProgress(t, test.terminal)
+		HideProgressBar = test.hide
+		bar := newProgress("a.tar.gz", 10, false, progressShown(nil, test.show))
+		_, _ = io.ReadAll(bar.Reader(strings.NewReader("0123456789")))
+		bar.Finish()
+		if bar != nil || buf.Len() != 0 {
+			t.Errorf("%s: progress rendered %q", test.name, buf.String())
+		}
+	}
+	HideProgressBar = false
+	if progressShown(&Options{HideProgressBar: true}, true) {
+		t.Error("progressShown() with Options.HideProgressBar = true")
+	}
+	HideProgressBar = true
+	defer func() { HideProgressBar = false }()
+	if !progressShown(&Options{}, true) {
+		t.Error("progressShown() with Options ignoring HideProgressBar = false")
+	}
+}
+
+func TestProgressLogLines(t *testing.T) {
+	buf := captureProgress(t, true)
+	bar := newProgress("a.tar.gz", 20, false, true)
+	_, _ = io.ReadAll(bar.Reader(strings.NewReader("0123456789")))
+	gologger.Info().Msgf("retrying download")
+	_, _ = io.ReadAll(bar.Reader(strings.NewReader("0123456789")))
+	bar.Finish()
+	gologger.Info().Msgf("after the bar")
+
+	out := buf.String()
+	// 日志行之前清除进度条, 之后重新绘制
+	before, after, ok := strings.Cut(out, "retrying download")
+	if !ok || strings.Contains(before[strings.LastIndex(before, "\r\033[K"):], "a.tar.gz") {
+		t.Fatalf("log line not written on a cleared line: %q", out)
+	}
+	if !strings.HasPrefix(after, "\n\ra.tar.gz") {
+		t.Errorf("bar not redrawn after the log line: %q", after)
+	}
+	finished, rest, _ := strings.Cut(after, "100%")
+	// 结束的进度条独占一行
+	if finished == "" || !strings.HasPrefix(rest, " ") || !strings.Contains(rest, "\033[K\n[") || !strings.HasSuffix(rest, "] after the bar\n") {
+		t.Errorf("log line after the finished bar = %q", rest)
+	}
+}
+
+func TestDownloadSourceProgress(t *testing.T) {
+	buf := captureProgress(t, true)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/progress", &fakeRelease{Tag: "v1.0.0", Source: zipArchive(t, map[string][]byte{
+		"progress/a.txt": []byte("a"),
+		"progress/b.txt": []byte("b"),
+	})})
+	d, err := NewghReleaseDownloader(Organization + "/progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files int
+	if err := d.DownloadSourceWithCallback(true, func(string, fs.FileInfo, io.Reader) error {
+		files++
+		return nil
+	}); err != nil || files != 2 {
+		t.Fatalf("DownloadSourceWithCallback() = %v with %d files", err, files)
+	}
+	out := buf.String()
+	for _, want := range []string{"progress.zip", "B/s", "extracting progress", "2/2 files"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("progress = %q, want it to contain %q", out, want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package updateutils
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// SetProxy sends the requests of the updater through proxyURL, an http://, https:// or socks5:// url
+// which may carry credentials, instead of the proxy of the environment. An empty url restores the
+// environment. The clients created afterwards use it: the version checks, the release api calls and
+// the asset and source downloads
+func SetProxy(proxyURL string) error {
+	if proxyURL == "" {
+		rebuildTransports(func(c *transportConfig) { c.proxy = http.ProxyFromEnvironment })
+		return nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		// 错误信息不包含代理地址, 其中可能有凭据
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return errorutil.NewWithErr(err).Msgf("could not parse the update proxy url")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return errorutil.New("unsupported update proxy scheme %q in %v, use http, https or socks5", u.Scheme, u.Redacted())
+	}
+	if u.Host == "" {
+		return errorutil.New("update proxy %v has no host", u.Redacted())
+	}
+	rebuildTransports(func(c *transportConfig) { c.proxy = http.ProxyURL(u) })
+	return nil
+}
@@ -0,0 +1,83 @@
+package updateutils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v30/github"
+)
+
+// ErrRateLimited is returned when the forge refused a request because the rate limit of its api is
+// exhausted, matched with errors.As. Callers checking for updates may skip the check silently
+type ErrRateLimited struct {
+	// ResetAt is when the limit resets, zero when the forge didn't tell
+	ResetAt time.Time
+	// Forge is SourceGitHub, SourceGitLab or SourceGitea
+	Forge string
+	// Authenticated reports whether the requests carried a token
+	Authenticated bool
+	// Action is what the updater was doing, e.g. fetching the latest release
+	Action string
+}
+
+// now returns the current time, tests replace it
+var now = time.Now
+
+func (e *ErrRateLimited) Error() string {
+	msg := fmt.Sprintf("%v api rate limit exceeded while %v", e.Forge, e.Action)
+	if !e.ResetAt.IsZero() {
+		msg += fmt.Sprintf(", it resets at %v (in %v)", e.ResetAt.Local().Format("15:04:05"), e.ResetAt.Sub(now()).Round(time.Second))
+	}
+	switch {
+	case e.Authenticated:
+		return msg + ", the limit of the token is exhausted"
+	case e.Forge == SourceGitHub:
+		return msg + ", set GITHUB_TOKEN or GH_TOKEN to raise it"
+	}
+	return msg + fmt.Sprintf(", set the %v credential to raise it", forgeCredential(e.Forge))
+}
+
+// isRateLimited reports whether err is an ErrRateLimited
+func isRateLimited(err error) bool {
+	var limited *ErrRateLimited
+	return errors.As(err, &limited)
+}
+
+// rateLimited returns the ErrRateLimited of the response resp or the error err of a request made while doing
+// action, nil when the request wasn't refused by the rate limit. The github client reports the limit with its
+// own errors, the downloads and the other forges with a 403 or a 429 and the rate limit headers
+func (d *GHReleaseDownloader) rateLimited(resp *http.Response, err error, action string) error {
+	limited := &ErrRateLimited{Forge: d.forge, Authenticated: d.authenticated, Action: action}
+	var rateLimit *github.RateLimitError
+	var abuse *github.AbuseRateLimitError
+	switch {
+	case errors.As(err, &rateLimit):
+		limited.ResetAt = rateLimit.Rate.Reset.Time
+		return limited
+	case errors.As(err, &abuse):
+		if abuse.RetryAfter != nil {
+			limited.ResetAt = now().Add(*abuse.RetryAfter)
+		}
+		return limited
+	case resp == nil || resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests:
+		return nil
+	}
+	// github 和 gitea 使用 X-RateLimit-*, gitlab 使用 RateLimit-*
+	remaining := resp.Header.Get("X-RateLimit-Remaining")
+	reset := resp.Header.Get("X-RateLimit-Reset")
+	if remaining == "" {
+		remaining, reset = resp.Header.Get("RateLimit-Remaining"), resp.Header.Get("RateLimit-Reset")
+	}
+	if remaining != "0" && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	if seconds, err := strconv.ParseInt(reset, 10, 64); err == nil && seconds > 0 {
+		limited.ResetAt = time.Unix(seconds, 0)
+	} else if after, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && after > 0 {
+		limited.ResetAt = now().Add(time.Duration(after) * time.Second)
+	}
+	return limited
+}
@@ -0,0 +1,127 @@
+package updateutils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rateLimitedResponse answers like github once the rate limit is exhausted, resetting at reset
+func rateLimitedResponse(reset time.Time) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message":"API rate limit exceeded for 127.0.0.1."}`))
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	hideProgressBar(t)
+	reset := time.Now().Add(12 * time.Minute).Truncate(time.Second)
+	suffix := func(s string) func(string) bool { return func(path string) bool { return strings.HasSuffix(path, s) } }
+	prefix := func(s string) func(string) bool { return func(path string) bool { return strings.HasPrefix(path, s) } }
+	tests := []struct {
+		name   string
+		match  func(string) bool
+		action string
+	}{
+		{name: "latest release", match: suffix("/releases/latest"), action: "fetching the latest release"},
+		{name: "asset download", match: prefix("/download/"), action: "downloading an asset"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeGitHub(t)
+			fake.AddRelease(Organization+"/limited", newToolRelease(t, "limited", "v1.0.0", []byte("bin")))
+			flaky := &flakyServer{match: test.match, failures: 10, fail: rateLimitedResponse(reset)}
+			server := httptest.NewServer(flaky.handler(fake))
+			defer server.Close()
+			githubBaseURL, _ = url.Parse(server.URL + "/api/")
+			UpdateSourceAllowlist = append(UpdateSourceAllowlist, trustedSource(Organization+"/limited"))
+			fake.DownloadURL = server.URL
+
+			err := GetUpdateToolFromRepoCallbackWithError("limited", "0.9.0", "")()
+			var limited *ErrRateLimited
+			if !errors.As(err, &limited) {
+				t.Fatalf("update = %v, want an ErrRateLimited", err)
+			}
+			if !limited.ResetAt.Equal(reset) || limited.Forge != SourceGitHub || !strings.HasPrefix(limited.Action, test.action) {
+				t.Errorf("ErrRateLimited = %+v, want reset at %v while %v", limited, reset, test.action)
+			}
+			for _, want := range []string{"rate limit exceeded", "resets at " + reset.Local().Format("15:04:05"), "GITHUB_TOKEN"} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't contain %q", err, want)
+				}
+			}
+		})
+	}
+
+	// 版本检查原样返回, 调用方可以跳过
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/limited", newToolRelease(t, "limited", "v1.0.0", []byte("bin")))
+	flaky := &flakyServer{match: suffix("/releases/latest"), failures: 10, fail: rateLimitedResponse(reset)}
+	server := httptest.NewServer(flaky.handler(fake))
+	defer server.Close()
+	githubBaseURL, _ = url.Parse(server.URL + "/api/")
+	UpdateSourceAllowlist = append(UpdateSourceAllowlist, trustedSource(Organization+"/limited"))
+	var limited *ErrRateLimited
+	if _, err := GetToolVersionCallback("limited", "")(); !errors.As(err, &limited) {
+		t.Errorf("GetToolVersionCallback() = %v, want an ErrRateLimited", err)
+	}
+}
+
+func TestRateLimitedResponse(t *testing.T) {
+	at := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	defer func(saved func() time.Time) { now = saved }(now)
+	now = func() time.Time { return at }
+	header := func(pairs ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i], pairs[i+1])
+		}
+		return h
+	}
+	tests := []struct {
+		name          string
+		forge         string
+		authenticated bool
+		status        int
+		header        http.Header
+		want          time.Time
+		limited       bool
+		message       string
+	}{
+		{name: "github", forge: SourceGitHub, status: http.StatusForbidden, header: header("X-RateLimit-Remaining", "0", "X-RateLimit-Reset", "1791979200"), want: time.Unix(1791979200, 0), limited: true, message: "set GITHUB_TOKEN or GH_TOKEN"},
+		{name: "gitlab", forge: SourceGitLab, status: http.StatusTooManyRequests, header: header("RateLimit-Remaining", "0", "RateLimit-Reset", "1791979200"), want: time.Unix(1791979200, 0), limited: true, message: "set the gitlab-token credential"},
+		{name: "retry after", forge: SourceGitea, status: http.StatusTooManyRequests, header: header("Retry-After", "90"), want: at.Add(90 * time.Second), limited: true, message: "(in 1m30s)"},
+		{name: "unknown reset", forge: SourceGitHub, status: http.StatusTooManyRequests, header: header(), limited: true, message: "while testing, set GITHUB_TOKEN"},
+		{name: "authenticated", forge: SourceGitHub, authenticated: true, status: http.StatusForbidden, header: header("X-RateLimit-Remaining", "0"), limited: true, message: "limit of the token is exhausted"},
+		{name: "forbidden", forge: SourceGitHub, status: http.StatusForbidden, header: header("X-RateLimit-Remaining", "42")},
+		{name: "not found", forge: SourceGitHub, status: http.StatusNotFound, header: header("X-RateLimit-Remaining", "0")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := &GHReleaseDownloader{forge: test.forge, authenticated: test.authenticated}
+			err := d.rateLimited(&http.Response{StatusCode: test.status, Header: test.header}, nil, "testing")
+			if (err != nil) != test.limited {
+				t.Fatalf("rateLimited() = %v, want limited %v", err, test.limited)
+			}
+			if err == nil {
+				return
+			}
+			limited := err.(*ErrRateLimited)
+			if !limited.ResetAt.Equal(test.want) {
+				t.Errorf("ResetAt = %v, want %v", limited.ResetAt, test.want)
+			}
+			if !strings.Contains(err.Error(), test.message) {
+				t.Errorf("rateLimited() = %q, want %q", err, test.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package updateutils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReleaseRaw(t *testing.T) {
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/raw", &fakeRelease{ID: 7, Tag: "v1.1.0"})
+	fake.AddOlderRelease(Organization+"/raw", &fakeRelease{ID: 3, Tag: "v1.0.0"})
+	downloader, err := NewghReleaseDownloader("raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := fake.apiRequests.Load()
+
+	raw, err := downloader.LatestRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil || fields["target_commitish"] != "main" || fields["tag_name"] != downloader.Latest.GetTagName() {
+		t.Errorf("LatestRaw() = %s, want the unmodified release", raw)
+	}
+	if tagged, err := downloader.ReleaseByTagRaw("v1.1.0"); err != nil || string(tagged) != string(raw) {
+		t.Errorf("ReleaseByTagRaw() of the latest tag = %s, %v", tagged, err)
+	}
+	if got := fake.apiRequests.Load(); got != requests {
+		t.Errorf("raw release of the latest tag made %d api requests", got-requests)
+	}
+
+	for i := 0; i < 2; i++ {
+		release, err := downloader.ReleaseByTag("v1.0.0")
+		if err != nil || release.GetID() != 3 {
+			t.Fatalf("ReleaseByTag() = %v, %v", release, err)
+		}
+	}
+	if got := fake.apiRequests.Load(); got != requests+1 {
+		t.Errorf("release fetched twice by tag made %d api requests, want 1", got-requests)
+	}
+	if _, err := downloader.ReleaseByTagRaw("v0.9.0"); err == nil {
+		t.Error("ReleaseByTagRaw() of a missing tag succeeded")
+	}
+}
@@ -0,0 +1,231 @@
+package updateutils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/charmbracelet/glamour"
+	"github.com/fatih/color"
+	"github.com/muesli/termenv"
+)
+
+// DefaultBreakingChangePatterns match the release notes headers of breaking change sections
+var DefaultBreakingChangePatterns = []string{`(?i)breaking`, `⚠`, `(?i)deprecat`}
+
+// ReleaseNotesStyle is the glamour style of the release notes printed after an update: "auto", "dark",
+// "light", "notty" or "raw" for the markdown as is. "auto" picks dark or light from the terminal background,
+// and notty when stdout is not a terminal or NO_COLOR is set
+var ReleaseNotesStyle = "auto"
+
+// stdoutTerminal reports whether stdout, where the release notes are printed, is a terminal
+var stdoutTerminal = func() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// plainOutput reports whether the update output is printed without colors, when stdout is not a terminal
+// or colors are disabled by NO_COLOR or color.NoColor
+func plainOutput() bool {
+	_, noColor := os.LookupEnv("NO_COLOR")
+	return noColor || color.NoColor || !stdoutTerminal()
+}
+
+// plainColor returns s colored by colorize unless the output is plain
+func plainColor(colorize func(format string, a ...interface{}) string, s string) string {
+	if plainOutput() {
+		return s
+	}
+	return colorize("%s", s)
+}
+
+var markdownHeaderRegex = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+
+// ExtractBreakingChanges returns the release notes sections whose header matches one of patterns,
+// a section runs until the next header of the same or a higher level
+func ExtractBreakingChanges(notes string, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = DefaultBreakingChangePatterns
+	}
+	regexes := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid breaking change pattern %v: %w", pattern, err)
+		}
+		regexes = append(regexes, regex)
+	}
+	var (
+		sections []string
+		current  []string
+		level    int
+	)
+	flush := func() {
+		if current != nil {
+			sections = append(sections, strings.TrimSpace(strings.Join(current, "\n")))
+			current = nil
+		}
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(notes, "\r\n", "\n"), "\n") {
+		rg := markdownHeaderRegex.FindStringSubmatch(line)
+		if rg == nil {
+			if current != nil {
+				current = append(current, line)
+			}
+			continue
+		}
+		if current != nil && len(rg[1]) <= level {
+			flush()
+		}
+		if current == nil && matchAny(regexes, rg[2]) {
+			current = []string{line}
+			level = len(rg[1])
+		} else if current != nil {
+			current = append(current, line)
+		}
+	}
+	flush()
+	return sections, nil
+}
+
+func matchAny(regexes []*regexp.Regexp, s string) bool {
+	for _, regex := range regexes {
+		if regex.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// HighlightBreakingChanges returns the release notes with their breaking change sections repeated
+// in a highlighted block before the full notes, and whether any was found
+func HighlightBreakingChanges(notes string, patterns []string) (string, bool, error) {
+	sections, err := ExtractBreakingChanges(notes, patterns)
+	if err != nil || len(sections) == 0 {
+		return notes, false, err
+	}
+	builder := &strings.Builder{}
+	builder.WriteString("> **⚠ This release contains breaking changes**\n>\n")
+	for i, section := range sections {
+		if i > 0 {
+			builder.WriteString(">\n")
+		}
+		for _, line := range strings.Split(section, "\n") {
+			builder.WriteString("> ")
+			builder.WriteString(line)
+			builder.WriteString("\n")
+		}
+	}
+	builder.WriteString("\n---\n\n")
+	builder.WriteString(notes)
+	return builder.String(), true, nil
+}
+
+// renderReleaseNotes renders the markdown release notes in style, see ReleaseNotesStyle, the markdown as is
+// when the style is raw or can't be rendered
+func renderReleaseNotes(notes, style string) string {
+	if style == "raw" {
+		return notes
+	}
+	if style == "" {
+		style = "auto"
+	}
+	if style == "auto" && plainOutput() {
+		style = "notty"
+	}
+	options := []glamour.TermRendererOption{glamour.WithStandardStyle(style)}
+	if style == "notty" {
+		// 不输出任何转义序列
+		options = append(options, glamour.WithColorProfile(termenv.Ascii))
+	}
+	r, err := glamour.NewTermRenderer(options...)
+	if err != nil {
+		updateLog.Error().Msgf("markdown rendering not supported with style %v: %v", style, err)
+		return notes
+	}
+	rendered, err := r.Render(notes)
+	if err != nil {
+		updateLog.Error().Msg(err.Error())
+		return notes
+	}
+	return rendered
+}
+
+// printReleaseNotes prints the release notes rendered by renderReleaseNotes
+func printReleaseNotes(notes, style string) {
+	updateLog.Print().Msgf("%v\n\n", renderReleaseNotes(notes, style))
+}
+
+// MaxReleaseNotes is the number of releases whose notes are shown by an update skipping releases, newest
+// first. 1 or less shows the notes of the installed release only
+var MaxReleaseNotes = 10
+
+// releaseNotes returns the notes of the releases after currentTag up to latestTag, newest first under a header
+// per version and capped at the MaxReleaseNotes of the downloader. Pre-releases other than latest are left
+// out unless the downloader includes them. It falls back to the notes of latest alone when the source can't
+// list its releases
+func (d *GHReleaseDownloader) releaseNotes(currentTag, latestTag string) string {
+	notes := d.Latest.GetBody()
+	limit := resolveOptions(d.options).MaxReleaseNotes
+	lister, ok := d.source.(releaseLister)
+	current, currentErr := semver.NewVersion(currentTag)
+	latest, latestErr := semver.NewVersion(latestTag)
+	// 非语义化版本无法确定中间的版本
+	if !ok || limit <= 1 || currentErr != nil || latestErr != nil || !latest.GreaterThan(current) {
+		return notes
+	}
+	releases, _, err := lister.releases(d.ctx)
+	if err != nil {
+		updateLog.Verbose().Msgf("showing the release notes of %v only, failed to list the releases: %v", d.Latest.GetTagName(), err)
+		return notes
+	}
+	type versionNotes struct {
+		version *semver.Version
+		tag     string
+		notes   string
+	}
+	var skipped []versionNotes
+	for _, release := range releases {
+		version, err := semver.NewVersion(release.TagName)
+		if err != nil || release.Draft || !version.GreaterThan(current) || !version.LessThan(latest) {
+			continue
+		}
+		if !d.prereleases && (release.Prerelease || version.Prerelease() != "") {
+			continue
+		}
+		skipped = append(skipped, versionNotes{version: version, tag: release.TagName, notes: release.notes()})
+	}
+	if len(skipped) == 0 {
+		return notes
+	}
+	sort.Slice(skipped, func(i, j int) bool {
+		return skipped[i].version.GreaterThan(skipped[j].version)
+	})
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "# %v\n\n%v\n", d.Latest.GetTagName(), strings.TrimSpace(notes))
+	for i, release := range skipped {
+		// latest 占用一个名额
+		if i+1 >= limit {
+			fmt.Fprintf(builder, "\n---\n\n_%d older releases since %v not shown_\n", len(skipped)-i, current.Original())
+			break
+		}
+		fmt.Fprintf(builder, "\n# %v\n\n%v\n", release.tag, strings.TrimSpace(release.notes))
+	}
+	return builder.String()
+}
+
+// confirm asks the user to confirm on stdin, it returns false when stdin is not a terminal
+func confirm(prompt string) bool {
+	if stat, err := os.Stdin.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		updateLog.Warning().Msgf("%s: stdin is not interactive, refusing", prompt)
+		return false
+	}
+	updateLog.Print().Msgf("%s [y/N]: ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,233 @@
+package updateutils
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+const releaseNotes = `## What's Changed
+* faster scans
+
+## ⚠ Breaking Changes
+* -json output renamed fields
+### Migration
+rename your jq filters
+
+## Deprecations
+* -old-flag will be removed
+
+## Bug Fixes
+* fix crash
+`
+
+func TestExtractBreakingChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		notes    string
+		patterns []string
+		want     []string
+	}{
+		{
+			name:  "default patterns",
+			notes: releaseNotes,
+			want: []string{
+				"## ⚠ Breaking Changes\n* -json output renamed fields\n### Migration\nrename your jq filters",
+				"## Deprecations\n* -old-flag will be removed",
+			},
+		},
+		{name: "custom patterns", notes: releaseNotes, patterns: []string{`(?i)bug`}, want: []string{"## Bug Fixes\n* fix crash"}},
+		{name: "no breaking changes", notes: "## What's Changed\n* faster scans\n", want: nil},
+	}
+	for _, test := range tests {
+		got, err := ExtractBreakingChanges(test.notes, test.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%s: ExtractBreakingChanges() = %q, want %q", test.name, got, test.want)
+		}
+	}
+	if _, err := ExtractBreakingChanges(releaseNotes, []string{"("}); err == nil {
+		t.Error("ExtractBreakingChanges() with an invalid pattern should fail")
+	}
+}
+
+func TestHighlightBreakingChanges(t *testing.T) {
+	notes, breaking, err := HighlightBreakingChanges(releaseNotes, nil)
+	if err != nil || !breaking {
+		t.Fatalf("HighlightBreakingChanges() = %v, %v", breaking, err)
+	}
+	if !strings.HasPrefix(notes, "> **⚠ This release contains breaking changes**") || !strings.HasSuffix(notes, releaseNotes) {
+		t.Errorf("unexpected highlighted notes:\n%s", notes)
+	}
+}
+
+func TestUpdateToolsConfirmBreaking(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	for _, name := range []string{"breaking", "custom"} {
+		release := newToolRelease(t, name, "v2.0.0", []byte(name))
+		release.Body = releaseNotes
+		fake.AddRelease(Organization+"/"+name, release)
+	}
+	var asked []string
+	updater := &Updater{APIRequestsPerMinute: -1, Concurrency: 1, ConfirmBreaking: func(result *UpdateResult) bool {
+		asked = append(asked, result.Tool.Name)
+		return false
+	}}
+	defer updater.Close()
+	summary := updater.UpdateTools(context.Background(), []Tool{
+		{Name: "breaking", Version: "1.0.0"},
+		// 覆盖后的规则不匹配任何 header
+		{Name: "custom", Version: "1.0.0", BreakingChangePatterns: []string{`^Nothing$`}},
+	}, t.TempDir())
+
+	if !summary.Results[0].BreakingChanges || summary.Results[0].Err != ErrBreakingChangesNotConfirmed || summary.Results[0].Updated {
+		t.Errorf("breaking: got %+v", summary.Results[0])
+	}
+	if summary.Results[1].BreakingChanges || summary.Results[1].Err != nil || !summary.Results[1].Updated {
+		t.Errorf("custom: got %+v", summary.Results[1])
+	}
+	if strings.Join(asked, ",") != "breaking" {
+		t.Errorf("ConfirmBreaking asked for %v, want [breaking]", asked)
+	}
+}
+
+func TestReleaseNotesBetweenVersions(t *testing.T) {
+	fake := newFakeGitHub(t)
+	repo := Organization + "/notes"
+	fake.AddRelease(repo, &fakeRelease{Tag: "v1.4.0", Body: "notes 1.4.0"})
+	for _, release := range []*fakeRelease{
+		{Tag: "v1.1.0", Body: "notes 1.1.0"},
+		{Tag: "v1.3.0", Body: "notes 1.3.0"},
+		{Tag: "v1.3.1-rc.1", Body: "notes rc", Prerelease: true},
+		{Tag: "v1.2.0", Body: "notes 1.2.0"},
+		{Tag: "v1.2.5", Body: "notes draft", Draft: true},
+		{Tag: "v1.0.0", Body: "notes 1.0.0"},
+	} {
+		fake.AddOlderRelease(repo, release)
+	}
+	limit := MaxReleaseNotes
+	defer func() { MaxReleaseNotes = limit }()
+
+	tests := []struct {
+		name        string
+		current     string
+		limit       int
+		prereleases bool
+		listStatus  int
+		want        []string
+		omitted     string
+	}{
+		{name: "one release behind", current: "1.3.0", limit: 10, want: []string{"notes 1.4.0"}},
+		{name: "releases between", current: "1.1.0", limit: 10, want: []string{"# v1.4.0", "notes 1.4.0", "# v1.3.0", "notes 1.3.0", "# v1.2.0", "notes 1.2.0"}},
+		{name: "capped", current: "1.0.0", limit: 2, want: []string{"# v1.4.0", "notes 1.4.0", "# v1.3.0", "notes 1.3.0"}, omitted: "_2 older releases since 1.0.0 not shown_"},
+		{name: "not aggregated", current: "1.0.0", limit: 1, want: []string{"notes 1.4.0"}},
+		{name: "pre-releases", current: "1.2.0", limit: 10, prereleases: true, want: []string{"# v1.4.0", "notes 1.4.0", "# v1.3.1-rc.1", "notes rc", "# v1.3.0", "notes 1.3.0"}},
+		{name: "list failure", current: "1.1.0", limit: 10, listStatus: http.StatusForbidden, want: []string{"notes 1.4.0"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			MaxReleaseNotes = test.limit
+			fake.ListStatus = test.listStatus
+			defer func() { fake.ListStatus = 0 }()
+			var opts []DownloaderOption
+			if test.prereleases {
+				opts = append(opts, WithPrereleases())
+			}
+			gh, err := NewghReleaseDownloader(repo, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			notes := gh.releaseNotes(test.current, gh.Latest.GetTagName())
+			var got []string
+			for _, line := range strings.Split(notes, "\n") {
+				if line != "" && line != "---" && !strings.HasPrefix(line, "_") {
+					got = append(got, line)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(test.want, "|") {
+				t.Errorf("releaseNotes() =\n%s\nwant %v", notes, test.want)
+			}
+			if test.omitted != "" && !strings.Contains(notes, test.omitted) {
+				t.Errorf("releaseNotes() =\n%s\nwant %q", notes, test.omitted)
+			}
+		})
+	}
+}
+
+func TestUpdateToolsBreakingChangesOfSkippedRelease(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	release := newToolRelease(t, "skipped", "v2.1.0", []byte("skipped"))
+	release.Body = "## Bug Fixes\n* fix crash\n"
+	fake.AddRelease(Organization+"/skipped", release)
+	older := newToolRelease(t, "skipped", "v2.0.0", []byte("skipped"))
+	older.Body = releaseNotes
+	fake.AddOlderRelease(Organization+"/skipped", older)
+
+	updater := &Updater{APIRequestsPerMinute: -1, Concurrency: 1, ConfirmBreaking: func(*UpdateResult) bool { return false }}
+	defer updater.Close()
+	summary := updater.UpdateTools(context.Background(), []Tool{{Name: "skipped", Version: "1.0.0"}}, t.TempDir())
+	result := summary.Results[0]
+	if !result.BreakingChanges || result.Err != ErrBreakingChangesNotConfirmed {
+		t.Errorf("update across a breaking release: got %+v", result)
+	}
+	if !strings.Contains(result.ReleaseNotes, "# v2.0.0") || !strings.Contains(result.ReleaseNotes, "# v2.1.0") {
+		t.Errorf("release notes of the update miss a release:\n%s", result.ReleaseNotes)
+	}
+}
+
+func TestRenderReleaseNotes(t *testing.T) {
+	terminal, noColor := stdoutTerminal, color.NoColor
+	defer func() { stdoutTerminal, color.NoColor = terminal, noColor }()
+	color.NoColor = false
+	notes := "## What's Changed\n* **faster** scans\n"
+
+	tests := []struct {
+		name     string
+		style    string
+		terminal bool
+		noColor  string
+		ansi     bool
+		raw      bool
+	}{
+		{name: "dark", style: "dark", terminal: true, ansi: true},
+		{name: "auto piped", style: "auto", terminal: false},
+		{name: "auto NO_COLOR", style: "auto", terminal: true, noColor: "1"},
+		{name: "notty", style: "notty", terminal: true},
+		{name: "raw", style: "raw", terminal: true, raw: true},
+		{name: "unknown", style: "sepia", terminal: true, raw: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdoutTerminal = func() bool { return test.terminal }
+			if test.noColor != "" {
+				t.Setenv("NO_COLOR", test.noColor)
+			}
+			rendered := renderReleaseNotes(notes, test.style)
+			if got := strings.Contains(rendered, "\x1b["); got != test.ansi {
+				t.Errorf("renderReleaseNotes() = %q, escape sequences %v want %v", rendered, got, test.ansi)
+			}
+			if got := rendered == notes; got != test.raw {
+				t.Errorf("renderReleaseNotes() = %q, raw %v want %v", rendered, got, test.raw)
+			}
+			if !strings.Contains(rendered, "faster") {
+				t.Errorf("renderReleaseNotes() = %q, missing the notes", rendered)
+			}
+		})
+	}
+
+	stdoutTerminal = func() bool { return false }
+	if label := plainColor(color.HiGreenString, "latest"); label != "latest" {
+		t.Errorf("plainColor() piped = %q, want plain", label)
+	}
+	stdoutTerminal = func() bool { return true }
+	if label := plainColor(color.HiGreenString, "latest"); label == "latest" {
+		t.Errorf("plainColor() on a terminal = %q, want colored", label)
+	}
+}
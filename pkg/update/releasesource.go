@@ -0,0 +1,381 @@
+package updateutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v30/github"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"github.com/wjlin0/CVE-2024-23897/pkg/credential"
+)
+
+// ReleaseSource is the forge hosting the releases of a repo. Releases of every forge are converted to
+// the github model, so the tag, the release notes body and the assets are read the same way
+type ReleaseSource interface {
+	// Release fetches the release tagged tag, the latest one when tag is empty. It returns the release,
+	// the api response it was decoded from and the http response, which may be set along an error
+	Release(ctx context.Context, tag string) (*github.RepositoryRelease, json.RawMessage, *http.Response, error)
+	// DownloadAsset requests the asset id of release, the status of the response is not checked
+	DownloadAsset(ctx context.Context, release *github.RepositoryRelease, id int64) (*http.Response, error)
+	// DownloadSource requests the zip archive of the source of release, the status of the response is not checked
+	DownloadSource(ctx context.Context, release *github.RepositoryRelease) (*http.Response, error)
+	// Tags lists the tags of the most recent releases, newest first, drafts excluded
+	Tags(ctx context.Context) ([]string, *http.Response, error)
+}
+
+// maxListedReleases is the number of releases listed by Tags
+const maxListedReleases = 100
+
+// releaseTag is the fields of the listed releases read by Tags and the aggregated release notes, they are
+// named the same by every forge but the notes, the description of the gitlab releases
+type releaseTag struct {
+	TagName     string `json:"tag_name"`
+	Draft       bool   `json:"draft"`
+	Prerelease  bool   `json:"prerelease"`
+	Body        string `json:"body"`
+	Description string `json:"description"`
+}
+
+// notes returns the release notes of the listed release
+func (r releaseTag) notes() string {
+	if r.Body != "" {
+		return r.Body
+	}
+	return r.Description
+}
+
+// releaseLister is implemented by the sources listing their most recent releases with their notes, newest
+// first. The release notes of the other sources are not aggregated
+type releaseLister interface {
+	releases(ctx context.Context) ([]releaseTag, *http.Response, error)
+}
+
+// tagNames returns the tags of releases which are not drafts
+func tagNames(releases []releaseTag) []string {
+	tags := make([]string, 0, len(releases))
+	for _, release := range releases {
+		if !release.Draft {
+			tags = append(tags, release.TagName)
+		}
+	}
+	return tags
+}
+
+// maxReleaseSize is the maximum size of an api response of a release
+const maxReleaseSize = 8 << 20
+
+// githubSource reads the releases of a github repo
+type githubSource struct {
+	client       *github.Client
+	httpClient   *http.Client
+	organization string
+	repoName     string
+}
+
+func (s *githubSource) Release(ctx context.Context, tag string) (*github.RepositoryRelease, json.RawMessage, *http.Response, error) {
+	endpoint := "latest"
+	if tag != "" {
+		endpoint = "tags/" + url.PathEscape(tag)
+	}
+	req, err := s.client.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/releases/%s", s.organization, s.repoName, endpoint), nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// 最新版本未变化时复用上次的响应
+	var cached *latestRelease
+	conditional := tag == "" && !etagDisabled()
+	if conditional {
+		if cached = readLatestRelease(req.URL.String()); cached != nil {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+	}
+	var raw json.RawMessage
+	resp, err := s.client.Do(ctx, req, &raw)
+	switch {
+	case cached != nil && resp != nil && resp.StatusCode == http.StatusNotModified:
+		updateLog.Verbose().Label("updater").Msgf("latest release of %v/%v not modified, using the cached response", s.organization, s.repoName)
+		raw = cached.Release
+	case err != nil:
+		return nil, nil, responseOf(resp), err
+	case tag == "":
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			writeLatestRelease(req.URL.String(), etag, raw)
+		}
+	}
+	release := &github.RepositoryRelease{}
+	if err := json.Unmarshal(raw, release); err != nil {
+		return nil, nil, resp.Response, errorutil.NewWithErr(err).Msgf("invalid release of %v/%v", s.organization, s.repoName)
+	}
+	return release, raw, resp.Response, nil
+}
+
+func (s *githubSource) DownloadAsset(ctx context.Context, _ *github.RepositoryRelease, id int64) (*http.Response, error) {
+	// api 返回预签名的下载地址
+	_, rdurl, err := s.client.Repositories.DownloadReleaseAsset(ctx, s.organization, s.repoName, id, nil)
+	if err != nil {
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) {
+			return errResp.Response, err
+		}
+		return nil, err
+	}
+	return getURL(ctx, s.httpClient, rdurl)
+}
+
+func (s *githubSource) DownloadSource(ctx context.Context, release *github.RepositoryRelease) (*http.Response, error) {
+	archiveURL := release.GetZipballURL()
+	if archiveURL == "" {
+		archiveURL = githubArchiveURL(s.client.BaseURL, s.organization, s.repoName, release.GetTagName())
+	}
+	return getURL(ctx, s.httpClient, archiveURL)
+}
+
+func (s *githubSource) Tags(ctx context.Context) ([]string, *http.Response, error) {
+	return s.listTags(ctx, fmt.Sprintf("per_page=%d", maxListedReleases))
+}
+
+func (s *githubSource) releases(ctx context.Context) ([]releaseTag, *http.Response, error) {
+	return s.listReleases(ctx, fmt.Sprintf("per_page=%d", maxListedReleases))
+}
+
+// listTags lists the tags of the releases of the repo with the paging query
+func (s *githubSource) listTags(ctx context.Context, query string) ([]string, *http.Response, error) {
+	releases, resp, err := s.listReleases(ctx, query)
+	if err != nil {
+		return nil, resp, err
+	}
+	return tagNames(releases), resp, nil
+}
+
+// listReleases lists the releases of the repo with the paging query
+func (s *githubSource) listReleases(ctx context.Context, query string) ([]releaseTag, *http.Response, error) {
+	req, err := s.client.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/releases?%s", s.organization, s.repoName, query), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var releases []releaseTag
+	resp, err := s.client.Do(ctx, req, &releases)
+	if err != nil {
+		return nil, responseOf(resp), err
+	}
+	return releases, resp.Response, nil
+}
+
+// giteaSource reads the releases of a gitea or forgejo repo. Their api follows the github one under
+// /api/v1 except for the assets, which are downloaded from their browser url, and the fields github
+// only returns such as target_commitish
+type giteaSource struct {
+	githubSource
+}
+
+func (s *giteaSource) DownloadAsset(ctx context.Context, release *github.RepositoryRelease, id int64) (*http.Response, error) {
+	for _, asset := range release.Assets {
+		if asset.GetID() == id {
+			return getURL(ctx, s.httpClient, asset.GetBrowserDownloadURL())
+		}
+	}
+	return nil, errorutil.New("asset %d not in release %v of %v/%v", id, release.GetTagName(), s.organization, s.repoName)
+}
+
+func (s *giteaSource) Tags(ctx context.Context) ([]string, *http.Response, error) {
+	// gitea 使用 limit 分页, 默认最多 50 条
+	return s.listTags(ctx, "limit=50")
+}
+
+func (s *giteaSource) releases(ctx context.Context) ([]releaseTag, *http.Response, error) {
+	return s.listReleases(ctx, "limit=50")
+}
+
+// giteaURL returns the gitea instance of the gitea repos, GiteaURLEnv takes precedence over GiteaURL
+func giteaURL() string {
+	if giteaURL := strings.TrimSpace(os.Getenv(GiteaURLEnv)); giteaURL != "" {
+		return giteaURL
+	}
+	return GiteaURL
+}
+
+// SetReleaseSource makes forge the forge of the repo specs without a scheme. baseURL is the instance
+// of gitlab or gitea, or the api url of a github enterprise server, the default instance when empty.
+// A token replaces the credential of forge. SourceEnv and GiteaURLEnv still take precedence
+func SetReleaseSource(forge, baseURL, token string) error {
+	forge = strings.ToLower(forge)
+	switch forge {
+	case SourceGitHub, SourceGitLab, SourceGitea:
+	default:
+		return errorutil.NewWithTag("updater", "unknown release source %v, expected %v, %v or %v", forge, SourceGitHub, SourceGitLab, SourceGitea)
+	}
+	if baseURL != "" {
+		parsed, err := url.Parse(baseURL)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return errorutil.NewWithTag("updater", "invalid %v url %v", forge, baseURL)
+		}
+		switch forge {
+		case SourceGitHub:
+			if err := SetGitHubBaseURL(baseURL, ""); err != nil {
+				return err
+			}
+		case SourceGitLab:
+			GitLabURL = baseURL
+		case SourceGitea:
+			GiteaURL = baseURL
+		}
+	} else if forge == SourceGitea && giteaURL() == "" {
+		return errorutil.NewWithTag("updater", "gitea has no default instance, set its url or %v", GiteaURLEnv)
+	}
+	if token != "" {
+		credential.Default.Select(forgeCredential(forge), &credential.Static{Value: token})
+	}
+	DefaultSource = forge
+	return nil
+}
+
+// gitlabSource reads the releases of a gitlab project with the Releases API
+type gitlabSource struct {
+	baseURL    *url.URL
+	project    string // group/project, groups may be nested
+	client     *http.Client
+	httpClient *http.Client
+}
+
+// gitlabRelease is the subset of a release of the gitlab api used by the updater
+type gitlabRelease struct {
+	TagName     string     `json:"tag_name"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	CreatedAt   *time.Time `json:"created_at"`
+	ReleasedAt  *time.Time `json:"released_at"`
+	Assets      struct {
+		Sources []struct {
+			Format string `json:"format"`
+			URL    string `json:"url"`
+		} `json:"sources"`
+		Links []struct {
+			ID             int64  `json:"id"`
+			Name           string `json:"name"`
+			URL            string `json:"url"`
+			DirectAssetURL string `json:"direct_asset_url"`
+		} `json:"links"`
+	} `json:"assets"`
+	Links struct {
+		Self string `json:"self"`
+	} `json:"_links"`
+}
+
+// toGitHub converts the release to the github model. Gitlab releases have no id, the asset links have
+// ids but no size
+func (r *gitlabRelease) toGitHub() *github.RepositoryRelease {
+	release := &github.RepositoryRelease{
+		TagName: github.String(r.TagName),
+		Name:    github.String(r.Name),
+		Body:    github.String(r.Description),
+		HTMLURL: github.String(r.Links.Self),
+	}
+	if r.ReleasedAt != nil {
+		release.PublishedAt = &github.Timestamp{Time: *r.ReleasedAt}
+	}
+	if r.CreatedAt != nil {
+		release.CreatedAt = &github.Timestamp{Time: *r.CreatedAt}
+	}
+	for _, source := range r.Assets.Sources {
+		if source.Format == "zip" {
+			release.ZipballURL = github.String(source.URL)
+		}
+	}
+	for _, link := range r.Assets.Links {
+		downloadURL := link.DirectAssetURL
+		if downloadURL == "" {
+			downloadURL = link.URL
+		}
+		release.Assets = append(release.Assets, &github.ReleaseAsset{
+			ID:                 github.Int64(link.ID),
+			Name:               github.String(link.Name),
+			BrowserDownloadURL: github.String(downloadURL),
+		})
+	}
+	return release
+}
+
+func (s *gitlabSource) Release(ctx context.Context, tag string) (*github.RepositoryRelease, json.RawMessage, *http.Response, error) {
+	endpoint := "permalink/latest"
+	if tag != "" {
+		endpoint = url.PathEscape(tag)
+	}
+	// 项目路径整体转义, 例如 group%2Fproject
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/releases/%s", strings.TrimSuffix(s.baseURL.String(), "/"), url.PathEscape(s.project), endpoint)
+	resp, err := getURL(ctx, s.client, apiURL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxReleaseSize))
+	if err != nil {
+		return nil, nil, resp, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, resp, fmt.Errorf("GET %v: %v %s", apiURL, resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	gitlab := &gitlabRelease{}
+	if err := json.Unmarshal(raw, gitlab); err != nil {
+		return nil, nil, resp, errorutil.NewWithErr(err).Msgf("invalid release of gitlab project %v", s.project)
+	}
+	return gitlab.toGitHub(), raw, resp, nil
+}
+
+func (s *gitlabSource) DownloadAsset(ctx context.Context, release *github.RepositoryRelease, id int64) (*http.Response, error) {
+	for _, asset := range release.Assets {
+		if asset.GetID() == id {
+			return getURL(ctx, s.httpClient, asset.GetBrowserDownloadURL())
+		}
+	}
+	return nil, errorutil.New("asset %d not in release %v of gitlab project %v", id, release.GetTagName(), s.project)
+}
+
+func (s *gitlabSource) DownloadSource(ctx context.Context, release *github.RepositoryRelease) (*http.Response, error) {
+	return getURL(ctx, s.httpClient, release.GetZipballURL())
+}
+
+func (s *gitlabSource) Tags(ctx context.Context) ([]string, *http.Response, error) {
+	releases, resp, err := s.releases(ctx)
+	if err != nil {
+		return nil, resp, err
+	}
+	return tagNames(releases), resp, nil
+}
+
+func (s *gitlabSource) releases(ctx context.Context) ([]releaseTag, *http.Response, error) {
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/releases?per_page=%d", strings.TrimSuffix(s.baseURL.String(), "/"), url.PathEscape(s.project), maxListedReleases)
+	resp, err := getURL(ctx, s.client, apiURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxReleaseSize))
+	if err != nil {
+		return nil, resp, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp, fmt.Errorf("GET %v: %v %s", apiURL, resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	var releases []releaseTag
+	if err := json.Unmarshal(raw, &releases); err != nil {
+		return nil, resp, errorutil.NewWithErr(err).Msgf("invalid releases of gitlab project %v", s.project)
+	}
+	return releases, resp, nil
+}
+
+// getURL sends a GET request of rawURL with client
+func getURL(ctx context.Context, client *http.Client, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,107 @@
+package updateutils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+var (
+	// RetryAttempts is the number of attempts of a github api call or download failing transiently: a
+	// network error, a 5xx or a 429 response. 1 disables the retries
+	RetryAttempts = 3
+	// RetryBackoff is the wait before the second attempt, doubled before each next one with jitter up
+	// to RetryBackoffMax
+	RetryBackoff    = 500 * time.Millisecond
+	RetryBackoffMax = 10 * time.Second
+)
+
+// errInterrupted is the kind of the errors of a download whose connection failed while reading the body
+var errInterrupted = errorutil.NewWithTag("updater", "download interrupted")
+
+// retryDelay returns the wait before the attempt following attempt, counted from 1
+func retryDelay(attempt int) time.Duration {
+	delay := RetryBackoff
+	for i := 1; i < attempt && delay < RetryBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > RetryBackoffMax {
+		delay = RetryBackoffMax
+	}
+	// 在 [delay/2, delay] 之间随机, 避免多台机器同时重试
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int63n(half+1))
+	}
+	return delay
+}
+
+// waitRetry waits before the attempt following attempt, it returns the error of ctx when done first
+func waitRetry(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// transientStatus reports whether a response with status code is worth retrying
+func transientStatus(code int) bool {
+	return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+}
+
+// networkError reports whether err is a failure of the connection rather than of the request
+func networkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// retryTransport retries the idempotent requests failing transiently, the other failures such as a
+// 404 or the 403 of the github rate limit are returned at once
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.base.RoundTrip(req)
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if req.Context().Err() != nil || attempt >= RetryAttempts {
+			return resp, err
+		}
+		var reason string
+		delay := retryDelay(attempt)
+		switch {
+		case err != nil && networkError(err):
+			reason = err.Error()
+		case err == nil && transientStatus(resp.StatusCode):
+			reason = resp.Status
+			if after, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && after > 0 {
+				delay = time.Duration(after) * time.Second
+				if delay > RetryBackoffMax {
+					delay = RetryBackoffMax
+				}
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+			_ = resp.Body.Close()
+		default:
+			return resp, err
+		}
+		updateLog.Info().Label("updater").Msgf("retrying %v in %v (%d/%d): %v", req.URL.Redacted(), delay.Round(time.Millisecond), attempt, RetryAttempts-1, reason)
+		if err := waitRetry(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package updateutils
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first requests whose path matches before passing them to the fake github
+type flakyServer struct {
+	mutex    sync.Mutex
+	match    func(path string) bool
+	failures int
+	fail     func(w http.ResponseWriter)
+	// matched counts the requests whose path matches
+	matched int
+}
+
+func (f *flakyServer) handler(fake *fakeGitHub) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		failing := false
+		if f.match(r.URL.Path) {
+			f.matched++
+			failing = f.matched <= f.failures
+		}
+		f.mutex.Unlock()
+		if failing {
+			f.fail(w)
+			return
+		}
+		fake.ServeHTTP(w, r)
+	})
+}
+
+func status(code int) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) { w.WriteHeader(code) }
+}
+
+// reset closes the connection without a response
+func reset(w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		_ = conn.Close()
+	}
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	hideProgressBar(t)
+	bin := []byte("retried binary")
+	source := zipArchive(t, map[string][]byte{"README.md": []byte("source")})
+	suffix := func(s string) func(string) bool { return func(path string) bool { return strings.HasSuffix(path, s) } }
+	prefix := func(s string) func(string) bool { return func(path string) bool { return strings.HasPrefix(path, s) } }
+	rateLimited := func(w http.ResponseWriter) {
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "4102444800")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message":"API rate limit exceeded"}`))
+	}
+	tests := []struct {
+		name     string
+		match    func(string) bool
+		failures int
+		fail     func(w http.ResponseWriter)
+		matched  int
+		wantErr  string
+	}{
+		{name: "latest release 502", match: suffix("/releases/latest"), failures: 2, fail: status(http.StatusBadGateway), matched: 3},
+		{name: "asset metadata 503", match: prefix("/api/repos/" + Organization + "/retried/releases/assets/"), failures: 2, fail: status(http.StatusServiceUnavailable), matched: 4},
+		{name: "asset connection reset", match: suffix(".tar.gz"), failures: 2, fail: reset, matched: 3},
+		{name: "source 429", match: prefix("/source/"), failures: 2, fail: status(http.StatusTooManyRequests), matched: 3},
+		{name: "attempts exhausted", match: suffix("/releases/latest"), failures: 10, fail: status(http.StatusBadGateway), matched: 3, wantErr: "502"},
+		{name: "not found fails fast", match: suffix("/releases/latest"), failures: 10, fail: status(http.StatusNotFound), matched: 1, wantErr: "not found"},
+		{name: "rate limit fails fast", match: suffix("/releases/latest"), failures: 10, fail: rateLimited, matched: 1, wantErr: "rate limit exceeded"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeGitHub(t)
+			release := newToolRelease(t, "retried", "v1.0.0", bin)
+			release.Source = source
+			fake.AddRelease(Organization+"/retried", release)
+			flaky := &flakyServer{match: test.match, failures: test.failures, fail: test.fail}
+			server := httptest.NewServer(flaky.handler(fake))
+			defer server.Close()
+			githubBaseURL, _ = url.Parse(server.URL + "/api/")
+			UpdateSourceAllowlist = append(UpdateSourceAllowlist, trustedSource(Organization+"/retried"))
+			fake.DownloadURL = server.URL
+			release.ZipballURL = server.URL + "/source/" + Organization + "/retried"
+
+			err := func() error {
+				d, err := NewghReleaseDownloader(Organization + "/retried")
+				if err != nil {
+					return err
+				}
+				d.cache = nil
+				got, err := d.GetExecutableFromAsset()
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(got, bin) {
+					t.Errorf("GetExecutableFromAsset() = %q", got)
+				}
+				got, err = d.DownloadSource(false)
+				if err == nil && !bytes.Equal(got, source) {
+					t.Errorf("DownloadSource() = %d bytes", len(got))
+				}
+				return err
+			}()
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("update = %v, want the retries to succeed", err)
+			}
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("update = %v, want an error containing %q", err, test.wantErr)
+			}
+			if flaky.matched != test.matched {
+				t.Errorf("got %d matching requests, want %d", flaky.matched, test.matched)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	backoff, max := RetryBackoff, RetryBackoffMax
+	defer func() { RetryBackoff, RetryBackoffMax = backoff, max }()
+	RetryBackoff, RetryBackoffMax = time.Second, 10*time.Second
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 1, min: 500 * time.Millisecond, max: time.Second},
+		{attempt: 2, min: time.Second, max: 2 * time.Second},
+		{attempt: 4, min: 4 * time.Second, max: 8 * time.Second},
+		{attempt: 10, min: 5 * time.Second, max: 10 * time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			if delay := retryDelay(test.attempt); delay < test.min || delay > test.max {
+				t.Fatalf("retryDelay(%d) = %v, want between %v and %v", test.attempt, delay, test.min, test.max)
+			}
+		}
+	}
+}
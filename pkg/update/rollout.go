@@ -0,0 +1,126 @@
+package updateutils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/denisbrodbeck/machineid"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// RolloutAssetName is the release asset publishing the rollout of the release, e.g. {"percent": 20}
+const RolloutAssetName = "rollout.json"
+
+var (
+	// RolloutPercent is the percentage of machines updated to a new release, negative uses the rollout
+	// published with the release and updates every machine when none is
+	RolloutPercent = -1
+	// ForceUpdate updates regardless of the rollout and reinstalls the release when the tool or the directory
+	// is already at its version, e.g. to repair a corrupted binary
+	ForceUpdate = false
+	// DisableMachineID keeps the machine id private, the rollout then uses a random id stable per install
+	DisableMachineID = false
+
+	// rolloutLine is the rollout published in the release body, e.g. "rollout: 20%"
+	rolloutLine  = regexp.MustCompile(`(?im)^[\s>*_-]*(?:<!--\s*)?rollout\s*:\s*(\d{1,3})\s*%?`)
+	installIDs   = &stateFile{name: "install-id"}
+	installMutex sync.Mutex
+)
+
+// rolloutAsset is the content of RolloutAssetName
+type rolloutAsset struct {
+	Percent *int `json:"percent"`
+}
+
+// Rollout is the decision of the rollout of a release for this machine
+type Rollout struct {
+	// Percent is the percentage of machines updated to the release
+	Percent int
+	// Bucket is the position of this machine in [0,100), machines below Percent are updated
+	Bucket int
+}
+
+// Deferred reports whether the update of this machine is deferred by the rollout
+func (r Rollout) Deferred() bool {
+	return r.Bucket >= r.Percent
+}
+
+func (r Rollout) String() string {
+	return "deferred by rollout policy (bucket " + strconv.Itoa(r.Bucket) + " not below " + strconv.Itoa(r.Percent) + "%)"
+}
+
+// installID returns the id of the machine, a random id recorded in the state dir when the machine id is
+// disabled or unavailable
+func installID() string {
+	if !DisableMachineID {
+		if id, err := machineid.ProtectedID(Repository); err == nil {
+			return id
+		}
+	}
+	installMutex.Lock()
+	defer installMutex.Unlock()
+	if data, err := installIDs.read(); err == nil && len(strings.TrimSpace(string(data))) != 0 {
+		return strings.TrimSpace(string(data))
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	_ = installIDs.write([]byte(hex.EncodeToString(id) + "\n"))
+	return hex.EncodeToString(id)
+}
+
+// rolloutBucket returns the position in [0,100) of the machine id in the rollout of the tag of source,
+// the same on every retry and a different cohort for every release
+func rolloutBucket(id, source, tag string) int {
+	sum := sha256.Sum256([]byte(id + "\x00" + source + "\x00" + tag))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+// parseRolloutPercent returns the rollout published in the release body, -1 when there is none
+func parseRolloutPercent(body string) int {
+	if match := rolloutLine.FindStringSubmatch(body); match != nil {
+		if percent, err := strconv.Atoi(match[1]); err == nil && percent <= 100 {
+			return percent
+		}
+	}
+	return -1
+}
+
+// publishedRollout returns the rollout of the latest release from its RolloutAssetName asset, then its body,
+// -1 when it publishes none
+func (d *GHReleaseDownloader) publishedRollout() (int, error) {
+	if d.HasAsset(RolloutAssetName) {
+		buff, err := d.DownloadAssetWithName(RolloutAssetName, false)
+		if err != nil {
+			return 0, errorutil.NewWithErr(err).Msgf("failed to download %v", RolloutAssetName)
+		}
+		var asset rolloutAsset
+		if err := json.Unmarshal(buff.Bytes(), &asset); err != nil || asset.Percent == nil || *asset.Percent < 0 || *asset.Percent > 100 {
+			return 0, errorutil.NewWithTag("updater", "invalid %v of release %v", RolloutAssetName, d.Latest.GetTagName())
+		}
+		return *asset.Percent, nil
+	}
+	return parseRolloutPercent(d.Latest.GetBody()), nil
+}
+
+// Rollout returns the rollout of the latest release for this machine: RolloutPercent when set, else the
+// published one, else every machine. ForceUpdate of the downloader never defers
+func (d *GHReleaseDownloader) Rollout() (Rollout, error) {
+	percent := RolloutPercent
+	if percent < 0 {
+		var err error
+		if percent, err = d.publishedRollout(); err != nil {
+			return Rollout{}, err
+		}
+	}
+	if percent < 0 || percent > 100 || resolveOptions(d.options).ForceUpdate {
+		percent = 100
+	}
+	return Rollout{Percent: percent, Bucket: rolloutBucket(installID(), d.Source(), d.Latest.GetTagName())}, nil
+}
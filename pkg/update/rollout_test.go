@@ -0,0 +1,122 @@
+package updateutils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestParseRolloutPercent(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{body: "## Changes\n\nrollout: 20%\n", want: 20},
+		{body: "Rollout: 5", want: 5},
+		{body: "<!-- rollout: 0 -->\n- fixes", want: 0},
+		{body: "> **rollout: 100%**", want: 100},
+		{body: "gradual rollout: later", want: -1},
+		{body: "rollout: 150%", want: -1},
+		{body: "", want: -1},
+	}
+	for _, test := range tests {
+		if got := parseRolloutPercent(test.body); got != test.want {
+			t.Errorf("parseRolloutPercent(%q) = %d, want %d", test.body, got, test.want)
+		}
+	}
+}
+
+func TestRolloutBucket(t *testing.T) {
+	below := 0
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("machine-%d", i)
+		bucket := rolloutBucket(id, "wjlin0/tool", "v1.1.0")
+		if bucket < 0 || bucket >= 100 {
+			t.Fatalf("rolloutBucket(%q) = %d, want [0,100)", id, bucket)
+		}
+		// 同一台机器重试时结果不变
+		if again := rolloutBucket(id, "wjlin0/tool", "v1.1.0"); again != bucket {
+			t.Fatalf("rolloutBucket(%q) = %d then %d", id, bucket, again)
+		}
+		if bucket < 20 {
+			below++
+		}
+	}
+	if below < 140 || below > 260 {
+		t.Errorf("%d of 1000 machines in a 20%% rollout", below)
+	}
+}
+
+func TestInstallIDWithoutMachineID(t *testing.T) {
+	newFakeGitHub(t)
+	disable := DisableMachineID
+	defer func() { DisableMachineID = disable }()
+	DisableMachineID = true
+	id := installID()
+	if len(id) != 32 || installID() != id {
+		t.Errorf("installID() = %q then %q, want a stable random id", id, installID())
+	}
+}
+
+func TestUpdateToolsRollout(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	percent, force := RolloutPercent, ForceUpdate
+	defer func() { RolloutPercent, ForceUpdate = percent, force }()
+	updater := &Updater{APIRequestsPerMinute: -1}
+	defer updater.Close()
+
+	tests := []struct {
+		name     string
+		body     string
+		asset    string
+		percent  int
+		force    bool
+		deferred bool
+	}{
+		{name: "unpublished", percent: -1},
+		{name: "body halted", body: "rollout: 0%", percent: -1, deferred: true},
+		{name: "forced", body: "rollout: 0%", percent: -1, force: true},
+		{name: "asset over body", body: "rollout: 0%", asset: `{"percent": 100}`, percent: -1},
+		{name: "option over asset", asset: `{"percent": 100}`, percent: 0, deferred: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			release := newToolRelease(t, "canary", "v1.1.0", []byte("bin-canary"))
+			release.Body = test.body
+			if test.asset != "" {
+				release.Assets[RolloutAssetName] = []byte(test.asset)
+			}
+			fake.AddRelease(Organization+"/canary", release)
+			RolloutPercent, ForceUpdate = test.percent, test.force
+			summary := updater.UpdateTools(context.Background(), []Tool{{Name: "canary", Version: "1.0.0"}}, t.TempDir())
+			result := summary.Results[0]
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+			if result.Deferred != test.deferred || result.Updated == test.deferred || summary.Deferred() != boolCount(test.deferred) {
+				t.Errorf("deferred = %v, updated = %v, want deferred %v", result.Deferred, result.Updated, test.deferred)
+			}
+		})
+	}
+
+	// 重试时同一台机器的结论不变
+	fake.AddRelease(Organization+"/canary", newToolRelease(t, "canary", "v1.1.0", []byte("bin-canary")))
+	RolloutPercent, ForceUpdate = 50, false
+	var first *UpdateResult
+	for i := 0; i < 3; i++ {
+		result := updater.UpdateTools(context.Background(), []Tool{{Name: "canary", Version: "1.0.0"}}, t.TempDir()).Results[0]
+		if first == nil {
+			first = result
+		} else if result.Deferred != first.Deferred || result.Rollout != first.Rollout {
+			t.Errorf("retry %d: rollout %+v deferred %v, first %+v deferred %v", i, result.Rollout, result.Deferred, first.Rollout, first.Deferred)
+		}
+	}
+}
+
+func boolCount(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,245 @@
+package updateutils
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+// SourceSignatureAssetName is the release asset holding the minisign signature of the release zipball
+var SourceSignatureAssetName = "source.zip.minisig"
+
+var (
+	// ErrUnsignedRelease is returned when signatures are required and the release has none
+	ErrUnsignedRelease = errorutil.NewWithTag("updater", "release is not signed")
+	// ErrInvalidSignature is returned when the signature doesn't match the pinned public key
+	ErrInvalidSignature = errorutil.NewWithTag("updater", "invalid release signature")
+	// ErrSignatureVerification is returned when the update verifier is set and the signature of the
+	// executable asset is missing or invalid, matched with errors.Is
+	ErrSignatureVerification = errorutil.NewWithTag("updater", "signature verification failed")
+)
+
+// signature schemes of SetUpdateVerifier
+const (
+	// SignatureMinisign verifies the <asset>.minisig minisign signature with a minisign public key
+	SignatureMinisign = "minisign"
+	// SignatureECDSA verifies the <asset>.sig ASN.1 ecdsa signature of the sha256 of the asset, raw or base64
+	// like cosign sign-blob, with a PEM or DER PKIX public key
+	SignatureECDSA = "ecdsa"
+)
+
+// assetVerifier verifies the signature of a release asset
+type assetVerifier interface {
+	// signatureAsset returns the name of the signature asset of asset
+	signatureAsset(asset string) string
+	verify(asset, signature []byte) error
+}
+
+// updateVerifier verifies the executable assets when set
+var updateVerifier assetVerifier
+
+// SetUpdateVerifier requires the executable assets of the updates and of the tools installed by the Updater
+// to be signed with publicKey, scheme being SignatureMinisign or SignatureECDSA. The signature is a release
+// asset named after the asset and is verified before the asset is unpacked, unlike the checksums file it
+// holds up when the release itself is compromised. An empty publicKey removes the verifier
+func SetUpdateVerifier(publicKey []byte, scheme string) error {
+	if len(bytes.TrimSpace(publicKey)) == 0 {
+		updateVerifier = nil
+		return nil
+	}
+	switch scheme {
+	case SignatureMinisign:
+		key, err := ParseMinisignPublicKey(string(publicKey))
+		if err != nil {
+			return err
+		}
+		updateVerifier = (*minisignVerifier)(key)
+	case SignatureECDSA:
+		key, err := parseECDSAPublicKey(publicKey)
+		if err != nil {
+			return err
+		}
+		updateVerifier = (*ecdsaVerifier)(key)
+	default:
+		return errorutil.New("unknown signature scheme %v (available: %v, %v)", scheme, SignatureMinisign, SignatureECDSA)
+	}
+	return nil
+}
+
+type minisignVerifier MinisignPublicKey
+
+func (v *minisignVerifier) signatureAsset(asset string) string {
+	return asset + ".minisig"
+}
+
+func (v *minisignVerifier) verify(asset, signature []byte) error {
+	return (*MinisignPublicKey)(v).Verify(asset, string(signature))
+}
+
+type ecdsaVerifier ecdsa.PublicKey
+
+func parseECDSAPublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	key, err := x509.ParsePKIXPublicKey(data)
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("invalid ecdsa public key")
+	}
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errorutil.New("public key is a %T, not an ecdsa key", key)
+	}
+	return ecdsaKey, nil
+}
+
+func (v *ecdsaVerifier) signatureAsset(asset string) string {
+	return asset + ".sig"
+}
+
+func (v *ecdsaVerifier) verify(asset, signature []byte) error {
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature))); err == nil {
+		signature = decoded
+	}
+	hash := sha256.Sum256(asset)
+	if !ecdsa.VerifyASN1((*ecdsa.PublicKey)(v), hash[:], signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// integrityError reports whether err refuses an asset failing its checksum or signature, such errors are
+// returned as is to be matched with errors.Is
+func integrityError(err error) bool {
+	return errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrSignatureVerification)
+}
+
+// verifySignature verifies the signature of the executable asset with the update verifier, if set
+func (d *GHReleaseDownloader) verifySignature(ctx context.Context, asset []byte) error {
+	verifier := updateVerifier
+	if verifier == nil {
+		return nil
+	}
+	name := verifier.signatureAsset(d.fullAssetName)
+	var id int64
+	for _, v := range d.Latest.Assets {
+		if v.GetName() == name {
+			id = v.GetID()
+		}
+	}
+	if id == 0 {
+		return newUpdateError(ErrSignatureVerification, "signature verification failed: release %v of %v has no %v asset", d.Latest.GetTagName(), d.Source(), name)
+	}
+	signature, err := d.downloadAsset(ctx, id, name, "", false)
+	if err != nil {
+		return newUpdateError(ErrSignatureVerification, "signature verification failed: could not download %v: %v", name, err)
+	}
+	if err := verifier.verify(asset, signature); err != nil {
+		return newUpdateError(ErrSignatureVerification, "signature verification failed: %v doesn't match %v: %v", d.fullAssetName, name, err)
+	}
+	updateLog.Info().Msgf("Verified signature of %v", d.fullAssetName)
+	return nil
+}
+
+const (
+	// minisign signature algorithms, Ed signs the message and ED its blake2b-512 hash
+	minisignAlgorithm       = "Ed"
+	minisignHashedAlgorithm = "ED"
+
+	trustedCommentPrefix = "trusted comment: "
+)
+
+// MinisignPublicKey is a minisign ed25519 public key
+type MinisignPublicKey struct {
+	KeyID [8]byte
+	Key   ed25519.PublicKey
+}
+
+// decodeMinisignLine returns the base64 line of a minisign file, skipping the untrusted comment
+func decodeMinisignLine(text string) ([]byte, []string, error) {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "untrusted comment:") {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return nil, nil, errorutil.New("empty minisign data")
+	}
+	data, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil {
+		return nil, nil, errorutil.NewWithErr(err).Msgf("invalid minisign encoding")
+	}
+	return data, lines[1:], nil
+}
+
+// ParseMinisignPublicKey parses a minisign public key file or its base64 line
+func ParseMinisignPublicKey(text string) (*MinisignPublicKey, error) {
+	data, _, err := decodeMinisignLine(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 2+8+ed25519.PublicKeySize || string(data[:2]) != minisignAlgorithm {
+		return nil, errorutil.New("unsupported minisign public key")
+	}
+	key := &MinisignPublicKey{Key: ed25519.PublicKey(data[10:])}
+	copy(key.KeyID[:], data[2:10])
+	return key, nil
+}
+
+// Verify checks the minisign signature of message including its trusted comment
+func (k *MinisignPublicKey) Verify(message []byte, signature string) error {
+	data, rest, err := decodeMinisignLine(signature)
+	if err != nil {
+		return err
+	}
+	if len(data) != 2+8+ed25519.SignatureSize || len(rest) != 2 || !strings.HasPrefix(rest[0], trustedCommentPrefix) {
+		return errorutil.New("malformed minisign signature")
+	}
+	algorithm, keyID, sig := string(data[:2]), data[2:10], data[10:]
+	if !bytes.Equal(keyID, k.KeyID[:]) {
+		return errorutil.NewWithErr(ErrInvalidSignature).Msgf("signed with key %X, pinned key is %X", reverse(keyID), reverse(k.KeyID[:]))
+	}
+	switch algorithm {
+	case minisignAlgorithm:
+	case minisignHashedAlgorithm:
+		hash := blake2b.Sum512(message)
+		message = hash[:]
+	default:
+		return errorutil.New("unsupported minisign signature algorithm %v", algorithm)
+	}
+	if !ed25519.Verify(k.Key, message, sig) {
+		return ErrInvalidSignature
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(rest[1])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errorutil.New("malformed minisign trusted comment signature")
+	}
+	trusted := append(append([]byte{}, sig...), strings.TrimPrefix(rest[0], trustedCommentPrefix)...)
+	if !ed25519.Verify(k.Key, trusted, globalSig) {
+		return errorutil.NewWithErr(ErrInvalidSignature).Msgf("trusted comment signature mismatch")
+	}
+	return nil
+}
+
+// reverse returns the key id as displayed by minisign, which prints it little endian
+func reverse(keyID []byte) []byte {
+	out := make([]byte, len(keyID))
+	for i := range keyID {
+		out[len(keyID)-1-i] = keyID[i]
+	}
+	return out
+}
@@ -0,0 +1,226 @@
+package updateutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisignKey is a test minisign key pair
+type minisignKey struct {
+	keyID   [8]byte
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+func newMinisignKey(t *testing.T) *minisignKey {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &minisignKey{private: private, public: public}
+	_, _ = rand.Read(key.keyID[:])
+	return key
+}
+
+// PublicKey returns the key in the minisign public key file format
+func (k *minisignKey) PublicKey() string {
+	data := append(append([]byte(minisignAlgorithm), k.keyID[:]...), k.public...)
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(data) + "\n"
+}
+
+// Sign returns a minisign signature of message, prehashed like minisign does by default when hashed is set
+func (k *minisignKey) Sign(message []byte, hashed bool) string {
+	algorithm := minisignAlgorithm
+	if hashed {
+		algorithm = minisignHashedAlgorithm
+		hash := blake2b.Sum512(message)
+		message = hash[:]
+	}
+	sig := ed25519.Sign(k.private, message)
+	comment := "timestamp:1700000000\tfile:templates.zip"
+	globalSig := ed25519.Sign(k.private, append(append([]byte{}, sig...), comment...))
+	return "untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), k.keyID[:]...), sig...)) + "\n" +
+		trustedCommentPrefix + comment + "\n" +
+		base64.StdEncoding.EncodeToString(globalSig) + "\n"
+}
+
+func TestMinisignVerify(t *testing.T) {
+	signer, other := newMinisignKey(t), newMinisignKey(t)
+	message := []byte("templates zipball")
+	key, err := ParseMinisignPublicKey(signer.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := signer.Sign(message, true)
+	tampered = tampered[:len(tampered)-10] + "AAAAAAAAA\n"
+
+	tests := []struct {
+		name      string
+		message   []byte
+		signature string
+		valid     bool
+	}{
+		{name: "legacy", message: message, signature: signer.Sign(message, false), valid: true},
+		{name: "prehashed", message: message, signature: signer.Sign(message, true), valid: true},
+		{name: "modified message", message: []byte("templates zipball!"), signature: signer.Sign(message, true)},
+		{name: "other key", message: message, signature: other.Sign(message, true)},
+		{name: "tampered trusted comment signature", message: message, signature: tampered},
+		{name: "garbage", message: message, signature: "not a signature"},
+	}
+	for _, test := range tests {
+		err := key.Verify(test.message, test.signature)
+		if (err == nil) != test.valid {
+			t.Errorf("Verify(%s) = %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestUpdateDirFromRepoSignature(t *testing.T) {
+	signer, other := newMinisignKey(t), newMinisignKey(t)
+	signed := newTemplatesRelease(t)
+	signed.Assets = map[string][]byte{SourceSignatureAssetName: []byte(signer.Sign(signed.Source, true))}
+	forged := newTemplatesRelease(t)
+	forged.Assets = map[string][]byte{SourceSignatureAssetName: []byte(other.Sign(forged.Source, true))}
+
+	tests := []struct {
+		name    string
+		release *fakeRelease
+		opts    *DirUpdateOptions
+		err     error
+	}{
+		{name: "signed", release: signed, opts: &DirUpdateOptions{PublicKey: signer.PublicKey(), RequireSigned: true}},
+		{name: "unsigned optional", release: newTemplatesRelease(t), opts: &DirUpdateOptions{PublicKey: signer.PublicKey()}},
+		{name: "unsigned required", release: newTemplatesRelease(t), opts: &DirUpdateOptions{PublicKey: signer.PublicKey(), RequireSigned: true}, err: ErrUnsignedRelease},
+		{name: "required without key", release: signed, opts: &DirUpdateOptions{RequireSigned: true}, err: ErrUnsignedRelease},
+		{name: "forged", release: forged, opts: &DirUpdateOptions{PublicKey: signer.PublicKey()}, err: ErrInvalidSignature},
+	}
+	for _, test := range tests {
+		fake := newFakeGitHub(t)
+		fake.AddRelease(Organization+"/templates", test.release)
+		dir := t.TempDir()
+
+		_, err := UpdateDirFromRepo("templates", dir, "", test.opts)
+		if test.err == nil && err != nil {
+			t.Errorf("UpdateDirFromRepo(%s) failed: %v", test.name, err)
+			continue
+		}
+		if test.err != nil {
+			if err == nil || !strings.Contains(err.Error(), test.err.Error()) {
+				t.Errorf("UpdateDirFromRepo(%s) = %v, want %v", test.name, err, test.err)
+			}
+			// 校验失败时不应解压任何文件
+			if _, statErr := os.Stat(filepath.Join(dir, "cves/new.yaml")); !os.IsNotExist(statErr) {
+				t.Errorf("UpdateDirFromRepo(%s) extracted an unverified release", test.name)
+			}
+		}
+	}
+}
+
+func TestUpdateVerifier(t *testing.T) {
+	hideProgressBar(t)
+	hideReleaseNotes := HideReleaseNotes
+	HideReleaseNotes = true
+	defer func() { HideReleaseNotes = hideReleaseNotes }()
+	signer, other := newMinisignKey(t), newMinisignKey(t)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&ecdsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaPublic := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	ecdsaSign := func(asset []byte) []byte {
+		hash := sha256.Sum256(asset)
+		sig, err := ecdsa.SignASN1(rand.Reader, ecdsaKey, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []byte(base64.StdEncoding.EncodeToString(sig))
+	}
+	assetName := platformAssetName("chaos", "v1.1.0", Tar)
+
+	tests := []struct {
+		name      string
+		publicKey []byte
+		scheme    string
+		// sign returns the signature assets of the executable asset
+		sign       func(asset []byte) map[string][]byte
+		err        error
+		wantBinary string
+	}{
+		{name: "no verifier", wantBinary: "bin-chaos"},
+		{name: "minisign", publicKey: []byte(signer.PublicKey()), scheme: SignatureMinisign, wantBinary: "bin-chaos",
+			sign: func(asset []byte) map[string][]byte {
+				return map[string][]byte{assetName + ".minisig": []byte(signer.Sign(asset, true))}
+			}},
+		{name: "minisign forged", publicKey: []byte(signer.PublicKey()), scheme: SignatureMinisign, err: ErrSignatureVerification, wantBinary: "old",
+			sign: func(asset []byte) map[string][]byte {
+				return map[string][]byte{assetName + ".minisig": []byte(other.Sign(asset, true))}
+			}},
+		{name: "minisign missing", publicKey: []byte(signer.PublicKey()), scheme: SignatureMinisign, err: ErrSignatureVerification, wantBinary: "old"},
+		{name: "ecdsa", publicKey: ecdsaPublic, scheme: SignatureECDSA, wantBinary: "bin-chaos",
+			sign: func(asset []byte) map[string][]byte { return map[string][]byte{assetName + ".sig": ecdsaSign(asset)} }},
+		{name: "ecdsa of another asset", publicKey: ecdsaPublic, scheme: SignatureECDSA, err: ErrSignatureVerification, wantBinary: "old",
+			sign: func(asset []byte) map[string][]byte {
+				return map[string][]byte{assetName + ".sig": ecdsaSign([]byte("other"))}
+			}},
+	}
+	defer func() { _ = SetUpdateVerifier(nil, "") }()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := SetUpdateVerifier(test.publicKey, test.scheme); err != nil {
+				t.Fatal(err)
+			}
+			release := newToolRelease(t, "chaos", "v1.1.0", []byte("bin-chaos"))
+			if test.sign != nil {
+				for name, signature := range test.sign(release.Assets[assetName]) {
+					release.Assets[name] = signature
+				}
+			}
+			fake := newFakeGitHub(t)
+			fake.AddRelease(Organization+"/chaos", release)
+			target := fakeExecutable(t, "chaos")
+
+			errs := make(chan error)
+			go func() { errs <- GetUpdateToolCallbackWithError("chaos", "1.0.0")() }()
+			if err := <-errs; !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("update = %v, want %v", err, test.err)
+			}
+			if data, _ := os.ReadFile(target); string(data) != test.wantBinary {
+				t.Errorf("executable = %q, want %q", data, test.wantBinary)
+			}
+		})
+	}
+}
+
+func TestSetUpdateVerifier(t *testing.T) {
+	defer func() { _ = SetUpdateVerifier(nil, "") }()
+	for _, test := range []struct {
+		publicKey string
+		scheme    string
+	}{
+		{publicKey: "not a key", scheme: SignatureMinisign},
+		{publicKey: newMinisignKey(t).PublicKey(), scheme: SignatureECDSA},
+		{publicKey: newMinisignKey(t).PublicKey(), scheme: "gpg"},
+	} {
+		if err := SetUpdateVerifier([]byte(test.publicKey), test.scheme); err == nil {
+			t.Errorf("SetUpdateVerifier(%q, %v) accepted an invalid key", test.publicKey, test.scheme)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package updateutils
+
+import (
+	"net/url"
+	"os"
+	"strings"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// Repository is the repo of the tool under Organization
+const Repository = "CVE-2024-23897"
+
+// OrganizationEnv is the environment variable overriding DefaultOrganization, redirecting the updates
+// of a built binary to a fork
+const OrganizationEnv = "UPDATE_ORG"
+
+// SourceEnv is the environment variable overriding DefaultSource and GiteaURLEnv the one overriding
+// GiteaURL, e.g. to update air-gapped machines from an internal mirror
+const (
+	SourceEnv   = "UPDATE_SOURCE"
+	GiteaURLEnv = "GITEA_URL"
+)
+
+// forges of the releases, a repo spec selects one with its scheme, e.g. gitlab://group/project
+const (
+	SourceGitHub = "github"
+	SourceGitLab = "gitlab"
+	// SourceGitea are gitea and forgejo instances
+	SourceGitea = "gitea"
+)
+
+var (
+	// DefaultSource is the forge of the repo specs without a scheme
+	DefaultSource = SourceGitHub
+	// GitLabURL is the gitlab instance of the gitlab repos, e.g. a self-hosted one
+	GitLabURL = "https://gitlab.com"
+	// GiteaURL is the gitea or forgejo instance of the gitea repos, it has no default
+	GiteaURL = ""
+	// DefaultOrganization is the organization of the repo names without one, e.g. of a fork
+	DefaultOrganization = Organization
+	// UpdateSourceAllowlist are the org/repo sources releases may be downloaded from, nil allows
+	// DefaultUpdateSource on the default host only. Names are compared case-insensitively as on github,
+	// gitlab and gitea sources are written gitlab://group/project and gitea://host/owner/repo. Sources on
+	// another host than github.com or gitlab.com are prefixed by the host, e.g.
+	// github.internal.example.com/acme/tool or gitlab://gitlab.example.com/group/project
+	UpdateSourceAllowlist []string
+	// InsecureAllowAnyRepo allows releases of repos outside UpdateSourceAllowlist
+	InsecureAllowAnyRepo = false
+	// ErrUntrustedUpdateSource is returned when the repo of an update is not allowlisted
+	ErrUntrustedUpdateSource = errorutil.NewWithTag("updater", "update source is not allowlisted")
+)
+
+// DefaultUpdateSource returns the org/repo of the tool under the default organization on the default forge
+func DefaultUpdateSource() string {
+	return sourceName(defaultSource(), defaultOrganization(), Repository)
+}
+
+// defaultSource returns the forge of the repo specs without a scheme, SourceEnv takes precedence over
+// DefaultSource
+func defaultSource() string {
+	if forge := strings.ToLower(strings.TrimSpace(os.Getenv(SourceEnv))); forge != "" {
+		return forge
+	}
+	if DefaultSource != "" {
+		return DefaultSource
+	}
+	return SourceGitHub
+}
+
+// defaultOrganization returns the organization of the repo names without one, OrganizationEnv takes
+// precedence over DefaultOrganization
+func defaultOrganization() string {
+	if org := strings.TrimSpace(os.Getenv(OrganizationEnv)); org != "" {
+		return org
+	}
+	if DefaultOrganization != "" {
+		return DefaultOrganization
+	}
+	return Organization
+}
+
+// parseRepoName returns the organization and repo of a repo name, the default organization when it has none
+func parseRepoName(RepoName string) (orgName, repoName string, err error) {
+	if !strings.Contains(RepoName, "/") {
+		return defaultOrganization(), RepoName, nil
+	}
+	arr := strings.Split(RepoName, "/")
+	if len(arr) != 2 {
+		return "", "", errorutil.NewWithTag("update", "invalid repo name %v", RepoName)
+	}
+	if arr[0] == "" {
+		return "", "", errorutil.NewWithTag("update", "organization name cannot be empty")
+	}
+	return arr[0], arr[1], nil
+}
+
+// parseSource returns the forge, the organization and the repo of a repo spec. The forge is the scheme
+// of the spec, github://, gitlab:// or gitea://, the default one without. Gitlab organizations are
+// groups, which may be nested
+func parseSource(spec string) (forge, orgName, repoName string, err error) {
+	forge = defaultSource()
+	if scheme, rest, ok := strings.Cut(spec, "://"); ok {
+		forge, spec = strings.ToLower(scheme), rest
+	}
+	switch forge {
+	case SourceGitHub, SourceGitea:
+		orgName, repoName, err = parseRepoName(spec)
+		return forge, orgName, repoName, err
+	case SourceGitLab:
+		if !strings.Contains(spec, "/") {
+			return forge, defaultOrganization(), spec, nil
+		}
+		for _, part := range strings.Split(spec, "/") {
+			if part == "" || part == "." || part == ".." {
+				return "", "", "", errorutil.NewWithTag("update", "invalid gitlab project %v", spec)
+			}
+		}
+		i := strings.LastIndex(spec, "/")
+		return forge, spec[:i], spec[i+1:], nil
+	default:
+		return "", "", "", errorutil.NewWithTag("update", "unknown release source %v, expected %v, %v or %v", forge, SourceGitHub, SourceGitLab, SourceGitea)
+	}
+}
+
+// sourceName returns the source of a repo as written in the allowlist: org/repo on github and
+// forge://org/repo on the other forges
+func sourceName(forge, orgName, repoName string) string {
+	if forge != SourceGitHub {
+		return forge + "://" + orgName + "/" + repoName
+	}
+	return orgName + "/" + repoName
+}
+
+// defaultHosts are the hosts of the forges whose sources are allowlisted without a host
+var defaultHosts = map[string]string{SourceGitHub: "github.com", SourceGitLab: "gitlab.com"}
+
+// sourceHost returns the host the releases of forge are downloaded from, empty when it is not set
+func sourceHost(forge string) string {
+	switch forge {
+	case SourceGitHub:
+		host, _ := githubHost()
+		return host
+	case SourceGitLab:
+		if instance, err := url.Parse(GitLabURL); err == nil {
+			return instance.Host
+		}
+	case SourceGitea:
+		if instance, err := url.Parse(giteaURL()); err == nil {
+			return instance.Host
+		}
+	}
+	return ""
+}
+
+// sourceIdentity returns the source of a repo as compared with the allowlist: its sourceName, prefixed by
+// the host of the forge unless it is the default one, e.g. github.internal.example.com/acme/tool
+func sourceIdentity(forge, orgName, repoName string) string {
+	name := sourceName(forge, orgName, repoName)
+	host := sourceHost(forge)
+	// gitlab 的群组名可以包含点, 以点开头的群组同样带上主机, 与其他主机的项目区分
+	group, _, _ := strings.Cut(orgName, "/")
+	if host == "" || strings.EqualFold(host, defaultHosts[forge]) && !(forge == SourceGitLab && strings.Contains(group, ".")) {
+		return name
+	}
+	if forge == SourceGitHub {
+		return host + "/" + name
+	}
+	return forge + "://" + host + "/" + orgName + "/" + repoName
+}
+
+// allowlisted reports whether the source identity is in the update source allowlist
+func allowlisted(identity string) bool {
+	allowlist := UpdateSourceAllowlist
+	if allowlist == nil {
+		allowlist = []string{DefaultUpdateSource()}
+	}
+	for _, allowed := range allowlist {
+		if strings.EqualFold(allowed, identity) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnforceUpdateSource returns the source of the repo spec repoName, with ErrUntrustedUpdateSource when
+// its identity on the host of the forge is not allowlisted unless InsecureAllowAnyRepo is set
+func EnforceUpdateSource(repoName string) (string, error) {
+	source, _, err := enforceUpdateSource(repoName)
+	return source, err
+}
+
+// enforceUpdateSource is EnforceUpdateSource also returning the identity of the source
+func enforceUpdateSource(repoName string) (source, identity string, err error) {
+	forge, orgName, repo, err := parseSource(repoName)
+	if err != nil {
+		return "", "", err
+	}
+	source, identity = sourceName(forge, orgName, repo), sourceIdentity(forge, orgName, repo)
+	if !allowlisted(identity) && !InsecureAllowAnyRepo {
+		return source, identity, errorutil.NewWithErr(ErrUntrustedUpdateSource).Msgf("%v is not an allowed update source, set InsecureAllowAnyRepo to update from it", identity)
+	}
+	return source, identity, nil
+}
@@ -0,0 +1,129 @@
+package updateutils
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnforceUpdateSource(t *testing.T) {
+	tests := []struct {
+		repoName string
+		source   string
+		trusted  bool
+	}{
+		{repoName: Repository, source: DefaultUpdateSource(), trusted: true},
+		{repoName: DefaultUpdateSource(), source: DefaultUpdateSource(), trusted: true},
+		{repoName: strings.ToUpper(DefaultUpdateSource()), source: strings.ToUpper(DefaultUpdateSource()), trusted: true},
+		{repoName: "attacker/" + Repository, source: "attacker/" + Repository},
+		{repoName: Organization + "/other-tool", source: Organization + "/other-tool"},
+		{repoName: "evil-fork", source: Organization + "/evil-fork"},
+		{repoName: Organization + "/" + Repository + "/../evil"},
+		{repoName: "/" + Repository},
+	}
+	for _, test := range tests {
+		source, err := EnforceUpdateSource(test.repoName)
+		if source != test.source {
+			t.Errorf("EnforceUpdateSource(%q) source = %q, want %q", test.repoName, source, test.source)
+		}
+		if test.trusted != (err == nil) {
+			t.Errorf("EnforceUpdateSource(%q) = %v, want trusted %v", test.repoName, err, test.trusted)
+		}
+	}
+}
+
+func TestParseRepoName(t *testing.T) {
+	tests := []struct {
+		repoName string
+		org      string
+		env      string
+		want     string
+	}{
+		{repoName: "mytool", want: Organization + "/mytool"},
+		{repoName: "acme/mytool", want: "acme/mytool"},
+		{repoName: "mytool", org: "acme", want: "acme/mytool"},
+		// 环境变量优先于 DefaultOrganization
+		{repoName: "mytool", org: "acme", env: "fork", want: "fork/mytool"},
+		{repoName: "mytool", env: "fork", want: "fork/mytool"},
+		{repoName: "other/mytool", org: "acme", env: "fork", want: "other/mytool"},
+	}
+	for _, test := range tests {
+		t.Setenv(OrganizationEnv, test.env)
+		DefaultOrganization = Organization
+		if test.org != "" {
+			DefaultOrganization = test.org
+		}
+		org, repo, err := parseRepoName(test.repoName)
+		if err != nil || org+"/"+repo != test.want {
+			t.Errorf("parseRepoName(%q) with org %q env %q = %s/%s, %v, want %s", test.repoName, test.org, test.env, org, repo, err, test.want)
+		}
+	}
+	DefaultOrganization = Organization
+}
+
+// TestForkOrganization updates from the release of a fork in the organization set by OrganizationEnv
+func TestForkOrganization(t *testing.T) {
+	t.Setenv(OrganizationEnv, "acme")
+	UpdateSourceAllowlist = nil
+	defer func() { UpdateSourceAllowlist = nil }()
+	// 默认只允许默认主机上的 fork
+	if source, err := EnforceUpdateSource(Repository); err != nil || source != "acme/"+Repository {
+		t.Fatalf("EnforceUpdateSource(%q) = %q, %v, want the allowlisted fork", Repository, source, err)
+	}
+	fake := newFakeGitHub(t)
+	UpdateSourceAllowlist = nil
+	if _, err := EnforceUpdateSource(Repository); err == nil || !strings.Contains(err.Error(), ErrUntrustedUpdateSource.Error()) {
+		t.Fatalf("EnforceUpdateSource(%q) on %v = %v, want %v", Repository, fake.URL, err, ErrUntrustedUpdateSource)
+	}
+	fake.AddRelease("acme/"+Repository, newToolRelease(t, Repository, "v1.1.0", []byte("fork")))
+	d, err := NewghReleaseDownloader(Repository)
+	if err != nil {
+		t.Fatalf("NewghReleaseDownloader(%q) = %v", Repository, err)
+	}
+	if d.Source() != "acme/"+Repository {
+		t.Errorf("NewghReleaseDownloader(%q) source = %q, want acme/%s", Repository, d.Source(), Repository)
+	}
+}
+
+// TestSpoofedRepoName proves a repo name pointing at another repo can't redirect the update
+// source, no api request reaches the spoofed repo unless InsecureAllowAnyRepo is set
+func TestSpoofedRepoName(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(DefaultUpdateSource(), newToolRelease(t, Repository, "v1.1.0", []byte("genuine")))
+	fake.AddUntrustedRelease("attacker/"+Repository, newToolRelease(t, Repository, "v9.9.9", []byte("malicious")))
+	tool := Tool{Name: Repository, Repo: "attacker/" + Repository, Version: "1.0.0"}
+
+	if _, err := NewghReleaseDownloader(tool.Repo); err == nil || !strings.Contains(err.Error(), ErrUntrustedUpdateSource.Error()) {
+		t.Fatalf("NewghReleaseDownloader(%q) = %v, want %v", tool.Repo, err, ErrUntrustedUpdateSource)
+	}
+	updater := &Updater{APIRequestsPerMinute: -1}
+	defer updater.Close()
+	dir := t.TempDir()
+	result := updater.UpdateTools(context.Background(), []Tool{tool}, dir).Results[0]
+	if result.Err == nil || !strings.Contains(result.Err.Error(), ErrUntrustedUpdateSource.Error()) {
+		t.Fatalf("UpdateTools() err = %v, want %v", result.Err, ErrUntrustedUpdateSource)
+	}
+	if result.Source != tool.Repo || result.Updated {
+		t.Errorf("UpdateTools() = source %q updated %v, want source %q not updated", result.Source, result.Updated, tool.Repo)
+	}
+	if requests := fake.apiRequests.Load(); requests != 0 {
+		t.Errorf("fake github got %d api requests, want none", requests)
+	}
+	if _, err := os.Stat(filepath.Join(dir, Repository)); !os.IsNotExist(err) {
+		t.Errorf("untrusted release was installed: %v", err)
+	}
+
+	InsecureAllowAnyRepo = true
+	defer func() { InsecureAllowAnyRepo = false }()
+	result = updater.UpdateTools(context.Background(), []Tool{tool}, dir).Results[0]
+	if result.Err != nil || !result.Updated || result.Source != tool.Repo {
+		t.Fatalf("UpdateTools() with InsecureAllowAnyRepo = %+v", result)
+	}
+	if bin, err := os.ReadFile(result.Path); err != nil || !bytes.Equal(bin, []byte("malicious")) {
+		t.Errorf("installed %q, %v", bin, err)
+	}
+}
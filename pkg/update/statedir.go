@@ -0,0 +1,135 @@
+package updateutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"github.com/wjlin0/CVE-2024-23897/pkg/atomicfile"
+)
+
+var (
+	// ErrReadOnlyInstall is returned when the directory an executable is installed into can't be written,
+	// e.g. the read-only root filesystem of a container
+	ErrReadOnlyInstall = errorutil.NewWithTag("updater", "install directory is read-only")
+
+	stateDirMutex sync.Mutex
+	stateDirs     = make(map[string]string)
+)
+
+// writableDir checks a file can be created in dir
+func writableDir(dir string) error {
+	probe, err := os.CreateTemp(dir, ".write-probe-*")
+	if err != nil {
+		return err
+	}
+	_ = probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// isReadOnly reports whether err is the error of writing to a read-only filesystem or a directory without write permission
+func isReadOnly(err error) bool {
+	return errors.Is(err, syscall.EROFS) || os.IsPermission(err)
+}
+
+// CheckInstallDir returns ErrReadOnlyInstall when executables can't be written to dir
+func CheckInstallDir(dir string) error {
+	err := writableDir(dir)
+	switch {
+	case err == nil:
+		return nil
+	case isReadOnly(err):
+		return errorutil.NewWithErr(ErrReadOnlyInstall).Msgf("can't write to %v (%v), rebuild the image with the new release or install it into a writable directory with Updater.UpdateTools", dir, err)
+	default:
+		return errorutil.NewWithErr(err).Msgf("can't install into %v", dir)
+	}
+}
+
+// stateDirCandidates returns the directories the caches and records of the updater may be kept in, by preference
+func stateDirCandidates() []string {
+	if AssetCacheDir != "" {
+		return []string{AssetCacheDir}
+	}
+	var candidates []string
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, Repository, "assets"))
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, Repository, "assets"))
+	}
+	return append(candidates, filepath.Join(os.TempDir(), Repository, "assets"))
+}
+
+// StateDir returns the directory the caches and records of the updater are kept in: AssetCacheDir when set,
+// else the first writable of $XDG_STATE_HOME, the user cache dir and the temp dir. Empty when none can be
+// written, they are then kept in memory for the process
+func StateDir() string {
+	candidates := stateDirCandidates()
+	key := strings.Join(candidates, string(os.PathListSeparator))
+	stateDirMutex.Lock()
+	defer stateDirMutex.Unlock()
+	if dir, ok := stateDirs[key]; ok {
+		return dir
+	}
+	dir := ""
+	for _, candidate := range candidates {
+		err := os.MkdirAll(candidate, 0700)
+		if err == nil {
+			err = writableDir(candidate)
+		}
+		if err != nil {
+			updateLog.Debug().Label("updater").Msgf("state directory %v is not usable: %v", candidate, err)
+			continue
+		}
+		dir = candidate
+		break
+	}
+	if dir == "" {
+		updateLog.Warning().Label("updater").Msgf("no writable state directory, keeping the updater caches in memory")
+	}
+	stateDirs[key] = dir
+	return dir
+}
+
+// stateFile is a record of the state dir, kept in memory for the process when no state dir is writable
+type stateFile struct {
+	name   string
+	mutex  sync.Mutex
+	memory []byte
+}
+
+// path returns the file of the record, empty when it is kept in memory
+func (f *stateFile) path() string {
+	if dir := StateDir(); dir != "" {
+		return filepath.Join(dir, f.name)
+	}
+	return ""
+}
+
+// read returns the content of the record, an error satisfying os.IsNotExist when there is none
+func (f *stateFile) read() ([]byte, error) {
+	if path := f.path(); path != "" {
+		return os.ReadFile(path)
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.memory == nil {
+		return nil, os.ErrNotExist
+	}
+	return f.memory, nil
+}
+
+// write replaces the content of the record
+func (f *stateFile) write(data []byte) error {
+	if path := f.path(); path != "" {
+		return atomicfile.WriteFile(path, data, 0600)
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.memory = append([]byte(nil), data...)
+	return nil
+}
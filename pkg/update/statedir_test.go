@@ -0,0 +1,86 @@
+package updateutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// blockedDir returns a path no directory can be created at, even by root
+func blockedDir(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(file, "dir")
+}
+
+func TestStateDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the user cache and temp dirs are not read from XDG_CACHE_HOME and TMPDIR on windows")
+	}
+	state, tmp := t.TempDir(), t.TempDir()
+	tests := []struct {
+		name   string
+		xdg    string
+		tmpDir string
+		want   string
+	}{
+		{name: "xdg state home", xdg: state, tmpDir: tmp, want: filepath.Join(state, Repository, "assets")},
+		{name: "temp dir fallback", xdg: blockedDir(t), tmpDir: tmp, want: filepath.Join(tmp, Repository, "assets")},
+		{name: "in memory", xdg: blockedDir(t), tmpDir: blockedDir(t), want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("XDG_STATE_HOME", test.xdg)
+			t.Setenv("XDG_CACHE_HOME", blockedDir(t))
+			t.Setenv("HOME", blockedDir(t))
+			t.Setenv("TMPDIR", test.tmpDir)
+			if dir := StateDir(); dir != test.want {
+				t.Errorf("StateDir() = %q, want %q", dir, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateToolsWithoutStateDir(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/memory", newToolRelease(t, "memory", "v1.1.0", []byte("bin-memory")))
+	AssetCacheDir = blockedDir(t)
+	updater := &Updater{APIRequestsPerMinute: -1}
+	defer updater.Close()
+
+	for i, hits := range []int{0, 1} {
+		summary := updater.UpdateTools(context.Background(), []Tool{{Name: "memory", Version: "1.0.0"}}, t.TempDir())
+		if summary.Updated() != 1 || summary.CacheHits() != hits {
+			t.Fatalf("update %d: updated %d with %d cache hits, want 1 with %d: %v", i, summary.Updated(), summary.CacheHits(), hits, summary.Results[0].Err)
+		}
+	}
+	if _, err := fingerprintRecords.read(); err != nil {
+		t.Errorf("release fingerprint not kept in memory: %v", err)
+	}
+}
+
+func TestCheckInstallDir(t *testing.T) {
+	if err := CheckInstallDir(t.TempDir()); err != nil {
+		t.Errorf("CheckInstallDir() of a writable dir = %v", err)
+	}
+	if err := CheckInstallDir(blockedDir(t)); err == nil || strings.Contains(err.Error(), ErrReadOnlyInstall.Error()) {
+		t.Errorf("CheckInstallDir() of a missing dir = %v, want an error other than %v", err, ErrReadOnlyInstall)
+	}
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions are not enforced")
+	}
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0700)
+	if err := CheckInstallDir(dir); err == nil || !strings.Contains(err.Error(), ErrReadOnlyInstall.Error()) {
+		t.Errorf("CheckInstallDir() of a read-only dir = %v, want %v", err, ErrReadOnlyInstall)
+	}
+}
@@ -0,0 +1,80 @@
+package updateutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// TemplateVersionFile is the metadata of a template pack at the root of the pack
+const TemplateVersionFile = ".version"
+
+// ErrIncompatibleTemplates is returned for template packs requiring a newer binary
+var ErrIncompatibleTemplates = errorutil.NewWithTag("updater", "templates require a newer binary")
+
+// TemplateVersion is the content of TemplateVersionFile, older packs only contain the tag as plain text
+type TemplateVersion struct {
+	Tag string `json:"tag"`
+	// MinBinary is the minimum binary version able to load the pack, empty for any
+	MinBinary string `json:"min_binary,omitempty"`
+}
+
+// ParseTemplateVersion parses TemplateVersionFile in the JSON or the plain text format
+func ParseTemplateVersion(data []byte) (*TemplateVersion, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("{")) {
+		return &TemplateVersion{Tag: string(data)}, nil
+	}
+	version := &TemplateVersion{}
+	if err := json.Unmarshal(data, version); err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("invalid %v", TemplateVersionFile)
+	}
+	if version.MinBinary != "" {
+		if _, err := semver.NewVersion(version.MinBinary); err != nil {
+			return nil, errorutil.NewWithErr(err).Msgf("invalid min_binary %q in %v", version.MinBinary, TemplateVersionFile)
+		}
+	}
+	return version, nil
+}
+
+// ReadTemplateVersion reads TemplateVersionFile of the pack in dir, nil when the pack has none
+func ReadTemplateVersion(dir string) (*TemplateVersion, error) {
+	data, err := os.ReadFile(filepath.Join(dir, TemplateVersionFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errorutil.NewWithErr(err).Msgf("failed to read %v", TemplateVersionFile)
+	}
+	return ParseTemplateVersion(data)
+}
+
+// Compatible returns ErrIncompatibleTemplates when binary is older than MinBinary. Development builds
+// and versions which can't be parsed are assumed compatible
+func (v *TemplateVersion) Compatible(binary string) error {
+	if v == nil || v.MinBinary == "" {
+		return nil
+	}
+	current, err := semver.NewVersion(strings.TrimSpace(binary))
+	if err != nil {
+		return nil
+	}
+	if current.LessThan(semver.MustParse(v.MinBinary)) {
+		return errorutil.NewWithErr(ErrIncompatibleTemplates).Msgf("templates %v require %v %v or newer but the binary is %v, run -update first", v.Tag, Repository, v.MinBinary, binary)
+	}
+	return nil
+}
+
+// CheckTemplateDir checks the pack in dir can be loaded by binary before loading it
+func CheckTemplateDir(dir, binary string) error {
+	version, err := ReadTemplateVersion(dir)
+	if err != nil {
+		return err
+	}
+	return version.Compatible(binary)
+}
@@ -0,0 +1,102 @@
+package updateutils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTemplateVersion(t *testing.T) {
+	tests := []struct {
+		data string
+		want TemplateVersion
+		err  bool
+	}{
+		{data: "v1.0.1\n", want: TemplateVersion{Tag: "v1.0.1"}},
+		{data: `{"tag": "v1.1.0", "min_binary": "1.0.3"}`, want: TemplateVersion{Tag: "v1.1.0", MinBinary: "1.0.3"}},
+		{data: `{"tag": "v1.1.0"}`, want: TemplateVersion{Tag: "v1.1.0"}},
+		{data: `{"tag": "v1.1.0", "min_binary": "next"}`, err: true},
+		{data: `{"tag": `, err: true},
+	}
+	for _, test := range tests {
+		got, err := ParseTemplateVersion([]byte(test.data))
+		if (err != nil) != test.err {
+			t.Errorf("ParseTemplateVersion(%q) error = %v, want error %v", test.data, err, test.err)
+			continue
+		}
+		if err == nil && *got != test.want {
+			t.Errorf("ParseTemplateVersion(%q) = %+v, want %+v", test.data, *got, test.want)
+		}
+	}
+}
+
+func TestTemplateVersionCompatible(t *testing.T) {
+	// 旧/新程序与旧/新模板包的四种组合
+	oldPack := &TemplateVersion{Tag: "v1.0.0"}
+	newPack := &TemplateVersion{Tag: "v1.1.0", MinBinary: "1.0.3"}
+	tests := []struct {
+		name   string
+		pack   *TemplateVersion
+		binary string
+		ok     bool
+	}{
+		{name: "old binary old pack", pack: oldPack, binary: "1.0.2", ok: true},
+		{name: "old binary new pack", pack: newPack, binary: "v1.0.2", ok: false},
+		{name: "new binary old pack", pack: oldPack, binary: "1.0.3", ok: true},
+		{name: "new binary new pack", pack: newPack, binary: "v1.0.3", ok: true},
+		{name: "development binary", pack: newPack, binary: "dev", ok: true},
+		{name: "no pack", binary: "1.0.2", ok: true},
+	}
+	for _, test := range tests {
+		err := test.pack.Compatible(test.binary)
+		if test.ok && err != nil {
+			t.Errorf("%s: Compatible() = %v", test.name, err)
+		}
+		if !test.ok && (err == nil || !strings.Contains(err.Error(), ErrIncompatibleTemplates.Error()) || !strings.Contains(err.Error(), "-update")) {
+			t.Errorf("%s: Compatible() = %v, want %v telling to run -update", test.name, err, ErrIncompatibleTemplates)
+		}
+	}
+}
+
+func TestCheckTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckTemplateDir(dir, "1.0.2"); err != nil {
+		t.Errorf("CheckTemplateDir() without %v = %v", TemplateVersionFile, err)
+	}
+	writeFiles(t, dir, map[string]string{TemplateVersionFile: `{"tag": "v1.1.0", "min_binary": "1.0.3"}`})
+	if err := CheckTemplateDir(dir, "1.0.2"); err == nil {
+		t.Error("CheckTemplateDir() loaded templates requiring a newer binary")
+	}
+}
+
+func TestUpdateDirFromRepoIncompatible(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      *DirUpdateOptions
+		installed bool
+		err       bool
+	}{
+		{name: "refused", opts: &DirUpdateOptions{BinaryVersion: "1.0.2"}, err: true},
+		{name: "forced", opts: &DirUpdateOptions{BinaryVersion: "1.0.2", Force: true}, installed: true},
+		{name: "dry run", opts: &DirUpdateOptions{BinaryVersion: "1.0.2", DryRun: true}},
+		{name: "compatible", opts: &DirUpdateOptions{BinaryVersion: "1.0.3"}, installed: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeGitHub(t)
+			fake.AddRelease(Organization+"/templates", &fakeRelease{Tag: "v1.1.0", Source: zipArchive(t, map[string][]byte{
+				"templates-abc123/.version":      []byte(`{"tag": "v1.1.0", "min_binary": "1.0.3"}`),
+				"templates-abc123/cves/new.yaml": []byte("new"),
+			})})
+			dir := t.TempDir()
+			_, err := UpdateDirFromRepo("templates", dir, "", test.opts)
+			if (err != nil) != test.err {
+				t.Fatalf("UpdateDirFromRepo() = %v, want error %v", err, test.err)
+			}
+			if _, statErr := os.Stat(filepath.Join(dir, "cves/new.yaml")); (statErr == nil) != test.installed {
+				t.Errorf("templates installed = %v, want %v", statErr == nil, test.installed)
+			}
+		})
+	}
+}
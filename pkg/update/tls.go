@@ -0,0 +1,36 @@
+package updateutils
+
+import (
+	"crypto/x509"
+
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// SetRootCAs trusts the PEM certificates of pemBytes, e.g. a corporate CA bundle, in addition to the
+// system roots for the version checks and the downloads of the updater. Nil trusts the system roots
+// only again
+func SetRootCAs(pemBytes []byte) error {
+	if pemBytes == nil {
+		rebuildTransports(func(c *transportConfig) { c.rootCAs = nil })
+		return nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return errorutil.New("no PEM certificate found in the update root CAs")
+	}
+	rebuildTransports(func(c *transportConfig) { c.rootCAs = pool })
+	return nil
+}
+
+// AllowInsecureTLS disables the verification of the certificates of github and of the download hosts,
+// for proxies intercepting TLS whose CA can't be trusted with SetRootCAs. The checksums and the update
+// verifier still verify the assets
+func AllowInsecureTLS(allow bool) {
+	if allow {
+		updateLog.Info().Label("updater").Msgf("TLS certificates of the update hosts are not verified")
+	}
+	rebuildTransports(func(c *transportConfig) { c.insecure = allow })
+}
@@ -0,0 +1,71 @@
+package updateutils
+
+import (
+	"bytes"
+	"encoding/pem"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTLSVerification(t *testing.T) {
+	hideProgressBar(t)
+	bin := []byte("binary over tls")
+	tests := []struct {
+		name string
+		// configure sets the tls options of the updater, the certificate is the pem of the server
+		configure func(t *testing.T, certificate []byte)
+		wantErr   bool
+	}{
+		{name: "self-signed refused", configure: func(*testing.T, []byte) {}, wantErr: true},
+		{name: "root CA", configure: func(t *testing.T, certificate []byte) {
+			if err := SetRootCAs(certificate); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "insecure", configure: func(*testing.T, []byte) { AllowInsecureTLS(true) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				_ = SetRootCAs(nil)
+				AllowInsecureTLS(false)
+			}()
+			fake := newFakeGitHub(t)
+			fake.AddRelease(Organization+"/secure", newToolRelease(t, "secure", "v1.0.0", bin))
+			// api 与下载都使用自签名证书的 https
+			server := httptest.NewTLSServer(fake)
+			defer server.Close()
+			githubBaseURL, _ = url.Parse(server.URL + "/api/")
+			UpdateSourceAllowlist = append(UpdateSourceAllowlist, trustedSource(Organization+"/secure"))
+			fake.DownloadURL = server.URL
+			test.configure(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+			d, err := NewghReleaseDownloader(Organization + "/secure")
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "certificate") {
+					t.Fatalf("NewghReleaseDownloader() = %v, want a certificate error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.cache = nil
+			if got, err := d.GetExecutableFromAsset(); err != nil || !bytes.Equal(got, bin) {
+				t.Fatalf("GetExecutableFromAsset() = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestSetRootCAs(t *testing.T) {
+	defer func() { _ = SetRootCAs(nil) }()
+	if err := SetRootCAs([]byte("not a certificate")); err == nil {
+		t.Error("SetRootCAs() of a file without certificate succeeded")
+	}
+	if err := SetRootCAs(nil); err != nil {
+		t.Errorf("SetRootCAs(nil) = %v", err)
+	}
+}
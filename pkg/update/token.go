@@ -0,0 +1,85 @@
+package updateutils
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/go-github/v30/github"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"github.com/wjlin0/CVE-2024-23897/pkg/credential"
+)
+
+// ErrCredentialRejected is returned when the forge refuses the github-token, gitlab-token or gitea-token
+// credential, matched with errors.Is
+var ErrCredentialRejected = errorutil.NewWithTag("updater", "the release source rejected the credential")
+
+// SetGitLabToken sets the token authenticating the gitlab api calls and downloads of the updater instead
+// of the GITLAB_TOKEN environment variable, an empty token makes anonymous calls
+func SetGitLabToken(token string) {
+	credential.Default.Select(credential.GitLabToken, &credential.Static{Value: token})
+}
+
+// SetGHToken sets the token authenticating the github api calls of the updater instead of the
+// GITHUB_TOKEN or GH_TOKEN environment variables, an empty token makes anonymous calls
+func SetGHToken(token string) {
+	credential.Default.Select(credential.GitHubToken, &credential.Static{Value: token})
+}
+
+// tokenTransport authenticates the requests to the github api host with a bearer token. Assets and
+// sources are redirected to pre-signed urls of other hosts, which don't receive the token
+type tokenTransport struct {
+	host  string
+	token string
+	// header carries the token as is instead of a bearer Authorization, e.g. PRIVATE-TOKEN on gitlab
+	// or Authorization with "token " on gitea
+	header string
+	base   http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	header, value := t.header, t.token
+	if header == "" {
+		header, value = "Authorization", "Bearer "+t.token
+	}
+	if req.URL.Host != t.host || req.Header.Get(header) != "" {
+		return base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(header, value)
+	return base.RoundTrip(req)
+}
+
+// credentialRejected returns ErrCredentialRejected when a token was sent and the forge answered while
+// doing action with 401 or with a 403 which is not a rate limit, nil otherwise
+func (d *GHReleaseDownloader) credentialRejected(resp *http.Response, err error, action string) error {
+	var rateLimit *github.RateLimitError
+	if !d.authenticated || resp == nil || errors.As(err, &rateLimit) {
+		return nil
+	}
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return nil
+	}
+	name := forgeCredential(d.forge)
+	provider := credential.Default.Provider(name)
+	if resp.StatusCode == http.StatusUnauthorized {
+		return newUpdateError(ErrCredentialRejected, "the %v credential (%v) is invalid or expired, %v refused it %v of %v/%v",
+			name, provider, d.forge, action, d.organization, d.repoName)
+	}
+	return newUpdateError(ErrCredentialRejected, "the %v credential (%v) has no access to %v/%v, %v refused it %v",
+		name, provider, d.organization, d.repoName, d.forge, action)
+}
+
+// forgeCredential returns the name of the credential authenticating the calls to forge
+func forgeCredential(forge string) string {
+	switch forge {
+	case SourceGitLab:
+		return credential.GitLabToken
+	case SourceGitea:
+		return credential.GiteaToken
+	}
+	return credential.GitHubToken
+}
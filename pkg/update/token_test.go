@@ -0,0 +1,64 @@
+package updateutils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wjlin0/CVE-2024-23897/pkg/credential"
+)
+
+// setGHToken sets the token of the updater until the test ends
+func setGHToken(t *testing.T, token string) {
+	SetGHToken(token)
+	t.Cleanup(func() {
+		credential.Default.Select(credential.GitHubToken, &credential.Env{Variable: "GITHUB_TOKEN", Fallbacks: []string{"GH_TOKEN"}})
+	})
+}
+
+func TestGHToken(t *testing.T) {
+	var sourceAuth atomic.Value
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sourceAuth.Store(r.Header.Get("Authorization"))
+		_, _ = w.Write(zipArchive(t, map[string][]byte{"README.md": []byte("private")}))
+	}))
+	defer source.Close()
+	fake := newFakeGitHub(t)
+	fake.Token = "ghp_private0123456789"
+	release := newToolRelease(t, "private", "v1.0.0", []byte("bin"))
+	release.ZipballURL = source.URL
+	fake.AddRelease(Organization+"/private", release)
+
+	setGHToken(t, "ghp_private0123456789")
+	d, err := NewghReleaseDownloader(Organization + "/private")
+	if err != nil {
+		t.Fatalf("NewghReleaseDownloader() with the token = %v", err)
+	}
+	if _, err := d.DownloadAssetWithName(platformAssetName("private", "v1.0.0", Tar), false); err != nil {
+		t.Errorf("DownloadAssetWithName() with the token = %v", err)
+	}
+	if _, err := d.DownloadSource(false); err != nil {
+		t.Errorf("DownloadSource() = %v", err)
+	}
+	// 令牌只发送给 api 主机
+	if auth, _ := sourceAuth.Load().(string); auth != "" {
+		t.Errorf("source download on another host got Authorization %q", auth)
+	}
+
+	for _, token := range []string{"ghp_revoked0123456789", ""} {
+		setGHToken(t, token)
+		_, err := NewghReleaseDownloader(Organization + "/private")
+		if token != "" && !errors.Is(err, ErrCredentialRejected) {
+			t.Errorf("NewghReleaseDownloader() with an invalid token = %v, want %v", err, ErrCredentialRejected)
+		}
+		if token == "" && (err == nil || errors.Is(err, ErrCredentialRejected)) {
+			t.Errorf("NewghReleaseDownloader() without token = %v, want a failure which is not a rejected credential", err)
+		}
+		if err != nil && token != "" && strings.Contains(err.Error(), token) {
+			t.Errorf("error leaks the token: %v", err)
+		}
+	}
+}
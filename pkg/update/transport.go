@@ -0,0 +1,84 @@
+package updateutils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// transportConfig is the network configuration of the updater set by SetProxy, SetRootCAs and
+// AllowInsecureTLS
+type transportConfig struct {
+	proxy    func(*http.Request) (*url.URL, error)
+	rootCAs  *x509.CertPool
+	insecure bool
+}
+
+var (
+	transportMutex sync.RWMutex
+	transports     = transportConfig{proxy: http.ProxyFromEnvironment}
+	// apiTransportBase and downloadTransportBase are the transports of the github api calls and of
+	// the asset and source downloads
+	apiTransportBase      http.RoundTripper
+	downloadTransportBase http.RoundTripper
+)
+
+func init() {
+	rebuildTransports(func(*transportConfig) {})
+}
+
+// rebuildTransports applies change to the network configuration and rebuilds the transports and
+// DefaultHttpClient with it, the clients created afterwards use them
+func rebuildTransports(change func(c *transportConfig)) {
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	change(&transports)
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		base = &http.Transport{}
+	}
+	api := base.Clone()
+	api.Proxy = transports.proxy
+	api.TLSClientConfig = &tls.Config{RootCAs: transports.rootCAs, InsecureSkipVerify: transports.insecure}
+	// 下载不透明解压, 以便按收到的字节计算校验和, decodeBody 显式解码
+	download := api.Clone()
+	download.DisableCompression = true
+	apiTransportBase, downloadTransportBase = api, download
+	DefaultHttpClient = &http.Client{Timeout: VersionCheckTimeout, Transport: api.Clone()}
+}
+
+// apiTransport returns the transport of the github api calls
+func apiTransport() http.RoundTripper {
+	transportMutex.RLock()
+	defer transportMutex.RUnlock()
+	return apiTransportBase
+}
+
+// downloadTransport returns the transport of the downloads. Transparent decompression is disabled so
+// the checksums are computed on the bytes received, decodeBody decodes them explicitly
+func downloadTransport() http.RoundTripper {
+	transportMutex.RLock()
+	defer transportMutex.RUnlock()
+	return downloadTransportBase
+}
+
+// WithHTTPClient makes the downloader send its api calls and downloads with client instead of the transports
+// configured by SetProxy, SetRootCAs and AllowInsecureTLS, e.g. a direct client next to one going through a
+// proxy in the same process. The transport, timeout, redirect policy and cookie jar of client apply; the
+// downloader wraps a copy of it with the credential, the retries and the egress counters, so client itself
+// and the other downloaders are not affected
+func WithHTTPClient(client *http.Client) DownloaderOption {
+	return func(d *GHReleaseDownloader) {
+		d.httpClient = client
+	}
+}
+
+// clientTransport returns the transport of client, http.DefaultTransport when it has none
+func clientTransport(client *http.Client) http.RoundTripper {
+	if client.Transport == nil {
+		return http.DefaultTransport
+	}
+	return client.Transport
+}
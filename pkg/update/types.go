@@ -14,14 +14,23 @@ const (
 	Zip AssetFormat = iota
 	Tar
 	Unknown
+	TarXz
+	TarZstd
+	// Binary is an executable which is not an archive
+	Binary
 )
 
 // FileExtension of this asset format
 func (a AssetFormat) FileExtension() string {
-	if a == Zip {
+	switch a {
+	case Zip:
 		return ".zip"
-	} else if a == Tar {
+	case Tar:
 		return ".tar.gz"
+	case TarXz:
+		return ".tar.xz"
+	case TarZstd:
+		return ".tar.zst"
 	}
 	return ""
 }
@@ -32,6 +41,10 @@ func IdentifyAssetFormat(assetName string) AssetFormat {
 		return Zip
 	case strings.HasSuffix(assetName, Tar.FileExtension()):
 		return Tar
+	case strings.HasSuffix(assetName, TarXz.FileExtension()):
+		return TarXz
+	case strings.HasSuffix(assetName, TarZstd.FileExtension()):
+		return TarZstd
 	default:
 		return Unknown
 	}
@@ -43,9 +56,18 @@ type Tool struct {
 	Repo    string            `json:"repo"`
 	Version string            `json:"version"`
 	Assets  map[string]string `json:"assets"`
+	// AssetBaseName is the prefix of the release asset names, defaults to Name
+	AssetBaseName string `json:"asset-base-name,omitempty"`
+	// ExecutableName is the name of the executable inside the asset and once installed, defaults to AssetBaseName
+	ExecutableName string `json:"executable-name,omitempty"`
+	// AssetPattern is the template of the release asset name of the platform, defaults to DefaultAssetPattern
+	AssetPattern string `json:"asset-pattern,omitempty"`
+	// BreakingChangePatterns overrides the breaking change patterns for this tool
+	BreakingChangePatterns []string `json:"breaking-change-patterns,omitempty"`
 }
 
-// GetVersionDescription returns tags like (latest) or (outdated) or (dev)
+// GetVersionDescription returns tags like (latest) or (outdated) or (development), (unknown) when
+// the versions differ and can't be compared. Colors follow color.NoColor, disabled by NO_COLOR
 func GetVersionDescription(current string, latest string) string {
 	if strings.HasSuffix(current, "-dev") {
 		if IsDevReleaseOutdated(current, latest) {
@@ -54,11 +76,20 @@ func GetVersionDescription(current string, latest string) string {
 			return fmt.Sprintf("(%v)", color.HiBlueString("development"))
 		}
 	}
-	if IsOutdated(current, latest) {
+	currentVer, _ := semver.NewVersion(current)
+	latestVer, _ := semver.NewVersion(latest)
+	switch {
+	case currentVer == nil || latestVer == nil:
+		if current != latest {
+			return fmt.Sprintf("(%v)", color.HiYellowString("unknown"))
+		}
+	case latestVer.GreaterThan(currentVer):
 		return fmt.Sprintf("(%v)", color.HiRedString("outdated"))
-	} else {
-		return fmt.Sprintf("(%v)", color.HiGreenString("latest"))
+	case currentVer.GreaterThan(latestVer):
+		// 比最新发布更新, 即未发布的构建
+		return fmt.Sprintf("(%v)", color.HiBlueString("development"))
 	}
+	return fmt.Sprintf("(%v)", color.HiGreenString("latest"))
 }
 
 // IsOutdated returns true if current version is outdated
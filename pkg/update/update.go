@@ -2,29 +2,28 @@ package updateutils
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/fatih/color"
 	errorutil "github.com/projectdiscovery/utils/errors"
 	folderutil "github.com/projectdiscovery/utils/folder"
-	"io"
-	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/Masterminds/semver/v3"
-	"github.com/charmbracelet/glamour"
 	"github.com/denisbrodbeck/machineid"
 	"github.com/minio/selfupdate"
-	"github.com/projectdiscovery/gologger"
 )
 
 const (
+	// Organization is the compiled-in organization of the tool, see DefaultOrganization
 	Organization = "wjlin0"
 )
 
@@ -34,10 +33,83 @@ var (
 	HideProgressBar       = false
 	VersionCheckTimeout   = time.Duration(5) * time.Second
 	DownloadUpdateTimeout = time.Duration(30) * time.Second
-	// Note: DefaultHttpClient is only used in GetToolVersionCallback
+	// DefaultHttpClient is rebuilt with the transports configured by SetProxy, SetRootCAs and AllowInsecureTLS.
+	// The downloaders use those transports directly, WithHTTPClient gives one its own client
 	DefaultHttpClient *http.Client
+	// ConfirmBreakingChanges requires an interactive confirmation before applying an update whose
+	// release notes contain breaking changes
+	ConfirmBreakingChanges = false
+	// BreakingChangePatterns match the release notes headers of breaking change sections, nil uses DefaultBreakingChangePatterns
+	BreakingChangePatterns []string
+	// DryRun makes the update callbacks print what they would do without downloading the asset or writing
+	// anything, they return ErrUpdateAvailable or ErrAlreadyLatest
+	DryRun = false
+	// TemplatesPublicKey is the pinned minisign public key verifying directory updates, used when DirUpdateOptions doesn't set one
+	TemplatesPublicKey string
+	// RequireSignedTemplates refuses directory updates from releases without a valid signature
+	RequireSignedTemplates = false
+	// DisableTelemetry omits the machine id from the update check parameters, also enabled by NoTelemetryEnv
+	DisableTelemetry = false
+	// MinimalCheck sends only the version in the update check parameters, without the machine id, os, arch
+	// and go version
+	MinimalCheck = false
+	// DisableUpdateCheck makes the version check and the update callbacks return ErrUpdateCheckDisabled without
+	// any request, also enabled by DisableUpdateCheckEnv
+	DisableUpdateCheck = false
 )
 
+// DisableUpdateCheckEnv set to a true value (1, true) enables DisableUpdateCheck, e.g. for a fleet of machines
+const DisableUpdateCheckEnv = "WJLIN0_DISABLE_UPDATE_CHECK"
+
+// NoTelemetryEnv set to a true value (1, true) enables DisableTelemetry
+const NoTelemetryEnv = "UPDATE_NO_TELEMETRY"
+
+// errors returned by the callbacks of GetUpdateToolFromRepoCallbackWithError, matched with errors.Is
+var (
+	// ErrAlreadyLatest is returned when the tool is already updated to the latest version
+	ErrAlreadyLatest = errorutil.NewWithTag("updater", "already updated to latest version")
+	// ErrUpdateAvailable is returned by a dry run when the update would be applied
+	ErrUpdateAvailable = errorutil.NewWithTag("updater", "update available")
+	// ErrAlreadyAtVersion is returned when the tool is already at the version it is updated to
+	ErrAlreadyAtVersion = errorutil.NewWithTag("updater", "already at the requested version")
+	// ErrUpdateDeferred is returned when the tool is outdated but its update was deferred by the rollout
+	ErrUpdateDeferred = errorutil.NewWithTag("updater", "update deferred by the rollout policy")
+	// ErrPermission is returned when the executable can't be replaced by the user
+	ErrPermission = errorutil.NewWithTag("updater", "insufficient permission to update")
+	// ErrApplyFailed is returned when replacing the executable failed and the previous one was restored
+	ErrApplyFailed = errorutil.NewWithTag("updater", "failed to apply update")
+	// ErrRollbackFailed is returned when replacing the executable failed and restoring the previous one failed too,
+	// the tool has to be reinstalled
+	ErrRollbackFailed = errorutil.NewWithTag("updater", "failed to roll back update")
+	// ErrUpdateCheckDisabled is returned without any request when DisableUpdateCheck or DisableUpdateCheckEnv
+	// disable the update checks, unlike ErrAlreadyLatest nothing was checked
+	ErrUpdateCheckDisabled = errorutil.NewWithTag("updater", "update check disabled")
+)
+
+// ExitUpdateAvailable is the exit code of the update callbacks exiting after a dry run which would update
+const ExitUpdateAvailable = 2
+
+// executablePath returns the path of the executable replaced by an update, tests replace it
+var executablePath = os.Executable
+
+// updateError is an error of kind, errors.Is matches it with its kind
+type updateError struct {
+	kind error
+	err  error
+}
+
+func (e *updateError) Error() string {
+	return e.err.Error()
+}
+
+func (e *updateError) Is(target error) bool {
+	return target == e.kind
+}
+
+func newUpdateError(kind error, format string, args ...any) error {
+	return &updateError{kind: kind, err: errorutil.NewWithErr(kind).Msgf(format, args...)}
+}
+
 // GetUpdateToolCallback returns a callback function
 // that updates given tool if given version is older than latest gh release and exits
 func GetUpdateToolCallback(toolName, version string) func() {
@@ -45,137 +117,496 @@ func GetUpdateToolCallback(toolName, version string) func() {
 }
 
 // GetUpdateToolWithRepoCallback returns a callback function that is similar to GetUpdateToolCallback
-// but it takes repoName as an argument (repoName can be either just repoName ex: `nuclei` or full repo Addr ex: `projectdiscovery/nuclei`)
+// but it takes repoName as an argument (repoName can be either just repoName ex: `nuclei`, resolved under
+// DefaultOrganization or UPDATE_ORG, or full repo Addr ex: `projectdiscovery/nuclei`)
 func GetUpdateToolFromRepoCallback(toolName, version, repoName string) func() {
+	return exitAfterUpdate(toolName, GetUpdateToolFromRepoCallbackWithError(toolName, version, repoName))
+}
+
+// GetUpdateToolToVersionNoErrCallback returns a callback that is similar to GetUpdateToolToVersionCallback but
+// exits after the update
+func GetUpdateToolToVersionNoErrCallback(toolName, currentVersion, repoName, targetTag string) func() {
+	return exitAfterUpdate(toolName, GetUpdateToolToVersionCallback(toolName, currentVersion, repoName, targetTag))
+}
+
+// GetUpdateToolFromFileNoErrCallback returns a callback replacing the executable of toolName with the one of
+// the local release asset at archivePath and exiting, see ApplyUpdateFromFileWithVersion
+func GetUpdateToolFromFileNoErrCallback(toolName, currentVersion, archivePath string) func() {
+	return exitAfterUpdate(toolName, func() error {
+		return ApplyUpdateFromFileWithVersion(toolName, currentVersion, archivePath)
+	})
+}
+
+// exitAfterUpdate returns a callback running update, reporting its error and exiting
+func exitAfterUpdate(toolName string, update func() error) func() {
 	return func() {
+		err := update()
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrAlreadyLatest):
+			updateLog.Info().Msgf("%v is already updated to latest version", toolName)
+		case errors.Is(err, ErrAlreadyAtVersion):
+			updateLog.Info().Msgf("%v", err)
+		case errors.Is(err, ErrUpdateAvailable):
+			// 演练时以退出码区分有可用更新
+			os.Exit(ExitUpdateAvailable)
+		case errors.Is(err, ErrUpdateDeferred), errors.Is(err, ErrBreakingChangesNotConfirmed), errors.Is(err, ErrUpdateCheckDisabled):
+			// already reported by the callback
+		case errors.Is(err, ErrApplyFailed):
+			updateLog.Error().Msgf("%v", err)
+			os.Exit(1)
+		default:
+			updateLog.Fatal().Label("updater").Msgf("%v", err)
+			// 自定义日志的 Fatalf 可以返回
+			return
+		}
+		os.Exit(0)
+	}
+}
+
+// GetUpdateToolCallbackWithError returns a callback function that is similar to GetUpdateToolCallback
+// but returns an error instead of exiting
+func GetUpdateToolCallbackWithError(toolName, version string) func() error {
+	return GetUpdateToolFromRepoCallbackWithError(toolName, version, "")
+}
+
+// GetUpdateToolCallbackWithErrorCtx is GetUpdateToolCallbackWithError aborting the update when ctx is done
+func GetUpdateToolCallbackWithErrorCtx(ctx context.Context, toolName, version string) func() error {
+	return GetUpdateToolFromRepoCallbackWithErrorCtx(ctx, toolName, version, "")
+}
+
+// GetUpdateToolFromRepoCallbackWithError returns a callback function that is similar to GetUpdateToolFromRepoCallback
+// but returns an error instead of exiting, such as ErrAlreadyLatest, ErrUpdateDeferred, ErrPermission or ErrApplyFailed
+func GetUpdateToolFromRepoCallbackWithError(toolName, version, repoName string) func() error {
+	return GetUpdateToolFromRepoCallbackWithErrorCtx(context.Background(), toolName, version, repoName)
+}
+
+// GetUpdateToolFromRepoCallbackWithErrorCtx is GetUpdateToolFromRepoCallbackWithError aborting the update when ctx
+// is done, the executable is not replaced once ctx is done
+func GetUpdateToolFromRepoCallbackWithErrorCtx(ctx context.Context, toolName, version, repoName string) func() error {
+	return updateToolCallback(ctx, toolName, version, repoName, "", false, nil)
+}
+
+// GetUpdateToolCheckCallback returns a callback resolving the update of toolName as
+// GetUpdateToolFromRepoCallbackWithError does, without downloading the asset or replacing the executable.
+// It prints what the update would do and returns ErrUpdateAvailable, or ErrAlreadyLatest when up to date
+func GetUpdateToolCheckCallback(toolName, version, repoName string) func() error {
+	return updateToolCallback(context.Background(), toolName, version, repoName, "", true, nil)
+}
+
+// GetUpdateToolToVersionCallback returns a callback installing the release of repoName tagged targetTag, also
+// when it is older than currentVersion. It returns ErrAlreadyAtVersion when currentVersion is targetTag and
+// ErrReleaseNotFound listing the nearest tags when the repo has no such release
+func GetUpdateToolToVersionCallback(toolName, currentVersion, repoName, targetTag string) func() error {
+	return updateToolCallback(context.Background(), toolName, currentVersion, repoName, targetTag, false, nil)
+}
+
+// GetUpdateToolCallbackWithOptions is GetUpdateToolCallbackWithError configured with opts instead of the
+// package variables
+func GetUpdateToolCallbackWithOptions(toolName, version string, opts Options) func() error {
+	return GetUpdateToolFromRepoCallbackWithOptions(toolName, version, "", opts)
+}
+
+// GetUpdateToolFromRepoCallbackWithOptions is GetUpdateToolFromRepoCallbackWithError configured with opts instead
+// of the package variables
+func GetUpdateToolFromRepoCallbackWithOptions(toolName, version, repoName string, opts Options) func() error {
+	return updateToolCallback(context.Background(), toolName, version, repoName, "", false, &opts)
+}
+
+// updateToolCallback returns the callback updating toolName to the latest release, or to the release tagged
+// targetTag when set. The rollout policy only defers updates to the latest release. A dry run, also enabled
+// by DryRun, stops before downloading the asset. opts replaces the package variables when not nil
+func updateToolCallback(ctx context.Context, toolName, version, repoName, targetTag string, dryRun bool, opts *Options) func() error {
+	return func() error {
+		if err := updateCheckDisabled(toolName); err != nil {
+			return err
+		}
+		options := resolveOptions(opts)
+		dryRun := dryRun || options.DryRun
+		if !dryRun {
+			sweepOldBinaries()
+		}
 		if repoName == "" {
 			repoName = toolName
 		}
-		gh, err := NewghReleaseDownloader(repoName)
+		var downloaderOpts []DownloaderOption
+		if opts != nil {
+			downloaderOpts = append(downloaderOpts, WithOptions(*opts))
+		}
+		gh, err := NewghReleaseDownloaderWithContext(ctx, repoName, downloaderOpts...)
+		if err := contextError(ctx, "update of %v cancelled", toolName); err != nil {
+			return err
+		}
+		if isRateLimited(err) {
+			return err
+		}
 		if err != nil {
-			gologger.Fatal().Label("updater").Msgf("failed to download latest release got %v", err)
+			return errorutil.NewWithErr(err).Msgf("failed to download latest release")
 		}
 		gh.SetToolName(toolName)
-		latestVersion, err := semver.NewVersion(gh.Latest.GetTagName())
+		updateLog.Info().Label("updater").Msgf("update source: %v", gh.SourceURL())
+		if targetTag != "" {
+			if err := gh.PinRelease(targetTag); err != nil {
+				return err
+			}
+		}
+		cmp, _, err := gh.compareVersion(version)
 		if err != nil {
-			gologger.Fatal().Label("updater").Msgf("failed to parse semversion from tagname `%v` got %v", gh.Latest.GetTagName(), err)
+			return err
+		}
+		currentVersion, latestVersion := displayVersion(version), displayVersion(gh.Latest.GetTagName())
+		if targetTag != "" {
+			if cmp == 0 && !options.ForceUpdate {
+				return newUpdateError(ErrAlreadyAtVersion, "%v is already at version %v", toolName, currentVersion)
+			}
+			if cmp > 0 {
+				// 显式指定的降级照常执行
+				updateLog.Info().Label("updater").Msgf("downgrading %v %v -> %v", toolName, currentVersion, latestVersion)
+			}
+		} else {
+			// check if current version is outdated
+			outdated := cmp < 0
+			recordOutdated(toolName, outdated)
+			if !outdated && !options.ForceUpdate {
+				return newUpdateError(ErrAlreadyLatest, "%v %v is the latest version", toolName, currentVersion)
+			}
+			rollout, err := gh.Rollout()
+			if err := contextError(ctx, "update of %v cancelled", toolName); err != nil {
+				return err
+			}
+			if err != nil {
+				return errorutil.NewWithErr(err).Msgf("failed to read the rollout of %v", latestVersion)
+			}
+			if rollout.Deferred() {
+				updateLog.Info().Msgf("update of %v %v -> %v %v", toolName, currentVersion, latestVersion, rollout)
+				return newUpdateError(ErrUpdateDeferred, "update of %v %v -> %v %v", toolName, currentVersion, latestVersion, rollout)
+			}
 		}
-		currentVersion, err := semver.NewVersion(version)
+		// 跨版本更新时, 中间版本的破坏性变更同样需要确认
+		notes, breaking, err := HighlightBreakingChanges(gh.releaseNotes(currentVersion, latestVersion), options.BreakingChangePatterns)
 		if err != nil {
-			gologger.Fatal().Label("updater").Msgf("failed to parse semversion from current version %v got %v", version, err)
+			return errorutil.NewWithErr(err).Msgf("failed to extract breaking changes")
 		}
-		// check if current version is outdated
-		if !IsOutdated(currentVersion.String(), latestVersion.String()) {
-			gologger.Info().Msgf("%v is already updated to latest version", toolName)
-			os.Exit(0)
+		if breaking && options.ConfirmBreakingChanges && !dryRun {
+			if !confirm(fmt.Sprintf("%v %v contains breaking changes, update anyway?", toolName, latestVersion)) {
+				updateLog.Info().Msgf("update of %v %v -> %v cancelled", toolName, currentVersion, latestVersion)
+				return newUpdateError(ErrBreakingChangesNotConfirmed, "update of %v %v -> %v cancelled", toolName, currentVersion, latestVersion)
+			}
 		}
-		// check permissions before downloading release
 		updateOpts := selfupdate.Options{}
+		// check permissions before downloading release
+		if executable, err := executablePath(); err == nil {
+			if err := CheckInstallDir(filepath.Dir(executable)); err != nil {
+				return newUpdateError(ErrPermission, "update of %v %v -> %v failed: %v", toolName, currentVersion, latestVersion, err)
+			}
+			updateOpts.TargetPath = executable
+		}
 		if err := updateOpts.CheckPermissions(); err != nil {
-			gologger.Fatal().Label("updater").Msgf("update of %v %v -> %v failed , insufficient permission detected got: %v", toolName, currentVersion.String(), latestVersion.String(), err)
+			return newUpdateError(ErrPermission, "update of %v %v -> %v failed , insufficient permission detected got: %v", toolName, currentVersion, latestVersion, err)
+		}
+		if dryRun {
+			err := dryRunUpdate(gh, toolName, currentVersion, latestVersion, cmp, breaking)
+			if errors.Is(err, ErrUpdateAvailable) && !options.HideReleaseNotes {
+				printReleaseNotes(notes, options.ReleaseNotesStyle)
+			}
+			return err
+		}
+		bin, err := gh.GetExecutableFromAssetCtx(ctx)
+		if err := contextError(ctx, "update of %v cancelled", toolName); err != nil {
+			return err
+		}
+		if integrityError(err) || isRateLimited(err) {
+			return err
 		}
-		bin, err := gh.GetExecutableFromAsset()
 		if err != nil {
-			gologger.Fatal().Label("updater").Msgf("executable %v not found in release asset `%v` got: %v", toolName, gh.AssetID, err)
+			return errorutil.NewWithErr(err).Msgf("executable %v not found in release asset `%v`", toolName, gh.AssetID)
 		}
 
-		if err = selfupdate.Apply(bytes.NewBuffer(bin), updateOpts); err != nil {
-			gologger.Error().Msgf("update of %v %v -> %v failed, rolling back update", toolName, currentVersion.String(), latestVersion.String())
-			if err := selfupdate.RollbackError(err); err != nil {
-				gologger.Fatal().Label("updater").Msgf("rollback of update of %v failed got %v,pls reinstall %v", toolName, err, toolName)
+		err, rollbackErr := applyUpdate(bin, updateOpts)
+		getMetrics().IncCounter(MetricApplies, map[string]string{"tool": toolName, "result": resultLabel(err)})
+		if err != nil {
+			getMetrics().IncCounter(MetricRollbacks, map[string]string{"tool": toolName, "result": resultLabel(rollbackErr)})
+			if rollbackErr != nil {
+				return newUpdateError(ErrRollbackFailed, "update of %v %v -> %v failed: %v, rollback failed got %v,pls reinstall %v", toolName, currentVersion, latestVersion, err, rollbackErr, toolName)
 			}
-			os.Exit(1)
+			return newUpdateError(ErrApplyFailed, "update of %v %v -> %v failed, rolled back update: %v", toolName, currentVersion, latestVersion, err)
 		}
 
-		gologger.Print().Msg("")
-		gologger.Info().Msgf("%v sucessfully updated %v -> %v (%s)", toolName, currentVersion.String(), latestVersion.String(), color.HiGreenString("latest"))
+		label := plainColor(color.HiGreenString, "latest")
+		if targetTag != "" {
+			label = plainColor(color.HiYellowString, "pinned")
+		}
+		if isPrerelease(gh.Latest) {
+			label += ", " + plainColor(color.HiMagentaString, "pre-release")
+			notes = fmt.Sprintf("> **%v is a pre-release**\n\n%v", gh.Latest.GetTagName(), notes)
+		}
+		updateLog.Print().Msg("")
+		if cmp == 0 {
+			updateLog.Info().Msgf("%v sucessfully reinstalled %v (%s) from %v", toolName, taggedVersion(latestVersion), label, gh.SourceURL())
+		} else {
+			updateLog.Info().Msgf("%v sucessfully updated %v -> %v (%s) from %v", toolName, currentVersion, latestVersion, label, gh.SourceURL())
+		}
 
-		if !HideReleaseNotes {
-			output := gh.Latest.GetBody()
-			// adjust colors for both dark / light terminal themes
-			r, err := glamour.NewTermRenderer(glamour.WithAutoStyle())
-			if err != nil {
-				gologger.Error().Msgf("markdown rendering not supported: %v", err)
-			}
-			if rendered, err := r.Render(output); err == nil {
-				output = rendered
-			} else {
-				gologger.Error().Msg(err.Error())
-			}
-			gologger.Print().Msgf("%v\n\n", output)
+		if !options.HideReleaseNotes {
+			printReleaseNotes(notes, options.ReleaseNotesStyle)
 		}
-		os.Exit(0)
+		return nil
 	}
 }
 
-// GetToolVersionCallback returns a callback function that checks for updates of tool
-// by sending a request to update check endpoint and returns latest version
-// if repoName is empty then tool name is considered as repoName
-func GetToolVersionCallback(toolName, repoName string) func() (string, error) {
-	return func() (string, error) {
-		if repoName == "" {
-			repoName = toolName
+// dryRunUpdate prints the update of toolName from current to latest resolved by gh, cmp is their comparison,
+// and returns ErrUpdateAvailable
+func dryRunUpdate(gh *GHReleaseDownloader, toolName, current, latest string, cmp int, breaking bool) error {
+	if err := gh.getToolAssetID(gh.Latest); err != nil {
+		return err
+	}
+	var size int64
+	for _, asset := range gh.Latest.Assets {
+		if asset.GetID() == int64(gh.AssetID) {
+			size = int64(asset.GetSize())
 		}
-		gh, err := NewghReleaseDownloader(repoName)
-		if err != nil {
-			return "", errorutil.NewWithErr(err).Msgf("failed to download latest release got %v", err).WithTag("updater")
+	}
+	action := "update"
+	if cmp == 0 {
+		action = "reinstall"
+	} else if cmp > 0 {
+		action = "downgrade"
+	}
+	summary := fmt.Sprintf("would %v %v %v -> %v (asset %v, %v) from %v", action, toolName, taggedVersion(current), taggedVersion(latest), gh.fullAssetName, formatBytes(size), gh.SourceURL())
+	if breaking {
+		summary += ", the release notes contain breaking changes"
+	}
+	updateLog.Info().Label("dry-run").Msg(summary)
+	return newUpdateError(ErrUpdateAvailable, "%v", summary)
+}
 
+// applyUpdate replaces the executable of opts with bin. When replacing it fails the previous executable is
+// restored, rollbackErr is set when restoring it failed too
+func applyUpdate(bin []byte, opts selfupdate.Options) (err, rollbackErr error) {
+	if err := selfupdate.PrepareAndCheckBinary(bytes.NewReader(bin), opts); err != nil {
+		return err, nil
+	}
+	injected := failpoint(FailpointApply)
+	if injected != nil {
+		// 删除准备好的新文件, 替换失败后由 selfupdate 回滚
+		target := opts.TargetPath
+		if target == "" {
+			target, _ = os.Executable()
 		}
-		gh.SetToolName(toolName)
-		latestVersion, err := semver.NewVersion(gh.Latest.GetTagName())
-		if err != nil {
-			return "", errorutil.NewWithErr(err).Msgf("failed to parse semversion from tagname `%v` got %v", gh.Latest.GetTagName(), err).WithTag("updater")
+		_ = os.Remove(filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".new"))
+	}
+	err = selfupdate.CommitBinary(opts)
+	rollbackErr = selfupdate.RollbackError(err)
+	if err != nil && rollbackErr == nil {
+		rollbackErr = failpoint(FailpointRollback)
+	}
+	if err == nil && injected == nil {
+		target := opts.TargetPath
+		if target == "" {
+			target, _ = os.Executable()
 		}
-		return latestVersion.String(), nil
+		// windows 上替换后的旧版本可能仍被占用
+		removeOldBinaries(target)
+	}
+	if injected != nil {
+		err = injected
+	}
+	return err, rollbackErr
+}
+
+// recordOutdated emits the metrics of a performed version check
+func recordOutdated(toolName string, outdated bool) {
+	labels := map[string]string{"tool": toolName}
+	if outdated {
+		getMetrics().SetGauge(MetricUpdateAvailable, 1, labels)
+		getMetrics().IncCounter(MetricOutdated, labels)
+	} else {
+		getMetrics().SetGauge(MetricUpdateAvailable, 0, labels)
+	}
+}
 
+// GetToolVersionCallback returns a callback function that checks for updates of tool
+// by sending a request to update check endpoint and returns latest version
+// if repoName is empty then tool name is considered as repoName. The latest version is reused for
+// VersionCheckTTL like GetCachedLatestVersion, unless DisableVersionCache. See GetVersionCheckCallback for
+// whether the current version is outdated. An exhausted api rate limit is an *ErrRateLimited, callers
+// may skip the check on it, like ErrUpdateCheckDisabled
+func GetToolVersionCallback(toolName, repoName string) func() (string, error) {
+	return func() (string, error) {
+		return GetCachedLatestVersion(toolName, repoName)
 	}
 }
 
 func GetUpdateDirFromRepoNoErrCallback(toolName, dir, repoName string) func() {
 	return func() {
-		if err := GetUpdateDirFromRepoCallback(toolName, dir, repoName)(); err != nil {
-			gologger.Fatal().Msgf("failed to update %v got %v", toolName, err)
+		err := GetUpdateDirFromRepoCallback(toolName, dir, repoName)()
+		if errors.Is(err, ErrUpdateCheckDisabled) {
+			return
+		}
+		if isRateLimited(err) {
+			updateLog.Fatal().Label("updater").Msgf("could not update %v: %v", toolName, err)
+			return
+		}
+		if err != nil {
+			updateLog.Fatal().Msgf("failed to update %v got %v", toolName, err)
 		}
 	}
 
 }
 
 func GetUpdateDirFromRepoCallback(toolName, dir, repoName string) func() error {
+	return GetUpdateDirFromRepoWithOptionsCallback(toolName, dir, repoName, nil)
+}
+
+// GetUpdateDirFromRepoCallbackCtx is GetUpdateDirFromRepoCallback aborting the update when ctx is done
+func GetUpdateDirFromRepoCallbackCtx(ctx context.Context, toolName, dir, repoName string) func() error {
+	return GetUpdateDirFromRepoWithOptionsCallbackCtx(ctx, toolName, dir, repoName, nil)
+}
+
+// GetUpdateDirFromRepoToVersionCallback returns a callback updating dir from the source of the release of
+// repoName tagged targetTag, also when it is older than the installed one
+func GetUpdateDirFromRepoToVersionCallback(toolName, dir, repoName, targetTag string) func() error {
+	return GetUpdateDirFromRepoWithOptionsCallback(toolName, dir, repoName, &DirUpdateOptions{Tag: targetTag})
+}
+
+// GetUpdateDirFromRepoCheckCallback returns a callback listing the files an update of dir from the latest
+// release would write and skip, without writing them. It returns ErrUpdateAvailable, or ErrAlreadyLatest when
+// dir is up to date
+func GetUpdateDirFromRepoCheckCallback(toolName, dir, repoName string) func() error {
 	return func() error {
-		if repoName == "" {
-			repoName = toolName
-		}
-		downloader, err := NewghReleaseDownloader(repoName)
+		changes, err := UpdateDirFromRepo(toolName, dir, repoName, &DirUpdateOptions{DryRun: true})
 		if err != nil {
-			return errorutil.NewWithErr(err).Msgf("failed to download latest release got %v", err).WithTag("updater")
+			return err
 		}
-		callback := func(path string, f fs.FileInfo, data io.Reader) error {
-			templateAbsolutePath, skipFile, err := calculateTemplateAbsolutePath(path, dir)
-			if err != nil {
-				return err
-			}
-			if skipFile {
-				return nil
-			}
-			bin, err := io.ReadAll(data)
-			if err != nil {
-				// if error occurs, iteration also stops
-				return errorutil.NewWithErr(err).Msgf("failed to read file %s", templateAbsolutePath)
-			}
-			return os.WriteFile(templateAbsolutePath, bin, f.Mode())
+		return dryRunDirUpdate(toolName, dir, changes)
+	}
+}
+
+// dryRunDirUpdate prints changes of the update of dir and returns ErrUpdateAvailable when it isn't empty
+func dryRunDirUpdate(toolName, dir string, changes *DirChangeSet) error {
+	if changes.IsEmpty() {
+		updateLog.Info().Label("dry-run").Msgf("%v in %v is up to date, %d files unchanged", toolName, dir, len(changes.Unchanged))
+		return newUpdateError(ErrAlreadyLatest, "%v in %v is up to date", toolName, dir)
+	}
+	summary := fmt.Sprintf("would write %d files (%v) to %v, skip %d unchanged and keep %d not in the release",
+		len(changes.Added)+len(changes.Modified), formatBytes(changes.Bytes), dir, len(changes.Unchanged), len(changes.Deleted)-len(changes.Pruned))
+	if len(changes.Pruned) > 0 {
+		summary += fmt.Sprintf(", prune %d", len(changes.Pruned))
+	}
+	updateLog.Info().Label("dry-run").Msg(summary)
+	for _, path := range changes.Added {
+		updateLog.Info().Label("dry-run").Msgf("  + %v", path)
+	}
+	for _, path := range changes.Modified {
+		updateLog.Info().Label("dry-run").Msgf("  ~ %v", path)
+	}
+	pruned := make(map[string]bool, len(changes.Pruned))
+	for _, path := range changes.Pruned {
+		pruned[path] = true
+	}
+	for _, path := range changes.Deleted {
+		if pruned[path] {
+			updateLog.Info().Label("dry-run").Msgf("  - %v (pruned)", path)
+		} else {
+			updateLog.Info().Label("dry-run").Msgf("  - %v (kept)", path)
 		}
-		if err = downloader.DownloadSourceWithCallback(false, callback); err != nil {
-			return errorutil.NewWithErr(err).Msgf("failed to download latest release got %v", err)
+	}
+	return newUpdateError(ErrUpdateAvailable, "%v update: %v", toolName, summary)
+}
+
+// GetUpdateDirFromRepoWithOptionsCallback returns a callback updating dir from the latest release source with opts
+func GetUpdateDirFromRepoWithOptionsCallback(toolName, dir, repoName string, opts *DirUpdateOptions) func() error {
+	return GetUpdateDirFromRepoWithOptionsCallbackCtx(context.Background(), toolName, dir, repoName, opts)
+}
+
+// GetUpdateDirFromRepoWithOptionsCallbackCtx is GetUpdateDirFromRepoWithOptionsCallback aborting the update when ctx is done
+func GetUpdateDirFromRepoWithOptionsCallbackCtx(ctx context.Context, toolName, dir, repoName string, opts *DirUpdateOptions) func() error {
+	return func() error {
+		changes, err := UpdateDirFromRepoCtx(ctx, toolName, dir, repoName, opts)
+		if err == nil && opts.options().DryRun {
+			return dryRunDirUpdate(toolName, dir, changes)
 		}
-		return nil
+		return err
 	}
 }
+
+// ErrUnsafeArchivePath is returned for an archive entry which would be written outside of the directory updated
+// from the archive, matched with errors.Is
+var ErrUnsafeArchivePath = errorutil.NewWithTag("updater", "unsafe archive entry path")
+
+// calculateTemplateAbsolutePath returns the path zipFilePath is written to in configuredTemplateDirectory, creating
+// its directory. Entries resolving outside of configuredTemplateDirectory are ErrUnsafeArchivePath
 func calculateTemplateAbsolutePath(zipFilePath, configuredTemplateDirectory string) (string, bool, error) {
+	templateAbsolutePath, skipFile, err := resolveTemplatePath(zipFilePath, configuredTemplateDirectory)
+	if err != nil || skipFile {
+		return "", skipFile, err
+	}
+	if err := makeTemplateDir(filepath.Dir(templateAbsolutePath)); err != nil {
+		return "", false, err
+	}
+	return templateAbsolutePath, false, nil
+}
+
+// makeTemplateDir creates the template folder templateDirectory
+func makeTemplateDir(templateDirectory string) error {
+	if err := os.MkdirAll(templateDirectory, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create template folder: %s. %w", templateDirectory, err)
+	}
+	return nil
+}
+
+// resolveTemplatePath is calculateTemplateAbsolutePath without creating the directory
+func resolveTemplatePath(zipFilePath, configuredTemplateDirectory string) (string, bool, error) {
+	if err := checkArchivePath(zipFilePath); err != nil {
+		return "", false, err
+	}
+	relativePath, skipFile := calculateTemplateRelativePath(zipFilePath)
+	if skipFile {
+		return "", true, nil
+	}
+	root, err := filepath.Abs(configuredTemplateDirectory)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to resolve template folder: %s. %w", configuredTemplateDirectory, err)
+	}
+	templateAbsolutePath := filepath.Join(root, relativePath)
+	if rel, err := filepath.Rel(root, templateAbsolutePath); err != nil || !filepath.IsLocal(rel) {
+		return "", false, newUpdateError(ErrUnsafeArchivePath, "archive entry %v resolves to %v, outside of %v", zipFilePath, templateAbsolutePath, root)
+	}
+	return templateAbsolutePath, false, nil
+}
+
+// checkArchivePath rejects absolute archive entry names, with a drive letter and climbing above the archive root
+// with .., with both / and \ separators whatever the host os
+func checkArchivePath(name string) error {
+	slashed := strings.ReplaceAll(name, "\\", "/")
+	switch {
+	case strings.HasPrefix(slashed, "/"):
+		return newUpdateError(ErrUnsafeArchivePath, "archive entry %v is an absolute path", name)
+	case len(slashed) >= 2 && slashed[1] == ':' && (slashed[0]|0x20 >= 'a' && slashed[0]|0x20 <= 'z'):
+		return newUpdateError(ErrUnsafeArchivePath, "archive entry %v has a drive letter", name)
+	}
+	depth := 0
+	for _, part := range strings.Split(slashed, "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if depth--; depth < 0 {
+				return newUpdateError(ErrUnsafeArchivePath, "archive entry %v climbs above the archive root", name)
+			}
+		default:
+			depth++
+		}
+	}
+	return nil
+}
+
+// calculateTemplateRelativePath returns the path of an archive file relative to the archive root
+func calculateTemplateRelativePath(zipFilePath string) (string, bool) {
 	directory, fileName := filepath.Split(zipFilePath)
 
 	if !strings.EqualFold(fileName, ".version") {
 		if strings.TrimSpace(fileName) == "" || strings.HasPrefix(fileName, ".") || strings.EqualFold(fileName, "README.md") {
-			return "", true, nil
+			return "", true
 		}
 	}
 
@@ -192,43 +623,103 @@ func calculateTemplateAbsolutePath(zipFilePath, configuredTemplateDirectory stri
 	relativeDirectoryPathWithoutZipRoot = filepath.Join(directoryPathChunks[1:]...)
 
 	if strings.HasPrefix(relativeDirectoryPathWithoutZipRoot, ".") {
-		return "", true, nil
+		return "", true
 	}
 
-	templateDirectory := filepath.Join(configuredTemplateDirectory, relativeDirectoryPathWithoutZipRoot)
+	return filepath.Join(relativeDirectoryPathWithoutZipRoot, fileName), false
+}
 
-	if err := os.MkdirAll(templateDirectory, os.ModePerm); err != nil {
-		return "", false, fmt.Errorf("failed to create template folder: %s. %w", templateDirectory, err)
+// reservedCheckParams are the update check parameters set by GetpdtmParams
+var reservedCheckParams = []string{"os", "arch", "go_version", "v", "machine_id"}
+
+var (
+	// machineIDAppKey is the app key the machine id is hashed with, see SetMachineIDAppKey
+	machineIDAppKey = "pdtm"
+	// extraCheckParams are the parameters of the tool added to the update check, see SetExtraCheckParams
+	extraCheckParams map[string]string
+	checkParamKey    = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// SetMachineIDAppKey sets the app key the machine id sent by GetpdtmParams is hashed with, giving the tool
+// its own id namespace. Empty restores the default pdtm key
+func SetMachineIDAppKey(key string) {
+	if key = strings.TrimSpace(key); key == "" {
+		key = "pdtm"
 	}
+	machineIDAppKey = key
+}
 
-	return filepath.Join(templateDirectory, fileName), false, nil
+// SetExtraCheckParams sets parameters of the tool added by GetpdtmParams, e.g. an edition or a channel. Keys
+// are letters, digits, '_', '.' and '-', the reserved os, arch, go_version, v and machine_id keys are
+// refused. Nil removes them
+func SetExtraCheckParams(params map[string]string) error {
+	for key := range params {
+		if !checkParamKey.MatchString(key) {
+			return errorutil.NewWithTag("updater", "invalid update check parameter %q", key)
+		}
+		for _, reserved := range reservedCheckParams {
+			if strings.EqualFold(key, reserved) {
+				return errorutil.NewWithTag("updater", "update check parameter %q is reserved", key)
+			}
+		}
+	}
+	extraCheckParams = make(map[string]string, len(params))
+	for key, value := range params {
+		extraCheckParams[key] = value
+	}
+	return nil
 }
 
-// GetpdtmParams returns encoded query parameters sent to update check endpoint
+// GetpdtmParams returns encoded query parameters sent to update check endpoint, only the version with
+// MinimalCheck and without the machine id when telemetry is disabled
 func GetpdtmParams(version string) string {
 	params := &url.Values{}
-	params.Add("os", runtime.GOOS)
-	params.Add("arch", runtime.GOARCH)
-	params.Add("go_version", runtime.Version())
+	if !MinimalCheck {
+		params.Add("os", runtime.GOOS)
+		params.Add("arch", runtime.GOARCH)
+		params.Add("go_version", runtime.Version())
+		for key, value := range extraCheckParams {
+			params.Add(key, value)
+		}
+	}
 	params.Add("v", version)
-	params.Add("machine_id", buildMachineId())
+	if !MinimalCheck && !telemetryDisabled() {
+		params.Add("machine_id", buildMachineId())
+	}
 	return params.Encode()
 }
 
+// updateCheckDisabled returns ErrUpdateCheckDisabled, logging it, when DisableUpdateCheck or
+// DisableUpdateCheckEnv disable the update checks of toolName, nil otherwise
+func updateCheckDisabled(toolName string) error {
+	reason := "disabled"
+	if !DisableUpdateCheck {
+		disabled, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(DisableUpdateCheckEnv)))
+		if err != nil || !disabled {
+			return nil
+		}
+		reason = "disabled by environment (" + DisableUpdateCheckEnv + ")"
+	}
+	updateLog.Info().Label("updater").Msgf("update check of %v %v", toolName, reason)
+	return newUpdateError(ErrUpdateCheckDisabled, "update check of %v %v", toolName, reason)
+}
+
+// telemetryDisabled reports whether DisableTelemetry or NoTelemetryEnv disable the machine id
+func telemetryDisabled() bool {
+	if DisableTelemetry {
+		return true
+	}
+	disabled, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(NoTelemetryEnv)))
+	return err == nil && disabled
+}
+
 func buildMachineId() string {
-	machineId, err := machineid.ProtectedID("pdtm")
+	if DisableMachineID {
+		return "unknown"
+	}
+	machineId, err := machineid.ProtectedID(machineIDAppKey)
 	if err != nil {
 		return "unknown"
 	}
 	return machineId
 }
-
-func init() {
-	DefaultHttpClient = &http.Client{
-		Timeout: VersionCheckTimeout,
-		Transport: &http.Transport{
-			Proxy:           http.ProxyFromEnvironment,
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
-}
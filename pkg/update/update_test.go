@@ -0,0 +1,177 @@
+package updateutils
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/denisbrodbeck/machineid"
+)
+
+func TestGetUpdateToolCallbackWithError(t *testing.T) {
+	hideProgressBar(t)
+	hideReleaseNotes := HideReleaseNotes
+	HideReleaseNotes = true
+	defer func() { HideReleaseNotes = hideReleaseNotes }()
+	tests := []struct {
+		name       string
+		version    string
+		steps      string
+		force      bool
+		err        error
+		wantBinary string
+	}{
+		{name: "latest", version: "1.1.0", err: ErrAlreadyLatest, wantBinary: "old"},
+		{name: "updated", version: "1.0.0", wantBinary: "bin-chaos"},
+		// 已是最新版本时重新安装
+		{name: "reinstalled", version: "1.1.0", force: true, wantBinary: "bin-chaos"},
+		{name: "apply failed", version: "1.0.0", steps: FailpointApply, err: ErrApplyFailed, wantBinary: "old"},
+		// 回滚也失败
+		{name: "rollback failed", version: "1.0.0", steps: FailpointRollback, err: ErrRollbackFailed, wantBinary: "old"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newFakeGitHub(t)
+			fake.AddRelease(Organization+"/chaos", newToolRelease(t, "chaos", "v1.1.0", []byte("bin-chaos")))
+			enableFailpoints(t, test.steps)
+			force := ForceUpdate
+			ForceUpdate = test.force
+			defer func() { ForceUpdate = force }()
+			target := fakeExecutable(t, "chaos")
+
+			// 在 goroutine 中调用, 不会退出进程
+			errs := make(chan error)
+			go func() { errs <- GetUpdateToolCallbackWithError("chaos", test.version)() }()
+			if err := <-errs; !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("update = %v, want %v", err, test.err)
+			}
+			if data, _ := os.ReadFile(target); string(data) != test.wantBinary {
+				t.Errorf("executable = %q, want %q", data, test.wantBinary)
+			}
+		})
+	}
+}
+
+func TestGetUpdateToolCallbackWithErrorPermission(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/chaos", newToolRelease(t, "chaos", "v1.1.0", []byte("bin-chaos")))
+	executable := executablePath
+	executablePath = func() (string, error) { return filepath.Join(blockedDir(t), "chaos"), nil }
+	defer func() { executablePath = executable }()
+	if err := GetUpdateToolCallbackWithError("chaos", "1.0.0")(); !errors.Is(err, ErrPermission) || errors.Is(err, ErrApplyFailed) {
+		t.Errorf("update into a missing dir = %v, want %v", err, ErrPermission)
+	}
+}
+
+func TestGetUpdateToolCheckCallback(t *testing.T) {
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/chaos", newToolRelease(t, "chaos", "v1.1.0", []byte("bin-chaos")))
+	// 演练时不应下载资源
+	fake.DownloadURL = "http://127.0.0.1:1"
+	target := fakeExecutable(t, "chaos")
+
+	err := GetUpdateToolCheckCallback("chaos", "1.0.0", "")()
+	if !errors.Is(err, ErrUpdateAvailable) {
+		t.Fatalf("GetUpdateToolCheckCallback() = %v, want %v", err, ErrUpdateAvailable)
+	}
+	name := platformAssetName("chaos", "v1.1.0", Tar)
+	if want := "would update chaos v1.0.0 -> v1.1.0 (asset " + name; !strings.Contains(err.Error(), want) {
+		t.Errorf("GetUpdateToolCheckCallback() = %v, want %q", err, want)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "old" {
+		t.Errorf("dry run replaced the executable with %q", data)
+	}
+	if err := GetUpdateToolCheckCallback("chaos", "1.1.0", "")(); !errors.Is(err, ErrAlreadyLatest) {
+		t.Errorf("GetUpdateToolCheckCallback() when up to date = %v, want %v", err, ErrAlreadyLatest)
+	}
+	executablePath = func() (string, error) { return filepath.Join(blockedDir(t), "chaos"), nil }
+	if err := GetUpdateToolCheckCallback("chaos", "1.0.0", "")(); !errors.Is(err, ErrPermission) {
+		t.Errorf("GetUpdateToolCheckCallback() of a read-only install = %v, want %v", err, ErrPermission)
+	}
+}
+
+func TestGetpdtmParams(t *testing.T) {
+	disable, minimal := DisableTelemetry, MinimalCheck
+	defer func() { DisableTelemetry, MinimalCheck = disable, minimal }()
+	tests := []struct {
+		name     string
+		disable  bool
+		minimal  bool
+		env      string
+		wantKeys []string
+	}{
+		{name: "default", wantKeys: []string{"arch", "go_version", "machine_id", "os", "v"}},
+		{name: "telemetry disabled", disable: true, wantKeys: []string{"arch", "go_version", "os", "v"}},
+		{name: "env", env: "1", wantKeys: []string{"arch", "go_version", "os", "v"}},
+		{name: "env false", env: "false", wantKeys: []string{"arch", "go_version", "machine_id", "os", "v"}},
+		{name: "minimal", minimal: true, wantKeys: []string{"v"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(NoTelemetryEnv, test.env)
+			DisableTelemetry, MinimalCheck = test.disable, test.minimal
+			params, err := url.ParseQuery(GetpdtmParams("1.0.2"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for key := range params {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, test.wantKeys) {
+				t.Errorf("GetpdtmParams() keys = %v, want %v", keys, test.wantKeys)
+			}
+			if params.Get("v") != "1.0.2" {
+				t.Errorf("GetpdtmParams() v = %q, want 1.0.2", params.Get("v"))
+			}
+		})
+	}
+}
+
+func TestExtraCheckParams(t *testing.T) {
+	defer func() { _ = SetExtraCheckParams(nil) }()
+	// 没有额外参数时与原有编码完全一致
+	want := url.Values{"os": {runtime.GOOS}, "arch": {runtime.GOARCH}, "go_version": {runtime.Version()}, "v": {"1.0.2"}, "machine_id": {buildMachineId()}}.Encode()
+	if got := GetpdtmParams("1.0.2"); got != want {
+		t.Errorf("GetpdtmParams() = %q, want %q", got, want)
+	}
+	for _, key := range []string{"v", "OS", "machine_id", "a b", "x&v=2", ""} {
+		if err := SetExtraCheckParams(map[string]string{key: "1"}); err == nil {
+			t.Errorf("SetExtraCheckParams(%q) succeeded, want an error", key)
+		}
+	}
+	if err := SetExtraCheckParams(map[string]string{"edition": "pro & co", "channel": "beta"}); err != nil {
+		t.Fatal(err)
+	}
+	params, err := url.ParseQuery(GetpdtmParams("1.0.2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Get("edition") != "pro & co" || params.Get("channel") != "beta" || params.Get("v") != "1.0.2" {
+		t.Errorf("GetpdtmParams() with extra parameters = %v", params)
+	}
+}
+
+func TestSetMachineIDAppKey(t *testing.T) {
+	defer SetMachineIDAppKey("")
+	if _, err := machineid.ID(); err != nil {
+		t.Skipf("no machine id: %v", err)
+	}
+	pdtm := buildMachineId()
+	SetMachineIDAppKey("jaudit")
+	if got := buildMachineId(); got == pdtm {
+		t.Errorf("machine id with app key jaudit = %v, want it to differ from the pdtm one", got)
+	}
+	SetMachineIDAppKey("")
+	if got := buildMachineId(); got != pdtm {
+		t.Errorf("machine id after reset = %v, want %v", got, pdtm)
+	}
+}
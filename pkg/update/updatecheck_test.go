@@ -0,0 +1,69 @@
+package updateutils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDisableUpdateCheck(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/checked", newToolRelease(t, "checked", "v1.0.0", []byte("bin")))
+	fake.AddRelease(Organization+"/templates", newTemplatesRelease(t))
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fake.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	githubBaseURL, _ = url.Parse(server.URL + "/api/")
+	UpdateSourceAllowlist = append(UpdateSourceAllowlist, trustedSource(Organization+"/checked"), trustedSource(Organization+"/templates"))
+
+	callbacks := map[string]func() error{
+		"GetToolVersionCallback": func() error {
+			_, err := GetToolVersionCallback("checked", "")()
+			return err
+		},
+		"GetVersionCheckCallback": func() error {
+			_, err := GetVersionCheckCallback("checked", "0.9.0", "")()
+			return err
+		},
+		"GetUpdateToolFromRepoCallbackWithError": GetUpdateToolFromRepoCallbackWithError("checked", "0.9.0", ""),
+		"GetUpdateToolCheckCallback":             GetUpdateToolCheckCallback("checked", "0.9.0", ""),
+		"GetUpdateDirFromRepoCallback":           GetUpdateDirFromRepoCallback("templates", t.TempDir(), ""),
+		"GetUpdateDirFromAssetCallback":          GetUpdateDirFromAssetCallback("templates", t.TempDir(), "", "templates.zip"),
+	}
+	disable := map[string]func(t *testing.T){
+		"environment": func(t *testing.T) { t.Setenv(DisableUpdateCheckEnv, "true") },
+		"variable": func(t *testing.T) {
+			DisableUpdateCheck = true
+			t.Cleanup(func() { DisableUpdateCheck = false })
+		},
+	}
+	for how, set := range disable {
+		t.Run(how, func(t *testing.T) {
+			set(t)
+			for name, callback := range callbacks {
+				err := callback()
+				if !errors.Is(err, ErrUpdateCheckDisabled) || errors.Is(err, ErrAlreadyLatest) {
+					t.Errorf("%v() = %v, want %v", name, err, ErrUpdateCheckDisabled)
+				}
+			}
+			if n := requests.Load(); n != 0 {
+				t.Errorf("got %d requests with the update check disabled, want none", n)
+			}
+		})
+	}
+
+	t.Setenv(DisableUpdateCheckEnv, "false")
+	if _, err := GetToolVersionCallback("checked", "")(); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() == 0 {
+		t.Errorf("no request with the update check enabled")
+	}
+}
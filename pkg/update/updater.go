@@ -0,0 +1,260 @@
+package updateutils
+
+import (
+	"context"
+	"fmt"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"github.com/remeh/sizedwaitgroup"
+	"github.com/wjlin0/CVE-2024-23897/pkg/atomicfile"
+	"github.com/wjlin0/CVE-2024-23897/pkg/credential"
+	"github.com/wjlin0/CVE-2024-23897/pkg/egress"
+	"path/filepath"
+	"time"
+)
+
+// ErrBreakingChangesNotConfirmed is returned when an update with breaking changes was not confirmed
+var ErrBreakingChangesNotConfirmed = errorutil.NewWithTag("updater", "update contains breaking changes and was not confirmed")
+
+// Updater updates a batch of tools, the github api calls of all its downloaders share one limiter
+type Updater struct {
+	// APIRequestsPerMinute limits github api calls, zero uses a default depending on the github-token credential
+	// and a negative value disables the limit
+	APIRequestsPerMinute int
+	// Concurrency is the number of tools updated at once, asset downloads are not limited
+	// and run while other tools wait on the api limiter
+	Concurrency int
+	// ConfirmBreaking is asked before installing a release with breaking changes, nil installs it
+	ConfirmBreaking func(result *UpdateResult) bool
+
+	limiter *apiLimiter
+}
+
+// UpdateResult is the result of updating a single tool
+type UpdateResult struct {
+	Tool Tool
+	// Source is the enforced org/repo the release is downloaded from
+	Source  string
+	Latest  string
+	Updated bool
+	Path    string
+	// ReleaseNotes are the latest release notes with the breaking changes highlighted
+	ReleaseNotes string
+	// BreakingChanges is true when the release notes contain breaking changes
+	BreakingChanges bool
+	// Cached is true when the asset was read from the asset cache instead of downloaded
+	Cached bool
+	// Deferred is true when the tool is outdated but its update was deferred by the rollout, not an error
+	Deferred bool
+	Rollout  Rollout
+	// Egress is the bytes exchanged with github for the tool per category
+	Egress map[string]egress.Usage
+	Err    error
+}
+
+// BatchSummary is the result of UpdateTools
+type BatchSummary struct {
+	Results []*UpdateResult
+	// APIRequests is the number of github api requests made
+	APIRequests int64
+	// Throttled is the total time github api requests waited on the limiter
+	Throttled time.Duration
+}
+
+// NewUpdater returns an Updater with the default limits
+func NewUpdater() *Updater {
+	return &Updater{Concurrency: 4}
+}
+
+func (u *Updater) apiLimiter() *apiLimiter {
+	if u.limiter == nil {
+		perMinute := u.APIRequestsPerMinute
+		if perMinute == 0 {
+			perMinute = DefaultAnonymousAPIRequestsPerMinute
+			if token, _ := credential.Get(credential.GitHubToken); token != "" {
+				perMinute = DefaultAuthenticatedAPIRequestsPerMinute
+			}
+		}
+		u.limiter = newAPILimiter(context.Background(), perMinute)
+	}
+	return u.limiter
+}
+
+// NewDownloader returns a release downloader whose github api calls wait on the updater limiter
+func (u *Updater) NewDownloader(repoName string) (*GHReleaseDownloader, error) {
+	return newghReleaseDownloader(context.Background(), repoName, u.apiLimiter())
+}
+
+// UpdateTools installs the latest release of every outdated tool into dir
+func (u *Updater) UpdateTools(ctx context.Context, tools []Tool, dir string) *BatchSummary {
+	limiter := u.apiLimiter()
+	startRequests, startThrottled := limiter.Requests(), limiter.Throttled()
+
+	concurrency := u.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	summary := &BatchSummary{Results: make([]*UpdateResult, len(tools))}
+	wg := sizedwaitgroup.New(concurrency)
+	for i, tool := range tools {
+		wg.Add()
+		go func(i int, tool Tool) {
+			defer wg.Done()
+			summary.Results[i] = u.updateTool(ctx, tool, dir)
+		}(i, tool)
+	}
+	wg.Wait()
+
+	summary.APIRequests = limiter.Requests() - startRequests
+	summary.Throttled = limiter.Throttled() - startThrottled
+	updateLog.Info().Label("updater").Msgf("%s", summary)
+	return summary
+}
+
+// Close releases the updater limiter
+func (u *Updater) Close() {
+	if u.limiter != nil {
+		u.limiter.Stop()
+	}
+}
+
+func (u *Updater) updateTool(ctx context.Context, tool Tool, dir string) *UpdateResult {
+	result := &UpdateResult{Tool: tool}
+	if err := ctx.Err(); err != nil {
+		result.Err = err
+		return result
+	}
+	repoName := tool.Repo
+	if repoName == "" {
+		repoName = tool.Name
+	}
+	var err error
+	result.Source, err = EnforceUpdateSource(repoName)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	// 取消 ctx 时中止正在进行的下载
+	gh, err := newghReleaseDownloader(ctx, result.Source, u.apiLimiter())
+	if isRateLimited(err) {
+		result.Err = err
+		return result
+	}
+	if err != nil {
+		result.Err = errorutil.NewWithErr(err).Msgf("failed to download latest release of %v", tool.Name)
+		return result
+	}
+	defer func() { result.Egress = gh.Egress() }()
+	gh.SetToolName(tool.Name)
+	gh.SetAssetBaseName(tool.AssetBaseName)
+	gh.SetExecutableName(tool.ExecutableName)
+	if err := gh.SetAssetPattern(tool.AssetPattern); err != nil {
+		result.Err = err
+		return result
+	}
+	result.Latest = gh.Latest.GetTagName()
+	outdated := tool.Version == ""
+	if !outdated {
+		cmp, _, err := gh.compareVersion(tool.Version)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		outdated = cmp < 0
+	}
+	recordOutdated(tool.Name, outdated)
+	if !outdated {
+		return result
+	}
+	patterns := tool.BreakingChangePatterns
+	if patterns == nil {
+		patterns = BreakingChangePatterns
+	}
+	result.ReleaseNotes, result.BreakingChanges, err = HighlightBreakingChanges(gh.releaseNotes(tool.Version, result.Latest), patterns)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if result.Rollout, err = gh.Rollout(); err != nil {
+		result.Err = err
+		return result
+	}
+	if result.Rollout.Deferred() {
+		result.Deferred = true
+		updateLog.Info().Label("updater").Msgf("update of %v %v -> %v %v", tool.Name, tool.Version, result.Latest, result.Rollout)
+		return result
+	}
+	if result.BreakingChanges && u.ConfirmBreaking != nil && !u.ConfirmBreaking(result) {
+		result.Err = ErrBreakingChangesNotConfirmed
+		return result
+	}
+	if err := CheckInstallDir(dir); err != nil {
+		result.Err = err
+		return result
+	}
+	bin, err := gh.GetExecutableFromAssetCtx(ctx)
+	result.Cached = gh.Cached()
+	if integrityError(err) || isRateLimited(err) {
+		result.Err = err
+		return result
+	}
+	if err != nil {
+		result.Err = errorutil.NewWithErr(err).Msgf("executable %v not found in release asset", gh.ExecutableName())
+		return result
+	}
+	result.Path = filepath.Join(dir, gh.ExecutableName())
+	if err = failpoint(FailpointApply); err == nil {
+		err = atomicfile.WriteFile(result.Path, bin, 0755)
+	}
+	getMetrics().IncCounter(MetricApplies, map[string]string{"tool": tool.Name, "result": resultLabel(err)})
+	if err != nil {
+		result.Err = errorutil.NewWithErr(err).Msgf("failed to write %v", result.Path)
+		return result
+	}
+	result.Updated = true
+	updateLog.Info().Label("updater").Msgf("%v sucessfully updated %v -> %v from %v (%v)", gh.ExecutableName(), tool.Version, result.Latest, result.Source, result.Path)
+	return result
+}
+
+// ConfirmBreakingInteractively asks on stdin before installing a release with breaking changes
+func ConfirmBreakingInteractively(result *UpdateResult) bool {
+	updateLog.Print().Msgf("%v\n", result.ReleaseNotes)
+	return confirm(fmt.Sprintf("%v %v contains breaking changes, update anyway?", result.Tool.Name, result.Latest))
+}
+
+// Updated returns the number of tools updated
+func (s *BatchSummary) Updated() (updated int) {
+	for _, result := range s.Results {
+		if result != nil && result.Updated {
+			updated++
+		}
+	}
+	return
+}
+
+// Deferred returns the number of outdated tools whose update was deferred by the rollout
+func (s *BatchSummary) Deferred() (deferred int) {
+	for _, result := range s.Results {
+		if result != nil && result.Deferred {
+			deferred++
+		}
+	}
+	return
+}
+
+// CacheHits returns the number of tools whose asset was read from the asset cache
+func (s *BatchSummary) CacheHits() (hits int) {
+	for _, result := range s.Results {
+		if result != nil && result.Cached {
+			hits++
+		}
+	}
+	return
+}
+
+func (s *BatchSummary) String() string {
+	summary := fmt.Sprintf("%d/%d tools updated, %d asset cache hits, %d github api requests, throttled %s", s.Updated(), len(s.Results), s.CacheHits(), s.APIRequests, s.Throttled.Round(time.Millisecond))
+	if deferred := s.Deferred(); deferred != 0 {
+		summary += fmt.Sprintf(", %d deferred by rollout policy", deferred)
+	}
+	return summary
+}
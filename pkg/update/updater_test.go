@@ -0,0 +1,55 @@
+package updateutils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateToolsSharedLimiter(t *testing.T) {
+	hideProgressBar(t)
+	fake := newFakeGitHub(t)
+	var tools []Tool
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("tool%d", i)
+		fake.AddRelease(Organization+"/"+name, newToolRelease(t, name, "v1.1.0", []byte("bin-"+name)))
+		version := "1.0.0"
+		if i%2 == 1 {
+			version = "1.1.0"
+		}
+		tools = append(tools, Tool{Name: name, Version: version})
+	}
+
+	updater := &Updater{APIRequestsPerMinute: 3000, Concurrency: 3}
+	defer updater.Close()
+	dir := t.TempDir()
+	summary := updater.UpdateTools(context.Background(), tools, dir)
+
+	if summary.Updated() != 3 {
+		t.Errorf("Updated() = %d, want 3", summary.Updated())
+	}
+	for _, result := range summary.Results {
+		if result.Err != nil {
+			t.Errorf("%s: %v", result.Tool.Name, result.Err)
+			continue
+		}
+		if !result.Updated {
+			continue
+		}
+		bin, err := os.ReadFile(filepath.Join(dir, result.Tool.Name))
+		if err != nil || !bytes.Equal(bin, []byte("bin-"+result.Tool.Name)) {
+			t.Errorf("%s: installed %q, %v", result.Tool.Name, bin, err)
+		}
+	}
+	if summary.APIRequests != fake.apiRequests.Load() {
+		t.Errorf("summary APIRequests = %d, fake github got %d", summary.APIRequests, fake.apiRequests.Load())
+	}
+	// 3000/min 即每 20ms 一个 token, 超过 1 个请求必然被限流
+	if summary.Throttled <= 0 {
+		t.Errorf("summary Throttled = %v, want > 0", summary.Throttled)
+	}
+	t.Log(summary)
+}
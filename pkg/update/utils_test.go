@@ -2,6 +2,7 @@ package updateutils
 
 import (
 	"github.com/fatih/color"
+	"strings"
 	"testing"
 )
 
@@ -37,6 +38,26 @@ func TestGetVersionDescription(t *testing.T) {
 			latest:  "v2.9.2",
 			want:    "(outdated)",
 		},
+		{
+			current: "1.0.2",
+			latest:  "v1.0.2",
+			want:    "(latest)",
+		},
+		{
+			current: "v2.9.3",
+			latest:  "v2.9.2",
+			want:    "(development)",
+		},
+		{
+			current: "nightly",
+			latest:  "v2.9.2",
+			want:    "(unknown)",
+		},
+		{
+			current: "nightly",
+			latest:  "nightly",
+			want:    "(latest)",
+		},
 	}
 	for _, test := range tests {
 		if GetVersionDescription(test.current, test.latest) != test.want {
@@ -44,3 +65,16 @@ func TestGetVersionDescription(t *testing.T) {
 		}
 	}
 }
+
+func TestGetVersionDescriptionColor(t *testing.T) {
+	noColor := color.NoColor
+	defer func() { color.NoColor = noColor }()
+	color.NoColor = false
+	if got := GetVersionDescription("v2.9.1", "v2.9.2"); got == "(outdated)" || !strings.Contains(got, "outdated") {
+		t.Errorf("GetVersionDescription() = %q, want a colored outdated", got)
+	}
+	color.NoColor = true
+	if got := GetVersionDescription("v2.9.1", "v2.9.2"); got != "(outdated)" {
+		t.Errorf("GetVersionDescription() = %q, want (outdated)", got)
+	}
+}
@@ -0,0 +1,182 @@
+package updateutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+var (
+	// VersionCheckTTL is how long the latest version found by a version check is reused by GetCachedVersionDescription
+	VersionCheckTTL = 24 * time.Hour
+	// DisableVersionCache makes GetCachedLatestVersion and GetToolVersionCallback ask github on every call, the
+	// result is still recorded
+	DisableVersionCache = false
+
+	versionCheckMutex sync.Mutex
+	// versionChecks are the version checks of the tools of the machine
+	versionChecks = &stateFile{name: "versions.json"}
+)
+
+// versionCheck is the latest version of a tool found by a version check
+type versionCheck struct {
+	Latest  string    `json:"latest"`
+	Checked time.Time `json:"checked"`
+	// Repo is the source the version was found in, a check of another organization or forge is not reused
+	Repo string `json:"repo,omitempty"`
+}
+
+// VersionCheckResult is the latest release of a tool compared with the current version
+type VersionCheckResult struct {
+	CurrentVersion string `json:"current-version"`
+	// LatestVersion is the latest version without its v prefix, the raw tag when NonSemver
+	LatestVersion string `json:"latest-version"`
+	// Outdated is set when CurrentVersion is older than LatestVersion, never when they can't be compared
+	Outdated bool `json:"outdated"`
+	// NonSemver is set when the tag of the latest release is not a semantic version
+	NonSemver bool `json:"non-semver,omitempty"`
+	// ComparedBy is the strategy comparing CurrentVersion with the latest release, e.g. CompareSemver,
+	// empty when they were not compared
+	ComparedBy  string    `json:"compared-by,omitempty"`
+	PublishedAt time.Time `json:"published-at"`
+	ReleaseURL  string    `json:"release-url"`
+	// AssetName is the release asset for this platform, empty when the release has none
+	AssetName string `json:"asset-name,omitempty"`
+}
+
+// GetVersionCheckCallback returns a callback checking the latest release of tool against currentVersion,
+// currentVersion may be empty. If repoName is empty then tool name is considered as repoName
+func GetVersionCheckCallback(toolName, currentVersion, repoName string) func() (*VersionCheckResult, error) {
+	return versionCheckCallback(toolName, currentVersion, repoName)
+}
+
+// GetVersionCheckCallbackWithOptions is GetVersionCheckCallback configured with opts instead of the package
+// variables, its requests time out after VersionCheckTimeout
+func GetVersionCheckCallbackWithOptions(toolName, currentVersion, repoName string, opts Options) func() (*VersionCheckResult, error) {
+	// 版本检查只调用 api
+	opts.DownloadUpdateTimeout = opts.VersionCheckTimeout
+	return versionCheckCallback(toolName, currentVersion, repoName, WithOptions(opts))
+}
+
+// versionCheckCallback returns the version check of toolName with a downloader configured with opts
+func versionCheckCallback(toolName, currentVersion, repoName string, opts ...DownloaderOption) func() (*VersionCheckResult, error) {
+	return func() (*VersionCheckResult, error) {
+		if err := updateCheckDisabled(toolName); err != nil {
+			return nil, err
+		}
+		if repoName == "" {
+			repoName = toolName
+		}
+		gh, err := NewghReleaseDownloader(repoName, opts...)
+		if isRateLimited(err) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, errorutil.NewWithErr(err).Msgf("failed to download latest release got %v", err).WithTag("updater")
+		}
+		gh.SetToolName(toolName)
+		tag := gh.Latest.GetTagName()
+		result := &VersionCheckResult{
+			CurrentVersion: currentVersion,
+			LatestVersion:  tag,
+			PublishedAt:    gh.Latest.GetPublishedAt().Time,
+			ReleaseURL:     gh.releaseURL(),
+		}
+		if latest, err := semver.NewVersion(tag); err == nil {
+			result.LatestVersion = latest.String()
+		} else {
+			result.NonSemver = true
+		}
+		if currentVersion != "" {
+			if cmp, strategy, err := gh.compareVersion(currentVersion); err == nil {
+				result.Outdated, result.ComparedBy = cmp < 0, strategy
+			} else {
+				updateLog.Verbose().Msgf("%v", err)
+			}
+		}
+		if err := gh.getToolAssetID(gh.Latest); err == nil {
+			result.AssetName = gh.fullAssetName
+		} else {
+			updateLog.Verbose().Msgf("no asset of %v for this platform: %v", tag, err)
+		}
+		return result, nil
+	}
+}
+
+// releaseURL returns the web page of the latest release
+func (d *GHReleaseDownloader) releaseURL() string {
+	if url := d.Latest.GetHTMLURL(); url != "" {
+		return url
+	}
+	if d.forge == SourceGitLab {
+		return fmt.Sprintf("https://%v/-/releases/%v", d.SourceURL(), d.Latest.GetTagName())
+	}
+	return fmt.Sprintf("https://%v/releases/tag/%v", d.SourceURL(), d.Latest.GetTagName())
+}
+
+// readVersionChecks returns the recorded version checks, empty when there are none or they can't be read
+func readVersionChecks() map[string]versionCheck {
+	checks := make(map[string]versionCheck)
+	if data, err := versionChecks.read(); err == nil {
+		if err := json.Unmarshal(data, &checks); err != nil {
+			updateLog.Debug().Label("updater").Msgf("ignoring corrupted version checks %v: %v", versionChecks.name, err)
+			checks = make(map[string]versionCheck)
+		}
+	}
+	return checks
+}
+
+// GetCachedLatestVersion returns the latest version of tool, from the last version check of the same source when
+// it is more recent than VersionCheckTTL and else from github, recording it for the next runs. Recording it is
+// best effort, the record is replaced atomically
+func GetCachedLatestVersion(toolName, repoName string) (string, error) {
+	if err := updateCheckDisabled(toolName); err != nil {
+		return "", err
+	}
+	if repoName == "" {
+		repoName = toolName
+	}
+	source := repoName
+	if forge, orgName, name, err := parseSource(repoName); err == nil {
+		source = sourceName(forge, orgName, name)
+	}
+	versionCheckMutex.Lock()
+	check, ok := readVersionChecks()[repoName]
+	versionCheckMutex.Unlock()
+	if ok && !DisableVersionCache && check.Latest != "" && check.Repo == source && time.Since(check.Checked) < VersionCheckTTL {
+		return check.Latest, nil
+	}
+	result, err := GetVersionCheckCallback(toolName, "", repoName)()
+	if err != nil {
+		return "", err
+	}
+	// 非语义化版本的标签原样返回
+	latest := result.LatestVersion
+	versionCheckMutex.Lock()
+	defer versionCheckMutex.Unlock()
+	checks := readVersionChecks()
+	checks[repoName] = versionCheck{Latest: latest, Checked: time.Now(), Repo: source}
+	data, err := json.MarshalIndent(checks, "", "  ")
+	if err == nil {
+		err = versionChecks.write(data)
+	}
+	if err != nil {
+		// 记录失败只是下次需要重新检查
+		updateLog.Debug().Label("updater").Msgf("could not record version check in %v: %v", versionChecks.name, err)
+	}
+	return latest, nil
+}
+
+// GetCachedVersionDescription returns the description of current against the latest version of tool,
+// as GetVersionDescription does, without a request to github while the last version check is fresh
+func GetCachedVersionDescription(toolName, repoName, current string) (string, error) {
+	latest, err := GetCachedLatestVersion(toolName, repoName)
+	if err != nil {
+		return "", err
+	}
+	return GetVersionDescription(current, latest), nil
+}
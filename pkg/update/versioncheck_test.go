@@ -0,0 +1,132 @@
+package updateutils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+func TestGetCachedVersionDescription(t *testing.T) {
+	color.NoColor = true
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/banner", newToolRelease(t, "banner", "v1.1.0", []byte("bin-banner")))
+
+	tests := []struct {
+		name     string
+		current  string
+		want     string
+		requests int64
+	}{
+		{name: "cold", current: "v1.0.0", want: "(outdated)", requests: 1},
+		{name: "warm", current: "v1.1.0", want: "(latest)", requests: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := fake.apiRequests.Load()
+			got, err := GetCachedVersionDescription("banner", "banner", test.current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("GetCachedVersionDescription() = %q, want %q", got, test.want)
+			}
+			if requests := fake.apiRequests.Load() - before; requests != test.requests {
+				t.Errorf("version check sent %d api requests, want %d", requests, test.requests)
+			}
+		})
+	}
+
+	ttl := VersionCheckTTL
+	defer func() { VersionCheckTTL = ttl }()
+	VersionCheckTTL = time.Nanosecond
+	fake.AddRelease(Organization+"/banner", newToolRelease(t, "banner", "v1.2.0", []byte("bin-banner")))
+	if got, err := GetCachedLatestVersion("banner", "banner"); err != nil || got != "1.2.0" {
+		t.Errorf("GetCachedLatestVersion() after expiry = (%q, %v), want 1.2.0", got, err)
+	}
+}
+
+func TestGetVersionCheckCallback(t *testing.T) {
+	published := time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC)
+	fake := newFakeGitHub(t)
+	release := newToolRelease(t, "check", "v1.1.0", []byte("bin-check"))
+	release.PublishedAt = published
+	fake.AddRelease(Organization+"/check", release)
+	fake.AddRelease(Organization+"/snapshot", &fakeRelease{Tag: "nightly-20240201"})
+	asset := platformAssetName("check", "v1.1.0", Tar)
+	// 假 github 作为 enterprise 服务器, 发布页面在其主机上
+	host := strings.TrimPrefix(strings.TrimPrefix(fake.URL, "http://"), "https://")
+
+	tests := []struct {
+		name    string
+		tool    string
+		current string
+		want    VersionCheckResult
+	}{
+		{name: "outdated", tool: "check", current: "1.0.0", want: VersionCheckResult{CurrentVersion: "1.0.0", LatestVersion: "1.1.0", Outdated: true, ComparedBy: CompareSemver,
+			PublishedAt: published, ReleaseURL: "https://" + host + "/" + Organization + "/check/releases/tag/v1.1.0", AssetName: asset}},
+		{name: "latest", tool: "check", current: "v1.1.0", want: VersionCheckResult{CurrentVersion: "v1.1.0", LatestVersion: "1.1.0", ComparedBy: CompareSemver,
+			PublishedAt: published, ReleaseURL: "https://" + host + "/" + Organization + "/check/releases/tag/v1.1.0", AssetName: asset}},
+		// 非语义化版本的标签不报错
+		{name: "non semver", tool: "snapshot", current: "1.0.0", want: VersionCheckResult{CurrentVersion: "1.0.0", LatestVersion: "nightly-20240201", NonSemver: true,
+			ReleaseURL: "https://" + host + "/" + Organization + "/snapshot/releases/tag/nightly-20240201"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := GetVersionCheckCallback(test.tool, test.current, "")()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != test.want {
+				t.Errorf("GetVersionCheckCallback() = %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+	if got, err := GetToolVersionCallback("snapshot", "")(); err != nil || got != "nightly-20240201" {
+		t.Errorf("GetToolVersionCallback() of a non semver tag = (%q, %v), want the tag", got, err)
+	}
+}
+
+func TestGetCachedLatestVersionBypass(t *testing.T) {
+	fake := newFakeGitHub(t)
+	fake.AddRelease(Organization+"/bypass", newToolRelease(t, "bypass", "v1.0.0", []byte("bin-bypass")))
+	if got, err := GetCachedLatestVersion("bypass", ""); err != nil || got != "1.0.0" {
+		t.Fatalf("GetCachedLatestVersion() = (%q, %v), want 1.0.0", got, err)
+	}
+	fake.AddRelease(Organization+"/bypass", newToolRelease(t, "bypass", "v1.1.0", []byte("bin-bypass")))
+	before := fake.apiRequests.Load()
+	if got, _ := GetCachedLatestVersion("bypass", ""); got != "1.0.0" {
+		t.Errorf("GetCachedLatestVersion() within the ttl = %q, want the cached 1.0.0", got)
+	}
+	// 每次运行都调用 GetToolVersionCallback 的工具同样使用缓存
+	if got, err := GetToolVersionCallback("bypass", "")(); err != nil || got != "1.0.0" {
+		t.Errorf("GetToolVersionCallback() within the ttl = (%q, %v), want the cached 1.0.0", got, err)
+	}
+	if requests := fake.apiRequests.Load() - before; requests != 0 {
+		t.Errorf("lookups within the ttl sent %d api requests, want none", requests)
+	}
+
+	disable := DisableVersionCache
+	defer func() { DisableVersionCache = disable }()
+	DisableVersionCache = true
+	if got, _ := GetToolVersionCallback("bypass", "")(); got != "1.1.0" {
+		t.Errorf("GetToolVersionCallback() without the cache = %q, want 1.1.0", got)
+	}
+	if got, _ := GetCachedLatestVersion("bypass", ""); got != "1.1.0" {
+		t.Errorf("GetCachedLatestVersion() without the cache = %q, want 1.1.0", got)
+	}
+	DisableVersionCache = false
+
+	// 其他来源记录的版本不复用
+	checks := readVersionChecks()
+	checks["bypass"] = versionCheck{Latest: "9.9.9", Checked: time.Now(), Repo: "acme/bypass"}
+	data, _ := json.Marshal(checks)
+	if err := versionChecks.write(data); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := GetCachedLatestVersion("bypass", ""); got != "1.1.0" {
+		t.Errorf("GetCachedLatestVersion() with a check of another source = %q, want 1.1.0", got)
+	}
+}
@@ -0,0 +1,224 @@
+package updateutils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	errorutil "github.com/projectdiscovery/utils/errors"
+)
+
+// Strategies reported by the version comparisons
+const (
+	// CompareSemver compares semantic versions
+	CompareSemver = "semver"
+	// CompareCoerced compares versions coerced to numbers, e.g. 1.2.3.4 or nuclei-v2.9.1
+	CompareCoerced = "coerced version"
+	// CompareTag compares equal tags which are not versions
+	CompareTag = "tag"
+	// ComparePublishDate compares the publication dates of the releases
+	ComparePublishDate = "publish date"
+)
+
+// ReleaseVersion is a side of a version comparison
+type ReleaseVersion struct {
+	// Tool is the name of the tool
+	Tool string
+	// Tag is the version or the release tag
+	Tag string
+	// PublishedAt returns the publication date of the release tagged Tag, it is looked up on the first call
+	PublishedAt func() (time.Time, error)
+}
+
+// VersionComparer compares the installed version of a tool with a release, for release schemes the default
+// comparison doesn't handle
+type VersionComparer interface {
+	// Compare returns a negative number when current is older than latest, 0 when they are the same version
+	// and a positive number when current is newer, and the strategy of the comparison
+	Compare(current, latest ReleaseVersion) (int, string, error)
+}
+
+// VersionComparerFunc is a function comparing versions as a VersionComparer
+type VersionComparerFunc func(current, latest ReleaseVersion) (int, string, error)
+
+func (f VersionComparerFunc) Compare(current, latest ReleaseVersion) (int, string, error) {
+	return f(current, latest)
+}
+
+// DefaultVersionComparer compares strict semantic versions, then versions coerced to numbers removing the v
+// and the tool name prefixes and padding missing components, then the publication dates of the releases
+type DefaultVersionComparer struct{}
+
+func (DefaultVersionComparer) Compare(current, latest ReleaseVersion) (int, string, error) {
+	currentVer, currentErr := semver.NewVersion(current.Tag)
+	latestVer, latestErr := semver.NewVersion(latest.Tag)
+	if currentErr == nil && latestErr == nil {
+		return currentVer.Compare(latestVer), CompareSemver, nil
+	}
+	if currentCoerced, ok := coerceVersion(current.Tool, current.Tag); ok {
+		if latestCoerced, ok := coerceVersion(latest.Tool, latest.Tag); ok {
+			return currentCoerced.compare(latestCoerced), CompareCoerced, nil
+		}
+	}
+	if current.Tag == latest.Tag {
+		return 0, CompareTag, nil
+	}
+	if current.PublishedAt == nil || latest.PublishedAt == nil {
+		return 0, "", fmt.Errorf("%v and %v are not versions", current.Tag, latest.Tag)
+	}
+	currentDate, err := current.PublishedAt()
+	if err != nil {
+		return 0, "", fmt.Errorf("%v and %v are not versions, publish date of %v: %w", current.Tag, latest.Tag, current.Tag, err)
+	}
+	latestDate, err := latest.PublishedAt()
+	if err != nil {
+		return 0, "", fmt.Errorf("%v and %v are not versions, publish date of %v: %w", current.Tag, latest.Tag, latest.Tag, err)
+	}
+	if currentDate.IsZero() || latestDate.IsZero() {
+		return 0, "", fmt.Errorf("%v and %v are not versions and have no publish date", current.Tag, latest.Tag)
+	}
+	return currentDate.Compare(latestDate), ComparePublishDate, nil
+}
+
+// VersionComparison compares the installed versions with the releases, see WithVersionComparer
+var VersionComparison VersionComparer = DefaultVersionComparer{}
+
+// WithVersionComparer makes the downloader compare the installed version with the releases with comparer
+// instead of VersionComparison
+func WithVersionComparer(comparer VersionComparer) DownloaderOption {
+	return func(d *GHReleaseDownloader) {
+		d.comparer = comparer
+	}
+}
+
+var coercedVersionRegex = regexp.MustCompile(`^[vV]?(\d+(?:\.\d+)*)(?:([-_+])(.+))?$`)
+
+// coercedVersion is a version of any number of numeric components and an optional pre-release
+type coercedVersion struct {
+	components []uint64
+	prerelease string
+}
+
+// coerceVersion parses tag as a version without the tool name prefix, e.g. nuclei-v2.9.1 or 1.2.3.4
+func coerceVersion(tool, tag string) (coercedVersion, bool) {
+	tag = strings.TrimSpace(tag)
+	if tool != "" && len(tag) > len(tool) && strings.EqualFold(tag[:len(tool)], tool) {
+		if trimmed := strings.TrimLeft(tag[len(tool):], "-_/@ "); len(trimmed) < len(tag)-len(tool) {
+			tag = trimmed
+		}
+	}
+	rg := coercedVersionRegex.FindStringSubmatch(tag)
+	if rg == nil {
+		return coercedVersion{}, false
+	}
+	var version coercedVersion
+	for _, component := range strings.Split(rg[1], ".") {
+		n, err := strconv.ParseUint(component, 10, 64)
+		if err != nil {
+			return coercedVersion{}, false
+		}
+		version.components = append(version.components, n)
+	}
+	// + 之后是构建信息, 不参与比较
+	if rg[2] != "+" {
+		version.prerelease = rg[3]
+	}
+	return version, true
+}
+
+// compare returns the sign of v - other, the missing components are 0 and a pre-release precedes the release
+func (v coercedVersion) compare(other coercedVersion) int {
+	for i := 0; i < len(v.components) || i < len(other.components); i++ {
+		var a, b uint64
+		if i < len(v.components) {
+			a = v.components[i]
+		}
+		if i < len(other.components) {
+			b = other.components[i]
+		}
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.prerelease == other.prerelease:
+		return 0
+	case v.prerelease == "":
+		return 1
+	case other.prerelease == "":
+		return -1
+	}
+	a, errA := semver.NewVersion("0.0.0-" + strings.ReplaceAll(v.prerelease, "_", "-"))
+	b, errB := semver.NewVersion("0.0.0-" + strings.ReplaceAll(other.prerelease, "_", "-"))
+	if errA == nil && errB == nil {
+		return a.Compare(b)
+	}
+	return strings.Compare(v.prerelease, other.prerelease)
+}
+
+// compareVersion compares the installed version current with the latest release of the downloader and
+// returns the strategy, logged when the versions are not semantic versions
+func (d *GHReleaseDownloader) compareVersion(current string) (int, string, error) {
+	comparer := d.comparer
+	if comparer == nil {
+		comparer = VersionComparison
+	}
+	tool := d.executableName
+	if tool == "" {
+		tool = d.repoName
+	}
+	latest := ReleaseVersion{Tool: tool, Tag: d.Latest.GetTagName(), PublishedAt: func() (time.Time, error) {
+		return d.Latest.GetPublishedAt().Time, nil
+	}}
+	installed := ReleaseVersion{Tool: tool, Tag: current, PublishedAt: func() (time.Time, error) {
+		return d.publishedAt(current)
+	}}
+	cmp, strategy, err := comparer.Compare(installed, latest)
+	if err != nil {
+		return 0, "", errorutil.NewWithErr(err).Msgf("failed to compare %v with %v", current, latest.Tag)
+	}
+	if strategy != CompareSemver {
+		updateLog.Info().Label("updater").Msgf("%v and %v compared by %v", current, latest.Tag, strategy)
+	}
+	return cmp, strategy, nil
+}
+
+// publishedAt returns the publication date of the release tagged tag, with or without its v prefix
+func (d *GHReleaseDownloader) publishedAt(tag string) (time.Time, error) {
+	release, _, err := d.releaseByTag(tag)
+	if errors.Is(err, ErrReleaseNotFound) {
+		if strings.HasPrefix(tag, "v") {
+			release, _, err = d.releaseByTag(strings.TrimPrefix(tag, "v"))
+		} else {
+			release, _, err = d.releaseByTag("v" + tag)
+		}
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return release.GetPublishedAt().Time, nil
+}
+
+// displayVersion returns the version of tag as printed by the updates, the semantic version without its v
+// prefix and else the tag as is
+func displayVersion(tag string) string {
+	if version, err := semver.NewVersion(tag); err == nil {
+		return version.String()
+	}
+	return tag
+}
+
+// taggedVersion returns version as printed with a v prefix, only added to semantic versions
+func taggedVersion(version string) string {
+	if _, err := semver.NewVersion(version); err == nil && !strings.HasPrefix(version, "v") {
+		return "v" + version
+	}
+	return version
+}
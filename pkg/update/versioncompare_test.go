@@ -0,0 +1,100 @@
+package updateutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultVersionComparer(t *testing.T) {
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	published := func(date time.Time) func() (time.Time, error) {
+		return func() (time.Time, error) { return date, nil }
+	}
+	tests := []struct {
+		name            string
+		tool            string
+		current, latest string
+		currentDate     func() (time.Time, error)
+		latestDate      func() (time.Time, error)
+		want            int
+		strategy        string
+		wantErr         bool
+	}{
+		{name: "semver", current: "v1.2.3", latest: "v1.3.0", want: -1, strategy: CompareSemver},
+		{name: "semver without v", current: "1.3.0", latest: "v1.3.0", want: 0, strategy: CompareSemver},
+		{name: "downgrade", current: "2.0.0", latest: "v1.9.9", want: 1, strategy: CompareSemver},
+		{name: "pre-release", current: "v2.1.0-beta.3", latest: "v2.1.0", want: -1, strategy: CompareSemver},
+		{name: "dev build", current: "2.9.1-dev", latest: "v2.9.1", want: -1, strategy: CompareSemver},
+		{name: "calver", current: "2024.01.3", latest: "2024.02.1", want: -1, strategy: CompareSemver},
+		{name: "two components", current: "v1.0", latest: "v1.0.1", want: -1, strategy: CompareSemver},
+		{name: "four components", current: "1.2.3.4", latest: "1.2.3.10", want: -1, strategy: CompareCoerced},
+		{name: "padded components", current: "1.2.3.0", latest: "v1.2.3", want: 0, strategy: CompareCoerced},
+		{name: "tool prefix", tool: "nuclei", current: "2.9.1", latest: "nuclei-v2.9.2", want: -1, strategy: CompareCoerced},
+		{name: "tool prefix slash", tool: "nuclei", current: "nuclei/v3.0.0", latest: "nuclei/v2.9.2", want: 1, strategy: CompareCoerced},
+		{name: "uppercase v", current: "V2", latest: "V10", want: -1, strategy: CompareCoerced},
+		{name: "underscore pre-release", current: "v1.2.3_beta", latest: "v1.2.3", want: -1, strategy: CompareCoerced},
+		{name: "build metadata", current: "1.2.3.4+linux", latest: "1.2.3.4", want: 0, strategy: CompareCoerced},
+		{name: "same nightly", current: "nightly-20240115", latest: "nightly-20240115", want: 0, strategy: CompareTag},
+		{name: "nightly by date", current: "nightly-20240115", latest: "nightly-20240201", currentDate: published(day), latestDate: published(day.AddDate(0, 0, 17)), want: -1, strategy: ComparePublishDate},
+		{name: "commit tags by date", current: "build-9f2c1e", latest: "build-77ab03", currentDate: published(day), latestDate: published(day.AddDate(0, 0, -1)), want: 1, strategy: ComparePublishDate},
+		{name: "no publish date", current: "nightly-20240115", latest: "nightly-20240201", currentDate: published(time.Time{}), latestDate: published(day), wantErr: true},
+		{name: "release not found", current: "r122", latest: "r123", currentDate: func() (time.Time, error) { return time.Time{}, ErrReleaseNotFound }, latestDate: published(day), wantErr: true},
+		{name: "not versions", current: "latest", latest: "stable", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := ReleaseVersion{Tool: test.tool, Tag: test.current, PublishedAt: test.currentDate}
+			latest := ReleaseVersion{Tool: test.tool, Tag: test.latest, PublishedAt: test.latestDate}
+			got, strategy, err := DefaultVersionComparer{}.Compare(current, latest)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Compare(%v, %v) error = %v, want error %v", test.current, test.latest, err, test.wantErr)
+			}
+			if err == nil && (sign(got) != test.want || strategy != test.strategy) {
+				t.Errorf("Compare(%v, %v) = %d by %v, want %d by %v", test.current, test.latest, got, strategy, test.want, test.strategy)
+			}
+		})
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func TestUpdateToolNonSemverTags(t *testing.T) {
+	fake := newFakeGitHub(t)
+	day := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	release := newToolRelease(t, "snapshot", "nightly-20240201", []byte("bin-snapshot"))
+	release.PublishedAt = day
+	fake.AddRelease(Organization+"/snapshot", release)
+	fake.AddOlderRelease(Organization+"/snapshot", &fakeRelease{Tag: "nightly-20240115", PublishedAt: day.AddDate(0, 0, -17)})
+	fake.AddOlderRelease(Organization+"/snapshot", &fakeRelease{Tag: "nightly-20240301", PublishedAt: day.AddDate(0, 1, 0)})
+	fakeExecutable(t, "snapshot")
+
+	err := GetUpdateToolCheckCallback("snapshot", "nightly-20240115", "")()
+	if !errors.Is(err, ErrUpdateAvailable) || !strings.Contains(err.Error(), "would update snapshot nightly-20240115 -> nightly-20240201") {
+		t.Errorf("GetUpdateToolCheckCallback() of an older nightly = %v, want %v", err, ErrUpdateAvailable)
+	}
+	if err := GetUpdateToolCheckCallback("snapshot", "nightly-20240301", "")(); !errors.Is(err, ErrAlreadyLatest) {
+		t.Errorf("GetUpdateToolCheckCallback() of a newer nightly = %v, want %v", err, ErrAlreadyLatest)
+	}
+	if err := GetUpdateToolCheckCallback("snapshot", "nightly-20231201", "")(); err == nil || !strings.Contains(err.Error(), "failed to compare") {
+		t.Errorf("GetUpdateToolCheckCallback() of an unknown nightly = %v, want a comparison error", err)
+	}
+
+	comparison := VersionComparison
+	defer func() { VersionComparison = comparison }()
+	VersionComparison = VersionComparerFunc(func(current, latest ReleaseVersion) (int, string, error) {
+		return strings.Compare(current.Tag, latest.Tag), "tag order", nil
+	})
+	if err := GetUpdateToolCheckCallback("snapshot", "nightly-20231201", "")(); !errors.Is(err, ErrUpdateAvailable) {
+		t.Errorf("GetUpdateToolCheckCallback() with a custom comparer = %v, want %v", err, ErrUpdateAvailable)
+	}
+}
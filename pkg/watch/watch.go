@@ -0,0 +1,163 @@
+package watch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PollInterval is the interval the file is read at when file system notifications are unavailable
+var PollInterval = 2 * time.Second
+
+// Tailer sends the lines appended to a file, or written to a named pipe, as they arrive
+type Tailer struct {
+	Path string
+	// Poll reads the file every PollInterval instead of watching it, e.g. on network file systems
+	// which don't send notifications
+	Poll   bool
+	reload chan struct{}
+	// offset is the position of the first byte not read yet, partial the line not terminated yet
+	offset  int64
+	partial []byte
+	info    os.FileInfo
+}
+
+// New returns a tailer of path
+func New(path string) *Tailer {
+	return &Tailer{Path: path, reload: make(chan struct{}, 1)}
+}
+
+// Reload makes the tailer read the file again from its start, a no-op for named pipes
+func (t *Tailer) Reload() {
+	select {
+	case t.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends the lines of the file and those appended later to lines until ctx is done. A
+// truncated or replaced file is read again from its start
+func (t *Tailer) Run(ctx context.Context, lines chan<- string) error {
+	info, err := os.Stat(t.Path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeNamedPipe != 0 {
+		return t.runPipe(ctx, lines)
+	}
+	var events chan fsnotify.Event
+	var watchErrors chan error
+	var tick <-chan time.Time
+	if !t.Poll {
+		watcher, err := fsnotify.NewWatcher()
+		if err == nil {
+			defer watcher.Close()
+			// 监听目录, 文件被替换后仍能收到事件
+			err = watcher.Add(filepath.Dir(t.Path))
+		}
+		if err == nil {
+			events, watchErrors = watcher.Events, watcher.Errors
+		}
+	}
+	if events == nil {
+		ticker := time.NewTicker(PollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	path, _ := filepath.Abs(t.Path)
+	for {
+		if err := t.read(ctx, lines); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-t.reload:
+				t.offset, t.partial = 0, nil
+				break wait
+			case <-tick:
+				break wait
+			case <-watchErrors:
+				// 事件可能丢失, 重新读取即可
+				break wait
+			case event := <-events:
+				if name, _ := filepath.Abs(event.Name); name == path {
+					break wait
+				}
+			}
+		}
+	}
+}
+
+// read sends the complete lines appended since the last read
+func (t *Tailer) read(ctx context.Context, lines chan<- string) error {
+	file, err := os.Open(t.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if t.info != nil && !os.SameFile(t.info, info) || info.Size() < t.offset {
+		t.offset, t.partial = 0, nil
+	}
+	t.info = info
+	if _, err := file.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", t.Path, err)
+	}
+	t.offset += int64(len(data))
+	data = append(t.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	t.partial = append([]byte(nil), data[end+1:]...)
+	if end < 0 {
+		return nil
+	}
+	for _, line := range bytes.Split(data[:end], []byte{'\n'}) {
+		select {
+		case lines <- string(bytes.TrimSuffix(line, []byte{'\r'})):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// runPipe reads the lines written to a named pipe by any number of successive writers
+func (t *Tailer) runPipe(ctx context.Context, lines chan<- string) error {
+	// 以读写方式打开, 打开时不会阻塞, 写入方关闭后也不会读到 EOF
+	file, err := os.OpenFile(t.Path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = file.Close()
+	}()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		select {
+		case lines <- scanner.Text():
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
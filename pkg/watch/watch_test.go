@@ -0,0 +1,96 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// expectLines waits for the next lines sent by the tailer
+func expectLines(t *testing.T, lines <-chan string, want ...string) {
+	t.Helper()
+	for _, line := range want {
+		select {
+		case got := <-lines:
+			if got != line {
+				t.Fatalf("got line %q, want %q", got, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for line %q", line)
+		}
+	}
+	select {
+	case got := <-lines:
+		t.Fatalf("unexpected line %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTailer(t *testing.T) {
+	PollInterval = 50 * time.Millisecond
+	for _, poll := range []bool{false, true} {
+		t.Run(map[bool]string{false: "notify", true: "poll"}[poll], func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "targets.txt")
+			appendFile(t, path, "a.example.com\r\nb.example.com\n")
+			tailer := New(path)
+			tailer.Poll = poll
+			ctx, cancel := context.WithCancel(context.Background())
+			lines := make(chan string)
+			done := make(chan error)
+			go func() { done <- tailer.Run(ctx, lines) }()
+
+			expectLines(t, lines, "a.example.com", "b.example.com")
+			// 未写完的行等到换行后才发送
+			appendFile(t, path, "c.exam")
+			expectLines(t, lines)
+			appendFile(t, path, "ple.com\n")
+			expectLines(t, lines, "c.example.com")
+			tailer.Reload()
+			expectLines(t, lines, "a.example.com", "b.example.com", "c.example.com")
+			// 截断后从头读取
+			if err := os.WriteFile(path, []byte("d\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			expectLines(t, lines, "d")
+			// 替换文件后从头读取
+			replacement := path + ".new"
+			if err := os.WriteFile(replacement, []byte("e\nf\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(replacement, path); err != nil {
+				t.Fatal(err)
+			}
+			expectLines(t, lines, "e", "f")
+
+			cancel()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run did not return after cancel")
+			}
+		})
+	}
+}
+
+func TestTailerMissingFile(t *testing.T) {
+	if err := New(filepath.Join(t.TempDir(), "missing")).Run(context.Background(), make(chan string)); !os.IsNotExist(err) {
+		t.Fatalf("Run = %v, want a not exist error", err)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTailerPipe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.fifo")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Skipf("mkfifo: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan string)
+	done := make(chan error)
+	go func() { done <- New(path).Run(ctx, lines) }()
+	// 多个写入方先后写入, 前一个关闭后继续读取
+	for _, line := range []string{"a.example.com", "b.example.com"} {
+		writer, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = writer.WriteString(line + "\n")
+		_ = writer.Close()
+		expectLines(t, lines, line)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
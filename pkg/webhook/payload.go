@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/wjlin0/CVE-2024-23897/pkg/ledger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"time"
+)
+
+// PayloadVersion is the version of the webhook payload. Breaking changes to Payload or Finding
+// (renamed, removed or retyped fields) must bump it, TestSchemaGolden fails until they do.
+// Version 2 reports the files read from a target as the Files of one finding
+const PayloadVersion = 2
+
+// FlatPayloadVersion is the version of the payloads without Files reporting every read file on its
+// own, sent with -flat-results
+const FlatPayloadVersion = 1
+
+// Payload is the body POSTed to the webhook for every new or changed finding
+type Payload struct {
+	// Version is the payload version, receivers should reject versions they don't know
+	Version int `json:"version"`
+	// Tool is the name of the sender
+	Tool string `json:"tool"`
+	// Timestamp is when the finding was reported
+	Timestamp time.Time `json:"timestamp"`
+	// Finding is the reported finding
+	Finding Finding `json:"finding"`
+}
+
+// Finding is a finding reported by the webhook
+type Finding struct {
+	// Key identifies the finding across runs: host, check and file path
+	Key string `json:"key"`
+	// ContentHash is the sha256 of Response, or of the sha256 of the Files, it changes when the leaked content changes
+	ContentHash     string   `json:"content-hash"`
+	CheckID         string   `json:"check-id"`
+	URL             string   `json:"url"`
+	Host            string   `json:"host"`
+	Port            int      `json:"port"`
+	Mode            string   `json:"mode"`
+	Command         string   `json:"command,omitempty"`
+	Filename        string   `json:"filename,omitempty"`
+	Response        string   `json:"response,omitempty"`
+	FullRead        bool     `json:"full-read"`
+	InterestScore   int      `json:"interest-score"`
+	InterestReasons []string `json:"interest-reasons,omitempty"`
+	// Verdict is set on targets refusing anonymous users, auth_required_possibly_vulnerable or auth_required_confirmed
+	Verdict string `json:"verdict,omitempty"`
+	// Files are the files read from the target, without their content (version 2)
+	Files []File `json:"files,omitempty"`
+}
+
+// File is a file read from a target, see output.FileRecord
+type File struct {
+	Path            string   `json:"path"`
+	RequestedVia    string   `json:"requested-via,omitempty"`
+	Complete        bool     `json:"complete"`
+	Size            int      `json:"size"`
+	SHA256          string   `json:"sha256,omitempty"`
+	Error           string   `json:"error,omitempty"`
+	InterestScore   int      `json:"interest-score"`
+	InterestReasons []string `json:"interest-reasons,omitempty"`
+}
+
+// NewPayload returns the payload reporting event
+func NewPayload(tool string, event *output.ResultEvent, now time.Time) *Payload {
+	payload := NewFlatPayload(tool, event, now)
+	payload.Version = PayloadVersion
+	if len(event.Files) == 0 {
+		return payload
+	}
+	hash := sha256.New()
+	for _, file := range event.Files {
+		payload.Finding.Files = append(payload.Finding.Files, File{
+			Path:            file.Path,
+			RequestedVia:    file.RequestedVia,
+			Complete:        file.Complete,
+			Size:            file.Size,
+			SHA256:          file.SHA256,
+			Error:           file.Error,
+			InterestScore:   file.InterestScore,
+			InterestReasons: file.InterestReasons,
+		})
+		hash.Write([]byte(file.Path + "\x00" + file.SHA256 + "\x00" + file.Error + "\n"))
+	}
+	payload.Finding.ContentHash = hex.EncodeToString(hash.Sum(nil))
+	return payload
+}
+
+// NewFlatPayload returns the version 1 payload reporting event, without its Files
+func NewFlatPayload(tool string, event *output.ResultEvent, now time.Time) *Payload {
+	return &Payload{
+		Version:   FlatPayloadVersion,
+		Tool:      tool,
+		Timestamp: now.UTC(),
+		Finding: Finding{
+			Key:             ledger.Key(event),
+			ContentHash:     ledger.ContentHash(event),
+			CheckID:         event.CheckID,
+			URL:             event.URL,
+			Host:            event.Host,
+			Port:            event.Port,
+			Mode:            event.Mode.String(),
+			Command:         event.Command,
+			Filename:        event.Args,
+			Response:        event.Response,
+			FullRead:        event.FullRead,
+			InterestScore:   event.InterestScore,
+			InterestReasons: event.InterestReasons,
+			Verdict:         event.Verdict,
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Receiver is an example webhook receiver. It accepts PayloadVersion and FlatPayloadVersion, rejects
+// unknown payload versions and drops retried deliveries it already accepted.
+type Receiver struct {
+	// FailFirst makes the first n requests fail with 503, used to exercise the sender retries
+	FailFirst int
+
+	mutex      sync.Mutex
+	requests   int
+	deliveries map[string]struct{}
+	payloads   []*Payload
+}
+
+// NewReceiver returns an empty receiver
+func NewReceiver() *Receiver {
+	return &Receiver{deliveries: make(map[string]struct{})}
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests++
+	if r.requests <= r.FailFirst {
+		http.Error(w, "try again later", http.StatusServiceUnavailable)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.Version != PayloadVersion && payload.Version != FlatPayloadVersion {
+		http.Error(w, fmt.Sprintf("unsupported payload version %d", payload.Version), http.StatusBadRequest)
+		return
+	}
+	delivery := req.Header.Get(DeliveryHeader)
+	if _, ok := r.deliveries[delivery]; ok && delivery != "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	r.deliveries[delivery] = struct{}{}
+	r.payloads = append(r.payloads, &payload)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Payloads returns the accepted payloads
+func (r *Receiver) Payloads() []*Payload {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]*Payload{}, r.payloads...)
+}
+
+// Requests returns the number of requests received, retries included
+func (r *Receiver) Requests() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.requests
+}
@@ -0,0 +1,77 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema returns the JSON Schema of the current payload version
+func Schema() ([]byte, error) {
+	return schema(PayloadVersion)
+}
+
+// FlatSchema returns the JSON Schema of the payloads sent with -flat-results, without the files
+func FlatSchema() ([]byte, error) {
+	return schema(FlatPayloadVersion)
+}
+
+func schema(version int) ([]byte, error) {
+	schema := schemaOf(reflect.TypeOf(Payload{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = fmt.Sprintf("https://github.com/wjlin0/CVE-2024-23897/webhook/v%d", version)
+	schema["title"] = "CVE-2024-23897 webhook payload"
+	schema["properties"].(map[string]interface{})["version"].(map[string]interface{})["const"] = version
+	if version == FlatPayloadVersion {
+		finding := schema["properties"].(map[string]interface{})["finding"].(map[string]interface{})
+		delete(finding["properties"].(map[string]interface{}), "files")
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func schemaOf(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaOf(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	errorutil "github.com/projectdiscovery/utils/errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// DeliveryHeader carries an id identical across the retries of one delivery, receivers may use it to drop duplicates
+	DeliveryHeader = "X-Webhook-Delivery"
+	// VersionHeader carries the payload version
+	VersionHeader = "X-Webhook-Version"
+)
+
+// Sender POSTs payloads to a webhook, retrying on network errors, 429 and 5xx responses
+type Sender struct {
+	URL     string
+	Client  *http.Client
+	Retries int
+	// Backoff is waited before the n-th retry, multiplied by n
+	Backoff time.Duration
+}
+
+// NewSender returns a sender for url with the default retry policy
+func NewSender(url string, client *http.Client) *Sender {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Sender{URL: url, Client: client, Retries: 3, Backoff: time.Second}
+}
+
+// Send delivers payload, every attempt carrying the same delivery id
+func (s *Sender) Send(ctx context.Context, payload *Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	delivery, err := newDeliveryID()
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for attempt := 0; attempt <= s.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(s.Backoff * time.Duration(attempt)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		retry, err := s.send(ctx, body, delivery, payload.Version)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+	}
+	return errorutil.NewWithErr(lastErr).Msgf("failed to deliver webhook to %v", s.URL)
+}
+
+func (s *Sender) send(ctx context.Context, body []byte, delivery string, version int) (retry bool, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(DeliveryHeader, delivery)
+	request.Header.Set(VersionHeader, fmt.Sprint(version))
+	resp, err := s.Client.Do(request)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func newDeliveryID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
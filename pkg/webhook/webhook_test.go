@@ -0,0 +1,145 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/wjlin0/CVE-2024-23897/pkg/ledger"
+	"github.com/wjlin0/CVE-2024-23897/pkg/output"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestSchemaGolden fails when the payload changes without a matching golden schema,
+// breaking changes must bump PayloadVersion and add a new golden file
+func TestSchemaGolden(t *testing.T) {
+	for version, generate := range map[int]func() ([]byte, error){PayloadVersion: Schema, FlatPayloadVersion: FlatSchema} {
+		schema, err := generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden, err := os.ReadFile(filepath.Join("testdata", fmt.Sprintf("payload.v%d.schema.json", version)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bytes.TrimSpace(schema), bytes.TrimSpace(golden)) {
+			t.Errorf("schema of version %d does not match testdata/payload.v%d.schema.json", version, version)
+		}
+	}
+}
+
+func TestPayloadFiles(t *testing.T) {
+	event := &output.ResultEvent{Host: "127.0.0.1", Port: 8080, URL: "http://127.0.0.1:8080", CheckID: "CVE-2024-23897", Mode: output.ModeReadFile, Files: []*output.FileRecord{
+		{Path: "/etc/passwd", RequestedVia: "connect-node", Complete: true, Size: 31, SHA256: "af36", Content: "root:x:0:0:root:/root:/bin/bash"},
+		{Path: "/nope", RequestedVia: "connect-node", Error: "no such file"},
+	}}
+	payload := NewPayload("CVE-2024-23897", event, time.Now())
+	want := []File{
+		{Path: "/etc/passwd", RequestedVia: "connect-node", Complete: true, Size: 31, SHA256: "af36"},
+		{Path: "/nope", RequestedVia: "connect-node", Error: "no such file"},
+	}
+	if payload.Version != PayloadVersion || !reflect.DeepEqual(payload.Finding.Files, want) {
+		t.Errorf("NewPayload() = version %d with files %+v, want %+v", payload.Version, payload.Finding.Files, want)
+	}
+	previous := payload.Finding.ContentHash
+	event.Files[0].SHA256 = "b7e2"
+	if NewPayload("CVE-2024-23897", event, time.Now()).Finding.ContentHash == previous {
+		t.Error("changed file should change the content hash")
+	}
+
+	flat := NewFlatPayload("CVE-2024-23897", event, time.Now())
+	data, err := json.Marshal(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flat.Version != FlatPayloadVersion || bytes.Contains(data, []byte(`"files"`)) {
+		t.Errorf("NewFlatPayload() = %s, want version %d without files", data, FlatPayloadVersion)
+	}
+
+	receiver := NewReceiver()
+	var versions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		versions = append(versions, r.Header.Get(VersionHeader))
+		receiver.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	sender := NewSender(server.URL, nil)
+	for _, payload := range []*Payload{payload, flat} {
+		if err := sender.Send(context.Background(), payload); err != nil {
+			t.Fatalf("Send() of version %d = %v", payload.Version, err)
+		}
+	}
+	if !reflect.DeepEqual(versions, []string{"2", "1"}) || len(receiver.Payloads()) != 2 {
+		t.Errorf("receiver accepted %d payloads with version headers %v", len(receiver.Payloads()), versions)
+	}
+}
+
+func TestSenderContract(t *testing.T) {
+	receiver := NewReceiver()
+	receiver.FailFirst = 2
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	l, err := ledger.Open(filepath.Join(t.TempDir(), "findings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	sender := NewSender(server.URL, nil)
+	sender.Backoff = 10 * time.Millisecond
+	event := &output.ResultEvent{Host: "127.0.0.1", Port: 8080, URL: "http://127.0.0.1:8080", CheckID: "CVE-2024-23897", Mode: output.ModeReadFile, Command: "reload-job", Args: "/etc/passwd", Response: "root:x:0:0:root:/root:/bin/bash"}
+	// 模拟两次定时运行, 第三次内容发生变化
+	for i, response := range []string{event.Response, event.Response, "root:x:0:0:root:/root:/bin/sh"} {
+		event.Response = response
+		changed, err := l.Record(event, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !changed {
+			continue
+		}
+		if err := sender.Send(context.Background(), NewPayload("CVE-2024-23897", event, time.Now())); err != nil {
+			t.Fatalf("run %d: Send() = %v", i, err)
+		}
+	}
+
+	payloads := receiver.Payloads()
+	if len(payloads) != 2 {
+		t.Fatalf("receiver accepted %d payloads, want 2", len(payloads))
+	}
+	if receiver.Requests() != 4 {
+		t.Errorf("receiver got %d requests, want 4 (2 retries + 2 deliveries)", receiver.Requests())
+	}
+	for _, payload := range payloads {
+		if payload.Version != PayloadVersion || payload.Finding.Key != ledger.Key(event) {
+			t.Errorf("unexpected payload %+v", payload)
+		}
+	}
+	if payloads[0].Finding.ContentHash == payloads[1].Finding.ContentHash {
+		t.Error("changed finding should carry a new content hash")
+	}
+}
+
+func TestSenderNoRetryOnClientError(t *testing.T) {
+	receiver := NewReceiver()
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	sender := NewSender(server.URL, nil)
+	sender.Backoff = 10 * time.Millisecond
+	payload := NewPayload("CVE-2024-23897", &output.ResultEvent{URL: server.URL}, time.Now())
+	payload.Version = PayloadVersion + 1
+	if err := sender.Send(context.Background(), payload); err == nil {
+		t.Error("Send() of an unknown payload version should fail")
+	}
+	if receiver.Requests() != 1 {
+		t.Errorf("receiver got %d requests, want 1", receiver.Requests())
+	}
+}